@@ -0,0 +1,15 @@
+package domain
+
+// Post is an article written by a user.
+//
+// table: "posts"
+// index: idx_posts_author(author_id)
+// check: chk_posts_title(length(title) > 0)
+type Post struct {
+	ID       string `db:"id,pk,type=uuid,default=gen_random_uuid()"`
+	AuthorID string `db:"author_id,notnull,type=uuid,fk=users.id,delete=cascade"`
+	Title    string `db:"title,notnull"`
+	Body     string `db:"body"`
+
+	BaseTimestamped
+}
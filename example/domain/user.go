@@ -0,0 +1,13 @@
+package domain
+
+// User is a registered account.
+//
+// table: "users"
+// index: idx_users_created_at(created_at)
+type User struct {
+	ID    string `db:"id,pk,type=uuid,default=gen_random_uuid()"`
+	Email string `db:"email,notnull,unique"`
+	Name  string `db:"name,notnull"`
+
+	BaseTimestamped
+}
@@ -0,0 +1,47 @@
+// Package access guards the remote APIs of migrateme: the HTTP handler of
+// pkg/runner and the gRPC service of serve.
+package access
+
+import (
+	"crypto/subtle"
+	"strings"
+	"sync"
+)
+
+// Bearer reports whether authorization, the value of an Authorization
+// header or metadata entry, carries token. The comparison takes constant
+// time; an empty token matches nothing, which disables the API.
+func Bearer(authorization, token string) bool {
+	if token == "" {
+		return false
+	}
+	got, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// Exclusive lets one operation at a time run per key, e.g. per service,
+// and refuses others instead of queueing them. The zero value is ready to
+// use.
+type Exclusive struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// TryAcquire marks key as running and returns the function ending it, or
+// false when an operation on key is already running.
+func (e *Exclusive) TryAcquire(key string) (release func(), ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running[key] {
+		return nil, false
+	}
+	if e.running == nil {
+		e.running = map[string]bool{}
+	}
+	e.running[key] = true
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.running, key)
+	}, true
+}
@@ -0,0 +1,48 @@
+package access
+
+import "testing"
+
+func TestBearer(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		header, token string
+		want          bool
+	}{
+		{"Bearer secret", "secret", true},
+		{"Bearer guess", "secret", false},
+		{"secret", "secret", false},
+		{"bearer secret", "secret", false},
+		{"Bearer ", "", false},
+		{"", "", false},
+	}
+	for _, tc := range cases {
+		if got := Bearer(tc.header, tc.token); got != tc.want {
+			t.Errorf("Bearer(%q, %q) = %v, want %v", tc.header, tc.token, got, tc.want)
+		}
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	t.Parallel()
+
+	var e Exclusive
+	release, ok := e.TryAcquire("billing")
+	if !ok {
+		t.Fatal("first acquire refused")
+	}
+	if _, ok := e.TryAcquire("billing"); ok {
+		t.Error("second acquire of the same key succeeded")
+	}
+	other, ok := e.TryAcquire("orders")
+	if !ok {
+		t.Error("acquire of another key refused")
+	}
+	other()
+	release()
+	if release, ok := e.TryAcquire("billing"); !ok {
+		t.Error("acquire after release refused")
+	} else {
+		release()
+	}
+}
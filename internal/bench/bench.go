@@ -0,0 +1,178 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/schema"
+)
+
+type Result struct {
+	Name       string
+	Tables     int
+	Columns    int
+	Iterations int
+	Statements int
+	Total      time.Duration
+}
+
+func (r Result) PerOp() time.Duration {
+	if r.Iterations == 0 {
+		return 0
+	}
+	return r.Total / time.Duration(r.Iterations)
+}
+
+func (r Result) PerTable() time.Duration {
+	if r.Iterations == 0 || r.Tables == 0 {
+		return 0
+	}
+	return r.Total / time.Duration(r.Iterations*r.Tables)
+}
+
+var syntheticTypes = []string{"text", "integer", "bigint", "boolean", "timestamptz", "varchar(64)", "jsonb"}
+
+// SyntheticSchemas builds a registry-like set of tables: every table has a
+// bigint primary key, `columns` data columns of mixed types, a unique column,
+// an index, a check, and (except the first one) a FK to the previous table.
+func SyntheticSchemas(tables, columns int) []migrate.TableSchema {
+	out := make([]migrate.TableSchema, 0, tables)
+
+	for t := 0; t < tables; t++ {
+		name := fmt.Sprintf("bench_t%04d", t)
+		s := migrate.TableSchema{
+			TableName: name,
+			Columns: []migrate.ColumnMeta{
+				{FieldName: "ID", ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true}},
+			},
+			Indexes: []migrate.IndexMeta{},
+			Checks:  []migrate.CheckMeta{},
+		}
+
+		for c := 0; c < columns; c++ {
+			col := migrate.ColumnMeta{
+				FieldName:  fmt.Sprintf("C%d", c),
+				ColumnName: fmt.Sprintf("c%03d", c),
+				Idx:        c + 1,
+				Attrs:      migrate.ColumnAttributes{PgType: syntheticTypes[c%len(syntheticTypes)]},
+			}
+			if c == 0 {
+				col.Attrs.Unique = true
+			}
+			s.Columns = append(s.Columns, col)
+		}
+
+		if t > 0 {
+			s.Columns = append(s.Columns, migrate.ColumnMeta{
+				FieldName:  "ParentID",
+				ColumnName: "parent_id",
+				Idx:        columns + 1,
+				Attrs: migrate.ColumnAttributes{
+					PgType: "bigint",
+					ForeignKey: &migrate.ForeignKey{
+						Table:    fmt.Sprintf("bench_t%04d", t-1),
+						Column:   "id",
+						OnDelete: migrate.Cascade,
+					},
+				},
+			})
+		}
+
+		if columns > 1 {
+			s.Indexes = append(s.Indexes, migrate.IndexMeta{Columns: []string{"c001"}})
+		}
+		s.Checks = append(s.Checks, migrate.CheckMeta{Expr: "id > 0"})
+
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// Mutate returns copies of the schemas with one column added and one column
+// type changed per table, so the diff has to walk every column.
+func Mutate(schemas []migrate.TableSchema) []migrate.TableSchema {
+	out := make([]migrate.TableSchema, 0, len(schemas))
+	for _, s := range schemas {
+		cp := s
+		cp.Columns = append([]migrate.ColumnMeta(nil), s.Columns...)
+		if len(cp.Columns) > 1 {
+			cp.Columns[1].Attrs.PgType = "text"
+			cp.Columns[1].Attrs.NotNull = !cp.Columns[1].Attrs.NotNull
+		}
+		cp.Columns = append(cp.Columns, migrate.ColumnMeta{
+			FieldName:  "Extra",
+			ColumnName: "extra",
+			Idx:        len(cp.Columns),
+			Attrs:      migrate.ColumnAttributes{PgType: "text"},
+		})
+		out = append(out, cp)
+	}
+	return out
+}
+
+// DiffCreate measures DiffSchemas against an empty database (CREATE TABLE path).
+func DiffCreate(schemas []migrate.TableSchema, columns, iterations int) Result {
+	g := schema.NewDiffGenerator()
+	res := Result{Name: "diff/create", Tables: len(schemas), Columns: columns, Iterations: iterations}
+
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		res.Statements = 0
+		for _, s := range schemas {
+			d := g.DiffSchemas(migrate.TableSchema{TableName: s.TableName}, s)
+			res.Statements += len(d.Up)
+		}
+	}
+	res.Total = time.Since(start)
+	return res
+}
+
+// DiffAlter measures DiffSchemas between two existing versions of every table.
+func DiffAlter(schemas []migrate.TableSchema, columns, iterations int) Result {
+	g := schema.NewDiffGenerator()
+	mutated := Mutate(schemas)
+	res := Result{Name: "diff/alter", Tables: len(schemas), Columns: columns, Iterations: iterations}
+
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		res.Statements = 0
+		for j := range schemas {
+			d := g.DiffSchemas(schemas[j], mutated[j])
+			res.Statements += len(d.Up)
+		}
+	}
+	res.Total = time.Since(start)
+	return res
+}
+
+// Fetch measures Fetcher over the synthetic tables. The tables must already
+// exist in the database reachable through q.
+func Fetch(ctx context.Context, q schema.PgxQuerier, schemas []migrate.TableSchema, columns, iterations int) (Result, error) {
+	f := schema.NewFetcher(q)
+	res := Result{Name: "fetch", Tables: len(schemas), Columns: columns, Iterations: iterations}
+
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		for _, s := range schemas {
+			if _, err := f.Fetch(ctx, s.TableName); err != nil {
+				return res, fmt.Errorf("fetch %s: %w", s.TableName, err)
+			}
+		}
+	}
+	res.Total = time.Since(start)
+	return res, nil
+}
+
+// CreateStatements returns DDL creating the synthetic tables in dependency order.
+func CreateStatements(schemas []migrate.TableSchema) []string {
+	g := schema.NewDiffGenerator()
+	var out []string
+	for _, s := range schemas {
+		d := g.DiffSchemas(migrate.TableSchema{TableName: s.TableName}, s)
+		out = append(out, d.Up...)
+	}
+	return out
+}
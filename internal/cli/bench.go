@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/amr0ny/migrateme/internal/bench"
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/spf13/cobra"
+)
+
+func NewBenchCommand() *cobra.Command {
+	var tables, columns, iterations int
+	var fetch bool
+
+	cmd := &cobra.Command{
+		Use:    "bench",
+		Short:  "Measure diff and introspection performance on synthetic registries",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tables <= 0 || columns <= 0 || iterations <= 0 {
+				return fmt.Errorf("--tables, --columns and --iterations must be >= 1")
+			}
+
+			schemas := bench.SyntheticSchemas(tables, columns)
+			results := []bench.Result{
+				bench.DiffCreate(schemas, columns, iterations),
+				bench.DiffAlter(schemas, columns, iterations),
+			}
+
+			if fetch {
+				res, err := benchFetch(cmd.Context(), schemas, columns, iterations)
+				if err != nil {
+					return err
+				}
+				results = append(results, res)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "BENCHMARK\tTABLES\tCOLUMNS\tITERATIONS\tSTATEMENTS\tTOTAL\tPER OP\tPER TABLE")
+			for _, r := range results {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+					r.Name, r.Tables, r.Columns, r.Iterations, r.Statements, r.Total, r.PerOp(), r.PerTable())
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().IntVar(&tables, "tables", 100, "Number of synthetic tables")
+	cmd.Flags().IntVar(&columns, "columns", 10, "Number of data columns per table")
+	cmd.Flags().IntVar(&iterations, "iterations", 5, "Number of iterations per benchmark")
+	cmd.Flags().BoolVar(&fetch, "fetch", false, "Also benchmark schema introspection against the configured database")
+	return cmd
+}
+
+// benchFetch creates the synthetic tables inside a transaction, fetches them
+// through that transaction and rolls everything back afterwards.
+func benchFetch(ctx context.Context, schemas []migrate.TableSchema, columns, iterations int) (bench.Result, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return bench.Result{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := database.NewDB(ctx, cfg.GetDSN())
+	if err != nil {
+		return bench.Result{}, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return bench.Result{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, stmt := range bench.CreateStatements(schemas) {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return bench.Result{}, fmt.Errorf("create synthetic tables: %w", err)
+		}
+	}
+
+	return bench.Fetch(ctx, tx, schemas, columns, iterations)
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+func NewCheckTagsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check-tags",
+		Short: "Check the db tags of all entities",
+		Long: `Check-tags loads the entities from entity_paths and reports db tags that
+would be ignored or produce failing SQL: unknown options, a type= that
+cannot be parsed, a default on a serial column, unique on a primary key,
+malformed fk=, delete= and update= values, and foreign keys to tables or
+columns no entity declares. Each problem points at the struct field.
+
+Problems can be silenced per field or entity with // migrate:ignore <code>,
+or globally with diagnostics.suppress.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := checkRegistry(cmd, cfg); err != nil {
+				return err
+			}
+			policy, err := migrate.ParseIdentifierPolicy(cfg.Migrations.Identifiers)
+			if err != nil {
+				return withCode(codeConfig, err)
+			}
+
+			reporter := cfg.Reporter()
+			for _, d := range schema.CheckTags(cfg.Entities, policy) {
+				reporter.Report(d)
+			}
+
+			// Discovery warnings were reported while loading the config.
+			found := reporter.Diagnostics()
+			var errs int
+			for _, d := range found {
+				if d.Severity == diagnostics.Error {
+					errs++
+				}
+			}
+			if errs > 0 {
+				return withCode(codeValidation, fmt.Errorf("%d problems in entity tags must be fixed", errs))
+			}
+
+			if jsonOutput(cmd) {
+				return writeJSON(os.Stdout, struct {
+					Valid       bool                     `json:"valid"`
+					Entities    int                      `json:"entities"`
+					Diagnostics []diagnostics.Diagnostic `json:"diagnostics"`
+				}{Valid: true, Entities: len(cfg.Entities), Diagnostics: nonNilDiagnostics(found)})
+			}
+
+			if len(found) == 0 {
+				fmt.Printf("Tags of %d entities are valid\n", len(cfg.Entities))
+			} else {
+				fmt.Printf("Tags of %d entities are valid, with %d warnings\n", len(cfg.Entities), len(found))
+			}
+			return nil
+		},
+	}
+	return cmd
+}
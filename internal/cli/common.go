@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/internal/logging"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/spf13/cobra"
+)
+
+// loaded is the config of the running command, kept so that diagnostics can
+// be attached to JSON error output.
+var loaded *config.Config
+
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, withCode(codeConfig, fmt.Errorf("failed to load config: %w", err))
+	}
+	loaded = cfg
+	return cfg, nil
+}
+
+// connectDB connects to the configured database; extra options override the
+// configured ones.
+func connectDB(ctx context.Context, cmd *cobra.Command, cfg *config.Config, extra ...database.Option) (*database.DB, error) {
+	opts := append(cfg.DBOptions(), database.OnRetry(func(attempt int, err error, wait time.Duration) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "database not ready (attempt %d/%d): %v; retrying in %s\n",
+			attempt, cfg.Database.Retry.Attempts, err, wait)
+	}))
+	opts = append(opts, extra...)
+	if logger, err := sqlLogger(cmd, cfg); err != nil {
+		return nil, err
+	} else if logger != nil {
+		opts = append(opts, database.WithTracer(&database.SQLLogger{Logger: logger}))
+	}
+
+	db, err := database.NewDB(ctx, cfg.GetDSN(), opts...)
+	if err != nil {
+		return nil, withCode(codeConnection, fmt.Errorf("failed to connect to database: %w", err))
+	}
+	return db, nil
+}
+
+// checkRegistry explains an empty registry. Commands then run against an
+// empty managed set, unless --require-entities turns it into an error.
+func checkRegistry(cmd *cobra.Command, cfg *config.Config) error {
+	if len(cfg.Registry) > 0 {
+		return nil
+	}
+	if len(cfg.GetEntityPaths()) == 0 {
+		return withCode(codeConfig, fmt.Errorf("no entity paths configured. Please set 'entity_paths' in config"))
+	}
+	if required, _ := cmd.Flags().GetBool("require-entities"); required {
+		return withCode(codeConfig, fmt.Errorf("no entities are registered in paths %v; run 'migrateme discover' to see what is found", cfg.GetEntityPaths()))
+	}
+	cfg.Reporter().Report(diagnostics.Warningf(diagnostics.NoEntities,
+		"no entities are registered in paths %v; run 'migrateme discover' to list the structs found there (entities need a `// table: \"name\"` doc comment)",
+		cfg.GetEntityPaths()))
+	return nil
+}
+
+func addServiceFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("service", "", "Use the settings of this entry of services in the config (default $MIGRATEME_SERVICE)")
+}
+
+func addGroupFlag(cmd *cobra.Command) {
+	cmd.Flags().String("group", "", "Work on the entities and migrations of this group (migrate:group) only")
+}
+
+// selectGroup scopes cfg to the group of --group; without it, to the
+// entities in no group.
+func selectGroup(cmd *cobra.Command, cfg *config.Config) error {
+	group, _ := cmd.Flags().GetString("group")
+	if err := cfg.SelectGroup(group); err != nil {
+		return withCode(codeInvalidArgument, err)
+	}
+	return nil
+}
+
+func addLogSQLFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool("log-sql", false, "Log every executed SQL statement with its arguments")
+	cmd.PersistentFlags().String("log-sql-file", "", "Write the SQL log to this file instead of stderr (implies --log-sql)")
+}
+
+// sqlLogger returns the logger for --log-sql, or nil when SQL logging is off.
+// It uses the logging format from config; statements are logged at info level
+// regardless of the configured level since they were asked for explicitly.
+func sqlLogger(cmd *cobra.Command, cfg *config.Config) (*slog.Logger, error) {
+	enabled, _ := cmd.Flags().GetBool("log-sql")
+	path, _ := cmd.Flags().GetString("log-sql-file")
+	if !enabled && path == "" {
+		return nil, nil
+	}
+
+	var out io.Writer = os.Stderr
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, withCode(codeInvalidArgument, fmt.Errorf("failed to open SQL log: %w", err))
+		}
+		cobra.OnFinalize(func() { f.Close() })
+		out = f
+	}
+
+	level := cfg.GetLogLevel()
+	if logging.ParseLevel(level) > slog.LevelInfo {
+		level = "info"
+	}
+	return logging.New(out, level, cfg.GetLogFormat()), nil
+}
+
+func collectedDiagnostics() []diagnostics.Diagnostic {
+	if loaded == nil {
+		return nil
+	}
+	return loaded.Reporter().Diagnostics()
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/spf13/cobra"
+)
+
+func TestCheckRegistry(t *testing.T) {
+	t.Parallel()
+
+	registry := migrate.SchemaRegistry{"users": func(string) migrate.TableSchema { return migrate.TableSchema{TableName: "users"} }}
+	tests := []struct {
+		name     string
+		paths    []string
+		registry migrate.SchemaRegistry
+		require  bool
+		errCode  string
+		warned   bool
+	}{
+		{"entities registered", []string{"internal/domain"}, registry, true, "", false},
+		{"no entity paths", nil, nil, false, codeConfig, false},
+		{"empty registry warns", []string{"internal/domain"}, nil, false, "", true},
+		{"empty registry with --require-entities", []string{"internal/domain"}, nil, true, codeConfig, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Default()
+			cfg.EntityPaths = tt.paths
+			cfg.Registry = tt.registry
+			cfg.Reporter().SetOutput(nil)
+			cmd := &cobra.Command{}
+			addRequireEntitiesFlag(cmd)
+			var args []string
+			if tt.require {
+				args = append(args, "--require-entities")
+			}
+			if err := cmd.ParseFlags(args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := checkRegistry(cmd, cfg)
+			if tt.errCode == "" && err != nil {
+				t.Fatalf("checkRegistry = %v", err)
+			}
+			if tt.errCode != "" && (err == nil || errorCode(err) != tt.errCode) {
+				t.Fatalf("checkRegistry = %v, want a %s error", err, tt.errCode)
+			}
+			ds := cfg.Reporter().Diagnostics()
+			if warned := len(ds) == 1 && ds[0].Code == diagnostics.NoEntities && ds[0].Severity == diagnostics.Warning; warned != tt.warned || (!tt.warned && len(ds) > 0) {
+				t.Errorf("diagnostics = %v, want the MM1003 warning: %v", ds, tt.warned)
+			}
+		})
+	}
+}
+
+func TestWriteDrift(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		checked bool
+		managed int
+		drift   []core.TableChange
+		want    string
+	}{
+		{"not checked", false, 0, nil, ""},
+		{"no drift", true, 3, nil, ""},
+		{"empty managed set", true, 0, nil, "\nDrift: no entities are registered, the managed set is empty\n"},
+		{"drift", true, 2, []core.TableChange{{TableName: "users", Type: core.AddColumns}},
+			"\nDrift (entities differ from database):\n  ~ users: add_columns\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var b bytes.Buffer
+			writeDrift(&b, tt.checked, tt.managed, tt.drift)
+			if b.String() != tt.want {
+				t.Errorf("writeDrift wrote %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+
+	// With nothing pending the empty managed set has no drift, so
+	// status --check succeeds; pending migrations still exit with code 2.
+	if err := checkExit(true, nil, nil); err != nil {
+		t.Errorf("status --check of an empty managed set = %v", err)
+	}
+	if err := checkExit(true, []string{"001_init"}, nil); exitCode(err) != ExitPending || !strings.Contains(err.Error(), "1 pending") {
+		t.Errorf("status --check with pending migrations = %v", err)
+	}
+}
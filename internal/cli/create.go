@@ -2,12 +2,10 @@ package cli
 
 import (
 	"fmt"
-	"github.com/amr0ny/migrateme/pkg/config"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
 
+	"github.com/amr0ny/migrateme/internal/core"
 	"github.com/spf13/cobra"
 )
 
@@ -17,22 +15,28 @@ func NewCreateCommand() *cobra.Command {
 		Short: "Create an empty migration file",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load()
+			cfg, err := loadConfig()
 			if err != nil {
-				return fmt.Errorf("failed to load config: %w", err)
+				return err
 			}
 
-			name := strings.ToLower(args[0])
-			name = strings.ReplaceAll(name, " ", "_")
-
-			ts := time.Now().UTC().Format("20060102150405")
-			file := fmt.Sprintf("%s__%s.sql", ts, name)
+			base, err := core.NewMigrator(cfg, nil).NewMigrationName(args[0])
+			if err != nil {
+				return withCode(codeConfig, err)
+			}
+			file := base + ".sql"
 
 			path := filepath.Join(cfg.GetMigrationsDir(), file)
 			if err := os.WriteFile(path, []byte("-- +migrate Up\n\n-- +migrate Down\n"), 0644); err != nil {
 				return err
 			}
 
+			if jsonOutput(cmd) {
+				return writeJSON(os.Stdout, struct {
+					CreatedFiles []string `json:"created_files"`
+				}{CreatedFiles: []string{path}})
+			}
+
 			fmt.Println("Created", path)
 			return nil
 		},
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/spf13/cobra"
+)
+
+func NewDataCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "data",
+		Short: "Dump and load table data tied to the schema version",
+	}
+
+	cmd.AddCommand(newDataDumpCommand())
+	cmd.AddCommand(newDataLoadCommand())
+	return cmd
+}
+
+func newDataDumpCommand() *cobra.Command {
+	var (
+		tables string
+		dir    string
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Copy table data to files stamped with the current migration version",
+		Long: `Copy the rows of the given tables (default: every registered table) to one
+file per table in --dir, with COPY in csv or binary format, from a single
+snapshot. The manifest.json written next to them records the last applied
+migration, and data load refuses the dump on a database at another version.
+
+  migrateme data dump --tables users,orders --dir testdata/fixtures`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != core.DataCSV && format != core.DataBinary {
+				return withCode(codeInvalidArgument, fmt.Errorf("--format must be %s or %s", core.DataCSV, core.DataBinary))
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			manifest, err := core.NewMigrator(cfg, db).DumpData(ctx, dir, splitList(tables), format)
+			if err != nil {
+				return err
+			}
+			return printDataManifest(cmd, manifest, "dumped", fmt.Sprintf("Dumped %d tables to %s", len(manifest.Tables), dir))
+		},
+	}
+
+	cmd.Flags().StringVar(&tables, "tables", "", "Comma-separated list of tables (default: all registered tables)")
+	cmd.Flags().StringVar(&dir, "dir", "fixtures", "Directory to write the data files and manifest to")
+	cmd.Flags().StringVar(&format, "format", core.DataCSV, "COPY format: csv or binary")
+	addGroupFlag(cmd)
+	return cmd
+}
+
+func newDataLoadCommand() *cobra.Command {
+	var (
+		dir      string
+		truncate bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "load",
+		Short: "Load data written by data dump",
+		Long: `Copy the files of a dump written by data dump into the database, in one
+transaction and in the order they were dumped, so referenced tables are
+filled first. Sequences of serial and identity columns are moved past the
+loaded rows.
+
+The database must be at the migration version recorded in the dump's
+manifest.json; otherwise nothing is loaded. Migrate the database to that
+version, or dump the data again from a database at the current one.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			manifest, err := core.NewMigrator(cfg, db).LoadData(ctx, dir, truncate)
+			var ve *core.DataVersionError
+			if errors.As(err, &ve) {
+				return withCode(codeVersionMismatch, err)
+			} else if err != nil {
+				return err
+			}
+			return printDataManifest(cmd, manifest, "loaded", fmt.Sprintf("Loaded %d tables from %s", len(manifest.Tables), dir))
+		},
+	}
+
+	cmd.Flags().StringVar(&dir, "dir", "fixtures", "Directory of the dump")
+	cmd.Flags().BoolVar(&truncate, "truncate", false, "Empty the tables before loading")
+	addGroupFlag(cmd)
+	return cmd
+}
+
+func printDataManifest(cmd *cobra.Command, manifest *core.DataManifest, verb, summary string) error {
+	if jsonOutput(cmd) {
+		if manifest.Tables == nil {
+			manifest.Tables = []core.DataTable{}
+		}
+		return writeJSON(os.Stdout, manifest)
+	}
+	for _, t := range manifest.Tables {
+		fmt.Println(" ", symbol(cmd, "✔", verb), t.Table, fmt.Sprintf("(%d rows)", t.Rows))
+	}
+	fmt.Println(summary)
+	return nil
+}
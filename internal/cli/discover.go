@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/discovery"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/spf13/cobra"
+)
+
+func NewDiscoverCommand() *cobra.Command {
+	var watch, explain bool
+	var interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "List the entities found in entity_paths",
+		Long: `List the structs registered as entities, with the table they map to and
+where they are declared. A struct becomes an entity when its doc comment
+contains a table directive, or when it has a TableName method returning a
+string literal:
+
+  // table: "users"
+  type User struct { ... }
+
+  func (Order) TableName() string { return "orders" }
+
+When a struct declares its table both ways, entity_sources in the config
+decides which one wins (comment first by default). With --explain, discover
+lists every struct under entity_paths with the reason it was or was not
+picked up as an entity.
+
+With --watch, discover keeps running and re-discovers entities whenever a Go
+file under entity_paths is added, changed or removed, printing the entity
+list again (one JSON document per run with -o json). Changes to the config
+file itself need a restart.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if watch && explain {
+				return withCode(codeValidation, fmt.Errorf("--explain cannot be combined with --watch"))
+			}
+			if watch && interval <= 0 {
+				return withCode(codeValidation, fmt.Errorf("--interval must be positive, got %s", interval))
+			}
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if explain {
+				return printExplanation(cmd, cfg)
+			}
+			if err := printEntities(cmd, cfg); err != nil || !watch {
+				return err
+			}
+
+			paths, err := config.ResolveEntityPaths(cfg.GetEntityPaths())
+			if err != nil {
+				return withCode(codeConfig, fmt.Errorf("failed to resolve entity paths: %w", err))
+			}
+			ctx := cmd.Context()
+			fmt.Fprintf(cmd.ErrOrStderr(), "Watching %d entity paths for changes (Ctrl+C to stop)\n", len(paths))
+			return discovery.Watch(ctx, paths, interval, func() {
+				if err := cfg.InitRegistry(); err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Discovery failed: %v\n", err)
+					return
+				}
+				if err := printEntities(cmd, cfg); err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%v\n", err)
+				}
+			})
+		},
+	}
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Re-discover entities whenever entity files change")
+	cmd.Flags().BoolVar(&explain, "explain", false, "Show why each struct was or was not picked up as an entity")
+	cmd.Flags().DurationVar(&interval, "interval", time.Second, "How often --watch checks entity files for changes")
+	return cmd
+}
+
+func printEntities(cmd *cobra.Command, cfg *config.Config) error {
+	entities := append([]migrate.EntityInfo(nil), cfg.Entities...)
+	sort.Slice(entities, func(i, j int) bool { return entities[i].TableName < entities[j].TableName })
+
+	if jsonOutput(cmd) {
+		type entityJSON struct {
+			Table   string `json:"table"`
+			Struct  string `json:"struct"`
+			File    string `json:"file"`
+			Line    int    `json:"line"`
+			Owner   string `json:"owner,omitempty"`
+			Group   string `json:"group,omitempty"`
+			Columns int    `json:"columns"`
+		}
+		out := make([]entityJSON, 0, len(entities))
+		for _, e := range entities {
+			out = append(out, entityJSON{
+				Table:   e.TableName,
+				Struct:  e.StructName,
+				File:    e.FilePath,
+				Line:    e.Line,
+				Owner:   e.Owner,
+				Group:   e.Group,
+				Columns: len(e.Fields),
+			})
+		}
+		return writeJSON(os.Stdout, struct {
+			EntityPaths []string     `json:"entity_paths"`
+			Entities    []entityJSON `json:"entities"`
+		}{EntityPaths: nonNil(cfg.GetEntityPaths()), Entities: out})
+	}
+
+	if len(entities) == 0 {
+		fmt.Printf("No entities found in paths: %v\n", cfg.GetEntityPaths())
+		fmt.Println(`Entities are structs with a doc comment like // table: "users"`)
+		return nil
+	}
+	for _, e := range entities {
+		fmt.Printf("  %s -> %s (%s:%d)", e.StructName, e.TableName, e.FilePath, e.Line)
+		if e.Owner != "" {
+			fmt.Printf(" owner: %s", e.Owner)
+		}
+		if e.Group != "" {
+			fmt.Printf(" group: %s", e.Group)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Found %d entities\n", len(entities))
+	return nil
+}
+
+func printExplanation(cmd *cobra.Command, cfg *config.Config) error {
+	resolutions, err := cfg.ExplainDiscovery()
+	if err != nil {
+		return withCode(codeConfig, err)
+	}
+	// Load has validated entity_sources already.
+	sources, _ := discovery.ParseEntitySources(cfg.EntitySources)
+
+	if jsonOutput(cmd) {
+		if resolutions == nil {
+			resolutions = []discovery.Resolution{}
+		}
+		return writeJSON(os.Stdout, struct {
+			EntityPaths   []string               `json:"entity_paths"`
+			EntitySources []string               `json:"entity_sources"`
+			Explain       []discovery.Resolution `json:"explain"`
+		}{
+			EntityPaths:   nonNil(cfg.GetEntityPaths()),
+			EntitySources: sources,
+			Explain:       resolutions,
+		})
+	}
+
+	if len(resolutions) == 0 {
+		fmt.Printf("No structs found in paths: %v\n", cfg.GetEntityPaths())
+		return nil
+	}
+	entities := 0
+	for _, r := range resolutions {
+		if r.Table != "" {
+			entities++
+			fmt.Printf("  + %s -> %s (%s:%d)\n      %s\n", r.Struct, r.Table, r.File, r.Line, r.Reason)
+		} else {
+			fmt.Printf("  - %s (%s:%d)\n      %s\n", r.Struct, r.File, r.Line, r.Reason)
+		}
+	}
+	fmt.Printf("%d of %d structs are entities (entity_sources: %s)\n",
+		entities, len(resolutions), strings.Join(sources, ", "))
+	return nil
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewGenDocsCommand() *cobra.Command {
+	var format, dir string
+
+	cmd := &cobra.Command{
+		Use:    "gen-docs",
+		Short:  "Generate man pages or markdown reference from the command tree",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", dir, err)
+			}
+
+			var render func(*cobra.Command) []byte
+			var fileName func(*cobra.Command) string
+			switch format {
+			case "man":
+				render, fileName = renderManPage, func(c *cobra.Command) string { return docBaseName(c) + ".1" }
+			case "markdown", "md":
+				render, fileName = renderMarkdown, func(c *cobra.Command) string { return docBaseName(c) + ".md" }
+			default:
+				return fmt.Errorf("unknown format %q (expected man or markdown)", format)
+			}
+
+			var written int
+			err := walkCommands(cmd.Root(), func(c *cobra.Command) error {
+				path := filepath.Join(dir, fileName(c))
+				if err := os.WriteFile(path, render(c), 0o644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", path, err)
+				}
+				written++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Generated %d %s pages in %s\n", written, format, dir)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "man", "Output format: man or markdown")
+	cmd.Flags().StringVar(&dir, "dir", "docs", "Output directory")
+	return cmd
+}
+
+func walkCommands(c *cobra.Command, fn func(*cobra.Command) error) error {
+	if !c.IsAvailableCommand() && c.HasParent() {
+		return nil
+	}
+	if err := fn(c); err != nil {
+		return err
+	}
+	for _, sub := range c.Commands() {
+		if err := walkCommands(sub, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func docBaseName(c *cobra.Command) string {
+	return strings.ReplaceAll(c.CommandPath(), " ", "-")
+}
+
+func visibleSubcommands(c *cobra.Command) []*cobra.Command {
+	var out []*cobra.Command
+	for _, sub := range c.Commands() {
+		if sub.IsAvailableCommand() {
+			out = append(out, sub)
+		}
+	}
+	return out
+}
+
+func renderMarkdown(c *cobra.Command) []byte {
+	var b bytes.Buffer
+	// As in renderManPage, the flags are collected before UseLine.
+	own, inherited := c.NonInheritedFlags(), c.InheritedFlags()
+
+	fmt.Fprintf(&b, "## %s\n\n%s\n\n", c.CommandPath(), c.Short)
+	if c.Long != "" {
+		fmt.Fprintf(&b, "### Synopsis\n\n%s\n\n", c.Long)
+	}
+	if c.Runnable() {
+		fmt.Fprintf(&b, "```\n%s\n```\n\n", c.UseLine())
+	}
+	if c.Example != "" {
+		fmt.Fprintf(&b, "### Examples\n\n```\n%s\n```\n\n", c.Example)
+	}
+	if own.HasAvailableFlags() {
+		fmt.Fprintf(&b, "### Options\n\n```\n%s```\n\n", own.FlagUsages())
+	}
+	if inherited.HasAvailableFlags() {
+		fmt.Fprintf(&b, "### Options inherited from parent commands\n\n```\n%s```\n\n", inherited.FlagUsages())
+	}
+
+	var seeAlso []string
+	if c.HasParent() {
+		p := c.Parent()
+		seeAlso = append(seeAlso, fmt.Sprintf("* [%s](%s.md)\t - %s", p.CommandPath(), docBaseName(p), p.Short))
+	}
+	for _, sub := range visibleSubcommands(c) {
+		seeAlso = append(seeAlso, fmt.Sprintf("* [%s](%s.md)\t - %s", sub.CommandPath(), docBaseName(sub), sub.Short))
+	}
+	if len(seeAlso) > 0 {
+		fmt.Fprintf(&b, "### SEE ALSO\n\n%s\n", strings.Join(seeAlso, "\n"))
+	}
+
+	return b.Bytes()
+}
+
+func renderManPage(c *cobra.Command) []byte {
+	var b bytes.Buffer
+	name := docBaseName(c)
+	// Collecting the flags merges the persistent ones into c, which UseLine
+	// needs to tell whether the command takes flags.
+	own, inherited := c.NonInheritedFlags(), c.InheritedFlags()
+
+	fmt.Fprintf(&b, ".TH \"%s\" \"1\" \"\" \"migrateme\" \"migrateme Manual\"\n", strings.ToUpper(name))
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roffEscape(name), roffEscape(c.Short))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n\\fB%s\\fP\n", roffEscape(c.UseLine()))
+
+	desc := c.Long
+	if desc == "" {
+		desc = c.Short
+	}
+	fmt.Fprintf(&b, ".SH DESCRIPTION\n.nf\n%s\n.fi\n", roffEscape(desc))
+
+	if c.Example != "" {
+		fmt.Fprintf(&b, ".SH EXAMPLES\n.nf\n%s\n.fi\n", roffEscape(c.Example))
+	}
+
+	writeManFlags(&b, "OPTIONS", own)
+	writeManFlags(&b, "OPTIONS INHERITED FROM PARENT COMMANDS", inherited)
+
+	var seeAlso []string
+	if c.HasParent() {
+		seeAlso = append(seeAlso, fmt.Sprintf("\\fB%s(1)\\fP", roffEscape(docBaseName(c.Parent()))))
+	}
+	for _, sub := range visibleSubcommands(c) {
+		seeAlso = append(seeAlso, fmt.Sprintf("\\fB%s(1)\\fP", roffEscape(docBaseName(sub))))
+	}
+	if len(seeAlso) > 0 {
+		fmt.Fprintf(&b, ".SH SEE ALSO\n%s\n", strings.Join(seeAlso, ", "))
+	}
+
+	return b.Bytes()
+}
+
+func writeManFlags(b *bytes.Buffer, title string, flags *pflag.FlagSet) {
+	if !flags.HasAvailableFlags() {
+		return
+	}
+	fmt.Fprintf(b, ".SH %s\n", title)
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+		name := "--" + f.Name
+		if f.Shorthand != "" {
+			name = "-" + f.Shorthand + ", " + name
+		}
+		if f.Value.Type() != "bool" {
+			name += "=" + f.Value.Type()
+		}
+		usage := f.Usage
+		switch f.DefValue {
+		case "", "false", "0", "0s", "[]":
+			// Zero values are left out, as in the markdown flag usages.
+		default:
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintf(b, ".TP\n\\fB%s\\fP\n%s\n", roffEscape(name), roffEscape(usage))
+	})
+}
+
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			lines[i] = `\&` + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// docsTree is a small command tree covering what the renderers handle:
+// long descriptions, examples, own and inherited flags, hidden flags and
+// commands, and text roff would read as requests.
+func docsTree() (root, run *cobra.Command) {
+	root = &cobra.Command{Use: "migrateme", Short: "Schema migrations from Go structs"}
+	root.PersistentFlags().String("config", "", "Config file")
+
+	run = &cobra.Command{
+		Use:   "run",
+		Short: "Apply pending migrations",
+		Long: `Apply every pending migration in order.
+.gitignore-like lines and back\slashes are escaped.`,
+		Example: "  migrateme run --dry-run",
+		RunE:    func(*cobra.Command, []string) error { return nil },
+	}
+	run.Flags().BoolP("dry-run", "n", false, "Print the migrations instead of applying them")
+	run.Flags().Duration("wait", 0, "How long to wait for the database")
+	run.Flags().String("to", "latest", "Last migration to apply")
+	run.Flags().Bool("internal", false, "Not documented")
+	_ = run.Flags().MarkHidden("internal")
+
+	hidden := &cobra.Command{Use: "gen-docs", Hidden: true, RunE: func(*cobra.Command, []string) error { return nil }}
+	root.AddCommand(run, hidden)
+	return root, run
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	t.Parallel()
+
+	root, run := docsTree()
+	tests := []struct {
+		cmd  *cobra.Command
+		want string
+	}{
+		{root, "## migrateme\n" +
+			"\n" +
+			"Schema migrations from Go structs\n" +
+			"\n" +
+			"### Options\n" +
+			"\n" +
+			"```\n" +
+			"      --config string   Config file\n" +
+			"```\n" +
+			"\n" +
+			"### SEE ALSO\n" +
+			"\n" +
+			"* [migrateme run](migrateme-run.md)\t - Apply pending migrations\n"},
+		{run, "## migrateme run\n" +
+			"\n" +
+			"Apply pending migrations\n" +
+			"\n" +
+			"### Synopsis\n" +
+			"\n" +
+			"Apply every pending migration in order.\n" +
+			".gitignore-like lines and back\\slashes are escaped.\n" +
+			"\n" +
+			"```\n" +
+			"migrateme run [flags]\n" +
+			"```\n" +
+			"\n" +
+			"### Examples\n" +
+			"\n" +
+			"```\n" +
+			"  migrateme run --dry-run\n" +
+			"```\n" +
+			"\n" +
+			"### Options\n" +
+			"\n" +
+			"```\n" +
+			"  -n, --dry-run         Print the migrations instead of applying them\n" +
+			"      --to string       Last migration to apply (default \"latest\")\n" +
+			"      --wait duration   How long to wait for the database\n" +
+			"```\n" +
+			"\n" +
+			"### Options inherited from parent commands\n" +
+			"\n" +
+			"```\n" +
+			"      --config string   Config file\n" +
+			"```\n" +
+			"\n" +
+			"### SEE ALSO\n" +
+			"\n" +
+			"* [migrateme](migrateme.md)\t - Schema migrations from Go structs\n"},
+	}
+	for _, tt := range tests {
+		if got := string(renderMarkdown(tt.cmd)); got != tt.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", tt.cmd.CommandPath(), got, tt.want)
+		}
+	}
+}
+
+func TestRenderManPage(t *testing.T) {
+	t.Parallel()
+
+	root, run := docsTree()
+	tests := []struct {
+		cmd  *cobra.Command
+		want string
+	}{
+		{root, `.TH "MIGRATEME" "1" "" "migrateme" "migrateme Manual"
+.SH NAME
+migrateme \- Schema migrations from Go structs
+.SH SYNOPSIS
+\fBmigrateme [flags]\fP
+.SH DESCRIPTION
+.nf
+Schema migrations from Go structs
+.fi
+.SH OPTIONS
+.TP
+\fB\-\-config=string\fP
+Config file
+.SH SEE ALSO
+\fBmigrateme\-run(1)\fP
+`},
+		{run, `.TH "MIGRATEME-RUN" "1" "" "migrateme" "migrateme Manual"
+.SH NAME
+migrateme\-run \- Apply pending migrations
+.SH SYNOPSIS
+\fBmigrateme run [flags]\fP
+.SH DESCRIPTION
+.nf
+Apply every pending migration in order.
+\&.gitignore\-like lines and back\\slashes are escaped.
+.fi
+.SH EXAMPLES
+.nf
+  migrateme run \-\-dry\-run
+.fi
+.SH OPTIONS
+.TP
+\fB\-n, \-\-dry\-run\fP
+Print the migrations instead of applying them
+.TP
+\fB\-\-to=string\fP
+Last migration to apply (default latest)
+.TP
+\fB\-\-wait=duration\fP
+How long to wait for the database
+.SH OPTIONS INHERITED FROM PARENT COMMANDS
+.TP
+\fB\-\-config=string\fP
+Config file
+.SH SEE ALSO
+\fBmigrateme(1)\fP
+`},
+	}
+	for _, tt := range tests {
+		if got := string(renderManPage(tt.cmd)); got != tt.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", tt.cmd.CommandPath(), got, tt.want)
+		}
+	}
+}
+
+// A command with only inherited flags still takes them, whichever page is
+// rendered first.
+func TestRenderSynopsis_InheritedFlagsOnly(t *testing.T) {
+	t.Parallel()
+
+	for name, render := range map[string]func(*cobra.Command) []byte{"man": renderManPage, "markdown": renderMarkdown} {
+		root := &cobra.Command{Use: "migrateme"}
+		root.PersistentFlags().String("config", "", "Config file")
+		version := &cobra.Command{Use: "version", Short: "Print the version", RunE: func(*cobra.Command, []string) error { return nil }}
+		root.AddCommand(version)
+
+		if got := string(render(version)); !strings.Contains(got, "migrateme version [flags]") {
+			t.Errorf("%s: synopsis without [flags]:\n%s", name, got)
+		}
+	}
+}
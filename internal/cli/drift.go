@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+func NewDriftCommand() *cobra.Command {
+	var (
+		adminDSN string
+		keep     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Compare migration files, the database and the entities using a shadow database",
+		Long: `Replay the migration files into a temporary shadow database and compare its
+schema with the live database and with the registered entities. Three kinds
+of drift are reported:
+
+  manual       the live database differs from what the migrations it applied
+               produce, e.g. a column added by hand in production
+  stale        applied migrations whose file was modified or removed since
+  ungenerated  the entities differ from what all migration files produce,
+               i.e. 'migrateme generate' has not been run for a change
+
+The live database is only read. The command exits with code 3 when any drift
+is found. The shadow database is dropped afterwards unless --keep is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
+			}
+			if err := checkRegistry(cmd, cfg); err != nil {
+				return err
+			}
+			if adminDSN == "" {
+				adminDSN = cfg.GetDSN()
+			}
+			if adminDSN == "" {
+				return withCode(codeConfig, fmt.Errorf("no database configured; pass --admin-dsn or set DATABASE_DSN"))
+			}
+
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			scratch, err := database.CreateScratch(ctx, adminDSN, "migrateme_shadow")
+			if err != nil {
+				return withCode(codeConnection, err)
+			}
+			if keep {
+				defer scratch.Close()
+			} else {
+				defer scratch.Drop(ctx)
+			}
+			shadow, err := database.NewDB(ctx, scratch.DSN, cfg.DBOptions()...)
+			if err != nil {
+				return withCode(codeConnection, fmt.Errorf("failed to connect to %s: %w", scratch.Name, err))
+			}
+			defer shadow.Close()
+
+			result, err := core.NewMigrator(cfg, db).Drift(ctx, shadow)
+			if err != nil {
+				return withCode(codeMigration, err)
+			}
+
+			asJSON := jsonOutput(cmd)
+			if asJSON {
+				if err := writeJSON(os.Stdout, struct {
+					Shadow string `json:"shadow"`
+					*core.DriftResult
+				}{Shadow: scratch.Name, DriftResult: result}); err != nil {
+					return err
+				}
+			} else {
+				if err := printDrift(cmd, result); err != nil {
+					return err
+				}
+				if keep {
+					fmt.Printf("Kept shadow database %s\n", scratch.Name)
+				}
+			}
+
+			if result.HasDrift() {
+				return &exitError{Code: ExitDrift, Err: fmt.Errorf("schema drift detected"), Silent: asJSON}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&adminDSN, "admin-dsn", "", "DSN of a server where the shadow database may be created (default: configured DSN)")
+	cmd.Flags().BoolVar(&keep, "keep", false, "Keep the shadow database")
+	addGroupFlag(cmd)
+	return cmd
+}
+
+func printDrift(cmd *cobra.Command, result *core.DriftResult) error {
+	fmt.Printf("Replayed %d migrations into the shadow database\n", len(result.Replayed))
+
+	fmt.Println("\nManual changes (live database vs applied migrations):")
+	if len(result.Manual) == 0 {
+		fmt.Println("  none")
+	} else if err := schema.WriteComparison(os.Stdout, result.Manual, false); err != nil {
+		return err
+	}
+
+	fmt.Println("\nStale migration files (applied, then modified or removed):")
+	if len(result.Stale) == 0 {
+		fmt.Println("  none")
+	}
+	for _, s := range result.Stale {
+		fmt.Printf("  %s %s: %s\n", symbol(cmd, "✘", "stale"), s.Migration, s.Reason)
+	}
+
+	fmt.Println("\nUngenerated changes (entities vs migration files):")
+	if len(result.Ungenerated) == 0 {
+		fmt.Println("  none")
+		return nil
+	}
+	return schema.WriteComparison(os.Stdout, result.Ungenerated, false)
+}
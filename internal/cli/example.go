@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/amr0ny/migrateme/internal/example"
+	"github.com/spf13/cobra"
+)
+
+func NewExampleCommand() *cobra.Command {
+	var (
+		adminDSN    string
+		entityPaths []string
+		keep        bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "example",
+		Short: "Run discover, generate, run and rollback over the example entities in a throwaway database",
+		Long: `Create a temporary database, run the whole pipeline over the example
+entities (example/domain by default) and check the outcome of every step:
+
+  discover  the entities are found
+  generate  one migration creates every table
+  run       the migration is applied
+  verify    the database matches the entities and generate reports no changes
+  rollback  the tables are gone and the migration is pending again
+
+The database and the migrations directory are dropped afterwards unless --keep
+is given. Run it from the repository root.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if adminDSN == "" {
+				cfg, err := loadConfig()
+				if err != nil {
+					return err
+				}
+				adminDSN = cfg.GetDSN()
+			}
+			if adminDSN == "" {
+				return withCode(codeConfig, fmt.Errorf("no database configured; pass --admin-dsn or set DATABASE_DSN"))
+			}
+
+			asJSON := jsonOutput(cmd)
+			opts := example.Options{AdminDSN: adminDSN, EntityPaths: entityPaths, Keep: keep}
+			if !asJSON {
+				opts.Step = func(s example.Step) {
+					fmt.Printf("%s %-8s %s (%s)\n", symbol(cmd, "✔", "ok"), s.Name, s.Detail, s.Duration.Round(1e6))
+				}
+			}
+
+			report, err := example.Run(cmd.Context(), opts)
+			if err != nil {
+				return withCode(codeError, fmt.Errorf("example scenario failed: %w", err))
+			}
+
+			if asJSON {
+				return writeJSON(os.Stdout, report)
+			}
+			if keep {
+				fmt.Printf("Kept database %s and migrations in %s\n", report.Database, report.MigrationsDir)
+			}
+			fmt.Printf("Example scenario passed (%s)\n", strings.Join(stepNames(report.Steps), " -> "))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&adminDSN, "admin-dsn", "", "DSN of a server where temporary databases may be created (default: configured DSN)")
+	cmd.Flags().StringSliceVar(&entityPaths, "entities", example.DefaultEntityPaths, "Entity paths to run the scenario over")
+	cmd.Flags().BoolVar(&keep, "keep", false, "Keep the temporary database and migrations directory")
+	return cmd
+}
+
+func stepNames(steps []example.Step) []string {
+	names := make([]string, len(steps))
+	for i, s := range steps {
+		names[i] = s.Name
+	}
+	return names
+}
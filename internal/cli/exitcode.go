@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"context"
+	"errors"
+)
+
+// Process exit codes. Pipelines rely on these values, so they must not change.
+const (
+	ExitOK      = 0
+	ExitError   = 1
+	ExitPending = 2 // pending migrations exist (status --check)
+	ExitDrift   = 3 // entities and database schema differ
+	ExitApplied = 4 // migrations were applied (run --detailed-exitcode)
+	// ExitInterrupted follows the shell convention for SIGINT (128+2).
+	ExitInterrupted = 130
+)
+
+// exitError makes a command finish with a specific exit code. Silent errors
+// have already been reported by the command itself and are not printed again.
+type exitError struct {
+	Code   int
+	Err    error
+	Silent bool
+}
+
+func (e *exitError) Error() string { return e.Err.Error() }
+func (e *exitError) Unwrap() error { return e.Err }
+
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.Code
+	}
+	if errors.Is(err, context.Canceled) {
+		return ExitInterrupted
+	}
+	return ExitError
+}
+
+func isSilent(err error) bool {
+	var ee *exitError
+	return errors.As(err, &ee) && ee.Silent
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/amr0ny/migrateme/internal/core"
+)
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	drift := []core.TableChange{{TableName: "users", Type: core.AddColumns}}
+	tests := []struct {
+		name   string
+		err    error
+		code   int
+		silent bool
+		json   string
+	}{
+		{"success", nil, ExitOK, false, ""},
+		{"error", errors.New("boom"), ExitError, false, codeError},
+		{"config error", withCode(codeConfig, errors.New("failed to load config")), ExitError, false, codeConfig},
+		{"connection error", withCode(codeConnection, errors.New("refused")), ExitError, false, codeConnection},
+		{"status --check, nothing to do", checkExit(true, nil, nil), ExitOK, false, ""},
+		{"status without --check", checkExit(false, []string{"002_add_email"}, drift), ExitOK, false, ""},
+		{"status --check, pending", checkExit(true, []string{"002_add_email"}, nil), ExitPending, true, codeError},
+		// Pending migrations take precedence: the drift is computed only
+		// when nothing is pending.
+		{"status --check, pending and drift", checkExit(true, []string{"002_add_email"}, drift), ExitPending, true, codeError},
+		{"status --check, drift", checkExit(true, nil, drift), ExitDrift, true, codeError},
+		{"drift", &exitError{Code: ExitDrift, Err: errors.New("schema drift detected")}, ExitDrift, false, codeError},
+		{"run --detailed-exitcode, applied", appliedExit(true, []string{"001_init"}), ExitApplied, true, codeError},
+		{"run --detailed-exitcode, nothing applied", appliedExit(true, nil), ExitOK, false, ""},
+		{"run, applied", appliedExit(false, []string{"001_init"}), ExitOK, false, ""},
+		{"interrupted", withCode(codeMigration, fmt.Errorf("apply 001_init: %w", context.Canceled)), ExitInterrupted, false, codeMigration},
+		{"wrapped exit code", fmt.Errorf("generate: %w", &exitError{Code: ExitDrift, Err: errors.New("changes")}), ExitDrift, false, codeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := exitCode(tt.err); got != tt.code {
+				t.Errorf("exitCode = %d, want %d", got, tt.code)
+			}
+			if got := isSilent(tt.err); got != tt.silent {
+				t.Errorf("isSilent = %v, want %v", got, tt.silent)
+			}
+			if tt.err != nil {
+				if got := errorCode(tt.err); got != tt.json {
+					t.Errorf("errorCode = %q, want %q", got, tt.json)
+				}
+			}
+		})
+	}
+}
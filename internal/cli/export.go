@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/codegen"
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/spf13/cobra"
+)
+
+func NewExportCommand() *cobra.Command {
+	var format, out string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the migrations for goose or golang-migrate",
+		Long: `Export writes the migrations in the file naming and directive conventions of
+goose or golang-migrate, so that an existing runner can apply them:
+
+  goose           <version>_<name>.sql with -- +goose Up/Down sections;
+                  dollar-quoted bodies are wrapped in StatementBegin/End and
+                  no_transaction migrations get -- +goose NO TRANSACTION
+  golang-migrate  <version>_<name>.up.sql and <version>_<name>.down.sql
+
+The exported SQL is what run executes: templates are rendered and configured
+timeouts are set. Migrations need numeric versions. The migrations directory
+is only read; existing files in --out are replaced only with --force.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != core.ExportGoose && format != core.ExportGolangMigrate {
+				return withCode(codeInvalidArgument, fmt.Errorf("--format must be %s or %s", core.ExportGoose, core.ExportGolangMigrate))
+			}
+			if out == "" {
+				return withCode(codeInvalidArgument, fmt.Errorf("--out is required"))
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			exported, err := core.NewMigrator(cfg, nil).Export(format, out, force)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput(cmd) {
+				if exported == nil {
+					exported = []core.ExportedMigration{}
+				}
+				return writeJSON(os.Stdout, struct {
+					Exported []core.ExportedMigration `json:"exported"`
+					Format   string                   `json:"format"`
+				}{Exported: exported, Format: format})
+			}
+
+			for _, e := range exported {
+				for _, f := range e.Files {
+					fmt.Println(" ", symbol(cmd, "✔", "wrote"), f)
+				}
+				if e.Warning != "" {
+					cfg.Reporter().Report(diagnostics.Warningf(diagnostics.ExportedSemantics, "%s: %s", e.Migration, e.Warning))
+				}
+			}
+			fmt.Printf("Exported %d migrations to %s for %s\n", len(exported), out, format)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "", "Layout to write: goose or golang-migrate")
+	cmd.Flags().StringVar(&out, "out", "", "Directory to write the migrations to")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace existing files in --out")
+	cmd.AddCommand(newExportJSONSchemaCommand())
+	cmd.AddCommand(newExportProtoCommand())
+	return cmd
+}
+
+func newExportJSONSchemaCommand() *cobra.Command {
+	var (
+		tables  string
+		out     string
+		openAPI bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "jsonschema",
+		Short: "Write JSON Schema or OpenAPI component schemas of the registered entities",
+		Long: `Describe every registered table as a JSON Schema object, from the same
+schemas generate uses: columns become properties, NOT NULL columns are
+required and the others also accept null. By default a JSON Schema document
+with the tables under $defs is written; --openapi writes an OpenAPI 3.1
+document with them under components.schemas instead.
+
+  migrateme export jsonschema --openapi --out api/entities.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			schemas := registrySchemas(cfg, splitList(tables))
+			if len(schemas) == 0 {
+				return withCode(codeConfig, fmt.Errorf("no matching entities found in paths: %v", cfg.EntityPaths))
+			}
+			src, err := codegen.JSONSchema(schemas, openAPI)
+			if err != nil {
+				return err
+			}
+
+			if out == "" {
+				_, err := os.Stdout.Write(src)
+				return err
+			}
+			if err := os.WriteFile(out, src, 0o644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", out, err)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Wrote %d schemas to %s\n", len(schemas), out)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&tables, "tables", "", "Comma-separated list of tables (default: all)")
+	cmd.Flags().StringVar(&out, "out", "", "File to write to (default: stdout)")
+	cmd.Flags().BoolVar(&openAPI, "openapi", false, "Write an OpenAPI 3.1 document instead of JSON Schema")
+	return cmd
+}
+
+func newExportProtoCommand() *cobra.Command {
+	var (
+		tables    string
+		out       string
+		pkg       string
+		goPackage string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "proto",
+		Short: "Write protobuf messages for the registered entities",
+		Long: `Write a proto3 file with one message per registered table, from the same
+schemas generate uses. Messages are named like the structs of gen models;
+uuid, numeric and text are strings, timestamp and timestamptz are
+google.protobuf.Timestamp, interval is google.protobuf.Duration and json is
+google.protobuf.Value. Nullable scalar columns are optional, arrays repeated.
+
+When --out already exists, every field keeps the number it has there: new
+columns get the next free numbers and the numbers and names of removed
+columns are reserved, so clients built from an older file keep working.
+
+  migrateme export proto --package shop.v1 --out proto/shop/v1/entities.proto`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			schemas := registrySchemas(cfg, splitList(tables))
+			if len(schemas) == 0 {
+				return withCode(codeConfig, fmt.Errorf("no matching entities found in paths: %v", cfg.EntityPaths))
+			}
+			var previous []byte
+			if out != "" {
+				previous, err = os.ReadFile(out)
+				if err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("failed to read %s: %w", out, err)
+				}
+			}
+			src, err := codegen.Proto(pkg, goPackage, schemas, previous)
+			if err != nil {
+				return err
+			}
+
+			if out == "" {
+				_, err := os.Stdout.Write(src)
+				return err
+			}
+			if err := os.WriteFile(out, src, 0o644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", out, err)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Wrote %d messages to %s\n", len(schemas), out)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&tables, "tables", "", "Comma-separated list of tables (default: all)")
+	cmd.Flags().StringVar(&out, "out", "", "File to write to (default: stdout)")
+	cmd.Flags().StringVar(&pkg, "package", "entities", "Proto package of the messages")
+	cmd.Flags().StringVar(&goPackage, "go-package", "", "go_package option, e.g. example.com/shop/v1;shopv1")
+	return cmd
+}
@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/amr0ny/migrateme/internal/codegen"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/spf13/cobra"
+)
+
+func NewGenCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gen",
+		Short: "Generate Go code from entities or the database",
+	}
+
+	cmd.AddCommand(newGenRepoCommand())
+	cmd.AddCommand(newGenModelsCommand())
+	cmd.AddCommand(newGenRegistryCommand())
+	return cmd
+}
+
+func newGenRepoCommand() *cobra.Command {
+	var tables string
+
+	cmd := &cobra.Command{
+		Use:   "repo",
+		Short: "Generate typed pgx CRUD repositories for registered entities",
+		Long: `Generate Insert/GetByPK/Update/Delete repositories for registered entities.
+
+Each repository is written next to its entity as <table>_repo.gen.go, together
+with a DBTX interface (migrateme_dbtx.gen.go) satisfied by *pgxpool.Pool,
+*pgx.Conn and pgx.Tx.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			entities := filterEntities(cfg.Entities, splitList(tables))
+			if len(entities) == 0 {
+				return withCode(codeConfig, fmt.Errorf("no matching entities found in paths: %v", cfg.EntityPaths))
+			}
+
+			// Repositories must use the names the tables were created with.
+			policy, err := migrate.ParseIdentifierPolicy(cfg.Migrations.Identifiers)
+			if err != nil {
+				return withCode(codeConfig, err)
+			}
+			mapped := make([]migrate.EntityInfo, len(entities))
+			for i, e := range entities {
+				mapped[i] = policy.ApplyEntity(e)
+			}
+
+			files, err := codegen.Repositories(mapped)
+			if err != nil {
+				return err
+			}
+
+			written := make([]string, 0, len(files))
+			for _, f := range files {
+				if err := os.WriteFile(f.Path, f.Source, 0o644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", f.Path, err)
+				}
+				written = append(written, f.Path)
+			}
+
+			if jsonOutput(cmd) {
+				return writeJSON(os.Stdout, struct {
+					CreatedFiles []string `json:"created_files"`
+				}{CreatedFiles: written})
+			}
+			for _, path := range written {
+				if rel, err := filepath.Rel(".", path); err == nil && !strings.HasPrefix(rel, "..") {
+					path = rel
+				}
+				fmt.Println("  -", path)
+			}
+			fmt.Printf("Generated %d repositories\n", len(entities))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&tables, "tables", "", "Comma-separated list of tables (default: all)")
+	return cmd
+}
+
+func newGenModelsCommand() *cobra.Command {
+	var (
+		tables string
+		dir    string
+		pkg    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "models",
+		Short: "Generate Go structs with db tags from an existing database",
+		Long: `Introspect tables of the live database and write one struct per table.
+
+The generated tags (pk, notnull, unique, type, default, fk) and the table,
+index and check directives describe the current schema, so running generate
+against the new entities should report no changes. Defaults containing commas
+cannot be expressed in a tag and are skipped.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			schemas, err := liveSchemas(cmd.Context(), cmd, cfg, splitList(tables))
+			if err != nil {
+				return err
+			}
+
+			if pkg == "" {
+				pkg = filepath.Base(dir)
+			}
+			files, err := codegen.Models(dir, pkg, schemas)
+			if err != nil {
+				return withCode(codeGenerate, err)
+			}
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", dir, err)
+			}
+
+			written := make([]string, 0, len(files))
+			for _, f := range files {
+				if err := os.WriteFile(f.Path, f.Source, 0o644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", f.Path, err)
+				}
+				written = append(written, f.Path)
+			}
+
+			if jsonOutput(cmd) {
+				return writeJSON(os.Stdout, struct {
+					CreatedFiles []string `json:"created_files"`
+				}{CreatedFiles: written})
+			}
+			for _, path := range written {
+				fmt.Println("  -", path)
+			}
+			fmt.Printf("Generated %d models\n", len(files))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&tables, "tables", "", "Comma-separated list of tables (default: all tables in the current schema)")
+	cmd.Flags().StringVar(&dir, "dir", "models", "Output directory")
+	cmd.Flags().StringVar(&pkg, "package", "", "Package name (default: base name of --dir)")
+	return cmd
+}
+
+func newGenRegistryCommand() *cobra.Command {
+	var (
+		out string
+		pkg string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Generate a Go file with the schema registry of all entities",
+		Long: `Write a Go file declaring Registry(), which returns the schemas of the
+registered entities as a migrate.SchemaRegistry, so a program can use them
+without discovering entities at run time.
+
+The output is deterministic: tables are sorted, there is no timestamp and
+source positions are left out, so the file only changes when the schemas do,
+and it is not rewritten when nothing changed. sql= fragment paths are written
+relative to the generated file. It is meant for go:generate:
+
+  //go:generate migrateme gen registry
+
+The package defaults to $GOPACKAGE, which go generate sets, or the base name
+of the output directory.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := checkRegistry(cmd, cfg); err != nil {
+				return err
+			}
+
+			dir := filepath.Dir(out)
+			if pkg == "" {
+				pkg = os.Getenv("GOPACKAGE")
+			}
+			if pkg == "" {
+				abs, err := filepath.Abs(dir)
+				if err != nil {
+					return err
+				}
+				pkg = filepath.Base(abs)
+			}
+
+			schemas := make([]migrate.TableSchema, 0, len(cfg.Registry))
+			for table, build := range cfg.Registry {
+				s := build(table)
+				for i, c := range s.Columns {
+					if c.SQLFile == "" {
+						continue
+					}
+					if rel, err := filepath.Rel(dir, c.SQLFile); err == nil {
+						s.Columns[i].SQLFile = filepath.ToSlash(rel)
+					}
+				}
+				schemas = append(schemas, s)
+			}
+			file, err := codegen.Registry(out, pkg, schemas)
+			if err != nil {
+				return withCode(codeGenerate, err)
+			}
+
+			written := false
+			if current, err := os.ReadFile(out); err != nil || !bytes.Equal(current, file.Source) {
+				if err := os.WriteFile(out, file.Source, 0o644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", out, err)
+				}
+				written = true
+			}
+
+			if jsonOutput(cmd) {
+				return writeJSON(os.Stdout, struct {
+					File    string `json:"file"`
+					Tables  int    `json:"tables"`
+					Changed bool   `json:"changed"`
+				}{File: out, Tables: len(schemas), Changed: written})
+			}
+			if written {
+				fmt.Printf("Generated registry of %d tables in %s\n", len(schemas), out)
+			} else {
+				fmt.Printf("Registry in %s is up to date\n", out)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&out, "out", "migrateme_registry.gen.go", "Output file")
+	cmd.Flags().StringVar(&pkg, "package", "", "Package name (default: $GOPACKAGE or base name of the output directory)")
+	return cmd
+}
+
+func filterEntities(entities []migrate.EntityInfo, tables []string) []migrate.EntityInfo {
+	if len(tables) == 0 {
+		return entities
+	}
+	want := map[string]bool{}
+	for _, t := range tables {
+		want[strings.ToLower(t)] = true
+	}
+	var out []migrate.EntityInfo
+	for _, e := range entities {
+		if want[strings.ToLower(e.TableName)] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -1,18 +1,24 @@
 package cli
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/amr0ny/migrateme/internal/core"
-	"github.com/amr0ny/migrateme/internal/database"
-	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/policy"
 	"github.com/spf13/cobra"
 )
 
 func NewGenerateCommand() *cobra.Command {
 	var migrationName string
 	var dryRun bool
+	var showSQL bool
+	var quiet bool
+	var interactive bool
+	var allowLossy bool
+	var analyze bool
 
 	cmd := &cobra.Command{
 		Use:   "generate [migration-name]",
@@ -23,43 +29,99 @@ func NewGenerateCommand() *cobra.Command {
 				migrationName = args[0]
 			}
 
-			cfg, err := config.Load()
+			asJSON := jsonOutput(cmd)
+
+			if interactive && (asJSON || ciMode(cmd)) {
+				return withCode(codeInvalidArgument, fmt.Errorf("--interactive cannot be combined with JSON output or CI mode"))
+			}
+
+			// In CI generate is a "schema is up to date" gate and never writes files.
+			ci := ciMode(cmd)
+			if ci {
+				dryRun, quiet = true, true
+			}
+
+			cfg, err := loadConfig()
 			if err != nil {
-				return fmt.Errorf("failed to load config: %w", err)
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
 			}
 
-			if len(cfg.Registry) == 0 {
-				if len(cfg.EntityPaths) == 0 {
-					return fmt.Errorf("no entity paths configured. Please set 'entity_paths' in config")
-				}
-				return fmt.Errorf("no migratable entities found in paths: %v", cfg.EntityPaths)
+			if err := checkRegistry(cmd, cfg); err != nil {
+				return err
 			}
 
-			fmt.Printf("Found %d entities for migration\n", len(cfg.Registry))
+			if !asJSON {
+				fmt.Printf("Found %d entities for migration\n", len(cfg.Registry))
+			}
 
-			ctx := context.Background()
-			db, err := database.NewDB(ctx, cfg.GetDSN())
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
 			if err != nil {
-				return fmt.Errorf("failed to connect to database: %w", err)
+				return err
 			}
 			defer db.Close()
 
 			migrator := core.NewMigrator(cfg, db)
 
-			result, err := migrator.Generate(ctx, core.GenerateOptions{
+			opts := core.GenerateOptions{
 				MigrationName: migrationName,
 				DryRun:        dryRun,
-			})
-			if err != nil {
-				return err
+				AllowLossy:    allowLossy,
+				Analyze:       analyze,
+			}
+			if dryRun && !asJSON {
+				if !ci {
+					fmt.Println("DRY RUN - No files will be created")
+				}
+				opts.Plan = &core.TextPlanWriter{W: os.Stdout, ShowSQL: showSQL}
+			}
+			if interactive {
+				opts.Review = newReviewer(cmd.InOrStdin(), cmd.OutOrStdout()).Review
+			} else if !quiet && !asJSON {
+				opts.Progress = func(done, total int, table string) {
+					fmt.Fprintf(os.Stderr, "\r[%d/%d] %s\033[K", done, total, table)
+					if done == total {
+						fmt.Fprintln(os.Stderr)
+					}
+				}
 			}
 
-			if dryRun {
-				fmt.Println("DRY RUN - No files were created")
-				fmt.Printf("Detected changes in %d tables:\n", len(result.Changes))
-				for _, change := range result.Changes {
-					fmt.Printf("  - %s: %s (%s)\n", change.TableName, change.Type, change.Details)
+			result, err := migrator.Generate(ctx, opts)
+			var pe *policy.Error
+			if errors.As(err, &pe) {
+				return withCode(codePolicy, err)
+			} else if err != nil {
+				return withCode(codeGenerate, err)
+			}
+
+			if asJSON {
+				if err := writeJSON(os.Stdout, newGenerateJSON(dryRun, result, cfg.Reporter().Diagnostics())); err != nil {
+					return err
+				}
+			}
+
+			if ci {
+				if len(result.Changes) > 0 {
+					return &exitError{
+						Code:   ExitDrift,
+						Err:    fmt.Errorf("schema is out of date: generate would change %d tables", len(result.Changes)),
+						Silent: asJSON,
+					}
 				}
+				if !asJSON {
+					fmt.Println("Schema is up to date")
+				}
+				return nil
+			}
+			if asJSON {
+				return nil
+			}
+
+			if dryRun {
+				fmt.Printf("Detected changes in %d tables\n", len(result.Changes))
 				return nil
 			}
 
@@ -71,6 +133,18 @@ func NewGenerateCommand() *cobra.Command {
 					fmt.Printf("  - %s\n", file)
 				}
 				fmt.Printf("Total changes: %d tables modified\n", len(result.Changes))
+				if analyze {
+					fmt.Println("\nImpact:")
+					for _, c := range result.Changes {
+						fmt.Printf("  - %s: %s\n", c.TableName, c.Type)
+						if err := core.WriteImpact(os.Stdout, c.Impact); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			if result.SchemaFile != "" {
+				fmt.Printf("Schema written to %s\n", result.SchemaFile)
 			}
 
 			return nil
@@ -78,5 +152,28 @@ func NewGenerateCommand() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be generated without creating files")
+	cmd.Flags().BoolVar(&showSQL, "sql", false, "Print generated SQL in dry-run mode")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Do not print per-table progress")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Review each table's SQL and accept, skip or edit it before writing files")
+	cmd.Flags().BoolVar(&analyze, "analyze", false, "Report locks, table rewrites and row counts of affected tables")
+	cmd.Flags().BoolVar(&allowLossy, "allow-lossy", false, "Generate column type changes that may lose data without a using= expression")
+	addGroupFlag(cmd)
 	return cmd
 }
+
+// generateJSON is the JSON output of generate and plan. Its lists are never
+// null, so that consumers can iterate them without checking.
+type generateJSON struct {
+	DryRun bool `json:"dry_run"`
+	*core.GenerateResult
+	Diagnostics []diagnostics.Diagnostic `json:"diagnostics"`
+}
+
+func newGenerateJSON(dryRun bool, result *core.GenerateResult, ds []diagnostics.Diagnostic) generateJSON {
+	out := *result
+	out.CreatedFiles = nonNil(out.CreatedFiles)
+	if out.Changes == nil {
+		out.Changes = []core.TableChange{}
+	}
+	return generateJSON{DryRun: dryRun, GenerateResult: &out, Diagnostics: nonNilDiagnostics(ds)}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/spf13/cobra"
+)
+
+func NewImportHistoryCommand() *cobra.Command {
+	var from, table string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "import-history",
+		Short: "Record the migrations another tool applied as applied",
+		Long: `Import-history reads the history table of golang-migrate, goose or Flyway
+and records the migrations it lists as applied, so that switching to migrateme
+does not need every past migration to be faked by hand.
+
+Versions are matched against the version the migration file names start
+with: 000001_users.up.sql for golang-migrate, 20240101120000_users.sql for
+goose, V1_1__users.sql for Flyway version 1.1. golang-migrate only records the
+current version, so every migration up to it is imported. No migration SQL is
+executed; use --dry-run to review the import first.
+
+golang-migrate names its table schema_migrations like migrateme does: rename
+it first and pass the new name with --table.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, ok := database.ForeignTables[from]; !ok {
+				return withCode(codeInvalidArgument, fmt.Errorf("--from must be %s, %s or %s",
+					database.ToolGolangMigrate, database.ToolGoose, database.ToolFlyway))
+			}
+			if table == "" {
+				table = database.ForeignTables[from]
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			result, err := core.NewMigrator(cfg, db).ImportHistory(ctx, from, table, dryRun)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput(cmd) {
+				result.Imported = nonNil(result.Imported)
+				return writeJSON(os.Stdout, struct {
+					core.ImportResult
+					DryRun bool `json:"dry_run"`
+				}{ImportResult: result, DryRun: dryRun})
+			}
+
+			for _, name := range result.Imported {
+				fmt.Println(" ", symbol(cmd, "✔", "imported"), name)
+			}
+			for _, v := range result.Unmatched {
+				cfg.Reporter().Report(diagnostics.Warningf(diagnostics.UnmatchedVersion,
+					"%s applied version %s, which no migration file has", from, v))
+			}
+			verb := "Imported"
+			if dryRun {
+				verb = "Would import"
+			}
+			fmt.Printf("%s %d migrations from %s", verb, len(result.Imported), table)
+			if len(result.Recorded) > 0 {
+				fmt.Printf(", %d were already recorded", len(result.Recorded))
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Tool to import from: golang-migrate, goose or flyway")
+	cmd.Flags().StringVar(&table, "table", "", "History table of the tool (default: the tool's default table)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print what would be imported")
+	addGroupFlag(cmd)
+	return cmd
+}
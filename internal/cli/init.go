@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const exampleEntity = `package %s
+
+import "time"
+
+// table: "examples"
+// index: idx_examples_created_at(created_at)
+type Example struct {
+	ID        string    ` + "`" + `db:"id,pk,type=uuid,default=gen_random_uuid()"` + "`" + `
+	Name      string    ` + "`" + `db:"name,notnull"` + "`" + `
+	CreatedAt time.Time ` + "`" + `db:"created_at,type=timestamptz,notnull,default=now()"` + "`" + `
+}
+`
+
+func NewInitCommand() *cobra.Command {
+	var (
+		file          string
+		dsn           string
+		migrationsDir string
+		entityPaths   []string
+		example       bool
+		yes           bool
+		force         bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Scaffold migrateme.yaml, the migrations directory and an optional example entity",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := os.Stat(file); err == nil && !force {
+				return fmt.Errorf("%s already exists (use --force to overwrite)", file)
+			}
+
+			defaults := config.Default()
+			if migrationsDir == "" {
+				migrationsDir = defaults.Migrations.Dir
+			}
+			if len(entityPaths) == 0 {
+				entityPaths = []string{"internal/domain/**/*.go"}
+			}
+
+			if !yes && !ciMode(cmd) {
+				p := &prompter{in: bufio.NewReader(cmd.InOrStdin()), out: cmd.OutOrStdout()}
+				dsn = p.ask("Database DSN", dsn)
+				migrationsDir = p.ask("Migrations directory", migrationsDir)
+				entityPaths = splitList(p.ask("Entity paths (comma separated)", strings.Join(entityPaths, ",")))
+				if !cmd.Flags().Changed("example") {
+					example = p.confirm("Generate an example entity", example)
+				}
+				if p.err != nil {
+					return p.err
+				}
+			}
+
+			cfg := defaults
+			cfg.Database.DSN = dsn
+			cfg.Migrations.Dir = migrationsDir
+			cfg.EntityPaths = entityPaths
+
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetIndent(2)
+			if err := enc.Encode(cfg); err != nil {
+				return fmt.Errorf("failed to encode config: %w", err)
+			}
+			if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", file, err)
+			}
+			fmt.Println("Created", file)
+
+			if err := os.MkdirAll(migrationsDir, 0o755); err != nil {
+				return fmt.Errorf("failed to create migrations directory: %w", err)
+			}
+			fmt.Println("Created", migrationsDir+string(filepath.Separator))
+
+			if example && len(entityPaths) > 0 {
+				path, err := writeExampleEntity(entityPaths[0])
+				if err != nil {
+					return err
+				}
+				fmt.Println("Created", path)
+			}
+
+			fmt.Println("\nNext steps:\n  migrateme generate\n  migrateme run")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&file, "file", "migrateme.yaml", "Config file to create")
+	cmd.Flags().StringVar(&dsn, "dsn", "", "Database connection string")
+	cmd.Flags().StringVar(&migrationsDir, "migrations-dir", "", "Migrations directory")
+	cmd.Flags().StringSliceVar(&entityPaths, "entity-paths", nil, "Entity path globs")
+	cmd.Flags().BoolVar(&example, "example", false, "Generate an example entity")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not prompt, use flags and defaults")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing config file")
+	return cmd
+}
+
+// writeExampleEntity places example.go into the static (non-glob) prefix of the
+// first entity path, so the generated entity is picked up by discovery.
+func writeExampleEntity(entityPath string) (string, error) {
+	dir := entityPath
+	if i := strings.IndexAny(dir, "*?["); i >= 0 {
+		dir = dir[:i]
+	}
+	if strings.HasSuffix(dir, ".go") {
+		dir = filepath.Dir(dir)
+	}
+	dir = filepath.Clean(dir)
+	if dir == "" {
+		dir = "."
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	pkg := filepath.Base(dir)
+	if pkg == "." || pkg == string(filepath.Separator) {
+		pkg = "domain"
+	}
+	pkg = strings.NewReplacer("-", "", ".", "").Replace(pkg)
+
+	path := filepath.Join(dir, "example.go")
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%s already exists", path)
+	}
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(exampleEntity, pkg)), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write example entity: %w", err)
+	}
+	return path, nil
+}
+
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	err error
+}
+
+func (p *prompter) ask(question, def string) string {
+	if p.err != nil {
+		return def
+	}
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		p.err = err
+		return def
+	}
+	if v := strings.TrimSpace(line); v != "" {
+		return v
+	}
+	return def
+}
+
+func (p *prompter) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	switch strings.ToLower(p.ask(question+" ("+hint+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return def
+	}
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
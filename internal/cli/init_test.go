@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+)
+
+// chdirModule changes into a new Go module, where init writes its files and
+// discovery finds them. Tests using it do not run in parallel; they also
+// clear the environment variables that would override the written config.
+func chdirModule(t *testing.T) string {
+	t.Helper()
+	for _, env := range []string{"DATABASE_DSN", "MIGRATIONS_DIR", "MIGRATIONS_TABLE", "ENTITY_PATHS", "MIGRATEME_SERVICE"} {
+		t.Setenv(env, "")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n\ngo 1.24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	return dir
+}
+
+func runInit(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd := NewInitCommand()
+	cmd.SetArgs(args)
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+// loadInitConfig reads the written config back the way every command does.
+// LoadService is used over Load, which loads only once per process.
+func loadInitConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.LoadService("", "migrateme.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestInit_Yes(t *testing.T) {
+	chdirModule(t)
+
+	if _, err := runInit(t, "", "--yes", "--example", "--dsn", "postgres://localhost:5432/app"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := loadInitConfig(t)
+	if cfg.Database.DSN != "postgres://localhost:5432/app" || cfg.Migrations.Dir != "migrations" {
+		t.Errorf("dsn %q, migrations dir %q", cfg.Database.DSN, cfg.Migrations.Dir)
+	}
+	if info, err := os.Stat("migrations"); err != nil || !info.IsDir() {
+		t.Errorf("migrations directory not created: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("internal", "domain", "example.go")); err != nil {
+		t.Fatalf("example entity not written: %v", err)
+	}
+	build, ok := cfg.Registry["examples"]
+	if !ok {
+		t.Fatalf("example entity not discovered, registry has %d tables", len(cfg.Registry))
+	}
+	var columns []string
+	for _, c := range build("examples").Columns {
+		columns = append(columns, c.ColumnName)
+	}
+	if got := strings.Join(columns, " "); got != "id name created_at" {
+		t.Errorf("columns = %q", got)
+	}
+}
+
+func TestInit_Prompts(t *testing.T) {
+	chdirModule(t)
+
+	// The answers: DSN, migrations directory, entity paths and the example.
+	out, err := runInit(t, "postgres://localhost:5432/shop\ndb/migrations\nmodels/*.go\ny\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, question := range []string{"Database DSN: ", "Migrations directory [migrations]: ", "Entity paths (comma separated) [internal/domain/**/*.go]: ", "Generate an example entity (y/N): "} {
+		if !strings.Contains(out, question) {
+			t.Errorf("expected the prompt %q, got %q", question, out)
+		}
+	}
+
+	cfg := loadInitConfig(t)
+	if cfg.Database.DSN != "postgres://localhost:5432/shop" || cfg.Migrations.Dir != "db/migrations" || strings.Join(cfg.EntityPaths, ",") != "models/*.go" {
+		t.Errorf("dsn %q, migrations dir %q, entity paths %v", cfg.Database.DSN, cfg.Migrations.Dir, cfg.EntityPaths)
+	}
+	src, err := os.ReadFile(filepath.Join("models", "example.go"))
+	if err != nil || !strings.HasPrefix(string(src), "package models\n") {
+		t.Fatalf("example entity: %v\n%s", err, src)
+	}
+	if _, ok := cfg.Registry["examples"]; !ok {
+		t.Error("example entity not discovered")
+	}
+}
+
+func TestInit_RefusesOverwrite(t *testing.T) {
+	chdirModule(t)
+
+	if _, err := runInit(t, "", "--yes", "--dsn", "postgres://localhost:5432/app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runInit(t, "", "--yes", "--dsn", "postgres://localhost:5432/other"); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("expected an existing config to be kept without --force, got %v", err)
+	}
+	if dsn := loadInitConfig(t).Database.DSN; dsn != "postgres://localhost:5432/app" {
+		t.Errorf("config overwritten without --force: dsn %q", dsn)
+	}
+
+	if _, err := runInit(t, "", "--yes", "--force", "--dsn", "postgres://localhost:5432/other"); err != nil {
+		t.Fatal(err)
+	}
+	if dsn := loadInitConfig(t).Database.DSN; dsn != "postgres://localhost:5432/other" {
+		t.Errorf("config not overwritten with --force: dsn %q", dsn)
+	}
+}
+
+func TestWriteExampleEntity(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	tests := []struct {
+		entityPath string
+		file       string
+		pkg        string
+	}{
+		{filepath.Join(root, "internal", "domain", "**", "*.go"), filepath.Join(root, "internal", "domain", "example.go"), "domain"},
+		{filepath.Join(root, "my-models", "entities.go"), filepath.Join(root, "my-models", "example.go"), "mymodels"},
+		{filepath.Join(root, "v1.2", "*.go"), filepath.Join(root, "v1.2", "example.go"), "v12"},
+	}
+	for _, tt := range tests {
+		path, err := writeExampleEntity(tt.entityPath)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.entityPath, err)
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != tt.file || !strings.HasPrefix(string(src), "package "+tt.pkg+"\n") {
+			t.Errorf("%s: wrote %s with\n%s", tt.entityPath, path, src)
+		}
+
+		// An existing example is never overwritten.
+		if _, err := writeExampleEntity(tt.entityPath); err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("%s: second write: %v", tt.entityPath, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/policy"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// Error codes reported in JSON output. They are part of the machine-readable
+// contract, so existing values must not change.
+const (
+	codeError           = "error"
+	codeInvalidArgument = "invalid_argument"
+	codeConfig          = "config_error"
+	codeConnection      = "connection_error"
+	codeGenerate        = "generate_failed"
+	codeMigration       = "migration_failed"
+	codeRollback        = "rollback_failed"
+	codePolicy          = "policy_violation"
+	codeValidation      = "validation_failed"
+	codeVersionMismatch = "version_mismatch"
+)
+
+// commandError attaches a stable code to an error returned from a command.
+type commandError struct {
+	Code string
+	Err  error
+}
+
+func (e *commandError) Error() string { return e.Err.Error() }
+func (e *commandError) Unwrap() error { return e.Err }
+
+func withCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &commandError{Code: code, Err: err}
+}
+
+func errorCode(err error) string {
+	var ce *commandError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	return codeError
+}
+
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringP("output", "o", outputText, "Output format: text or json")
+}
+
+func addCIFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool("ci", false, "Non-interactive CI mode: no prompts or emoji, strict checksums, explicit destructive flags, generate fails on changes")
+}
+
+func addRequireEntitiesFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool("require-entities", false, "Fail instead of warning when no entities are registered")
+}
+
+func ciMode(cmd *cobra.Command) bool {
+	ci, _ := cmd.Flags().GetBool("ci")
+	return ci
+}
+
+// symbol returns the decorative symbol, or its plain replacement in CI mode.
+func symbol(cmd *cobra.Command, decorated, plain string) string {
+	if ciMode(cmd) {
+		return plain
+	}
+	return decorated
+}
+
+func outputFormat(cmd *cobra.Command) (string, error) {
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return outputText, nil
+	}
+	switch format {
+	case outputText, outputJSON:
+		return format, nil
+	default:
+		return "", withCode(codeInvalidArgument, fmt.Errorf("unknown output format %q (expected text or json)", format))
+	}
+}
+
+func jsonOutput(cmd *cobra.Command) bool {
+	format, _ := outputFormat(cmd)
+	return format == outputJSON
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type jsonError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonErrorResult struct {
+	Error       jsonError                `json:"error"`
+	Violations  []policy.Violation       `json:"violations,omitempty"`
+	Diagnostics []diagnostics.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// Execute runs the root command and returns the process exit code.
+func Execute() int {
+	root := NewRootCommand()
+	root.SilenceErrors = true
+
+	ctx, stop := interruptContext()
+	defer stop()
+	cmd, err := root.ExecuteContextC(ctx)
+	if err == nil {
+		return ExitOK
+	}
+
+	if isSilent(err) {
+		return exitCode(err)
+	}
+	if cmd != nil && jsonOutput(cmd) {
+		result := jsonErrorResult{
+			Error:       jsonError{Code: errorCode(err), Message: err.Error()},
+			Diagnostics: collectedDiagnostics(),
+		}
+		var pe *policy.Error
+		if errors.As(err, &pe) {
+			result.Violations = pe.Violations
+		}
+		writeJSON(os.Stdout, result)
+	} else {
+		log.Printf("Error: %v", err)
+	}
+	return exitCode(err)
+}
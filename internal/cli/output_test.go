@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+)
+
+// The JSON output of status, plan and generate is read by scripts, so its
+// field names and empty lists are pinned here.
+func TestJSONOutputSchema(t *testing.T) {
+	t.Parallel()
+
+	applied := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{
+			name: "status, empty",
+			v:    statusJSON{Applied: nonNil(nil), Pending: nonNil(nil)},
+			want: `{
+  "applied": [],
+  "pending": [],
+  "managed_tables": 0
+}
+`,
+		},
+		{
+			name: "status --check --verbose",
+			v: statusJSON{
+				Applied: []string{"001_init"},
+				Pending: []string{"002_add_email"},
+				History: []historyEntry{{Migration: "001_init", AppliedAt: applied, Checksum: "abc", AppliedBy: "ci", DurationMS: 12, Batch: 1}},
+				Drift:   []core.TableChange{{TableName: "users", Type: core.AddColumns}},
+				Managed: 2,
+			},
+			want: `{
+  "applied": [
+    "001_init"
+  ],
+  "pending": [
+    "002_add_email"
+  ],
+  "history": [
+    {
+      "migration": "001_init",
+      "applied_at": "2024-05-01T12:00:00Z",
+      "checksum": "abc",
+      "applied_by": "ci",
+      "duration_ms": 12,
+      "batch": 1
+    }
+  ],
+  "drift": [
+    {
+      "table": "users",
+      "type": "add_columns"
+    }
+  ],
+  "managed_tables": 2
+}
+`,
+		},
+		{
+			name: "plan, no changes",
+			v:    newGenerateJSON(true, &core.GenerateResult{}, nil),
+			want: `{
+  "dry_run": true,
+  "created_files": [],
+  "changes": [],
+  "diagnostics": []
+}
+`,
+		},
+		{
+			name: "generate",
+			v: newGenerateJSON(false, &core.GenerateResult{
+				CreatedFiles: []string{"migrations/002_add_email.up.sql"},
+				Changes:      []core.TableChange{{TableName: "users", Owner: "team-a", Type: core.AddColumns}},
+				SchemaFile:   "schema.sql",
+			}, []diagnostics.Diagnostic{diagnostics.Warningf(diagnostics.NoEntities, "no entities")}),
+			want: `{
+  "dry_run": false,
+  "created_files": [
+    "migrations/002_add_email.up.sql"
+  ],
+  "changes": [
+    {
+      "table": "users",
+      "owner": "team-a",
+      "type": "add_columns"
+    }
+  ],
+  "schema_file": "schema.sql",
+  "diagnostics": [
+    {
+      "code": "MM1003",
+      "severity": "warning",
+      "message": "no entities"
+    }
+  ]
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var b bytes.Buffer
+			if err := writeJSON(&b, tt.v); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/spf13/cobra"
+)
+
+func NewPlanCommand() *cobra.Command {
+	var groupByOwner bool
+	var showSQL bool
+	var analyze bool
+
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show pending schema changes without creating migration files",
+		Long: `Show pending schema changes without creating migration files.
+
+With --analyze every table also lists the statements that take a lock, which
+lock they take, whether they rewrite or scan the whole table, and the
+planner's estimate of its rows, so reviewers can judge the downtime risk
+before the migration is written.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON := jsonOutput(cmd)
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if err := checkRegistry(cmd, cfg); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			migrator := core.NewMigrator(cfg, db)
+
+			opts := core.GenerateOptions{DryRun: true, Analyze: analyze}
+			var grouped *core.OwnerGroupedPlanWriter
+			switch {
+			case asJSON:
+				// changes are reported from the result
+			case groupByOwner:
+				grouped = &core.OwnerGroupedPlanWriter{W: os.Stdout, ShowSQL: showSQL}
+				opts.Plan = grouped
+			default:
+				opts.Plan = &core.TextPlanWriter{W: os.Stdout, ShowSQL: showSQL}
+			}
+
+			result, err := migrator.Generate(ctx, opts)
+			if err != nil {
+				return withCode(codeGenerate, err)
+			}
+			if asJSON {
+				return writeJSON(os.Stdout, newGenerateJSON(true, result, cfg.Reporter().Diagnostics()))
+			}
+			if grouped != nil {
+				if err := grouped.Flush(); err != nil {
+					return err
+				}
+			}
+
+			if len(result.Changes) == 0 {
+				fmt.Println("No changes detected")
+				return nil
+			}
+			fmt.Printf("\nDetected changes in %d tables\n", len(result.Changes))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&groupByOwner, "group-by-owner", false, "Group changes by the owning team (migrate:owner)")
+	cmd.Flags().BoolVar(&showSQL, "sql", false, "Print generated SQL for each table")
+	cmd.Flags().BoolVar(&analyze, "analyze", false, "Report locks, table rewrites and row counts of affected tables")
+	return cmd
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/spf13/cobra"
+)
+
+func NewRenumberCommand() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "renumber",
+		Short: "Give pending migrations consecutive sequential versions",
+		Long: `Renumber renames pending migrations so that their versions follow the last
+applied migration without gaps or duplicates, keeping their current order.
+Applied migrations are never renamed. It needs migrations.naming: sequential
+and is typically run after merging branches that both added migrations.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			renames, err := core.NewMigrator(cfg, db).Renumber(ctx, dryRun)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput(cmd) {
+				if renames == nil {
+					renames = []core.Rename{}
+				}
+				return writeJSON(os.Stdout, struct {
+					Renamed []core.Rename `json:"renamed"`
+					DryRun  bool          `json:"dry_run"`
+				}{Renamed: renames, DryRun: dryRun})
+			}
+
+			if len(renames) == 0 {
+				fmt.Println("Migrations are already numbered in order")
+				return nil
+			}
+			for _, r := range renames {
+				fmt.Printf("%s -> %s\n", r.From, r.To)
+			}
+			if dryRun {
+				fmt.Printf("Would rename %d files\n", len(renames))
+			} else {
+				fmt.Printf("Renamed %d files\n", len(renames))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the planned renames")
+	return cmd
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/spf13/cobra"
+)
+
+func NewRepairCommand() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "repair",
+		Short: "Reconcile the migration history with the migration files",
+		Long: `Repair updates the migrations table to match the migrations directory:
+
+  - history rows of renamed files are moved to the new name, matched by the
+    checksum of the up SQL;
+  - history rows of deleted files are removed;
+  - checksums of intentionally edited files are updated.
+
+No migration SQL is executed. Use --dry-run to review the changes first.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			actions, err := core.NewMigrator(cfg, db).Repair(ctx, dryRun)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput(cmd) {
+				if actions == nil {
+					actions = []core.RepairAction{}
+				}
+				return writeJSON(os.Stdout, struct {
+					Actions []core.RepairAction `json:"actions"`
+					DryRun  bool                `json:"dry_run"`
+				}{Actions: actions, DryRun: dryRun})
+			}
+
+			if len(actions) == 0 {
+				fmt.Println("Migration history matches the migration files")
+				return nil
+			}
+			for _, a := range actions {
+				switch a.Action {
+				case core.RepairRenamed:
+					fmt.Printf("  %s %s -> %s\n", a.Action, a.Name, a.To)
+				default:
+					fmt.Printf("  %s %s\n", a.Action, a.Name)
+				}
+			}
+			if dryRun {
+				fmt.Printf("Would make %d changes\n", len(actions))
+			} else {
+				fmt.Printf("Made %d changes\n", len(actions))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only print the planned changes")
+	return cmd
+}
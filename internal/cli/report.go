@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/spf13/cobra"
+)
+
+func NewReportCommand() *cobra.Command {
+	var format string
+	var analyze bool
+
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Summarize pending migrations and entity drift for a pull request comment",
+		Long: `Report renders the migrations not applied yet and the entity changes no
+migration covers yet as a markdown summary, for any CI system to post as a
+pull request comment:
+
+  migrateme report --format markdown > report.md
+
+Each migration and change has its SQL in a collapsible section, and those
+dropping or truncating data carry a destructive badge. Entity changes are
+only compared once no migration is pending. With --analyze the changes list
+the locks they take. Nothing is written to the database or the migrations
+directory.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "markdown" {
+				return withCode(codeInvalidArgument, fmt.Errorf("unknown report format %q (expected markdown)", format))
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			report, err := core.NewMigrator(cfg, db).Report(ctx, analyze)
+			if err != nil {
+				return withCode(codeGenerate, err)
+			}
+			if jsonOutput(cmd) {
+				return writeJSON(os.Stdout, report)
+			}
+			return core.WriteMarkdownReport(os.Stdout, report)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "markdown", "Report format: markdown")
+	cmd.Flags().BoolVar(&analyze, "analyze", false, "List the locks entity changes take")
+	addGroupFlag(cmd)
+	return cmd
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// errReviewAborted is returned when the user quits an interactive review.
+var errReviewAborted = errors.New("generation aborted, no files were written")
+
+// reviewer asks the user what to do with every table of an interactive
+// generate run.
+type reviewer struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	acceptAll bool
+}
+
+func newReviewer(in io.Reader, out io.Writer) *reviewer {
+	return &reviewer{in: bufio.NewReader(in), out: out}
+}
+
+func (r *reviewer) Review(change core.TableChange, diff migrate.TableDiff) (migrate.TableDiff, bool, error) {
+	if r.acceptAll {
+		return diff, true, nil
+	}
+
+	for {
+		r.show(change, diff)
+		fmt.Fprint(r.out, "Accept this table? [y]es, [n]o/skip, [e]dit, [a]ccept all, [q]uit: ")
+
+		line, err := r.in.ReadString('\n')
+		if err != nil && line == "" {
+			return diff, false, errReviewAborted
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes", "":
+			return diff, true, nil
+		case "n", "no", "s", "skip":
+			return diff, false, nil
+		case "a", "all":
+			r.acceptAll = true
+			return diff, true, nil
+		case "e", "edit":
+			edited, err := editDiff(change, diff)
+			if err != nil {
+				fmt.Fprintf(r.out, "Edit failed: %v\n", err)
+				continue
+			}
+			if len(edited.Up) == 0 {
+				fmt.Fprintln(r.out, "Up section is empty, skipping the table")
+				return edited, false, nil
+			}
+			diff = edited
+		case "q", "quit":
+			return diff, false, errReviewAborted
+		default:
+			fmt.Fprintln(r.out, "Please answer y, n, e, a or q")
+		}
+	}
+}
+
+func (r *reviewer) show(change core.TableChange, diff migrate.TableDiff) {
+	fmt.Fprintf(r.out, "\n=== %s (%s) ===\n-- up\n", change.TableName, change.Type)
+	for _, stmt := range append(diff.Up, diff.PostUp...) {
+		fmt.Fprintf(r.out, "%s;\n", stmt)
+	}
+	fmt.Fprintln(r.out, "-- down")
+	for _, stmt := range diff.Down {
+		fmt.Fprintf(r.out, "%s;\n", stmt)
+	}
+}
+
+// editDiff opens the table's statements in $EDITOR and reads them back.
+func editDiff(change core.TableChange, diff migrate.TableDiff) (migrate.TableDiff, error) {
+	f, err := os.CreateTemp("", "migrateme-"+change.TableName+"-*.sql")
+	if err != nil {
+		return diff, err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.WriteString(f, core.FormatTableDiff(change, diff)); err != nil {
+		f.Close()
+		return diff, err
+	}
+	if err := f.Close(); err != nil {
+		return diff, err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return diff, fmt.Errorf("editor: %w", err)
+	}
+
+	content, err := os.ReadFile(f.Name())
+	if err != nil {
+		return diff, err
+	}
+	return core.EditTableDiff(diff, string(content))
+}
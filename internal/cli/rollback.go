@@ -1,16 +1,17 @@
 package cli
 
 import (
-	"context"
 	"fmt"
+	"os"
+	"strconv"
+
 	"github.com/amr0ny/migrateme/internal/core"
-	"github.com/amr0ny/migrateme/internal/database"
-	"github.com/amr0ny/migrateme/pkg/config"
 	"github.com/spf13/cobra"
-	"strconv"
 )
 
 func NewRollbackCommand() *cobra.Command {
+	var allowDestructive bool
+
 	cmd := &cobra.Command{
 		Use:   "rollback <n>",
 		Short: "Rollback last N applied migrations",
@@ -18,21 +19,27 @@ func NewRollbackCommand() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			n, err := strconv.Atoi(args[0])
 			if err != nil {
-				return fmt.Errorf("invalid number: %w", err)
+				return withCode(codeInvalidArgument, fmt.Errorf("invalid number: %w", err))
 			}
 			if n <= 0 {
-				return fmt.Errorf("N must be >= 1")
+				return withCode(codeInvalidArgument, fmt.Errorf("N must be >= 1"))
+			}
+			if ciMode(cmd) && !allowDestructive {
+				return withCode(codeInvalidArgument, fmt.Errorf("rollback is destructive, pass --allow-destructive to run it in CI mode"))
 			}
 
-			cfg, err := config.Load()
+			cfg, err := loadConfig()
 			if err != nil {
-				return fmt.Errorf("failed to load config: %w", err)
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
 			}
 
-			ctx := context.Background()
-			db, err := database.NewDB(ctx, cfg.GetDSN())
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
 			if err != nil {
-				return fmt.Errorf("failed to connect to database: %w", err)
+				return err
 			}
 			defer db.Close()
 
@@ -40,7 +47,13 @@ func NewRollbackCommand() *cobra.Command {
 
 			rolledBack, err := migrator.Rollback(ctx, n)
 			if err != nil {
-				return err
+				return withCode(codeRollback, err)
+			}
+
+			if jsonOutput(cmd) {
+				return writeJSON(os.Stdout, struct {
+					RolledBack []string `json:"rolled_back"`
+				}{RolledBack: nonNil(rolledBack)})
 			}
 
 			if len(rolledBack) == 0 {
@@ -52,5 +65,7 @@ func NewRollbackCommand() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().BoolVar(&allowDestructive, "allow-destructive", false, "Confirm rollback in CI mode")
+	addGroupFlag(cmd)
 	return cmd
 }
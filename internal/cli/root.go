@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"github.com/amr0ny/migrateme/pkg/config"
 	"github.com/spf13/cobra"
 )
 
@@ -9,13 +10,55 @@ func NewRootCommand() *cobra.Command {
 		Use:     "migrateme",
 		Aliases: []string{"migrate"},
 		Short:   "Database migration tool",
+		CompletionOptions: cobra.CompletionOptions{
+			DisableDefaultCmd: true,
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := outputFormat(cmd); err != nil {
+				return err
+			}
+			if service, _ := cmd.Flags().GetString("service"); service != "" {
+				config.SetService(service)
+			}
+			// Flags and arguments are valid at this point; runtime failures and
+			// exit statuses should not be followed by usage text.
+			cmd.SilenceUsage = true
+			return nil
+		},
 	}
+	addOutputFlag(cmd)
+	addCIFlag(cmd)
+	addRequireEntitiesFlag(cmd)
+	addLogSQLFlags(cmd)
+	addServiceFlag(cmd)
 
 	cmd.AddCommand(NewGenerateCommand())
+	cmd.AddCommand(NewPlanCommand())
 	cmd.AddCommand(NewRunCommand())
 	cmd.AddCommand(NewStatusCommand())
 	cmd.AddCommand(NewRollbackCommand())
 	cmd.AddCommand(NewCreateCommand())
+	cmd.AddCommand(NewRenumberCommand())
+	cmd.AddCommand(NewValidateCommand())
+	cmd.AddCommand(NewVerifyCommand())
+	cmd.AddCommand(NewTestCommand())
+	cmd.AddCommand(NewDriftCommand())
+	cmd.AddCommand(NewCheckTagsCommand())
+	cmd.AddCommand(NewRepairCommand())
+	cmd.AddCommand(NewImportHistoryCommand())
+	cmd.AddCommand(NewExportCommand())
+	cmd.AddCommand(NewDataCommand())
+	cmd.AddCommand(NewSnapshotCommand())
+	cmd.AddCommand(NewServeCommand())
+	cmd.AddCommand(NewReportCommand())
+	cmd.AddCommand(NewDiscoverCommand())
+	cmd.AddCommand(NewGenCommand())
+	cmd.AddCommand(NewSchemaCommand())
+	cmd.AddCommand(NewInitCommand())
+	cmd.AddCommand(NewExampleCommand())
+	cmd.AddCommand(NewCompletionCommand())
+	cmd.AddCommand(NewBenchCommand())
+	cmd.AddCommand(NewGenDocsCommand())
 
 	return cmd
 }
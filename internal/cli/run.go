@@ -2,7 +2,14 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
 	"github.com/amr0ny/migrateme/internal/core"
 	"github.com/amr0ny/migrateme/internal/database"
 	"github.com/amr0ny/migrateme/pkg/config"
@@ -10,33 +17,294 @@ import (
 )
 
 func NewRunCommand() *cobra.Command {
+	var allowDestructive, allowOutOfOrder, quiet, resume, detailedExitCode, profile bool
+	var waitForDB time.Duration
+	var profileOut string
+	var parallel int
+
 	cmd := &cobra.Command{
 		Use:   "run",
 		Short: "Apply all pending migrations",
+		Long: `Apply all pending migrations in order.
+
+A migration failing with lock_not_available (e.g. after lock_timeout) or
+deadlock_detected is applied again with exponential backoff when
+migrations.lock_retry is configured; every attempt is logged to stderr.
+
+Progress is written to stderr: each migration as it starts, with its number
+of statements, and a line every few seconds while a long one (e.g. a
+backfill) is still running. A table of durations follows at the end.
+
+Runs against the same database are serialized with an advisory lock: a run
+started while another one is applying migrations waits for it and then
+finds them applied. For Kubernetes init containers and Jobs, --wait-for-db
+keeps retrying the connection until the database accepts it, up to the
+given time, and --detailed-exitcode tells "applied N" (exit code 4) from
+"already up to date" (exit code 0).
+
+--profile times every statement and reads pg_stat_statements before and
+after the run, when the extension is installed, and prints the slowest
+statements and the largest server-side deltas; --profile-out also writes
+the full report as JSON. Transactional migrations are then sent statement
+by statement inside their transaction instead of as one query.
+
+--parallel N applies up to N pending migrations at once, each on its own
+connection, when the tables named in their statements do not overlap.
+Migrations sharing a table, or doing anything whose tables cannot be told
+(functions, types, views, DO blocks, DROP ... CASCADE), wait for the ones
+before them, so dependency order holds; so do no_transaction migrations.
+Each migration of a group runs in a transaction held open until the whole
+group succeeded, then all are committed and recorded in file order. When
+one fails, the whole group is rolled back.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load()
+			cfg, err := loadConfig()
 			if err != nil {
-				return fmt.Errorf("failed to load config: %w", err)
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
 			}
 
-			ctx := context.Background()
-			db, err := database.NewDB(ctx, cfg.GetDSN())
+			ctx := cmd.Context()
+			db, err := connectWaiting(ctx, cmd, cfg, waitForDB)
 			if err != nil {
-				return fmt.Errorf("failed to connect to database: %w", err)
+				return err
 			}
 			defer db.Close()
 
 			migrator := core.NewMigrator(cfg, db)
 
-			applied, err := migrator.Run(ctx)
+			asJSON := jsonOutput(cmd)
+			progress := &runProgress{w: cmd.ErrOrStderr(), quiet: quiet || asJSON, parallel: parallel > 1}
+			defer progress.stop()
+
+			var prof *core.Profile
+			if profile || profileOut != "" {
+				prof = &core.Profile{}
+			}
+
+			ci := ciMode(cmd)
+			applied, err := migrator.Run(ctx, core.RunOptions{
+				StrictChecksums:  ci,
+				BlockDestructive: ci && !allowDestructive,
+				AllowOutOfOrder:  allowOutOfOrder,
+				Resume:           resume,
+				OnRetry: func(migration string, attempt int, err error, wait time.Duration) {
+					fmt.Fprintf(cmd.ErrOrStderr(), "migration %s lost a lock conflict (attempt %d/%d): %v; retrying in %s\n",
+						migration, attempt, cfg.Migrations.LockRetry.Attempts, err, wait)
+				},
+				Progress: progress.report,
+				Lock:     true,
+				OnLockWait: func() {
+					fmt.Fprintln(cmd.ErrOrStderr(), "another run is applying migrations, waiting for it to finish")
+				},
+				Profile:  prof,
+				Parallel: parallel,
+			})
+			progress.stop()
+			if prof != nil {
+				if profileOut != "" {
+					if err := writeProfileFile(profileOut, prof); err != nil {
+						return err
+					}
+				}
+				// A failed run is profiled as well, up to the failing statement.
+				if err != nil && !asJSON {
+					if err := core.WriteProfile(cmd.ErrOrStderr(), prof, profileTop); err != nil {
+						return err
+					}
+				}
+			}
 			if err != nil {
-				return err
+				return withCode(codeMigration, err)
+			}
+
+			if asJSON {
+				timings := make([]migrationTiming, 0, len(progress.done))
+				for _, p := range progress.done {
+					timings = append(timings, migrationTiming{Migration: p.Migration, Statements: p.Statements, DurationMS: p.Elapsed.Milliseconds()})
+				}
+				err := writeJSON(os.Stdout, struct {
+					Applied []string          `json:"applied"`
+					Timings []migrationTiming `json:"timings"`
+					Profile *core.Profile     `json:"profile,omitempty"`
+				}{Applied: nonNil(applied), Timings: timings, Profile: prof})
+				if err != nil {
+					return err
+				}
+				return appliedExit(detailedExitCode, applied)
 			}
 
+			if len(progress.done) > 0 {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "MIGRATION\tSTATEMENTS\tDURATION")
+				var total time.Duration
+				for _, p := range progress.done {
+					fmt.Fprintf(w, "%s\t%d\t%s\n", p.Migration, p.Statements, p.Elapsed.Round(time.Millisecond))
+					total += p.Elapsed
+				}
+				fmt.Fprintf(w, "total\t\t%s\n", total.Round(time.Millisecond))
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				fmt.Println()
+			}
+			if prof != nil && len(applied) > 0 {
+				if err := core.WriteProfile(os.Stdout, prof, profileTop); err != nil {
+					return err
+				}
+				fmt.Println()
+			}
 			fmt.Printf("Applied %d migrations\n", len(applied))
-			return nil
+			return appliedExit(detailedExitCode, applied)
 		},
 	}
 
+	cmd.Flags().BoolVar(&allowDestructive, "allow-destructive", false, "Allow migrations that drop or truncate data in CI mode")
+	cmd.Flags().BoolVar(&allowOutOfOrder, "allow-out-of-order", false, "Apply pending migrations older than the newest applied one")
+	cmd.Flags().BoolVar(&resume, "resume", false, "Continue a partially applied no_transaction migration after its last successful statement")
+	cmd.Flags().DurationVar(&waitForDB, "wait-for-db", 0, "Keep retrying the connection until the database accepts it, up to this long (e.g. 2m)")
+	cmd.Flags().BoolVar(&detailedExitCode, "detailed-exitcode", false, "Exit with code 4 when migrations were applied, 0 when already up to date")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Do not print per-migration progress")
+	cmd.Flags().BoolVar(&profile, "profile", false, "Time every statement and report the slowest ones with their pg_stat_statements deltas")
+	cmd.Flags().IntVar(&parallel, "parallel", 1, "Apply up to this many migrations touching disjoint tables at once")
+	cmd.Flags().StringVar(&profileOut, "profile-out", "", "Also write the full profile as JSON to this file (implies --profile)")
+	addGroupFlag(cmd)
 	return cmd
 }
+
+// profileTop is how many statements and pg_stat_statements entries the
+// profile report of run lists.
+const profileTop = 10
+
+func writeProfileFile(path string, prof *core.Profile) error {
+	content, err := json.MarshalIndent(prof, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	return nil
+}
+
+// connectWaiting connects like connectDB; with a positive wait it keeps
+// retrying until the database accepts connections or wait has passed,
+// e.g. in an init container started together with the database.
+func connectWaiting(ctx context.Context, cmd *cobra.Command, cfg *config.Config, wait time.Duration) (*database.DB, error) {
+	if wait <= 0 {
+		return connectDB(ctx, cmd, cfg)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	start := time.Now()
+	db, err := connectDB(waitCtx, cmd, cfg,
+		database.WithRetry(database.RetryPolicy{Attempts: math.MaxInt, Backoff: 500 * time.Millisecond, MaxBackoff: 5 * time.Second}),
+		database.OnRetry(func(attempt int, err error, next time.Duration) {
+			fmt.Fprintf(cmd.ErrOrStderr(), "database not ready after %s (attempt %d): %v; retrying in %s\n",
+				time.Since(start).Round(time.Second), attempt, err, next)
+		}))
+	if err != nil && ctx.Err() == nil && waitCtx.Err() != nil {
+		return nil, withCode(codeConnection, fmt.Errorf("database not ready within %s: %w", wait, err))
+	}
+	return db, err
+}
+
+// appliedExit turns a successful run into exit code 4 when migrations were
+// applied and detailed exit codes are requested.
+func appliedExit(detailed bool, applied []string) error {
+	if !detailed || len(applied) == 0 {
+		return nil
+	}
+	return &exitError{Code: ExitApplied, Err: fmt.Errorf("applied %d migrations", len(applied)), Silent: true}
+}
+
+type migrationTiming struct {
+	Migration  string `json:"migration"`
+	Statements int    `json:"statements"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// runStillRunning is how often run reports a migration that is still
+// running.
+const runStillRunning = 5 * time.Second
+
+// runProgress prints the progress of run and collects the finished
+// migrations for the summary.
+type runProgress struct {
+	w     io.Writer
+	quiet bool
+	// parallel names the migration in every line, as several can be
+	// running at once.
+	parallel bool
+
+	done []core.MigrationProgress
+	// running holds, for each running migration, the channel stopping its
+	// still-running report.
+	running map[string]chan struct{}
+}
+
+func (p *runProgress) report(ev core.MigrationProgress) {
+	if ev.Done {
+		p.stopOne(ev.Migration)
+		p.done = append(p.done, ev)
+		if !p.quiet {
+			fmt.Fprintf(p.w, "      %sdone in %s\n", p.label(ev.Migration), ev.Elapsed.Round(time.Millisecond))
+		}
+		return
+	}
+	if p.quiet {
+		return
+	}
+	fmt.Fprintf(p.w, "[%d/%d] %s (%d statements)\n", ev.Index, ev.Total, ev.Migration, ev.Statements)
+
+	start, label := time.Now(), p.label(ev.Migration)
+	stopped := make(chan struct{})
+	if p.running == nil {
+		p.running = map[string]chan struct{}{}
+	}
+	p.running[ev.Migration] = stopped
+	go func() {
+		ticker := time.NewTicker(runStillRunning)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintf(p.w, "      %sstill running, %s elapsed\n", label, time.Since(start).Round(time.Second))
+			case <-stopped:
+				return
+			}
+		}
+	}()
+}
+
+// label prefixes the lines about migration when several run at once.
+func (p *runProgress) label(migration string) string {
+	if !p.parallel {
+		return ""
+	}
+	return migration + ": "
+}
+
+// stopOne ends the report of a running migration.
+func (p *runProgress) stopOne(migration string) {
+	if stopped, ok := p.running[migration]; ok {
+		close(stopped)
+		delete(p.running, migration)
+	}
+}
+
+// stop ends the reports of all running migrations.
+func (p *runProgress) stop() {
+	for migration := range p.running {
+		p.stopOne(migration)
+	}
+}
+
+// nonNil makes empty lists encode as [] rather than null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// TestConnectWaiting_Timeout does not run in parallel: it clears
+// DATABASE_DSN, which would otherwise override the unreachable DSN.
+func TestConnectWaiting_Timeout(t *testing.T) {
+	t.Setenv("DATABASE_DSN", "")
+
+	cfg := config.Default()
+	// Nothing listens on port 1, so every attempt is refused at once.
+	cfg.Database.DSN = "postgres://migrateme@127.0.0.1:1/migrateme?connect_timeout=1"
+
+	var stderr bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetErr(&stderr)
+
+	start := time.Now()
+	_, err := connectWaiting(context.Background(), cmd, cfg, 1200*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected connecting to a closed port to fail")
+	}
+	if !strings.Contains(err.Error(), "database not ready within 1.2s") || errorCode(err) != codeConnection {
+		t.Errorf("expected a connection error naming the wait, got %q (%s)", err, errorCode(err))
+	}
+	if exitCode(err) != ExitError {
+		t.Errorf("exitCode = %d, want %d", exitCode(err), ExitError)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 10*time.Second {
+		t.Errorf("gave up after %s, want about the 1.2s wait", elapsed)
+	}
+	if !strings.Contains(stderr.String(), "database not ready after") {
+		t.Errorf("expected the retries to be reported, got %q", stderr.String())
+	}
+
+	// An interrupt stops waiting without blaming the wait.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = connectWaiting(ctx, cmd, cfg, time.Minute)
+	if err == nil || strings.Contains(err.Error(), "not ready within") {
+		t.Errorf("expected the interrupted wait to fail without a timeout error, got %v", err)
+	}
+}
+
+func TestAppliedExit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		detailed bool
+		applied  []string
+		code     int
+	}{
+		{"applied", true, []string{"001_init", "002_add_email"}, ExitApplied},
+		{"nothing applied", true, nil, ExitOK},
+		{"without --detailed-exitcode", false, []string{"001_init"}, ExitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := appliedExit(tt.detailed, tt.applied)
+			if got := exitCode(err); got != tt.code {
+				t.Errorf("exitCode = %d, want %d", got, tt.code)
+			}
+			// Exit code 4 reports success; there is no error to print.
+			if err != nil && (!isSilent(err) || !strings.Contains(err.Error(), "applied 2 migrations")) {
+				t.Errorf("appliedExit = %v, silent %v", err, isSilent(err))
+			}
+		})
+	}
+}
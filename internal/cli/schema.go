@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+func NewSchemaCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Inspect the declared or live schema",
+	}
+
+	cmd.AddCommand(newSchemaGraphCommand())
+	cmd.AddCommand(newSchemaDumpCommand())
+	cmd.AddCommand(newSchemaDiffCommand())
+	return cmd
+}
+
+const (
+	sourceRegistry = "registry"
+	sourceDB       = "db"
+)
+
+func newSchemaDumpCommand() *cobra.Command {
+	var (
+		from   string
+		tables string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Write a JSON snapshot of the declared or live schema to stdout",
+		Long: `Write a JSON snapshot of the registered entities (or, with --from db, of the
+live database) to stdout. Snapshots can be used as a source for schema diff:
+
+  migrateme schema dump --from db > before.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if from != sourceRegistry && from != sourceDB {
+				return withCode(codeInvalidArgument, fmt.Errorf("unknown source %q (expected %s or %s)", from, sourceRegistry, sourceDB))
+			}
+
+			schemas, err := loadSchemas(cmd, cfg, from, splitList(tables))
+			if err != nil {
+				return err
+			}
+			return schema.WriteSnapshot(os.Stdout, schema.NewSnapshot(schemas))
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", sourceRegistry, "Schema source: registry or db")
+	cmd.Flags().StringVar(&tables, "tables", "", "Comma-separated list of tables (default: all)")
+	return cmd
+}
+
+func newSchemaDiffCommand() *cobra.Command {
+	var (
+		from    string
+		to      string
+		tables  string
+		noColor bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show a column-by-column diff between two schema states",
+		Long: `Show how the schema changes between two states, attribute by attribute,
+instead of as SQL. Each side is "db", "registry" or the path of a snapshot
+written by schema dump:
+
+  migrateme schema diff                                # db -> registry
+  migrateme schema diff --from before.json --to registry`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			filter := splitList(tables)
+			fromSchemas, err := loadSchemas(cmd, cfg, from, filter)
+			if err != nil {
+				return err
+			}
+			toSchemas, err := loadSchemas(cmd, cfg, to, filter)
+			if err != nil {
+				return err
+			}
+
+			comparisons := schema.Compare(fromSchemas, toSchemas)
+			if jsonOutput(cmd) {
+				if comparisons == nil {
+					comparisons = []schema.TableComparison{}
+				}
+				return writeJSON(os.Stdout, struct {
+					From    string                   `json:"from"`
+					To      string                   `json:"to"`
+					Changes []schema.TableComparison `json:"changes"`
+				}{From: from, To: to, Changes: comparisons})
+			}
+
+			if len(comparisons) == 0 {
+				fmt.Println("No differences")
+				return nil
+			}
+			color := !noColor && !ciMode(cmd) && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+			return schema.WriteComparison(os.Stdout, comparisons, color)
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", sourceDB, "Old state: db, registry or a snapshot file")
+	cmd.Flags().StringVar(&to, "to", sourceRegistry, "New state: db, registry or a snapshot file")
+	cmd.Flags().StringVar(&tables, "tables", "", "Comma-separated list of tables (default: all)")
+	cmd.Flags().BoolVar(&noColor, "no-color", false, "Disable colored output")
+	return cmd
+}
+
+// loadSchemas reads schemas from the registry, the live database or a
+// snapshot file, optionally limited to tables.
+func loadSchemas(cmd *cobra.Command, cfg *config.Config, source string, tables []string) ([]migrate.TableSchema, error) {
+	switch source {
+	case sourceRegistry:
+		return registrySchemas(cfg, tables), nil
+	case sourceDB:
+		return liveSchemas(cmd.Context(), cmd, cfg, tables)
+	}
+
+	snap, err := schema.LoadSnapshot(source)
+	if err != nil {
+		return nil, withCode(codeInvalidArgument, fmt.Errorf("failed to read snapshot: %w", err))
+	}
+	if len(tables) == 0 {
+		return snap.Tables, nil
+	}
+	var out []migrate.TableSchema
+	for _, t := range snap.Tables {
+		if slices.ContainsFunc(tables, func(name string) bool { return strings.EqualFold(name, t.TableName) }) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func newSchemaGraphCommand() *cobra.Command {
+	var (
+		format string
+		from   string
+		tables string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Export the schema as an ER diagram (DOT, Mermaid or PlantUML)",
+		Long: `Print tables, columns and foreign key edges as Graphviz DOT, Mermaid or
+PlantUML. By default the registered entities are drawn; use --from db to draw
+the live database, or pass the path of a snapshot written by schema dump.
+
+  migrateme schema graph --format dot | dot -Tsvg > schema.svg`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			schemas, err := loadSchemas(cmd, cfg, from, splitList(tables))
+			if err != nil {
+				return err
+			}
+			if len(schemas) == 0 {
+				return withCode(codeConfig, fmt.Errorf("no tables to draw"))
+			}
+
+			if err := schema.WriteGraph(os.Stdout, format, schemas); err != nil {
+				return withCode(codeInvalidArgument, err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", schema.GraphMermaid, "Diagram format: dot, mermaid or plantuml")
+	cmd.Flags().StringVar(&from, "from", sourceRegistry, "Schema source: registry or db")
+	cmd.Flags().StringVar(&tables, "tables", "", "Comma-separated list of tables (default: all)")
+	return cmd
+}
+
+// registrySchemas builds the declared schemas of the given tables, or of all
+// registered tables when none are given.
+func registrySchemas(cfg *config.Config, tables []string) []migrate.TableSchema {
+	var out []migrate.TableSchema
+	for name, build := range cfg.Registry {
+		if len(tables) > 0 && !slices.ContainsFunc(tables, func(t string) bool { return strings.EqualFold(t, name) }) {
+			continue
+		}
+		out = append(out, migrate.NormalizeSchema(build(name)))
+	}
+	return out
+}
+
+// liveSchemas fetches the given tables from the database, or every table of
+// the current schema except the migrations table when none are given.
+func liveSchemas(ctx context.Context, cmd *cobra.Command, cfg *config.Config, tables []string) ([]migrate.TableSchema, error) {
+	db, err := connectDB(ctx, cmd, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	fetcher := schema.NewFetcher(db.Pool)
+	if len(tables) == 0 {
+		if tables, err = fetcher.ListTables(ctx); err != nil {
+			return nil, err
+		}
+		tables = slices.DeleteFunc(tables, cfg.IsHistoryTable)
+	}
+
+	schemas := make([]migrate.TableSchema, 0, len(tables))
+	for _, name := range tables {
+		ts, err := fetcher.Fetch(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", name, err)
+		}
+		if len(ts.Columns) == 0 {
+			return nil, withCode(codeInvalidArgument, fmt.Errorf("table %s does not exist", name))
+		}
+		schemas = append(schemas, ts)
+	}
+	return schemas, nil
+}
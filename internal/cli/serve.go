@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/server"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// serveTokenEnv holds the token clients of serve must send. It is not a
+// flag, so that it does not show up in process listings.
+const serveTokenEnv = "MIGRATEME_SERVE_TOKEN"
+
+func NewServeCommand() *cobra.Command {
+	var addr, auditLog string
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve Status, Plan, Apply and Rollback of the configured databases",
+		Long: `Serve runs migrateme as a daemon for a central migrations service. It serves
+the gRPC service migrateme.server.v1.Migrations (pkg/serverpb) with the
+methods:
+
+  Status    applied and pending migrations
+  Plan      pending migrations with the SQL Apply would execute
+  Apply     apply pending migrations, under the run lock
+  Rollback  revert the last "steps" migrations
+
+Requests name the service, an entry of services in the config. Every call
+must carry the metadata "authorization: Bearer <token>" with the token from
+$` + serveTokenEnv + `. Apply and Rollback are written to the audit log as JSON
+lines, with the caller named in the ` + server.ActorMetadata + ` metadata; only one
+of them runs at a time per service.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token := os.Getenv(serveTokenEnv)
+			if token == "" {
+				return withCode(codeConfig, fmt.Errorf("set %s to the token clients must send", serveTokenEnv))
+			}
+
+			var audit io.Writer = cmd.ErrOrStderr()
+			if auditLog != "" {
+				f, err := os.OpenFile(auditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+				if err != nil {
+					return fmt.Errorf("open audit log: %w", err)
+				}
+				defer f.Close()
+				audit = f
+			}
+
+			lis, err := net.Listen("tcp", addr)
+			if err != nil {
+				return fmt.Errorf("listen on %s: %w", addr, err)
+			}
+			srv := (&server.Server{
+				Token: token,
+				Load:  func(service string) (*config.Config, error) { return config.LoadService(service) },
+				Audit: audit,
+			}).GRPCServer()
+
+			ctx := cmd.Context()
+			go func() {
+				<-ctx.Done()
+				// Calls in flight finish their migrations.
+				srv.GracefulStop()
+			}()
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "serving migrations on %s\n", lis.Addr())
+			if err := srv.Serve(lis); err != nil {
+				return err
+			}
+			return ctx.Err()
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", ":7070", "Address to listen on")
+	cmd.Flags().StringVar(&auditLog, "audit-log", "", "Append the audit log to this file instead of stderr")
+	return cmd
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/spf13/cobra"
+)
+
+func NewSnapshotCommand() *cobra.Command {
+	var (
+		target   string
+		tables   string
+		truncate bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Copy data into another database, anonymizing columns tagged anon=",
+		Long: `Copy the rows of registered tables from the configured database, e.g.
+production, into the target database, e.g. staging. Columns tagged anon= are
+replaced on the way, so their original values never leave the source:
+
+  hash        md5 of the salted value; equal values stay equal
+  null        NULL
+  fake_email  user_<hash>@example.com
+
+Both databases must be at the same migration version. Rows are read from a
+single snapshot and written in one transaction, referenced tables first. The
+target is snapshot.target_dsn unless --target is given; snapshot.salt (or
+SNAPSHOT_SALT) salts the derived values.
+
+  migrateme snapshot --target "$STAGING_DSN" --truncate`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
+			}
+			if target == "" {
+				target = cfg.Snapshot.TargetDSN
+			}
+			if target == "" {
+				return withCode(codeInvalidArgument, fmt.Errorf("no target database: pass --target or set snapshot.target_dsn"))
+			}
+			if target == cfg.GetDSN() {
+				return withCode(codeInvalidArgument, fmt.Errorf("the target database is the source database"))
+			}
+
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			targetDB, err := database.NewDB(ctx, target, cfg.DBOptions()...)
+			if err != nil {
+				return withCode(codeConnection, fmt.Errorf("failed to connect to target database: %w", err))
+			}
+			defer targetDB.Close()
+
+			copied, err := core.NewMigrator(cfg, db).Snapshot(ctx, targetDB, core.SnapshotOptions{
+				Tables:   splitList(tables),
+				Salt:     cfg.Snapshot.Salt,
+				Truncate: truncate,
+			})
+			var ve *core.DataVersionError
+			if errors.As(err, &ve) {
+				return withCode(codeVersionMismatch, err)
+			} else if err != nil {
+				return err
+			}
+
+			if jsonOutput(cmd) {
+				if copied == nil {
+					copied = []core.SnapshotTable{}
+				}
+				return writeJSON(os.Stdout, struct {
+					Tables []core.SnapshotTable `json:"tables"`
+				}{Tables: copied})
+			}
+			for _, t := range copied {
+				fmt.Println(" ", symbol(cmd, "✔", "copied"), t.Table, fmt.Sprintf("(%d rows)", t.Rows))
+				if len(t.Anonymized) > 0 {
+					fmt.Printf("    anonymized: %v\n", t.Anonymized)
+				}
+			}
+			if cfg.Snapshot.Salt == "" {
+				cfg.Reporter().Report(diagnostics.Warningf(diagnostics.UnsaltedSnapshot,
+					"snapshot.salt is not set, hashed values can be matched against guessed ones"))
+			}
+			fmt.Printf("Copied %d tables\n", len(copied))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&target, "target", "", "DSN of the database to copy into (default: snapshot.target_dsn)")
+	cmd.Flags().StringVar(&tables, "tables", "", "Comma-separated list of tables (default: all registered tables)")
+	cmd.Flags().BoolVar(&truncate, "truncate", false, "Empty the target tables before copying")
+	addGroupFlag(cmd)
+	return cmd
+}
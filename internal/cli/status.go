@@ -1,28 +1,45 @@
 package cli
 
 import (
-	"context"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
 	"github.com/amr0ny/migrateme/internal/core"
 	"github.com/amr0ny/migrateme/internal/database"
-	"github.com/amr0ny/migrateme/pkg/config"
 	"github.com/spf13/cobra"
 )
 
 func NewStatusCommand() *cobra.Command {
+	var check, verbose bool
+
 	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show applied and pending migrations",
+		Long: `Show applied and pending migrations.
+
+With --check the command exits with code 2 when pending migrations exist and
+with code 3 when the entities differ from the database schema (drift).
+With --verbose applied migrations are listed with when, by whom, from which
+host and migrateme version they were applied and how long they took.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load()
+			asJSON := jsonOutput(cmd)
+
+			cfg, err := loadConfig()
 			if err != nil {
-				return fmt.Errorf("failed to load config: %w", err)
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
 			}
 
-			ctx := context.Background()
-			db, err := database.NewDB(ctx, cfg.GetDSN())
+			ctx := cmd.Context()
+			db, err := connectDB(ctx, cmd, cfg)
 			if err != nil {
-				return fmt.Errorf("failed to connect to database: %w", err)
+				return err
 			}
 			defer db.Close()
 
@@ -33,19 +50,147 @@ func NewStatusCommand() *cobra.Command {
 				return err
 			}
 
-			fmt.Println("Applied:")
-			for _, m := range applied {
-				fmt.Println("  ✔", m)
+			var history []database.HistoryEntry
+			if verbose {
+				if history, err = migrator.History(ctx); err != nil {
+					return err
+				}
 			}
 
-			fmt.Println("\nPending:")
-			for _, f := range pending {
-				fmt.Println("  ✘", f)
+			// Drift is only meaningful once every migration has been applied,
+			// so pending migrations exit with code 2 whatever the entities.
+			var drift []core.TableChange
+			driftChecked := check && len(pending) == 0
+			if driftChecked {
+				if err := checkRegistry(cmd, cfg); err != nil {
+					return err
+				}
+				result, err := migrator.Generate(ctx, core.GenerateOptions{DryRun: true})
+				if err != nil {
+					return withCode(codeGenerate, err)
+				}
+				drift = result.Changes
 			}
 
-			return nil
+			if asJSON {
+				out := statusJSON{Applied: nonNil(applied), Pending: nonNil(pending), Drift: drift, Managed: len(cfg.Registry)}
+				for _, h := range history {
+					out.History = append(out.History, historyEntry{
+						Migration: h.Name, AppliedAt: h.AppliedAt, Checksum: h.Checksum, AppliedBy: h.AppliedBy,
+						OSUser: h.OSUser, Hostname: h.Hostname, ToolVersion: h.ToolVersion, DurationMS: h.Duration.Milliseconds(), Batch: h.Batch,
+					})
+				}
+				if err := writeJSON(os.Stdout, out); err != nil {
+					return err
+				}
+			} else {
+				fmt.Println("Applied:")
+				if verbose {
+					if err := writeHistory(cmd, history); err != nil {
+						return err
+					}
+				} else {
+					for _, m := range applied {
+						fmt.Println(" ", symbol(cmd, "✔", "applied"), m)
+					}
+				}
+
+				fmt.Println("\nPending:")
+				for _, f := range pending {
+					fmt.Println(" ", symbol(cmd, "✘", "pending"), f)
+				}
+
+				writeDrift(os.Stdout, driftChecked, len(cfg.Registry), drift)
+			}
+
+			return checkExit(check, pending, drift)
 		},
 	}
 
+	cmd.Flags().BoolVar(&check, "check", false, "Exit with code 2 if migrations are pending or 3 if schema drift is detected")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show who applied each migration, from where and how long it took")
+	addGroupFlag(cmd)
 	return cmd
 }
+
+// writeDrift prints the drift found by status --check. An empty managed set
+// is called out, since it can only report no drift.
+func writeDrift(w io.Writer, checked bool, managed int, drift []core.TableChange) {
+	if checked && managed == 0 {
+		fmt.Fprintln(w, "\nDrift: no entities are registered, the managed set is empty")
+	}
+	if len(drift) > 0 {
+		fmt.Fprintln(w, "\nDrift (entities differ from database):")
+		for _, c := range drift {
+			fmt.Fprintf(w, "  ~ %s: %s\n", c.TableName, c.Type)
+		}
+	}
+}
+
+// statusJSON is the JSON output of status. Applied and pending are never
+// null; history is set with --verbose and drift with --check.
+type statusJSON struct {
+	Applied []string           `json:"applied"`
+	Pending []string           `json:"pending"`
+	History []historyEntry     `json:"history,omitempty"`
+	Drift   []core.TableChange `json:"drift,omitempty"`
+	Managed int                `json:"managed_tables"`
+}
+
+// checkExit turns the result of status --check into exit code 2 when
+// migrations are pending, or 3 when the entities differ from the database.
+func checkExit(check bool, pending []string, drift []core.TableChange) error {
+	if !check {
+		return nil
+	}
+	switch {
+	case len(pending) > 0:
+		return &exitError{Code: ExitPending, Err: fmt.Errorf("%d pending migrations", len(pending)), Silent: true}
+	case len(drift) > 0:
+		return &exitError{Code: ExitDrift, Err: fmt.Errorf("schema drift in %d tables", len(drift)), Silent: true}
+	}
+	return nil
+}
+
+type historyEntry struct {
+	Migration   string    `json:"migration"`
+	AppliedAt   time.Time `json:"applied_at"`
+	Checksum    string    `json:"checksum,omitempty"`
+	AppliedBy   string    `json:"applied_by,omitempty"`
+	OSUser      string    `json:"os_user,omitempty"`
+	Hostname    string    `json:"hostname,omitempty"`
+	ToolVersion string    `json:"tool_version,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+	Batch       int64     `json:"batch,omitempty"`
+}
+
+// writeHistory prints the applied migrations as a table. Columns recorded
+// before the history table had them are shown as "-".
+func writeHistory(cmd *cobra.Command, history []database.HistoryEntry) error {
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  \tMIGRATION\tBATCH\tAPPLIED AT\tBY\tOS USER\tHOST\tVERSION\tDURATION\tCHECKSUM")
+	for _, h := range history {
+		duration := "-"
+		if h.Duration > 0 {
+			duration = h.Duration.String()
+		}
+		batch := "-"
+		if h.Batch > 0 {
+			batch = strconv.FormatInt(h.Batch, 10)
+		}
+		sum := h.Checksum
+		if len(sum) > 12 {
+			sum = sum[:12]
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", symbol(cmd, "✔", "applied"), h.Name, batch,
+			h.AppliedAt.Local().Format(time.DateTime), orDash(h.AppliedBy), orDash(h.OSUser), orDash(h.Hostname),
+			orDash(h.ToolVersion), duration, orDash(sum))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+func NewTestCommand() *cobra.Command {
+	var (
+		adminDSN string
+		keep     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Check that every migration reverts cleanly, in a throwaway database",
+		Long: `Create a temporary database and test every migration in it: apply the up,
+apply the down, apply the up again, fetching the schema after each step.
+
+The down has to restore the schema from before the up, and the second up has
+to produce the same schema as the first. Migrations that fail either check,
+have no down SQL or whose SQL fails are reported; the command then exits
+with an error. The database is dropped afterwards unless --keep is given, so
+run it before migrations reach a real environment.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
+			}
+			if adminDSN == "" {
+				adminDSN = cfg.GetDSN()
+			}
+			if adminDSN == "" {
+				return withCode(codeConfig, fmt.Errorf("no database configured; pass --admin-dsn or set DATABASE_DSN"))
+			}
+
+			ctx := cmd.Context()
+			scratch, err := database.CreateScratch(ctx, adminDSN, "migrateme_test")
+			if err != nil {
+				return withCode(codeConnection, err)
+			}
+			if keep {
+				defer scratch.Close()
+			} else {
+				defer scratch.Drop(ctx)
+			}
+			db, err := database.NewDB(ctx, scratch.DSN, cfg.DBOptions()...)
+			if err != nil {
+				return withCode(codeConnection, fmt.Errorf("failed to connect to %s: %w", scratch.Name, err))
+			}
+			defer db.Close()
+
+			asJSON := jsonOutput(cmd)
+			var onResult func(core.RoundtripResult)
+			if !asJSON {
+				onResult = func(r core.RoundtripResult) {
+					if r.Problem == "" {
+						fmt.Printf("%s %s\n", symbol(cmd, "✔", "ok"), r.Migration)
+						return
+					}
+					fmt.Printf("%s %s: %s\n", symbol(cmd, "✘", "failed"), r.Migration, r.Problem)
+					if len(r.Differences) > 0 {
+						schema.WriteComparison(os.Stdout, r.Differences, false)
+					}
+				}
+			}
+
+			results, runErr := core.NewMigrator(cfg, db).Roundtrip(ctx, onResult)
+			failed := 0
+			for _, r := range results {
+				if r.Problem != "" {
+					failed++
+				}
+			}
+
+			if asJSON {
+				if err := writeJSON(os.Stdout, struct {
+					Database string                 `json:"database"`
+					Results  []core.RoundtripResult `json:"results"`
+				}{Database: scratch.Name, Results: results}); err != nil {
+					return err
+				}
+			} else {
+				if keep {
+					fmt.Printf("Kept database %s\n", scratch.Name)
+				}
+				fmt.Printf("Tested %d migrations, %d failed\n", len(results), failed)
+			}
+
+			// The results have been printed, JSON output included.
+			switch {
+			case runErr != nil:
+				return &exitError{Code: ExitError, Err: runErr, Silent: asJSON}
+			case failed > 0:
+				return &exitError{Code: ExitError, Err: fmt.Errorf("%d migrations do not revert cleanly", failed), Silent: asJSON}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&adminDSN, "admin-dsn", "", "DSN of a server where temporary databases may be created (default: configured DSN)")
+	cmd.Flags().BoolVar(&keep, "keep", false, "Keep the temporary database")
+	addGroupFlag(cmd)
+	return cmd
+}
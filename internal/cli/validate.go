@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/spf13/cobra"
+)
+
+func NewValidateCommand() *cobra.Command {
+	var offline bool
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check migration files for duplicates, orphans and unreadable content",
+		Long: `Validate checks the migrations directory for duplicate migration names,
+up files without down files and the reverse, empty files, content that is not
+valid UTF-8 and malformed -- +migrate sections. It also reports migrations
+that are applied in the database but missing on disk, unless --offline is set.
+
+The same checks run before 'migrateme run', which refuses to apply anything
+while errors remain. Warnings can be silenced with diagnostics.suppress.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			var db *database.DB
+			if !offline {
+				if db, err = connectDB(ctx, cmd, cfg); err != nil {
+					return err
+				}
+				defer db.Close()
+			}
+
+			found, err := core.NewMigrator(cfg, db).Validate(ctx)
+			if err != nil {
+				return err
+			}
+
+			var errs int
+			for _, d := range found {
+				if d.Severity == diagnostics.Error {
+					errs++
+				}
+			}
+			if errs > 0 {
+				return withCode(codeValidation, fmt.Errorf("%d problems in migration files must be fixed", errs))
+			}
+
+			if jsonOutput(cmd) {
+				return writeJSON(os.Stdout, struct {
+					Valid       bool                     `json:"valid"`
+					Diagnostics []diagnostics.Diagnostic `json:"diagnostics"`
+				}{Valid: true, Diagnostics: nonNilDiagnostics(found)})
+			}
+
+			if len(found) == 0 {
+				fmt.Println("Migration files are valid")
+			} else {
+				fmt.Printf("Migration files are valid, with %d warnings\n", len(found))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&offline, "offline", false, "Only check files, without connecting to the database")
+	return cmd
+}
+
+func nonNilDiagnostics(ds []diagnostics.Diagnostic) []diagnostics.Diagnostic {
+	if ds == nil {
+		return []diagnostics.Diagnostic{}
+	}
+	return ds
+}
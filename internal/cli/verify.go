@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/spf13/cobra"
+)
+
+func NewVerifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Relate migrations to the entity changes they were generated from",
+		Long: `Verify reads the header generate writes at the top of each migration, which
+records the migrateme version, the entities the migration was generated from
+and checksums of their schemas, and lists which struct produced which
+migration.
+
+It then compares every entity with the schema its newest migration brings the
+table to. An entity that changed since then needs 'migrateme generate', and
+verify exits with code 3. Entities that no header records, for example
+because their migrations were written by hand, are listed as untracked. No
+database connection is needed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := selectGroup(cmd, cfg); err != nil {
+				return err
+			}
+
+			result, err := core.NewMigrator(cfg, nil).Verify()
+			if err != nil {
+				return withCode(codeValidation, err)
+			}
+			changed := result.Changed()
+
+			if jsonOutput(cmd) {
+				if err := writeJSON(os.Stdout, result); err != nil {
+					return err
+				}
+			} else {
+				printVerify(cmd, result)
+			}
+
+			if len(changed) > 0 {
+				return &exitError{
+					Code:   ExitDrift,
+					Err:    fmt.Errorf("%d entities changed since their last migration, run 'migrateme generate'", len(changed)),
+					Silent: jsonOutput(cmd),
+				}
+			}
+			return nil
+		},
+	}
+	addGroupFlag(cmd)
+	return cmd
+}
+
+func printVerify(cmd *cobra.Command, result *core.VerifyResult) {
+	fmt.Println("Migrations:")
+	for _, m := range result.Migrations {
+		if m.Header == nil {
+			fmt.Printf("  %s (no header)\n", m.Migration)
+			continue
+		}
+		fmt.Printf("  %s (migrateme %s)\n", m.Migration, m.Header.Version)
+		for _, e := range m.Header.Entities {
+			if e.Struct == "" {
+				fmt.Printf("    %s: dropped\n", e.Table)
+			} else {
+				fmt.Printf("    %s <- %s (%s:%d)\n", e.Table, e.Struct, e.File, e.Line)
+			}
+		}
+	}
+
+	fmt.Println("\nEntities:")
+	for _, e := range result.Entities {
+		name := e.Table
+		if e.Struct != "" {
+			name = fmt.Sprintf("%s (%s)", e.Table, e.Struct)
+		}
+		switch e.Status {
+		case core.VerifyCurrent:
+			fmt.Printf("  %s %s: generated by %s\n", symbol(cmd, "✔", "current"), name, e.Migration)
+		case core.VerifyChanged:
+			fmt.Printf("  %s %s: changed since %s\n", symbol(cmd, "✘", "changed"), name, e.Migration)
+		default:
+			fmt.Printf("  %s %s: no migration header records it\n", symbol(cmd, "?", "untracked"), name)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// JSONSchemaDialect is the JSON Schema version JSONSchema writes; OpenAPI 3.1
+// component schemas use the same dialect.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema describes every table as a JSON Schema object, keyed by table
+// name: a JSON Schema document with the tables under $defs or, with openAPI,
+// an OpenAPI 3.1 document with the tables under components.schemas. Columns
+// become properties in declaration order; NOT NULL columns are required and
+// the others also accept null. The output depends only on the schemas.
+func JSONSchema(schemas []migrate.TableSchema, openAPI bool) ([]byte, error) {
+	sorted := append([]migrate.TableSchema(nil), schemas...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].TableName < sorted[j].TableName })
+
+	defs := make(orderedObject, 0, len(sorted))
+	for _, s := range sorted {
+		defs = append(defs, member{s.TableName, tableJSONSchema(s)})
+	}
+
+	var doc orderedObject
+	if openAPI {
+		doc = orderedObject{
+			{"openapi", "3.1.0"},
+			{"info", orderedObject{{"title", "migrateme entities"}, {"version", "1"}}},
+			{"components", orderedObject{{"schemas", defs}}},
+		}
+	} else {
+		doc = orderedObject{
+			{"$schema", JSONSchemaDialect},
+			{"$defs", defs},
+		}
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("encode json schema: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+func tableJSONSchema(s migrate.TableSchema) orderedObject {
+	props := make(orderedObject, 0, len(s.Columns))
+	required := []string{}
+	for _, c := range s.Columns {
+		prop := columnJSONSchema(c.Attrs.PgType)
+		if !c.Attrs.NotNull {
+			prop = nullable(prop)
+		} else {
+			required = append(required, c.ColumnName)
+		}
+		if fk := c.Attrs.ForeignKey; fk != nil {
+			prop = append(prop, member{"description", fmt.Sprintf("References %s.%s.", fk.Table, fk.Column)})
+		}
+		props = append(props, member{c.ColumnName, prop})
+	}
+
+	out := orderedObject{
+		{"type", "object"},
+		{"title", s.TableName},
+		{"properties", props},
+	}
+	if len(required) > 0 {
+		out = append(out, member{"required", required})
+	}
+	return append(out, member{"additionalProperties", false})
+}
+
+// columnJSONSchema maps a normalized Postgres type to a JSON Schema. Types
+// without a JSON counterpart, e.g. enums, are strings.
+func columnJSONSchema(pgType string) orderedObject {
+	t := strings.ToLower(strings.TrimSpace(pgType))
+	if elem, ok := strings.CutSuffix(t, "[]"); ok {
+		return orderedObject{{"type", "array"}, {"items", columnJSONSchema(elem)}}
+	}
+	base, mod, _ := strings.Cut(t, "(")
+	base = strings.TrimSpace(base)
+	mod = strings.TrimSuffix(mod, ")")
+
+	switch base {
+	case "smallint", "smallserial":
+		return orderedObject{{"type", "integer"}, {"minimum", -32768}, {"maximum", 32767}}
+	case "integer", "serial":
+		return orderedObject{{"type", "integer"}, {"format", "int32"}}
+	case "bigint", "bigserial":
+		return orderedObject{{"type", "integer"}, {"format", "int64"}}
+	case "real":
+		return orderedObject{{"type", "number"}, {"format", "float"}}
+	case "double precision":
+		return orderedObject{{"type", "number"}, {"format", "double"}}
+	case "numeric", "money":
+		return orderedObject{{"type", "number"}}
+	case "boolean":
+		return orderedObject{{"type", "boolean"}}
+	case "uuid":
+		return orderedObject{{"type", "string"}, {"format", "uuid"}}
+	case "timestamp", "timestamptz":
+		return orderedObject{{"type", "string"}, {"format", "date-time"}}
+	case "date":
+		return orderedObject{{"type", "string"}, {"format", "date"}}
+	case "time", "timetz":
+		return orderedObject{{"type", "string"}, {"format", "time"}}
+	case "interval":
+		return orderedObject{{"type", "string"}, {"format", "duration"}}
+	case "inet", "cidr":
+		return orderedObject{{"type", "string"}}
+	case "bytea":
+		return orderedObject{{"type", "string"}, {"contentEncoding", "base64"}}
+	case "json", "jsonb":
+		return orderedObject{}
+	case "vector", "halfvec":
+		return orderedObject{{"type", "array"}, {"items", orderedObject{{"type", "number"}}}}
+	case "varchar", "char", "character varying", "character":
+		if n, err := strconv.Atoi(mod); err == nil {
+			return orderedObject{{"type", "string"}, {"maxLength", n}}
+		}
+	}
+	return orderedObject{{"type", "string"}}
+}
+
+// nullable lets a property also be null. A schema without a type, like that
+// of json columns, already accepts null.
+func nullable(prop orderedObject) orderedObject {
+	out := make(orderedObject, len(prop))
+	copy(out, prop)
+	for i, m := range out {
+		if m.key == "type" {
+			out[i].value = []string{m.value.(string), "null"}
+		}
+	}
+	return out
+}
+
+// orderedObject is a JSON object that keeps its members in order, so that
+// properties follow the column order.
+type orderedObject []member
+
+type member struct {
+	key   string
+	value any
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
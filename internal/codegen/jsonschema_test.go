@@ -0,0 +1,65 @@
+package codegen
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestJSONSchema(t *testing.T) {
+	t.Parallel()
+
+	users := migrate.NormalizeSchema(migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ParseColumnTag("id,pk_uuid")},
+			{ColumnName: "name", Attrs: migrate.ParseColumnTag("name,notnull,type=varchar(100)")},
+			{ColumnName: "tags", Attrs: migrate.ParseColumnTag("tags,type=text[]")},
+			{ColumnName: "created_at", Attrs: migrate.ParseColumnTag("created_at,type=timestamptz")},
+		},
+	})
+
+	src, err := JSONSchema([]migrate.TableSchema{users}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Schema string `json:"$schema"`
+		Defs   map[string]struct {
+			Properties map[string]map[string]any `json:"properties"`
+			Required   []string                  `json:"required"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(src, &doc); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, src)
+	}
+	u := doc.Defs["users"]
+	if doc.Schema != JSONSchemaDialect || strings.Join(u.Required, ",") != "id,name" {
+		t.Fatalf("unexpected document:\n%s", src)
+	}
+	if p := u.Properties["id"]; p["type"] != "string" || p["format"] != "uuid" {
+		t.Errorf("id = %v", p)
+	}
+	if p := u.Properties["name"]; p["maxLength"] != float64(100) {
+		t.Errorf("name = %v", p)
+	}
+	if p := u.Properties["created_at"]; p["format"] != "date-time" || len(p["type"].([]any)) != 2 {
+		t.Errorf("nullable created_at = %v", p)
+	}
+	if p := u.Properties["tags"]; p["items"].(map[string]any)["type"] != "string" {
+		t.Errorf("tags = %v", p)
+	}
+	if strings.Index(string(src), `"id"`) > strings.Index(string(src), `"created_at"`) {
+		t.Errorf("properties must follow the column order:\n%s", src)
+	}
+
+	api, err := JSONSchema([]migrate.TableSchema{users}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(api), `"openapi": "3.1.0"`) || !strings.Contains(string(api), `"schemas": {`) {
+		t.Errorf("unexpected OpenAPI document:\n%s", api)
+	}
+}
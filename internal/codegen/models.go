@@ -0,0 +1,236 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+const modelsHeader = "// Code generated by migrateme gen models. Review before committing.\n\n"
+
+// Models generates one Go struct per table with db tags that the migrator
+// reads back into the same schema, so generated entities produce no diff.
+func Models(dir, pkg string, tables []migrate.TableSchema) ([]File, error) {
+	files := make([]File, 0, len(tables))
+	for _, t := range tables {
+		src, err := modelSource(pkg, t)
+		if err != nil {
+			return nil, fmt.Errorf("generate model for %s: %w", t.TableName, err)
+		}
+		files = append(files, File{Path: filepath.Join(dir, t.TableName+".go"), Source: src})
+	}
+	return files, nil
+}
+
+func modelSource(pkg string, t migrate.TableSchema) ([]byte, error) {
+	var body bytes.Buffer
+	imports := map[string]bool{}
+
+	fmt.Fprintf(&body, "// table: %q\n", t.TableName)
+	for _, idx := range t.Indexes {
+		fmt.Fprintf(&body, "// %s\n", indexDirective(idx))
+	}
+	for _, chk := range t.Checks {
+		fmt.Fprintf(&body, "// check: %s(%s)\n", chk.Name, chk.Expr)
+	}
+	fmt.Fprintf(&body, "type %s struct {\n", structName(t.TableName))
+	for _, c := range t.Columns {
+		goType, imp := goTypeFor(c.Attrs)
+		if imp != "" {
+			imports[imp] = true
+		}
+		fmt.Fprintf(&body, "\t%s %s `db:\"%s\"`\n", fieldName(c.ColumnName), goType, dbTag(c))
+	}
+	body.WriteString("}\n")
+
+	var b bytes.Buffer
+	b.WriteString(modelsHeader)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	if len(imports) > 0 {
+		paths := make([]string, 0, len(imports))
+		for p := range imports {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		b.WriteString("import (\n")
+		for _, p := range paths {
+			fmt.Fprintf(&b, "\t%q\n", p)
+		}
+		b.WriteString(")\n\n")
+	}
+	b.Write(body.Bytes())
+	return format.Source(b.Bytes())
+}
+
+func indexDirective(idx migrate.IndexMeta) string {
+	cols := make([]string, len(idx.Columns))
+	for i, c := range idx.Columns {
+		cols[i] = c
+		if i < len(idx.Opclasses) && idx.Opclasses[i] != "" {
+			cols[i] += " " + idx.Opclasses[i]
+		}
+	}
+	s := "index: "
+	if idx.Unique {
+		s += "unique "
+	}
+	s += idx.Name + "(" + strings.Join(cols, ", ") + ")"
+	if idx.Method != "" && idx.Method != "btree" {
+		s += " using " + idx.Method
+	}
+	if len(idx.With) > 0 {
+		s += " with (" + strings.Join(idx.With, ", ") + ")"
+	}
+	if idx.Tablespace != "" {
+		s += " tablespace " + idx.Tablespace
+	}
+	if idx.Where != nil {
+		s += " where " + *idx.Where
+	}
+	return s
+}
+
+func dbTag(c migrate.ColumnMeta) string {
+	parts := []string{c.ColumnName}
+	a := c.Attrs
+	if a.IsPK {
+		parts = append(parts, "pk")
+	} else if a.NotNull {
+		parts = append(parts, "notnull")
+	}
+	if a.Unique {
+		parts = append(parts, "unique")
+		if a.NullsNotDistinct {
+			parts = append(parts, "nulls_not_distinct")
+		}
+	}
+	// citext columns come back as ci, which generates citext by default.
+	if a.CaseInsensitive || a.PgType == "citext" {
+		parts = append(parts, "ci")
+	} else if a.PgType != "" && a.PgType != "text" && !strings.Contains(a.PgType, ",") {
+		parts = append(parts, "type="+a.PgType)
+	}
+	// Tag options are comma separated, so defaults containing commas are left
+	// out and have to be added by hand.
+	if a.Default != nil && !strings.Contains(*a.Default, ",") {
+		parts = append(parts, "default="+*a.Default)
+	}
+	if fk := a.ForeignKey; fk != nil {
+		parts = append(parts, "fk="+fk.Table+"."+fk.Column)
+		if fk.OnDelete != "" && fk.OnDelete != migrate.NoAction {
+			action := "delete=" + tagAction(fk.OnDelete)
+			if len(fk.OnDeleteColumns) > 0 {
+				action += "(" + strings.Join(fk.OnDeleteColumns, ",") + ")"
+			}
+			parts = append(parts, action)
+		}
+		if fk.OnUpdate != "" && fk.OnUpdate != migrate.NoAction {
+			parts = append(parts, "update="+tagAction(fk.OnUpdate))
+		}
+		if m := migrate.NormalizeMatch(fk.Match); m != "" {
+			parts = append(parts, "match="+strings.ToLower(string(m)))
+		}
+		if fk.InitiallyDeferred {
+			parts = append(parts, "initially_deferred")
+		} else if fk.Deferrable {
+			parts = append(parts, "deferrable")
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func tagAction(a migrate.OnActionType) string {
+	return strings.ReplaceAll(strings.ToLower(string(a)), " ", "_")
+}
+
+// goTypeFor maps a Postgres type to a Go type and the import it needs.
+// Nullable scalars become pointers.
+func goTypeFor(a migrate.ColumnAttributes) (string, string) {
+	t := strings.ToLower(a.PgType)
+	if base, ok := strings.CutSuffix(t, "[]"); ok {
+		elem, imp := scalarGoType(base)
+		return "[]" + elem, imp
+	}
+
+	goType, imp := scalarGoType(t)
+	switch {
+	case strings.HasPrefix(goType, "[]"), goType == "json.RawMessage", a.NotNull || a.IsPK:
+		return goType, imp
+	default:
+		return "*" + goType, imp
+	}
+}
+
+func scalarGoType(t string) (string, string) {
+	base := t
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		base = strings.TrimSpace(t[:i])
+	}
+	switch base {
+	case "smallint", "int2":
+		return "int16", ""
+	case "integer", "int", "int4", "serial":
+		return "int32", ""
+	case "bigint", "int8", "bigserial":
+		return "int64", ""
+	case "boolean", "bool":
+		return "bool", ""
+	case "real", "float4":
+		return "float32", ""
+	case "double precision", "float8":
+		return "float64", ""
+	case "timestamp", "timestamptz", "date", "time", "timetz":
+		return "time.Time", "time"
+	case "json", "jsonb":
+		return "json.RawMessage", "encoding/json"
+	case "bytea":
+		return "[]byte", ""
+	case "vector", "halfvec":
+		return "[]float32", ""
+	default:
+		// text, varchar, uuid, numeric, enums, ...
+		return "string", ""
+	}
+}
+
+var initialisms = map[string]string{
+	"id": "ID", "url": "URL", "uri": "URI", "api": "API", "json": "JSON",
+	"http": "HTTP", "uuid": "UUID", "sql": "SQL", "ip": "IP", "html": "HTML",
+}
+
+func fieldName(column string) string {
+	var b strings.Builder
+	for _, p := range strings.FieldsFunc(strings.ToLower(column), func(r rune) bool { return r == '_' || r == '-' || r == ' ' }) {
+		if v, ok := initialisms[p]; ok {
+			b.WriteString(v)
+			continue
+		}
+		b.WriteString(strings.ToUpper(p[:1]) + p[1:])
+	}
+	name := b.String()
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "X" + name
+	}
+	return name
+}
+
+// structName singularizes the table name: order_items -> OrderItem.
+func structName(table string) string {
+	name := fieldName(table)
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "ss"):
+		return name
+	case strings.HasSuffix(name, "s"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
@@ -0,0 +1,71 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestModels(t *testing.T) {
+	t.Parallel()
+
+	now := "now()"
+	table := migrate.TableSchema{
+		TableName: "order_items",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true}},
+			{ColumnName: "order_id", Attrs: migrate.ColumnAttributes{PgType: "uuid", NotNull: true, ForeignKey: &migrate.ForeignKey{
+				Table: "orders", Column: "id", OnDelete: migrate.Cascade,
+			}}},
+			{ColumnName: "note", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			{ColumnName: "created_at", Attrs: migrate.ColumnAttributes{PgType: "timestamptz", NotNull: true, Default: &now}},
+			{ColumnName: "meta", Attrs: migrate.ColumnAttributes{PgType: "jsonb"}},
+		},
+		Indexes: []migrate.IndexMeta{{Name: "idx_order_items_order", Columns: []string{"order_id"}}},
+	}
+
+	files, err := Models("models", "models", []migrate.TableSchema{table})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "models/order_items.go" {
+		t.Fatalf("unexpected files: %+v", files)
+	}
+
+	src := string(files[0].Source)
+	for _, want := range []string{
+		"package models",
+		`"encoding/json"`,
+		`"time"`,
+		`// table: "order_items"`,
+		"// index: idx_order_items_order(order_id)",
+		"type OrderItem struct {",
+		"ID        int64           `db:\"id,pk,type=bigint\"`",
+		"OrderID   string          `db:\"order_id,notnull,type=uuid,fk=orders.id,delete=cascade\"`",
+		"Note      *string         `db:\"note\"`",
+		"CreatedAt time.Time       `db:\"created_at,notnull,type=timestamptz,default=now()\"`",
+		"Meta      json.RawMessage `db:\"meta,type=jsonb\"`",
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("expected %q in:\n%s", want, src)
+		}
+	}
+}
+
+func TestStructName(t *testing.T) {
+	t.Parallel()
+
+	for table, want := range map[string]string{
+		"users":      "User",
+		"categories": "Category",
+		"addresses":  "Address",
+		"boxes":      "Box",
+		"api_keys":   "APIKey",
+		"progress":   "Progress",
+	} {
+		if got := structName(table); got != want {
+			t.Errorf("structName(%q) = %q, want %q", table, got, want)
+		}
+	}
+}
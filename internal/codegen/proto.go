@@ -0,0 +1,269 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+const protoHeader = "// Code generated by migrateme export proto. DO NOT EDIT.\n\n"
+
+// protoWellKnown maps the well-known message types Proto may use to the file
+// declaring them.
+var protoWellKnown = map[string]string{
+	"google.protobuf.Timestamp": "google/protobuf/timestamp.proto",
+	"google.protobuf.Duration":  "google/protobuf/duration.proto",
+	"google.protobuf.Value":     "google/protobuf/struct.proto",
+}
+
+// Proto generates a proto3 file with one message per table, named like the
+// structs of gen models (order_items -> OrderItem). Nullable scalar columns
+// are optional; arrays are repeated. goPackage, when set, becomes the
+// go_package option.
+//
+// previous is the file generated before, or nil. A field keeps the number it
+// has there, new fields are numbered after the highest number the message
+// used, and the numbers and names of removed fields are reserved, so
+// reordering or removing columns never renumbers a field. Without previous,
+// fields are numbered in column order. The output depends only on the
+// schemas and previous.
+func Proto(pkg, goPackage string, schemas []migrate.TableSchema, previous []byte) ([]byte, error) {
+	numbers, err := parseProtoNumbers(previous)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := append([]migrate.TableSchema(nil), schemas...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].TableName < sorted[j].TableName })
+
+	imports := map[string]bool{}
+	var body bytes.Buffer
+	for _, s := range sorted {
+		name := structName(s.TableName)
+		fields := numbers[name].assign(s.Columns)
+		fmt.Fprintf(&body, "\n// %s\nmessage %s {\n", s.TableName, name)
+		if len(fields.reserved) > 0 {
+			fmt.Fprintf(&body, "  reserved %s;\n", joinInts(fields.reserved))
+		}
+		if len(fields.reservedNames) > 0 {
+			quoted := make([]string, len(fields.reservedNames))
+			for i, n := range fields.reservedNames {
+				quoted[i] = strconv.Quote(n)
+			}
+			fmt.Fprintf(&body, "  reserved %s;\n", strings.Join(quoted, ", "))
+		}
+		for i, c := range s.Columns {
+			typ, repeated := protoType(c.Attrs.PgType)
+			if file, ok := protoWellKnown[typ]; ok {
+				imports[file] = true
+			}
+			label := ""
+			switch {
+			case repeated:
+				label = "repeated "
+			case !c.Attrs.NotNull && !strings.Contains(typ, "."):
+				label = "optional "
+			}
+			fmt.Fprintf(&body, "  %s%s %s = %d;\n", label, typ, protoFieldName(c.ColumnName), fields.numbers[i])
+		}
+		body.WriteString("}\n")
+	}
+
+	var b bytes.Buffer
+	b.WriteString(protoHeader)
+	b.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&b, "package %s;\n", pkg)
+	if len(imports) > 0 {
+		files := make([]string, 0, len(imports))
+		for f := range imports {
+			files = append(files, f)
+		}
+		sort.Strings(files)
+		b.WriteString("\n")
+		for _, f := range files {
+			fmt.Fprintf(&b, "import %q;\n", f)
+		}
+	}
+	if goPackage != "" {
+		fmt.Fprintf(&b, "\noption go_package = %q;\n", goPackage)
+	}
+	b.Write(body.Bytes())
+	return b.Bytes(), nil
+}
+
+// protoMessage holds the field numbers of a message: in a previous file
+// when parsed, for the columns of a table once assigned.
+type protoMessage struct {
+	// fields maps field names to numbers; numbers lists them by column.
+	fields  map[string]int
+	numbers []int
+
+	reserved      []int
+	reservedNames []string
+}
+
+var (
+	protoMessageRe  = regexp.MustCompile(`^message\s+(\w+)\s*\{`)
+	protoFieldRe    = regexp.MustCompile(`^(?:(?:optional|repeated)\s+)?[\w.]+\s+(\w+)\s*=\s*(\d+)\s*;`)
+	protoReservedRe = regexp.MustCompile(`^reserved\s+(.+);`)
+)
+
+// parseProtoNumbers reads the field numbers and reserved fields of the
+// messages in a file written by Proto, by message name.
+func parseProtoNumbers(src []byte) (map[string]*protoMessage, error) {
+	messages := map[string]*protoMessage{}
+	var current *protoMessage
+	for i, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if m := protoMessageRe.FindStringSubmatch(line); m != nil {
+			current = &protoMessage{fields: map[string]int{}}
+			messages[m[1]] = current
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if line == "}" {
+			current = nil
+			continue
+		}
+		if m := protoReservedRe.FindStringSubmatch(line); m != nil {
+			for _, item := range strings.Split(m[1], ",") {
+				item = strings.TrimSpace(item)
+				if name, err := strconv.Unquote(item); err == nil {
+					current.reservedNames = append(current.reservedNames, name)
+					continue
+				}
+				n, err := strconv.Atoi(item)
+				if err != nil {
+					return nil, fmt.Errorf("previous proto file, line %d: unsupported reserved %q", i+1, item)
+				}
+				current.reserved = append(current.reserved, n)
+			}
+			continue
+		}
+		if m := protoFieldRe.FindStringSubmatch(line); m != nil {
+			n, err := strconv.Atoi(m[2])
+			if err != nil {
+				return nil, fmt.Errorf("previous proto file, line %d: %w", i+1, err)
+			}
+			current.fields[m[1]] = n
+		}
+	}
+	return messages, nil
+}
+
+// assign numbers the columns of a table, keeping the numbers of the fields
+// in prev, which may be nil, and reserving those of removed fields.
+func (prev *protoMessage) assign(columns []migrate.ColumnMeta) protoMessage {
+	var out protoMessage
+	if prev == nil {
+		for i := range columns {
+			out.numbers = append(out.numbers, i+1)
+		}
+		return out
+	}
+
+	next := 0
+	for _, n := range prev.fields {
+		next = max(next, n)
+	}
+	for _, n := range prev.reserved {
+		next = max(next, n)
+	}
+
+	kept := map[string]bool{}
+	for _, c := range columns {
+		name := protoFieldName(c.ColumnName)
+		n, ok := prev.fields[name]
+		if !ok {
+			next++
+			n = next
+		}
+		kept[name] = true
+		out.numbers = append(out.numbers, n)
+	}
+
+	out.reserved = append(out.reserved, prev.reserved...)
+	for name, n := range prev.fields {
+		if !kept[name] {
+			out.reserved = append(out.reserved, n)
+			out.reservedNames = append(out.reservedNames, name)
+		}
+	}
+	// A column added back gets a new number, so its name is no longer
+	// reserved.
+	for _, name := range prev.reservedNames {
+		if !kept[name] {
+			out.reservedNames = append(out.reservedNames, name)
+		}
+	}
+	sort.Ints(out.reserved)
+	sort.Strings(out.reservedNames)
+	return out
+}
+
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ", ")
+}
+
+// protoType maps a normalized Postgres type to a proto3 field type and
+// whether the field is repeated. Types without a proto counterpart, e.g.
+// uuid, numeric and enums, are strings.
+func protoType(pgType string) (string, bool) {
+	t := strings.ToLower(strings.TrimSpace(pgType))
+	if elem, ok := strings.CutSuffix(t, "[]"); ok {
+		if typ, repeated := protoType(elem); !repeated {
+			return typ, true
+		}
+		return "string", true
+	}
+	base, _, _ := strings.Cut(t, "(")
+	switch strings.TrimSpace(base) {
+	case "smallint", "integer", "smallserial", "serial":
+		return "int32", false
+	case "bigint", "bigserial":
+		return "int64", false
+	case "real":
+		return "float", false
+	case "double precision":
+		return "double", false
+	case "boolean":
+		return "bool", false
+	case "bytea":
+		return "bytes", false
+	case "timestamp", "timestamptz":
+		return "google.protobuf.Timestamp", false
+	case "interval":
+		return "google.protobuf.Duration", false
+	case "json", "jsonb":
+		return "google.protobuf.Value", false
+	case "vector", "halfvec":
+		return "float", true
+	}
+	return "string", false
+}
+
+var (
+	protoCamelRe   = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+	protoInvalidRe = regexp.MustCompile(`[^a-z0-9_]+`)
+)
+
+// protoFieldName writes a column name as a lower_snake_case proto field name.
+func protoFieldName(column string) string {
+	name := strings.ToLower(protoCamelRe.ReplaceAllString(column, "${1}_${2}"))
+	name = strings.Trim(protoInvalidRe.ReplaceAllString(name, "_"), "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "x_" + name
+	}
+	return name
+}
@@ -0,0 +1,107 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestProto(t *testing.T) {
+	t.Parallel()
+
+	items := migrate.NormalizeSchema(migrate.TableSchema{
+		TableName: "order_items",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ParseColumnTag("id,pk_uuid")},
+			{ColumnName: "quantity", Attrs: migrate.ParseColumnTag("quantity,notnull,type=integer")},
+			{ColumnName: "note", Attrs: migrate.ParseColumnTag("note")},
+			{ColumnName: "tags", Attrs: migrate.ParseColumnTag("tags,type=text[]")},
+			{ColumnName: "shippedAt", Attrs: migrate.ParseColumnTag("shippedAt,type=timestamptz")},
+		},
+	})
+
+	src, err := Proto("shop.v1", "example.com/shop/v1;shopv1", []migrate.TableSchema{items}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Code generated by migrateme export proto. DO NOT EDIT.
+
+syntax = "proto3";
+
+package shop.v1;
+
+import "google/protobuf/timestamp.proto";
+
+option go_package = "example.com/shop/v1;shopv1";
+
+// order_items
+message OrderItem {
+  string id = 1;
+  int32 quantity = 2;
+  optional string note = 3;
+  repeated string tags = 4;
+  google.protobuf.Timestamp shipped_at = 5;
+}
+`
+	if got := string(src); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestProto_StableNumbers(t *testing.T) {
+	t.Parallel()
+
+	users := func(columns ...string) []migrate.TableSchema {
+		s := migrate.TableSchema{TableName: "users"}
+		for _, c := range columns {
+			s.Columns = append(s.Columns, migrate.ColumnMeta{ColumnName: c, Attrs: migrate.ParseColumnTag(c + ",notnull")})
+		}
+		return []migrate.TableSchema{migrate.NormalizeSchema(s)}
+	}
+
+	first, err := Proto("shop.v1", "", users("id", "email", "name"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// email is removed, the columns are reordered and phone is added.
+	second, err := Proto("shop.v1", "", users("name", "id", "phone"), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+// users
+message User {
+  reserved 2;
+  reserved "email";
+  string name = 3;
+  string id = 1;
+  string phone = 4;
+}
+`
+	if got := string(second); !strings.HasSuffix(got, want) {
+		t.Fatalf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	// email comes back with a new number; 2 stays reserved.
+	third, err := Proto("shop.v1", "", users("name", "id", "phone", "email"), second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `
+message User {
+  reserved 2;
+  string name = 3;
+  string id = 1;
+  string phone = 4;
+  string email = 5;
+}
+`
+	if got := string(third); !strings.HasSuffix(got, want) {
+		t.Fatalf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	if _, err := Proto("shop.v1", "", users("id"), []byte("message User {\n  reserved 1 to 3;\n}\n")); err == nil {
+		t.Error("expected an unsupported reserved range to fail")
+	}
+}
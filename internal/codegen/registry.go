@@ -0,0 +1,175 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+const registryHeader = "// Code generated by migrateme gen registry. DO NOT EDIT.\n\n"
+
+// Registry generates a Go file declaring Registry(), which returns the
+// schemas as a migrate.SchemaRegistry, so that a program can use the
+// registry without discovering entities at run time. The output depends only
+// on the schemas: tables are sorted, source positions are left out and there
+// is no timestamp, so regenerating an unchanged registry gives the same file.
+func Registry(path, pkg string, schemas []migrate.TableSchema) (File, error) {
+	sorted := append([]migrate.TableSchema(nil), schemas...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].TableName < sorted[j].TableName })
+
+	var b bytes.Buffer
+	b.WriteString(registryHeader)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString("import \"github.com/amr0ny/migrateme/pkg/migrate\"\n\n")
+	b.WriteString("// Registry returns the schemas of the entities, as the migrator builds them.\n")
+	b.WriteString("func Registry() migrate.SchemaRegistry {\n\treturn migrate.SchemaRegistry{\n")
+	for _, s := range sorted {
+		fmt.Fprintf(&b, "\t\t%q: func(string) migrate.TableSchema {\n\t\t\treturn ", s.TableName)
+		writeSchemaLiteral(&b, s)
+		b.WriteString("\n\t\t},\n")
+	}
+	b.WriteString("\t}\n}\n\n")
+	b.WriteString("func migratemePtr[T any](v T) *T { return &v }\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return File{}, fmt.Errorf("format registry: %w", err)
+	}
+	return File{Path: path, Source: src}, nil
+}
+
+// writeSchemaLiteral writes s as a Go composite literal, leaving out zero
+// fields and the source positions of columns.
+func writeSchemaLiteral(b *bytes.Buffer, s migrate.TableSchema) {
+	b.WriteString("migrate.TableSchema{\n")
+	fmt.Fprintf(b, "TableName: %q,\n", s.TableName)
+	writeStringField(b, "Owner", s.Owner)
+
+	b.WriteString("Columns: []migrate.ColumnMeta{\n")
+	for _, c := range s.Columns {
+		b.WriteString("{\n")
+		writeStringField(b, "FieldName", c.FieldName)
+		fmt.Fprintf(b, "ColumnName: %q,\n", c.ColumnName)
+		fmt.Fprintf(b, "Idx: %d,\n", c.Idx)
+		writeAttrsLiteral(b, c.Attrs)
+		writeStringsField(b, "Ignore", c.Ignore)
+		writeStringField(b, "SQLFile", c.SQLFile)
+		writeStringField(b, "Using", c.Using)
+		b.WriteString("},\n")
+	}
+	b.WriteString("},\n")
+
+	if len(s.Indexes) > 0 {
+		b.WriteString("Indexes: []migrate.IndexMeta{\n")
+		for _, idx := range s.Indexes {
+			b.WriteString("{\n")
+			writeStringField(b, "Name", idx.Name)
+			writeStringsField(b, "Columns", idx.Columns)
+			if idx.Unique {
+				b.WriteString("Unique: true,\n")
+			}
+			writeStringPtrField(b, "Where", idx.Where)
+			writeStringField(b, "Method", idx.Method)
+			writeStringsField(b, "Opclasses", idx.Opclasses)
+			writeStringsField(b, "With", idx.With)
+			writeStringField(b, "Tablespace", idx.Tablespace)
+			b.WriteString("},\n")
+		}
+		b.WriteString("},\n")
+	}
+	if len(s.Checks) > 0 {
+		b.WriteString("Checks: []migrate.CheckMeta{\n")
+		for _, chk := range s.Checks {
+			fmt.Fprintf(b, "{Name: %q, Expr: %q},\n", chk.Name, chk.Expr)
+		}
+		b.WriteString("},\n")
+	}
+	writeStringsField(b, "Ignore", s.Ignore)
+	writeStringsField(b, "Storage", s.Storage)
+	writeStringField(b, "Tablespace", s.Tablespace)
+	writeStringField(b, "Like", s.Like)
+	writeStringsField(b, "Inherits", s.Inherits)
+	if len(s.Triggers) > 0 {
+		b.WriteString("Triggers: []migrate.TriggerMeta{\n")
+		for _, trg := range s.Triggers {
+			b.WriteString("{\n")
+			writeStringField(b, "Name", trg.Name)
+			writeStringField(b, "Timing", trg.Timing)
+			writeStringsField(b, "Events", trg.Events)
+			writeStringField(b, "Function", trg.Function)
+			writeStringField(b, "FunctionSQL", trg.FunctionSQL)
+			b.WriteString("},\n")
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString("}")
+}
+
+func writeAttrsLiteral(b *bytes.Buffer, a migrate.ColumnAttributes) {
+	b.WriteString("Attrs: migrate.ColumnAttributes{\n")
+	fmt.Fprintf(b, "PgType: %q,\n", a.PgType)
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{{"NotNull", a.NotNull}, {"Unique", a.Unique}, {"NullsNotDistinct", a.NullsNotDistinct}, {"IsPK", a.IsPK},
+		{"CaseInsensitive", a.CaseInsensitive}} {
+		if flag.set {
+			fmt.Fprintf(b, "%s: true,\n", flag.name)
+		}
+	}
+	writeStringPtrField(b, "Default", a.Default)
+	if a.Anon != "" {
+		fmt.Fprintf(b, "Anon: %q,\n", a.Anon)
+	}
+	if fk := a.ForeignKey; fk != nil {
+		fmt.Fprintf(b, "ForeignKey: &migrate.ForeignKey{Table: %q, Column: %q", fk.Table, fk.Column)
+		if fk.OnDelete != "" {
+			fmt.Fprintf(b, ", OnDelete: %q", fk.OnDelete)
+		}
+		if fk.OnUpdate != "" {
+			fmt.Fprintf(b, ", OnUpdate: %q", fk.OnUpdate)
+		}
+		if len(fk.OnDeleteColumns) > 0 {
+			fmt.Fprintf(b, ", OnDeleteColumns: %#v", fk.OnDeleteColumns)
+		}
+		if fk.Match != "" {
+			fmt.Fprintf(b, ", Match: %q", fk.Match)
+		}
+		if fk.Deferrable {
+			b.WriteString(", Deferrable: true")
+		}
+		if fk.InitiallyDeferred {
+			b.WriteString(", InitiallyDeferred: true")
+		}
+		b.WriteString("},\n")
+	}
+	writeStringPtrField(b, "ConstraintName", a.ConstraintName)
+	b.WriteString("},\n")
+}
+
+func writeStringField(b *bytes.Buffer, name, v string) {
+	if v != "" {
+		fmt.Fprintf(b, "%s: %q,\n", name, v)
+	}
+}
+
+func writeStringPtrField(b *bytes.Buffer, name string, v *string) {
+	if v != nil {
+		fmt.Fprintf(b, "%s: migratemePtr(%q),\n", name, *v)
+	}
+}
+
+func writeStringsField(b *bytes.Buffer, name string, v []string) {
+	if len(v) == 0 {
+		return
+	}
+	quoted := make([]string, len(v))
+	for i, s := range v {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	fmt.Fprintf(b, "%s: []string{%s},\n", name, strings.Join(quoted, ", "))
+}
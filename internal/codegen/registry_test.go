@@ -0,0 +1,69 @@
+package codegen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	now := "now()"
+	where := "deleted_at IS NULL"
+	users := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{FieldName: "ID", ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}, FilePath: "/src/user.go", Line: 7},
+			{FieldName: "Email", ColumnName: "email", Idx: 1, Attrs: migrate.ColumnAttributes{PgType: "text", Unique: true}},
+		},
+		Indexes: []migrate.IndexMeta{{Name: "idx_users_email", Columns: []string{"email"}, Where: &where}},
+	}
+	orders := migrate.TableSchema{
+		TableName: "orders",
+		Owner:     "billing",
+		Columns: []migrate.ColumnMeta{
+			{FieldName: "UserID", ColumnName: "user_id", Attrs: migrate.ColumnAttributes{PgType: "uuid", NotNull: true, ForeignKey: &migrate.ForeignKey{
+				Table: "users", Column: "id", OnDelete: migrate.Cascade,
+			}}},
+			{FieldName: "CreatedAt", ColumnName: "created_at", Idx: 1, Attrs: migrate.ColumnAttributes{PgType: "timestamptz", Default: &now}},
+		},
+		Checks: []migrate.CheckMeta{{Name: "chk_orders_created", Expr: "created_at > '2000-01-01'"}},
+	}
+
+	first, err := Registry("registry.gen.go", "domain", []migrate.TableSchema{users, orders})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Registry("registry.gen.go", "domain", []migrate.TableSchema{orders, users})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Source, second.Source) {
+		t.Fatalf("output depends on input order:\n%s\n---\n%s", first.Source, second.Source)
+	}
+
+	src := string(first.Source)
+	for _, want := range []string{
+		"// Code generated by migrateme gen registry. DO NOT EDIT.",
+		"package domain",
+		"func Registry() migrate.SchemaRegistry {",
+		`Owner:     "billing",`,
+		`ForeignKey: &migrate.ForeignKey{Table: "users", Column: "id", OnDelete: "CASCADE"},`,
+		`Default: migratemePtr("now()"),`,
+		`Where:   migratemePtr("deleted_at IS NULL"),`,
+		`{Name: "chk_orders_created", Expr: "created_at > '2000-01-01'"},`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("expected %q in:\n%s", want, src)
+		}
+	}
+	if strings.Index(src, `"orders": func`) > strings.Index(src, `"users": func`) {
+		t.Errorf("tables are not sorted:\n%s", src)
+	}
+	if strings.Contains(src, "user.go") {
+		t.Errorf("source positions leak into the registry:\n%s", src)
+	}
+}
@@ -0,0 +1,315 @@
+// Package codegen generates Go source from registered entities.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/schema"
+)
+
+const generatedHeader = "// Code generated by migrateme gen repo. DO NOT EDIT.\n\n"
+
+// File is a generated source file.
+type File struct {
+	Path   string
+	Source []byte
+}
+
+// Repositories generates a pgx CRUD repository next to every entity, plus one
+// DBTX interface (the same shape sqlc uses) per package.
+func Repositories(entities []migrate.EntityInfo) ([]File, error) {
+	var files []File
+	packages := map[string]string{}
+
+	for _, e := range entities {
+		src, err := repositorySource(e)
+		if err != nil {
+			return nil, fmt.Errorf("generate repository for %s: %w", e.StructName, err)
+		}
+		files = append(files, File{Path: filepath.Join(e.Package, e.TableName+"_repo.gen.go"), Source: src})
+		packages[e.Package] = e.PackageName
+	}
+
+	dirs := make([]string, 0, len(packages))
+	for dir := range packages {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		src, err := format.Source([]byte(generatedHeader + "package " + packages[dir] + dbtxSource))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: filepath.Join(dir, "migrateme_dbtx.gen.go"), Source: src})
+	}
+	return files, nil
+}
+
+const dbtxSource = `
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DBTX is implemented by *pgxpool.Pool, *pgx.Conn and pgx.Tx.
+type DBTX interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+`
+
+type repoColumn struct {
+	Field  string
+	Column string
+	GoType string
+	Param  string
+}
+
+func repositorySource(e migrate.EntityInfo) ([]byte, error) {
+	ts := schema.BuildSchema(e)
+	names, pkNames := schema.ExtractColumns(ts)
+
+	fields := map[string]migrate.FieldInfo{}
+	for _, f := range e.Fields {
+		fields[f.ColumnName] = f
+	}
+
+	var cols, pk, rest []repoColumn
+	for _, name := range names {
+		f, ok := fields[name]
+		if !ok {
+			// Added by a table option, like the soft-delete column; the
+			// struct has no field for it.
+			continue
+		}
+		c := repoColumn{Field: f.FieldName, Column: name, GoType: f.GoType, Param: paramName(name)}
+		if c.GoType == "" {
+			c.GoType = "any"
+		}
+		cols = append(cols, c)
+		if contains(pkNames, name) {
+			pk = append(pk, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+
+	repo := e.StructName + "Repository"
+	table := quoteIdent(e.TableName)
+
+	var b bytes.Buffer
+	b.WriteString(generatedHeader)
+	fmt.Fprintf(&b, "package %s\n\nimport (\n\t\"context\"\n", e.PackageName)
+	if len(pk) > 0 {
+		b.WriteString("\n\t\"github.com/jackc/pgx/v5\"\n")
+		for _, imp := range typeImports(pk, e.Imports) {
+			fmt.Fprintf(&b, "\t%s\n", imp)
+		}
+	}
+	b.WriteString(")\n\n")
+
+	soft := e.Options.SoftDelete && len(pk) > 0
+	notDeleted := quoteIdent(migrate.SoftDeleteColumn) + " IS NULL"
+	if soft {
+		fmt.Fprintf(&b, "// %sNotDeleted matches the rows of %s that are not soft-deleted.\n", e.StructName, e.TableName)
+		fmt.Fprintf(&b, "const %sNotDeleted = `%s`\n\n", e.StructName, notDeleted)
+	}
+
+	fmt.Fprintf(&b, "type %s struct {\n\tdb DBTX\n}\n\n", repo)
+	fmt.Fprintf(&b, "func New%s(db DBTX) *%s {\n\treturn &%s{db: db}\n}\n\n", repo, repo, repo)
+
+	// Insert
+	fmt.Fprintf(&b, "func (r *%s) Insert(ctx context.Context, e *%s) error {\n", repo, e.StructName)
+	fmt.Fprintf(&b, "\t_, err := r.db.Exec(ctx, `INSERT INTO %s (%s) VALUES (%s)`, %s)\n\treturn err\n}\n",
+		table, columnList(cols), placeholders(1, len(cols)), fieldArgs(cols))
+
+	if len(pk) == 0 {
+		return format.Source(b.Bytes())
+	}
+
+	// GetByPK
+	byPK := whereClause(pk, 1)
+	if soft {
+		byPK += " AND " + notDeleted
+	}
+	fmt.Fprintf(&b, "\nfunc (r *%s) GetByPK(ctx context.Context, %s) (*%s, error) {\n", repo, paramList(pk), e.StructName)
+	fmt.Fprintf(&b, "\tvar e %s\n", e.StructName)
+	fmt.Fprintf(&b, "\terr := r.db.QueryRow(ctx, `SELECT %s FROM %s WHERE %s`, %s).Scan(%s)\n",
+		columnList(cols), table, byPK, paramArgs(pk), scanArgs(cols))
+	b.WriteString("\tif err != nil {\n\t\treturn nil, err\n\t}\n\treturn &e, nil\n}\n")
+
+	// Update
+	if len(rest) > 0 {
+		sets := make([]string, len(rest))
+		for i, c := range rest {
+			sets[i] = fmt.Sprintf("%s = $%d", quoteIdent(c.Column), i+1)
+		}
+		fmt.Fprintf(&b, "\n// Update writes all non-key columns; it returns pgx.ErrNoRows when no row matches.\n")
+		fmt.Fprintf(&b, "func (r *%s) Update(ctx context.Context, e *%s) error {\n", repo, e.StructName)
+		fmt.Fprintf(&b, "\ttag, err := r.db.Exec(ctx, `UPDATE %s SET %s WHERE %s`, %s, %s)\n",
+			table, strings.Join(sets, ", "), whereClause(pk, len(rest)+1), fieldArgs(rest), fieldArgs(pk))
+		b.WriteString(rowsAffectedCheck)
+	}
+
+	// Delete
+	deleteMethod := "Delete"
+	if soft {
+		deleted := quoteIdent(migrate.SoftDeleteColumn)
+		fmt.Fprintf(&b, "\n// Delete soft-deletes a row; it returns pgx.ErrNoRows when no row that is not deleted matches.\n")
+		fmt.Fprintf(&b, "func (r *%s) Delete(ctx context.Context, %s) error {\n", repo, paramList(pk))
+		fmt.Fprintf(&b, "\ttag, err := r.db.Exec(ctx, `UPDATE %s SET %s = now() WHERE %s`, %s)\n",
+			table, deleted, byPK, paramArgs(pk))
+		b.WriteString(rowsAffectedCheck)
+
+		fmt.Fprintf(&b, "\n// Restore undoes Delete; it returns pgx.ErrNoRows when no deleted row matches.\n")
+		fmt.Fprintf(&b, "func (r *%s) Restore(ctx context.Context, %s) error {\n", repo, paramList(pk))
+		fmt.Fprintf(&b, "\ttag, err := r.db.Exec(ctx, `UPDATE %s SET %s = NULL WHERE %s AND %s IS NOT NULL`, %s)\n",
+			table, deleted, whereClause(pk, 1), deleted, paramArgs(pk))
+		b.WriteString(rowsAffectedCheck)
+		deleteMethod = "HardDelete"
+	}
+	fmt.Fprintf(&b, "\n// %s returns pgx.ErrNoRows when no row matches.\n", deleteMethod)
+	fmt.Fprintf(&b, "func (r *%s) %s(ctx context.Context, %s) error {\n", repo, deleteMethod, paramList(pk))
+	fmt.Fprintf(&b, "\ttag, err := r.db.Exec(ctx, `DELETE FROM %s WHERE %s`, %s)\n", table, whereClause(pk, 1), paramArgs(pk))
+	b.WriteString(rowsAffectedCheck)
+
+	return format.Source(b.Bytes())
+}
+
+const rowsAffectedCheck = `	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+`
+
+var qualifierRE = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)\.`)
+
+// typeImports returns import specs for packages referenced by the key types.
+func typeImports(cols []repoColumn, imports map[string]string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, c := range cols {
+		for _, m := range qualifierRE.FindAllStringSubmatch(c.GoType, -1) {
+			alias := m[1]
+			path, ok := imports[alias]
+			if !ok || seen[alias] {
+				continue
+			}
+			seen[alias] = true
+			spec := fmt.Sprintf("%q", path)
+			if path[strings.LastIndex(path, "/")+1:] != alias {
+				spec = alias + " " + spec
+			}
+			out = append(out, spec)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// paramName turns a column name into a Go parameter name: user_id -> userID.
+func paramName(column string) string {
+	parts := strings.Split(strings.ToLower(column), "_")
+	var b strings.Builder
+	for i, p := range parts {
+		switch {
+		case p == "":
+		case i == 0:
+			b.WriteString(p)
+		case p == "id":
+			b.WriteString("ID")
+		default:
+			b.WriteString(strings.ToUpper(p[:1]) + p[1:])
+		}
+	}
+	name := b.String()
+	if name == "" || token.IsKeyword(name) || name == "ctx" || name == "r" || name == "e" {
+		name += "Key"
+	}
+	return name
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func columnList(cols []repoColumn) string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = quoteIdent(c.Column)
+	}
+	return strings.Join(out, ", ")
+}
+
+func placeholders(from, n int) string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("$%d", from+i)
+	}
+	return strings.Join(out, ", ")
+}
+
+func whereClause(cols []repoColumn, from int) string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = fmt.Sprintf("%s = $%d", quoteIdent(c.Column), from+i)
+	}
+	return strings.Join(out, " AND ")
+}
+
+func fieldArgs(cols []repoColumn) string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = "e." + c.Field
+	}
+	return strings.Join(out, ", ")
+}
+
+func scanArgs(cols []repoColumn) string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = "&e." + c.Field
+	}
+	return strings.Join(out, ", ")
+}
+
+func paramList(cols []repoColumn) string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = c.Param + " " + c.GoType
+	}
+	return strings.Join(out, ", ")
+}
+
+func paramArgs(cols []repoColumn) string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = c.Param
+	}
+	return strings.Join(out, ", ")
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestRepositories(t *testing.T) {
+	t.Parallel()
+
+	entity := migrate.EntityInfo{
+		StructName:  "User",
+		TableName:   "users",
+		Package:     "/src/app/domain",
+		PackageName: "domain",
+		Imports:     map[string]string{"uuid": "github.com/google/uuid", "time": "time"},
+		Fields: []migrate.FieldInfo{
+			{FieldName: "ID", ColumnName: "id", Idx: 0, RawTag: `db:"id,pk,type=uuid"`, GoType: "uuid.UUID"},
+			{FieldName: "Email", ColumnName: "email", Idx: 1, RawTag: `db:"email,unique"`, GoType: "string"},
+			{FieldName: "CreatedAt", ColumnName: "created_at", Idx: 2, RawTag: `db:"created_at"`, GoType: "time.Time"},
+		},
+	}
+
+	files, err := Repositories([]migrate.EntityInfo{entity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != "/src/app/domain/users_repo.gen.go" || files[1].Path != "/src/app/domain/migrateme_dbtx.gen.go" {
+		t.Fatalf("unexpected files: %+v", files)
+	}
+
+	src := string(files[0].Source)
+	for _, want := range []string{
+		`"github.com/google/uuid"`,
+		"func (r *UserRepository) GetByPK(ctx context.Context, id uuid.UUID) (*User, error)",
+		`UPDATE "users" SET "email" = $1, "created_at" = $2 WHERE "id" = $3`,
+		`DELETE FROM "users" WHERE "id" = $1`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("expected %q in:\n%s", want, src)
+		}
+	}
+	if strings.Contains(src, `"time"`) {
+		t.Fatalf("time is not used by key types and must not be imported:\n%s", src)
+	}
+}
+
+func TestRepositories_SoftDelete(t *testing.T) {
+	t.Parallel()
+
+	entity := migrate.EntityInfo{
+		StructName:  "User",
+		TableName:   "users",
+		Package:     "/src/app/domain",
+		PackageName: "domain",
+		Fields: []migrate.FieldInfo{
+			{FieldName: "ID", ColumnName: "id", Idx: 0, RawTag: `db:"id,pk"`, GoType: "int64"},
+			{FieldName: "Email", ColumnName: "email", Idx: 1, RawTag: `db:"email,unique"`, GoType: "string"},
+		},
+		Options: migrate.TableOptions{SoftDelete: true},
+	}
+
+	files, err := Repositories([]migrate.EntityInfo{entity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := string(files[0].Source)
+	for _, want := range []string{
+		"const UserNotDeleted = `\"deleted_at\" IS NULL`",
+		`INSERT INTO "users" ("id", "email") VALUES ($1, $2)`,
+		`FROM "users" WHERE "id" = $1 AND "deleted_at" IS NULL`,
+		`UPDATE "users" SET "deleted_at" = now() WHERE "id" = $1 AND "deleted_at" IS NULL`,
+		`UPDATE "users" SET "deleted_at" = NULL WHERE "id" = $1 AND "deleted_at" IS NOT NULL`,
+		"func (r *UserRepository) HardDelete(ctx context.Context, id int64) error",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("expected %q in:\n%s", want, src)
+		}
+	}
+}
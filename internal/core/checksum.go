@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+)
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChecksums compares applied migrations with their up files and returns
+// the names of migrations whose files were modified after being applied.
+// Every mismatch is also reported as an MM3001 diagnostic.
+func (m *Migrator) VerifyChecksums(ctx context.Context) ([]string, error) {
+	recorded, err := m.db.GetAppliedChecksums(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied checksums: %w", err)
+	}
+
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+
+	var modified []string
+	for _, mig := range migrations {
+		base := mig.Base
+		want, ok := recorded[base]
+		if !ok {
+			continue
+		}
+		path := mig.path(true)
+		content, err := m.readMigration(mig, true)
+		if err != nil {
+			return nil, fmt.Errorf("read up file %s: %w", path, err)
+		}
+		if checksum(content) != want {
+			modified = append(modified, base)
+			m.report(diagnostics.Warningf(diagnostics.ChecksumMismatch,
+				"migration %s was modified after it had been applied", base).At(path, 0))
+		}
+	}
+
+	sort.Strings(modified)
+	return modified, nil
+}
+
+var destructiveRE = regexp.MustCompile(`(?i)\b(DROP\s+(TABLE|COLUMN|SCHEMA)|TRUNCATE)\b`)
+
+// isDestructive reports whether sql contains statements that lose data.
+func isDestructive(sql string) bool {
+	return destructiveRE.MatchString(sql)
+}
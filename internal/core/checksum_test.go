@@ -0,0 +1,21 @@
+package core
+
+import "testing"
+
+func TestIsDestructive(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]bool{
+		"ALTER TABLE users DROP COLUMN email;":            true,
+		"drop table if exists posts;":                     true,
+		"TRUNCATE audit_log;":                             true,
+		"ALTER TABLE users ADD COLUMN email text;":        false,
+		"DROP INDEX idx_users_email;":                     false,
+		"ALTER TABLE users DROP CONSTRAINT users_fk_org;": false,
+	}
+	for sql, want := range cases {
+		if got := isDestructive(sql); got != want {
+			t.Errorf("isDestructive(%q) = %v, want %v", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// customSQL returns the SQL fragments of the columns new adds over old. Up
+// fragments run after the generated statements; down fragments run before
+// them, while the columns still exist.
+func customSQL(old, new migrate.TableSchema) (up, down []string, err error) {
+	existing := make(map[string]bool, len(old.Columns))
+	for _, c := range old.Columns {
+		existing[c.ColumnName] = true
+	}
+
+	for _, c := range new.Columns {
+		if c.SQLFile == "" || existing[c.ColumnName] {
+			continue
+		}
+		fragUp, fragDown, err := readFragment(c.SQLFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sql fragment of %s.%s: %w", new.TableName, c.ColumnName, err)
+		}
+		up = append(up, fragUp...)
+		down = append(fragDown, down...)
+	}
+	return up, down, nil
+}
+
+// readFragment reads a SQL fragment file. Without -- +migrate markers the
+// whole file is up SQL.
+func readFragment(path string) (up, down []string, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasSectionMarkers(content) {
+		return statementBlock(string(content)), nil, nil
+	}
+
+	upSQL, downSQL, err := parseSections(content)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return statementBlock(string(upSQL)), statementBlock(string(downSQL)), nil
+}
+
+func hasSectionMarkers(content []byte) bool {
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if sectionMarkerRE.Match(bytes.TrimSpace(line)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestGenerateMigrationSQL_AppendsColumnFragments(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	backfill := filepath.Join(dir, "backfill_status.sql")
+	os.WriteFile(backfill, []byte("-- +migrate Up\nUPDATE users SET status = 'active';\n-- +migrate Down\nSELECT 'before drop';\n"), 0o644)
+	plain := filepath.Join(dir, "seed.sql")
+	os.WriteFile(plain, []byte("INSERT INTO users (id) VALUES (gen_random_uuid());\n"), 0o644)
+
+	old := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}, SQLFile: plain},
+		},
+	}
+	schemas := map[string]migrate.TableSchema{
+		"users": {
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}, SQLFile: plain},
+				{ColumnName: "status", Idx: 1, Attrs: migrate.ColumnAttributes{PgType: "text"}, SQLFile: backfill},
+			},
+		},
+	}
+
+	m := &Migrator{config: &config.Config{}}
+	plan := recordingDiffs{}
+	_, err := m.generateMigrationSQL(context.Background(), staticFetcher{"users": old}, []string{"users"}, schemas, discardSink{}, GenerateOptions{Plan: plan})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := plan["users"]
+	if len(diff.Up) < 2 || diff.Up[len(diff.Up)-1] != "UPDATE users SET status = 'active'" {
+		t.Fatalf("backfill must follow the generated statements, got %q", diff.Up)
+	}
+	for _, stmt := range diff.Up {
+		if stmt == "INSERT INTO users (id) VALUES (gen_random_uuid())" {
+			t.Fatal("fragment of an existing column was added again")
+		}
+	}
+	if len(diff.Down) < 2 || diff.Down[0] != "SELECT 'before drop'" {
+		t.Fatalf("down fragment must run before the column is dropped, got %q", diff.Down)
+	}
+}
+
+func TestGenerateMigrationSQL_MissingFragment(t *testing.T) {
+	t.Parallel()
+
+	schemas := map[string]migrate.TableSchema{
+		"users": {
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid"}, SQLFile: filepath.Join(t.TempDir(), "missing.sql")},
+			},
+		},
+	}
+
+	m := &Migrator{config: &config.Config{}}
+	if _, err := m.generateMigrationSQL(context.Background(), staticFetcher{}, []string{"users"}, schemas, discardSink{}, GenerateOptions{}); err == nil {
+		t.Fatal("expected an error for a missing fragment")
+	}
+}
+
+type recordingDiffs map[string]migrate.TableDiff
+
+func (p recordingDiffs) WriteTable(change TableChange, diff migrate.TableDiff) error {
+	p[change.TableName] = diff
+	return nil
+}
+
+func TestGenerateMigrationSQL_RefusesLossyTypeChanges(t *testing.T) {
+	t.Parallel()
+
+	old := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "age", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+		},
+	}
+	schemas := map[string]migrate.TableSchema{
+		"users": {
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "age", Attrs: migrate.ColumnAttributes{PgType: "integer"}},
+			},
+		},
+	}
+
+	m := &Migrator{config: &config.Config{}}
+	_, err := m.generateMigrationSQL(context.Background(), staticFetcher{"users": old}, []string{"users"}, schemas, discardSink{}, GenerateOptions{})
+	var lossy *LossyChangeError
+	if !errors.As(err, &lossy) || len(lossy.Changes) != 1 || lossy.Changes[0].Column != "age" {
+		t.Fatalf("expected a LossyChangeError for age, got %v", err)
+	}
+
+	if _, err := m.generateMigrationSQL(context.Background(), staticFetcher{"users": old}, []string{"users"}, schemas, discardSink{}, GenerateOptions{AllowLossy: true}); err != nil {
+		t.Fatalf("AllowLossy must permit the change: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/jackc/pgx/v5"
+)
+
+// Data dump formats: COPY csv with a header row, or COPY binary, which is
+// faster and exact but tied to the column types.
+const (
+	DataCSV    = "csv"
+	DataBinary = "binary"
+)
+
+// DataManifestFile describes a data dump in its directory.
+const DataManifestFile = "manifest.json"
+
+// DataManifest records the schema version a dump was taken at and its
+// files, in the order they are loaded.
+type DataManifest struct {
+	Version  string      `json:"version"`
+	Format   string      `json:"format"`
+	DumpedAt time.Time   `json:"dumped_at"`
+	Tables   []DataTable `json:"tables"`
+}
+
+// DataTable is the dump of one table.
+type DataTable struct {
+	Table string `json:"table"`
+	File  string `json:"file"`
+	Rows  int64  `json:"rows"`
+}
+
+// DataVersionError is returned by LoadData and Snapshot when the data was
+// taken at another schema version than the database is at.
+type DataVersionError struct {
+	Dump     string
+	Database string
+}
+
+func (e *DataVersionError) Error() string {
+	return fmt.Sprintf("data is from schema version %s, but the database is at %s; migrate the database to that version or take the data again",
+		versionOrNone(e.Dump), versionOrNone(e.Database))
+}
+
+func versionOrNone(v string) string {
+	if v == "" {
+		return "(no migrations)"
+	}
+	return fmt.Sprintf("%q", v)
+}
+
+// SchemaVersion returns the last applied migration in file order, or empty
+// when none is applied.
+func (m *Migrator) SchemaVersion(ctx context.Context) (string, error) {
+	applied, err := m.db.GetAppliedMigrations(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	if len(applied) == 0 {
+		return "", nil
+	}
+	return slices.Max(applied), nil
+}
+
+// DumpData copies the rows of tables, or of every registered table when none
+// are given, to one file per table in dir, and writes a DataManifest stamped
+// with the schema version. Tables are ordered so that referenced tables come
+// first, as LoadData needs them.
+func (m *Migrator) DumpData(ctx context.Context, dir string, tables []string, format string) (*DataManifest, error) {
+	if format != DataCSV && format != DataBinary {
+		return nil, fmt.Errorf("unknown data format %q, expected %q or %q", format, DataCSV, DataBinary)
+	}
+	if m.db.Pool == nil {
+		return nil, fmt.Errorf("dumping data needs a pgx pool")
+	}
+	schemas := m.buildSchemas()
+	if len(tables) == 0 {
+		tables = getTableNames(schemas)
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no tables to dump")
+	}
+
+	version, err := m.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	conn, err := m.db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	// One repeatable read transaction gives every table the same snapshot.
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	manifest := &DataManifest{Version: version, Format: format, DumpedAt: time.Now().UTC()}
+	for _, table := range dataOrder(schemas, tables) {
+		file := table + "." + format
+		if format == DataBinary {
+			file = table + ".bin"
+		}
+		rows, err := copyTableTo(ctx, tx.Conn(), table, filepath.Join(dir, file), format)
+		if err != nil {
+			return nil, fmt.Errorf("dump %s: %w", table, err)
+		}
+		manifest.Tables = append(manifest.Tables, DataTable{Table: table, File: file, Rows: rows})
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, DataManifestFile), append(content, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+func copyTableTo(ctx context.Context, conn *pgx.Conn, table, path, format string) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	tag, err := conn.PgConn().CopyTo(ctx, w, "COPY "+pgx.Identifier{table}.Sanitize()+" TO STDOUT "+copyOptions(format))
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return tag.RowsAffected(), err
+}
+
+func copyOptions(format string) string {
+	if format == DataBinary {
+		return "WITH (FORMAT binary)"
+	}
+	return "WITH (FORMAT csv, HEADER true)"
+}
+
+// ReadDataManifest reads the manifest of the dump in dir.
+func ReadDataManifest(dir string) (*DataManifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, DataManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var manifest DataManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", DataManifestFile, err)
+	}
+	if manifest.Format != DataCSV && manifest.Format != DataBinary {
+		return nil, fmt.Errorf("%s: unknown data format %q", DataManifestFile, manifest.Format)
+	}
+	// Files are read from dir only, whatever the manifest says.
+	seen := make(map[string]bool, len(manifest.Tables))
+	for _, t := range manifest.Tables {
+		if t.File != filepath.Base(t.File) || t.File == "." || t.File == ".." {
+			return nil, fmt.Errorf("%s: file %q of table %s is not in the dump directory", DataManifestFile, t.File, t.Table)
+		}
+		if seen[t.Table] {
+			return nil, fmt.Errorf("%s: table %s is listed twice", DataManifestFile, t.Table)
+		}
+		seen[t.Table] = true
+	}
+	return &manifest, nil
+}
+
+// LoadData copies the dump in dir into the database, in one transaction, and
+// moves the sequences of serial and identity columns past the loaded rows.
+// It fails with a *DataVersionError unless the database is at the schema
+// version the dump was taken at. Tables are loaded so that referenced tables
+// come first, by the foreign keys of the registered schemas, whatever order
+// the manifest lists them in. With truncate the tables are emptied first.
+func (m *Migrator) LoadData(ctx context.Context, dir string, truncate bool) (*DataManifest, error) {
+	manifest, err := ReadDataManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data dump: %w", err)
+	}
+	version, err := m.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version != manifest.Version {
+		return nil, &DataVersionError{Dump: manifest.Version, Database: version}
+	}
+	if m.config != nil {
+		manifest.Tables = sortDataTables(m.buildSchemas(), manifest.Tables)
+	}
+	if m.db.Pool == nil {
+		return nil, fmt.Errorf("loading data needs a pgx pool")
+	}
+
+	err = pgx.BeginFunc(ctx, m.db.Pool, func(tx pgx.Tx) error {
+		if truncate && len(manifest.Tables) > 0 {
+			names := make([]string, len(manifest.Tables))
+			for i, t := range manifest.Tables {
+				names[i] = pgx.Identifier{t.Table}.Sanitize()
+			}
+			if _, err := tx.Exec(ctx, "TRUNCATE "+strings.Join(names, ", ")); err != nil {
+				return fmt.Errorf("truncate: %w", err)
+			}
+		}
+		for i, t := range manifest.Tables {
+			rows, err := copyTableFrom(ctx, tx.Conn(), t.Table, filepath.Join(dir, t.File), manifest.Format)
+			if err != nil {
+				return fmt.Errorf("load %s: %w", t.Table, err)
+			}
+			manifest.Tables[i].Rows = rows
+			if err := resetSequences(ctx, tx, t.Table); err != nil {
+				return fmt.Errorf("reset sequences of %s: %w", t.Table, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// dataOrder orders tables so that referenced tables come first, the order
+// DumpData writes them in and LoadData loads them in.
+func dataOrder(schemas map[string]migrate.TableSchema, tables []string) []string {
+	return topologicalSort(dependencyGraph(schemas, tables), tables)
+}
+
+// sortDataTables puts the tables of a manifest in dataOrder.
+func sortDataTables(schemas map[string]migrate.TableSchema, tables []DataTable) []DataTable {
+	names := make([]string, len(tables))
+	byName := make(map[string]DataTable, len(tables))
+	for i, t := range tables {
+		names[i] = t.Table
+		byName[t.Table] = t
+	}
+	sorted := make([]DataTable, 0, len(tables))
+	for _, name := range dataOrder(schemas, names) {
+		sorted = append(sorted, byName[name])
+	}
+	return sorted
+}
+
+func copyTableFrom(ctx context.Context, conn *pgx.Conn, table, path, format string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	tag, err := conn.PgConn().CopyFrom(ctx, bufio.NewReader(f), "COPY "+pgx.Identifier{table}.Sanitize()+" FROM STDIN "+copyOptions(format))
+	return tag.RowsAffected(), err
+}
+
+// resetSequences sets the sequence of every serial or identity column of
+// table so that its next value follows the largest loaded one.
+func resetSequences(ctx context.Context, tx pgx.Tx, table string) error {
+	quoted := pgx.Identifier{table}.Sanitize()
+	rows, err := tx.Query(ctx, `
+SELECT a.attname, pg_get_serial_sequence($1, a.attname)
+FROM pg_attribute a
+WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+  AND pg_get_serial_sequence($1, a.attname) IS NOT NULL`, quoted)
+	if err != nil {
+		return fmt.Errorf("query sequences: %w", err)
+	}
+	type sequence struct{ column, name string }
+	var seqs []sequence
+	for rows.Next() {
+		var s sequence
+		if err := rows.Scan(&s.column, &s.name); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan sequence row: %w", err)
+		}
+		seqs = append(seqs, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate sequence rows: %w", err)
+	}
+
+	for _, s := range seqs {
+		column := pgx.Identifier{s.column}.Sanitize()
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`SELECT setval($1, COALESCE(max(%s), 0) + 1, false) FROM %s`, column, quoted), s.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestReadDataManifest(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name, manifest, err string
+	}{
+		{"valid", `{"version": "001__init", "format": "csv", "tables": [{"table": "users", "file": "users.csv"}]}`, ""},
+		{"format", `{"version": "001__init", "format": "xml", "tables": []}`, `unknown data format "xml"`},
+		{"outside", `{"version": "001__init", "format": "csv", "tables": [{"table": "users", "file": "../users.csv"}]}`, "not in the dump directory"},
+		{"twice", `{"version": "001__init", "format": "csv", "tables": [{"table": "users", "file": "users.csv"}, {"table": "users", "file": "users2.csv"}]}`, "listed twice"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, DataManifestFile), []byte(tc.manifest), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			m, err := ReadDataManifest(dir)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatal(err)
+			case tc.err == "" && (m.Version != "001__init" || len(m.Tables) != 1):
+				t.Fatalf("manifest = %+v", m)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Fatalf("err = %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestDataVersionError(t *testing.T) {
+	t.Parallel()
+
+	err := &DataVersionError{Dump: "002__orders", Database: ""}
+	if msg := err.Error(); !strings.Contains(msg, `"002__orders"`) || !strings.Contains(msg, "(no migrations)") {
+		t.Fatalf("message = %q", msg)
+	}
+}
+
+func TestLoadData_Version(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manifest := `{"version": "0002__orders", "format": "csv", "tables": [{"table": "users", "file": "users.csv"}]}`
+	if err := os.WriteFile(filepath.Join(dir, DataManifestFile), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		applied []string
+		want    *DataVersionError
+	}{
+		{"behind", []string{"0001__users"}, &DataVersionError{Dump: "0002__orders", Database: "0001__users"}},
+		{"ahead", []string{"0001__users", "0002__orders", "0003__email"}, &DataVersionError{Dump: "0002__orders", Database: "0003__email"}},
+		{"empty", nil, &DataVersionError{Dump: "0002__orders", Database: ""}},
+		// The version is the last migration in file order, not the last
+		// one applied.
+		{"same", []string{"0002__orders", "0001__users"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := NewMigrator(config.Default(), database.New(&fakeExecutor{applied: tc.applied}))
+			_, err := m.LoadData(context.Background(), dir, false)
+
+			var versionErr *DataVersionError
+			switch {
+			case tc.want != nil && (!errors.As(err, &versionErr) || *versionErr != *tc.want):
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			// Past the version check only the copy is left, which needs a
+			// pgx pool.
+			case tc.want == nil && (err == nil || !strings.Contains(err.Error(), "needs a pgx pool")):
+				t.Fatalf("err = %v, want the version to match", err)
+			}
+		})
+	}
+}
+
+func TestSortDataTables(t *testing.T) {
+	t.Parallel()
+
+	fk := func(table, column, ref string) migrate.TableSchema {
+		return migrate.TableSchema{TableName: table, Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ParseColumnTag("id,pk,type=bigint")},
+			{ColumnName: column, Attrs: migrate.ParseColumnTag(column + ",type=bigint,fk=" + ref + ".id")},
+		}}
+	}
+	schemas := map[string]migrate.TableSchema{
+		"users":       {TableName: "users", Columns: []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ParseColumnTag("id,pk,type=bigint")}}},
+		"orders":      fk("orders", "user_id", "users"),
+		"order_items": fk("order_items", "order_id", "orders"),
+	}
+	// A manifest listing dependents first, e.g. edited by hand.
+	tables := []DataTable{
+		{Table: "order_items", File: "order_items.csv", Rows: 3},
+		{Table: "orders", File: "orders.csv", Rows: 2},
+		{Table: "users", File: "users.csv", Rows: 1},
+	}
+
+	var got []string
+	for _, dt := range sortDataTables(schemas, tables) {
+		got = append(got, dt.Table+":"+dt.File)
+	}
+	if want := "users:users.csv orders:orders.csv order_items:order_items.csv"; strings.Join(got, " ") != want {
+		t.Errorf("load order = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dirLockName is the lock file generate holds in the migrations directory.
+// It does not end in .sql, so it is never taken for a migration.
+const dirLockName = ".migrateme.lock"
+
+// staleDirLock is the age after which a lock file is taken to be left behind
+// by a generate that crashed, and is broken.
+const staleDirLock = time.Hour
+
+// ErrDirLocked reports that another generate is writing to the migrations
+// directory.
+var ErrDirLocked = errors.New("migrations directory is locked")
+
+// lockDir takes the lock file of dir, so that generate runs sharing the
+// directory, but not necessarily a database, never write migrations at the
+// same time. The returned function releases it.
+func lockDir(dir string) (func(), error) {
+	path := filepath.Join(dir, dirLockName)
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			host, _ := os.Hostname()
+			fmt.Fprintf(f, "pid %d on %s since %s\n", os.Getpid(), host, time.Now().UTC().Format(time.RFC3339))
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock migrations directory: %w", err)
+		}
+
+		info, statErr := os.Stat(path)
+		if statErr == nil && time.Since(info.ModTime()) > staleDirLock && attempt == 0 {
+			os.Remove(path)
+			continue
+		}
+		holder, _ := os.ReadFile(path)
+		return nil, fmt.Errorf("%w: another generate holds %s (%s); remove the file if that run is gone",
+			ErrDirLocked, path, strings.TrimSpace(string(holder)))
+	}
+}
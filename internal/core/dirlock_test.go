@@ -0,0 +1,91 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+)
+
+func TestLockDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	unlock, err := lockDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockDir(dir); !errors.Is(err, ErrDirLocked) {
+		t.Fatalf("second lock: got %v, want ErrDirLocked", err)
+	}
+	unlock()
+
+	unlock, err = lockDir(dir)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	defer unlock()
+
+	// A lock left behind by a crashed run is broken once it is stale.
+	old := time.Now().Add(-2 * staleDirLock)
+	if err := os.Chtimes(filepath.Join(dir, dirLockName), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockDir(dir); err != nil {
+		t.Fatalf("stale lock was not broken: %v", err)
+	}
+}
+
+func TestClaimMigrationName_Collisions(t *testing.T) {
+	t.Parallel()
+
+	newMigrator := func(naming string) (*Migrator, string) {
+		cfg := config.Default()
+		cfg.Migrations.Dir = t.TempDir()
+		cfg.Migrations.Naming = naming
+		return NewMigrator(cfg, nil), cfg.Migrations.Dir
+	}
+	upFile := func(dir string) func(string) string {
+		return func(base string) string { return filepath.Join(dir, base+".up.sql") }
+	}
+
+	m, dir := newMigrator(NamingSequential)
+	first, err := m.claimMigrationName("users", upFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.claimMigrationName("posts", upFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != "0001__users" || second != "0002__posts" {
+		t.Errorf("sequential names = %s, %s; want 0001__users, 0002__posts", first, second)
+	}
+
+	// Another run writes the migration the first name picked.
+	m, dir = newMigrator(NamingTimestamp)
+	taken := filepath.Join(dir, "taken.up.sql")
+	if err := os.WriteFile(taken, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	name, err := m.claimMigrationName("posts", func(base string) string {
+		if calls++; calls == 1 {
+			return taken
+		}
+		return upFile(dir)(base)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(name, "__posts_2") {
+		t.Errorf("name after a collision = %s, want a _2 suffix", name)
+	}
+	if _, err := os.Stat(filepath.Join(dir, name+".up.sql")); err != nil {
+		t.Errorf("name was not reserved: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	schema2 "github.com/amr0ny/migrateme/pkg/schema"
+)
+
+// Reasons a migration is reported as stale by Drift.
+const (
+	StaleModified = "modified"
+	StaleMissing  = "missing"
+)
+
+// StaleMigration is an applied migration whose file no longer matches what
+// was applied.
+type StaleMigration struct {
+	Migration string `json:"migration"`
+	Reason    string `json:"reason"`
+}
+
+// DriftResult compares the migration files, the live database and the
+// registry with each other.
+type DriftResult struct {
+	// Replayed lists the migrations replayed into the shadow database.
+	Replayed []string `json:"replayed"`
+	// Manual is how the live schema differs from the schema the migrations
+	// it applied produce: changes made to the database by hand.
+	Manual []schema2.TableComparison `json:"manual"`
+	// Stale are applied migrations whose file was modified or removed since.
+	Stale []StaleMigration `json:"stale"`
+	// Ungenerated is how the registry differs from the schema every
+	// migration file produces: entity changes generate has not been run for.
+	Ungenerated []schema2.TableComparison `json:"ungenerated"`
+}
+
+// HasDrift reports whether any of the three comparisons found a difference.
+func (r *DriftResult) HasDrift() bool {
+	return len(r.Manual) > 0 || len(r.Stale) > 0 || len(r.Ungenerated) > 0
+}
+
+// Drift replays the migration files into shadow, an empty scratch database,
+// and compares the result with the live database of the migrator and with
+// the registry. The migrations applied to the live database are replayed
+// first, so that pending migrations do not count as manual changes; then the
+// rest, whose schema has to match the entities. The live database is only
+// read.
+func (m *Migrator) Drift(ctx context.Context, shadow *database.DB) (*DriftResult, error) {
+	if m.db.Pool == nil || shadow.Pool == nil {
+		return nil, fmt.Errorf("detecting drift needs pgx pools to read the schemas")
+	}
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+	applied, err := m.db.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	appliedSet := make(map[string]bool, len(applied))
+	for _, a := range applied {
+		appliedSet[a] = true
+	}
+
+	result := &DriftResult{
+		Replayed:    []string{},
+		Manual:      []schema2.TableComparison{},
+		Stale:       []StaleMigration{},
+		Ungenerated: []schema2.TableComparison{},
+	}
+	if result.Stale, err = m.staleMigrations(ctx, migrations, applied); err != nil {
+		return nil, err
+	}
+
+	replay := func(wantApplied bool) error {
+		for _, mig := range migrations {
+			if appliedSet[mig.Base] != wantApplied {
+				continue
+			}
+			up, noTx, err := m.migrationSQL(mig, true)
+			if err != nil {
+				return err
+			}
+			if err := execMigration(ctx, shadow, up, noTx); err != nil {
+				return fmt.Errorf("replay %s: %w", mig.Base, err)
+			}
+			result.Replayed = append(result.Replayed, mig.Base)
+		}
+		return nil
+	}
+
+	shadowFetcher := schema2.NewFetcher(shadow.Pool)
+	if err := replay(true); err != nil {
+		return nil, err
+	}
+	replayed, err := m.snapshotManaged(ctx, shadowFetcher)
+	if err != nil {
+		return nil, fmt.Errorf("shadow database: %w", err)
+	}
+	live, err := m.snapshotManaged(ctx, schema2.NewFetcher(m.db.Pool))
+	if err != nil {
+		return nil, fmt.Errorf("live database: %w", err)
+	}
+
+	// Tables neither the migrations nor the registry know about belong to
+	// someone else, e.g. another group or application, and are left out.
+	schemas := m.buildSchemas()
+	known := make(map[string]bool, len(replayed)+len(schemas))
+	for _, t := range replayed {
+		known[t.TableName] = true
+	}
+	for table := range schemas {
+		known[table] = true
+	}
+	var ours []migrate.TableSchema
+	for _, t := range live {
+		if known[t.TableName] {
+			ours = append(ours, t)
+		}
+	}
+	if diff := schema2.Compare(replayed, ours); diff != nil {
+		result.Manual = diff
+	}
+
+	if err := replay(false); err != nil {
+		return nil, err
+	}
+	all, err := m.snapshotManaged(ctx, shadowFetcher)
+	if err != nil {
+		return nil, fmt.Errorf("shadow database: %w", err)
+	}
+	registry := make([]migrate.TableSchema, 0, len(schemas))
+	for _, s := range schemas {
+		registry = append(registry, s)
+	}
+	if diff := schema2.Compare(all, registry); diff != nil {
+		result.Ungenerated = diff
+	}
+	return result, nil
+}
+
+// staleMigrations finds the applied migrations whose up file changed since
+// it was applied or no longer exists.
+func (m *Migrator) staleMigrations(ctx context.Context, migrations []migration, applied []string) ([]StaleMigration, error) {
+	stale := []StaleMigration{}
+	modified, err := m.VerifyChecksums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range modified {
+		stale = append(stale, StaleMigration{Migration: name, Reason: StaleModified})
+	}
+
+	files := make(map[string]bool, len(migrations))
+	for _, mig := range migrations {
+		files[mig.Base] = true
+	}
+	for _, name := range applied {
+		if !files[name] {
+			stale = append(stale, StaleMigration{Migration: name, Reason: StaleMissing})
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Migration < stale[j].Migration })
+	return stale, nil
+}
+
+// snapshotManaged is snapshotSchema without migration history tables.
+func (m *Migrator) snapshotManaged(ctx context.Context, fetcher *schema2.Fetcher) ([]migrate.TableSchema, error) {
+	tables, err := snapshotSchema(ctx, fetcher)
+	if err != nil {
+		return nil, err
+	}
+	isHistory := func(table string) bool {
+		return table == database.DefaultHistoryTable || strings.HasPrefix(table, database.DefaultHistoryTable+"_")
+	}
+	if m.config != nil {
+		isHistory = m.config.IsHistoryTable
+	}
+	out := tables[:0]
+	for _, t := range tables {
+		if !isHistory(t.TableName) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Export formats.
+const (
+	// ExportGoose writes <version>_<name>.sql with -- +goose Up/Down
+	// sections.
+	ExportGoose = "goose"
+	// ExportGolangMigrate writes <version>_<name>.up.sql and .down.sql.
+	ExportGolangMigrate = "golang-migrate"
+)
+
+// ExportedMigration is a migration written by Export.
+type ExportedMigration struct {
+	Migration string   `json:"migration"`
+	Files     []string `json:"files"`
+	// Warning explains what the other tool runs differently.
+	Warning string `json:"warning,omitempty"`
+}
+
+// Export writes the migrations to dir in the file naming and directive
+// conventions of another migration runner. The SQL written is what run
+// would execute: templates are rendered and configured timeouts set. For
+// goose the BEGIN; and COMMIT; around generated migrations are left out,
+// since goose runs each migration in a transaction itself.
+// Migrations need numeric versions, which both tools require; existing
+// files are only replaced with overwrite.
+func (m *Migrator) Export(format, dir string, overwrite bool) ([]ExportedMigration, error) {
+	if format != ExportGoose && format != ExportGolangMigrate {
+		return nil, fmt.Errorf("unknown export format %q, want %s or %s", format, ExportGoose, ExportGolangMigrate)
+	}
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+
+	type file struct {
+		path    string
+		content string
+	}
+	var files []file
+	var exported []ExportedMigration
+	for _, mig := range migrations {
+		n, ok := sequenceNumber(mig.Base)
+		if !ok {
+			return nil, fmt.Errorf("migration %s has no numeric version, which %s needs", mig.Base, format)
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("migration %s has version 0, which %s does not accept", mig.Base, format)
+		}
+		_, title, _ := strings.Cut(mig.Base, "__")
+		prefix := migrationVersion(mig.Base) + "_" + strings.ReplaceAll(title, "__", "_")
+
+		up, noTx, err := m.runSQL(mig, true)
+		if err != nil {
+			return nil, err
+		}
+		down, _, err := m.runSQL(mig, false)
+		if err != nil {
+			return nil, err
+		}
+
+		result := ExportedMigration{Migration: mig.Base}
+		var own []file
+		switch format {
+		case ExportGoose:
+			own = append(own, file{prefix + ".sql", gooseMigration(stripTxBlock(up), stripTxBlock(down), noTx)})
+		case ExportGolangMigrate:
+			own = append(own, file{prefix + ".up.sql", up})
+			if strings.TrimSpace(down) != "" {
+				own = append(own, file{prefix + ".down.sql", down})
+			}
+			if noTx && countStatements(up) > 1 {
+				result.Warning = "golang-migrate runs a file as one query, in an implicit transaction; " +
+					"split this no_transaction migration into one file per statement"
+			}
+		}
+		for _, f := range own {
+			result.Files = append(result.Files, f.path)
+		}
+		files = append(files, own...)
+		exported = append(exported, result)
+	}
+
+	if !overwrite {
+		for _, f := range files {
+			if _, err := os.Stat(filepath.Join(dir, f.path)); err == nil {
+				return nil, fmt.Errorf("%s already exists in %s; use --force to replace it", f.path, dir)
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.path), []byte(f.content), 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return exported, nil
+}
+
+// runSQL returns the SQL run executes for one direction of mig, empty
+// for a missing down file, and whether the migration is no_transaction.
+func (m *Migrator) runSQL(mig migration, up bool) (string, bool, error) {
+	content, err := m.readMigration(mig, up)
+	if !up && errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read %s: %w", mig.path(up), err)
+	}
+	sql, err := m.renderSQL(mig.path(up), content)
+	if err != nil {
+		return "", false, err
+	}
+	noTx := isNoTransaction(content)
+	if !noTx && strings.TrimSpace(sql) != "" {
+		if sql, err = m.withTimeouts(mig.path(up), content, sql); err != nil {
+			return "", false, err
+		}
+	}
+	return sql, noTx, nil
+}
+
+var commitRE = regexp.MustCompile(`(?i)^(COMMIT|END)(\s+(WORK|TRANSACTION))?\s*;?$`)
+
+// stripTxBlock removes the BEGIN; and COMMIT; that generate wraps a
+// migration in. goose runs every migration in a transaction of its own and
+// records the version in it; a COMMIT of the file would end that
+// transaction early and leave the version row outside it.
+func stripTxBlock(sql string) string {
+	lines := strings.Split(sql, "\n")
+	first, last := -1, -1
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			first = i
+			break
+		}
+	}
+	for i := len(lines) - 1; i > first; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && !strings.HasPrefix(line, "--") {
+			last = i
+			break
+		}
+	}
+	if first < 0 || last < 0 || !beginRE.MatchString(strings.TrimSpace(lines[first])) ||
+		!commitRE.MatchString(strings.TrimSpace(lines[last])) {
+		return sql
+	}
+	// Keep what follows BEGIN; on its line, e.g. the SET LOCAL timeouts.
+	lines[first] = strings.TrimSpace(beginRE.ReplaceAllString(strings.TrimSpace(lines[first]), ""))
+	lines[last] = ""
+	return strings.Join(lines, "\n")
+}
+
+// gooseMigration joins up and down into a goose migration. goose splits a
+// section at semicolons, so a section with dollar-quoted bodies is kept
+// whole between StatementBegin and StatementEnd.
+func gooseMigration(up, down string, noTx bool) string {
+	var b strings.Builder
+	if noTx {
+		b.WriteString("-- +goose NO TRANSACTION\n")
+	}
+	for _, section := range []struct{ marker, sql string }{{"Up", up}, {"Down", down}} {
+		fmt.Fprintf(&b, "-- +goose %s\n", section.marker)
+		sql := strings.TrimSpace(section.sql)
+		if sql == "" {
+			continue
+		}
+		if hasDollarQuote(sql) {
+			fmt.Fprintf(&b, "-- +goose StatementBegin\n%s\n-- +goose StatementEnd\n", sql)
+		} else {
+			b.WriteString(sql + "\n")
+		}
+	}
+	return b.String()
+}
+
+func hasDollarQuote(sql string) bool {
+	for i := range sql {
+		if sql[i] == '$' && dollarTag(sql[i:]) != "" {
+			return true
+		}
+	}
+	return false
+}
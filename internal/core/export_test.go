@@ -0,0 +1,146 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/schema"
+)
+
+var exportFS = fstest.MapFS{
+	"0001__create_users.up.sql":   {Data: []byte("CREATE TABLE users (id int);\n")},
+	"0001__create_users.down.sql": {Data: []byte("DROP TABLE users;\n")},
+	"0002__touch_fn.up.sql": {Data: []byte("CREATE FUNCTION touch() RETURNS trigger AS $$\n" +
+		"BEGIN NEW.updated_at = now(); RETURN NEW; END;\n$$ LANGUAGE plpgsql;\n")},
+	"0003__email_idx.up.sql": {Data: []byte("-- migrateme:no_transaction\n" +
+		"CREATE INDEX CONCURRENTLY users_email ON users (email);\nCREATE INDEX CONCURRENTLY users_name ON users (name);\n")},
+}
+
+func TestExport_Goose(t *testing.T) {
+	t.Parallel()
+
+	m := NewMigrator(config.Default(), nil)
+	m.SetMigrationsFS(exportFS)
+	dir := t.TempDir()
+
+	exported, err := m.Export(ExportGoose, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 3 || exported[0].Files[0] != "0001_create_users.sql" {
+		t.Fatalf("exported %+v", exported)
+	}
+
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if got, want := read("0001_create_users.sql"), "-- +goose Up\nCREATE TABLE users (id int);\n-- +goose Down\nDROP TABLE users;\n"; got != want {
+		t.Errorf("goose migration is\n%s\nwant\n%s", got, want)
+	}
+	if got := read("0002_touch_fn.sql"); !strings.Contains(got, "-- +goose StatementBegin\nCREATE FUNCTION") {
+		t.Errorf("dollar-quoted function is not kept whole:\n%s", got)
+	}
+	if got := read("0003_email_idx.sql"); !strings.HasPrefix(got, "-- +goose NO TRANSACTION\n") {
+		t.Errorf("no_transaction migration is run in a transaction:\n%s", got)
+	}
+
+	if _, err := m.Export(ExportGoose, dir, false); err == nil {
+		t.Fatal("expected existing files to be kept without overwrite")
+	}
+	if _, err := m.Export(ExportGoose, dir, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Generated migrations carry their own BEGIN; and COMMIT;, which goose
+// must not see: it runs the migration and its version row in one
+// transaction of its own.
+func TestExport_GooseGeneratedMigration(t *testing.T) {
+	t.Parallel()
+
+	up := "-- migrateme:header {\"version\":\"dev\"}\n" +
+		schema.WrapTx([]string{"CREATE TABLE users (id int)", "CREATE INDEX users_id ON users (id)"})
+	down := schema.WrapTx([]string{"DROP TABLE users"})
+	cfg := config.Default()
+	cfg.Migrations.LockTimeout = 5 * time.Second
+	m := NewMigrator(cfg, nil)
+	m.SetMigrationsFS(fstest.MapFS{
+		"0001__create_users.up.sql":   {Data: []byte(up)},
+		"0001__create_users.down.sql": {Data: []byte(down)},
+	})
+	dir := t.TempDir()
+	if _, err := m.Export(ExportGoose, dir, false); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "0001_create_users.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, word := range []string{"BEGIN", "COMMIT"} {
+		if strings.Contains(got, word) {
+			t.Errorf("goose migration still contains %s:\n%s", word, got)
+		}
+	}
+	for _, want := range []string{"SET LOCAL lock_timeout = 5000;", "CREATE TABLE users (id int);", "CREATE INDEX users_id ON users (id);", "-- +goose Down", "DROP TABLE users;"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "SET LOCAL") > strings.Index(got, "CREATE TABLE") {
+		t.Errorf("the timeouts must come first:\n%s", got)
+	}
+
+	// golang-migrate runs the file as given, so it keeps the block.
+	if _, err := m.Export(ExportGolangMigrate, dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "0001_create_users.up.sql")); !strings.Contains(string(b), "COMMIT;") {
+		t.Errorf("golang-migrate up lost its transaction block:\n%s", b)
+	}
+}
+
+func TestExport_GolangMigrate(t *testing.T) {
+	t.Parallel()
+
+	m := NewMigrator(config.Default(), nil)
+	m.SetMigrationsFS(exportFS)
+	dir := t.TempDir()
+
+	exported, err := m.Export(ExportGolangMigrate, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := exported[0].Files; len(got) != 2 || got[0] != "0001_create_users.up.sql" || got[1] != "0001_create_users.down.sql" {
+		t.Errorf("files of 0001 are %v", got)
+	}
+	if got := exported[1].Files; len(got) != 1 {
+		t.Errorf("a migration without down got files %v", got)
+	}
+	if exported[2].Warning == "" {
+		t.Error("expected a warning for the multi-statement no_transaction migration")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "0002_touch_fn.up.sql")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExport_NeedsNumericVersions(t *testing.T) {
+	t.Parallel()
+
+	m := NewMigrator(config.Default(), nil)
+	m.SetMigrationsFS(fstest.MapFS{"add_users.up.sql": {Data: []byte("SELECT 1;")}})
+	if _, err := m.Export(ExportGoose, t.TempDir(), false); err == nil {
+		t.Fatal("expected a migration without numeric version to fail")
+	}
+}
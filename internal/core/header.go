@@ -0,0 +1,156 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/internal/version"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// Header is the metadata block generate writes at the top of a migration:
+// which migrateme wrote it, from which entities, and the state of the
+// registry at the time. It is read back by Verify.
+//
+//	-- migrateme:header {"version":"v1.4.0","generator":"generate","registry":"..."}
+//	-- migrateme:entity {"table":"users","struct":"domain.User","file":"domain/user.go","line":12,"schema":"..."}
+type Header struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator"`
+	// Registry is the checksum of every schema in the registry.
+	Registry string         `json:"registry"`
+	Entities []HeaderEntity `json:"entities,omitempty"`
+}
+
+// HeaderEntity is a table a migration changes, with the entity it was
+// generated from. Struct is empty for a table the migration drops.
+type HeaderEntity struct {
+	Table  string `json:"table"`
+	Struct string `json:"struct,omitempty"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	// Schema is the checksum of the schema the migration brings the table to.
+	Schema string `json:"schema,omitempty"`
+}
+
+const (
+	headerPrefix       = "-- migrateme:header "
+	headerEntityPrefix = "-- migrateme:entity "
+)
+
+// String renders h as SQL comments.
+func (h Header) String() string {
+	var b strings.Builder
+	meta, _ := json.Marshal(struct {
+		Version   string `json:"version"`
+		Generator string `json:"generator"`
+		Registry  string `json:"registry"`
+	}{h.Version, h.Generator, h.Registry})
+	fmt.Fprintf(&b, "%s%s\n", headerPrefix, meta)
+	for _, e := range h.Entities {
+		line, _ := json.Marshal(e)
+		fmt.Fprintf(&b, "%s%s\n", headerEntityPrefix, line)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// ParseHeader reads the header of a migration. ok is false for migrations
+// without one, e.g. written by hand or by an older migrateme.
+func ParseHeader(content []byte) (h Header, ok bool, err error) {
+	sc := bufio.NewScanner(bytes.NewReader(content))
+	sc.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(text, headerPrefix):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(text, headerPrefix)), &h); err != nil {
+				return Header{}, false, fmt.Errorf("line %d: invalid migrateme header: %w", line, err)
+			}
+			ok = true
+		case strings.HasPrefix(text, headerEntityPrefix):
+			var e HeaderEntity
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(text, headerEntityPrefix)), &e); err != nil {
+				return Header{}, false, fmt.Errorf("line %d: invalid migrateme header: %w", line, err)
+			}
+			h.Entities = append(h.Entities, e)
+		case text == "" || strings.HasPrefix(text, "--"):
+			// The header is among the leading comments.
+		default:
+			return h, ok, nil
+		}
+	}
+	return h, ok, sc.Err()
+}
+
+// migrationHeader describes a migration making changes to reach schemas.
+func (m *Migrator) migrationHeader(changes []TableChange, schemas map[string]migrate.TableSchema) Header {
+	entities := m.config.EntityByTable()
+	h := Header{
+		Version:   version.String(),
+		Generator: "generate",
+		Registry:  registryChecksum(schemas),
+	}
+	for _, change := range changes {
+		he := HeaderEntity{Table: change.TableName}
+		if s, ok := schemas[change.TableName]; ok {
+			he.Schema = schemaChecksum(s)
+			if e, ok := entities[change.TableName]; ok {
+				he.Struct = qualifiedStruct(e)
+				he.File, he.Line = relativePath(e.FilePath), e.Line
+			}
+		}
+		h.Entities = append(h.Entities, he)
+	}
+	return h
+}
+
+// schemaChecksum identifies a table schema. Source positions are not part
+// of it, so moving a field does not change it.
+func schemaChecksum(s migrate.TableSchema) string {
+	data, _ := json.Marshal(s)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func registryChecksum(schemas map[string]migrate.TableSchema) string {
+	tables := make([]string, 0, len(schemas))
+	for table := range schemas {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	h := sha256.New()
+	for _, table := range tables {
+		fmt.Fprintf(h, "%s %s\n", table, schemaChecksum(schemas[table]))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func qualifiedStruct(e migrate.EntityInfo) string {
+	if e.PackageName == "" {
+		return e.StructName
+	}
+	return e.PackageName + "." + e.StructName
+}
+
+// relativePath makes an entity path relative to the working directory, so
+// headers do not depend on where the repository is checked out.
+func relativePath(path string) string {
+	if path == "" || !filepath.IsAbs(path) {
+		return filepath.ToSlash(path)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(path)
+}
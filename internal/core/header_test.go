@@ -0,0 +1,110 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestHeader_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	h := Header{
+		Version:   "v1.4.0",
+		Generator: "generate",
+		Registry:  "0123456789abcdef",
+		Entities: []HeaderEntity{
+			{Table: "users", Struct: "domain.User", File: "domain/user.go", Line: 12, Schema: "fedcba9876543210"},
+			{Table: "legacy"},
+		},
+	}
+	content := "-- Owners: core\n\n" + h.String() + "BEGIN;\n-- migrateme:header {\"version\":\"ignored\"}\nCOMMIT;\n"
+
+	got, ok, err := ParseHeader([]byte(content))
+	if err != nil || !ok {
+		t.Fatalf("ParseHeader: ok=%v err=%v", ok, err)
+	}
+	if got.Version != h.Version || got.Registry != h.Registry || len(got.Entities) != 2 || got.Entities[0] != h.Entities[0] {
+		t.Errorf("ParseHeader = %+v, want %+v", got, h)
+	}
+
+	if _, ok, err := ParseHeader([]byte("BEGIN;\nSELECT 1;\nCOMMIT;\n")); ok || err != nil {
+		t.Errorf("migration without header: ok=%v err=%v", ok, err)
+	}
+	if _, _, err := ParseHeader([]byte("-- migrateme:header {not json\n")); err == nil {
+		t.Error("expected an error for a malformed header")
+	}
+}
+
+func TestSchemaChecksum_IgnoresPositions(t *testing.T) {
+	t.Parallel()
+
+	s := migrate.TableSchema{TableName: "users", Columns: []migrate.ColumnMeta{
+		{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true}, FilePath: "a.go", Line: 3},
+	}}
+	moved := s
+	moved.Columns = []migrate.ColumnMeta{s.Columns[0]}
+	moved.Columns[0].Line = 30
+	if schemaChecksum(s) != schemaChecksum(moved) {
+		t.Error("moving a field changed the checksum")
+	}
+	changed := s
+	changed.Columns = []migrate.ColumnMeta{s.Columns[0]}
+	changed.Columns[0].Attrs.PgType = "bigint"
+	if schemaChecksum(s) == schemaChecksum(changed) {
+		t.Error("changing a column type kept the checksum")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	users := migrate.TableSchema{TableName: "users", Columns: []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid"}}}}
+	orders := migrate.TableSchema{TableName: "orders", Columns: []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint"}}}}
+	oldOrders := orders
+	oldOrders.Columns = []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "integer"}}}
+
+	header := func(schemas ...migrate.TableSchema) string {
+		h := Header{Version: "devel", Generator: "generate"}
+		for _, s := range schemas {
+			h.Entities = append(h.Entities, HeaderEntity{Table: s.TableName, Struct: "domain.X", Schema: schemaChecksum(s)})
+		}
+		return h.String()
+	}
+
+	cfg := config.Default()
+	cfg.Registry = migrate.SchemaRegistry{
+		"users":  func(string) migrate.TableSchema { return users },
+		"orders": func(string) migrate.TableSchema { return orders },
+		"tags":   func(string) migrate.TableSchema { return migrate.TableSchema{TableName: "tags"} },
+	}
+	m := NewMigrator(cfg, nil)
+	m.SetMigrationsFS(fstest.MapFS{
+		"0001__init.up.sql":   {Data: []byte(header(users, oldOrders) + "SELECT 1;")},
+		"0001__init.down.sql": {Data: []byte("SELECT -1;")},
+		"0002__hand.up.sql":   {Data: []byte("SELECT 2;")},
+		"0002__hand.down.sql": {Data: []byte("SELECT -2;")},
+	})
+
+	result, err := m.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Migrations) != 2 || result.Migrations[0].Header == nil || result.Migrations[1].Header != nil {
+		t.Fatalf("migrations = %+v", result.Migrations)
+	}
+	var got []string
+	for _, e := range result.Entities {
+		got = append(got, e.Table+":"+e.Status+":"+e.Migration)
+	}
+	want := "orders:changed:0001__init tags:untracked: users:current:0001__init"
+	if strings.Join(got, " ") != want {
+		t.Errorf("entities = %q, want %q", strings.Join(got, " "), want)
+	}
+	if changed := result.Changed(); len(changed) != 1 || changed[0].Table != "orders" {
+		t.Errorf("Changed() = %+v", changed)
+	}
+}
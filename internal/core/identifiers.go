@@ -0,0 +1,83 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	schema2 "github.com/amr0ny/migrateme/pkg/schema"
+)
+
+// checkIdentifiers reports table, column and constraint names that Postgres
+// would truncate, and names that are reserved words. Codes ignored on the
+// table or column are skipped.
+func (m *Migrator) checkIdentifiers(s migrate.TableSchema) []diagnostics.Diagnostic {
+	var found []diagnostics.Diagnostic
+	report := func(ignore []string, d diagnostics.Diagnostic) {
+		if diagnostics.Ignored(ignore, d.Code) || diagnostics.Ignored(s.Ignore, d.Code) {
+			return
+		}
+		m.report(d)
+		found = append(found, d)
+	}
+
+	// subject names the identifier in messages, e.g. `column "user" of table "accounts"`.
+	checkName := func(ignore []string, subject, name, suggestion string) {
+		if len(name) > schema2.MaxIdentifierLength {
+			report(ignore, diagnostics.Errorf(diagnostics.IdentifierTooLong,
+				"%s is %d bytes, Postgres truncates it to %q; use a name of at most %d bytes",
+				subject, len(name), truncateIdent(name), schema2.MaxIdentifierLength))
+		}
+		if schema2.IsReservedWord(name) {
+			report(ignore, diagnostics.Errorf(diagnostics.ReservedIdentifier,
+				"%s is a reserved word; rename it, e.g. to %q", subject, suggestion))
+		}
+	}
+
+	table := s.TableName
+	suggestion := table + "s"
+	if strings.HasSuffix(table, "s") {
+		suggestion = table + "_records"
+	}
+	checkName(nil, fmt.Sprintf("table %q", table), table, suggestion)
+	for _, c := range s.Columns {
+		checkName(c.Ignore, fmt.Sprintf("column %q of table %q", c.ColumnName, table), c.ColumnName,
+			strings.TrimSuffix(table, "s")+"_"+c.ColumnName)
+	}
+	for _, name := range schema2.ConstraintNames(s) {
+		if len(name) > schema2.MaxIdentifierLength {
+			report(nil, diagnostics.Errorf(diagnostics.IdentifierTooLong,
+				"constraint or index name %q of table %s is %d bytes, Postgres truncates it to %q; shorten the table or column names",
+				name, table, len(name), truncateIdent(name)))
+		}
+	}
+	return found
+}
+
+// truncateIdent returns the name Postgres keeps for an over-long identifier,
+// without splitting a multi-byte character.
+func truncateIdent(name string) string {
+	n := schema2.MaxIdentifierLength
+	for n > 0 && n < len(name) && name[n]&0xC0 == 0x80 {
+		n--
+	}
+	return name[:n]
+}
+
+func invalidIdentifiersError(found []diagnostics.Diagnostic) error {
+	return diagnosticsError("invalid identifiers (add // migrate:ignore <code> to the entity or field to keep a name)", found)
+}
+
+// diagnosticsError lists found under summary, one diagnostic per line.
+func diagnosticsError(summary string, found []diagnostics.Diagnostic) error {
+	var b strings.Builder
+	b.WriteString(summary)
+	b.WriteByte(':')
+	for _, d := range found {
+		b.WriteString("\n  ")
+		b.WriteString(d.String())
+	}
+	return errors.New(b.String())
+}
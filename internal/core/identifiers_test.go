@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestGenerateMigrationSQL_InvalidIdentifiers(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 70)
+	schemas := map[string]migrate.TableSchema{
+		"accounts": {
+			TableName: "accounts",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+				{ColumnName: "user", Idx: 1, Attrs: migrate.ColumnAttributes{PgType: "text"}},
+				{ColumnName: long, Idx: 2, Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			},
+		},
+	}
+
+	m := &Migrator{config: &config.Config{}}
+	_, err := m.generateMigrationSQL(context.Background(), staticFetcher{}, []string{"accounts"}, schemas, discardSink{}, GenerateOptions{Plan: recordingDiffs{}})
+	if err == nil {
+		t.Fatal("expected an error for invalid identifiers")
+	}
+	for _, want := range []string{string(diagnostics.ReservedIdentifier), string(diagnostics.IdentifierTooLong), `"account_user"`, strings.Repeat("x", 63)} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestGenerateMigrationSQL_IgnoredIdentifier(t *testing.T) {
+	t.Parallel()
+
+	schemas := map[string]migrate.TableSchema{
+		"accounts": {
+			TableName: "accounts",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+				{ColumnName: "user", Idx: 1, Ignore: []string{string(diagnostics.ReservedIdentifier)}, Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			},
+		},
+	}
+
+	m := &Migrator{config: &config.Config{}}
+	changes, err := m.generateMigrationSQL(context.Background(), staticFetcher{}, []string{"accounts"}, schemas, discardSink{}, GenerateOptions{Plan: recordingDiffs{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(changes))
+	}
+}
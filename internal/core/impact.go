@@ -0,0 +1,158 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// Lock levels taken by migration statements, strongest first.
+const (
+	LockAccessExclusive      = "ACCESS EXCLUSIVE"
+	LockShareRowExclusive    = "SHARE ROW EXCLUSIVE"
+	LockShare                = "SHARE"
+	LockShareUpdateExclusive = "SHARE UPDATE EXCLUSIVE"
+	LockRowExclusive         = "ROW EXCLUSIVE"
+)
+
+// StatementImpact is what applying a statement costs the table it changes.
+type StatementImpact struct {
+	Statement string `json:"statement"`
+	// Lock is the lock taken on the table; empty for statements on tables
+	// nobody uses yet, e.g. CREATE TABLE.
+	Lock string `json:"lock,omitempty"`
+	// Rewrite means every row is written again, holding Lock throughout.
+	Rewrite bool `json:"rewrite,omitempty"`
+	// Scan means every row is read, e.g. to validate a constraint, holding
+	// Lock throughout.
+	Scan bool   `json:"scan,omitempty"`
+	Note string `json:"note,omitempty"`
+}
+
+// Blocks reports whether the statement blocks reads or writes of the table
+// for as long as it runs.
+func (s StatementImpact) Blocks() bool {
+	return s.Lock != "" && s.Lock != LockShareUpdateExclusive && s.Lock != LockRowExclusive
+}
+
+// TableImpact estimates the downtime risk of migrating a table.
+type TableImpact struct {
+	// Rows is the planner's estimate of the rows in the table, -1 when the
+	// table has never been analyzed.
+	Rows       int64             `json:"rows"`
+	Statements []StatementImpact `json:"statements"`
+}
+
+// Risky reports whether a blocking statement reads or writes every row,
+// so that the lock is held for a time growing with the table.
+func (t *TableImpact) Risky() bool {
+	for _, s := range t.Statements {
+		if s.Blocks() && (s.Rewrite || s.Scan) {
+			return true
+		}
+	}
+	return false
+}
+
+// rowEstimator is implemented by schema.Fetcher. Without it, row counts are
+// reported as unknown.
+type rowEstimator interface {
+	EstimateRows(ctx context.Context, table string) (int64, error)
+}
+
+// analyzeImpact classifies the up statements of diff and fetches the row
+// estimate of the table, unless the migration creates it.
+func analyzeImpact(ctx context.Context, fetcher schemaFetcher, table string, changeType ChangeType, diff migrate.TableDiff) (*TableImpact, error) {
+	impact := &TableImpact{Rows: -1, Statements: []StatementImpact{}}
+	if changeType == CreateTable {
+		impact.Rows = 0
+	} else if re, ok := fetcher.(rowEstimator); ok {
+		rows, err := re.EstimateRows(ctx, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate rows of %s: %w", table, err)
+		}
+		impact.Rows = rows
+	}
+	for _, stmt := range append(append([]string{}, diff.Up...), diff.PostUp...) {
+		impact.Statements = append(impact.Statements, AnalyzeStatement(stmt))
+	}
+	return impact, nil
+}
+
+// statementRule maps statements matching re to the impact they have. Rules
+// are tried in order; the first match wins.
+type statementRule struct {
+	re      *regexp.Regexp
+	lock    string
+	rewrite bool
+	scan    bool
+	note    string
+}
+
+// volatileDefault matches defaults that are evaluated per row, which makes
+// ADD COLUMN fill every row instead of storing the default once.
+var volatileDefault = regexp.MustCompile(`(?i)\b(random|gen_random_uuid|uuid_generate_v\d|clock_timestamp|nextval)\s*\(|\b(big|small)?serial\b`)
+
+var statementRules = []statementRule{
+	{re: regexp.MustCompile(`(?is)^CREATE\s+TABLE\b.*\bAS\s+TABLE\b`), lock: LockShare, scan: true,
+		note: "copies the table"},
+	{re: regexp.MustCompile(`(?is)^CREATE\s+(TABLE|EXTENSION|SCHEMA|TYPE)\b`)},
+	{re: regexp.MustCompile(`(?is)^CREATE\s+(UNIQUE\s+)?INDEX\s+CONCURRENTLY\b`), lock: LockShareUpdateExclusive, scan: true,
+		note: "builds the index without blocking writes"},
+	{re: regexp.MustCompile(`(?is)^CREATE\s+(UNIQUE\s+)?INDEX\b`), lock: LockShare, scan: true,
+		note: "blocks writes while the index is built; consider CREATE INDEX CONCURRENTLY"},
+	{re: regexp.MustCompile(`(?is)^DROP\s+INDEX\s+CONCURRENTLY\b`), lock: LockShareUpdateExclusive},
+	{re: regexp.MustCompile(`(?is)^DROP\s+(TABLE|INDEX)\b`), lock: LockAccessExclusive},
+	{re: regexp.MustCompile(`(?is)^INSERT\s+INTO\b.*\bSELECT\b`), lock: LockRowExclusive, rewrite: true,
+		note: "copies every row"},
+	{re: regexp.MustCompile(`(?is)\bALTER\s+COLUMN\s+\S+\s+(SET\s+DATA\s+)?TYPE\b`), lock: LockAccessExclusive, rewrite: true,
+		note: "rewrites the table and its indexes unless the types are binary compatible"},
+	{re: regexp.MustCompile(`(?is)\bALTER\s+COLUMN\s+\S+\s+SET\s+NOT\s+NULL\b`), lock: LockAccessExclusive, scan: true,
+		note: "scans the table to check for NULLs"},
+	{re: regexp.MustCompile(`(?is)\bADD\s+CONSTRAINT\b.*\bNOT\s+VALID\b`), lock: LockShareRowExclusive,
+		note: "existing rows are not checked until VALIDATE CONSTRAINT"},
+	{re: regexp.MustCompile(`(?is)\bADD\s+CONSTRAINT\s+\S+\s+FOREIGN\s+KEY\b`), lock: LockShareRowExclusive, scan: true,
+		note: "blocks writes to both tables while existing rows are checked; consider NOT VALID"},
+	{re: regexp.MustCompile(`(?is)\bADD\s+CONSTRAINT\s+\S+\s+(UNIQUE|PRIMARY\s+KEY)\b`), lock: LockAccessExclusive, scan: true,
+		note: "builds a unique index"},
+	{re: regexp.MustCompile(`(?is)\bADD\s+CONSTRAINT\s+\S+\s+CHECK\b`), lock: LockAccessExclusive, scan: true,
+		note: "scans the table to check existing rows; consider NOT VALID"},
+	{re: regexp.MustCompile(`(?is)\bVALIDATE\s+CONSTRAINT\b`), lock: LockShareUpdateExclusive, scan: true},
+	{re: regexp.MustCompile(`(?is)^ALTER\s+TABLE\b`), lock: LockAccessExclusive},
+}
+
+// AnalyzeStatement tells which lock a statement takes in Postgres and
+// whether it rewrites or scans the table. Statements wrapped in a DO block,
+// as generate writes for idempotent constraints, are analyzed by the
+// statement inside. Unrecognized statements get no lock and a note.
+func AnalyzeStatement(stmt string) StatementImpact {
+	impact := StatementImpact{Statement: stmt}
+	sql := strings.TrimSpace(stmt)
+	if m := doBlockStatement.FindStringSubmatch(sql); m != nil {
+		sql = strings.TrimSpace(m[1])
+	}
+
+	for _, rule := range statementRules {
+		if rule.re.MatchString(sql) {
+			impact.Lock, impact.Rewrite, impact.Scan, impact.Note = rule.lock, rule.rewrite, rule.scan, rule.note
+			break
+		}
+	}
+	if impact.Lock == "" && !strings.HasPrefix(strings.ToUpper(sql), "CREATE") {
+		impact.Note = "not recognized; check its locks by hand"
+	}
+
+	if addColumn.MatchString(sql) && volatileDefault.MatchString(sql) {
+		impact.Rewrite = true
+		impact.Note = "the default is computed per row, so every row is rewritten"
+	}
+	return impact
+}
+
+var (
+	doBlockStatement = regexp.MustCompile(`(?is)^DO\s+\$\$.*\bTHEN\s+(.*?);?\s+END\s+IF`)
+	addColumn        = regexp.MustCompile(`(?is)^ALTER\s+TABLE\b.*\bADD\s+COLUMN\b`)
+)
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestAnalyzeStatement(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		stmt    string
+		lock    string
+		rewrite bool
+		scan    bool
+	}{
+		{stmt: `CREATE TABLE IF NOT EXISTS "users" (id uuid)`},
+		{stmt: `ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "name" text`, lock: LockAccessExclusive},
+		{stmt: `ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "n" bigserial`, lock: LockAccessExclusive, rewrite: true},
+		{stmt: `ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "k" uuid DEFAULT gen_random_uuid()`, lock: LockAccessExclusive, rewrite: true},
+		{stmt: `ALTER TABLE "users" ALTER COLUMN "age" TYPE bigint USING "age"::bigint`, lock: LockAccessExclusive, rewrite: true},
+		{stmt: `ALTER TABLE "users" ALTER COLUMN "age" SET NOT NULL`, lock: LockAccessExclusive, scan: true},
+		{stmt: `ALTER TABLE "users" ALTER COLUMN "age" SET DEFAULT 0`, lock: LockAccessExclusive},
+		{stmt: `CREATE INDEX IF NOT EXISTS "idx" ON "users" ("age")`, lock: LockShare, scan: true},
+		{stmt: `CREATE INDEX CONCURRENTLY "idx" ON "users" ("age")`, lock: LockShareUpdateExclusive, scan: true},
+		{stmt: `ALTER TABLE "posts" ADD CONSTRAINT "fk" FOREIGN KEY ("user_id") REFERENCES "users"("id") NOT VALID`, lock: LockShareRowExclusive},
+		{stmt: `DROP TABLE "users_old"`, lock: LockAccessExclusive},
+		{stmt: `INSERT INTO "users" ("id") SELECT "id" FROM "users_tmp"`, lock: LockRowExclusive, rewrite: true},
+		{
+			stmt: `DO $$ BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_posts_user_id') THEN
+    ALTER TABLE "posts" ADD CONSTRAINT "fk_posts_user_id" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE NO ACTION ON UPDATE NO ACTION;
+  END IF;
+END $$;`,
+			lock: LockShareRowExclusive, scan: true,
+		},
+	}
+	for _, tt := range tests {
+		got := AnalyzeStatement(tt.stmt)
+		if got.Lock != tt.lock || got.Rewrite != tt.rewrite || got.Scan != tt.scan {
+			t.Errorf("AnalyzeStatement(%q) = lock %q, rewrite %v, scan %v; want %q, %v, %v",
+				tt.stmt, got.Lock, got.Rewrite, got.Scan, tt.lock, tt.rewrite, tt.scan)
+		}
+	}
+}
+
+type estimatingFetcher struct {
+	staticFetcher
+	rows map[string]int64
+}
+
+func (f estimatingFetcher) EstimateRows(_ context.Context, table string) (int64, error) {
+	return f.rows[table], nil
+}
+
+func TestGenerateMigrationSQL_Analyze(t *testing.T) {
+	t.Parallel()
+
+	users := testSchemas()["users"]
+	changed := testSchemas()
+	u := changed["users"]
+	u.Columns = append(append([]migrate.ColumnMeta{}, u.Columns...),
+		migrate.ColumnMeta{ColumnName: "email", Idx: 1, Attrs: migrate.ColumnAttributes{PgType: "text", NotNull: true}})
+	changed["users"] = u
+
+	fetcher := estimatingFetcher{staticFetcher: staticFetcher{"users": users}, rows: map[string]int64{"users": 5000}}
+	changes, err := (&Migrator{}).generateMigrationSQL(context.Background(), fetcher, []string{"users", "posts"}, changed, discardSink{}, GenerateOptions{Analyze: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	impacts := map[string]*TableImpact{}
+	for _, c := range changes {
+		impacts[c.TableName] = c.Impact
+	}
+	if impacts["users"] == nil || impacts["users"].Rows != 5000 {
+		t.Fatalf("users impact = %+v, want 5000 rows", impacts["users"])
+	}
+	if impacts["posts"] == nil || impacts["posts"].Rows != 0 {
+		t.Fatalf("posts impact = %+v, want 0 rows for a new table", impacts["posts"])
+	}
+	for _, s := range impacts["users"].Statements {
+		if s.Lock != LockAccessExclusive {
+			t.Errorf("%s: lock %q, want %s", s.Statement, s.Lock, LockAccessExclusive)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/internal/database"
+)
+
+// ImportResult is what ImportHistory recorded.
+type ImportResult struct {
+	// Imported are the migrations recorded as applied.
+	Imported []string `json:"imported"`
+	// Recorded are matching migrations migrateme had already recorded.
+	Recorded []string `json:"recorded,omitempty"`
+	// Unmatched are versions the tool applied that no migration file has.
+	Unmatched []string `json:"unmatched,omitempty"`
+}
+
+// ImportHistory records the migrations another tool applied, read from its
+// history table, as applied by migrateme. Versions are matched against the
+// leading version of the migration file names, so that 000001_users.up.sql
+// (golang-migrate), 20240101120000_users.sql (goose) and V1_1__users.sql
+// (Flyway, version 1.1) keep their versions. No migration SQL is run; with
+// dryRun nothing is recorded.
+func (m *Migrator) ImportHistory(ctx context.Context, tool, table string, dryRun bool) (ImportResult, error) {
+	var result ImportResult
+	foreign, err := m.db.ForeignHistory(ctx, tool, table)
+	if err != nil {
+		return result, fmt.Errorf("failed to read %s history from %s: %w", tool, table, err)
+	}
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return result, fmt.Errorf("failed to list migration files: %w", err)
+	}
+	applied, err := m.db.GetAppliedMigrations(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	appliedSet := make(map[string]bool, len(applied))
+	for _, a := range applied {
+		appliedSet[a] = true
+	}
+
+	matched, unmatched, err := matchForeignHistory(migrations, foreign)
+	if err != nil {
+		return result, err
+	}
+	result.Unmatched = unmatched
+
+	var batch int64
+	for _, match := range matched {
+		if appliedSet[match.mig.Base] {
+			result.Recorded = append(result.Recorded, match.mig.Base)
+			continue
+		}
+		result.Imported = append(result.Imported, match.mig.Base)
+		if dryRun {
+			continue
+		}
+		if batch == 0 {
+			if batch, err = m.db.NextBatch(ctx); err != nil {
+				return result, fmt.Errorf("failed to number the import: %w", err)
+			}
+		}
+		content, err := m.readMigration(match.mig, true)
+		if err != nil {
+			return result, fmt.Errorf("read %s: %w", match.mig.path(true), err)
+		}
+		err = m.db.RecordMigration(ctx, database.MigrationRecord{
+			Name: match.mig.Base, Checksum: checksum(content), Batch: batch, AppliedAt: match.from.AppliedAt,
+		})
+		if err != nil {
+			return result, fmt.Errorf("record migration %s: %w", match.mig.Base, err)
+		}
+	}
+	return result, nil
+}
+
+type foreignMatch struct {
+	mig  migration
+	from database.ForeignMigration
+}
+
+// matchForeignHistory pairs the migrations with the foreign history, in
+// migration order. A baseline matches every migration up to its version.
+func matchForeignHistory(migrations []migration, foreign []database.ForeignMigration) ([]foreignMatch, []string, error) {
+	byVersion := make(map[string]migration, len(migrations))
+	for _, mig := range migrations {
+		v, ok := foreignVersion(mig.Base)
+		if !ok {
+			continue
+		}
+		if other, ok := byVersion[v]; ok {
+			return nil, nil, fmt.Errorf("migrations %s and %s share version %s", other.Base, mig.Base, v)
+		}
+		byVersion[v] = mig
+	}
+
+	found := make(map[string]foreignMatch)
+	var unmatched []string
+	for _, f := range foreign {
+		v := normalizeForeignVersion(f.Version)
+		if f.Baseline {
+			for mv, mig := range byVersion {
+				if !lessForeignVersion(v, mv) {
+					found[mig.Base] = foreignMatch{mig: mig, from: database.ForeignMigration{Version: mv, AppliedAt: f.AppliedAt}}
+				}
+			}
+		}
+		mig, ok := byVersion[v]
+		if !ok {
+			unmatched = append(unmatched, f.Version)
+			continue
+		}
+		found[mig.Base] = foreignMatch{mig: mig, from: f}
+	}
+
+	matched := make([]foreignMatch, 0, len(found))
+	for _, match := range found {
+		matched = append(matched, match)
+	}
+	sort.Slice(matched, func(i, j int) bool { return lessVersion(matched[i].mig.Base, matched[j].mig.Base) })
+	return matched, unmatched, nil
+}
+
+// foreignVersion returns the version a migration file name starts with,
+// normalized: a Flyway "V" prefix is dropped and the parts of a dotted
+// version, written with underscores in file names, lose leading zeros.
+func foreignVersion(base string) (string, bool) {
+	name := base
+	if len(name) > 1 && (name[0] == 'V' || name[0] == 'v') && name[1] >= '0' && name[1] <= '9' {
+		name = name[1:]
+	}
+	end := 0
+	for end < len(name) && (name[end] >= '0' && name[end] <= '9' || name[end] == '_' || name[end] == '.') {
+		// A double underscore ends a Flyway or migrateme version, a single
+		// one followed by a letter ends a golang-migrate or goose one.
+		if name[end] == '_' && (end+1 >= len(name) || name[end+1] < '0' || name[end+1] > '9') {
+			break
+		}
+		end++
+	}
+	if end == 0 {
+		return "", false
+	}
+	return normalizeForeignVersion(strings.ReplaceAll(name[:end], "_", ".")), true
+}
+
+func normalizeForeignVersion(v string) string {
+	parts := strings.Split(v, ".")
+	for i, p := range parts {
+		if p = strings.TrimLeft(p, "0"); p == "" {
+			p = "0"
+		}
+		parts[i] = p
+	}
+	return strings.Join(parts, ".")
+}
+
+// lessForeignVersion compares normalized versions part by part by value.
+func lessForeignVersion(a, b string) bool {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] == pb[i] {
+			continue
+		}
+		if len(pa[i]) != len(pb[i]) {
+			return len(pa[i]) < len(pb[i])
+		}
+		return pa[i] < pb[i]
+	}
+	return len(pa) < len(pb)
+}
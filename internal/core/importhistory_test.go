@@ -0,0 +1,70 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/database"
+)
+
+func TestForeignVersion(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"000001_create_users":            "1",
+		"20240101120000_add_orders":      "20240101120000",
+		"V1_1__add_orders":               "1.1",
+		"v2__drop_legacy":                "2",
+		"0003__add_index":                "3",
+		"20240115120000__profile__a1b2c": "20240115120000",
+		"init":                           "",
+	}
+	for base, want := range cases {
+		got, ok := foreignVersion(base)
+		if ok != (want != "") || got != want {
+			t.Errorf("foreignVersion(%q) = %q, %v, want %q", base, got, ok, want)
+		}
+	}
+}
+
+func TestMatchForeignHistory(t *testing.T) {
+	t.Parallel()
+
+	migrations := []migration{{Base: "000001_users"}, {Base: "000002_orders"}, {Base: "000010_items"}}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	names := func(matched []foreignMatch) []string {
+		var out []string
+		for _, m := range matched {
+			out = append(out, m.mig.Base)
+		}
+		return out
+	}
+
+	// golang-migrate only records the current version.
+	matched, unmatched, err := matchForeignHistory(migrations, []database.ForeignMigration{{Version: "2", Baseline: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"000001_users", "000002_orders"}; !reflect.DeepEqual(names(matched), want) || unmatched != nil {
+		t.Fatalf("baseline matched %v, unmatched %v, want %v", names(matched), unmatched, want)
+	}
+
+	// goose and Flyway record every version.
+	matched, unmatched, err = matchForeignHistory(migrations, []database.ForeignMigration{
+		{Version: "10", AppliedAt: at}, {Version: "1", AppliedAt: at}, {Version: "7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"000001_users", "000010_items"}; !reflect.DeepEqual(names(matched), want) {
+		t.Fatalf("matched %v, want %v", names(matched), want)
+	}
+	if !matched[0].from.AppliedAt.Equal(at) {
+		t.Errorf("lost the time the migration was applied: %v", matched[0].from.AppliedAt)
+	}
+	if !reflect.DeepEqual(unmatched, []string{"7"}) {
+		t.Errorf("unmatched %v, want [7]", unmatched)
+	}
+}
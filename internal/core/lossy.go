@@ -0,0 +1,23 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/schema"
+)
+
+// LossyChangeError is returned by Generate for column type changes that may
+// lose data and have neither a using= tag expression nor AllowLossy.
+type LossyChangeError struct {
+	Changes []schema.TypeChange
+}
+
+func (e *LossyChangeError) Error() string {
+	var b strings.Builder
+	b.WriteString("column type changes may lose data; add a using= tag expression or pass --allow-lossy:")
+	for _, c := range e.Changes {
+		fmt.Fprintf(&b, "\n  %s.%s: %s -> %s (%s)", c.Table, c.Column, c.From, c.To, c.Kind)
+	}
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Migration file formats for generate.
+const (
+	// FormatSplit writes <name>.up.sql and <name>.down.sql.
+	FormatSplit = "split"
+	// FormatSingle writes one <name>.sql with -- +migrate Up/Down sections.
+	FormatSingle = "single"
+)
+
+// migration is one migration found in the migrations directory, stored
+// either as split up/down files or as a single file with section markers.
+type migration struct {
+	Base string
+	// File is the single file holding both sections; empty for split files.
+	File string
+}
+
+func (mig migration) path(up bool) string {
+	switch {
+	case mig.File != "":
+		return mig.File
+	case up:
+		return mig.Base + ".up.sql"
+	default:
+		return mig.Base + ".down.sql"
+	}
+}
+
+// listMigrations returns the migrations in the migrations directory in
+// version order. A single-file migration is any .sql file that is not an up
+// or down file.
+func (m *Migrator) listMigrations() ([]migration, error) {
+	migrations, err := m.scanMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkVersionCollisions(migrations); err != nil {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+func (m *Migrator) scanMigrations() ([]migration, error) {
+	files, err := m.getMigrationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]string)
+	var migrations []migration
+	for _, file := range files {
+		var mig migration
+		switch {
+		case strings.HasSuffix(file, ".down.sql"):
+			continue
+		case strings.HasSuffix(file, ".up.sql"):
+			mig = migration{Base: strings.TrimSuffix(file, ".up.sql")}
+		default:
+			mig = migration{Base: strings.TrimSuffix(file, ".sql"), File: file}
+		}
+		if other, ok := seen[mig.Base]; ok {
+			return nil, fmt.Errorf("migration %s is defined twice: %s and %s", mig.Base, other, file)
+		}
+		seen[mig.Base] = file
+		migrations = append(migrations, mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return lessVersion(migrations[i].Base, migrations[j].Base) })
+	return migrations, nil
+}
+
+// readMigration returns the raw up or down SQL of mig. A missing down file
+// is reported as fs.ErrNotExist; a single file without a Down section yields
+// empty content.
+func (m *Migrator) readMigration(mig migration, up bool) ([]byte, error) {
+	content, err := fs.ReadFile(m.migrationsFS(), mig.path(up))
+	if err != nil || mig.File == "" {
+		return content, err
+	}
+
+	upSQL, downSQL, err := parseSections(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", mig.File, err)
+	}
+	if up {
+		return upSQL, nil
+	}
+	return downSQL, nil
+}
+
+var sectionMarkerRE = regexp.MustCompile(`(?i)^--\s*\+migrate\s+(up|down)\b`)
+
+// parseSections splits a single-file migration at its -- +migrate Up and
+// -- +migrate Down markers. Only comments may precede the Up marker.
+func parseSections(content []byte) (up, down []byte, err error) {
+	var sections [2]bytes.Buffer
+	var seen [2]bool
+	current := -1
+
+	sc := bufio.NewScanner(bytes.NewReader(content))
+	sc.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if m := sectionMarkerRE.FindStringSubmatch(strings.TrimSpace(text)); m != nil {
+			current = 0
+			if strings.EqualFold(m[1], "down") {
+				current = 1
+			}
+			if seen[current] {
+				return nil, nil, fmt.Errorf("line %d: duplicate -- +migrate %s marker", line, m[1])
+			}
+			seen[current] = true
+			continue
+		}
+		if current < 0 {
+			if trimmed := strings.TrimSpace(text); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return nil, nil, fmt.Errorf("line %d: statement before the -- +migrate Up marker", line)
+			}
+			continue
+		}
+		sections[current].WriteString(text)
+		sections[current].WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	if !seen[0] {
+		return nil, nil, errors.New("missing -- +migrate Up marker")
+	}
+	return sections[0].Bytes(), sections[1].Bytes(), nil
+}
+
+// joinMigration writes the split up and down files into a single file with
+// section markers at path and removes them.
+func joinMigration(upPath, downPath, path string) error {
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range []struct{ marker, path string }{
+		{"-- +migrate Up\n", upPath},
+		{"\n-- +migrate Down\n", downPath},
+	} {
+		if err := appendFile(dst, part.marker, part.path); err != nil {
+			dst.Close()
+			os.Remove(path)
+			return err
+		}
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	os.Remove(upPath)
+	os.Remove(downPath)
+	return nil
+}
+
+func appendFile(dst io.Writer, prefix, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if _, err := io.WriteString(dst, prefix); err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
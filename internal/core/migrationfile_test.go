@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+)
+
+func TestParseSections(t *testing.T) {
+	t.Parallel()
+
+	up, down, err := parseSections([]byte("-- leading comment\n\n-- +migrate Up\nCREATE TABLE a (id int);\n\n-- +migrate Down\nDROP TABLE a;\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(up)); got != "CREATE TABLE a (id int);" {
+		t.Errorf("up = %q", got)
+	}
+	if got := strings.TrimSpace(string(down)); got != "DROP TABLE a;" {
+		t.Errorf("down = %q", got)
+	}
+}
+
+func TestParseSections_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"missing up":          "-- +migrate Down\nDROP TABLE a;\n",
+		"statement before up": "SELECT 1;\n-- +migrate Up\nSELECT 2;\n",
+		"duplicate up":        "-- +migrate Up\nSELECT 1;\n-- +migrate Up\nSELECT 2;\n",
+	}
+	for name, content := range cases {
+		if _, _, err := parseSections([]byte(content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestListMigrations_MixesFormats(t *testing.T) {
+	t.Parallel()
+
+	m := &Migrator{}
+	m.SetMigrationsFS(fstest.MapFS{
+		"001__a.up.sql":   {Data: []byte("SELECT 1;")},
+		"001__a.down.sql": {Data: []byte("SELECT -1;")},
+		"002__b.sql":      {Data: []byte("-- +migrate Up\nSELECT 2;\n-- +migrate Down\nSELECT -2;\n")},
+	})
+
+	migrations, err := m.listMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Base != "001__a" || migrations[1].Base != "002__b" {
+		t.Fatalf("listMigrations = %+v", migrations)
+	}
+
+	down, err := m.readMigration(migrations[1], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(down)) != "SELECT -2;" {
+		t.Errorf("down section = %q", down)
+	}
+}
+
+func TestListMigrations_RejectsDuplicates(t *testing.T) {
+	t.Parallel()
+
+	m := &Migrator{}
+	m.SetMigrationsFS(fstest.MapFS{
+		"001__a.up.sql": {Data: []byte("SELECT 1;")},
+		"001__a.sql":    {Data: []byte("-- +migrate Up\nSELECT 1;\n")},
+	})
+
+	if _, err := m.listMigrations(); err == nil {
+		t.Fatal("expected an error for a migration defined twice")
+	}
+}
+
+func TestRun_SingleFileMigration(t *testing.T) {
+	t.Parallel()
+
+	exec := &fakeExecutor{}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{
+		"001__a.sql": {Data: []byte("-- +migrate Up\nSELECT 1;\n-- +migrate Down\nSELECT -1;\n")},
+	})
+
+	if _, err := m.Run(context.Background(), RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range exec.execs {
+		if strings.Contains(q, "SELECT -1;") {
+			t.Fatalf("down section was applied: %q", exec.execs)
+		}
+	}
+}
+
+func TestJoinMigration(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	upPath := filepath.Join(dir, "x.up.sql")
+	downPath := filepath.Join(dir, "x.down.sql")
+	os.WriteFile(upPath, []byte("SELECT 1;\n"), 0o644)
+	os.WriteFile(downPath, []byte("SELECT -1;\n"), 0o644)
+
+	path := filepath.Join(dir, "x.sql")
+	if err := joinMigration(upPath, downPath, path); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, down, err := parseSections(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(up)) != "SELECT 1;" || strings.TrimSpace(string(down)) != "SELECT -1;" {
+		t.Errorf("joined file = %q", content)
+	}
+	if _, err := os.Stat(upPath); !os.IsNotExist(err) {
+		t.Error("split up file was not removed")
+	}
+}
@@ -2,44 +2,158 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/amr0ny/migrateme/internal/database"
 	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/hooks"
 	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/policy"
 	schema2 "github.com/amr0ny/migrateme/pkg/schema"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
-	"time"
 )
 
 type Migrator struct {
 	config *config.Config
 	db     *database.DB
+	diag   diagnostics.Reporter
+
+	// fsys, when set, is read instead of the configured migrations directory.
+	fsys fs.FS
+
+	hooks       []hooks.Hook
+	hooksLoaded bool
+
+	// policy is compiled from config on the first Generate; nil when no
+	// rules are configured.
+	policy *policy.Policy
+
+	// beginTx opens the transaction of a migration applied in parallel; nil
+	// begins one on the pgx pool.
+	beginTx func(ctx context.Context) (waveTx, error)
+
+	// serverVersion is the server_version_num read by Generate, deciding
+	// which extensions a table needs; 0 when unknown.
+	serverVersion int
 }
 
 func NewMigrator(cfg *config.Config, db *database.DB) *Migrator {
 	return &Migrator{
 		config: cfg,
 		db:     db,
+		diag:   cfg.Reporter(),
+	}
+}
+
+// SetMigrationsFS makes the migrator read migration files from fsys (e.g. an
+// embed.FS) instead of the migrations directory. Generate still writes to disk.
+func (m *Migrator) SetMigrationsFS(fsys fs.FS) {
+	m.fsys = fsys
+}
+
+// AddHook registers a hook that runs on every generated table migration,
+// after the hooks loaded from config plugins.
+func (m *Migrator) AddHook(h hooks.Hook) {
+	m.hooks = append(m.hooks, h)
+}
+
+func (m *Migrator) loadHooks() error {
+	if m.hooksLoaded || m.config == nil {
+		return nil
+	}
+	var loaded []hooks.Hook
+	for _, path := range m.config.Hooks.Plugins {
+		h, err := hooks.Load(path)
+		if err != nil {
+			return err
+		}
+		loaded = append(loaded, h)
+	}
+	m.hooks = append(loaded, m.hooks...)
+	m.hooksLoaded = true
+	return nil
+}
+
+func (m *Migrator) loadPolicy() error {
+	if m.policy != nil || m.config == nil || m.config.Policy.Empty() {
+		return nil
+	}
+	p, err := policy.Compile(m.config.Policy)
+	if err != nil {
+		return fmt.Errorf("invalid policy: %w", err)
+	}
+	m.policy = p
+	return nil
+}
+
+func (m *Migrator) migrationsFS() fs.FS {
+	if m.fsys != nil {
+		return m.fsys
+	}
+	return os.DirFS(m.config.GetMigrationsDir())
+}
+
+func (m *Migrator) migrationFormat() string {
+	if m.config == nil || m.config.Migrations.Format == "" {
+		return FormatSplit
+	}
+	return m.config.Migrations.Format
+}
+
+func (m *Migrator) report(d diagnostics.Diagnostic) {
+	if m.diag != nil {
+		m.diag.Report(d)
 	}
 }
 
 type GenerateOptions struct {
 	MigrationName string
 	DryRun        bool
+
+	// Plan, when set, receives each table diff as soon as it is computed.
+	Plan PlanWriter
+
+	// Progress, when set, is called after every processed table.
+	Progress func(done, total int, table string)
+
+	// Review, when set, is called with every table's final diff before it is
+	// written. It returns the diff to write, possibly edited, and whether to
+	// keep the table at all. An error aborts generation.
+	Review func(change TableChange, diff migrate.TableDiff) (migrate.TableDiff, bool, error)
+
+	// AllowLossy generates type changes that may lose data even without a
+	// using= expression. Otherwise they fail with a *LossyChangeError.
+	AllowLossy bool
+
+	// Analyze sets TableChange.Impact: the locks the statements take, which
+	// ones rewrite or scan the table, and how many rows it has.
+	Analyze bool
 }
 
 type GenerateResult struct {
-	CreatedFiles []string
-	Changes      []TableChange
+	CreatedFiles []string      `json:"created_files"`
+	Changes      []TableChange `json:"changes"`
+
+	// SchemaFile is the path of the schema file written with
+	// migrations.emit_schema_file.
+	SchemaFile string `json:"schema_file,omitempty"`
 }
 
 type TableChange struct {
-	TableName string
-	Type      ChangeType
-	Details   string
+	TableName string     `json:"table"`
+	Owner     string     `json:"owner,omitempty"`
+	Type      ChangeType `json:"type"`
+	Details   string     `json:"details,omitempty"`
+
+	// Extensions the table depends on; they are created ahead of the migration.
+	Extensions []string `json:"extensions,omitempty"`
+
+	// Impact is set when generating with GenerateOptions.Analyze.
+	Impact *TableImpact `json:"impact,omitempty"`
 }
 
 type ChangeType string
@@ -51,134 +165,408 @@ const (
 	DropColumns      ChangeType = "drop_columns"
 	ModifyColumns    ChangeType = "modify_columns"
 	AlterConstraints ChangeType = "alter_constraints"
+	RebuildTable     ChangeType = "rebuild_table"
 )
 
+// schemaFetcher is the part of schema.Fetcher used during generation.
+type schemaFetcher interface {
+	Fetch(ctx context.Context, table string) (migrate.TableSchema, error)
+}
+
+// referenceFetcher is implemented by schema.Fetcher. Rebuilding a table with
+// a fetcher lacking it assumes no other table references it.
+type referenceFetcher interface {
+	References(ctx context.Context, table string) ([]schema2.Reference, error)
+}
+
+// tableSink receives generated statements; migrationSink implements it.
+type tableSink interface {
+	WriteTable(change TableChange, diff migrate.TableDiff) error
+}
+
+// generateLockName identifies the advisory lock that serializes generate runs
+// against the same database.
+const generateLockName = "migrateme:generate"
+
 func (m *Migrator) Generate(ctx context.Context, opts GenerateOptions) (*GenerateResult, error) {
+	if m.db.Pool == nil {
+		return nil, fmt.Errorf("generating migrations needs a pgx pool to read the live schema")
+	}
+	if !opts.DryRun {
+		lock, err := m.db.TryLock(ctx, generateLockName)
+		if errors.Is(err, database.ErrLocked) {
+			return nil, fmt.Errorf("another generate is already running against this database, try again once it finishes")
+		} else if err != nil {
+			return nil, err
+		}
+		defer lock.Release(context.WithoutCancel(ctx))
+	}
+
 	if hasUnapplied, err := m.hasUnappliedMigrations(ctx); err != nil {
 		return nil, fmt.Errorf("failed to check for unapplied migrations: %w", err)
 	} else if hasUnapplied {
 		return nil, fmt.Errorf("there are unapplied migrations. Please run 'migrate run' before generating new migrations")
 	}
+	version, err := m.db.ServerVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server version: %w", err)
+	}
+	m.serverVersion = version
+
+	switch m.migrationFormat() {
+	case FormatSplit, FormatSingle:
+	default:
+		return nil, fmt.Errorf("unknown migrations format %q, expected %q or %q", m.config.Migrations.Format, FormatSplit, FormatSingle)
+	}
+	if _, err := m.namingScheme(); err != nil {
+		return nil, err
+	}
 
 	if err := os.MkdirAll(m.config.GetMigrationsDir(), 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create migrations directory: %w", err)
 	}
+	if !opts.DryRun {
+		unlock, err := lockDir(m.config.GetMigrationsDir())
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
 
-	schemaFetcher := schema2.NewFetcher(m.db.Pool)
-	newSchemas, oldSchemas, dependencyGraph, err := m.buildSchemaDependencies(ctx, schemaFetcher)
-	if err != nil {
+	if err := m.loadHooks(); err != nil {
 		return nil, err
 	}
-
-	sortedTables, err := topologicalSort(dependencyGraph, getTableNames(newSchemas))
-	if err != nil {
-		return nil, fmt.Errorf("failed to sort tables topologically: %w", err)
+	if err := m.loadPolicy(); err != nil {
+		return nil, err
 	}
 
-	changes, upStatements, downStatements := m.generateMigrationSQL(sortedTables, newSchemas, oldSchemas)
-	if len(upStatements) == 0 {
-		return &GenerateResult{
-			CreatedFiles: []string{},
-			Changes:      changes,
-		}, nil
-	}
+	newSchemas := m.buildSchemas()
 
-	if opts.DryRun {
-		return &GenerateResult{
-			CreatedFiles: []string{},
-			Changes:      changes,
-		}, nil
+	var sink *migrationSink
+	var out tableSink = discardSink{}
+	if !opts.DryRun {
+		var err error
+		sink, err = newMigrationSink(m.config.GetMigrationsDir())
+		if err != nil {
+			return nil, err
+		}
+		out = sink
 	}
 
-	createdFiles, err := m.createMigrationFiles(opts.MigrationName, changes, upStatements, downStatements)
+	changes, err := m.generateMigrationSQL(ctx, schema2.NewFetcher(m.db.Pool), getTableNames(newSchemas), newSchemas, out, opts)
 	if err != nil {
+		if sink != nil {
+			sink.Abort()
+		}
 		return nil, err
 	}
 
-	return &GenerateResult{
-		CreatedFiles: createdFiles,
+	result := &GenerateResult{
+		CreatedFiles: []string{},
 		Changes:      changes,
-	}, nil
+	}
+	if sink == nil {
+		return result, nil
+	}
+	if len(changes) == 0 {
+		sink.Abort()
+	} else {
+		sink.meta = m.migrationHeader(changes, newSchemas).String()
+		if result.CreatedFiles, err = m.createMigrationFiles(sink, opts.MigrationName, changes); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.config.Migrations.EmitSchemaFile {
+		if result.SchemaFile, err = m.writeSchemaFile(newSchemas); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
 }
-func (m *Migrator) buildSchemaDependencies(ctx context.Context, fetcher *schema2.Fetcher) (
-	map[string]migrate.TableSchema,
-	map[string]migrate.TableSchema,
-	map[string][]string,
-	error,
-) {
-	newSchemas := make(map[string]migrate.TableSchema)
-	oldSchemas := make(map[string]migrate.TableSchema)
-	dependencyGraph := make(map[string][]string)
 
+func (m *Migrator) buildSchemas() map[string]migrate.TableSchema {
+	newSchemas := make(map[string]migrate.TableSchema, len(m.config.Registry))
 	for table, builder := range m.config.Registry {
 		newSchemas[table] = builder(table)
-		dependencyGraph[table] = []string{} // Инициализируем для всех таблиц
 	}
+	return newSchemas
+}
 
-	allTables := getTableNames(newSchemas)
-	sort.Strings(allTables)
-
-	for _, table := range allTables {
-		oldSchema, err := fetcher.Fetch(ctx, table)
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("failed to fetch schema for table %s: %w", table, err)
-		}
-		oldSchemas[table] = oldSchema
-
-		newSchema := newSchemas[table]
-		for _, column := range newSchema.Columns {
-			if column.Attrs.ForeignKey != nil {
-				refTable := column.Attrs.ForeignKey.Table
-				if _, exists := m.config.Registry[refTable]; exists {
-					// Добавляем зависимость, даже если это self-reference
-					dependencyGraph[refTable] = append(dependencyGraph[refTable], table)
+// dependencyGraph maps every table to the tables among them that reference
+// it. Self-references (e.g. parent_id to the same table) are left out: they
+// do not constrain the order, and the diff adds them after the table is
+// created.
+func dependencyGraph(schemas map[string]migrate.TableSchema, tables []string) map[string][]string {
+	graph := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		graph[table] = []string{}
+	}
+	for _, table := range tables {
+		for _, column := range schemas[table].Columns {
+			if fk := column.Attrs.ForeignKey; fk != nil {
+				if _, exists := graph[fk.Table]; exists && fk.Table != table {
+					graph[fk.Table] = append(graph[fk.Table], table)
 				}
 			}
 		}
+		// Templates and parents are created before the tables built from
+		// them.
+		for _, base := range append([]string{schemas[table].Like}, schemas[table].Inherits...) {
+			if _, exists := graph[base]; exists && base != table {
+				graph[base] = append(graph[base], table)
+			}
+		}
 	}
-
-	return newSchemas, oldSchemas, dependencyGraph, nil
+	return graph
 }
 
+// generateMigrationSQL fetches, diffs and emits one table at a time, so the
+// number of tables does not affect peak memory usage.
+//
+// Tables are processed in topological order of their foreign keys, so
+// referenced tables are created first. The sink writes down chunks in reverse
+// processing order, so dependents are reverted before the tables they
+// reference.
 func (m *Migrator) generateMigrationSQL(
-	sortedTables []string,
+	ctx context.Context,
+	fetcher schemaFetcher,
+	tables []string,
 	newSchemas map[string]migrate.TableSchema,
-	oldSchemas map[string]migrate.TableSchema,
-) ([]TableChange, []string, []string) {
+	sink tableSink,
+	opts GenerateOptions,
+) ([]TableChange, error) {
+	sortedTables := topologicalSort(dependencyGraph(newSchemas, tables), tables)
+
+	// Names Postgres would truncate or reject in hand-written SQL fail
+	// before anything is fetched.
+	var invalid []diagnostics.Diagnostic
+	for _, table := range sortedTables {
+		invalid = append(invalid, m.checkIdentifiers(newSchemas[table])...)
+	}
+	if len(invalid) > 0 {
+		return nil, invalidIdentifiersError(invalid)
+	}
+
+	// A foreign key to a misspelled table or column fails only at apply time.
+	unknown, err := m.checkForeignKeys(ctx, fetcher, sortedTables, newSchemas)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		return nil, diagnosticsError("foreign keys reference unknown tables or columns", unknown)
+	}
+
 	var changes []TableChange
-	var allUpStatements []string
-	var allDownStatements []string
+	var violations []policy.Violation
+	var lossy []schema2.TypeChange
+	var comments map[string]string
+	if m.policy != nil {
+		comments = m.config.TableComments()
+	}
 
-	diffGenerator := schema2.NewDiffGenerator()
+	diffGenerator := m.newDiffGenerator(sortedTables, newSchemas)
+
+	for i, table := range sortedTables {
+		oldSchema, err := fetcher.Fetch(ctx, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch schema for table %s: %w", table, err)
+		}
 
-	for _, table := range sortedTables {
 		newSchema := migrate.NormalizeSchema(newSchemas[table])
-		oldSchema := migrate.NormalizeSchema(oldSchemas[table])
+		oldSchema = migrate.AlignSerialColumns(migrate.NormalizeSchema(oldSchema), newSchema)
 
-		diff := diffGenerator.DiffSchemas(oldSchema, newSchema)
-		if diff.IsEmpty() {
-			continue
+		if m.policy != nil {
+			violations = append(violations, m.policy.CheckTable(policy.Table{Schema: newSchema, Comment: comments[table]})...)
+		}
+
+		if !opts.AllowLossy {
+			lossy = append(lossy, diffGenerator.UnsafeTypeChanges(oldSchema, newSchema)...)
+		}
+
+		var diff migrate.TableDiff
+		rebuild := m.config != nil && m.config.Migrations.PreserveColumnOrder &&
+			len(oldSchema.Columns) > 0 && len(newSchema.Columns) > 0 &&
+			schema2.ColumnOrderChanged(oldSchema, newSchema)
+		if rebuild {
+			var refs []schema2.Reference
+			if rf, ok := fetcher.(referenceFetcher); ok {
+				if refs, err = rf.References(ctx, table); err != nil {
+					return nil, fmt.Errorf("failed to fetch references to table %s: %w", table, err)
+				}
+			}
+			if diff, err = diffGenerator.RebuildTable(oldSchema, newSchema, refs); err != nil {
+				return nil, err
+			}
+		} else {
+			diff = diffGenerator.DiffSchemas(oldSchema, newSchema)
 		}
+		up, down, err := customSQL(oldSchema, newSchema)
+		if err != nil {
+			return nil, err
+		}
+		diff.Up = append(diff.Up, up...)
+		diff.Down = append(down, diff.Down...)
+		var changeType ChangeType
+		m.reportTypeChanges(oldSchema, newSchema)
+		if !diff.IsEmpty() {
+			changeType = m.analyzeTableChange(oldSchema, newSchema)
+			if rebuild {
+				changeType = RebuildTable
+			}
+			if changeType == CreateTable {
+				diff.Up = append(diff.Up, m.publicationStatements(table)...)
+			}
+
+			// Hooks may rewrite the statements or drop them entirely.
+			diff, err = m.applyHooks(table, changeType, newSchema, diff)
+			if err != nil {
+				return nil, err
+			}
+			if opts.Review != nil && !diff.IsEmpty() {
+				reviewed, keep, err := opts.Review(m.newTableChange(table, changeType, newSchema, diff), diff)
+				if err != nil {
+					return nil, err
+				}
+				if !keep {
+					reviewed = migrate.TableDiff{}
+				}
+				diff = reviewed
+			}
+			if m.policy != nil {
+				violations = append(violations, m.policy.CheckStatements(table, append(diff.Up, diff.PostUp...))...)
+			}
+		}
+		if !diff.IsEmpty() {
+			change := m.newTableChange(table, changeType, newSchema, diff)
+			if opts.Analyze {
+				if change.Impact, err = analyzeImpact(ctx, fetcher, table, changeType, diff); err != nil {
+					return nil, err
+				}
+			}
+			changes = append(changes, change)
+
+			if opts.Plan != nil {
+				if err := opts.Plan.WriteTable(change, diff); err != nil {
+					return nil, fmt.Errorf("failed to write plan: %w", err)
+				}
+			}
+			if err := sink.WriteTable(change, diff); err != nil {
+				return nil, err
+			}
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(i+1, len(sortedTables), table)
+		}
+	}
 
-		changeType := m.analyzeTableChange(oldSchema, newSchema)
-		changes = append(changes, TableChange{
-			TableName: table,
-			Type:      changeType,
-			Details:   fmt.Sprintf("%d changes", len(diff.Up)),
-		})
+	// Every table is checked before failing, so the report is complete.
+	if len(violations) > 0 {
+		return nil, &policy.Error{Violations: violations}
+	}
+	if len(lossy) > 0 {
+		return nil, &LossyChangeError{Changes: lossy}
+	}
+	return changes, nil
+}
 
-		allUpStatements = append(allUpStatements, fmt.Sprintf("-- Changes for table: %s", table))
-		allUpStatements = append(allUpStatements, diff.Up...)
-		allUpStatements = append(allUpStatements, "")
+// newDiffGenerator configures a diff generator for tables processed in
+// sortedTables order. Cycles are broken in sortedTables; a foreign key to a
+// table that comes later can only be added once every table exists.
+func (m *Migrator) newDiffGenerator(sortedTables []string, newSchemas map[string]migrate.TableSchema) *schema2.DiffGenerator {
+	position := make(map[string]int, len(sortedTables))
+	for i, table := range sortedTables {
+		position[table] = i
+	}
+	diffGenerator := schema2.NewDiffGenerator()
+	diffGenerator.DeferForeignKey = func(table string, col migrate.ColumnMeta) bool {
+		ref, ok := position[col.Attrs.ForeignKey.Table]
+		return ok && ref > position[table]
+	}
+	diffGenerator.DeferrableForeignKeys = m.config != nil && m.config.Migrations.DeferrableCycles
+	diffGenerator.AllowNarrowing = m.config != nil && m.config.Migrations.AllowNarrowing
+	diffGenerator.Template = func(table string) (migrate.TableSchema, bool) {
+		tmpl, ok := newSchemas[table]
+		return migrate.NormalizeSchema(tmpl), ok
+	}
+	return diffGenerator
+}
+
+func (m *Migrator) newTableChange(table string, changeType ChangeType, s migrate.TableSchema, diff migrate.TableDiff) TableChange {
+	return TableChange{
+		TableName: table,
+		Owner:     s.Owner,
+		Type:      changeType,
+		Details:   fmt.Sprintf("%d changes", len(diff.Up)),
+
+		Extensions: schema2.RequiredExtensions(s, m.serverVersion),
+	}
+}
+
+// applyHooks runs the registered hooks on a table's diff. A hook may rewrite
+// the statements, drop them entirely, or veto generation with an error.
+func (m *Migrator) applyHooks(table string, changeType ChangeType, s migrate.TableSchema, diff migrate.TableDiff) (migrate.TableDiff, error) {
+	if len(m.hooks) == 0 {
+		return diff, nil
+	}
+	tm, err := hooks.Chain(hooks.TableMigration{
+		Table:  table,
+		Change: string(changeType),
+		Schema: s,
+		Up:     diff.Up,
+		Down:   diff.Down,
+		PostUp: diff.PostUp,
+	}, m.hooks...)
+	if err != nil {
+		return diff, fmt.Errorf("hook failed for table %s: %w", table, err)
+	}
+	return migrate.TableDiff{Up: tm.Up, Down: tm.Down, PostUp: tm.PostUp}, nil
+}
+
+// publicationStatements adds a newly created table to the publications that
+// config assigns it to. Dropping the table removes it from them, so there is
+// nothing to revert.
+func (m *Migrator) publicationStatements(table string) []string {
+	if m.config == nil {
+		return nil
+	}
+	var stmts []string
+	for _, pub := range m.config.PublicationsFor(table) {
+		stmts = append(stmts, schema2.AddTableToPublicationStatement(pub, table))
+	}
+	return stmts
+}
 
-		tableDown := append([]string{fmt.Sprintf("-- Revert changes for table: %s", table)}, diff.Down...)
-		tableDown = append(tableDown, "")
-		allDownStatements = append(tableDown, allDownStatements...)
+func (m *Migrator) reportTypeChanges(old, new migrate.TableSchema) {
+	oldTypes := make(map[string]string, len(old.Columns))
+	for _, c := range old.Columns {
+		oldTypes[c.ColumnName] = c.Attrs.PgType
 	}
 
-	return changes, allUpStatements, allDownStatements
+	for _, c := range new.Columns {
+		from, ok := oldTypes[c.ColumnName]
+		if !ok || !schema2.IsLossyTypeChange(from, c.Attrs.PgType) {
+			continue
+		}
+		// Narrowing changes are left out of the diff unless allowed.
+		d := diagnostics.Warningf(diagnostics.LossyTypeChange,
+			"changing %s.%s from %s to %s may lose data", new.TableName, c.ColumnName, from, c.Attrs.PgType)
+		if schema2.IsNarrowingChange(from, c.Attrs.PgType) && (m.config == nil || !m.config.Migrations.AllowNarrowing) {
+			d = diagnostics.Warningf(diagnostics.NarrowingSkipped,
+				"not narrowing %s.%s from %s to %s; set migrations.allow_narrowing to apply it", new.TableName, c.ColumnName, from, c.Attrs.PgType)
+		}
+		if diagnostics.Ignored(c.Ignore, d.Code) || diagnostics.Ignored(new.Ignore, d.Code) {
+			continue
+		}
+		m.report(d)
+	}
 }
 
+type discardSink struct{}
+
+func (discardSink) WriteTable(TableChange, migrate.TableDiff) error { return nil }
+
 func (m *Migrator) analyzeTableChange(old, new migrate.TableSchema) ChangeType {
 	hasAdded := hasNewColumns(old, new)
 	hasDropped := hasDroppedColumns(old, new)
@@ -208,44 +596,47 @@ func (m *Migrator) analyzeTableChange(old, new migrate.TableSchema) ChangeType {
 	}
 }
 
-func (m *Migrator) createMigrationFiles(
-	migrationName string,
-	changes []TableChange,
-	upStatements, downStatements []string,
-) ([]string, error) {
-	timestamp := time.Now().UTC().Format("20060102150405")
-	suffix := randomHex(4)
-
-	baseName := m.generateMigrationName(timestamp, suffix, migrationName, changes)
-	upPath := filepath.Join(m.config.GetMigrationsDir(), baseName+".up.sql")
-	downPath := filepath.Join(m.config.GetMigrationsDir(), baseName+".down.sql")
-
-	// Записываем файлы
-	upContent := schema2.WrapTx(upStatements)
-	if err := os.WriteFile(upPath, []byte(upContent), 0o644); err != nil {
-		return nil, fmt.Errorf("failed to write up migration: %w", err)
+func (m *Migrator) createMigrationFiles(sink *migrationSink, migrationName string, changes []TableChange) ([]string, error) {
+	if migrationName == "" {
+		changedTables := make([]string, len(changes))
+		for i, change := range changes {
+			changedTables[i] = change.TableName
+		}
+		migrationName = generateAutoName(changedTables)
 	}
 
-	downContent := schema2.WrapTx(downStatements)
-	if err := os.WriteFile(downPath, []byte(downContent), 0o644); err != nil {
-		os.Remove(upPath) // Cleanup on error
-		return nil, fmt.Errorf("failed to write down migration: %w", err)
+	// The name is reserved by creating the file it ends up in.
+	single := m.migrationFormat() == FormatSingle
+	reserved := func(base string) string {
+		if single {
+			return filepath.Join(m.config.GetMigrationsDir(), base+".sql")
+		}
+		up, _ := sink.paths(base)
+		return up
 	}
+	baseName, err := m.claimMigrationName(migrationName, reserved)
+	if err != nil {
+		sink.Abort()
+		return nil, err
+	}
+	upPath, downPath := sink.paths(baseName)
 
-	return []string{baseName + ".up.sql", baseName + ".down.sql"}, nil
-}
-
-func (m *Migrator) generateMigrationName(timestamp, suffix, customName string, changes []TableChange) string {
-	if customName != "" {
-		return fmt.Sprintf("%s__%s__%s", timestamp, normalizeName(customName), suffix)
+	if err := sink.Commit(upPath, downPath); err != nil {
+		os.Remove(reserved(baseName))
+		return nil, err
 	}
 
-	changedTables := make([]string, len(changes))
-	for i, change := range changes {
-		changedTables[i] = change.TableName
+	if single {
+		file := baseName + ".sql"
+		if err := joinMigration(upPath, downPath, filepath.Join(m.config.GetMigrationsDir(), file)); err != nil {
+			os.Remove(upPath)
+			os.Remove(downPath)
+			return nil, fmt.Errorf("failed to write migration: %w", err)
+		}
+		return []string{file}, nil
 	}
 
-	return fmt.Sprintf("%s__%s__%s", timestamp, generateAutoName(changedTables), suffix)
+	return []string{baseName + ".up.sql", baseName + ".down.sql"}, nil
 }
 
 func generateAutoName(changedTables []string) string {
@@ -0,0 +1,290 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration naming schemes. Every scheme starts with a version that orders
+// the migrations, separated from the rest of the name by "__".
+const (
+	// NamingHashed names migrations <timestamp>__<name>__<hash>, so that
+	// parallel branches never produce the same name.
+	NamingHashed = "timestamp_name_hash"
+	// NamingTimestamp names migrations <timestamp>__<name>.
+	NamingTimestamp = "timestamp"
+	// NamingSequential names migrations 0001__<name>, 0002__<name>, ...
+	NamingSequential = "sequential"
+)
+
+// sequentialWidth is the minimum number of digits of a sequential version.
+const sequentialWidth = 4
+
+func (m *Migrator) namingScheme() (string, error) {
+	if m.config == nil || m.config.Migrations.Naming == "" {
+		return NamingHashed, nil
+	}
+	switch scheme := m.config.Migrations.Naming; scheme {
+	case NamingHashed, NamingTimestamp, NamingSequential:
+		return scheme, nil
+	default:
+		return "", fmt.Errorf("unknown migrations naming %q, expected %q, %q or %q",
+			scheme, NamingHashed, NamingTimestamp, NamingSequential)
+	}
+}
+
+// NewMigrationName returns the base name (without extension) for a new
+// migration called name, following the configured naming scheme. It fails
+// when a migration with that name or sequential version already exists.
+func (m *Migrator) NewMigrationName(name string) (string, error) {
+	return m.newMigrationName(name, 0)
+}
+
+// errMigrationExists reports a new migration name that is already taken.
+var errMigrationExists = errors.New("migration already exists")
+
+// newMigrationName is NewMigrationName for the given attempt at naming the
+// migration: after the first, timestamp names get a numeric suffix, since
+// the timestamp may not have changed.
+func (m *Migrator) newMigrationName(name string, attempt int) (string, error) {
+	scheme, err := m.namingScheme()
+	if err != nil {
+		return "", err
+	}
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return "", err
+	}
+
+	name = normalizeName(name)
+	var base string
+	switch scheme {
+	case NamingSequential:
+		base = fmt.Sprintf("%s__%s", formatSequence(nextSequence(migrations), sequenceWidth(migrations)), name)
+	case NamingTimestamp:
+		if attempt > 0 {
+			name = fmt.Sprintf("%s_%d", name, attempt+1)
+		}
+		base = fmt.Sprintf("%s__%s", time.Now().UTC().Format("20060102150405"), name)
+	default:
+		base = fmt.Sprintf("%s__%s__%s", time.Now().UTC().Format("20060102150405"), name, randomHex(4))
+	}
+
+	for _, mig := range migrations {
+		if mig.Base == base || (scheme == NamingSequential && migrationVersion(mig.Base) == migrationVersion(base)) {
+			return "", fmt.Errorf("%w: %s", errMigrationExists, mig.Base)
+		}
+	}
+	return base, nil
+}
+
+// maxNameAttempts bounds how often generate names a migration again when
+// the name it picked is taken.
+const maxNameAttempts = 5
+
+// claimMigrationName names a new migration like NewMigrationName and
+// reserves the name by creating the file path(base) exclusively. When a
+// migration of that name appears in the meantime, written by a concurrent
+// run, it picks another name: a new hash, a suffix or the next sequential
+// version.
+func (m *Migrator) claimMigrationName(name string, path func(base string) string) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxNameAttempts; attempt++ {
+		base, err := m.newMigrationName(name, attempt)
+		if errors.Is(err, errMigrationExists) {
+			lastErr = err
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		f, err := os.OpenFile(path(base), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if os.IsExist(err) {
+			lastErr = fmt.Errorf("%w: %s", errMigrationExists, base)
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("failed to create migration %s: %w", base, err)
+		}
+		f.Close()
+		return base, nil
+	}
+	return "", fmt.Errorf("no free name for migration %s after %d attempts: %w", name, maxNameAttempts, lastErr)
+}
+
+// migrationVersion returns the ordering prefix of a migration base name.
+func migrationVersion(base string) string {
+	version, _, _ := strings.Cut(base, "__")
+	return version
+}
+
+func sequenceNumber(base string) (int, bool) {
+	version := migrationVersion(base)
+	if version == "" || strings.TrimLeft(version, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(version)
+	return n, err == nil
+}
+
+func nextSequence(migrations []migration) int {
+	next := 1
+	for _, mig := range migrations {
+		if n, ok := sequenceNumber(mig.Base); ok && n >= next {
+			next = n + 1
+		}
+	}
+	return next
+}
+
+func sequenceWidth(migrations []migration) int {
+	width := sequentialWidth
+	for _, mig := range migrations {
+		if _, ok := sequenceNumber(mig.Base); ok {
+			width = max(width, len(migrationVersion(mig.Base)))
+		}
+	}
+	return width
+}
+
+func formatSequence(n, width int) string {
+	return fmt.Sprintf("%0*d", width, n)
+}
+
+// lessVersion orders migration base names, comparing numeric versions by
+// value so that 10000__x follows 9999__y.
+func lessVersion(a, b string) bool {
+	va, vb := migrationVersion(a), migrationVersion(b)
+	_, aNum := sequenceNumber(a)
+	_, bNum := sequenceNumber(b)
+	if aNum && bNum && va != vb {
+		ta, tb := strings.TrimLeft(va, "0"), strings.TrimLeft(vb, "0")
+		if len(ta) != len(tb) {
+			return len(ta) < len(tb)
+		}
+		if ta != tb {
+			return ta < tb
+		}
+	}
+	return a < b
+}
+
+// checkVersionCollisions fails when two migrations share a sequential
+// version, which happens when branches adding migrations are merged.
+func (m *Migrator) checkVersionCollisions(migrations []migration) error {
+	if scheme, _ := m.namingScheme(); scheme != NamingSequential {
+		return nil
+	}
+	seen := make(map[int]string)
+	for _, mig := range migrations {
+		n, ok := sequenceNumber(mig.Base)
+		if !ok {
+			continue
+		}
+		if other, ok := seen[n]; ok {
+			return fmt.Errorf("migrations %s and %s share version %d; run 'migrateme renumber' to fix the order", other, mig.Base, n)
+		}
+		seen[n] = mig.Base
+	}
+	return nil
+}
+
+// Rename is a migration renamed by Renumber.
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Renumber gives pending migrations consecutive sequential versions after
+// the last applied one, keeping their current order. Applied migrations are
+// never renamed. With dryRun only the planned renames are returned.
+func (m *Migrator) Renumber(ctx context.Context, dryRun bool) ([]Rename, error) {
+	if scheme, err := m.namingScheme(); err != nil {
+		return nil, err
+	} else if scheme != NamingSequential {
+		return nil, fmt.Errorf("renumber needs migrations.naming set to %q", NamingSequential)
+	}
+
+	migrations, err := m.scanMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+	applied, err := m.db.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	appliedSet := make(map[string]bool, len(applied))
+	for _, a := range applied {
+		appliedSet[a] = true
+	}
+
+	var appliedMigrations, pending []migration
+	for _, mig := range migrations {
+		if appliedSet[mig.Base] {
+			appliedMigrations = append(appliedMigrations, mig)
+		} else {
+			pending = append(pending, mig)
+		}
+	}
+	next := nextSequence(appliedMigrations)
+	width := max(sequenceWidth(migrations), len(strconv.Itoa(next+len(pending)-1)))
+
+	taken := make(map[string]bool, len(migrations))
+	for _, mig := range migrations {
+		taken[mig.Base] = true
+	}
+
+	var renames []Rename
+	var moves []func() error
+	for _, mig := range pending {
+		_, rest, ok := strings.Cut(mig.Base, "__")
+		if !ok {
+			rest = mig.Base
+		}
+		base := formatSequence(next, width) + "__" + rest
+		next++
+		if base == mig.Base {
+			continue
+		}
+		if taken[base] {
+			return nil, fmt.Errorf("cannot rename %s: %s already exists", mig.Base, base)
+		}
+		taken[base] = true
+
+		for _, from := range m.migrationPaths(mig) {
+			to := base + strings.TrimPrefix(from, mig.Base)
+			renames = append(renames, Rename{From: from, To: to})
+			dir := m.config.GetMigrationsDir()
+			moves = append(moves, func() error {
+				return os.Rename(filepath.Join(dir, from), filepath.Join(dir, to))
+			})
+		}
+	}
+
+	if dryRun {
+		return renames, nil
+	}
+	for i, move := range moves {
+		if err := move(); err != nil {
+			return renames[:i], fmt.Errorf("rename %s: %w", renames[i].From, err)
+		}
+	}
+	return renames, nil
+}
+
+// migrationPaths returns the files that make up mig.
+func (m *Migrator) migrationPaths(mig migration) []string {
+	if mig.File != "" {
+		return []string{mig.File}
+	}
+	paths := []string{mig.path(true)}
+	if _, err := os.Stat(filepath.Join(m.config.GetMigrationsDir(), mig.path(false))); err == nil {
+		paths = append(paths, mig.path(false))
+	}
+	return paths
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+)
+
+func namingMigrator(naming string, fsys fstest.MapFS) *Migrator {
+	cfg := config.Default()
+	cfg.Migrations.Naming = naming
+	m := NewMigrator(cfg, nil)
+	m.SetMigrationsFS(fsys)
+	return m
+}
+
+func TestNewMigrationName_Schemes(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"0001__init.up.sql": {Data: []byte("SELECT 1;")},
+		"0002__users.sql":   {Data: []byte("-- +migrate Up\nSELECT 2;\n")},
+	}
+
+	cases := map[string]*regexp.Regexp{
+		NamingSequential: regexp.MustCompile(`^0003__add_posts$`),
+		NamingTimestamp:  regexp.MustCompile(`^\d{14}__add_posts$`),
+		NamingHashed:     regexp.MustCompile(`^\d{14}__add_posts__[0-9a-f]{8}$`),
+		"":               regexp.MustCompile(`^\d{14}__add_posts__[0-9a-f]{8}$`),
+	}
+	for naming, want := range cases {
+		got, err := namingMigrator(naming, fsys).NewMigrationName("Add posts")
+		if err != nil {
+			t.Fatalf("%q: %v", naming, err)
+		}
+		if !want.MatchString(got) {
+			t.Errorf("%q: NewMigrationName = %q, want %s", naming, got, want)
+		}
+	}
+
+	if _, err := namingMigrator("random", fsys).NewMigrationName("x"); err == nil {
+		t.Error("expected an error for an unknown naming scheme")
+	}
+}
+
+func TestListMigrations_SequentialCollision(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"0001__init.up.sql":  {Data: []byte("SELECT 1;")},
+		"0002__users.up.sql": {Data: []byte("SELECT 2;")},
+		"0002__posts.up.sql": {Data: []byte("SELECT 3;")},
+	}
+
+	if _, err := namingMigrator(NamingSequential, fsys).listMigrations(); err == nil {
+		t.Fatal("expected a version collision error")
+	}
+	if _, err := namingMigrator(NamingHashed, fsys).listMigrations(); err != nil {
+		t.Fatalf("collisions only matter for sequential naming: %v", err)
+	}
+}
+
+func TestListMigrations_OrdersNumericVersionsByValue(t *testing.T) {
+	t.Parallel()
+
+	m := namingMigrator(NamingSequential, fstest.MapFS{
+		"10000__b.up.sql": {Data: []byte("SELECT 2;")},
+		"9999__a.up.sql":  {Data: []byte("SELECT 1;")},
+	})
+
+	migrations, err := m.listMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrations[0].Base != "9999__a" || migrations[1].Base != "10000__b" {
+		t.Fatalf("listMigrations = %+v", migrations)
+	}
+}
+
+func TestRenumber(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{
+		"0001__init.up.sql", "0001__init.down.sql",
+		"0002__users.up.sql", "0002__users.down.sql",
+		"0002__posts.sql",
+		"0005__tags.up.sql",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("-- +migrate Up\nSELECT 1;\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.Default()
+	cfg.Migrations.Dir = dir
+	cfg.Migrations.Naming = NamingSequential
+	m := NewMigrator(cfg, database.New(&fakeExecutor{applied: []string{"0001__init"}}))
+
+	renames, err := m.Renumber(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renames) != 3 {
+		t.Fatalf("Renumber = %+v", renames)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	sort.Strings(got)
+	want := []string{
+		"0001__init.down.sql", "0001__init.up.sql",
+		"0002__posts.sql",
+		"0003__users.down.sql", "0003__users.up.sql",
+		"0004__tags.up.sql",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("files = %v, want %v", got, want)
+		}
+	}
+
+	if _, err := m.listMigrations(); err != nil {
+		t.Fatalf("collision left after renumber: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Table names in statements, optionally schema-qualified and quoted.
+const sqlIdent = `((?:"[^"]+"|[\w$]+)(?:\s*\.\s*(?:"[^"]+"|[\w$]+))?)`
+
+var (
+	// tableStatementRE matches the statements whose tables tableRefRE and
+	// tableListRE find. Anything else, e.g. a function, type, view, DO
+	// block or DROP INDEX, may touch tables not named in it.
+	tableStatementRE = regexp.MustCompile(`(?is)^(CREATE\s+((GLOBAL|LOCAL)\s+)?((TEMP|TEMPORARY|UNLOGGED)\s+)?TABLE|` +
+		`CREATE\s+(UNIQUE\s+)?INDEX|CREATE\s+(OR\s+REPLACE\s+)?TRIGGER|ALTER\s+TABLE|DROP\s+TABLE|TRUNCATE|` +
+		`INSERT|UPDATE|DELETE|COMMENT\s+ON\s+(TABLE|COLUMN)|ANALYZE|LOCK)\b`)
+	// neutralStatementRE matches statements that touch no table.
+	neutralStatementRE = regexp.MustCompile(`(?is)^(SET|RESET|BEGIN|START\s+TRANSACTION|COMMIT|END)\b`)
+	tableRefRE         = regexp.MustCompile(`(?is)\b(?:CREATE\s+(?:(?:GLOBAL|LOCAL)\s+)?(?:(?:TEMP|TEMPORARY|UNLOGGED)\s+)?TABLE|ALTER\s+TABLE|` +
+		`INSERT\s+INTO|UPDATE|FROM|JOIN|REFERENCES|LOCK(?:\s+TABLE)?|ANALYZE|COMMENT\s+ON\s+TABLE|` +
+		`INHERITS\s*\(|LIKE|PARTITION\s+OF|(?:ATTACH|DETACH)\s+PARTITION|RENAME\s+TO)` +
+		`\s+(?:IF\s+(?:NOT\s+)?EXISTS\s+)?(?:ONLY\s+)?` + sqlIdent)
+	// indexTableRE finds the table of CREATE INDEX and CREATE TRIGGER, which
+	// ON alone does not tell from ON DELETE of a foreign key.
+	indexTableRE = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+INDEX|INDEX|(?:OR\s+REPLACE\s+)?TRIGGER)\b.*?\bON\s+(?:ONLY\s+)?` + sqlIdent)
+	// columnCommentRE finds the column of COMMENT ON COLUMN, whose table is
+	// all but its last part.
+	columnCommentRE = regexp.MustCompile(`(?is)^COMMENT\s+ON\s+COLUMN\s+((?:"[^"]+"|[\w$]+)(?:\s*\.\s*(?:"[^"]+"|[\w$]+))*)`)
+	// tableListRE finds the tables of DROP TABLE and TRUNCATE, which take a
+	// list of them.
+	tableListRE = regexp.MustCompile(`(?is)^(?:DROP\s+TABLE|TRUNCATE(?:\s+TABLE)?)\s+(?:IF\s+EXISTS\s+)?(.*?)\s*(?:\b(?:RESTRICT|RESTART\s+IDENTITY|CONTINUE\s+IDENTITY)\b.*)?$`)
+	cascadeRE   = regexp.MustCompile(`(?i)\bCASCADE\s*$`)
+	// sqlNoiseRE matches comments and string literals, which can hold
+	// anything that looks like a table reference.
+	sqlNoiseRE = regexp.MustCompile(`(?s)--[^\n]*|/\*.*?\*/|'(?:[^']|'')*'`)
+)
+
+// notTables are words tableRefRE takes for tables after e.g. ON UPDATE of a
+// foreign key or in a subquery.
+var notTables = map[string]bool{"cascade": true, "restrict": true, "set": true, "no": true, "lateral": true, "select": true}
+
+// migrationTables returns the tables the statements of sql read or change,
+// sorted, or false when some statement may touch tables it does not name.
+// Run applies a migration concurrently with others only when it knows its
+// tables and none of them is shared.
+func migrationTables(sql string) ([]string, bool) {
+	seen := map[string]bool{}
+	for _, stmt := range splitStatements(sql) {
+		tables, ok := statementTables(stmt)
+		if !ok {
+			return nil, false
+		}
+		for _, t := range tables {
+			seen[t] = true
+		}
+	}
+	tables := make([]string, 0, len(seen))
+	for t := range seen {
+		tables = append(tables, t)
+	}
+	slices.Sort(tables)
+	return tables, true
+}
+
+// statementTables returns the tables stmt reads or changes. Statements wrapped
+// in a DO block, as generate writes for idempotent constraints, are looked at
+// by the statement inside. DROP TABLE and TRUNCATE with CASCADE reach tables
+// they do not name, so they are not known.
+func statementTables(stmt string) ([]string, bool) {
+	sql := strings.TrimSpace(sqlNoiseRE.ReplaceAllString(stmt, "''"))
+	if m := doBlockStatement.FindStringSubmatch(sql); m != nil {
+		sql = strings.TrimSpace(m[1])
+	}
+	if neutralStatementRE.MatchString(sql) {
+		return nil, true
+	}
+	if !tableStatementRE.MatchString(sql) {
+		return nil, false
+	}
+
+	var tables []string
+	add := func(name string) {
+		name = normalizeTableName(name)
+		if name != "" && !notTables[name] && !strings.HasPrefix(name, "pg_") && !strings.HasPrefix(name, "information_schema.") {
+			tables = append(tables, name)
+		}
+	}
+	if m := tableListRE.FindStringSubmatch(sql); m != nil {
+		if cascadeRE.MatchString(sql) {
+			return nil, false
+		}
+		for _, name := range strings.Split(m[1], ",") {
+			// The last word, after a possible ONLY.
+			if words := strings.Fields(name); len(words) > 0 {
+				add(words[len(words)-1])
+			}
+		}
+		return tables, true
+	}
+	if m := indexTableRE.FindStringSubmatch(sql); m != nil {
+		add(m[1])
+	}
+	if m := columnCommentRE.FindStringSubmatch(sql); m != nil {
+		if i := strings.LastIndex(m[1], "."); i > 0 {
+			add(m[1][:i])
+		}
+	}
+	for _, m := range tableRefRE.FindAllStringSubmatch(sql, -1) {
+		add(m[1])
+	}
+	return tables, true
+}
+
+// normalizeTableName folds unquoted names to lower case, as Postgres does,
+// and drops the public schema.
+func normalizeTableName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		if unquoted, ok := strings.CutPrefix(p, `"`); ok {
+			parts[i] = strings.TrimSuffix(unquoted, `"`)
+		} else {
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	if len(parts) == 2 && parts[0] == "public" {
+		parts = parts[1:]
+	}
+	return strings.Join(parts, ".")
+}
+
+// joinsWave reports whether p can be applied together with the migrations
+// of wave: the wave has room for it, and all of them know their tables and
+// share none.
+func joinsWave(wave []*pendingRun, p *pendingRun, parallel int) bool {
+	if len(wave) == 0 {
+		return true
+	}
+	if len(wave) >= parallel || !p.parallel {
+		return false
+	}
+	for _, w := range wave {
+		if !w.parallel {
+			return false
+		}
+		for _, t := range p.tables {
+			if slices.Contains(w.tables, t) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestMigrationTables(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		sql    string
+		tables []string
+		ok     bool
+	}{
+		{
+			name: "create table with foreign key",
+			sql: `CREATE TABLE IF NOT EXISTS "Orders" (
+	id bigserial PRIMARY KEY,
+	user_id bigint REFERENCES public.users (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS orders_user_id_idx ON "Orders" (user_id);
+COMMENT ON COLUMN "Orders".user_id IS 'from users; see FROM accounts';`,
+			tables: []string{"Orders", "users"},
+			ok:     true,
+		},
+		{
+			name: "backfill with timeouts",
+			sql: `SET LOCAL lock_timeout = '5s';
+-- copy totals from items
+UPDATE orders SET total = (SELECT sum(price) FROM order_items i WHERE i.order_id = orders.id);
+ALTER TABLE ONLY orders ALTER COLUMN total SET NOT NULL`,
+			tables: []string{"order_items", "orders"},
+			ok:     true,
+		},
+		{
+			name: "generated constraint in a DO block",
+			sql: `DO $$ BEGIN IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk') THEN
+ALTER TABLE posts ADD CONSTRAINT fk FOREIGN KEY (author_id) REFERENCES authors (id); END IF; END $$`,
+			tables: []string{"authors", "posts"},
+			ok:     true,
+		},
+		{
+			name:   "drop and truncate lists",
+			sql:    "DROP TABLE IF EXISTS a, b RESTRICT; TRUNCATE TABLE ONLY c, d RESTART IDENTITY",
+			tables: []string{"a", "b", "c", "d"},
+			ok:     true,
+		},
+		{
+			name: "drop cascade",
+			sql:  "DROP TABLE sessions CASCADE",
+		},
+		{
+			name: "function",
+			sql:  "CREATE FUNCTION touch() RETURNS trigger AS $$ BEGIN NEW.updated_at = now(); RETURN NEW; END $$ LANGUAGE plpgsql",
+		},
+		{
+			name: "enum type",
+			sql:  "CREATE TYPE status AS ENUM ('new', 'done'); ALTER TABLE orders ADD COLUMN status status",
+		},
+		{
+			name: "drop index",
+			sql:  "DROP INDEX orders_user_id_idx",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tables, ok := migrationTables(tt.sql)
+			if ok != tt.ok || !reflect.DeepEqual(tables, tt.tables) {
+				t.Errorf("migrationTables = %v, %v, want %v, %v", tables, ok, tt.tables, tt.ok)
+			}
+		})
+	}
+}
+
+func TestJoinsWave(t *testing.T) {
+	t.Parallel()
+
+	users := &pendingRun{tables: []string{"users"}, parallel: true}
+	orders := &pendingRun{tables: []string{"orders", "users"}, parallel: true}
+	tags := &pendingRun{tables: []string{"tags"}, parallel: true}
+	function := &pendingRun{}
+
+	tests := []struct {
+		name     string
+		wave     []*pendingRun
+		p        *pendingRun
+		parallel int
+		want     bool
+	}{
+		{"empty wave", nil, function, 1, true},
+		{"serial", []*pendingRun{users}, tags, 1, false},
+		{"disjoint", []*pendingRun{users}, tags, 4, true},
+		{"shared table", []*pendingRun{tags, users}, orders, 4, false},
+		{"wave full", []*pendingRun{users, tags}, &pendingRun{tables: []string{"x"}, parallel: true}, 2, false},
+		{"unknown tables", []*pendingRun{users}, function, 4, false},
+		{"after unknown tables", []*pendingRun{function}, tags, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := joinsWave(tt.wave, tt.p, tt.parallel); got != tt.want {
+				t.Errorf("joinsWave = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeWaveTx logs what happens to the transaction of a parallel migration.
+type fakeWaveTx struct {
+	mu   *sync.Mutex
+	log  *[]string
+	fail map[string]error
+	sql  string
+}
+
+func (tx *fakeWaveTx) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	tx.sql = sql
+	return pgconn.CommandTag{}, tx.fail[sql]
+}
+
+func (tx *fakeWaveTx) Commit(context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	*tx.log = append(*tx.log, "commit "+tx.sql)
+	return nil
+}
+
+func (tx *fakeWaveTx) Rollback(context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	*tx.log = append(*tx.log, "rollback "+tx.sql)
+	return nil
+}
+
+func TestRun_ParallelWave(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"001__a.up.sql": {Data: []byte("CREATE TABLE a (id int);")},
+		"002__b.up.sql": {Data: []byte("CREATE TABLE b (id int);")},
+		"003__c.up.sql": {Data: []byte("CREATE TABLE c (id int);")},
+		// Shares a with 001__a, so it waits for the wave before it.
+		"004__d.up.sql": {Data: []byte("ALTER TABLE a ADD COLUMN d int;")},
+	}
+	run := func(fail map[string]error) ([]string, []string, *fakeExecutor, error) {
+		var mu sync.Mutex
+		var log []string
+		exec := &fakeExecutor{}
+		m := NewMigrator(config.Default(), database.New(exec))
+		m.SetMigrationsFS(fsys)
+		m.beginTx = func(context.Context) (waveTx, error) {
+			return &fakeWaveTx{mu: &mu, log: &log, fail: fail}, nil
+		}
+		applied, err := m.Run(context.Background(), RunOptions{Parallel: 3})
+		return applied, log, exec, err
+	}
+	recorded := func(exec *fakeExecutor) int {
+		n := 0
+		for _, q := range exec.execs {
+			if strings.HasPrefix(q, "INSERT INTO schema_migrations") {
+				n++
+			}
+		}
+		return n
+	}
+
+	applied, log, exec, err := run(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(applied, ",") != "001__a,002__b,003__c,004__d" {
+		t.Errorf("applied %v", applied)
+	}
+	want := []string{"commit CREATE TABLE a (id int);", "commit CREATE TABLE b (id int);", "commit CREATE TABLE c (id int);"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("transactions = %q, want the wave committed in file order", log)
+	}
+	if recorded(exec) != 4 || exec.execs[len(exec.execs)-2] != "ALTER TABLE a ADD COLUMN d int;" {
+		t.Errorf("expected 004__d to run alone after the wave, got %q", exec.execs)
+	}
+
+	// A failure in the middle of the wave rolls all of it back, so that no
+	// later migration is recorded while an earlier one is pending.
+	applied, log, exec, err = run(map[string]error{"CREATE TABLE b (id int);": errors.New("boom")})
+	if err == nil || !strings.Contains(err.Error(), "002__b") || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected 002__b to fail the wave, got %v", err)
+	}
+	if len(applied) != 0 || recorded(exec) != 0 {
+		t.Errorf("applied %v and recorded %d migrations, want none", applied, recorded(exec))
+	}
+	slices.Sort(log)
+	want = []string{"rollback CREATE TABLE a (id int);", "rollback CREATE TABLE b (id int);", "rollback CREATE TABLE c (id int);"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("transactions = %q, want all of the wave rolled back", log)
+	}
+}
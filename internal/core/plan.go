@@ -0,0 +1,156 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// PlanWriter receives every table diff as soon as it has been computed.
+type PlanWriter interface {
+	WriteTable(change TableChange, diff migrate.TableDiff) error
+}
+
+// TextPlanWriter prints a human-readable plan, optionally with SQL.
+type TextPlanWriter struct {
+	W       io.Writer
+	ShowSQL bool
+}
+
+func (p *TextPlanWriter) WriteTable(change TableChange, diff migrate.TableDiff) error {
+	if _, err := fmt.Fprintf(p.W, "  - %s: %s (%s)%s\n", change.TableName, change.Type, change.Details, ownerSuffix(change.Owner)); err != nil {
+		return err
+	}
+	if err := WriteImpact(p.W, change.Impact); err != nil {
+		return err
+	}
+	if !p.ShowSQL {
+		return nil
+	}
+	for _, stmt := range diff.Up {
+		if _, err := fmt.Fprintf(p.W, "      %s;\n", stmt); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range diff.PostUp {
+		if _, err := fmt.Fprintf(p.W, "      -- after all tables:\n      %s;\n", stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteImpact prints the statements of a table that take a lock, with the
+// estimated row count, under the table line of a plan. It prints nothing
+// for a nil impact.
+func WriteImpact(w io.Writer, impact *TableImpact) error {
+	if impact == nil {
+		return nil
+	}
+	rows := "unknown, the table has not been analyzed"
+	if impact.Rows >= 0 {
+		rows = fmt.Sprintf("~%d", impact.Rows)
+	}
+	if _, err := fmt.Fprintf(w, "      rows: %s\n", rows); err != nil {
+		return err
+	}
+	for _, s := range impact.Statements {
+		if s.Lock == "" && s.Note == "" {
+			continue
+		}
+		lock := s.Lock
+		if lock == "" {
+			lock = "?"
+		}
+		if s.Rewrite {
+			lock += ", rewrite"
+		} else if s.Scan {
+			lock += ", scan"
+		}
+		if _, err := fmt.Fprintf(w, "      [%s] %s\n", lock, summarizeStatement(s.Statement)); err != nil {
+			return err
+		}
+		if s.Note != "" {
+			if _, err := fmt.Fprintf(w, "        %s\n", s.Note); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// summarizeStatement shortens a statement to its first line, at most 100
+// characters, for listing it in a plan. A DO block is shown by the
+// statement inside.
+func summarizeStatement(stmt string) string {
+	stmt = strings.TrimSpace(stmt)
+	if m := doBlockStatement.FindStringSubmatch(stmt); m != nil {
+		stmt = strings.TrimSpace(m[1])
+	}
+	if i := strings.IndexByte(stmt, '\n'); i >= 0 {
+		stmt = stmt[:i] + " ..."
+	}
+	if len(stmt) > 100 {
+		stmt = stmt[:97] + "..."
+	}
+	return stmt
+}
+
+const unownedGroup = "(unowned)"
+
+// OwnerGroupedPlanWriter buffers the plan and prints it grouped by entity
+// owner on Flush, so every team can review its own section.
+type OwnerGroupedPlanWriter struct {
+	W       io.Writer
+	ShowSQL bool
+
+	groups map[string][]plannedTable
+}
+
+type plannedTable struct {
+	change TableChange
+	diff   migrate.TableDiff
+}
+
+func (p *OwnerGroupedPlanWriter) WriteTable(change TableChange, diff migrate.TableDiff) error {
+	if p.groups == nil {
+		p.groups = map[string][]plannedTable{}
+	}
+	owner := change.Owner
+	if owner == "" {
+		owner = unownedGroup
+	}
+	p.groups[owner] = append(p.groups[owner], plannedTable{change: change, diff: diff})
+	return nil
+}
+
+func (p *OwnerGroupedPlanWriter) Flush() error {
+	owners := make([]string, 0, len(p.groups))
+	for owner := range p.groups {
+		if owner != unownedGroup {
+			owners = append(owners, owner)
+		}
+	}
+	sort.Strings(owners)
+	if _, ok := p.groups[unownedGroup]; ok {
+		owners = append(owners, unownedGroup)
+	}
+
+	text := &TextPlanWriter{W: p.W, ShowSQL: p.ShowSQL}
+	for _, owner := range owners {
+		tables := p.groups[owner]
+		if _, err := fmt.Fprintf(p.W, "\n[%s] %d tables\n", owner, len(tables)); err != nil {
+			return err
+		}
+		for _, t := range tables {
+			t.change.Owner = ""
+			if err := text.WriteTable(t.change, t.diff); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
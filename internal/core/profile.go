@@ -0,0 +1,193 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Profile collects where the time of a run went, when passed as
+// RunOptions.Profile.
+type Profile struct {
+	// Statements are the timings of every applied statement, in order.
+	Statements []StatementTiming `json:"statements"`
+	// StatStatements are the pg_stat_statements deltas of the run, by
+	// execution time, when the extension is installed.
+	StatStatements []StatStatementDelta `json:"pg_stat_statements,omitempty"`
+	// StatStatementsAvailable reports whether pg_stat_statements could be
+	// read.
+	StatStatementsAvailable bool `json:"pg_stat_statements_available"`
+}
+
+// StatementTiming is how long one statement of a migration took.
+type StatementTiming struct {
+	Migration string        `json:"migration"`
+	Index     int           `json:"index"`
+	SQL       string        `json:"sql"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// StatStatementDelta is how much one pg_stat_statements entry grew during
+// the run.
+type StatStatementDelta struct {
+	Query          string        `json:"query"`
+	Calls          int64         `json:"calls"`
+	ExecTime       time.Duration `json:"exec_time"`
+	Rows           int64         `json:"rows"`
+	SharedBlksHit  int64         `json:"shared_blks_hit"`
+	SharedBlksRead int64         `json:"shared_blks_read"`
+}
+
+// Slowest returns the n slowest statements, slowest first.
+func (p *Profile) Slowest(n int) []StatementTiming {
+	out := append([]StatementTiming(nil), p.Statements...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Duration > out[j].Duration })
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// Total is the time spent in statements.
+func (p *Profile) Total() time.Duration {
+	var total time.Duration
+	for _, s := range p.Statements {
+		total += s.Duration
+	}
+	return total
+}
+
+// WriteProfile prints the n slowest statements of p and its n largest
+// pg_stat_statements deltas.
+func WriteProfile(w io.Writer, p *Profile, n int) error {
+	fmt.Fprintf(w, "Slowest statements (%d statements, %s in total):\n", len(p.Statements), p.Total().Round(time.Millisecond))
+	for _, s := range p.Slowest(n) {
+		fmt.Fprintf(w, "  %10s  %s #%d  %s\n", s.Duration.Round(time.Millisecond), s.Migration, s.Index, oneLine(s.SQL, 80))
+	}
+	if !p.StatStatementsAvailable {
+		fmt.Fprintln(w, "pg_stat_statements is not installed, no server-side statistics")
+		return nil
+	}
+	fmt.Fprintln(w, "pg_stat_statements deltas:")
+	deltas := p.StatStatements
+	if len(deltas) > n {
+		deltas = deltas[:n]
+	}
+	for _, d := range deltas {
+		_, err := fmt.Fprintf(w, "  %10s  calls=%d rows=%d blks read=%d hit=%d  %s\n", d.ExecTime.Round(time.Millisecond),
+			d.Calls, d.Rows, d.SharedBlksRead, d.SharedBlksHit, oneLine(d.Query, 60))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oneLine collapses whitespace in sql and shortens it to max runes.
+func oneLine(sql string, max int) string {
+	s := strings.Join(strings.Fields(sql), " ")
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+// execProfiled applies a transactional migration statement by statement on
+// one connection, timing each. A migration without its own BEGIN is wrapped
+// in one, so it stays atomic as when sent as a single query.
+func execProfiled(ctx context.Context, pool *pgxpool.Pool, base, sql string) ([]StatementTiming, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	stmts := splitStatements(sql)
+	if len(stmts) > 0 && !beginRE.MatchString(stmts[0]+";") && !concurrentlyRE.MatchString(sql) {
+		stmts = append(append([]string{"BEGIN"}, stmts...), "COMMIT")
+	}
+
+	timings := make([]StatementTiming, 0, len(stmts))
+	for i, stmt := range stmts {
+		start := time.Now()
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			// Leave no transaction open on the pooled connection.
+			conn.Exec(context.WithoutCancel(ctx), "ROLLBACK")
+			return nil, err
+		}
+		timings = append(timings, StatementTiming{Migration: base, Index: i + 1, SQL: stmt, Duration: time.Since(start)})
+	}
+	return timings, nil
+}
+
+// statStatements keys pg_stat_statements counters of the current database
+// by query id.
+type statStatements map[int64]StatStatementDelta
+
+// readStatStatements reads pg_stat_statements, or returns false when the
+// extension is not installed or readable. total_exec_time is total_time
+// before Postgres 13.
+func readStatStatements(ctx context.Context, pool *pgxpool.Pool) (statStatements, bool) {
+	rows, err := pool.Query(ctx, `
+SELECT s.queryid, s.query, s.calls,
+       COALESCE((to_jsonb(s)->>'total_exec_time')::float8, (to_jsonb(s)->>'total_time')::float8, 0),
+       s.rows, s.shared_blks_hit, s.shared_blks_read
+FROM pg_stat_statements s
+WHERE s.dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+  AND s.queryid IS NOT NULL`)
+	if err != nil {
+		return nil, false
+	}
+	defer rows.Close()
+
+	out := statStatements{}
+	for rows.Next() {
+		var id int64
+		var d StatStatementDelta
+		var ms float64
+		if err := rows.Scan(&id, &d.Query, &d.Calls, &ms, &d.Rows, &d.SharedBlksHit, &d.SharedBlksRead); err != nil {
+			return nil, false
+		}
+		d.ExecTime = time.Duration(ms * float64(time.Millisecond))
+		// The same query id can appear for several users; add them up.
+		prev := out[id]
+		d.Calls += prev.Calls
+		d.ExecTime += prev.ExecTime
+		d.Rows += prev.Rows
+		d.SharedBlksHit += prev.SharedBlksHit
+		d.SharedBlksRead += prev.SharedBlksRead
+		out[id] = d
+	}
+	return out, rows.Err() == nil
+}
+
+// deltas returns what grew from before to after, by execution time.
+func (after statStatements) deltas(before statStatements) []StatStatementDelta {
+	var out []StatStatementDelta
+	for id, a := range after {
+		b := before[id]
+		if a.Calls == b.Calls {
+			continue
+		}
+		out = append(out, StatStatementDelta{
+			Query:          a.Query,
+			Calls:          a.Calls - b.Calls,
+			ExecTime:       a.ExecTime - b.ExecTime,
+			Rows:           a.Rows - b.Rows,
+			SharedBlksHit:  a.SharedBlksHit - b.SharedBlksHit,
+			SharedBlksRead: a.SharedBlksRead - b.SharedBlksRead,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ExecTime != out[j].ExecTime {
+			return out[i].ExecTime > out[j].ExecTime
+		}
+		return out[i].Query < out[j].Query
+	})
+	return out
+}
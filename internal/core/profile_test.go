@@ -0,0 +1,95 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileSlowest(t *testing.T) {
+	t.Parallel()
+
+	p := &Profile{Statements: []StatementTiming{
+		{Migration: "001_init", Index: 1, SQL: "CREATE TABLE a ()", Duration: 2 * time.Millisecond},
+		{Migration: "001_init", Index: 2, SQL: "UPDATE a SET x = 1", Duration: 900 * time.Millisecond},
+		{Migration: "002_index", Index: 1, SQL: "CREATE INDEX ON a (x)", Duration: 40 * time.Millisecond},
+	}}
+
+	slowest := p.Slowest(2)
+	if len(slowest) != 2 || slowest[0].SQL != "UPDATE a SET x = 1" || slowest[1].Migration != "002_index" {
+		t.Fatalf("Slowest(2) = %+v", slowest)
+	}
+	if p.Statements[0].Index != 1 || p.Statements[0].Migration != "001_init" {
+		t.Errorf("Slowest reordered the statements: %+v", p.Statements)
+	}
+	if got := p.Total(); got != 942*time.Millisecond {
+		t.Errorf("Total() = %s", got)
+	}
+}
+
+func TestStatStatementsDeltas(t *testing.T) {
+	t.Parallel()
+
+	before := statStatements{
+		1: {Query: "SELECT 1", Calls: 5, ExecTime: time.Second},
+		2: {Query: "UPDATE a SET x = $1", Calls: 1, ExecTime: time.Second, Rows: 10, SharedBlksRead: 3},
+	}
+	after := statStatements{
+		1: {Query: "SELECT 1", Calls: 5, ExecTime: time.Second},
+		2: {Query: "UPDATE a SET x = $1", Calls: 2, ExecTime: 3 * time.Second, Rows: 110, SharedBlksRead: 50},
+		3: {Query: "CREATE INDEX ON a (x)", Calls: 1, ExecTime: 500 * time.Millisecond},
+	}
+
+	got := after.deltas(before)
+	if len(got) != 2 {
+		t.Fatalf("deltas = %+v, want the two entries that were called", got)
+	}
+	want := StatStatementDelta{Query: "UPDATE a SET x = $1", Calls: 1, ExecTime: 2 * time.Second, Rows: 100, SharedBlksRead: 47}
+	if got[0] != want {
+		t.Errorf("deltas[0] = %+v, want %+v", got[0], want)
+	}
+	if got[1].Query != "CREATE INDEX ON a (x)" || got[1].Calls != 1 {
+		t.Errorf("deltas[1] = %+v", got[1])
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	t.Parallel()
+
+	p := &Profile{Statements: []StatementTiming{
+		{Migration: "001_init", Index: 2, SQL: "UPDATE a\n   SET x = 1", Duration: 1500 * time.Millisecond},
+	}}
+
+	var b bytes.Buffer
+	if err := WriteProfile(&b, p, 10); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{"1 statements, 1.5s in total", "001_init #2  UPDATE a SET x = 1", "pg_stat_statements is not installed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+
+	p.StatStatementsAvailable = true
+	p.StatStatements = []StatStatementDelta{{Query: "UPDATE a SET x = $1", Calls: 1, ExecTime: time.Second, Rows: 100}}
+	b.Reset()
+	if err := WriteProfile(&b, p, 10); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "calls=1 rows=100") {
+		t.Errorf("expected the pg_stat_statements delta in:\n%s", b.String())
+	}
+}
+
+func TestOneLine(t *testing.T) {
+	t.Parallel()
+
+	if got := oneLine("SELECT\n\t1", 80); got != "SELECT 1" {
+		t.Errorf("oneLine = %q", got)
+	}
+	if got := oneLine("SELECT 123456", 8); got != "SELECT …" {
+		t.Errorf("oneLine = %q", got)
+	}
+}
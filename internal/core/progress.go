@@ -0,0 +1,106 @@
+package core
+
+import (
+	"strings"
+	"time"
+)
+
+// MigrationProgress reports on a migration being applied by Run: once
+// before it starts and once, with Done set, after it succeeded. With
+// RunOptions.Parallel, the migrations applied together all start before the
+// first of them is reported done.
+type MigrationProgress struct {
+	Migration string
+	// Index is the 1-based position of the migration among the Total
+	// pending ones.
+	Index, Total int
+	// Statements is the number of statements in the migration. They are
+	// sent to the server together, so progress within a migration is only
+	// visible as elapsed time.
+	Statements int
+	// Elapsed is the time the migration took; zero before it starts.
+	Elapsed time.Duration
+	Done    bool
+}
+
+// countStatements counts the statements of sql.
+func countStatements(sql string) int {
+	return len(splitStatements(sql))
+}
+
+// splitStatements splits sql into statements at semicolons outside of
+// quotes, dollar-quoted bodies and comments. Statements keep the comments
+// inside them but not the terminating semicolon; empty ones are dropped.
+func splitStatements(sql string) []string {
+	var stmts []string
+	start := 0
+	pending := false // a statement has started since the last semicolon
+	flush := func(end int) {
+		if pending {
+			stmts = append(stmts, strings.TrimSpace(sql[start:end]))
+		}
+		start, pending = end+1, false
+	}
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(sql)
+			}
+			if !pending {
+				start = i
+			}
+			continue
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(sql)
+			}
+			if !pending {
+				start = i + 1
+			}
+			continue
+		case c == '\'' || c == '"':
+			if end := strings.IndexByte(sql[i+1:], c); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case c == '$':
+			if tag := dollarTag(sql[i:]); tag != "" {
+				if end := strings.Index(sql[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				} else {
+					i = len(sql)
+				}
+			}
+		case c == ';':
+			flush(i)
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		}
+		pending = true
+	}
+	flush(len(sql))
+	return stmts
+}
+
+// dollarTag returns the opening $tag$ at the start of s, or "" when s does
+// not start one.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9':
+		default:
+			return ""
+		}
+	}
+	return ""
+}
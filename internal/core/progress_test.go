@@ -0,0 +1,43 @@
+package core
+
+import "testing"
+
+func TestCountStatements(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]int{
+		"":                                 0,
+		"-- only a comment\n":              0,
+		"SELECT 1":                         1,
+		"BEGIN;\n\nSELECT 1;\nCOMMIT;":     3,
+		"SELECT ';';  ; SELECT \"a;b\";":   2,
+		"/* ; */ SELECT 1; -- ;\nSELECT 2": 2,
+		"DO $$ BEGIN PERFORM 1; END $$;\nSELECT $1;":                           2,
+		"CREATE FUNCTION f() RETURNS int AS $fn$ SELECT 1; $fn$ LANGUAGE sql;": 1,
+	}
+	for sql, want := range tests {
+		if got := countStatements(sql); got != want {
+			t.Errorf("countStatements(%q) = %d, want %d", sql, got, want)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	t.Parallel()
+
+	sql := "-- migrateme:no_transaction\nCREATE INDEX CONCURRENTLY a ON t (x);\n\n/* second */\nCREATE INDEX CONCURRENTLY b ON t (y) WHERE z = ';';\nUPDATE t SET x = 1 -- trailing\n"
+	got := splitStatements(sql)
+	want := []string{
+		"CREATE INDEX CONCURRENTLY a ON t (x)",
+		"CREATE INDEX CONCURRENTLY b ON t (y) WHERE z = ';'",
+		"UPDATE t SET x = 1 -- trailing",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("splitStatements = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("statement %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/schema"
+)
+
+type referencingFetcher struct {
+	staticFetcher
+	refs map[string][]schema.Reference
+}
+
+func (f referencingFetcher) References(_ context.Context, table string) ([]schema.Reference, error) {
+	return f.refs[table], nil
+}
+
+func TestGenerateMigrationSQL_PreserveColumnOrder(t *testing.T) {
+	t.Parallel()
+
+	old := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+			{ColumnName: "name", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+		},
+	}
+	schemas := map[string]migrate.TableSchema{
+		"users": {
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+				{ColumnName: "email", Idx: 1, Attrs: migrate.ColumnAttributes{PgType: "text"}},
+				{ColumnName: "name", Idx: 2, Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			},
+		},
+	}
+	fetcher := referencingFetcher{
+		staticFetcher: staticFetcher{"users": old},
+		refs: map[string][]schema.Reference{"users": {{
+			Table: "orders",
+			Column: migrate.ColumnMeta{
+				ColumnName: "user_id",
+				Attrs:      migrate.ColumnAttributes{ForeignKey: &migrate.ForeignKey{Table: "users", Column: "id"}},
+			},
+		}}},
+	}
+
+	for _, preserve := range []bool{false, true} {
+		m := &Migrator{config: &config.Config{Migrations: config.MigrationsConfig{PreserveColumnOrder: preserve}}}
+		plan := recordingDiffs{}
+		changes, err := m.generateMigrationSQL(context.Background(), fetcher, []string{"users"}, schemas, discardSink{}, GenerateOptions{Plan: plan})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 1 {
+			t.Fatalf("expected one change, got %d", len(changes))
+		}
+
+		up := strings.Join(plan["users"].Up, "\n")
+		rebuilt := strings.Contains(up, `CREATE TABLE "users__rebuild" AS TABLE "users"`)
+		if rebuilt != preserve {
+			t.Fatalf("preserve_column_order=%v: rebuild=%v in:\n%s", preserve, rebuilt, up)
+		}
+		if preserve {
+			if changes[0].Type != RebuildTable {
+				t.Fatalf("expected change type %s, got %s", RebuildTable, changes[0].Type)
+			}
+			if !strings.Contains(up, `ALTER TABLE "orders" DROP CONSTRAINT IF EXISTS "fk_orders_user_id"`) {
+				t.Fatalf("referencing foreign key must be dropped during the rebuild:\n%s", up)
+			}
+		} else if !strings.Contains(up, `ADD COLUMN IF NOT EXISTS "email"`) {
+			t.Fatalf("expected the column to be appended:\n%s", up)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// tableLister is implemented by schema.Fetcher. Without it, close matches
+// for an unknown foreign key table are only looked up among entities.
+type tableLister interface {
+	ListTables(ctx context.Context) ([]string, error)
+}
+
+// checkForeignKeys reports foreign keys whose table is neither an entity nor
+// a table in the database, or whose column that table does not have. A
+// referenced entity must declare the column; a table outside the registry is
+// fetched from the database. Codes ignored on the table or column are
+// skipped.
+func (m *Migrator) checkForeignKeys(
+	ctx context.Context,
+	fetcher schemaFetcher,
+	tables []string,
+	newSchemas map[string]migrate.TableSchema,
+) ([]diagnostics.Diagnostic, error) {
+	live := make(map[string]migrate.TableSchema)
+	var liveTables []string
+	listed := false
+
+	var found []diagnostics.Diagnostic
+	for _, table := range tables {
+		s := migrate.NormalizeSchema(newSchemas[table])
+		for _, col := range s.Columns {
+			fk := col.Attrs.ForeignKey
+			if fk == nil || diagnostics.Ignored(col.Ignore, diagnostics.UnknownReference) ||
+				diagnostics.Ignored(s.Ignore, diagnostics.UnknownReference) {
+				continue
+			}
+
+			target, declared := newSchemas[fk.Table]
+			if !declared {
+				var ok bool
+				if target, ok = live[fk.Table]; !ok {
+					var err error
+					if target, err = fetcher.Fetch(ctx, fk.Table); err != nil {
+						return nil, fmt.Errorf("failed to fetch schema for referenced table %s: %w", fk.Table, err)
+					}
+					live[fk.Table] = target
+				}
+			}
+
+			field := table + "." + col.ColumnName
+			if col.FieldName != "" {
+				field = table + "." + col.FieldName
+			}
+
+			var d diagnostics.Diagnostic
+			switch {
+			case !declared && len(target.Columns) == 0:
+				if !listed {
+					if lister, ok := fetcher.(tableLister); ok {
+						names, err := lister.ListTables(ctx)
+						if err != nil {
+							return nil, fmt.Errorf("failed to list tables: %w", err)
+						}
+						liveTables = names
+					}
+					listed = true
+				}
+				d = diagnostics.Errorf(diagnostics.UnknownReference,
+					"%s: foreign key references table %q, which is neither an entity nor a table in the database%s",
+					field, fk.Table, didYouMean(fk.Table, append(sortedKeys(newSchemas), liveTables...)))
+			case !hasColumn(target, fk.Column):
+				where := "entity"
+				if !declared {
+					where = "table"
+				}
+				d = diagnostics.Errorf(diagnostics.UnknownReference,
+					"%s: foreign key references column %q, which %s %q does not have%s",
+					field, fk.Column, where, fk.Table, didYouMean(fk.Column, columnNames(target)))
+			default:
+				continue
+			}
+			if col.FilePath != "" {
+				d = d.At(col.FilePath, col.Line)
+			}
+			m.report(d)
+			found = append(found, d)
+		}
+	}
+	return found, nil
+}
+
+func hasColumn(s migrate.TableSchema, name string) bool {
+	for _, c := range s.Columns {
+		if c.ColumnName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func columnNames(s migrate.TableSchema) []string {
+	names := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		names[i] = c.ColumnName
+	}
+	return names
+}
+
+// didYouMean formats up to three candidates close to name as a suggestion,
+// or returns "" when none is close.
+func didYouMean(name string, candidates []string) string {
+	matches := closestNames(name, candidates, 3)
+	if len(matches) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(matches))
+	for i, c := range matches {
+		quoted[i] = fmt.Sprintf("%q", c)
+	}
+	return "; did you mean " + strings.Join(quoted, " or ") + "?"
+}
+
+// closestNames returns at most limit distinct candidates within an edit
+// distance of a third of name's length (at least two), closest first.
+func closestNames(name string, candidates []string, limit int) []string {
+	maxDist := len(name) / 3
+	if maxDist < 2 {
+		maxDist = 2
+	}
+
+	type match struct {
+		name string
+		dist int
+	}
+	var matches []match
+	seen := make(map[string]bool, len(candidates))
+	lower := strings.ToLower(name)
+	for _, c := range candidates {
+		if seen[c] || c == name {
+			continue
+		}
+		seen[c] = true
+		if d := editDistance(lower, strings.ToLower(c)); d <= maxDist {
+			matches = append(matches, match{c, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	var out []string
+	for i := 0; i < len(matches) && i < limit; i++ {
+		out = append(out, matches[i].name)
+	}
+	return out
+}
+
+// editDistance is the Levenshtein distance between a and b, in bytes.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+type listingFetcher struct {
+	staticFetcher
+}
+
+func (f listingFetcher) ListTables(context.Context) ([]string, error) {
+	return sortedKeys(f.staticFetcher), nil
+}
+
+func referencingSchemas(fk migrate.ForeignKey, ignore ...string) map[string]migrate.TableSchema {
+	return map[string]migrate.TableSchema{
+		"partner": {
+			TableName: "partner",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+			},
+		},
+		"orders": {
+			TableName: "orders",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+				{
+					FieldName:  "PartnerID",
+					ColumnName: "partner_id",
+					Idx:        1,
+					Ignore:     ignore,
+					FilePath:   "domain/order.go",
+					Line:       12,
+					Attrs:      migrate.ColumnAttributes{PgType: "uuid", ForeignKey: &fk},
+				},
+			},
+		},
+	}
+}
+
+func TestGenerateMigrationSQL_UnknownForeignKeyTarget(t *testing.T) {
+	t.Parallel()
+
+	fetcher := listingFetcher{staticFetcher{
+		"partners_archive": {TableName: "partners_archive", Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid"}},
+		}},
+	}}
+
+	tests := []struct {
+		name string
+		fk   migrate.ForeignKey
+		want []string
+	}{
+		{
+			name: "misspelled entity table",
+			fk:   migrate.ForeignKey{Table: "partners", Column: "id"},
+			want: []string{"domain/order.go:12", string(diagnostics.UnknownReference), "orders.PartnerID", `table "partners"`, `did you mean "partner"?`},
+		},
+		{
+			name: "misspelled entity column",
+			fk:   migrate.ForeignKey{Table: "partner", Column: "idd"},
+			want: []string{`column "idd", which entity "partner" does not have`, `did you mean "id"?`},
+		},
+		{
+			name: "misspelled database column",
+			fk:   migrate.ForeignKey{Table: "partners_archive", Column: "uid"},
+			want: []string{`column "uid", which table "partners_archive" does not have`, `did you mean "id"?`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := &Migrator{config: &config.Config{}}
+			_, err := m.generateMigrationSQL(context.Background(), fetcher, []string{"partner", "orders"},
+				referencingSchemas(tt.fk), discardSink{}, GenerateOptions{Plan: recordingDiffs{}})
+			if err == nil {
+				t.Fatal("expected an error for the unknown foreign key target")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateMigrationSQL_ForeignKeyToDatabaseTable(t *testing.T) {
+	t.Parallel()
+
+	fetcher := staticFetcher{
+		"partners_archive": {TableName: "partners_archive", Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid"}},
+		}},
+	}
+
+	for _, tc := range []struct {
+		fk     migrate.ForeignKey
+		ignore []string
+	}{
+		{fk: migrate.ForeignKey{Table: "partners_archive", Column: "id"}},
+		{fk: migrate.ForeignKey{Table: "external", Column: "id"}, ignore: []string{string(diagnostics.UnknownReference)}},
+	} {
+		m := &Migrator{config: &config.Config{}}
+		_, err := m.generateMigrationSQL(context.Background(), fetcher, []string{"partner", "orders"},
+			referencingSchemas(tc.fk, tc.ignore...), discardSink{}, GenerateOptions{Plan: recordingDiffs{}})
+		if err != nil {
+			t.Errorf("fk to %s: %v", tc.fk.Table, err)
+		}
+	}
+}
+
+func TestClosestNames(t *testing.T) {
+	t.Parallel()
+
+	candidates := []string{"partner", "partners_v2", "payments", "orders", "partnrs", "partner"}
+	if got, want := closestNames("partners", candidates, 3), []string{"partner", "partnrs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("closestNames = %v, want %v", got, want)
+	}
+	if got := closestNames("users", candidates, 3); got != nil {
+		t.Errorf("expected no matches, got %v", got)
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Repair actions.
+const (
+	RepairRemoved  = "removed"
+	RepairRenamed  = "renamed"
+	RepairRehashed = "rehashed"
+)
+
+// RepairAction is one change Repair makes to the migrations table.
+type RepairAction struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	// To is the new name of a renamed migration.
+	To string `json:"to,omitempty"`
+}
+
+// Repair reconciles the migrations table with the migration files:
+//
+//   - an applied migration whose file was renamed (found by the checksum of
+//     its up SQL among pending migrations) is recorded under the new name;
+//   - an applied migration whose file was deleted is removed from history;
+//   - an applied migration whose file was edited is recorded with the new
+//     checksum.
+//
+// Repair never runs migration SQL. With dryRun only the planned actions are
+// returned.
+func (m *Migrator) Repair(ctx context.Context, dryRun bool) ([]RepairAction, error) {
+	migrations, err := m.scanMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+	applied, err := m.db.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	recorded, err := m.db.GetAppliedChecksums(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied checksums: %w", err)
+	}
+
+	appliedSet := make(map[string]bool, len(applied))
+	for _, a := range applied {
+		appliedSet[a] = true
+	}
+
+	onDisk := make(map[string]string, len(migrations))
+	pendingBySum := make(map[string][]string)
+	for _, mig := range migrations {
+		content, err := m.readMigration(mig, true)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", mig.path(true), err)
+		}
+		sum := checksum(content)
+		onDisk[mig.Base] = sum
+		if !appliedSet[mig.Base] {
+			pendingBySum[sum] = append(pendingBySum[sum], mig.Base)
+		}
+	}
+
+	var actions []RepairAction
+	for _, name := range applied {
+		sum, ok := onDisk[name]
+		if ok {
+			if recorded[name] != sum {
+				actions = append(actions, RepairAction{Action: RepairRehashed, Name: name})
+			}
+			continue
+		}
+
+		candidates := pendingBySum[recorded[name]]
+		switch {
+		case recorded[name] == "" || len(candidates) == 0:
+			actions = append(actions, RepairAction{Action: RepairRemoved, Name: name})
+		case len(candidates) == 1:
+			actions = append(actions, RepairAction{Action: RepairRenamed, Name: name, To: candidates[0]})
+			delete(pendingBySum, recorded[name])
+		default:
+			sort.Strings(candidates)
+			return nil, fmt.Errorf("applied migration %s matches several renamed files (%v); rename the history row by hand", name, candidates)
+		}
+	}
+
+	if dryRun {
+		return actions, nil
+	}
+	for i, a := range actions {
+		var err error
+		switch a.Action {
+		case RepairRemoved:
+			err = m.db.RemoveMigration(ctx, a.Name)
+		case RepairRenamed:
+			err = m.db.RenameMigration(ctx, a.Name, a.To)
+		case RepairRehashed:
+			err = m.db.UpdateChecksum(ctx, a.Name, onDisk[a.Name])
+		}
+		if err != nil {
+			return actions[:i], fmt.Errorf("repair %s: %w", a.Name, err)
+		}
+	}
+	return actions, nil
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+)
+
+func TestRepair(t *testing.T) {
+	t.Parallel()
+
+	exec := &fakeExecutor{
+		applied: []string{"001__kept", "002__old_name", "003__deleted", "004__edited"},
+		checksums: map[string]string{
+			"001__kept":     checksum([]byte("SELECT 1;")),
+			"002__old_name": checksum([]byte("SELECT 2;")),
+			"003__deleted":  checksum([]byte("SELECT 3;")),
+			"004__edited":   checksum([]byte("SELECT 4;")),
+		},
+	}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{
+		"001__kept.up.sql":     {Data: []byte("SELECT 1;")},
+		"002__new_name.up.sql": {Data: []byte("SELECT 2;")},
+		"004__edited.up.sql":   {Data: []byte("SELECT 4; -- fixed")},
+		"005__pending.up.sql":  {Data: []byte("SELECT 5;")},
+	})
+
+	actions, err := m.Repair(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RepairAction{
+		{Action: RepairRenamed, Name: "002__old_name", To: "002__new_name"},
+		{Action: RepairRemoved, Name: "003__deleted"},
+		{Action: RepairRehashed, Name: "004__edited"},
+	}
+	if len(actions) != len(want) {
+		t.Fatalf("Repair = %+v, want %+v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("Repair = %+v, want %+v", actions, want)
+		}
+	}
+	if n := historyUpdates(exec.execs); n != 0 {
+		t.Fatalf("dry run made %d history updates", n)
+	}
+
+	if _, err := m.Repair(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if n := historyUpdates(exec.execs); n != 3 {
+		t.Fatalf("expected 3 history updates, got %q", exec.execs)
+	}
+}
+
+func historyUpdates(execs []string) int {
+	var n int
+	for _, q := range execs {
+		if strings.HasPrefix(q, "UPDATE") || strings.HasPrefix(q, "DELETE") {
+			n++
+		}
+	}
+	return n
+}
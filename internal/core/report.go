@@ -0,0 +1,190 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// Report is the migration state of a branch, for a pull request comment:
+// the migration files not applied yet and the entity changes no migration
+// covers yet.
+type Report struct {
+	Pending []ReportMigration `json:"pending"`
+	Changes []ReportChange    `json:"changes"`
+	// DriftSkipped explains why Changes were not computed.
+	DriftSkipped string `json:"drift_skipped,omitempty"`
+}
+
+// ReportMigration is a pending migration file.
+type ReportMigration struct {
+	PendingMigration
+	Destructive bool `json:"destructive"`
+}
+
+// ReportChange is a table whose entity differs from the database.
+type ReportChange struct {
+	TableChange
+	SQL         []string `json:"sql"`
+	Destructive bool     `json:"destructive"`
+}
+
+// HasDestructive reports whether any migration or change loses data.
+func (r *Report) HasDestructive() bool {
+	for _, p := range r.Pending {
+		if p.Destructive {
+			return true
+		}
+	}
+	for _, c := range r.Changes {
+		if c.Destructive {
+			return true
+		}
+	}
+	return false
+}
+
+// Report collects the pending migrations and, when none is pending, the
+// entity changes generate would turn into a migration. With analyze the
+// changes report the locks they take. Nothing is written.
+func (m *Migrator) Report(ctx context.Context, analyze bool) (*Report, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Pending: []ReportMigration{}, Changes: []ReportChange{}}
+	for _, p := range pending {
+		report.Pending = append(report.Pending, ReportMigration{PendingMigration: p, Destructive: isDestructive(p.SQL)})
+	}
+
+	switch {
+	case len(pending) > 0:
+		report.DriftSkipped = "entity changes are compared once the pending migrations are applied"
+		return report, nil
+	case m.config == nil || len(m.config.Registry) == 0:
+		report.DriftSkipped = "no entities are registered"
+		return report, nil
+	}
+
+	collect := &reportCollector{report: report}
+	if _, err := m.Generate(ctx, GenerateOptions{DryRun: true, Analyze: analyze, Plan: collect}); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// reportCollector is the PlanWriter gathering the changes of a Report.
+type reportCollector struct {
+	report *Report
+}
+
+func (c *reportCollector) WriteTable(change TableChange, diff migrate.TableDiff) error {
+	sql := append(append([]string{}, diff.Up...), diff.PostUp...)
+	destructive := change.Type == DropTable || change.Type == DropColumns || isDestructive(strings.Join(sql, ";\n"))
+	c.report.Changes = append(c.report.Changes, ReportChange{TableChange: change, SQL: sql, Destructive: destructive})
+	return nil
+}
+
+const destructiveBadge = "🔴 **destructive**"
+
+// WriteMarkdownReport renders r as a pull request comment: a summary line,
+// a table of pending migrations and a list of entity changes, each with
+// its SQL in a collapsed section and a badge when it loses data.
+func WriteMarkdownReport(w io.Writer, r *Report) error {
+	var b strings.Builder
+	b.WriteString("## Migration report\n\n")
+
+	summary := []string{
+		fmt.Sprintf("**%d** pending %s", len(r.Pending), plural(len(r.Pending), "migration", "migrations")),
+		fmt.Sprintf("**%d** %s changed by entities", len(r.Changes), plural(len(r.Changes), "table", "tables")),
+	}
+	if r.HasDestructive() {
+		summary = append(summary, destructiveBadge+" changes")
+	}
+	b.WriteString(strings.Join(summary, " · ") + "\n")
+
+	if len(r.Pending) > 0 {
+		b.WriteString("\n### Pending migrations\n\n| Migration | Statements | |\n|---|---|---|\n")
+		for _, p := range r.Pending {
+			fmt.Fprintf(&b, "| `%s` | %d | %s |\n", p.Migration, p.Statements, badge(p.Destructive))
+		}
+		for _, p := range r.Pending {
+			writeSQLDetails(&b, p.Migration, p.SQL)
+		}
+	}
+
+	b.WriteString("\n### Entity changes without a migration\n\n")
+	switch {
+	case r.DriftSkipped != "":
+		fmt.Fprintf(&b, "_Not checked: %s._\n", r.DriftSkipped)
+	case len(r.Changes) == 0:
+		b.WriteString("Entities match the database schema.\n")
+	default:
+		for _, c := range r.Changes {
+			fmt.Fprintf(&b, "- `%s`: %s", c.TableName, c.Type)
+			if c.Details != "" {
+				fmt.Fprintf(&b, " (%s)", c.Details)
+			}
+			if c.Owner != "" {
+				fmt.Fprintf(&b, ", owner %s", c.Owner)
+			}
+			if c.Destructive {
+				b.WriteString(" " + destructiveBadge)
+			}
+			b.WriteString("\n")
+			if c.Impact != nil {
+				for _, s := range c.Impact.Statements {
+					if s.Lock == "" {
+						continue
+					}
+					fmt.Fprintf(&b, "  - `%s` takes %s", summarizeStatement(s.Statement), s.Lock)
+					switch {
+					case s.Rewrite:
+						b.WriteString(", rewrites the table")
+					case s.Scan:
+						b.WriteString(", scans the table")
+					}
+					if c.Impact.Rows >= 0 {
+						fmt.Fprintf(&b, " (~%d rows)", c.Impact.Rows)
+					}
+					b.WriteString("\n")
+				}
+			}
+		}
+		for _, c := range r.Changes {
+			writeSQLDetails(&b, c.TableName, strings.Join(c.SQL, ";\n")+";")
+		}
+		b.WriteString("\nRun `migrateme generate` to create the migration.\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func badge(destructive bool) string {
+	if destructive {
+		return destructiveBadge
+	}
+	return ""
+}
+
+// writeSQLDetails writes sql as a collapsed section, with a code fence
+// longer than any backtick run in it.
+func writeSQLDetails(b *strings.Builder, title, sql string) {
+	fence := "```"
+	for strings.Contains(sql, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(b, "\n<details><summary><code>%s</code> SQL</summary>\n\n%ssql\n%s\n%s\n\n</details>\n",
+		title, fence, strings.TrimSpace(sql), fence)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteMarkdownReport(t *testing.T) {
+	t.Parallel()
+
+	r := &Report{
+		Pending: []ReportMigration{
+			{PendingMigration: PendingMigration{Migration: "0002__drop_legacy", Statements: 1, SQL: "DROP TABLE legacy;"}, Destructive: true},
+			{PendingMigration: PendingMigration{Migration: "0003__fn", Statements: 1, SQL: "SELECT '```';"}},
+		},
+		DriftSkipped: "entity changes are compared once the pending migrations are applied",
+	}
+	var b strings.Builder
+	if err := WriteMarkdownReport(&b, r); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"**2** pending migrations",
+		destructiveBadge + " changes",
+		"| `0002__drop_legacy` | 1 | " + destructiveBadge + " |",
+		"<details><summary><code>0002__drop_legacy</code> SQL</summary>\n\n```sql\nDROP TABLE legacy;\n```\n\n</details>",
+		"````sql\nSELECT '```';\n````",
+		"_Not checked: entity changes are compared",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteMarkdownReport_Changes(t *testing.T) {
+	t.Parallel()
+
+	r := &Report{Changes: []ReportChange{{
+		TableChange: TableChange{TableName: "users", Type: AddColumns, Details: "email", Owner: "@identity"},
+		SQL:         []string{"ALTER TABLE users ADD COLUMN email TEXT"},
+	}}}
+	var b strings.Builder
+	if err := WriteMarkdownReport(&b, r); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	if !strings.Contains(out, "- `users`: add_columns (email), owner @identity\n") || strings.Contains(out, destructiveBadge) {
+		t.Errorf("unexpected change listing:\n%s", out)
+	}
+	if !strings.Contains(out, "Run `migrateme generate`") {
+		t.Errorf("report does not say how to cover the changes:\n%s", out)
+	}
+}
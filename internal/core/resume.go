@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/database"
+)
+
+// noTransactionDirective marks a migration whose statements must not run in
+// a transaction, e.g. CREATE INDEX CONCURRENTLY. Its statements are applied
+// one by one and each success is recorded, so that a migration failing part
+// way can be resumed after the failed statement instead of starting over.
+const noTransactionDirective = "-- migrateme:no_transaction"
+
+var transactionControlRE = regexp.MustCompile(`(?i)^(BEGIN|START\s+TRANSACTION|COMMIT|END|ROLLBACK)\b`)
+
+// hasTransactionControl reports whether a statement of sql begins or ends a
+// transaction.
+func hasTransactionControl(sql string) bool {
+	for _, stmt := range splitStatements(sql) {
+		if transactionControlRE.MatchString(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNoTransaction reports whether content carries the no_transaction
+// directive on a line of its own.
+func isNoTransaction(content []byte) bool {
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == noTransactionDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// execMigration runs the SQL of a migration the way run applies it, but
+// records nothing: a no_transaction migration statement by statement, since
+// Postgres runs a query of several statements in an implicit transaction
+// and CREATE INDEX CONCURRENTLY refuses that, any other as one query.
+func execMigration(ctx context.Context, db *database.DB, sql string, noTx bool) error {
+	if !noTx {
+		return db.Exec(ctx, sql)
+	}
+	for i, stmt := range splitStatements(sql) {
+		if err := db.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// PartialMigrationError reports a no_transaction migration of which some
+// statements were applied before one failed.
+type PartialMigrationError struct {
+	Migration string
+	// Done of the Total statements succeeded.
+	Done, Total int
+}
+
+func (e *PartialMigrationError) Error() string {
+	return fmt.Sprintf("migration %s was partially applied (%d of %d statements); "+
+		"fix the cause and run again with --resume to continue after the last successful statement",
+		e.Migration, e.Done, e.Total)
+}
+
+// applyStatements applies a no_transaction migration statement by statement,
+// each in its own implicit transaction, recording every success. A migration
+// with recorded statements is only continued with RunOptions.Resume, which
+// skips them; a recorded statement that changed since fails the run, as the
+// database may no longer match the file.
+func (m *Migrator) applyStatements(ctx context.Context, base, sql string, opts RunOptions, onRetry database.RetryFunc) error {
+	stmts := splitStatements(sql)
+	for _, stmt := range stmts {
+		if transactionControlRE.MatchString(stmt) {
+			return fmt.Errorf("migration %s is marked no_transaction but contains %q", base, strings.Fields(stmt)[0])
+		}
+	}
+
+	done, err := m.db.GetStatementProgress(ctx, base)
+	if err != nil {
+		return fmt.Errorf("failed to get statement progress of %s: %w", base, err)
+	}
+	if len(done) > 0 && !opts.Resume {
+		return &PartialMigrationError{Migration: base, Done: len(done), Total: len(stmts)}
+	}
+
+	for i, stmt := range stmts {
+		sum := checksum([]byte(stmt))
+		if prev, ok := done[i]; ok {
+			if prev != sum {
+				return fmt.Errorf("statement %d of %s changed after it had been applied; "+
+					"revert it by hand and clear its progress before resuming", i+1, base)
+			}
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("stopped before statement %d of %d: %w", i+1, len(stmts), err)
+		}
+
+		start := time.Now()
+		err := m.lockRetryPolicy().Do(ctx, func() error {
+			return m.db.Exec(ctx, stmt)
+		}, database.IsLockContention, onRetry)
+		if opts.Profile != nil && err == nil {
+			opts.Profile.Statements = append(opts.Profile.Statements, StatementTiming{
+				Migration: base, Index: i + 1, SQL: stmt, Duration: time.Since(start),
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("statement %d of %d failed after %d succeeded, run again with --resume once fixed: %w",
+				i+1, len(stmts), len(done), err)
+		}
+		if err := m.db.RecordStatement(context.WithoutCancel(ctx), base, i, sum); err != nil {
+			return fmt.Errorf("record statement %d: %w", i+1, err)
+		}
+		done[i] = sum
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+)
+
+const noTxMigration = `-- migrateme:no_transaction
+CREATE INDEX CONCURRENTLY users_email ON users (email);
+CREATE INDEX CONCURRENTLY users_name ON users (name);
+`
+
+func TestRun_ResumesNoTransactionMigration(t *testing.T) {
+	t.Parallel()
+
+	second := "CREATE INDEX CONCURRENTLY users_name ON users (name)"
+	exec := &fakeExecutor{fail: map[string][]error{second: {errors.New("could not create unique index")}}}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{"001__idx.up.sql": {Data: []byte(noTxMigration)}})
+
+	if _, err := m.Run(context.Background(), RunOptions{}); err == nil || !strings.Contains(err.Error(), "--resume") {
+		t.Fatalf("expected the failure to point at --resume, got %v", err)
+	}
+	if len(exec.progress["001__idx"]) != 1 {
+		t.Fatalf("recorded progress %v, want the first statement", exec.progress)
+	}
+
+	// A plain rerun refuses to start the migration over.
+	var partial *PartialMigrationError
+	if _, err := m.Run(context.Background(), RunOptions{}); !errors.As(err, &partial) || partial.Done != 1 || partial.Total != 2 {
+		t.Fatalf("expected a partial migration error, got %v", err)
+	}
+
+	exec.execs = nil
+	applied, err := m.Run(context.Background(), RunOptions{Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0] != "001__idx" {
+		t.Fatalf("Run applied %v, want [001__idx]", applied)
+	}
+	for _, q := range exec.execs {
+		if strings.Contains(q, "users_email") {
+			t.Fatalf("resume re-executed the first statement: %v", exec.execs)
+		}
+	}
+	if _, ok := exec.progress["001__idx"]; ok {
+		t.Fatalf("progress of the applied migration was not cleared: %v", exec.progress)
+	}
+}
+
+func TestRun_ResumeRejectsChangedStatement(t *testing.T) {
+	t.Parallel()
+
+	exec := &fakeExecutor{progress: map[string]map[int]string{"001__idx": {0: "stale"}}}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{"001__idx.up.sql": {Data: []byte(noTxMigration)}})
+
+	if _, err := m.Run(context.Background(), RunOptions{Resume: true}); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Fatalf("expected a changed statement error, got %v", err)
+	}
+}
+
+func TestRun_NoTransactionRejectsTransactionControl(t *testing.T) {
+	t.Parallel()
+
+	exec := &fakeExecutor{}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{"001__a.up.sql": {Data: []byte("-- migrateme:no_transaction\nBEGIN;\nSELECT 1;\nCOMMIT;\n")}})
+
+	if _, err := m.Run(context.Background(), RunOptions{}); err == nil || !strings.Contains(err.Error(), "no_transaction") {
+		t.Fatalf("expected a transaction control error, got %v", err)
+	}
+}
+
+func TestExecMigration(t *testing.T) {
+	t.Parallel()
+
+	sql := "CREATE INDEX CONCURRENTLY a_x ON a (x);\nCREATE INDEX CONCURRENTLY a_y ON a (y);"
+
+	exec := &fakeExecutor{}
+	if err := execMigration(context.Background(), database.New(exec), sql, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(exec.execs) != 2 || !strings.HasPrefix(exec.execs[1], "CREATE INDEX CONCURRENTLY a_y") {
+		t.Errorf("no_transaction migration ran as %q, want one query per statement", exec.execs)
+	}
+
+	exec = &fakeExecutor{fail: map[string][]error{"CREATE INDEX CONCURRENTLY a_y ON a (y)": {errors.New("boom")}}}
+	err := execMigration(context.Background(), database.New(exec), sql, true)
+	if err == nil || !strings.Contains(err.Error(), "statement 2") {
+		t.Errorf("expected statement 2 to fail, got %v", err)
+	}
+
+	exec = &fakeExecutor{}
+	if err := execMigration(context.Background(), database.New(exec), sql, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(exec.execs) != 1 {
+		t.Errorf("transactional migration ran as %q, want one query", exec.execs)
+	}
+}
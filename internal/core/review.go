@@ -0,0 +1,52 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// FormatTableDiff renders a table diff for editing by hand, as a single-file
+// migration with -- +migrate Up/Down sections. Statements that close
+// reference cycles are left out; EditTableDiff keeps them unchanged.
+func FormatTableDiff(change TableChange, diff migrate.TableDiff) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Table %s (%s). Edit the statements below; an empty Up section skips the table.\n", change.TableName, change.Type)
+	b.WriteString("-- +migrate Up\n")
+	for _, stmt := range diff.Up {
+		b.WriteString(stmt + ";\n")
+	}
+	b.WriteString("\n-- +migrate Down\n")
+	for _, stmt := range diff.Down {
+		b.WriteString(stmt + ";\n")
+	}
+	return b.String()
+}
+
+// EditTableDiff replaces the up and down statements of diff with the
+// sections of text, as produced by FormatTableDiff and edited by the user.
+// Each section becomes a single statement block.
+func EditTableDiff(diff migrate.TableDiff, text string) (migrate.TableDiff, error) {
+	up, down, err := parseSections([]byte(text))
+	if err != nil {
+		return migrate.TableDiff{}, err
+	}
+
+	diff.Up = statementBlock(string(up))
+	diff.Down = statementBlock(string(down))
+	if len(diff.Up) == 0 {
+		return migrate.TableDiff{}, nil
+	}
+	return diff, nil
+}
+
+// statementBlock turns edited SQL into a statement list for the migration
+// writers, which terminate every statement with a semicolon themselves.
+func statementBlock(sql string) []string {
+	sql = strings.TrimRight(strings.TrimSpace(sql), ";")
+	if strings.TrimSpace(sql) == "" {
+		return nil
+	}
+	return []string{sql}
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestEditTableDiff_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	change := TableChange{TableName: "users", Type: CreateTable}
+	diff := migrate.TableDiff{
+		Up:     []string{`CREATE TABLE "users" ("id" uuid)`, `CREATE INDEX ON "users" ("id")`},
+		Down:   []string{`DROP TABLE "users"`},
+		PostUp: []string{`ALTER TABLE "users" ADD FOREIGN KEY ("id") REFERENCES "x" ("id")`},
+	}
+
+	text := FormatTableDiff(change, diff)
+	text = strings.Replace(text, `("id" uuid)`, `("id" uuid PRIMARY KEY)`, 1)
+
+	edited, err := EditTableDiff(diff, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edited.Up) != 1 || !strings.Contains(edited.Up[0], "PRIMARY KEY") || strings.HasSuffix(edited.Up[0], ";") {
+		t.Errorf("up = %q", edited.Up)
+	}
+	if len(edited.Down) != 1 || edited.Down[0] != `DROP TABLE "users"` {
+		t.Errorf("down = %q", edited.Down)
+	}
+	if len(edited.PostUp) != 1 {
+		t.Errorf("post-up statements were lost: %q", edited.PostUp)
+	}
+}
+
+func TestEditTableDiff_EmptyUpSkipsTable(t *testing.T) {
+	t.Parallel()
+
+	edited, err := EditTableDiff(migrate.TableDiff{Up: []string{"SELECT 1"}}, "-- +migrate Up\n\n-- +migrate Down\nSELECT 2;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !edited.IsEmpty() {
+		t.Errorf("expected an empty diff, got %+v", edited)
+	}
+}
+
+func TestGenerateMigrationSQL_Review(t *testing.T) {
+	t.Parallel()
+
+	m := &Migrator{config: &config.Config{}}
+	var reviewed []string
+	review := func(change TableChange, diff migrate.TableDiff) (migrate.TableDiff, bool, error) {
+		reviewed = append(reviewed, change.TableName)
+		if change.TableName == "users" {
+			return diff, false, nil
+		}
+		diff.Up = []string{"SELECT 'edited'"}
+		return diff, true, nil
+	}
+
+	var plan recordingPlan
+	changes, err := m.generateMigrationSQL(context.Background(), staticFetcher{}, []string{"users", "posts"}, testSchemas(), discardSink{}, GenerateOptions{Plan: &plan, Review: review})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviewed) != 2 {
+		t.Fatalf("reviewed %v, want both tables", reviewed)
+	}
+	if len(changes) != 1 || changes[0].TableName != "posts" {
+		t.Fatalf("expected only posts to be kept, got %+v", changes)
+	}
+	if up := plan.up["posts"]; len(up) != 1 || up[0] != "SELECT 'edited'" {
+		t.Fatalf("edited statements were not written: %q", up)
+	}
+
+	abort := errors.New("quit")
+	_, err = m.generateMigrationSQL(context.Background(), staticFetcher{}, []string{"users", "posts"}, testSchemas(), discardSink{}, GenerateOptions{
+		Review: func(TableChange, migrate.TableDiff) (migrate.TableDiff, bool, error) {
+			return migrate.TableDiff{}, false, abort
+		},
+	})
+	if !errors.Is(err, abort) {
+		t.Fatalf("expected the review error, got %v", err)
+	}
+}
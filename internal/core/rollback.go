@@ -2,9 +2,9 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
 	"strings"
 )
 
@@ -22,33 +22,56 @@ func (m *Migrator) Rollback(ctx context.Context, n int) ([]string, error) {
 		n = len(applied)
 	}
 
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+	byBase := make(map[string]migration, len(migrations))
+	for _, mig := range migrations {
+		byBase[mig.Base] = mig
+	}
+
 	toRollback := applied[len(applied)-n:]
 	var rolledBack []string
 
 	for i := len(toRollback) - 1; i >= 0; i-- {
 		base := toRollback[i]
-		downFile := base + ".down.sql"
-		downPath := filepath.Join(m.config.GetMigrationsDir(), downFile)
-
-		if _, err := os.Stat(downPath); os.IsNotExist(err) {
+		mig, ok := byBase[base]
+		if !ok {
+			mig = migration{Base: base}
+		}
+		downFile := mig.path(false)
+		content, err := m.readMigration(mig, false)
+		if errors.Is(err, fs.ErrNotExist) {
 			return rolledBack, fmt.Errorf("down file not found for migration: %s", base)
+		} else if err != nil {
+			return rolledBack, fmt.Errorf("read down file %s: %w", downFile, err)
 		}
 
-		content, err := os.ReadFile(downPath)
+		downSQL, err := m.renderSQL(downFile, content)
 		if err != nil {
-			return rolledBack, fmt.Errorf("read down file %s: %w", downFile, err)
+			return rolledBack, err
 		}
-
-		downSQL := string(content)
 		if strings.TrimSpace(downSQL) == "" {
 			return rolledBack, fmt.Errorf("migration %s has empty down file", base)
 		}
+		if downSQL, err = m.withTimeouts(downFile, content, downSQL); err != nil {
+			return rolledBack, err
+		}
 
-		if _, err := m.db.Pool.Exec(ctx, downSQL); err != nil {
+		if err := ctx.Err(); err != nil {
+			return rolledBack, fmt.Errorf("stopped before rolling back %s: %w", base, err)
+		}
+		if err := m.db.Exec(ctx, downSQL); err != nil {
+			if ctx.Err() != nil {
+				return rolledBack, fmt.Errorf("stopped while rolling back %s, its transaction was rolled back: %w", base, ctx.Err())
+			}
 			return rolledBack, fmt.Errorf("rollback %s: %w", base, err)
 		}
 
-		if err := m.db.RemoveMigration(ctx, base); err != nil {
+		// Once reverted, the migration is removed from the history even if
+		// ctx was canceled meanwhile.
+		if err := m.db.RemoveMigration(context.WithoutCancel(ctx), base); err != nil {
 			return rolledBack, fmt.Errorf("remove migration %s: %w", base, err)
 		}
 
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	schema2 "github.com/amr0ny/migrateme/pkg/schema"
+)
+
+// RoundtripResult is the outcome of testing one migration.
+type RoundtripResult struct {
+	Migration string `json:"migration"`
+	// Problem is empty when the migration passed.
+	Problem string `json:"problem,omitempty"`
+	// Differences are the schema changes that should not be there: what the
+	// down leaves behind, or what the second up does differently.
+	Differences []schema2.TableComparison `json:"differences,omitempty"`
+}
+
+// Roundtrip tests the down migrations of the pending migrations. Each one
+// is applied, reverted and applied again, and the schema is fetched after
+// every step: the down has to restore the schema from before the up, and
+// the second up has to produce the same schema as the first. The migrator
+// must work on a scratch database, since migrations are really applied and
+// reverted. onResult, when set, is called after each migration.
+//
+// It stops at the first migration whose SQL fails, as later ones depend on
+// it; a migration whose schemas differ is recorded and the next one tested.
+func (m *Migrator) Roundtrip(ctx context.Context, onResult func(RoundtripResult)) ([]RoundtripResult, error) {
+	if m.db.Pool == nil {
+		return nil, fmt.Errorf("testing migrations needs a pgx pool to read the schema")
+	}
+	if err := m.db.EnsureMigrationsTable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ensure migrations table: %w", err)
+	}
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+	applied, err := m.db.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	appliedSet := make(map[string]bool, len(applied))
+	for _, a := range applied {
+		appliedSet[a] = true
+	}
+
+	fetcher := schema2.NewFetcher(m.db.Pool)
+	results := []RoundtripResult{}
+	for _, mig := range migrations {
+		if appliedSet[mig.Base] {
+			continue
+		}
+		result, err := m.roundtrip(ctx, fetcher, mig)
+		if err != nil {
+			result.Problem = err.Error()
+		}
+		results = append(results, result)
+		if onResult != nil {
+			onResult(result)
+		}
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", mig.Base, err)
+		}
+	}
+	return results, nil
+}
+
+func (m *Migrator) roundtrip(ctx context.Context, fetcher *schema2.Fetcher, mig migration) (RoundtripResult, error) {
+	result := RoundtripResult{Migration: mig.Base}
+	up, upNoTx, err := m.migrationSQL(mig, true)
+	if err != nil {
+		return result, err
+	}
+	down, downNoTx, err := m.migrationSQL(mig, false)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && strings.TrimSpace(down) == "") {
+		return result, fmt.Errorf("migration has no down SQL")
+	} else if err != nil {
+		return result, err
+	}
+
+	before, err := snapshotSchema(ctx, fetcher)
+	if err != nil {
+		return result, err
+	}
+	if err := execMigration(ctx, m.db, up, upNoTx); err != nil {
+		return result, fmt.Errorf("up: %w", err)
+	}
+	afterUp, err := snapshotSchema(ctx, fetcher)
+	if err != nil {
+		return result, err
+	}
+	if err := execMigration(ctx, m.db, down, downNoTx); err != nil {
+		return result, fmt.Errorf("down: %w", err)
+	}
+	afterDown, err := snapshotSchema(ctx, fetcher)
+	if err != nil {
+		return result, err
+	}
+	if diff := schema2.Compare(before, afterDown); len(diff) > 0 {
+		result.Problem = "down does not restore the schema from before the up"
+		result.Differences = diff
+	}
+	redoStart := time.Now()
+	if err := execMigration(ctx, m.db, up, upNoTx); err != nil {
+		return result, fmt.Errorf("up after down: %w", err)
+	}
+	took := time.Since(redoStart)
+	afterRedo, err := snapshotSchema(ctx, fetcher)
+	if err != nil {
+		return result, err
+	}
+	if diff := schema2.Compare(afterUp, afterRedo); len(diff) > 0 && result.Problem == "" {
+		result.Problem = "up after down gives another schema than the first up"
+		result.Differences = diff
+	}
+
+	content, err := m.readMigration(mig, true)
+	if err != nil {
+		return result, err
+	}
+	if err := m.db.RecordMigration(ctx, database.MigrationRecord{Name: mig.Base, Checksum: checksum(content), Duration: took}); err != nil {
+		return result, fmt.Errorf("record migration: %w", err)
+	}
+	return result, nil
+}
+
+// migrationSQL returns the rendered up or down SQL of mig.
+func (m *Migrator) migrationSQL(mig migration, up bool) (sql string, noTx bool, err error) {
+	content, err := m.readMigration(mig, up)
+	if err != nil {
+		return "", false, err
+	}
+	sql, err = m.renderSQL(mig.path(up), content)
+	return sql, isNoTransaction(content), err
+}
+
+// snapshotSchema fetches every table of the database.
+func snapshotSchema(ctx context.Context, fetcher *schema2.Fetcher) ([]migrate.TableSchema, error) {
+	tables, err := fetcher.ListTables(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list tables: %w", err)
+	}
+	out := make([]migrate.TableSchema, 0, len(tables))
+	for _, table := range tables {
+		ts, err := fetcher.Fetch(ctx, table)
+		if err != nil {
+			return nil, fmt.Errorf("fetch %s: %w", table, err)
+		}
+		out = append(out, ts)
+	}
+	return out, nil
+}
@@ -2,24 +2,95 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
-func (m *Migrator) Run(ctx context.Context) ([]string, error) {
+type RunOptions struct {
+	// StrictChecksums refuses to run when applied migrations were modified.
+	StrictChecksums bool
+	// BlockDestructive refuses to apply migrations that drop tables, columns
+	// or schemas, or truncate tables.
+	BlockDestructive bool
+	// AllowOutOfOrder applies pending migrations that sort before the newest
+	// applied one instead of refusing to run.
+	AllowOutOfOrder bool
+	// OnRetry, when set, is called when a migration failed on a lock
+	// conflict and is about to be retried under migrations.lock_retry.
+	OnRetry func(migration string, attempt int, err error, wait time.Duration)
+	// Progress, when set, is called before and after every migration.
+	Progress func(MigrationProgress)
+	// Resume continues no_transaction migrations that failed part way after
+	// their last successful statement; without it such a migration stops
+	// the run with a *PartialMigrationError.
+	Resume bool
+	// Lock serializes runs against the same database with an advisory
+	// lock, so that replicas starting together apply migrations once. It
+	// needs a pgx pool.
+	Lock bool
+	// OnLockWait, when set, is called when another run holds the lock and
+	// Run starts waiting for it.
+	OnLockWait func()
+	// Profile, when set, receives the timing of every applied statement
+	// and the pg_stat_statements deltas of the run, also when it fails.
+	// Transactional migrations are then sent statement by statement on one
+	// connection instead of as one query, which needs a pgx pool.
+	Profile *Profile
+	// Parallel, when above 1, applies up to that many pending migrations
+	// at once on separate connections when the tables named in their
+	// statements are disjoint. Migrations sharing a table, and those whose
+	// tables cannot be told (functions, types, DO blocks, ...), still run
+	// in file order after the ones before them, and so do no_transaction
+	// migrations and those with their own BEGIN or COMMIT. The migrations
+	// applied together are committed only once all of them succeeded, and
+	// rolled back together otherwise. OnRetry may then be called
+	// concurrently. It needs a pgx pool.
+	Parallel int
+}
+
+// runLockName identifies the advisory lock that serializes runs against the
+// same database.
+const runLockName = "migrateme:run"
+
+func (m *Migrator) Run(ctx context.Context, opts RunOptions) ([]string, error) {
+	if opts.Lock {
+		release, err := m.lockRun(ctx, opts.OnLockWait)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
 	if err := m.db.EnsureMigrationsTable(ctx); err != nil {
 		return nil, fmt.Errorf("failed to ensure migrations table: %w", err)
 	}
 
-	files, err := m.getMigrationFiles()
+	found, err := m.Validate(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list migration files: %w", err)
+		return nil, err
+	}
+	if hasErrors(found) {
+		return nil, invalidFilesError(found)
+	}
+
+	modified, err := m.VerifyChecksums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(modified) > 0 && opts.StrictChecksums {
+		return nil, fmt.Errorf("applied migrations were modified: %s", strings.Join(modified, ", "))
 	}
 
-	upFiles := filterUpFiles(files)
-	migrationBases := extractMigrationBases(upFiles)
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
 
 	applied, err := m.db.GetAppliedMigrations(ctx)
 	if err != nil {
@@ -31,36 +102,399 @@ func (m *Migrator) Run(ctx context.Context) ([]string, error) {
 		appliedSet[a] = struct{}{}
 	}
 
-	var appliedNow []string
+	if !opts.AllowOutOfOrder {
+		if err := checkOrder(migrations, applied, appliedSet); err != nil {
+			return nil, err
+		}
+	}
 
-	for _, base := range migrationBases {
-		if _, ok := appliedSet[base]; ok {
-			continue
+	var pending []migration
+	for _, mig := range migrations {
+		if _, ok := appliedSet[mig.Base]; !ok {
+			pending = append(pending, mig)
 		}
+	}
 
-		upFile := base + ".up.sql"
-		upPath := filepath.Join(m.config.GetMigrationsDir(), upFile)
+	var batch int64
+	if len(pending) > 0 {
+		if batch, err = m.db.NextBatch(ctx); err != nil {
+			return nil, fmt.Errorf("failed to number the run: %w", err)
+		}
+	}
 
-		content, err := os.ReadFile(upPath)
-		if err != nil {
-			return appliedNow, fmt.Errorf("read up file %s: %w", upFile, err)
+	if opts.Parallel > 1 && m.db.Pool == nil && m.beginTx == nil {
+		return nil, fmt.Errorf("parallel apply needs a pgx pool")
+	}
+	if opts.Profile != nil && len(pending) > 0 {
+		if m.db.Pool == nil {
+			return nil, fmt.Errorf("profiling a run needs a pgx pool")
+		}
+		before, ok := readStatStatements(ctx, m.db.Pool)
+		opts.Profile.StatStatementsAvailable = ok
+		if ok {
+			defer func() {
+				if after, ok := readStatStatements(context.WithoutCancel(ctx), m.db.Pool); ok {
+					opts.Profile.StatStatements = after.deltas(before)
+				}
+			}()
 		}
+	}
 
-		upSQL := string(content)
-		if strings.TrimSpace(upSQL) == "" {
+	var appliedNow []string
+	var wave []*pendingRun
+	for i, mig := range pending {
+		p, err := m.preparePending(mig, opts)
+		if err == nil && p == nil {
 			continue
 		}
+		if err != nil || !joinsWave(wave, p, opts.Parallel) {
+			done, waveErr := m.applyWave(ctx, wave, batch, opts)
+			appliedNow = append(appliedNow, done...)
+			if waveErr != nil {
+				return appliedNow, waveErr
+			}
+			if err != nil {
+				return appliedNow, err
+			}
+			wave = nil
+		}
+		p.progress = MigrationProgress{Migration: mig.Base, Index: i + 1, Total: len(pending), Statements: countStatements(p.sql)}
+		wave = append(wave, p)
+	}
+	last, err := m.applyWave(ctx, wave, batch, opts)
+	return append(appliedNow, last...), err
+}
 
-		if _, err := m.db.Pool.Exec(ctx, upSQL); err != nil {
-			return appliedNow, fmt.Errorf("apply %s: %w", base, err)
+// pendingRun is a pending migration read and rendered for Run.
+type pendingRun struct {
+	mig      migration
+	content  []byte
+	sql      string
+	noTx     bool
+	progress MigrationProgress
+	// tables are the tables the migration touches; parallel is false when
+	// they are not known, and the migration is then applied alone.
+	tables   []string
+	parallel bool
+}
+
+// preparePending reads and renders mig, returning nil for an empty one.
+func (m *Migrator) preparePending(mig migration, opts RunOptions) (*pendingRun, error) {
+	upFile := mig.path(true)
+	content, err := m.readMigration(mig, true)
+	if err != nil {
+		return nil, fmt.Errorf("read up file %s: %w", upFile, err)
+	}
+
+	upSQL, err := m.renderSQL(upFile, content)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(upSQL) == "" {
+		return nil, nil
+	}
+	p := &pendingRun{mig: mig, content: content, noTx: isNoTransaction(content)}
+	p.tables, p.parallel = migrationTables(upSQL)
+	// A parallel migration runs in a transaction Run holds open, so it must
+	// not end that transaction or need to run outside of one.
+	p.parallel = p.parallel && !p.noTx && !concurrentlyRE.MatchString(upSQL) && !hasTransactionControl(upSQL)
+	if !p.noTx {
+		if upSQL, err = m.withTimeouts(upFile, content, upSQL); err != nil {
+			return nil, err
 		}
+	}
+	p.sql = upSQL
 
-		if err := m.db.RecordMigration(ctx, base); err != nil {
-			return appliedNow, fmt.Errorf("record migration %s: %w", base, err)
+	if opts.BlockDestructive && isDestructive(upSQL) {
+		return nil, fmt.Errorf("migration %s contains destructive statements", mig.Base)
+	}
+	return p, nil
+}
+
+// applyWave applies the migrations of wave, a single one as usual and
+// several concurrently with applyParallel, and records them in file order.
+func (m *Migrator) applyWave(ctx context.Context, wave []*pendingRun, batch int64, opts RunOptions) ([]string, error) {
+	if len(wave) == 0 {
+		return nil, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("stopped before applying %s: %w", wave[0].mig.Base, err)
+	}
+	if opts.Progress != nil {
+		for _, p := range wave {
+			opts.Progress(p.progress)
 		}
+	}
+	if len(wave) > 1 {
+		return m.applyParallel(ctx, wave, batch, opts)
+	}
 
-		appliedNow = append(appliedNow, base)
+	p := wave[0]
+	took, err := m.applyPending(ctx, p, opts)
+	if err != nil {
+		return nil, err
 	}
+	if err := m.recordApplied(ctx, p, took, batch, opts); err != nil {
+		return nil, err
+	}
+	return []string{p.mig.Base}, nil
+}
+
+// waveTx is the transaction a migration of a parallel wave is applied in.
+// It is held open until every migration of the wave succeeded.
+type waveTx interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
 
+// applyParallel applies the migrations of wave concurrently, each in a
+// transaction on a connection of its own. Once all of them succeeded they
+// are committed and recorded in file order; when any of them fails, all are
+// rolled back, so that the history never has an applied migration after a
+// pending one.
+func (m *Migrator) applyParallel(ctx context.Context, wave []*pendingRun, batch int64, opts RunOptions) ([]string, error) {
+	type result struct {
+		tx      waveTx
+		timings []StatementTiming
+		took    time.Duration
+		err     error
+	}
+	results := make([]result, len(wave))
+	var wg sync.WaitGroup
+	for i, p := range wave {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := &results[i]
+			r.tx, r.timings, r.took, r.err = m.beginPending(ctx, p, opts)
+		}()
+	}
+	wg.Wait()
+
+	rollback := func(from int) {
+		for _, r := range results[from:] {
+			if r.tx != nil {
+				r.tx.Rollback(context.WithoutCancel(ctx))
+			}
+		}
+	}
+	var firstErr error
+	for _, r := range results {
+		if opts.Profile != nil {
+			opts.Profile.Statements = append(opts.Profile.Statements, r.timings...)
+		}
+		if r.err != nil && firstErr == nil {
+			firstErr = r.err
+		}
+	}
+	if firstErr != nil {
+		rollback(0)
+		return nil, fmt.Errorf("%w; the migrations applied together with it were rolled back", firstErr)
+	}
+
+	var appliedNow []string
+	for i, p := range wave {
+		// As in a serial run, a migration that succeeded is committed and
+		// recorded even if ctx was canceled meanwhile.
+		if err := results[i].tx.Commit(context.WithoutCancel(ctx)); err != nil {
+			rollback(i + 1)
+			return appliedNow, fmt.Errorf("commit %s: %w", p.mig.Base, err)
+		}
+		if err := m.recordApplied(ctx, p, results[i].took, batch, opts); err != nil {
+			rollback(i + 1)
+			return appliedNow, err
+		}
+		appliedNow = append(appliedNow, p.mig.Base)
+	}
 	return appliedNow, nil
 }
+
+// beginPending applies p in a transaction of its own and leaves it open.
+func (m *Migrator) beginPending(ctx context.Context, p *pendingRun, opts RunOptions) (waveTx, []StatementTiming, time.Duration, error) {
+	var tx waveTx
+	var timings []StatementTiming
+	start := time.Now()
+	err := m.lockRetryPolicy().Do(ctx, func() error {
+		var err error
+		if tx, err = m.beginWaveTx(ctx); err != nil {
+			return err
+		}
+		if timings, err = execInTx(ctx, tx, p.mig.Base, p.sql, opts.Profile != nil); err != nil {
+			tx.Rollback(context.WithoutCancel(ctx))
+			tx = nil
+		}
+		return err
+	}, database.IsLockContention, retryFunc(p.mig.Base, opts))
+	took := time.Since(start)
+	if err != nil {
+		return nil, nil, took, applyError(ctx, p, err)
+	}
+	return tx, timings, took, nil
+}
+
+func (m *Migrator) beginWaveTx(ctx context.Context) (waveTx, error) {
+	if m.beginTx != nil {
+		return m.beginTx(ctx)
+	}
+	tx, err := m.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// execInTx runs sql in tx, as one query or, when profiling, statement by
+// statement with their timings.
+func execInTx(ctx context.Context, tx waveTx, base, sql string, profile bool) ([]StatementTiming, error) {
+	if !profile {
+		_, err := tx.Exec(ctx, sql)
+		return nil, err
+	}
+	var timings []StatementTiming
+	for i, stmt := range splitStatements(sql) {
+		start := time.Now()
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return nil, err
+		}
+		timings = append(timings, StatementTiming{Migration: base, Index: i + 1, SQL: stmt, Duration: time.Since(start)})
+	}
+	return timings, nil
+}
+
+// recordApplied records p as applied and reports it done.
+func (m *Migrator) recordApplied(ctx context.Context, p *pendingRun, took time.Duration, batch int64, opts RunOptions) error {
+	base := p.mig.Base
+	// Once applied, the migration is recorded even if ctx was canceled
+	// meanwhile, so the history matches the schema.
+	if err := m.db.RecordMigration(context.WithoutCancel(ctx), database.MigrationRecord{
+		Name: base, Checksum: checksum(p.content), Duration: took, Batch: batch,
+	}); err != nil {
+		return fmt.Errorf("record migration %s: %w", base, err)
+	}
+	if p.noTx {
+		if err := m.db.ClearStatementProgress(context.WithoutCancel(ctx), base); err != nil {
+			return fmt.Errorf("clear statement progress of %s: %w", base, err)
+		}
+	}
+	if opts.Progress != nil {
+		progress := p.progress
+		progress.Elapsed, progress.Done = took, true
+		opts.Progress(progress)
+	}
+	return nil
+}
+
+// applyPending applies one migration and returns how long it took.
+func (m *Migrator) applyPending(ctx context.Context, p *pendingRun, opts RunOptions) (time.Duration, error) {
+	base := p.mig.Base
+	onRetry := retryFunc(base, opts)
+
+	var err error
+	start := time.Now()
+	if p.noTx {
+		err = m.applyStatements(ctx, base, p.sql, opts, onRetry)
+	} else if opts.Profile != nil {
+		var timings []StatementTiming
+		err = m.lockRetryPolicy().Do(ctx, func() (err error) {
+			timings, err = execProfiled(ctx, m.db.Pool, base, p.sql)
+			return err
+		}, database.IsLockContention, onRetry)
+		opts.Profile.Statements = append(opts.Profile.Statements, timings...)
+	} else {
+		err = m.lockRetryPolicy().Do(ctx, func() error {
+			return m.db.Exec(ctx, p.sql)
+		}, database.IsLockContention, onRetry)
+	}
+	took := time.Since(start)
+	if err != nil {
+		return took, applyError(ctx, p, err)
+	}
+	return took, nil
+}
+
+// retryFunc reports lock retries of the migration base to opts.OnRetry.
+func retryFunc(base string, opts RunOptions) database.RetryFunc {
+	if opts.OnRetry == nil {
+		return nil
+	}
+	return func(attempt int, err error, wait time.Duration) { opts.OnRetry(base, attempt, err, wait) }
+}
+
+func applyError(ctx context.Context, p *pendingRun, err error) error {
+	var partial *PartialMigrationError
+	if errors.As(err, &partial) {
+		return err
+	}
+	if !p.noTx && ctx.Err() != nil {
+		return fmt.Errorf("stopped while applying %s, its transaction was rolled back: %w", p.mig.Base, ctx.Err())
+	}
+	return fmt.Errorf("apply %s: %w", p.mig.Base, err)
+}
+
+// lockRun takes the run lock, waiting for a concurrent run to finish.
+func (m *Migrator) lockRun(ctx context.Context, onWait func()) (func(), error) {
+	if m.db.Pool == nil {
+		return nil, fmt.Errorf("locking the run needs a pgx pool")
+	}
+	lock, err := m.db.TryLock(ctx, runLockName)
+	if errors.Is(err, database.ErrLocked) {
+		if onWait != nil {
+			onWait()
+		}
+		lock, err = m.db.Lock(ctx, runLockName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() { lock.Release(context.WithoutCancel(ctx)) }, nil
+}
+
+// lockRetryPolicy is the policy for migrations failing on lock conflicts;
+// without config they are not retried.
+func (m *Migrator) lockRetryPolicy() database.RetryPolicy {
+	if m.config == nil {
+		return database.RetryPolicy{}
+	}
+	return m.config.LockRetryPolicy()
+}
+
+func invalidFilesError(found []diagnostics.Diagnostic) error {
+	var b strings.Builder
+	b.WriteString("invalid migration files:")
+	for _, d := range found {
+		if d.Severity == diagnostics.Error {
+			b.WriteString("\n  ")
+			b.WriteString(d.String())
+		}
+	}
+	return errors.New(b.String())
+}
+
+// checkOrder fails when a pending migration sorts before the newest applied
+// one, which usually means it was added on a branch merged after newer
+// migrations had already been applied.
+func checkOrder(migrations []migration, applied []string, appliedSet map[string]struct{}) error {
+	newest := ""
+	for _, a := range applied {
+		if newest == "" || lessVersion(newest, a) {
+			newest = a
+		}
+	}
+	if newest == "" {
+		return nil
+	}
+
+	var older []string
+	for _, mig := range migrations {
+		if _, ok := appliedSet[mig.Base]; !ok && lessVersion(mig.Base, newest) {
+			older = append(older, mig.Base)
+		}
+	}
+	if len(older) == 0 {
+		return nil
+	}
+	return fmt.Errorf("pending migrations %s are older than the last applied migration %s, "+
+		"probably from a merged branch. Give them a newer version (e.g. with 'migrateme renumber') "+
+		"or run with --allow-out-of-order to apply them anyway", strings.Join(older, ", "), newest)
+}
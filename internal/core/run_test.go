@@ -0,0 +1,327 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestGetMigrationFiles_ReadsFromFS(t *testing.T) {
+	t.Parallel()
+
+	m := &Migrator{}
+	m.SetMigrationsFS(fstest.MapFS{
+		"002__b.up.sql":   {Data: []byte("SELECT 2;")},
+		"001__a.up.sql":   {Data: []byte("SELECT 1;")},
+		"001__a.down.sql": {Data: []byte("SELECT 0;")},
+		"README.md":       {Data: []byte("docs")},
+		"schema.sql":      {Data: []byte("CREATE TABLE a ();")},
+		"nested/x.sql":    {Data: []byte("SELECT 3;")},
+	})
+
+	files, err := m.getMigrationFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"001__a.down.sql", "001__a.up.sql", "002__b.up.sql"}
+	if len(files) != len(want) {
+		t.Fatalf("getMigrationFiles = %v, want %v", files, want)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Fatalf("getMigrationFiles = %v, want %v", files, want)
+		}
+	}
+}
+
+// fakeExecutor records statements and answers queries on the migrations
+// table from applied and checksums. Statements in fail return their errors,
+// one per execution.
+type fakeExecutor struct {
+	applied   []string
+	checksums map[string]string
+	execs     []string
+	fail      map[string][]error
+	// onExec, when set, is called with every statement before it runs.
+	onExec func(query string)
+	// progress holds the recorded statement checksums by migration.
+	progress map[string]map[int]string
+}
+
+func (e *fakeExecutor) Exec(_ context.Context, query string, args ...any) error {
+	query = strings.TrimSpace(query)
+	e.execs = append(e.execs, query)
+	if e.onExec != nil {
+		e.onExec(query)
+	}
+	if errs := e.fail[query]; len(errs) > 0 {
+		e.fail[query] = errs[1:]
+		return errs[0]
+	}
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations_progress"):
+		if e.progress == nil {
+			e.progress = make(map[string]map[int]string)
+		}
+		name := args[0].(string)
+		if e.progress[name] == nil {
+			e.progress[name] = make(map[int]string)
+		}
+		e.progress[name][args[1].(int)] = args[2].(string)
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations_progress"):
+		delete(e.progress, args[0].(string))
+	}
+	return nil
+}
+
+func (e *fakeExecutor) Query(_ context.Context, query string, args ...any) (database.Rows, error) {
+	rows := &fakeRows{}
+	if strings.Contains(query, "obj_description") || strings.Contains(query, "max(batch)") {
+		return rows, nil
+	}
+	if strings.Contains(query, "_progress") {
+		for statement, sum := range e.progress[args[0].(string)] {
+			rows.values = append(rows.values, []string{strconv.Itoa(statement), sum})
+		}
+		return rows, nil
+	}
+	if strings.Contains(query, "checksum") {
+		for _, name := range e.applied {
+			if sum, ok := e.checksums[name]; ok {
+				rows.values = append(rows.values, []string{name, sum})
+			}
+		}
+		return rows, nil
+	}
+	for _, name := range e.applied {
+		rows.values = append(rows.values, []string{name})
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	values [][]string
+	cur    []string
+}
+
+func (r *fakeRows) Next() bool {
+	if len(r.values) == 0 {
+		return false
+	}
+	r.cur, r.values = r.values[0], r.values[1:]
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	for i := range dest {
+		switch d := dest[i].(type) {
+		case *int:
+			n, err := strconv.Atoi(r.cur[i])
+			if err != nil {
+				return err
+			}
+			*d = n
+		default:
+			*d.(*string) = r.cur[i]
+		}
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error   { return nil }
+func (r *fakeRows) Close() error { return nil }
+
+func TestRun_UsesExecutor(t *testing.T) {
+	t.Parallel()
+
+	exec := &fakeExecutor{applied: []string{"001__a"}}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{
+		"001__a.up.sql": {Data: []byte("SELECT 1;")},
+		"002__b.up.sql": {Data: []byte("SELECT 2;")},
+	})
+
+	applied, err := m.Run(context.Background(), RunOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0] != "002__b" {
+		t.Fatalf("Run applied %v, want [002__b]", applied)
+	}
+
+	var ranUp, recorded bool
+	for _, q := range exec.execs {
+		ranUp = ranUp || q == "SELECT 2;"
+		recorded = recorded || strings.HasPrefix(q, "INSERT INTO schema_migrations")
+		if q == "SELECT 1;" {
+			t.Errorf("already applied migration was run again")
+		}
+	}
+	if !ranUp || !recorded {
+		t.Errorf("expected the up file to run and be recorded, got %q", exec.execs)
+	}
+}
+
+func TestRun_ReportsProgress(t *testing.T) {
+	t.Parallel()
+
+	m := NewMigrator(config.Default(), database.New(&fakeExecutor{}))
+	m.SetMigrationsFS(fstest.MapFS{
+		"001__a.up.sql": {Data: []byte("BEGIN;\nSELECT 1;\nSELECT ';';\nCOMMIT;")},
+		"002__b.up.sql": {Data: []byte("SELECT 2;")},
+	})
+
+	var events []MigrationProgress
+	if _, err := m.Run(context.Background(), RunOptions{Progress: func(p MigrationProgress) { events = append(events, p) }}); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected a start and a done event per migration, got %+v", events)
+	}
+	start, done := events[0], events[1]
+	if start.Migration != "001__a" || start.Index != 1 || start.Total != 2 || start.Statements != 4 || start.Done {
+		t.Errorf("start event = %+v", start)
+	}
+	if done.Migration != "001__a" || !done.Done {
+		t.Errorf("done event = %+v", done)
+	}
+	if events[3].Migration != "002__b" || events[3].Index != 2 || !events[3].Done {
+		t.Errorf("last event = %+v", events[3])
+	}
+}
+
+func TestRun_RetriesLockContention(t *testing.T) {
+	t.Parallel()
+
+	lockTimeout := &pgconn.PgError{Code: "55P03", Message: "canceling statement due to lock timeout"}
+	exec := &fakeExecutor{fail: map[string][]error{"SELECT 1;": {lockTimeout, lockTimeout}}}
+	cfg := config.Default()
+	cfg.Migrations.LockRetry = config.RetryConfig{Attempts: 3, Backoff: time.Millisecond}
+	m := NewMigrator(cfg, database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{"001__a.up.sql": {Data: []byte("SELECT 1;")}})
+
+	var retried []int
+	applied, err := m.Run(context.Background(), RunOptions{
+		OnRetry: func(migration string, attempt int, err error, _ time.Duration) {
+			if migration != "001__a" || !database.IsLockContention(err) {
+				t.Errorf("unexpected retry of %s after %v", migration, err)
+			}
+			retried = append(retried, attempt)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || len(retried) != 2 {
+		t.Fatalf("applied %v after retries %v, want 001__a after 2 retries", applied, retried)
+	}
+
+	// Without lock_retry the first lock timeout aborts the run.
+	exec = &fakeExecutor{fail: map[string][]error{"SELECT 1;": {lockTimeout}}}
+	m = NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{"001__a.up.sql": {Data: []byte("SELECT 1;")}})
+	if _, err := m.Run(context.Background(), RunOptions{}); !database.IsLockContention(err) {
+		t.Fatalf("expected the lock timeout, got %v", err)
+	}
+}
+
+func TestRun_StopsWhenCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exec := &fakeExecutor{fail: map[string][]error{"SELECT 2;": {errors.New("canceling statement due to user request")}}}
+	exec.onExec = func(query string) {
+		if query == "SELECT 2;" {
+			cancel()
+		}
+	}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{
+		"001__a.up.sql": {Data: []byte("SELECT 1;")},
+		"002__b.up.sql": {Data: []byte("SELECT 2;")},
+		"003__c.up.sql": {Data: []byte("SELECT 3;")},
+	})
+
+	applied, err := m.Run(ctx, RunOptions{})
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "002__b") {
+		t.Fatalf("expected to stop while applying 002__b, got %v", err)
+	}
+	if len(applied) != 1 || applied[0] != "001__a" {
+		t.Fatalf("applied %v, want [001__a]", applied)
+	}
+	var recorded int
+	for _, q := range exec.execs {
+		if strings.HasPrefix(q, "INSERT INTO schema_migrations") {
+			recorded++
+		}
+		if q == "SELECT 3;" {
+			t.Error("migration after the interruption was run")
+		}
+	}
+	if recorded != 1 {
+		t.Errorf("expected only 001__a to be recorded, got %d records", recorded)
+	}
+}
+
+func TestRollback_UsesExecutor(t *testing.T) {
+	t.Parallel()
+
+	exec := &fakeExecutor{applied: []string{"001__a", "002__b"}}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fstest.MapFS{
+		"002__b.down.sql": {Data: []byte("SELECT -2;")},
+	})
+
+	rolledBack, err := m.Rollback(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolledBack) != 1 || rolledBack[0] != "002__b" {
+		t.Fatalf("Rollback reverted %v, want [002__b]", rolledBack)
+	}
+	n := len(exec.execs)
+	if n < 2 || exec.execs[n-2] != "SELECT -2;" || !strings.HasPrefix(exec.execs[n-1], "DELETE FROM schema_migrations") {
+		t.Errorf("expected the down file to run and be removed, got %q", exec.execs)
+	}
+}
+
+func TestRun_RefusesOutOfOrderMigrations(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"001__a.up.sql": {Data: []byte("SELECT 1;")},
+		"002__b.up.sql": {Data: []byte("SELECT 2;")},
+		"003__c.up.sql": {Data: []byte("SELECT 3;")},
+	}
+
+	exec := &fakeExecutor{applied: []string{"001__a", "003__c"}}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.SetMigrationsFS(fsys)
+
+	_, err := m.Run(context.Background(), RunOptions{})
+	if err == nil || !strings.Contains(err.Error(), "002__b") {
+		t.Fatalf("expected an out-of-order error naming 002__b, got %v", err)
+	}
+	for _, q := range exec.execs {
+		if q == "SELECT 2;" {
+			t.Fatal("out-of-order migration was applied")
+		}
+	}
+
+	applied, err := m.Run(context.Background(), RunOptions{AllowOutOfOrder: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0] != "002__b" {
+		t.Fatalf("Run applied %v, want [002__b]", applied)
+	}
+}
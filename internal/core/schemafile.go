@@ -0,0 +1,75 @@
+package core
+
+import (
+	"fmt"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	schema2 "github.com/amr0ny/migrateme/pkg/schema"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SchemaFileName is the file generate writes next to the migrations with
+// migrations.emit_schema_file. The runner does not treat it as a migration.
+const SchemaFileName = "schema.sql"
+
+const schemaFileHeader = "-- Code generated by migrateme generate. DO NOT EDIT.\n" +
+	"-- The schema of the registered entities once every migration is applied.\n\n"
+
+// writeSchemaFile writes SchemaSQL to SchemaFileName in the migrations
+// directory and returns its path.
+func (m *Migrator) writeSchemaFile(newSchemas map[string]migrate.TableSchema) (string, error) {
+	path := filepath.Join(m.config.GetMigrationsDir(), SchemaFileName)
+	if err := os.WriteFile(path, []byte(m.schemaSQL(newSchemas)), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write schema file: %w", err)
+	}
+	return path, nil
+}
+
+// schemaSQL returns the DDL creating newSchemas from scratch: the extensions
+// they need, then every table with its indexes, constraints and triggers in
+// foreign key order, and last the foreign keys closing a cycle. It depends
+// only on the schemas and the server version, so an unchanged registry gives
+// the same file.
+func (m *Migrator) schemaSQL(newSchemas map[string]migrate.TableSchema) string {
+	tables := getTableNames(newSchemas)
+	sortedTables := topologicalSort(dependencyGraph(newSchemas, tables), tables)
+	diffGenerator := m.newDiffGenerator(sortedTables, newSchemas)
+
+	var b strings.Builder
+	b.WriteString(schemaFileHeader)
+
+	extensions := map[string]struct{}{}
+	for _, table := range sortedTables {
+		for _, ext := range schema2.RequiredExtensions(newSchemas[table], m.serverVersion) {
+			extensions[ext] = struct{}{}
+		}
+	}
+	if len(extensions) > 0 {
+		names := make([]string, 0, len(extensions))
+		for ext := range extensions {
+			names = append(names, ext)
+		}
+		sort.Strings(names)
+		for _, ext := range names {
+			fmt.Fprintf(&b, "%s;\n", schema2.CreateExtensionStatement(ext))
+		}
+		b.WriteString("\n")
+	}
+
+	var postUp []string
+	for _, table := range sortedTables {
+		diff := diffGenerator.DiffSchemas(migrate.TableSchema{}, migrate.NormalizeSchema(newSchemas[table]))
+		fmt.Fprintf(&b, "-- %s\n", table)
+		for _, stmt := range diff.Up {
+			fmt.Fprintf(&b, "%s;\n", stmt)
+		}
+		b.WriteString("\n")
+		postUp = append(postUp, diff.PostUp...)
+	}
+	for _, stmt := range postUp {
+		fmt.Fprintf(&b, "%s;\n", stmt)
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestSchemaSQL(t *testing.T) {
+	t.Parallel()
+
+	// gen_random_uuid needs pgcrypto before Postgres 13.
+	m := &Migrator{config: &config.Config{}, serverVersion: 120000}
+	schemas := map[string]migrate.TableSchema{
+		"posts": {
+			TableName: "posts",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ParseColumnTag("id,pk_uuid")},
+				{ColumnName: "author_id", Attrs: migrate.ParseColumnTag("author_id,type=uuid,fk=users.id")},
+			},
+		},
+		"users": {
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ParseColumnTag("id,pk_uuid")},
+				{ColumnName: "email", Attrs: migrate.ParseColumnTag("email,unique")},
+			},
+		},
+	}
+
+	got := m.schemaSQL(schemas)
+	if !strings.HasPrefix(got, schemaFileHeader+`CREATE EXTENSION IF NOT EXISTS "pgcrypto";`) {
+		t.Fatalf("schema file must start with the header and extensions:\n%s", got)
+	}
+	users, posts := strings.Index(got, `CREATE TABLE IF NOT EXISTS "users"`), strings.Index(got, `CREATE TABLE IF NOT EXISTS "posts"`)
+	if users < 0 || posts < 0 || users > posts {
+		t.Fatalf("users must be created before posts, which references it:\n%s", got)
+	}
+	if again := m.schemaSQL(schemas); again != got {
+		t.Fatalf("schema file is not deterministic:\n%s\n---\n%s", got, again)
+	}
+}
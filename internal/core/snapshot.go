@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/jackc/pgx/v5"
+)
+
+// SnapshotOptions configures Snapshot.
+type SnapshotOptions struct {
+	// Tables to copy; empty means every registered table.
+	Tables []string
+	// Salt is mixed into anonymized values; see migrate.AnonRule.Expr.
+	Salt string
+	// Truncate empties the target tables before copying.
+	Truncate bool
+}
+
+// SnapshotTable is what Snapshot copied of one table.
+type SnapshotTable struct {
+	Table      string   `json:"table"`
+	Rows       int64    `json:"rows"`
+	Anonymized []string `json:"anonymized,omitempty"`
+}
+
+// Snapshot copies the rows of registered tables from the migrator's database
+// into target, replacing the values of columns tagged anon= as their rule
+// says on the way, so that no original value of such a column reaches the
+// target. Both databases must be at the same schema version; the rows are
+// read from one snapshot and written in one transaction, referenced tables
+// first. Only declared columns are copied.
+func (m *Migrator) Snapshot(ctx context.Context, target *database.DB, opts SnapshotOptions) ([]SnapshotTable, error) {
+	if m.db.Pool == nil || target.Pool == nil {
+		return nil, fmt.Errorf("snapshot needs a pgx pool for both databases")
+	}
+	schemas := m.buildSchemas()
+	tables := opts.Tables
+	if len(tables) == 0 {
+		tables = getTableNames(schemas)
+	}
+	for _, table := range tables {
+		if _, ok := schemas[table]; !ok {
+			return nil, fmt.Errorf("table %s is not registered, its columns and anon rules are unknown", table)
+		}
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no tables to copy")
+	}
+
+	version, err := m.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targetVersion, err := (&Migrator{config: m.config, db: target}).SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version != targetVersion {
+		return nil, &DataVersionError{Dump: version, Database: targetVersion}
+	}
+
+	conn, err := m.db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+	source, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer source.Rollback(context.WithoutCancel(ctx))
+
+	sorted := topologicalSort(dependencyGraph(schemas, tables), tables)
+	var copied []SnapshotTable
+	err = pgx.BeginFunc(ctx, target.Pool, func(tx pgx.Tx) error {
+		if opts.Truncate {
+			names := make([]string, len(sorted))
+			for i, table := range sorted {
+				names[i] = pgx.Identifier{table}.Sanitize()
+			}
+			if _, err := tx.Exec(ctx, "TRUNCATE "+strings.Join(names, ", ")); err != nil {
+				return fmt.Errorf("truncate: %w", err)
+			}
+		}
+		for _, table := range sorted {
+			selectSQL, insertSQL, anonymized := snapshotCopySQL(migrate.NormalizeSchema(schemas[table]), opts.Salt)
+			rows, err := pipeCopy(ctx, source.Conn(), tx.Conn(), selectSQL, insertSQL)
+			if err != nil {
+				return fmt.Errorf("copy %s: %w", table, err)
+			}
+			if err := resetSequences(ctx, tx, table); err != nil {
+				return fmt.Errorf("reset sequences of %s: %w", table, err)
+			}
+			copied = append(copied, SnapshotTable{Table: table, Rows: rows, Anonymized: anonymized})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// snapshotCopySQL returns the COPY statements reading s from the source,
+// with anonymized columns replaced, and writing it to the target, and the
+// names of the anonymized columns.
+func snapshotCopySQL(s migrate.TableSchema, salt string) (string, string, []string) {
+	exprs := make([]string, len(s.Columns))
+	columns := make([]string, len(s.Columns))
+	var anonymized []string
+	for i, c := range s.Columns {
+		exprs[i] = c.Attrs.Anon.Expr(c.ColumnName, c.Attrs.PgType, salt)
+		columns[i] = pgx.Identifier{c.ColumnName}.Sanitize()
+		if c.Attrs.Anon != "" {
+			anonymized = append(anonymized, c.ColumnName)
+		}
+	}
+	table := pgx.Identifier{s.TableName}.Sanitize()
+	selectSQL := fmt.Sprintf("COPY (SELECT %s FROM %s) TO STDOUT WITH (FORMAT binary)", strings.Join(exprs, ", "), table)
+	insertSQL := fmt.Sprintf("COPY %s (%s) FROM STDIN WITH (FORMAT binary)", table, strings.Join(columns, ", "))
+	return selectSQL, insertSQL, anonymized
+}
+
+// pipeCopy streams the output of a COPY TO on from into a COPY FROM on to,
+// without buffering the table.
+func pipeCopy(ctx context.Context, from, to *pgx.Conn, selectSQL, insertSQL string) (int64, error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := from.PgConn().CopyTo(ctx, pw, selectSQL)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	tag, err := to.PgConn().CopyFrom(ctx, pr, insertSQL)
+	// Unblock the reader side if the target failed first.
+	pr.CloseWithError(err)
+	if readErr := <-done; readErr != nil && err == nil {
+		err = readErr
+	}
+	return tag.RowsAffected(), err
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestSnapshotCopySQL(t *testing.T) {
+	t.Parallel()
+
+	users := migrate.NormalizeSchema(migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ParseColumnTag("id,pk,type=bigserial")},
+			{ColumnName: "email", Attrs: migrate.ParseColumnTag("email,notnull,unique,anon=fake_email")},
+			{ColumnName: "name", Attrs: migrate.ParseColumnTag("name,type=varchar(100),anon=hash")},
+			{ColumnName: "phone", Attrs: migrate.ParseColumnTag("phone,anon=null")},
+		},
+	})
+
+	selectSQL, insertSQL, anonymized := snapshotCopySQL(users, "s'alt")
+	for _, want := range []string{
+		`COPY (SELECT "id", `,
+		`('user_' || substr(md5('s''alt' || "email"::text), 1, 16) || '@example.com')::text`,
+		`(md5('s''alt' || "name"::text))::varchar(100)`,
+		`NULL::text FROM "users") TO STDOUT WITH (FORMAT binary)`,
+	} {
+		if !strings.Contains(selectSQL, want) {
+			t.Errorf("expected %q in %s", want, selectSQL)
+		}
+	}
+	if want := `COPY "users" ("id", "email", "name", "phone") FROM STDIN WITH (FORMAT binary)`; insertSQL != want {
+		t.Errorf("insert = %s, want %s", insertSQL, want)
+	}
+	if strings.Join(anonymized, ",") != "email,name,phone" {
+		t.Errorf("anonymized = %v", anonymized)
+	}
+}
@@ -3,10 +3,12 @@ package core
 import (
 	"context"
 	"fmt"
+
+	"github.com/amr0ny/migrateme/internal/database"
 )
 
 func (m *Migrator) Status(ctx context.Context) ([]string, []string, error) {
-	files, err := m.getMigrationFiles()
+	migrations, err := m.listMigrations()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to list migration files: %w", err)
 	}
@@ -22,11 +24,59 @@ func (m *Migrator) Status(ctx context.Context) ([]string, []string, error) {
 	}
 
 	var pending []string
-	for _, file := range files {
-		if !appliedSet[file] {
-			pending = append(pending, file)
+	for _, mig := range migrations {
+		if !appliedSet[mig.Base] {
+			pending = append(pending, mig.Base)
 		}
 	}
 
 	return applied, pending, nil
 }
+
+// History returns the applied migrations with what the history table
+// recorded about them, in the order they were applied.
+func (m *Migrator) History(ctx context.Context) ([]database.HistoryEntry, error) {
+	history, err := m.db.GetHistory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration history: %w", err)
+	}
+	return history, nil
+}
+
+// PendingMigration is a migration Run would apply.
+type PendingMigration struct {
+	Migration  string `json:"migration"`
+	Statements int    `json:"statements"`
+	// SQL is what Run would execute, templates rendered and timeouts set.
+	SQL string `json:"sql"`
+}
+
+// Pending returns the migrations Run would apply, in order, without
+// executing anything.
+func (m *Migrator) Pending(ctx context.Context) ([]PendingMigration, error) {
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+	applied, err := m.db.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	appliedSet := make(map[string]bool, len(applied))
+	for _, a := range applied {
+		appliedSet[a] = true
+	}
+
+	var pending []PendingMigration
+	for _, mig := range migrations {
+		if appliedSet[mig.Base] {
+			continue
+		}
+		sql, _, err := m.runSQL(mig, true)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, PendingMigration{Migration: mig.Base, Statements: countStatements(sql), SQL: sql})
+	}
+	return pending, nil
+}
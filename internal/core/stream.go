@@ -0,0 +1,267 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	schema2 "github.com/amr0ny/migrateme/pkg/schema"
+)
+
+// migrationSink streams per-table diffs into the up/down migration files.
+//
+// Up statements are appended to a temporary up file as they arrive. Down
+// statements must end up in reverse table order, so each table's rendered down
+// chunk is spooled to a temporary file and the chunks are copied back in
+// reverse order when the migration is committed. Only chunk offsets are kept
+// in memory.
+type migrationSink struct {
+	dir string
+
+	upFile *os.File
+	upBuf  *bufio.Writer
+	up     *schema2.TxWriter
+
+	spool    *os.File
+	spoolPos int64
+	chunks   []spoolChunk
+
+	// meta is the metadata header of the up file (see Header).
+	meta string
+
+	owners     []string
+	extensions []string
+
+	// postUp holds statements that go after every table, e.g. foreign keys
+	// closing a reference cycle. There are only a few, so they stay in memory.
+	postUp []string
+}
+
+type spoolChunk struct {
+	off, size int64
+}
+
+func newMigrationSink(dir string) (*migrationSink, error) {
+	upFile, err := os.CreateTemp(dir, ".migrateme-*.up.sql.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary up migration: %w", err)
+	}
+	spool, err := os.CreateTemp("", "migrateme-down-*.spool")
+	if err != nil {
+		upFile.Close()
+		os.Remove(upFile.Name())
+		return nil, fmt.Errorf("failed to create down spool: %w", err)
+	}
+
+	buf := bufio.NewWriter(upFile)
+	return &migrationSink{
+		dir:    dir,
+		upFile: upFile,
+		upBuf:  buf,
+		up:     schema2.NewTxWriter(buf),
+		spool:  spool,
+	}, nil
+}
+
+func (s *migrationSink) WriteTable(change TableChange, diff migrate.TableDiff) error {
+	table := change.TableName
+	if change.Owner != "" {
+		s.owners = appendUnique(s.owners, change.Owner)
+	}
+	for _, ext := range change.Extensions {
+		s.extensions = appendUnique(s.extensions, ext)
+	}
+
+	up := make([]string, 0, len(diff.Up)+2)
+	up = append(up, fmt.Sprintf("-- Changes for table: %s%s", table, ownerSuffix(change.Owner)))
+	up = append(up, diff.Up...)
+	up = append(up, "")
+	if err := s.up.Write(up...); err != nil {
+		return fmt.Errorf("failed to write up migration: %w", err)
+	}
+	s.postUp = append(s.postUp, diff.PostUp...)
+
+	down := make([]string, 0, len(diff.Down)+2)
+	down = append(down, fmt.Sprintf("-- Revert changes for table: %s", table))
+	down = append(down, diff.Down...)
+	down = append(down, "")
+	return s.writeDownChunk(schema2.RenderStatements(down))
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, x := range list {
+		if x == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// header returns lines written at the top of a migration file, ahead of the
+// transaction. The up file also gets the metadata header and the required
+// extensions, which are never dropped on the way down since other tables may
+// use them.
+func (s *migrationSink) header(up bool) string {
+	var b strings.Builder
+	if up {
+		b.WriteString(s.meta)
+	}
+	if len(s.owners) > 0 {
+		owners := append([]string(nil), s.owners...)
+		sort.Strings(owners)
+		fmt.Fprintf(&b, "-- Owners: %s\n\n", strings.Join(owners, ", "))
+	}
+	if up && len(s.extensions) > 0 {
+		exts := append([]string(nil), s.extensions...)
+		sort.Strings(exts)
+		for _, ext := range exts {
+			fmt.Fprintf(&b, "%s;\n", schema2.CreateExtensionStatement(ext))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func ownerSuffix(owner string) string {
+	if owner == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (owner: %s)", owner)
+}
+
+func (s *migrationSink) writeDownChunk(rendered string) error {
+	n, err := io.WriteString(s.spool, rendered)
+	if err != nil {
+		return fmt.Errorf("failed to spool down migration: %w", err)
+	}
+	s.chunks = append(s.chunks, spoolChunk{off: s.spoolPos, size: int64(n)})
+	s.spoolPos += int64(n)
+	return nil
+}
+
+// Commit finalizes the up file under its real name and assembles the down file.
+func (s *migrationSink) Commit(upPath, downPath string) error {
+	defer s.closeSpool()
+
+	if len(s.postUp) > 0 {
+		stmts := append([]string{"-- Deferred foreign keys (reference cycles)"}, s.postUp...)
+		if err := s.up.Write(append(stmts, "")...); err != nil {
+			s.Abort()
+			return fmt.Errorf("failed to write up migration: %w", err)
+		}
+	}
+	if err := s.up.Close(); err != nil {
+		s.Abort()
+		return fmt.Errorf("failed to write up migration: %w", err)
+	}
+	if err := s.upBuf.Flush(); err != nil {
+		s.Abort()
+		return fmt.Errorf("failed to write up migration: %w", err)
+	}
+	if err := s.upFile.Close(); err != nil {
+		os.Remove(s.upFile.Name())
+		return fmt.Errorf("failed to write up migration: %w", err)
+	}
+
+	if err := s.writeDown(downPath); err != nil {
+		os.Remove(s.upFile.Name())
+		os.Remove(downPath)
+		return err
+	}
+
+	if err := s.finalizeUp(upPath); err != nil {
+		os.Remove(s.upFile.Name())
+		os.Remove(upPath)
+		os.Remove(downPath)
+		return fmt.Errorf("failed to write up migration: %w", err)
+	}
+	return nil
+}
+
+// finalizeUp moves the temporary up file into place, prepending the header
+// (which is only known once every table has been processed) when needed.
+func (s *migrationSink) finalizeUp(upPath string) error {
+	header := s.header(true)
+	if header == "" {
+		return os.Rename(s.upFile.Name(), upPath)
+	}
+
+	src, err := os.Open(s.upFile.Name())
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(upPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(dst, header); err != nil {
+		dst.Close()
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(s.upFile.Name())
+}
+
+func (s *migrationSink) writeDown(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write down migration: %w", err)
+	}
+	defer f.Close()
+
+	buf := bufio.NewWriter(f)
+	if _, err := buf.WriteString(s.header(false)); err != nil {
+		return fmt.Errorf("failed to write down migration: %w", err)
+	}
+	tw := schema2.NewTxWriter(buf)
+	for i := len(s.chunks) - 1; i >= 0; i-- {
+		c := s.chunks[i]
+		data := make([]byte, c.size)
+		if _, err := s.spool.ReadAt(data, c.off); err != nil {
+			return fmt.Errorf("failed to read down spool: %w", err)
+		}
+		if err := tw.WriteRaw(string(data)); err != nil {
+			return fmt.Errorf("failed to write down migration: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write down migration: %w", err)
+	}
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write down migration: %w", err)
+	}
+	return f.Close()
+}
+
+// Abort discards everything written so far.
+func (s *migrationSink) Abort() {
+	s.upFile.Close()
+	os.Remove(s.upFile.Name())
+	s.closeSpool()
+}
+
+func (s *migrationSink) closeSpool() {
+	if s.spool == nil {
+		return
+	}
+	s.spool.Close()
+	os.Remove(s.spool.Name())
+	s.spool = nil
+}
+
+func (s *migrationSink) paths(baseName string) (string, string) {
+	return filepath.Join(s.dir, baseName+".up.sql"), filepath.Join(s.dir, baseName+".down.sql")
+}
@@ -0,0 +1,395 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	schema2 "github.com/amr0ny/migrateme/pkg/schema"
+)
+
+type staticFetcher map[string]migrate.TableSchema
+
+func (f staticFetcher) Fetch(_ context.Context, table string) (migrate.TableSchema, error) {
+	if s, ok := f[table]; ok {
+		return s, nil
+	}
+	return migrate.TableSchema{TableName: table}, nil
+}
+
+func testSchemas() map[string]migrate.TableSchema {
+	return map[string]migrate.TableSchema{
+		"users": {
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+			},
+		},
+		"posts": {
+			TableName: "posts",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+				{ColumnName: "user_id", Attrs: migrate.ColumnAttributes{PgType: "uuid", ForeignKey: &migrate.ForeignKey{Table: "users", Column: "id"}}},
+			},
+		},
+	}
+}
+
+func TestGenerateMigrationSQL_StreamsFilesInWrapTxFormat(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	sink, err := newMigrationSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Migrator{}
+	var progressed []string
+	changes, err := m.generateMigrationSQL(context.Background(), staticFetcher{}, []string{"users", "posts"}, testSchemas(), sink, GenerateOptions{
+		Progress: func(done, total int, table string) { progressed = append(progressed, table) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || len(progressed) != 2 {
+		t.Fatalf("expected 2 changes and 2 progress calls, got %d and %d", len(changes), len(progressed))
+	}
+
+	upPath, downPath := sink.paths("test")
+	if err := sink.Commit(upPath, downPath); err != nil {
+		t.Fatal(err)
+	}
+
+	up, _ := os.ReadFile(upPath)
+	down, _ := os.ReadFile(downPath)
+
+	g := schema2.NewDiffGenerator()
+	var wantUp, wantDown []string
+	for _, table := range []string{"users", "posts"} {
+		d := g.DiffSchemas(migrate.TableSchema{TableName: table}, migrate.NormalizeSchema(testSchemas()[table]))
+		wantUp = append(wantUp, "-- Changes for table: "+table)
+		wantUp = append(wantUp, d.Up...)
+		wantUp = append(wantUp, "")
+		chunk := append([]string{"-- Revert changes for table: " + table}, d.Down...)
+		wantDown = append(append(chunk, ""), wantDown...)
+	}
+
+	if string(up) != schema2.WrapTx(wantUp) {
+		t.Fatalf("unexpected up file:\n%s", up)
+	}
+	if string(down) != schema2.WrapTx(wantDown) {
+		t.Fatalf("unexpected down file:\n%s", down)
+	}
+	if strings.Index(string(down), "posts") > strings.Index(string(down), "users") {
+		t.Fatalf("expected posts to be reverted before users:\n%s", down)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Fatalf("temporary file left behind: %s", filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+func TestMigrationSink_OwnersHeader(t *testing.T) {
+	t.Parallel()
+
+	sink, err := newMigrationSink(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []TableChange{
+		{TableName: "users", Owner: "identity"},
+		{TableName: "payments", Owner: "billing"},
+		{TableName: "refunds", Owner: "billing"},
+		{TableName: "logs"},
+	} {
+		if err := sink.WriteTable(c, migrate.TableDiff{Up: []string{"SELECT 1"}, Down: []string{"SELECT 2"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upPath, downPath := sink.paths("owners")
+	if err := sink.Commit(upPath, downPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{upPath, downPath} {
+		data, _ := os.ReadFile(path)
+		if !strings.HasPrefix(string(data), "-- Owners: billing, identity\n\nBEGIN;") {
+			t.Fatalf("unexpected header in %s:\n%s", filepath.Base(path), data)
+		}
+	}
+	up, _ := os.ReadFile(upPath)
+	if !strings.Contains(string(up), "-- Changes for table: payments (owner: billing)") {
+		t.Fatalf("expected owner in table comment:\n%s", up)
+	}
+}
+
+func TestOwnerGroupedPlanWriter(t *testing.T) {
+	t.Parallel()
+
+	var b strings.Builder
+	w := &OwnerGroupedPlanWriter{W: &b}
+	w.WriteTable(TableChange{TableName: "logs", Type: CreateTable}, migrate.TableDiff{})
+	w.WriteTable(TableChange{TableName: "users", Owner: "identity", Type: CreateTable}, migrate.TableDiff{})
+	w.WriteTable(TableChange{TableName: "payments", Owner: "billing", Type: CreateTable}, migrate.TableDiff{})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := b.String()
+	billing, identity, unowned := strings.Index(out, "[billing]"), strings.Index(out, "[identity]"), strings.Index(out, "[(unowned)]")
+	if billing < 0 || !(billing < identity && identity < unowned) {
+		t.Fatalf("unexpected grouping:\n%s", out)
+	}
+}
+
+func TestGenerateMigrationSQL_DefersForeignKeysClosingCycles(t *testing.T) {
+	t.Parallel()
+
+	schemas := testSchemas()
+	users := schemas["users"]
+	users.Columns = append(users.Columns, migrate.ColumnMeta{
+		ColumnName: "pinned_post_id",
+		Attrs:      migrate.ColumnAttributes{PgType: "uuid", ForeignKey: &migrate.ForeignKey{Table: "posts", Column: "id"}},
+	})
+	schemas["users"] = users
+
+	graph := map[string][]string{"users": {"posts"}, "posts": {"users"}}
+	sorted := topologicalSort(graph, []string{"users", "posts"})
+	if strings.Join(sorted, ",") != "posts,users" {
+		t.Fatalf("unexpected order: %v", sorted)
+	}
+
+	sink, err := newMigrationSink(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Migrator{config: &config.Config{Migrations: config.MigrationsConfig{DeferrableCycles: true}}}
+	if _, err := m.generateMigrationSQL(context.Background(), staticFetcher{}, sorted, schemas, sink, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	upPath, downPath := sink.paths("cycle")
+	if err := sink.Commit(upPath, downPath); err != nil {
+		t.Fatal(err)
+	}
+	up, _ := os.ReadFile(upPath)
+
+	deferred := strings.Index(string(up), "-- Deferred foreign keys")
+	fk := strings.Index(string(up), `FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE NO ACTION ON UPDATE NO ACTION DEFERRABLE INITIALLY DEFERRED`)
+	if deferred < 0 || fk < deferred || fk < strings.Index(string(up), `CREATE TABLE IF NOT EXISTS "users"`) {
+		t.Fatalf("expected posts.user_id to be added after all tables:\n%s", up)
+	}
+	if strings.Contains(string(up), `REFERENCES "posts"("id") ON DELETE NO ACTION ON UPDATE NO ACTION DEFERRABLE`) {
+		t.Fatalf("users.pinned_post_id points backwards and must not be deferred:\n%s", up)
+	}
+}
+
+func TestTopologicalSort_OrdersReferencedTablesFirst(t *testing.T) {
+	t.Parallel()
+
+	graph := map[string][]string{
+		"users": {"posts", "comments"},
+		"posts": {"comments"},
+	}
+	got := topologicalSort(graph, []string{"comments", "posts", "users", "tags"})
+	if strings.Join(got, ",") != "tags,users,posts,comments" {
+		t.Fatalf("unexpected order: %v", got)
+	}
+}
+
+// TestTopologicalSort_BreaksCyclesDeterministically checks the heap against
+// picking the remaining table with the fewest unresolved references by a
+// scan, on random graphs with cycles and repeated references.
+func TestTopologicalSort_BreaksCyclesDeterministically(t *testing.T) {
+	t.Parallel()
+
+	scan := func(graph map[string][]string, tables []string) []string {
+		tables = slices.Sorted(slices.Values(tables))
+		inDegree := map[string]int{}
+		for _, dependents := range graph {
+			for _, to := range dependents {
+				inDegree[to]++
+			}
+		}
+		done := map[string]bool{}
+		var result []string
+		for len(result) < len(tables) {
+			next := ""
+			for _, table := range tables {
+				if !done[table] && (next == "" || inDegree[table] < inDegree[next]) {
+					next = table
+				}
+			}
+			done[next] = true
+			result = append(result, next)
+			for _, dependent := range graph[next] {
+				inDegree[dependent]--
+			}
+		}
+		return result
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 200 {
+		n := 1 + rng.IntN(30)
+		tables := make([]string, n)
+		for i := range tables {
+			tables[i] = fmt.Sprintf("t%02d", rng.IntN(100))
+		}
+		tables = slices.Compact(slices.Sorted(slices.Values(tables)))
+		rng.Shuffle(len(tables), func(i, j int) { tables[i], tables[j] = tables[j], tables[i] })
+
+		graph := map[string][]string{}
+		for _, from := range tables {
+			for range rng.IntN(4) {
+				if to := tables[rng.IntN(len(tables))]; to != from {
+					graph[from] = append(graph[from], to)
+				}
+			}
+		}
+		if got, want := topologicalSort(graph, tables), scan(graph, tables); !slices.Equal(got, want) {
+			t.Fatalf("topologicalSort(%v) = %v, want %v", graph, got, want)
+		}
+	}
+}
+
+func TestGenerateMigrationSQL_RevertsDependentsBeforeReferencedTables(t *testing.T) {
+	t.Parallel()
+
+	ref := func(table string) migrate.ColumnAttributes {
+		return migrate.ColumnAttributes{PgType: "uuid", ForeignKey: &migrate.ForeignKey{Table: table, Column: "id"}}
+	}
+	table := func(name string, fks ...string) migrate.TableSchema {
+		cols := []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}}}
+		for _, fk := range fks {
+			cols = append(cols, migrate.ColumnMeta{ColumnName: fk + "_id", Attrs: ref(fk)})
+		}
+		return migrate.TableSchema{TableName: name, Columns: cols}
+	}
+
+	cases := map[string]struct {
+		schemas map[string]migrate.TableSchema
+		live    staticFetcher
+	}{
+		"chain": {schemas: map[string]migrate.TableSchema{
+			"orgs":     table("orgs"),
+			"teams":    table("teams", "orgs"),
+			"members":  table("members", "teams"),
+			"sessions": table("sessions", "members"),
+		}},
+		"diamond": {schemas: map[string]migrate.TableSchema{
+			"accounts": table("accounts"),
+			"invoices": table("invoices", "accounts"),
+			"payments": table("payments", "accounts"),
+			"refunds":  table("refunds", "invoices", "payments"),
+		}},
+		"existing table gains reference to a new one": {
+			schemas: map[string]migrate.TableSchema{
+				"coupons": table("coupons"),
+				"orders":  table("orders", "coupons"),
+			},
+			live: staticFetcher{"orders": table("orders")},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			sink, err := newMigrationSink(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Pass tables in reverse name order to make sure the order does not
+			// come from the caller.
+			tables := getTableNames(tc.schemas)
+			slices.Reverse(tables)
+
+			m := &Migrator{}
+			if _, err := m.generateMigrationSQL(context.Background(), tc.live, tables, tc.schemas, sink, GenerateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			upPath, downPath := sink.paths("fk")
+			if err := sink.Commit(upPath, downPath); err != nil {
+				t.Fatal(err)
+			}
+			up, _ := os.ReadFile(upPath)
+			down, _ := os.ReadFile(downPath)
+
+			for _, s := range tc.schemas {
+				for _, c := range s.Columns {
+					fk := c.Attrs.ForeignKey
+					if fk == nil {
+						continue
+					}
+					if markerIndex(up, "-- Changes for table: "+fk.Table) > markerIndex(up, "-- Changes for table: "+s.TableName) {
+						t.Errorf("%s must be migrated before %s:\n%s", fk.Table, s.TableName, up)
+					}
+					if markerIndex(down, "-- Revert changes for table: "+s.TableName) > markerIndex(down, "-- Revert changes for table: "+fk.Table) {
+						t.Errorf("%s must be reverted before %s:\n%s", s.TableName, fk.Table, down)
+					}
+				}
+			}
+		})
+	}
+}
+
+func markerIndex(file []byte, marker string) int {
+	return strings.Index(string(file), marker)
+}
+
+func TestGenerateMigrationSQL_SelfReference(t *testing.T) {
+	t.Parallel()
+
+	fk := func(table string) migrate.ColumnAttributes {
+		return migrate.ColumnAttributes{PgType: "uuid", ForeignKey: &migrate.ForeignKey{Table: table, Column: "id"}}
+	}
+	pk := migrate.ColumnMeta{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}}
+	schemas := map[string]migrate.TableSchema{
+		"products": {TableName: "products", Columns: []migrate.ColumnMeta{
+			pk, {ColumnName: "category_id", Idx: 1, Attrs: fk("categories")},
+		}},
+		"categories": {TableName: "categories", Columns: []migrate.ColumnMeta{
+			pk, {ColumnName: "parent_id", Idx: 1, Attrs: fk("categories")},
+		}},
+	}
+
+	graph := dependencyGraph(schemas, []string{"products", "categories"})
+	if got := graph["categories"]; len(got) != 1 || got[0] != "products" {
+		t.Fatalf("categories dependents = %v, want [products]", got)
+	}
+
+	sink, err := newMigrationSink(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Migrator{config: &config.Config{Migrations: config.MigrationsConfig{DeferrableCycles: true}}}
+	if _, err := m.generateMigrationSQL(context.Background(), staticFetcher{}, []string{"products", "categories"}, schemas, sink, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	upPath, downPath := sink.paths("self_reference")
+	if err := sink.Commit(upPath, downPath); err != nil {
+		t.Fatal(err)
+	}
+	up, _ := os.ReadFile(upPath)
+
+	categories := strings.Index(string(up), `CREATE TABLE IF NOT EXISTS "categories"`)
+	selfFK := strings.Index(string(up), `FOREIGN KEY ("parent_id") REFERENCES "categories"("id") ON DELETE NO ACTION ON UPDATE NO ACTION;`)
+	products := strings.Index(string(up), `CREATE TABLE IF NOT EXISTS "products"`)
+	if categories < 0 || selfFK < categories || products < selfFK {
+		t.Fatalf("expected categories and its self-reference before products:\n%s", up)
+	}
+	if strings.Contains(string(up), "DEFERRABLE") {
+		t.Fatalf("no foreign key should be deferred:\n%s", up)
+	}
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+var templateFuncs = template.FuncMap{
+	"env": os.Getenv,
+	"quote": func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	},
+	"ident": func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	},
+}
+
+// renderSQL expands a migration file through text/template when templates are
+// enabled in config. Checksums are always taken from the raw file, so the same
+// file applied with different variables does not count as modified.
+func (m *Migrator) renderSQL(name string, content []byte) (string, error) {
+	if m.config == nil || !m.config.Migrations.Templates {
+		return string(content), nil
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return "", fmt.Errorf("parse template %s: %w", name, err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, m.config.TemplateVars()); err != nil {
+		return "", fmt.Errorf("render template %s: %w", name, err)
+	}
+	return b.String(), nil
+}
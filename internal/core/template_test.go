@@ -0,0 +1,40 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+)
+
+func TestRenderSQL(t *testing.T) {
+	t.Setenv("MIGRATEME_VAR_ROLE", "app_rw")
+
+	cfg := config.Default()
+	cfg.Vars = map[string]string{"tablespace": "fast_ssd", "role": "app"}
+	m := &Migrator{config: cfg}
+
+	src := []byte(`CREATE TABLE t (id int) TABLESPACE {{ .tablespace }};
+GRANT SELECT ON t TO {{ ident .role }};
+SELECT '{{"{{"}}1,2},{3,4}}'::int[];`)
+
+	raw, err := m.renderSQL("x.up.sql", src)
+	if err != nil || raw != string(src) {
+		t.Fatalf("templates disabled: got %q, %v", raw, err)
+	}
+
+	cfg.Migrations.Templates = true
+	got, err := m.renderSQL("x.up.sql", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"TABLESPACE fast_ssd;", `TO "app_rw";`, `'{{1,2},{3,4}}'`} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in:\n%s", want, got)
+		}
+	}
+
+	if _, err := m.renderSQL("x.up.sql", []byte("{{ .missing }}")); err == nil {
+		t.Fatal("expected error for missing variable")
+	}
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Directives overriding the configured timeouts for one migration. They may
+// appear on any comment line of the file, e.g.
+//
+//	-- migrateme:lock_timeout 10s
+//	-- migrateme:statement_timeout 0
+//
+// where 0 disables the timeout for the migration.
+const (
+	lockTimeoutDirective      = "-- migrateme:lock_timeout"
+	statementTimeoutDirective = "-- migrateme:statement_timeout"
+)
+
+var (
+	beginRE        = regexp.MustCompile(`(?i)^(BEGIN|START\s+TRANSACTION)(\s+(WORK|TRANSACTION))?\s*;`)
+	concurrentlyRE = regexp.MustCompile(`(?i)\bCONCURRENTLY\b`)
+)
+
+// withTimeouts makes sql set lock_timeout and statement_timeout with SET
+// LOCAL, from the directives in content or else from config. The settings
+// go right after the BEGIN a migration starts with, or before its first
+// statement when it has none: all statements of a migration are sent as one
+// query, which Postgres runs in a single implicit transaction. A migration
+// without BEGIN using CONCURRENTLY must not run in a transaction at all and
+// is left unchanged.
+func (m *Migrator) withTimeouts(name string, content []byte, sql string) (string, error) {
+	var lock, stmt *time.Duration
+	if m.config != nil {
+		if d := m.config.Migrations.LockTimeout; d > 0 {
+			lock = &d
+		}
+		if d := m.config.Migrations.StatementTimeout; d > 0 {
+			stmt = &d
+		}
+	}
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		for _, dir := range []struct {
+			prefix string
+			dst    **time.Duration
+		}{{lockTimeoutDirective, &lock}, {statementTimeoutDirective, &stmt}} {
+			value, ok := strings.CutPrefix(line, dir.prefix+" ")
+			if !ok {
+				continue
+			}
+			d, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil || d < 0 {
+				return "", fmt.Errorf("%s:%d: invalid %s %q", name, i+1, strings.TrimPrefix(dir.prefix, "-- migrateme:"), strings.TrimSpace(value))
+			}
+			*dir.dst = &d
+		}
+	}
+	if lock == nil && stmt == nil {
+		return sql, nil
+	}
+
+	var set strings.Builder
+	if lock != nil {
+		fmt.Fprintf(&set, "SET LOCAL lock_timeout = %d;\n", lock.Milliseconds())
+	}
+	if stmt != nil {
+		fmt.Fprintf(&set, "SET LOCAL statement_timeout = %d;\n", stmt.Milliseconds())
+	}
+
+	// Find the first statement, past leading comments and blank lines.
+	offset, inTx := 0, false
+	for offset < len(sql) {
+		end := strings.IndexByte(sql[offset:], '\n')
+		if end < 0 {
+			end = len(sql) - offset
+		}
+		line := strings.TrimSpace(sql[offset : offset+end])
+		if line != "" && !strings.HasPrefix(line, "--") {
+			if inTx = beginRE.MatchString(line); inTx {
+				// Insert after the BEGIN line.
+				offset += end + 1
+				if offset > len(sql) {
+					return sql + "\n" + set.String(), nil
+				}
+			}
+			break
+		}
+		offset += end + 1
+	}
+	if !inTx && concurrentlyRE.MatchString(sql) {
+		return sql, nil
+	}
+	if offset > len(sql) {
+		offset = len(sql)
+	}
+	return sql[:offset] + set.String() + sql[offset:], nil
+}
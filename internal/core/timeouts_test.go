@@ -0,0 +1,59 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+)
+
+func TestWithTimeouts(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{}
+	cfg.Migrations.LockTimeout = 5 * time.Second
+	m := &Migrator{config: cfg}
+
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "after BEGIN",
+			sql:  "-- migrateme:header {}\n\nBEGIN;\n\nALTER TABLE t ADD COLUMN c text;\nCOMMIT;",
+			want: "-- migrateme:header {}\n\nBEGIN;\nSET LOCAL lock_timeout = 5000;\n\nALTER TABLE t ADD COLUMN c text;\nCOMMIT;",
+		},
+		{
+			name: "without BEGIN",
+			sql:  "-- comment\nALTER TABLE t ADD COLUMN c text;",
+			want: "-- comment\nSET LOCAL lock_timeout = 5000;\nALTER TABLE t ADD COLUMN c text;",
+		},
+		{
+			name: "concurrently outside a transaction",
+			sql:  "CREATE INDEX CONCURRENTLY i ON t (c);",
+			want: "CREATE INDEX CONCURRENTLY i ON t (c);",
+		},
+		{
+			name: "directives override config",
+			sql:  "-- migrateme:lock_timeout 0\n-- migrateme:statement_timeout 1m\nBEGIN;\nSELECT 1;\nCOMMIT;",
+			want: "-- migrateme:lock_timeout 0\n-- migrateme:statement_timeout 1m\nBEGIN;\nSET LOCAL lock_timeout = 0;\nSET LOCAL statement_timeout = 60000;\nSELECT 1;\nCOMMIT;",
+		},
+	}
+	for _, tt := range tests {
+		got, err := m.withTimeouts("m.up.sql", []byte(tt.sql), tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := m.withTimeouts("m.up.sql", []byte("-- migrateme:lock_timeout soon\nSELECT 1;"), "SELECT 1;"); err == nil {
+		t.Error("expected an invalid directive to fail")
+	}
+	if got, _ := (&Migrator{config: &config.Config{}}).withTimeouts("m.up.sql", []byte("SELECT 1;"), "SELECT 1;"); got != "SELECT 1;" {
+		t.Errorf("without timeouts the SQL should be unchanged, got %q", got)
+	}
+}
@@ -1,105 +1,90 @@
 package core
 
 import (
+	"container/heap"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/amr0ny/migrateme/pkg/migrate"
-	"os"
+	"io/fs"
 	"sort"
 	"strings"
 )
 
-func topologicalSort(graph map[string][]string, allTables []string) ([]string, error) {
-	inDegree := make(map[string]int)
-	for _, table := range allTables {
-		inDegree[table] = 0
-	}
-
-	// Увеличиваем степень входа для зависимостей, исключая self-reference
-	for from, dependents := range graph {
+// topologicalSort orders tables so that referenced tables come before the
+// tables referencing them; graph maps a table to the tables that reference
+// it and must not contain self-references (see dependencyGraph). A reference
+// cycle is broken by emitting the remaining table with the fewest unresolved
+// references first; its foreign keys to tables emitted later are then
+// created in a post pass (see migrate.TableDiff.PostUp). Ties are broken by
+// name.
+func topologicalSort(graph map[string][]string, allTables []string) []string {
+	inDegree := make(map[string]int, len(allTables))
+	for _, dependents := range graph {
 		for _, to := range dependents {
-			if from != to { // Игнорируем self-reference
-				inDegree[to]++
-			}
+			inDegree[to]++
 		}
 	}
 
-	queue := make([]string, 0)
-	for table, degree := range inDegree {
-		if degree == 0 {
-			queue = append(queue, table)
-		}
+	ready := &tableQueue{inDegree: inDegree, index: make(map[string]int, len(allTables))}
+	for _, table := range allTables {
+		ready.Push(table)
 	}
+	heap.Init(ready)
 
 	result := make([]string, 0, len(allTables))
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-		result = append(result, current)
-
-		for _, neighbor := range graph[current] {
-			if current != neighbor { // Игнорируем self-reference
-				inDegree[neighbor]--
-				if inDegree[neighbor] == 0 {
-					queue = append(queue, neighbor)
-				}
+	for ready.Len() > 0 {
+		next := heap.Pop(ready).(string)
+		result = append(result, next)
+		for _, dependent := range graph[next] {
+			inDegree[dependent]--
+			if i, ok := ready.index[dependent]; ok {
+				heap.Fix(ready, i)
 			}
 		}
 	}
+	return result
+}
 
-	if len(result) != len(allTables) {
-		// Проверяем, связана ли проблема с self-reference
-		remainingTables := make([]string, 0)
-		for _, table := range allTables {
-			found := false
-			for _, processedTable := range result {
-				if table == processedTable {
-					found = true
-					break
-				}
-			}
-			if !found {
-				remainingTables = append(remainingTables, table)
-			}
-		}
+// tableQueue is a heap of the tables not yet emitted by topologicalSort,
+// ordered by unresolved references and then by name.
+type tableQueue struct {
+	tables   []string
+	inDegree map[string]int
+	// index is the position of each table in tables, for heap.Fix.
+	index map[string]int
+}
 
-		// Отладочная информация о циклах
-		cycleInfo := "\nDependency resolution failed. Problematic tables:\n"
-		cycleInfo += "\nDetailed analysis:\n"
-		for _, table := range remainingTables {
-			deps := graph[table]
-			selfRef := hasSelfReference(graph, table)
-			nonSelfCount := countNonSelfReferences(graph, table)
+func (q *tableQueue) Len() int { return len(q.tables) }
 
-			cycleInfo += fmt.Sprintf("  - %s: self-reference=%v, external-deps=%d, all-deps=%v\n",
-				table, selfRef, nonSelfCount, deps)
-		}
+func (q *tableQueue) Less(i, j int) bool {
+	a, b := q.tables[i], q.tables[j]
+	if q.inDegree[a] != q.inDegree[b] {
+		return q.inDegree[a] < q.inDegree[b]
+	}
+	return a < b
+}
 
-		// Пытаемся добавить оставшиеся таблицы (те, у которых только self-reference)
-		for _, table := range remainingTables {
-			deps := graph[table]
-			onlySelfRef := true
-			for _, dep := range deps {
-				if dep != table {
-					onlySelfRef = false
-					break
-				}
-			}
-			if onlySelfRef && len(deps) > 0 {
-				result = append(result, table)
-			}
-		}
+func (q *tableQueue) Swap(i, j int) {
+	q.tables[i], q.tables[j] = q.tables[j], q.tables[i]
+	q.index[q.tables[i]] = i
+	q.index[q.tables[j]] = j
+}
 
-		// Если после этого все еще есть проблемы
-		if len(result) != len(allTables) {
-			return nil, fmt.Errorf("%s", cycleInfo)
-		}
-	}
+func (q *tableQueue) Push(x any) {
+	q.index[x.(string)] = len(q.tables)
+	q.tables = append(q.tables, x.(string))
+}
 
-	return result, nil
+func (q *tableQueue) Pop() any {
+	last := q.tables[len(q.tables)-1]
+	q.tables = q.tables[:len(q.tables)-1]
+	delete(q.index, last)
+	return last
 }
+
 func randomHex(n int) string {
 	b := make([]byte, n)
 	rand.Read(b)
@@ -189,7 +174,8 @@ func hasConstraintChanges(old, new migrate.TableSchema) bool {
 		if !exists {
 			continue
 		}
-		if oldCol.Attrs.IsPK != newCol.Attrs.IsPK || oldCol.Attrs.Unique != newCol.Attrs.Unique {
+		if oldCol.Attrs.IsPK != newCol.Attrs.IsPK || oldCol.Attrs.Unique != newCol.Attrs.Unique ||
+			newCol.Attrs.Unique && oldCol.Attrs.NullsNotDistinct != newCol.Attrs.NullsNotDistinct {
 			return true
 		}
 		if !foreignKeysEqualForCore(oldCol.Attrs.ForeignKey, newCol.Attrs.ForeignKey) {
@@ -244,15 +230,7 @@ func hasColumnDefinitionChanges(old, new migrate.TableSchema) bool {
 		if !exists {
 			continue
 		}
-		oldDef := ""
-		if oldCol.Attrs.Default != nil {
-			oldDef = *oldCol.Attrs.Default
-		}
-		newDef := ""
-		if c.Attrs.Default != nil {
-			newDef = *c.Attrs.Default
-		}
-		if oldCol.Attrs.NotNull != c.Attrs.NotNull || oldDef != newDef {
+		if oldCol.Attrs.NotNull != c.Attrs.NotNull || !migrate.EqualDefaults(oldCol.Attrs.Default, c.Attrs.Default) {
 			return true
 		}
 	}
@@ -276,7 +254,8 @@ func foreignKeysEqualForCore(a, b *migrate.ForeignKey) bool {
 		return a == b
 	}
 	return normalizeRefName(a.Table) == normalizeRefName(b.Table) &&
-		normalizeRefName(a.Column) == normalizeRefName(b.Column)
+		normalizeRefName(a.Column) == normalizeRefName(b.Column) &&
+		migrate.NormalizeMatch(a.Match) == migrate.NormalizeMatch(b.Match)
 }
 
 func normalizeRefName(v string) string {
@@ -292,7 +271,7 @@ func (m *Migrator) hasUnappliedMigrations(ctx context.Context) (bool, error) {
 		return false, err
 	}
 
-	files, err := m.getMigrationFiles()
+	migrations, err := m.listMigrations()
 	if err != nil {
 		return false, err
 	}
@@ -302,12 +281,9 @@ func (m *Migrator) hasUnappliedMigrations(ctx context.Context) (bool, error) {
 		appliedSet[a] = true
 	}
 
-	for _, file := range files {
-		if strings.HasSuffix(file, ".up.sql") {
-			base := strings.TrimSuffix(file, ".up.sql")
-			if !appliedSet[base] {
-				return true, nil
-			}
+	for _, mig := range migrations {
+		if !appliedSet[mig.Base] {
+			return true, nil
 		}
 	}
 
@@ -315,9 +291,9 @@ func (m *Migrator) hasUnappliedMigrations(ctx context.Context) (bool, error) {
 }
 
 func (m *Migrator) getMigrationFiles() ([]string, error) {
-	entries, err := os.ReadDir(m.config.GetMigrationsDir())
+	entries, err := fs.ReadDir(m.migrationsFS(), ".")
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return []string{}, nil
 		}
 		return nil, err
@@ -325,7 +301,7 @@ func (m *Migrator) getMigrationFiles() ([]string, error) {
 
 	var files []string
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") && entry.Name() != SchemaFileName {
 			files = append(files, entry.Name())
 		}
 	}
@@ -333,44 +309,3 @@ func (m *Migrator) getMigrationFiles() ([]string, error) {
 	sort.Strings(files)
 	return files, nil
 }
-func filterUpFiles(files []string) []string {
-	var upFiles []string
-	for _, file := range files {
-		if strings.HasSuffix(file, ".up.sql") {
-			upFiles = append(upFiles, file)
-		}
-	}
-	sort.Strings(upFiles)
-	return upFiles
-}
-
-func extractMigrationBases(upFiles []string) []string {
-	var bases []string
-	for _, file := range upFiles {
-		base := strings.TrimSuffix(file, ".up.sql")
-		bases = append(bases, base)
-	}
-	return bases
-}
-
-// internal/core/utils.go
-func hasSelfReference(graph map[string][]string, table string) bool {
-	deps := graph[table]
-	for _, dep := range deps {
-		if dep == table {
-			return true
-		}
-	}
-	return false
-}
-
-func countNonSelfReferences(graph map[string][]string, table string) int {
-	count := 0
-	deps := graph[table]
-	for _, dep := range deps {
-		if dep != table {
-			count++
-		}
-	}
-	return count
-}
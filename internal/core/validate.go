@@ -0,0 +1,152 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+)
+
+// Validate checks the migration files for duplicate names, up files without
+// a down counterpart and the reverse, empty files, invalid UTF-8 and
+// malformed single-file migrations. When the migrator has a database it also
+// reports applied migrations whose files are gone. Every problem is reported
+// as a diagnostic and returned.
+func (m *Migrator) Validate(ctx context.Context) ([]diagnostics.Diagnostic, error) {
+	files, err := m.getMigrationFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+
+	var found []diagnostics.Diagnostic
+	add := func(d diagnostics.Diagnostic) {
+		found = append(found, d)
+		m.report(d)
+	}
+
+	ups := make(map[string]string)
+	downs := make(map[string]bool)
+	for _, file := range files {
+		content, err := fs.ReadFile(m.migrationsFS(), file)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+		if !utf8.Valid(content) {
+			add(diagnostics.Errorf(diagnostics.InvalidEncoding, "file is not valid UTF-8").At(file, invalidUTF8Line(content)))
+			continue
+		}
+
+		switch {
+		case strings.HasSuffix(file, ".down.sql"):
+			downs[strings.TrimSuffix(file, ".down.sql")] = true
+			if isBlank(content) {
+				add(diagnostics.Warningf(diagnostics.EmptyMigration, "down file is empty, rollback will fail").At(file, 0))
+			}
+			continue
+		case strings.HasSuffix(file, ".up.sql"):
+			if isBlank(content) {
+				add(diagnostics.Warningf(diagnostics.EmptyMigration, "up file is empty").At(file, 0))
+			}
+		default:
+			up, down, err := parseSections(content)
+			if err != nil {
+				add(diagnostics.Errorf(diagnostics.InvalidMigration, "%v", err).At(file, 0))
+			} else if isBlank(up) {
+				add(diagnostics.Warningf(diagnostics.EmptyMigration, "Up section is empty").At(file, 0))
+			} else if isBlank(down) {
+				add(diagnostics.Warningf(diagnostics.MissingDownMigration, "migration has no Down section, it cannot be rolled back").At(file, 0))
+			}
+		}
+
+		base := strings.TrimSuffix(strings.TrimSuffix(file, ".sql"), ".up")
+		if other, ok := ups[base]; ok {
+			add(diagnostics.Errorf(diagnostics.DuplicateMigration, "migration %s is also defined by %s", base, other).At(file, 0))
+			continue
+		}
+		ups[base] = file
+	}
+
+	for _, base := range sortedKeys(ups) {
+		if file := ups[base]; strings.HasSuffix(file, ".up.sql") && !downs[base] {
+			add(diagnostics.Warningf(diagnostics.MissingDownMigration, "no %s.down.sql, the migration cannot be rolled back", base).At(file, 0))
+		}
+	}
+	for _, base := range sortedKeys(downs) {
+		if _, ok := ups[base]; !ok {
+			add(diagnostics.Warningf(diagnostics.OrphanDownMigration, "down file has no matching up file").At(base+".down.sql", 0))
+		}
+	}
+
+	if scheme, _ := m.namingScheme(); scheme == NamingSequential {
+		byVersion := make(map[int]string)
+		for _, base := range sortedKeys(ups) {
+			n, ok := sequenceNumber(base)
+			if !ok {
+				continue
+			}
+			if other, ok := byVersion[n]; ok {
+				add(diagnostics.Errorf(diagnostics.DuplicateMigration, "version %d is used by %s and %s; run 'migrateme renumber'", n, other, base).At(ups[base], 0))
+				continue
+			}
+			byVersion[n] = base
+		}
+	}
+
+	if m.db != nil {
+		applied, err := m.db.GetAppliedMigrations(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+		}
+		for _, base := range applied {
+			if _, ok := ups[base]; !ok {
+				add(diagnostics.Warningf(diagnostics.MissingMigration, "migration %s is applied but its file is missing", base))
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// hasErrors reports whether any of ds is an error.
+func hasErrors(ds []diagnostics.Diagnostic) bool {
+	for _, d := range ds {
+		if d.Severity == diagnostics.Error {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isBlank(content []byte) bool {
+	return len(bytes.TrimSpace(content)) == 0
+}
+
+// invalidUTF8Line returns the 1-based line of the first invalid UTF-8 byte.
+func invalidUTF8Line(content []byte) int {
+	line := 1
+	for len(content) > 0 {
+		r, size := utf8.DecodeRune(content)
+		if r == utf8.RuneError && size == 1 {
+			return line
+		}
+		if r == '\n' {
+			line++
+		}
+		content = content[size:]
+	}
+	return line
+}
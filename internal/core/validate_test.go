@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	m := NewMigrator(config.Default(), database.New(&fakeExecutor{applied: []string{"000__gone", "001__ok"}}))
+	m.diag = nil
+	m.SetMigrationsFS(fstest.MapFS{
+		"001__ok.up.sql":       {Data: []byte("SELECT 1;")},
+		"001__ok.down.sql":     {Data: []byte("SELECT -1;")},
+		"002__nodown.up.sql":   {Data: []byte("SELECT 2;")},
+		"003__orphan.down.sql": {Data: []byte("SELECT -3;")},
+		"004__empty.up.sql":    {Data: []byte("  \n")},
+		"004__empty.down.sql":  {Data: []byte("SELECT -4;")},
+		"005__latin1.up.sql":   {Data: []byte("SELECT 1;\n-- caf\xe9\n")},
+		"006__dup.up.sql":      {Data: []byte("SELECT 6;")},
+		"006__dup.down.sql":    {Data: []byte("SELECT -6;")},
+		"006__dup.sql":         {Data: []byte("-- +migrate Up\nSELECT 6;\n-- +migrate Down\nSELECT -6;\n")},
+		"007__broken.sql":      {Data: []byte("SELECT 7;\n")},
+	})
+
+	found, err := m.Validate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[diagnostics.Code]string{
+		diagnostics.MissingDownMigration: "002__nodown.up.sql",
+		diagnostics.OrphanDownMigration:  "003__orphan.down.sql",
+		diagnostics.EmptyMigration:       "004__empty.up.sql",
+		diagnostics.InvalidEncoding:      "005__latin1.up.sql",
+		diagnostics.DuplicateMigration:   "006__dup.up.sql",
+		diagnostics.InvalidMigration:     "007__broken.sql",
+		diagnostics.MissingMigration:     "",
+	}
+	got := make(map[diagnostics.Code]diagnostics.Diagnostic)
+	for _, d := range found {
+		got[d.Code] = d
+	}
+	for code, file := range want {
+		d, ok := got[code]
+		if !ok {
+			t.Errorf("missing %s diagnostic, got %v", code, found)
+			continue
+		}
+		if d.File != file {
+			t.Errorf("%s reported for %q, want %q", code, d.File, file)
+		}
+	}
+	if len(found) != len(want) {
+		t.Errorf("expected %d diagnostics, got %v", len(want), found)
+	}
+	if d := got[diagnostics.InvalidEncoding]; d.Line != 2 {
+		t.Errorf("invalid UTF-8 reported at line %d, want 2", d.Line)
+	}
+	if !hasErrors(found) {
+		t.Error("expected errors")
+	}
+}
+
+func TestRun_RefusesInvalidFiles(t *testing.T) {
+	t.Parallel()
+
+	exec := &fakeExecutor{}
+	m := NewMigrator(config.Default(), database.New(exec))
+	m.diag = nil
+	m.SetMigrationsFS(fstest.MapFS{
+		"001__a.up.sql": {Data: []byte("SELECT 1;")},
+		"002__b.sql":    {Data: []byte("SELECT 2;\n")},
+	})
+
+	if _, err := m.Run(context.Background(), RunOptions{}); err == nil {
+		t.Fatal("expected Run to refuse invalid migration files")
+	}
+	for _, q := range exec.execs {
+		if q == "SELECT 1;" {
+			t.Fatal("a migration was applied despite invalid files")
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Entity states reported by Verify.
+const (
+	// VerifyCurrent is an entity matching the schema the newest migration
+	// generated from it brings its table to.
+	VerifyCurrent = "current"
+	// VerifyChanged is an entity that changed since its newest migration;
+	// generate has not been run for the change yet.
+	VerifyChanged = "changed"
+	// VerifyUntracked is an entity no migration header records, e.g.
+	// because its migrations predate headers or were written by hand.
+	VerifyUntracked = "untracked"
+)
+
+// VerifyMigration is a migration with the header generate wrote into it.
+type VerifyMigration struct {
+	Migration string `json:"migration"`
+	// Header is nil for migrations without one.
+	Header *Header `json:"header,omitempty"`
+}
+
+// VerifyEntity relates an entity to the newest migration generated from it.
+type VerifyEntity struct {
+	Table     string `json:"table"`
+	Struct    string `json:"struct,omitempty"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Status    string `json:"status"`
+	Migration string `json:"migration,omitempty"`
+}
+
+// VerifyResult is what Verify found, migrations in version order and
+// entities by table.
+type VerifyResult struct {
+	Migrations []VerifyMigration `json:"migrations"`
+	Entities   []VerifyEntity    `json:"entities"`
+}
+
+// Changed returns the entities that changed since their newest migration.
+func (r *VerifyResult) Changed() []VerifyEntity {
+	var out []VerifyEntity
+	for _, e := range r.Entities {
+		if e.Status == VerifyChanged {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Verify reads the headers of the migrations, which record the entities
+// each migration was generated from, and compares the entities of the
+// registry with the schema their newest migration brings their table to.
+// It needs no database.
+func (m *Migrator) Verify() (*VerifyResult, error) {
+	migrations, err := m.listMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migration files: %w", err)
+	}
+
+	result := &VerifyResult{Migrations: []VerifyMigration{}, Entities: []VerifyEntity{}}
+	// newest maps tables to the newest migration changing them, with the
+	// checksum of the schema it brings the table to.
+	newest := make(map[string][2]string)
+	for _, mig := range migrations {
+		content, err := m.readMigration(mig, true)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", mig.path(true), err)
+		}
+		h, ok, err := ParseHeader(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mig.path(true), err)
+		}
+		vm := VerifyMigration{Migration: mig.Base}
+		if ok {
+			vm.Header = &h
+			for _, e := range h.Entities {
+				newest[e.Table] = [2]string{mig.Base, e.Schema}
+			}
+		}
+		result.Migrations = append(result.Migrations, vm)
+	}
+
+	entities := m.config.EntityByTable()
+	schemas := m.buildSchemas()
+	tables := make([]string, 0, len(schemas))
+	for table := range schemas {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		ve := VerifyEntity{Table: table, Status: VerifyUntracked}
+		if e, ok := entities[table]; ok {
+			ve.Struct = qualifiedStruct(e)
+			ve.File, ve.Line = relativePath(e.FilePath), e.Line
+		}
+		if n, ok := newest[table]; ok {
+			ve.Migration = n[0]
+			ve.Status = VerifyCurrent
+			if n[1] != schemaChecksum(schemas[table]) {
+				ve.Status = VerifyChanged
+			}
+		}
+		result.Entities = append(result.Entities, ve)
+	}
+	return result, nil
+}
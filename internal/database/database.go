@@ -3,39 +3,161 @@ package database
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DB tracks applied migrations. Pool is nil for a DB created with New, which
+// can apply and revert migrations but not fetch schemas or take locks.
 type DB struct {
 	Pool *pgxpool.Pool
+
+	exec Executor
+	// history is the table applied migrations are recorded in, quoted;
+	// empty means schema_migrations. progress is its statement progress
+	// table, quoted.
+	history  string
+	progress string
+	// historyReady is set once the history table has the current layout.
+	historyReady bool
+}
+
+// New returns a DB that runs on exec, e.g. an application's own
+// database/sql connection or an open transaction.
+func New(exec Executor) *DB {
+	return &DB{exec: exec}
+}
+
+// Exec runs query on the underlying executor.
+func (db *DB) Exec(ctx context.Context, query string, args ...any) error {
+	return db.executor().Exec(ctx, query, args...)
+}
+
+func (db *DB) executor() Executor {
+	if db.exec == nil {
+		db.exec = FromPgx(db.Pool)
+	}
+	return db.exec
 }
 
-func NewDB(ctx context.Context, connString string) (*DB, error) {
-	pool, err := pgxpool.New(ctx, connString)
+type Option func(*options)
+
+type options struct {
+	retry   RetryPolicy
+	onRetry RetryFunc
+	pool    []func(*pgxpool.Config)
+	history string
+}
+
+// WithTracer installs a pgx query tracer on every pool connection.
+func WithTracer(t pgx.QueryTracer) Option {
+	return withPoolConfig(func(c *pgxpool.Config) { c.ConnConfig.Tracer = t })
+}
+
+// WithConnectTimeout limits how long establishing a single connection may take.
+func WithConnectTimeout(d time.Duration) Option {
+	return withPoolConfig(func(c *pgxpool.Config) { c.ConnConfig.ConnectTimeout = d })
+}
+
+// WithStatementTimeout sets statement_timeout on every pool connection.
+func WithStatementTimeout(d time.Duration) Option {
+	return withPoolConfig(func(c *pgxpool.Config) {
+		c.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(d.Milliseconds(), 10)
+	})
+}
+
+// WithRetry retries the initial connection according to p.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) { o.retry = p }
+}
+
+// OnRetry reports failed connection attempts that are going to be retried.
+func OnRetry(fn RetryFunc) Option {
+	return func(o *options) { o.onRetry = fn }
+}
+
+// WithHistoryTable records applied migrations in table instead of
+// schema_migrations, giving a separate migration history.
+func WithHistoryTable(table string) Option {
+	return func(o *options) { o.history = table }
+}
+
+func withPoolConfig(fn func(*pgxpool.Config)) Option {
+	return func(o *options) { o.pool = append(o.pool, fn) }
+}
+
+func NewDB(ctx context.Context, connString string, opts ...Option) (*DB, error) {
+	poolCfg, err := pgxpool.ParseConfig(connString)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, fn := range o.pool {
+		fn(poolCfg)
 	}
 
-	if err := pool.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	var pool *pgxpool.Pool
+	err = o.retry.do(ctx, func() error {
+		pool, err = pgxpool.NewWithConfig(ctx, poolCfg)
+		if err != nil {
+			return fmt.Errorf("failed to create connection pool: %w", err)
+		}
+		if err := pool.Ping(ctx); err != nil {
+			pool.Close()
+			return fmt.Errorf("failed to ping database: %w", err)
+		}
+		return nil
+	}, o.onRetry)
+	if err != nil {
+		return nil, err
 	}
 
-	return &DB{Pool: pool}, nil
+	db := &DB{Pool: pool}
+	if o.history != "" {
+		db.history = pgx.Identifier{o.history}.Sanitize()
+		db.progress = pgx.Identifier{o.history + progressSuffix}.Sanitize()
+	}
+	return db, nil
+}
+
+// DefaultHistoryTable is the table applied migrations are recorded in.
+const DefaultHistoryTable = "schema_migrations"
+
+func (db *DB) historyTable() string {
+	if db.history == "" {
+		return DefaultHistoryTable
+	}
+	return db.history
 }
 
 func (db *DB) Close() {
-	db.Pool.Close()
+	if db.Pool != nil {
+		db.Pool.Close()
+	}
 }
 
-func (db *DB) EnsureMigrationsTable(ctx context.Context) error {
-	_, err := db.Pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS schema_migrations (
-			name TEXT PRIMARY KEY,
-			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
-		)
-	`)
-	return err
+// ServerVersion returns the server_version_num of the database, e.g.
+// 160002 for Postgres 16.2.
+func (db *DB) ServerVersion(ctx context.Context) (int, error) {
+	rows, err := db.executor().Query(ctx, "SELECT current_setting('server_version_num')::int")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var version int
+	if rows.Next() {
+		if err := rows.Scan(&version); err != nil {
+			return 0, err
+		}
+	}
+	return version, rows.Err()
 }
 
 func (db *DB) GetAppliedMigrations(ctx context.Context) ([]string, error) {
@@ -43,7 +165,7 @@ func (db *DB) GetAppliedMigrations(ctx context.Context) ([]string, error) {
 		return nil, err
 	}
 
-	rows, err := db.Pool.Query(ctx, `SELECT name FROM schema_migrations ORDER BY applied_at ASC`)
+	rows, err := db.executor().Query(ctx, "SELECT name FROM "+db.historyTable()+" ORDER BY applied_at, apply_order")
 	if err != nil {
 		return nil, err
 	}
@@ -58,15 +180,44 @@ func (db *DB) GetAppliedMigrations(ctx context.Context) ([]string, error) {
 		migrations = append(migrations, name)
 	}
 
-	return migrations, nil
+	return migrations, rows.Err()
 }
 
-func (db *DB) RecordMigration(ctx context.Context, name string) error {
-	_, err := db.Pool.Exec(ctx, `INSERT INTO schema_migrations(name) VALUES ($1)`, name)
-	return err
+// GetAppliedChecksums returns checksums of applied migrations. Migrations
+// recorded before checksums were introduced are omitted.
+func (db *DB) GetAppliedChecksums(ctx context.Context) (map[string]string, error) {
+	if err := db.EnsureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.executor().Query(ctx, "SELECT name, checksum FROM "+db.historyTable()+" WHERE checksum IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checksums := make(map[string]string)
+	for rows.Next() {
+		var name, checksum string
+		if err := rows.Scan(&name, &checksum); err != nil {
+			return nil, err
+		}
+		checksums[name] = checksum
+	}
+
+	return checksums, rows.Err()
 }
 
 func (db *DB) RemoveMigration(ctx context.Context, name string) error {
-	_, err := db.Pool.Exec(ctx, `DELETE FROM schema_migrations WHERE name = $1`, name)
-	return err
+	return db.Exec(ctx, "DELETE FROM "+db.historyTable()+" WHERE name = $1", name)
+}
+
+// RenameMigration changes the name a migration is recorded under.
+func (db *DB) RenameMigration(ctx context.Context, from, to string) error {
+	return db.Exec(ctx, "UPDATE "+db.historyTable()+" SET name = $2 WHERE name = $1", from, to)
+}
+
+// UpdateChecksum replaces the recorded checksum of an applied migration.
+func (db *DB) UpdateChecksum(ctx context.Context, name, checksum string) error {
+	return db.Exec(ctx, "UPDATE "+db.historyTable()+" SET checksum = $2 WHERE name = $1", name, checksum)
 }
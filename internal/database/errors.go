@@ -0,0 +1,26 @@
+package database
+
+import "errors"
+
+// SQLSTATE codes of the errors a migration may lose to concurrent
+// transactions.
+const (
+	sqlStateLockNotAvailable = "55P03"
+	sqlStateDeadlockDetected = "40P01"
+)
+
+// IsLockContention reports whether err is lock_not_available, e.g. from
+// lock_timeout, or deadlock_detected: errors that may not happen again once
+// the conflicting transactions are done. It recognizes errors of pgx and of
+// any database/sql driver whose errors have an SQLState method.
+func IsLockContention(err error) bool {
+	var state interface{ SQLState() string }
+	if !errors.As(err, &state) {
+		return false
+	}
+	switch state.SQLState() {
+	case sqlStateLockNotAvailable, sqlStateDeadlockDetected:
+		return true
+	}
+	return false
+}
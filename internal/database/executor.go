@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Executor runs the statements that apply and revert migrations and
+// maintain the migrations table. FromPgx and FromSQL adapt the common
+// connection types.
+type Executor interface {
+	Exec(ctx context.Context, query string, args ...any) error
+	Query(ctx context.Context, query string, args ...any) (Rows, error)
+}
+
+// Rows is the subset of pgx.Rows and *sql.Rows that Executor results need.
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close() error
+}
+
+// PgxQuerier is implemented by *pgxpool.Pool, *pgxpool.Conn, *pgx.Conn and
+// pgx.Tx.
+type PgxQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// SQLQuerier is implemented by *sql.DB, *sql.Conn and *sql.Tx, whatever the
+// driver (lib/pq, pgx stdlib, ...).
+type SQLQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// FromPgx returns an Executor running on a pgx pool, connection or
+// transaction.
+func FromPgx(q PgxQuerier) Executor {
+	return pgxExecutor{q}
+}
+
+// FromSQL returns an Executor running on a database/sql handle.
+func FromSQL(q SQLQuerier) Executor {
+	return sqlExecutor{q}
+}
+
+type pgxExecutor struct {
+	q PgxQuerier
+}
+
+func (e pgxExecutor) Exec(ctx context.Context, query string, args ...any) error {
+	_, err := e.q.Exec(ctx, query, args...)
+	return err
+}
+
+func (e pgxExecutor) Query(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := e.q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgxRows{rows}, nil
+}
+
+type pgxRows struct {
+	pgx.Rows
+}
+
+func (r pgxRows) Close() error {
+	r.Rows.Close()
+	return r.Rows.Err()
+}
+
+type sqlExecutor struct {
+	q SQLQuerier
+}
+
+func (e sqlExecutor) Exec(ctx context.Context, query string, args ...any) error {
+	_, err := e.q.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (e sqlExecutor) Query(ctx context.Context, query string, args ...any) (Rows, error) {
+	return e.q.QueryContext(ctx, query, args...)
+}
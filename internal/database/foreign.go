@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Tools whose migration history can be imported.
+const (
+	ToolGolangMigrate = "golang-migrate"
+	ToolGoose         = "goose"
+	ToolFlyway        = "flyway"
+)
+
+// ForeignTables are the default history tables of the tools.
+var ForeignTables = map[string]string{
+	ToolGolangMigrate: "schema_migrations",
+	ToolGoose:         "goose_db_version",
+	ToolFlyway:        "flyway_schema_history",
+}
+
+// ForeignMigration is a migration another tool recorded as applied.
+type ForeignMigration struct {
+	// Version is the version as the tool records it, e.g. 20240101120000
+	// or 1.2 for Flyway.
+	Version string
+	// Baseline marks every migration up to Version as applied: golang-migrate
+	// only records the current version, Flyway baselines a database.
+	Baseline bool
+	// AppliedAt is zero when the tool does not record it.
+	AppliedAt time.Time
+}
+
+// ForeignHistory reads the migrations tool recorded as applied in table, an
+// optionally schema-qualified name.
+func (db *DB) ForeignHistory(ctx context.Context, tool, table string) ([]ForeignMigration, error) {
+	quoted := pgx.Identifier(strings.Split(table, ".")).Sanitize()
+	own := db.history
+	if own == "" {
+		own = pgx.Identifier{DefaultHistoryTable}.Sanitize()
+	}
+	if quoted == own {
+		return nil, fmt.Errorf("%s is migrateme's history table; rename the %s table first, e.g. ALTER TABLE %s RENAME TO %s_%s, and import from that",
+			table, tool, quoted, strings.ReplaceAll(tool, "-", "_"), table)
+	}
+
+	switch tool {
+	case ToolGolangMigrate:
+		return db.golangMigrateHistory(ctx, quoted)
+	case ToolGoose:
+		return db.gooseHistory(ctx, quoted)
+	case ToolFlyway:
+		return db.flywayHistory(ctx, quoted)
+	}
+	return nil, fmt.Errorf("unknown tool %q, want %s, %s or %s", tool, ToolGolangMigrate, ToolGoose, ToolFlyway)
+}
+
+// golangMigrateHistory reads the single row golang-migrate keeps: the
+// version of the last applied migration and whether it failed half way.
+func (db *DB) golangMigrateHistory(ctx context.Context, table string) ([]ForeignMigration, error) {
+	rows, err := db.executor().Query(ctx, "SELECT version, dirty FROM "+table+" LIMIT 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []ForeignMigration
+	for rows.Next() {
+		var version int64
+		var dirty bool
+		if err := rows.Scan(&version, &dirty); err != nil {
+			return nil, err
+		}
+		if dirty {
+			return nil, fmt.Errorf("golang-migrate marks version %d dirty; fix the database and force the version with golang-migrate before importing", version)
+		}
+		history = append(history, ForeignMigration{Version: strconv.FormatInt(version, 10), Baseline: true})
+	}
+	return history, rows.Err()
+}
+
+// gooseHistory replays goose's log of applies and rollbacks; version 0 is
+// the row goose creates with its table.
+func (db *DB) gooseHistory(ctx context.Context, table string) ([]ForeignMigration, error) {
+	rows, err := db.executor().Query(ctx, "SELECT version_id, is_applied, tstamp FROM "+table+" WHERE version_id > 0 ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	var order []int64
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var at time.Time
+		if err := rows.Scan(&version, &isApplied, &at); err != nil {
+			return nil, err
+		}
+		if !isApplied {
+			delete(applied, version)
+			continue
+		}
+		if _, ok := applied[version]; !ok {
+			order = append(order, version)
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var history []ForeignMigration
+	for _, version := range order {
+		if at, ok := applied[version]; ok {
+			history = append(history, ForeignMigration{Version: strconv.FormatInt(version, 10), AppliedAt: at})
+			delete(applied, version)
+		}
+	}
+	return history, nil
+}
+
+// flywayHistory reads the successful versioned migrations and baselines;
+// repeatable migrations have no version and are not imported.
+func (db *DB) flywayHistory(ctx context.Context, table string) ([]ForeignMigration, error) {
+	rows, err := db.executor().Query(ctx, "SELECT version, type, installed_on FROM "+table+
+		" WHERE success AND version IS NOT NULL ORDER BY installed_rank")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []ForeignMigration
+	for rows.Next() {
+		var m ForeignMigration
+		var kind string
+		if err := rows.Scan(&m.Version, &kind, &m.AppliedAt); err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(kind, "UNDO"):
+			// An undo migration reverts the version it is named after.
+			for i := len(history) - 1; i >= 0; i-- {
+				if history[i].Version == m.Version && !history[i].Baseline {
+					history = append(history[:i], history[i+1:]...)
+					break
+				}
+			}
+			continue
+		case kind == "BASELINE":
+			m.Baseline = true
+		}
+		history = append(history, m)
+	}
+	return history, rows.Err()
+}
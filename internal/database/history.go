@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/version"
+)
+
+// historyUpgrades[v] upgrades the history table from layout v to v+1.
+// The table records its layout in its comment, so that
+// EnsureMigrationsTable only runs the upgrades it is missing; a column the
+// history needs later is added by appending an upgrade. Tables created
+// before layouts were versioned have no comment and are treated as layout
+// 0, which holds whatever columns they already got as the upgrades are
+// idempotent.
+var historyUpgrades = []string{
+	// 1: checksums and the order migrations were applied in.
+	`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS checksum TEXT;
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS apply_order BIGSERIAL;`,
+	// 2: who applied a migration, from where and how long it took.
+	`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS applied_by TEXT DEFAULT current_user;
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS os_user TEXT;
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS hostname TEXT;
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS tool_version TEXT;
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS duration_ms BIGINT;`,
+	// 3: the run that applied a migration.
+	`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS batch BIGINT;`,
+}
+
+// historyVersion is the layout of the history table this build writes.
+var historyVersion = len(historyUpgrades)
+
+const historyCommentFormat = "migrateme history v%d"
+
+// EnsureMigrationsTable creates the history table and upgrades it to the
+// current layout.
+func (db *DB) EnsureMigrationsTable(ctx context.Context) error {
+	if db.historyReady {
+		return nil
+	}
+	table := db.historyTable()
+	if err := db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			name TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`, table)); err != nil {
+		return err
+	}
+
+	current, err := db.historyLayout(ctx)
+	if err != nil {
+		return fmt.Errorf("read history table layout: %w", err)
+	}
+	if current < historyVersion {
+		// The upgrades and the new layout are sent as one query, which runs
+		// in a single transaction: an interrupted upgrade leaves the table
+		// as it was.
+		var upgrade strings.Builder
+		for _, step := range historyUpgrades[current:] {
+			fmt.Fprintf(&upgrade, step+"\n", table)
+		}
+		fmt.Fprintf(&upgrade, "COMMENT ON TABLE %s IS '"+historyCommentFormat+"';", table, historyVersion)
+		if err := db.Exec(ctx, upgrade.String()); err != nil {
+			return fmt.Errorf("upgrade history table from layout %d to %d: %w", current, historyVersion, err)
+		}
+	}
+	db.historyReady = true
+	return nil
+}
+
+// historyLayout returns the layout the history table has, 0 when it has
+// never been versioned.
+func (db *DB) historyLayout(ctx context.Context) (int, error) {
+	rows, err := db.executor().Query(ctx, "SELECT COALESCE(obj_description(to_regclass($1), 'pg_class'), '')", db.historyTable())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var comment string
+	if rows.Next() {
+		if err := rows.Scan(&comment); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	var v int
+	if _, err := fmt.Sscanf(comment, historyCommentFormat, &v); err != nil {
+		return 0, nil
+	}
+	return v, nil
+}
+
+// HistoryEntry is an applied migration as recorded in the history table.
+// Fields other than Name and AppliedAt are empty for migrations recorded
+// before they were introduced.
+type HistoryEntry struct {
+	Name        string
+	AppliedAt   time.Time
+	Checksum    string
+	AppliedBy   string
+	OSUser      string
+	Hostname    string
+	ToolVersion string
+	Duration    time.Duration
+	// Batch numbers the runs of migrateme: migrations applied by the same
+	// run share it.
+	Batch int64
+}
+
+// GetHistory returns the applied migrations in the order they were applied.
+func (db *DB) GetHistory(ctx context.Context) ([]HistoryEntry, error) {
+	if err := db.EnsureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.executor().Query(ctx, `
+		SELECT name, applied_at, COALESCE(checksum, ''), COALESCE(applied_by, ''), COALESCE(os_user, ''),
+			COALESCE(hostname, ''), COALESCE(tool_version, ''), COALESCE(duration_ms, 0), COALESCE(batch, 0)
+		FROM `+db.historyTable()+` ORDER BY applied_at, apply_order`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		var ms int64
+		if err := rows.Scan(&e.Name, &e.AppliedAt, &e.Checksum, &e.AppliedBy, &e.OSUser, &e.Hostname, &e.ToolVersion, &ms, &e.Batch); err != nil {
+			return nil, err
+		}
+		e.Duration = time.Duration(ms) * time.Millisecond
+		history = append(history, e)
+	}
+	return history, rows.Err()
+}
+
+// MigrationRecord is what RecordMigration records about an applied
+// migration besides who applied it.
+type MigrationRecord struct {
+	Name     string
+	Checksum string
+	Duration time.Duration
+	// Batch is the run that applied the migration, see NextBatch; 0 records
+	// none.
+	Batch int64
+	// AppliedAt, when set, is recorded instead of the current time.
+	AppliedAt time.Time
+}
+
+// RecordMigration records a migration as applied, along with the OS user,
+// host and migrateme version applying it; the database user is recorded by
+// the column default.
+func (db *DB) RecordMigration(ctx context.Context, rec MigrationRecord) error {
+	osUser, host := localIdentity()
+	var appliedAt any
+	if !rec.AppliedAt.IsZero() {
+		appliedAt = rec.AppliedAt
+	}
+	return db.Exec(ctx, "INSERT INTO "+db.historyTable()+
+		"(name, checksum, os_user, hostname, tool_version, duration_ms, batch, applied_at) "+
+		"VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), $5, $6, NULLIF($7, 0), COALESCE($8, now()))",
+		rec.Name, rec.Checksum, osUser, host, version.String(), rec.Duration.Milliseconds(), rec.Batch, appliedAt)
+}
+
+// NextBatch returns the batch number for the migrations of a new run.
+func (db *DB) NextBatch(ctx context.Context) (int64, error) {
+	if err := db.EnsureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+
+	rows, err := db.executor().Query(ctx, "SELECT COALESCE(max(batch), 0) + 1 FROM "+db.historyTable())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	batch := int64(1)
+	if rows.Next() {
+		if err := rows.Scan(&batch); err != nil {
+			return 0, err
+		}
+	}
+	return batch, rows.Err()
+}
+
+// localIdentity returns the OS user and host name of this process, empty
+// when they cannot be determined.
+func localIdentity() (osUser, host string) {
+	if u, err := user.Current(); err == nil {
+		osUser = u.Username
+	} else {
+		osUser = os.Getenv("USER")
+	}
+	host, _ = os.Hostname()
+	return osUser, host
+}
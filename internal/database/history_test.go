@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type layoutExecutor struct {
+	comment string
+	execs   []string
+}
+
+func (e *layoutExecutor) Exec(_ context.Context, query string, _ ...any) error {
+	e.execs = append(e.execs, strings.TrimSpace(query))
+	return nil
+}
+
+func (e *layoutExecutor) Query(context.Context, string, ...any) (Rows, error) {
+	return &commentRows{comment: e.comment}, nil
+}
+
+type commentRows struct {
+	comment string
+	read    bool
+}
+
+func (r *commentRows) Next() bool {
+	if r.read {
+		return false
+	}
+	r.read = true
+	return true
+}
+
+func (r *commentRows) Scan(dest ...any) error {
+	*dest[0].(*string) = r.comment
+	return nil
+}
+
+func (r *commentRows) Err() error   { return nil }
+func (r *commentRows) Close() error { return nil }
+
+func TestEnsureMigrationsTable_UpgradesLayout(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		comment string
+		// want are parts of the upgrade, nil when none is due.
+		want    []string
+		notWant string
+	}{
+		"unversioned": {"", []string{"checksum", "applied_by", "batch", "COMMENT ON TABLE schema_migrations IS 'migrateme history v3'"}, ""},
+		"layout 1":    {"migrateme history v1", []string{"applied_by", "batch", "'migrateme history v3'"}, "apply_order"},
+		"current":     {"migrateme history v3", nil, ""},
+		"newer":       {"migrateme history v9", nil, ""},
+	}
+	for name, c := range cases {
+		exec := &layoutExecutor{comment: c.comment}
+		db := New(exec)
+		if err := db.EnsureMigrationsTable(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// The first statement creates the table if it is missing, the
+		// upgrade is sent as a single query.
+		got := exec.execs[1:]
+		if c.want == nil {
+			if len(got) > 0 {
+				t.Errorf("%s: upgraded a current table: %q", name, got)
+			}
+			continue
+		}
+		if len(got) != 1 {
+			t.Fatalf("%s: ran %q, want a single upgrade", name, got)
+		}
+		for _, want := range c.want {
+			if !strings.Contains(got[0], want) {
+				t.Errorf("%s: upgrade %q does not contain %q", name, got[0], want)
+			}
+		}
+		if c.notWant != "" && strings.Contains(got[0], c.notWant) {
+			t.Errorf("%s: upgrade %q repeats an applied step", name, got[0])
+		}
+
+		// The layout is only checked once per DB.
+		if err := db.EnsureMigrationsTable(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(exec.execs) != 2 {
+			t.Errorf("%s: EnsureMigrationsTable ran again: %q", name, exec.execs)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrLocked is returned by TryLock when another session holds the lock.
+var ErrLocked = errors.New("lock is held by another session")
+
+// Lock is a session-level PostgreSQL advisory lock. It pins one pool
+// connection until released, since advisory locks belong to a session.
+type Lock struct {
+	conn *pgxpool.Conn
+	key  int64
+}
+
+// TryLock takes the advisory lock identified by name without waiting.
+func (db *DB) TryLock(ctx context.Context, name string) (*Lock, error) {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	key := lockKey(name)
+	var ok bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	if !ok {
+		conn.Release()
+		return nil, ErrLocked
+	}
+
+	return &Lock{conn: conn, key: key}, nil
+}
+
+// Lock takes the advisory lock identified by name, waiting until another
+// session releases it or ctx is done.
+func (db *DB) Lock(ctx context.Context, name string) (*Lock, error) {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	key := lockKey(name)
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	return &Lock{conn: conn, key: key}, nil
+}
+
+func (l *Lock) Release(ctx context.Context) error {
+	defer l.conn.Release()
+	if _, err := l.conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		return fmt.Errorf("failed to release advisory lock: %w", err)
+	}
+	return nil
+}
+
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// progressSuffix names the statement progress table after the history
+// table: schema_migrations_progress by default.
+const progressSuffix = "_progress"
+
+func (db *DB) progressTable() string {
+	if db.progress == "" {
+		return DefaultHistoryTable + progressSuffix
+	}
+	return db.progress
+}
+
+// EnsureProgressTable creates the table recording which statements of a
+// migration applied statement by statement have succeeded.
+func (db *DB) EnsureProgressTable(ctx context.Context) error {
+	return db.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			migration TEXT NOT NULL,
+			statement INTEGER NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (migration, statement)
+		);
+	`, db.progressTable()))
+}
+
+// GetStatementProgress returns the checksums of the statements of migration
+// that have succeeded, by their 0-based index.
+func (db *DB) GetStatementProgress(ctx context.Context, migration string) (map[int]string, error) {
+	if err := db.EnsureProgressTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.executor().Query(ctx, "SELECT statement, checksum FROM "+db.progressTable()+" WHERE migration = $1", migration)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int]string)
+	for rows.Next() {
+		var statement int
+		var checksum string
+		if err := rows.Scan(&statement, &checksum); err != nil {
+			return nil, err
+		}
+		done[statement] = checksum
+	}
+	return done, rows.Err()
+}
+
+// RecordStatement records that statement of migration has succeeded.
+func (db *DB) RecordStatement(ctx context.Context, migration string, statement int, checksum string) error {
+	return db.Exec(ctx, "INSERT INTO "+db.progressTable()+"(migration, statement, checksum) VALUES ($1, $2, $3)", migration, statement, checksum)
+}
+
+// ClearStatementProgress forgets the statement progress of migration, once
+// it has been recorded as applied.
+func (db *DB) ClearStatementProgress(ctx context.Context, migration string) error {
+	return db.Exec(ctx, "DELETE FROM "+db.progressTable()+" WHERE migration = $1", migration)
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy controls how often connecting, or applying a migration that
+// lost a lock conflict, is attempted before giving up. The wait starts at
+// Backoff and doubles after every failure, up to MaxBackoff. The zero value
+// tries once.
+type RetryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// RetryFunc is called after a failed attempt, before waiting for the next.
+type RetryFunc func(attempt int, err error, wait time.Duration)
+
+func (p RetryPolicy) do(ctx context.Context, fn func() error, onRetry RetryFunc) error {
+	return p.Do(ctx, fn, nil, onRetry)
+}
+
+// Do calls fn until it succeeds, fails with an error retryable rejects, or
+// the attempts are used up, and returns the last error. A nil retryable
+// retries every error.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error, retryable func(error) bool, onRetry RetryFunc) error {
+	attempts := max(p.Attempts, 1)
+	wait := p.Backoff
+	if wait <= 0 {
+		wait = time.Second
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= attempts || (retryable != nil && !retryable(err)) {
+			return err
+		}
+		if onRetry != nil {
+			onRetry(attempt, err, wait)
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+
+		wait *= 2
+		if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+			wait = p.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRetryPolicy_RetriesUntilSuccess(t *testing.T) {
+	p := RetryPolicy{Attempts: 5, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	var calls int
+	var waits []time.Duration
+	err := p.do(context.Background(), func() error {
+		calls++
+		if calls < 4 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, func(_ int, _ error, wait time.Duration) { waits = append(waits, wait) })
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 4 {
+		t.Errorf("expected 4 calls, got %d", calls)
+	}
+	want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 2 * time.Millisecond}
+	if len(waits) != len(want) {
+		t.Fatalf("expected waits %v, got %v", want, waits)
+	}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Errorf("wait %d: expected %s, got %s", i, want[i], waits[i])
+		}
+	}
+}
+
+func TestRetryPolicy_ReturnsLastError(t *testing.T) {
+	p := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+	var calls int
+	err := p.do(context.Background(), func() error {
+		calls++
+		return errors.New("connection refused")
+	}, nil)
+
+	if err == nil || calls != 3 {
+		t.Fatalf("expected 3 failed calls, got %d (err=%v)", calls, err)
+	}
+}
+
+func TestRetryPolicy_ZeroValueTriesOnce(t *testing.T) {
+	var calls int
+	_ = RetryPolicy{}.do(context.Background(), func() error {
+		calls++
+		return errors.New("boom")
+	}, nil)
+
+	if calls != 1 {
+		t.Errorf("expected a single call, got %d", calls)
+	}
+}
+
+func TestRetryPolicy_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := RetryPolicy{Attempts: 10, Backoff: time.Hour}
+
+	var calls int
+	err := p.do(ctx, func() error {
+		calls++
+		return errors.New("connection refused")
+	}, func(int, error, time.Duration) { cancel() })
+
+	if err == nil || calls != 1 {
+		t.Fatalf("expected to stop after cancel, got %d calls (err=%v)", calls, err)
+	}
+}
+
+func TestRetryPolicy_RetriesOnlyLockContention(t *testing.T) {
+	p := RetryPolicy{Attempts: 5, Backoff: time.Millisecond}
+
+	var calls int
+	err := p.Do(context.Background(), func() error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("apply: %w", &pgconn.PgError{Code: "55P03", Message: "canceling statement due to lock timeout"})
+		}
+		return &pgconn.PgError{Code: "42P01", Message: `relation "users" does not exist`}
+	}, IsLockContention, nil)
+
+	if calls != 2 {
+		t.Errorf("expected the lock timeout to be retried once, got %d calls", calls)
+	}
+	if IsLockContention(err) {
+		t.Errorf("expected the undefined table error, got %v", err)
+	}
+}
+
+func TestIsLockContention(t *testing.T) {
+	for code, want := range map[string]bool{"55P03": true, "40P01": true, "23505": false} {
+		if got := IsLockContention(&pgconn.PgError{Code: code}); got != want {
+			t.Errorf("IsLockContention(%s) = %v, want %v", code, got, want)
+		}
+	}
+	if IsLockContention(errors.New("connection reset")) {
+		t.Error("plain errors are not lock contention")
+	}
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Scratch is a throwaway database created on a server through an admin
+// connection, for running migrations where they can do no harm.
+type Scratch struct {
+	Name string
+	DSN  string
+
+	admin *DB
+}
+
+// CreateScratch creates an empty database named prefix_<nanoseconds> on the
+// server of adminDSN, whose user must be allowed to create databases. Drop
+// removes it again.
+func CreateScratch(ctx context.Context, adminDSN, prefix string) (*Scratch, error) {
+	admin, err := NewDB(ctx, adminDSN)
+	if err != nil {
+		return nil, fmt.Errorf("connect to admin database: %w", err)
+	}
+	name := fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+	if _, err := admin.Pool.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{name}.Sanitize()); err != nil {
+		admin.Close()
+		return nil, fmt.Errorf("create database %s: %w", name, err)
+	}
+	dsn, err := WithDatabase(adminDSN, name)
+	if err != nil {
+		s := &Scratch{Name: name, admin: admin}
+		s.Drop(ctx)
+		return nil, err
+	}
+	return &Scratch{Name: name, DSN: dsn, admin: admin}, nil
+}
+
+// Drop drops the database, closing connections still open to it, and the
+// admin connection.
+func (s *Scratch) Drop(ctx context.Context) error {
+	defer s.admin.Close()
+	_, err := s.admin.Pool.Exec(context.WithoutCancel(ctx), "DROP DATABASE IF EXISTS "+pgx.Identifier{s.Name}.Sanitize()+" WITH (FORCE)")
+	if err != nil {
+		return fmt.Errorf("drop database %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+// Close releases the admin connection and keeps the database.
+func (s *Scratch) Close() {
+	s.admin.Close()
+}
+
+// WithDatabase returns dsn pointing at database name. Both URL and
+// keyword/value DSNs are supported.
+func WithDatabase(dsn, name string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("parse dsn: %w", err)
+		}
+		u.Path = "/" + name
+		return u.String(), nil
+	}
+	// Later keywords override earlier ones.
+	return strings.TrimSpace(dsn + " dbname=" + name), nil
+}
@@ -0,0 +1,22 @@
+package database
+
+import "testing"
+
+func TestWithDatabase(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"postgres://u:p@localhost:5432/app?sslmode=disable": "postgres://u:p@localhost:5432/scratch?sslmode=disable",
+		"postgresql://localhost":                            "postgresql://localhost/scratch",
+		"host=localhost dbname=app":                         "host=localhost dbname=app dbname=scratch",
+	}
+	for in, want := range cases {
+		got, err := WithDatabase(in, "scratch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("WithDatabase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
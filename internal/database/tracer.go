@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SQLLogger is a pgx query tracer that logs every executed statement with its
+// arguments, duration and outcome.
+type SQLLogger struct {
+	Logger *slog.Logger
+}
+
+type traceKey struct{}
+
+type traceStart struct {
+	sql   string
+	args  []any
+	start time.Time
+}
+
+func (l *SQLLogger) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceStart{sql: data.SQL, args: data.Args, start: time.Now()})
+}
+
+func (l *SQLLogger) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	st, _ := ctx.Value(traceKey{}).(traceStart)
+
+	attrs := []any{
+		slog.String("sql", st.sql),
+		slog.Duration("duration", time.Since(st.start)),
+	}
+	if len(st.args) > 0 {
+		attrs = append(attrs, slog.Any("args", st.args))
+	}
+	if data.Err != nil {
+		l.Logger.Error("query failed", append(attrs, slog.String("error", data.Err.Error()))...)
+		return
+	}
+	l.Logger.Info("query", append(attrs, slog.String("result", data.CommandTag.String()))...)
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSQLLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	l := &SQLLogger{Logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+	trace := func(sql string, args []any, end pgx.TraceQueryEndData) map[string]any {
+		t.Helper()
+		buf.Reset()
+		ctx := l.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql, Args: args})
+		time.Sleep(2 * time.Millisecond)
+		l.TraceQueryEnd(ctx, nil, end)
+
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("%v: %s", err, buf.String())
+		}
+		return entry
+	}
+
+	// Arguments are logged as they are, not redacted.
+	entry := trace("INSERT INTO users (email) VALUES ($1)", []any{"ann@example.com"}, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("INSERT 0 1")})
+	if entry["level"] != "INFO" || entry["msg"] != "query" || entry["sql"] != "INSERT INTO users (email) VALUES ($1)" || entry["result"] != "INSERT 0 1" {
+		t.Errorf("entry = %v", entry)
+	}
+	if args, _ := entry["args"].([]any); len(args) != 1 || args[0] != "ann@example.com" {
+		t.Errorf("args = %v", entry["args"])
+	}
+	// slog writes durations in nanoseconds.
+	if d, _ := entry["duration"].(float64); time.Duration(d) < 2*time.Millisecond || time.Duration(d) > time.Minute {
+		t.Errorf("duration = %v", entry["duration"])
+	}
+
+	entry = trace("SELECT 1/0", nil, pgx.TraceQueryEndData{Err: errors.New("division by zero")})
+	if entry["level"] != "ERROR" || entry["msg"] != "query failed" || entry["sql"] != "SELECT 1/0" || entry["error"] != "division by zero" {
+		t.Errorf("entry = %v", entry)
+	}
+	if _, ok := entry["args"]; ok {
+		t.Errorf("a statement without arguments logged args: %v", entry)
+	}
+}
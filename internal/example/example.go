@@ -0,0 +1,259 @@
+// Package example runs the whole pipeline — discover, generate, run and
+// rollback — over a set of entities in a throwaway database and checks the
+// result of every step. It backs the `example` command and the e2e test.
+package example
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/schema"
+)
+
+// DefaultEntityPaths points at the entities bundled with the repository.
+var DefaultEntityPaths = []string{"example/domain"}
+
+type Options struct {
+	// AdminDSN connects to a server where the runner may create and drop
+	// databases.
+	AdminDSN    string
+	EntityPaths []string
+	// Keep leaves the database and the migrations directory in place.
+	Keep bool
+	// Step, when set, is called after every finished step.
+	Step func(Step)
+}
+
+type Step struct {
+	Name     string        `json:"name"`
+	Detail   string        `json:"detail"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+type Report struct {
+	Database      string `json:"database"`
+	MigrationsDir string `json:"migrations_dir"`
+	Steps         []Step `json:"steps"`
+}
+
+// Run executes the scenario and returns the first failed check as an error.
+func Run(ctx context.Context, opts Options) (report *Report, err error) {
+	if len(opts.EntityPaths) == 0 {
+		opts.EntityPaths = DefaultEntityPaths
+	}
+
+	dir, err := os.MkdirTemp("", "migrateme-example-")
+	if err != nil {
+		return nil, fmt.Errorf("create migrations directory: %w", err)
+	}
+	report = &Report{MigrationsDir: dir}
+
+	scratch, err := database.CreateScratch(ctx, opts.AdminDSN, "migrateme_example")
+	if err != nil {
+		return report, err
+	}
+	report.Database = scratch.Name
+	if opts.Keep {
+		defer scratch.Close()
+	} else {
+		defer func() {
+			if dropErr := scratch.Drop(ctx); dropErr != nil && err == nil {
+				err = dropErr
+			}
+			os.RemoveAll(dir)
+		}()
+	}
+
+	dsn := scratch.DSN
+	db, err := database.NewDB(ctx, dsn)
+	if err != nil {
+		return report, fmt.Errorf("connect to %s: %w", scratch.Name, err)
+	}
+	defer db.Close()
+
+	// Config getters prefer environment variables over fields, so they have
+	// to point at the scenario too while it runs.
+	defer overrideEnv(map[string]string{
+		"MIGRATIONS_DIR": dir,
+		"ENTITY_PATHS":   strings.Join(opts.EntityPaths, ","),
+	})()
+
+	cfg := config.Default()
+	cfg.Database.DSN = dsn
+	cfg.Migrations.Dir = dir
+	cfg.EntityPaths = opts.EntityPaths
+
+	s := &scenario{cfg: cfg, db: db, report: report, onStep: opts.Step}
+	for _, st := range []struct {
+		name string
+		fn   func(context.Context) (string, error)
+	}{
+		{"discover", s.discover},
+		{"generate", s.generate},
+		{"run", s.run},
+		{"verify", s.verify},
+		{"rollback", s.rollback},
+	} {
+		if err := s.step(ctx, st.name, st.fn); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+type scenario struct {
+	cfg      *config.Config
+	db       *database.DB
+	migrator *core.Migrator
+	report   *Report
+	onStep   func(Step)
+}
+
+func (s *scenario) step(ctx context.Context, name string, fn func(context.Context) (string, error)) error {
+	start := time.Now()
+	detail, err := fn(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	st := Step{Name: name, Detail: detail, Duration: time.Since(start)}
+	s.report.Steps = append(s.report.Steps, st)
+	if s.onStep != nil {
+		s.onStep(st)
+	}
+	return nil
+}
+
+func (s *scenario) discover(context.Context) (string, error) {
+	if err := s.cfg.InitRegistry(); err != nil {
+		return "", err
+	}
+	if len(s.cfg.Registry) == 0 {
+		return "", fmt.Errorf("no entities found in %v", s.cfg.EntityPaths)
+	}
+	s.migrator = core.NewMigrator(s.cfg, s.db)
+	return fmt.Sprintf("%d entities", len(s.cfg.Registry)), nil
+}
+
+func (s *scenario) generate(ctx context.Context) (string, error) {
+	result, err := s.migrator.Generate(ctx, core.GenerateOptions{MigrationName: "example"})
+	if err != nil {
+		return "", err
+	}
+	if len(result.CreatedFiles) != 2 {
+		return "", fmt.Errorf("expected an up and a down file, got %v", result.CreatedFiles)
+	}
+	for _, c := range result.Changes {
+		if c.Type != core.CreateTable {
+			return "", fmt.Errorf("expected %s to be created on an empty database, got %s", c.TableName, c.Type)
+		}
+	}
+	if len(result.Changes) != len(s.cfg.Registry) {
+		return "", fmt.Errorf("expected %d created tables, got %d", len(s.cfg.Registry), len(result.Changes))
+	}
+	return fmt.Sprintf("%d tables", len(result.Changes)), nil
+}
+
+func (s *scenario) run(ctx context.Context) (string, error) {
+	applied, err := s.migrator.Run(ctx, core.RunOptions{StrictChecksums: true})
+	if err != nil {
+		return "", err
+	}
+	if len(applied) != 1 {
+		return "", fmt.Errorf("expected 1 applied migration, got %v", applied)
+	}
+	return applied[0], nil
+}
+
+// verify checks that the database now matches the entities exactly.
+func (s *scenario) verify(ctx context.Context) (string, error) {
+	live, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	declared := make([]migrate.TableSchema, 0, len(s.cfg.Registry))
+	for name, build := range s.cfg.Registry {
+		declared = append(declared, build(name))
+	}
+	if diff := schema.Compare(live, declared); len(diff) > 0 {
+		return "", fmt.Errorf("database differs from entities: %+v", diff)
+	}
+
+	result, err := s.migrator.Generate(ctx, core.GenerateOptions{DryRun: true})
+	if err != nil {
+		return "", err
+	}
+	if len(result.Changes) > 0 {
+		return "", fmt.Errorf("generate is not idempotent, it would still change %d tables", len(result.Changes))
+	}
+	return "no drift", nil
+}
+
+func (s *scenario) rollback(ctx context.Context) (string, error) {
+	rolledBack, err := s.migrator.Rollback(ctx, 1)
+	if err != nil {
+		return "", err
+	}
+	if len(rolledBack) != 1 {
+		return "", fmt.Errorf("expected 1 rolled back migration, got %v", rolledBack)
+	}
+
+	live, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range live {
+		if len(t.Columns) > 0 {
+			return "", fmt.Errorf("table %s still exists after rollback", t.TableName)
+		}
+	}
+
+	_, pending, err := s.migrator.Status(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(pending) != 1 {
+		return "", fmt.Errorf("expected the migration to be pending again, got %v", pending)
+	}
+	return rolledBack[0], nil
+}
+
+func (s *scenario) fetch(ctx context.Context) ([]migrate.TableSchema, error) {
+	fetcher := schema.NewFetcher(s.db.Pool)
+	out := make([]migrate.TableSchema, 0, len(s.cfg.Registry))
+	for name := range s.cfg.Registry {
+		ts, err := fetcher.Fetch(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ts)
+	}
+	return out, nil
+}
+
+func overrideEnv(vars map[string]string) (restore func()) {
+	prev := make(map[string]*string, len(vars))
+	for k, v := range vars {
+		if old, ok := os.LookupEnv(k); ok {
+			prev[k] = &old
+		} else {
+			prev[k] = nil
+		}
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k, old := range prev {
+			if old == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *old)
+			}
+		}
+	}
+}
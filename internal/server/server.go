@@ -0,0 +1,198 @@
+// Package server serves the migrations of the databases in a config over
+// gRPC, for a central service that plans and applies migrations of many
+// application databases on request. The API is the Migrations service of
+// pkg/serverpb:
+//
+//	Status    applied and pending migrations
+//	Plan      the pending migrations with the SQL Apply would execute
+//	Apply     applies the pending migrations
+//	Rollback  reverts the last steps applied migrations
+//
+// Requests name the service (an entry of services in the config, or "" for
+// the top-level settings) and carry the metadata "authorization: Bearer
+// <token>". Apply and Rollback are written to the audit log; only one of
+// them runs at a time per service.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/access"
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/serverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ActorMetadata names who triggered a request, for the audit log.
+const ActorMetadata = "x-migrateme-actor"
+
+// Server implements the Migrations service. Token must be set.
+type Server struct {
+	serverpb.UnimplementedMigrationsServer
+
+	Token string
+	// Load returns the config of a service.
+	Load func(service string) (*config.Config, error)
+	// Audit receives a JSON line per Apply and Rollback; nil discards them.
+	Audit io.Writer
+
+	auditMu sync.Mutex
+	// changing refuses an Apply or Rollback of a service while another one
+	// of the same service runs.
+	changing access.Exclusive
+}
+
+// AuditEntry is a line of the audit log.
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Service  string    `json:"service"`
+	Group    string    `json:"group,omitempty"`
+	Actor    string    `json:"actor,omitempty"`
+	Remote   string    `json:"remote"`
+	Ran      []string  `json:"ran,omitempty"`
+	Reverted []string  `json:"reverted,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Duration int64     `json:"duration_ms"`
+}
+
+type method func(ctx context.Context, m *core.Migrator, req *serverpb.Request, resp *serverpb.Response) error
+
+// GRPCServer returns a gRPC server with the Migrations service registered
+// behind the token check.
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	g := grpc.NewServer(append(opts, grpc.UnaryInterceptor(s.authenticate))...)
+	serverpb.RegisterMigrationsServer(g, s)
+	return g
+}
+
+// authenticate rejects calls without the token before they reach a method.
+func (s *Server) authenticate(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !access.Bearer(firstMetadata(ctx, "authorization"), s.Token) {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) Status(ctx context.Context, req *serverpb.Request) (*serverpb.Response, error) {
+	return s.serve(ctx, "Status", false, req, statusOf)
+}
+
+func (s *Server) Plan(ctx context.Context, req *serverpb.Request) (*serverpb.Response, error) {
+	return s.serve(ctx, "Plan", false, req, plan)
+}
+
+func (s *Server) Apply(ctx context.Context, req *serverpb.Request) (*serverpb.Response, error) {
+	return s.serve(ctx, "Apply", true, req, apply)
+}
+
+func (s *Server) Rollback(ctx context.Context, req *serverpb.Request) (*serverpb.Response, error) {
+	return s.serve(ctx, "Rollback", true, req, rollback)
+}
+
+func (s *Server) serve(ctx context.Context, name string, audited bool, req *serverpb.Request, fn method) (*serverpb.Response, error) {
+	cfg, err := s.Load(req.Service)
+	if err == nil {
+		err = cfg.SelectGroup(req.Group)
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if audited {
+		release, ok := s.changing.TryAcquire(req.Service)
+		if !ok {
+			return nil, status.Errorf(codes.Aborted, "migrations of service %q are already being changed", req.Service)
+		}
+		defer release()
+	}
+
+	resp := &serverpb.Response{Service: req.Service}
+	start := time.Now()
+	err = s.call(ctx, cfg, req, resp, fn)
+	if audited {
+		entry := AuditEntry{
+			Time: start, Method: name, Service: req.Service, Group: req.Group,
+			Actor: firstMetadata(ctx, ActorMetadata), Ran: resp.Ran, Reverted: resp.Reverted,
+			Duration: time.Since(start).Milliseconds(),
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			entry.Remote = p.Addr.String()
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		s.audit(entry)
+	}
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return resp, nil
+}
+
+// call connects to the database of cfg for the duration of one method.
+func (s *Server) call(ctx context.Context, cfg *config.Config, req *serverpb.Request, resp *serverpb.Response, fn method) error {
+	db, err := database.NewDB(ctx, cfg.GetDSN(), cfg.DBOptions()...)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to connect to database: %v", err)
+	}
+	defer db.Close()
+	return fn(ctx, core.NewMigrator(cfg, db), req, resp)
+}
+
+func statusOf(ctx context.Context, m *core.Migrator, _ *serverpb.Request, resp *serverpb.Response) error {
+	var err error
+	resp.Applied, resp.Pending, err = m.Status(ctx)
+	return err
+}
+
+func plan(ctx context.Context, m *core.Migrator, _ *serverpb.Request, resp *serverpb.Response) error {
+	pending, err := m.Pending(ctx)
+	for _, p := range pending {
+		resp.Plan = append(resp.Plan, &serverpb.PendingMigration{Migration: p.Migration, Statements: int32(p.Statements), Sql: p.SQL})
+	}
+	return err
+}
+
+// apply takes the run lock, so that it never races a deploy running the
+// same migrations.
+func apply(ctx context.Context, m *core.Migrator, _ *serverpb.Request, resp *serverpb.Response) error {
+	var err error
+	resp.Ran, err = m.Run(ctx, core.RunOptions{StrictChecksums: true, Lock: true})
+	return err
+}
+
+func rollback(ctx context.Context, m *core.Migrator, req *serverpb.Request, resp *serverpb.Response) error {
+	var err error
+	resp.Reverted, err = m.Rollback(ctx, max(int(req.Steps), 1))
+	return err
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (s *Server) audit(e AuditEntry) {
+	if s.Audit == nil {
+		return
+	}
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	_ = json.NewEncoder(s.Audit).Encode(e)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/amr0ny/migrateme/pkg/serverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial serves s over an in-memory listener and returns a client of it.
+func dial(t *testing.T, s *Server) serverpb.MigrationsClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	g := s.GRPCServer()
+	go func() { _ = g.Serve(lis) }()
+	t.Cleanup(g.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return serverpb.NewMigrationsClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestServer_Auth(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var loaded []string
+	client := dial(t, &Server{Token: "secret", Load: func(service string) (*config.Config, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loaded = append(loaded, service)
+		return nil, fmt.Errorf("unknown service %q", service)
+	}})
+	req := &serverpb.Request{Service: "billing"}
+
+	if _, err := client.Apply(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Apply without a token: %v", err)
+	}
+	if _, err := client.Apply(withToken("guess"), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Apply with a wrong token: %v", err)
+	}
+	mu.Lock()
+	if len(loaded) != 0 {
+		t.Fatalf("unauthenticated calls loaded configs: %v", loaded)
+	}
+	mu.Unlock()
+
+	_, err := client.Status(withToken("secret"), req)
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "unknown service") {
+		t.Errorf("Status of an unknown service: %v", err)
+	}
+}
+
+func TestServer_NoTokenRejectsAll(t *testing.T) {
+	t.Parallel()
+
+	client := dial(t, &Server{Load: func(string) (*config.Config, error) { return config.Default(), nil }})
+	if _, err := client.Status(withToken(""), &serverpb.Request{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("call to a server without token: %v", err)
+	}
+}
+
+func TestServer_OneChangePerService(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{Token: "secret", Load: func(string) (*config.Config, error) { return config.Default(), nil }}
+	release, ok := s.changing.TryAcquire("billing")
+	if !ok {
+		t.Fatal("TryAcquire failed on an idle server")
+	}
+	defer release()
+
+	client := dial(t, s)
+	if _, err := client.Rollback(withToken("secret"), &serverpb.Request{Service: "billing"}); status.Code(err) != codes.Aborted {
+		t.Errorf("Rollback while billing is being changed: %v", err)
+	}
+}
+
+func TestServer_Audit(t *testing.T) {
+	t.Parallel()
+
+	var log bytes.Buffer
+	s := &Server{Audit: &log}
+	s.audit(AuditEntry{Method: "Apply", Service: "billing", Actor: "deploy-bot", Ran: []string{"0001__users"}})
+
+	var e AuditEntry
+	if err := json.Unmarshal(log.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Method != "Apply" || e.Actor != "deploy-bot" || len(e.Ran) != 1 {
+		t.Fatalf("audit entry %+v", e)
+	}
+}
@@ -0,0 +1,31 @@
+// Package version reports the version of the migrateme build.
+package version
+
+import "runtime/debug"
+
+// Version is set at build time with
+//
+//	-ldflags "-X github.com/amr0ny/migrateme/internal/version.Version=v1.2.3"
+//
+// Without it, the module version recorded by go install is used.
+var Version = ""
+
+// String returns the version of the running migrateme, or "devel" for a
+// build from a source checkout.
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			// Programs embedding migrateme (see pkg/cli) depend on it.
+			if dep.Path == "github.com/amr0ny/migrateme" {
+				return dep.Version
+			}
+		}
+		if info.Main.Path == "github.com/amr0ny/migrateme" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			return info.Main.Version
+		}
+	}
+	return "devel"
+}
@@ -0,0 +1,23 @@
+// Package cli runs the migrateme command line from a program of the
+// application. Types registered with migrate.Register before Execute are
+// entities along with those discovered in entity_paths, so a small program
+// can replace discovery entirely:
+//
+//	func main() {
+//		migrate.Register[domain.User]("users")
+//		migrate.Register[domain.Order]("orders")
+//		os.Exit(cli.Execute())
+//	}
+//
+// and is run as go run ./cmd/migrate generate.
+package cli
+
+import (
+	internalcli "github.com/amr0ny/migrateme/internal/cli"
+)
+
+// Execute runs the command given by the process arguments and returns the
+// exit code.
+func Execute() int {
+	return internalcli.Execute()
+}
@@ -4,14 +4,20 @@ import (
 	"context"
 	"fmt"
 	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
 	"github.com/amr0ny/migrateme/pkg/discovery"
 	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/policy"
 	"github.com/amr0ny/migrateme/pkg/schema"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"gopkg.in/yaml.v3"
@@ -19,11 +25,97 @@ import (
 
 type DatabaseConfig struct {
 	DSN string `yaml:"dsn" env:"DATABASE_DSN"`
+
+	// ConnectTimeout limits a single connection attempt; zero means no limit.
+	ConnectTimeout time.Duration `yaml:"connect_timeout,omitempty" env:"DATABASE_CONNECT_TIMEOUT"`
+
+	// StatementTimeout sets statement_timeout for every session; zero keeps
+	// the server default. It applies to migrations too.
+	StatementTimeout time.Duration `yaml:"statement_timeout,omitempty" env:"DATABASE_STATEMENT_TIMEOUT"`
+
+	Retry RetryConfig `yaml:"retry,omitempty"`
+}
+
+// RetryConfig retries the initial connection, e.g. while a database
+// container is still starting. The wait doubles after every failed attempt.
+type RetryConfig struct {
+	Attempts   int           `yaml:"attempts,omitempty" env:"DATABASE_RETRY_ATTEMPTS"`
+	Backoff    time.Duration `yaml:"backoff,omitempty" env:"DATABASE_RETRY_BACKOFF"`
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
 }
 
 type MigrationsConfig struct {
 	Dir       string `yaml:"dir" env:"MIGRATIONS_DIR"`
 	TableName string `yaml:"table_name" env:"MIGRATIONS_TABLE"`
+
+	// Templates renders migration files through text/template before they
+	// are applied, with Vars as data.
+	Templates bool `yaml:"templates,omitempty"`
+
+	// Format selects how generate writes migrations: "split" (default) for
+	// <name>.up.sql and <name>.down.sql, or "single" for one <name>.sql with
+	// -- +migrate Up/Down sections. The runner reads both.
+	Format string `yaml:"format,omitempty"`
+
+	// Naming selects the migration file names: "timestamp_name_hash"
+	// (default), "timestamp" or "sequential" (0001__name, 0002__name, ...).
+	Naming string `yaml:"naming,omitempty"`
+
+	// DeferrableCycles creates foreign keys that close a reference cycle as
+	// DEFERRABLE INITIALLY DEFERRED.
+	DeferrableCycles bool `yaml:"deferrable_cycles,omitempty"`
+
+	// PreserveColumnOrder rebuilds a table (copy, drop, recreate) when its
+	// declared column order no longer matches the database, instead of
+	// appending new columns at the end.
+	PreserveColumnOrder bool `yaml:"preserve_column_order,omitempty"`
+
+	// AllowNarrowing lets generate shrink a column's length, precision or
+	// scale, e.g. varchar(255) to varchar(50). Without it such changes are
+	// reported and skipped.
+	AllowNarrowing bool `yaml:"allow_narrowing,omitempty"`
+
+	// Identifiers maps declared table and column names to database
+	// identifiers: "preserve" (default), "lower" or "snake_case".
+	Identifiers string `yaml:"identifiers,omitempty"`
+
+	// CaseInsensitive selects how columns tagged ci are generated: "citext"
+	// (default) or "lower", text with a unique index on lower(column).
+	CaseInsensitive string `yaml:"case_insensitive,omitempty"`
+
+	// TouchUpdatedAt adds a set_updated_at() trigger to every table with an
+	// updated_at timestamp column, like those of entities embedding a
+	// created_at/updated_at base struct, so the database keeps it current.
+	TouchUpdatedAt bool `yaml:"touch_updated_at,omitempty"`
+
+	// EmitSchemaFile makes generate write schema.sql next to the
+	// migrations: the DDL creating every registered table from scratch, so
+	// reviewers can read the resulting schema instead of replaying migrations.
+	EmitSchemaFile bool `yaml:"emit_schema_file,omitempty"`
+
+	// LockTimeout and StatementTimeout are set with SET LOCAL in the
+	// transaction of every migration that is applied or rolled back, so DDL
+	// waiting behind a long transaction fails instead of blocking the
+	// queries queued behind it. Zero leaves the session setting. A migration
+	// overrides them with -- migrateme:lock_timeout and
+	// -- migrateme:statement_timeout directives.
+	LockTimeout      time.Duration `yaml:"lock_timeout,omitempty" env:"MIGRATIONS_LOCK_TIMEOUT"`
+	StatementTimeout time.Duration `yaml:"statement_timeout,omitempty" env:"MIGRATIONS_STATEMENT_TIMEOUT"`
+
+	// LockRetry applies a migration again, with exponential backoff, when
+	// it fails with lock_not_available or deadlock_detected, instead of
+	// aborting the run. Attempts of 0 or 1 do not retry.
+	LockRetry RetryConfig `yaml:"lock_retry,omitempty"`
+}
+
+// SnapshotConfig configures copying anonymized data into another database.
+type SnapshotConfig struct {
+	// TargetDSN is the database snapshot copies into, e.g. staging.
+	TargetDSN string `yaml:"target_dsn,omitempty" env:"SNAPSHOT_TARGET_DSN"`
+
+	// Salt is mixed into anon=hash and anon=fake_email values, so they
+	// cannot be reversed by hashing guessed values. Keep it secret.
+	Salt string `yaml:"salt,omitempty" env:"SNAPSHOT_SALT"`
 }
 
 type LoggingConfig struct {
@@ -31,12 +123,53 @@ type LoggingConfig struct {
 	Format string `yaml:"format" env:"LOG_FORMAT"`
 }
 
+type DiagnosticsConfig struct {
+	// Suppress lists diagnostic codes (e.g. MM1001) that are never reported.
+	Suppress []string `yaml:"suppress,omitempty"`
+}
+
+type HooksConfig struct {
+	// Plugins are paths to Go plugins exporting a hooks.Hook.
+	Plugins []string `yaml:"plugins,omitempty"`
+}
+
+// PublicationConfig assigns managed tables to a logical replication
+// publication. The table name "*" matches every managed table.
+type PublicationConfig struct {
+	Name   string   `yaml:"name"`
+	Tables []string `yaml:"tables"`
+}
+
+// PublicationsFor returns the names of publications that include table.
+func (c *Config) PublicationsFor(table string) []string {
+	var out []string
+	for _, p := range c.Publications {
+		for _, t := range p.Tables {
+			if t == "*" || strings.EqualFold(t, table) {
+				out = append(out, p.Name)
+				break
+			}
+		}
+	}
+	return out
+}
+
 var (
 	once      sync.Once
 	config    *Config
 	configErr error
+	// service is the entry of services Load applies, see SetService.
+	service string
 )
 
+// SetService makes Load apply the services entry name over the top-level
+// settings, for configs that manage several databases. It must be called
+// before Load; the MIGRATEME_SERVICE environment variable is used when it is
+// not.
+func SetService(name string) {
+	service = name
+}
+
 // ==================================================
 // PUBLIC API
 // ==================================================
@@ -49,17 +182,42 @@ func (c *Config) GetDSN() string {
 }
 
 func (c *Config) GetMigrationsDir() string {
+	dir := c.Migrations.Dir
 	if env := os.Getenv("MIGRATIONS_DIR"); env != "" {
-		return env
+		dir = env
 	}
-	return c.Migrations.Dir
+	if c.group != "" {
+		return filepath.Join(dir, c.group)
+	}
+	return dir
 }
 
+// GetMigrationsTable returns the table applied migrations are recorded in:
+// migrations.table_name (MIGRATIONS_TABLE), schema_migrations by default,
+// with _<group> appended when a group is selected.
 func (c *Config) GetMigrationsTable() string {
+	if c.group != "" {
+		return c.historyTable() + "_" + c.group
+	}
+	return c.historyTable()
+}
+
+// IsHistoryTable reports whether table records migrations for this config:
+// the history table of no group or of any group, or their statement
+// progress tables.
+func (c *Config) IsHistoryTable(table string) bool {
+	base := c.historyTable()
+	return table == base || strings.HasPrefix(table, base+"_")
+}
+
+func (c *Config) historyTable() string {
 	if env := os.Getenv("MIGRATIONS_TABLE"); env != "" {
 		return env
 	}
-	return c.Migrations.TableName
+	if c.Migrations.TableName != "" {
+		return c.Migrations.TableName
+	}
+	return database.DefaultHistoryTable
 }
 
 func (c *Config) GetLogLevel() string {
@@ -88,12 +246,131 @@ func (c *Config) GetEntityPaths() []string {
 	return c.EntityPaths
 }
 
+// Reporter returns the diagnostics collector shared by discovery and core.
+func (c *Config) Reporter() *diagnostics.Collector {
+	if c.reporter == nil {
+		c.reporter = diagnostics.NewCollector(os.Stderr, c.Diagnostics.Suppress)
+	}
+	return c.reporter
+}
+
+// TableComments returns the doc comment of each discovered entity by table.
+func (c *Config) TableComments() map[string]string {
+	out := make(map[string]string, len(c.Entities))
+	for _, e := range c.Entities {
+		out[e.TableName] = e.Comment
+	}
+	return out
+}
+
+// EntityByTable returns the entities by the registry table they build, that
+// is with the identifier policy applied to their table names.
+func (c *Config) EntityByTable() map[string]migrate.EntityInfo {
+	// Load has validated the policy already.
+	policy, _ := migrate.ParseIdentifierPolicy(c.Migrations.Identifiers)
+	out := make(map[string]migrate.EntityInfo, len(c.Entities))
+	for _, e := range c.Entities {
+		out[policy.Ident(e.TableName)] = e
+	}
+	return out
+}
+
+// TemplateVars returns Vars with environment overrides applied.
+func (c *Config) TemplateVars() map[string]string {
+	vars := make(map[string]string, len(c.Vars))
+	for k, v := range c.Vars {
+		vars[k] = v
+	}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if name, ok := strings.CutPrefix(k, "MIGRATEME_VAR_"); ok && name != "" {
+			vars[strings.ToLower(name)] = v
+		}
+	}
+	return vars
+}
+
 func (c *Config) HasEntityPaths() bool {
 	return len(c.GetEntityPaths()) > 0
 }
 
+// DBOptions returns the connection options configured under database.
+func (c *Config) DBOptions() []database.Option {
+	var opts []database.Option
+	if d := c.Database.ConnectTimeout; d > 0 {
+		opts = append(opts, database.WithConnectTimeout(d))
+	}
+	if d := c.Database.StatementTimeout; d > 0 {
+		opts = append(opts, database.WithStatementTimeout(d))
+	}
+	if r := c.Database.Retry; r.Attempts > 1 {
+		opts = append(opts, database.WithRetry(database.RetryPolicy{
+			Attempts:   r.Attempts,
+			Backoff:    r.Backoff,
+			MaxBackoff: r.MaxBackoff,
+		}))
+	}
+	if table := c.GetMigrationsTable(); table != database.DefaultHistoryTable {
+		opts = append(opts, database.WithHistoryTable(table))
+	}
+	return opts
+}
+
+// LockRetryPolicy returns the policy for retrying migrations that lost a
+// lock conflict, configured under migrations.lock_retry.
+func (c *Config) LockRetryPolicy() database.RetryPolicy {
+	r := c.Migrations.LockRetry
+	return database.RetryPolicy{Attempts: r.Attempts, Backoff: r.Backoff, MaxBackoff: r.MaxBackoff}
+}
+
+var groupNameRE = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// SelectGroup scopes the config to the entities of group (migrate:group), or
+// to the entities in no group when group is empty. The migrations of a group
+// live in a subdirectory of the migrations dir named after it, and are
+// recorded in their own history table, GetMigrationsTable.
+func (c *Config) SelectGroup(group string) error {
+	group = strings.ToLower(strings.TrimSpace(group))
+	if group != "" && !groupNameRE.MatchString(group) {
+		return fmt.Errorf("invalid group %q: use lowercase letters, digits and underscores", group)
+	}
+	var entities []migrate.EntityInfo
+	for _, e := range c.Entities {
+		if e.Group == group {
+			entities = append(entities, e)
+		}
+	}
+	if group != "" && len(entities) == 0 {
+		return fmt.Errorf("no entities are in group %q; groups: %s", group, strings.Join(c.Groups(), ", "))
+	}
+	if err := c.setEntities(entities); err != nil {
+		return err
+	}
+	c.group = group
+	return nil
+}
+
+// Group returns the group selected with SelectGroup.
+func (c *Config) Group() string {
+	return c.group
+}
+
+// Groups returns the groups entities are in, sorted.
+func (c *Config) Groups() []string {
+	seen := map[string]bool{}
+	var groups []string
+	for _, e := range c.Entities {
+		if e.Group != "" && !seen[e.Group] {
+			seen[e.Group] = true
+			groups = append(groups, e.Group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
 func (c *Config) NewPool(ctx context.Context) (*pgxpool.Pool, error) {
-	db, err := database.NewDB(ctx, c.GetDSN())
+	db, err := database.NewDB(ctx, c.GetDSN(), c.DBOptions()...)
 	if err != nil {
 		return nil, err
 	}
@@ -104,8 +381,9 @@ func (c *Config) NewPool(ctx context.Context) (*pgxpool.Pool, error) {
 // INTERNAL LOADING PIPELINE
 // ==================================================
 
-func loadConfig(configPath ...string) (*Config, error) {
-	cfg := &Config{
+// Default returns a config populated with built-in defaults only.
+func Default() *Config {
+	return &Config{
 		Migrations: MigrationsConfig{
 			Dir:       "migrations",
 			TableName: "schema_migrations",
@@ -115,17 +393,77 @@ func loadConfig(configPath ...string) (*Config, error) {
 			Format: "text",
 		},
 	}
+}
+
+func loadConfig(configPath ...string) (*Config, error) {
+	name := service
+	if name == "" {
+		name = os.Getenv("MIGRATEME_SERVICE")
+	}
+	return loadServiceConfig(name, configPath...)
+}
+
+func loadServiceConfig(name string, configPath ...string) (*Config, error) {
+	cfg := Default()
 
 	path := getConfigPath(configPath...)
 	if err := loadYAMLConfig(path, cfg); err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("failed to load YAML config: %w", err)
 	}
 
-	loadEnvConfig(cfg)
+	if err := cfg.applyService(name); err != nil {
+		return nil, err
+	}
+
+	if err := loadEnvConfig(cfg); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
 
+// applyService decodes the services entry name over the config. Settings it
+// does not mention keep their top-level values.
+func (c *Config) applyService(name string) error {
+	if name == "" {
+		return nil
+	}
+	node, ok := c.Services[name]
+	if !ok {
+		if len(c.Services) == 0 {
+			return fmt.Errorf("unknown service %q: no services are configured", name)
+		}
+		return fmt.Errorf("unknown service %q; services: %s", name, strings.Join(c.ServiceNames(), ", "))
+	}
+	var nested struct {
+		Services yaml.Node `yaml:"services"`
+	}
+	if err := node.Decode(&nested); err == nil && !nested.Services.IsZero() {
+		return fmt.Errorf("service %q: services cannot be nested", name)
+	}
+	if err := node.Decode(c); err != nil {
+		return fmt.Errorf("invalid config of service %q: %w", name, err)
+	}
+	c.service = name
+	return nil
+}
+
+// Service returns the name of the service the config was loaded for, or ""
+// for the top-level settings.
+func (c *Config) Service() string {
+	return c.service
+}
+
+// ServiceNames returns the configured services, sorted.
+func (c *Config) ServiceNames() []string {
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // ==================================================
 // CONFIG LOCATION
 // ==================================================
@@ -163,11 +501,33 @@ func loadYAMLConfig(path string, cfg *Config) error {
 	return nil
 }
 
-func loadEnvConfig(cfg *Config) {
+func loadEnvConfig(cfg *Config) error {
 	// Database config
 	if v := os.Getenv("DATABASE_DSN"); v != "" {
 		cfg.Database.DSN = v
 	}
+	for name, dst := range map[string]*time.Duration{
+		"DATABASE_CONNECT_TIMEOUT":     &cfg.Database.ConnectTimeout,
+		"DATABASE_STATEMENT_TIMEOUT":   &cfg.Database.StatementTimeout,
+		"DATABASE_RETRY_BACKOFF":       &cfg.Database.Retry.Backoff,
+		"MIGRATIONS_LOCK_TIMEOUT":      &cfg.Migrations.LockTimeout,
+		"MIGRATIONS_STATEMENT_TIMEOUT": &cfg.Migrations.StatementTimeout,
+	} {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*dst = d
+		}
+	}
+	if v := os.Getenv("DATABASE_RETRY_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid DATABASE_RETRY_ATTEMPTS: %w", err)
+		}
+		cfg.Database.Retry.Attempts = n
+	}
 
 	// Migrations config
 	if v := os.Getenv("MIGRATIONS_DIR"); v != "" {
@@ -177,6 +537,14 @@ func loadEnvConfig(cfg *Config) {
 		cfg.Migrations.TableName = v
 	}
 
+	// Snapshot config
+	if v := os.Getenv("SNAPSHOT_TARGET_DSN"); v != "" {
+		cfg.Snapshot.TargetDSN = v
+	}
+	if v := os.Getenv("SNAPSHOT_SALT"); v != "" {
+		cfg.Snapshot.Salt = v
+	}
+
 	// Logging config
 	if v := os.Getenv("LOG_LEVEL"); v != "" {
 		cfg.Logging.Level = v
@@ -193,12 +561,34 @@ func loadEnvConfig(cfg *Config) {
 		}
 		cfg.EntityPaths = strings.Split(v, separator)
 	}
+
+	return nil
 }
 
 // ==================================================
 // PATH RESOLUTION WITH GLOBS
 // ==================================================
 
+// withRegistered adds registered entities to discovered ones. A registered
+// type replaces a discovered struct of the same table, since registering it
+// is explicit.
+func withRegistered(discovered, registered []migrate.EntityInfo) []migrate.EntityInfo {
+	if len(registered) == 0 {
+		return discovered
+	}
+	tables := make(map[string]bool, len(registered))
+	for _, e := range registered {
+		tables[strings.ToLower(e.TableName)] = true
+	}
+	out := make([]migrate.EntityInfo, 0, len(discovered)+len(registered))
+	for _, e := range discovered {
+		if !tables[strings.ToLower(e.TableName)] {
+			out = append(out, e)
+		}
+	}
+	return append(out, registered...)
+}
+
 func ResolveEntityPaths(patterns []string) ([]string, error) {
 	var result []string
 
@@ -235,11 +625,6 @@ func containsRecursive(p string) bool {
 }
 
 func expandRecursive(pattern string) ([]string, error) {
-	base := pattern
-	for strings.Contains(base, "**") {
-		base = strings.Replace(base, "**", "*", 1)
-	}
-
 	root := string([]rune(pattern)[:strings.Index(pattern, "**")])
 
 	var matches []string
@@ -256,8 +641,7 @@ func expandRecursive(pattern string) ([]string, error) {
 			return nil
 		}
 
-		ok, _ := filepath.Match(base, path)
-		if ok && !info.IsDir() && strings.HasSuffix(path, ".go") {
+		if !info.IsDir() && strings.HasSuffix(path, ".go") && matchRecursive(pattern, path) {
 			matches = append(matches, path)
 		}
 
@@ -267,14 +651,78 @@ func expandRecursive(pattern string) ([]string, error) {
 	return matches, err
 }
 
+// matchRecursive reports whether path matches pattern, in which a "**"
+// element matches any number of directories, none included: dir/**/*.go
+// matches dir/a.go as well as dir/x/y/a.go.
+func matchRecursive(pattern, path string) bool {
+	pattern, path = filepath.ToSlash(filepath.Clean(pattern)), filepath.ToSlash(filepath.Clean(path))
+	return matchElems(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func matchElems(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchElems(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(strings.ReplaceAll(pattern[0], "**", "*"), path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
 type Config struct {
 	Database   DatabaseConfig   `yaml:"database"`
 	Migrations MigrationsConfig `yaml:"migrations"`
 	Logging    LoggingConfig    `yaml:"logging"`
+	Snapshot   SnapshotConfig   `yaml:"snapshot,omitempty"`
 
 	EntityPaths []string `yaml:"entity_paths" env:"ENTITY_PATHS" envSeparator:","`
+	// EntityTags lists the struct tags columns are read from, by priority:
+	// db, bun, gorm and json. The default is db only.
+	EntityTags []string `yaml:"entity_tags,omitempty"`
+	// InferColumns turns exported untagged entity fields into columns named
+	// in snake_case, with a type inferred from the Go type.
+	InferColumns bool `yaml:"infer_columns,omitempty"`
+	// EntitySources lists how a struct can declare its table, by
+	// precedence: comment (// table: "users") and method (a TableName
+	// method returning a string literal). The default is both, comment
+	// first.
+	EntitySources []string `yaml:"entity_sources,omitempty"`
+
+	Diagnostics DiagnosticsConfig `yaml:"diagnostics,omitempty"`
+
+	Publications []PublicationConfig `yaml:"publications,omitempty"`
+
+	Hooks HooksConfig `yaml:"hooks,omitempty"`
+
+	Policy policy.Rules `yaml:"policy,omitempty"`
+
+	// Services configure the databases of a monorepo by service name. Each
+	// entry overrides top-level settings (database, migrations,
+	// entity_paths, ...) when the service is selected.
+	Services map[string]yaml.Node `yaml:"services,omitempty"`
+
+	// Vars are template variables for migration files. Each can be
+	// overridden with a MIGRATEME_VAR_<NAME> environment variable.
+	Vars map[string]string `yaml:"vars,omitempty"`
 
 	Registry migrate.SchemaRegistry `yaml:"-"`
+	// Entities are the discovered entities the registry was built from.
+	Entities []migrate.EntityInfo `yaml:"-"`
+
+	reporter *diagnostics.Collector
+	group    string
+	service  string
 }
 
 func Load(configPath ...string) (*Config, error) {
@@ -285,15 +733,11 @@ func Load(configPath ...string) (*Config, error) {
 			return
 		}
 
-		// Инициализация реестра схем (опционально, только если есть entity_paths)
-		if cfg.HasEntityPaths() {
-			if err := initRuntimeRegistry(cfg); err != nil {
-				configErr = fmt.Errorf("failed to init runtime registry: %w", err)
-				return
-			}
-		} else {
-			// Создаем пустой реестр, если нет entity_paths
-			cfg.Registry = make(migrate.SchemaRegistry)
+		// Инициализация реестра схем: сущности из entity_paths и типы,
+		// зарегистрированные через migrate.Register
+		if err := initRuntimeRegistry(cfg); err != nil {
+			configErr = fmt.Errorf("failed to init runtime registry: %w", err)
+			return
 		}
 
 		config = cfg
@@ -301,6 +745,20 @@ func Load(configPath ...string) (*Config, error) {
 	return config, configErr
 }
 
+// LoadService loads the config with the services entry name applied, like
+// Load after SetService, but anew on every call: a process managing several
+// databases loads one config per service.
+func LoadService(name string, configPath ...string) (*Config, error) {
+	cfg, err := loadServiceConfig(name, configPath...)
+	if err != nil {
+		return nil, err
+	}
+	if err := initRuntimeRegistry(cfg); err != nil {
+		return nil, fmt.Errorf("failed to init runtime registry: %w", err)
+	}
+	return cfg, nil
+}
+
 func MustLoad(configPath ...string) *Config {
 	cfg, err := Load(configPath...)
 	if err != nil {
@@ -309,32 +767,121 @@ func MustLoad(configPath ...string) *Config {
 	return cfg
 }
 
-func initRuntimeRegistry(cfg *Config) error {
-	entityPaths := cfg.GetEntityPaths()
-	if len(entityPaths) == 0 {
-		// Нет путей к сущностям - это нормально, просто создаем пустой реестр
-		cfg.Registry = make(migrate.SchemaRegistry)
-		return nil
+// ExplainDiscovery runs discovery over the configured paths and returns why
+// each struct was or was not picked up as an entity, sorted by position.
+// The registry is left as it is.
+func (c *Config) ExplainDiscovery() ([]discovery.Resolution, error) {
+	if len(c.GetEntityPaths()) == 0 {
+		return nil, nil
 	}
-
-	paths, err := ResolveEntityPaths(entityPaths)
+	priority, err := migrate.ParseTagPriority(c.EntityTags)
+	if err != nil {
+		return nil, err
+	}
+	ctx, paths, err := c.discoveryContext(priority)
 	if err != nil {
-		return fmt.Errorf("failed to resolve entity paths: %w", err)
+		return nil, err
 	}
+	// Load has reported the diagnostics of discovery already.
+	ctx.Reporter = diagnostics.NewCollector(io.Discard, nil)
+	ctx.Explain = true
+	if _, err := discovery.DiscoverEntities(ctx, paths); err != nil {
+		return nil, fmt.Errorf("failed to discover entities: %w", err)
+	}
+	sort.SliceStable(ctx.Resolutions, func(i, j int) bool {
+		a, b := ctx.Resolutions[i], ctx.Resolutions[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return ctx.Resolutions, nil
+}
 
+// discoveryContext prepares discovery of the entities in the configured
+// paths and resolves those paths.
+func (c *Config) discoveryContext(priority []string) (*discovery.DiscoverContext, []string, error) {
+	sources, err := discovery.ParseEntitySources(c.EntitySources)
+	if err != nil {
+		return nil, nil, err
+	}
+	paths, err := ResolveEntityPaths(c.GetEntityPaths())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve entity paths: %w", err)
+	}
 	ctx, err := discovery.LoadPackages()
 	if err != nil {
-		return fmt.Errorf("failed to load packages: %w", err)
+		return nil, nil, fmt.Errorf("failed to load packages: %w", err)
 	}
-	entities, err := discovery.DiscoverEntities(ctx, paths)
+	ctx.Reporter = c.Reporter()
+	ctx.TagPriority = priority
+	ctx.InferColumns = c.InferColumns
+	ctx.EntitySources = sources
+	return ctx, paths, nil
+}
+
+// InitRegistry discovers entities in the configured paths and builds the
+// registry, together with types registered by migrate.Register. Load does
+// this already; it is for configs built in code.
+func (c *Config) InitRegistry() error {
+	return initRuntimeRegistry(c)
+}
+
+func initRuntimeRegistry(cfg *Config) error {
+	priority, err := migrate.ParseTagPriority(cfg.EntityTags)
+	if err != nil {
+		return err
+	}
+
+	var entities []migrate.EntityInfo
+	// Нет путей к сущностям - это нормально, реестр строится из
+	// зарегистрированных типов или остаётся пустым
+	if len(cfg.GetEntityPaths()) > 0 {
+		ctx, paths, err := cfg.discoveryContext(priority)
+		if err != nil {
+			return err
+		}
+		entities, err = discovery.DiscoverEntities(ctx, paths)
+		if err != nil {
+			return fmt.Errorf("failed to discover entities: %w", err)
+		}
+	}
+	entities = withRegistered(entities, migrate.RegisteredEntities(priority, cfg.InferColumns))
+
+	return cfg.setEntities(entities)
+}
+
+// setEntities builds the registry from entities.
+func (c *Config) setEntities(entities []migrate.EntityInfo) error {
+	policy, err := migrate.ParseIdentifierPolicy(c.Migrations.Identifiers)
 	if err != nil {
-		return fmt.Errorf("failed to discover entities: %w", err)
+		return err
+	}
+	ci, err := migrate.ParseCaseInsensitiveMode(c.Migrations.CaseInsensitive)
+	if err != nil {
+		return err
 	}
 
-	cfg.Registry = make(migrate.SchemaRegistry)
+	c.Entities = entities
+	c.Registry = make(migrate.SchemaRegistry)
 	for _, entity := range entities {
-		cfg.Registry[entity.TableName] = func(table string) migrate.TableSchema {
-			return schema.BuildSchema(entity)
+		table := policy.Ident(entity.TableName)
+		c.Registry[table] = func(string) migrate.TableSchema {
+			s := ci.Apply(policy.Apply(schema.BuildSchema(entity)))
+			if entity.Options.Audited {
+				s = schema.WithAudit(s)
+			}
+			if c.Migrations.TouchUpdatedAt {
+				s = schema.WithTouchUpdatedAt(s)
+			}
+			return s
+		}
+		// The audit table gets the name of the mapped table, which the
+		// trigger function writes to.
+		if entity.Options.Audited {
+			c.Registry[schema.AuditTableName(table)] = func(string) migrate.TableSchema {
+				return schema.AuditTable(table)
+			}
 		}
 	}
 
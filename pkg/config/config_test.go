@@ -0,0 +1,195 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const servicesConfig = `
+database:
+  dsn: "postgres://localhost:5432/app"
+migrations:
+  dir: "migrations"
+  naming: sequential
+  table_name: app_migrations
+entity_paths: ["internal/domain"]
+
+services:
+  billing:
+    database:
+      dsn: "postgres://localhost:5432/billing"
+    migrations:
+      dir: "services/billing/migrations"
+    entity_paths: ["services/billing/domain"]
+  search:
+    migrations:
+      table_name: search_migrations
+`
+
+// writeConfig writes content to a config file and clears the environment
+// variables that would override what the tests read back, so the tests
+// using it do not run in parallel.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	for _, env := range []string{"DATABASE_DSN", "MIGRATIONS_DIR", "MIGRATIONS_TABLE", "ENTITY_PATHS", "MIGRATEME_SERVICE"} {
+		t.Setenv(env, "")
+	}
+	path := filepath.Join(t.TempDir(), "migrateme.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadServiceConfig(t *testing.T) {
+	path := writeConfig(t, servicesConfig)
+
+	tests := []struct {
+		service  string
+		dsn      string
+		dir      string
+		table    string
+		paths    []string
+		naming   string
+		selected string
+	}{
+		// No service keeps the top-level settings.
+		{"", "postgres://localhost:5432/app", "migrations", "app_migrations", []string{"internal/domain"}, "sequential", ""},
+		// The service overrides what it sets and inherits the rest.
+		{"billing", "postgres://localhost:5432/billing", "services/billing/migrations", "app_migrations", []string{"services/billing/domain"}, "sequential", "billing"},
+		{"search", "postgres://localhost:5432/app", "migrations", "search_migrations", []string{"internal/domain"}, "sequential", "search"},
+	}
+	for _, tt := range tests {
+		cfg, err := loadServiceConfig(tt.service, path)
+		if err != nil {
+			t.Fatalf("service %q: %v", tt.service, err)
+		}
+		if cfg.Database.DSN != tt.dsn || cfg.Migrations.Dir != tt.dir || cfg.Migrations.TableName != tt.table ||
+			cfg.Migrations.Naming != tt.naming || !reflect.DeepEqual(cfg.EntityPaths, tt.paths) {
+			t.Errorf("service %q: dsn %q, dir %q, table %q, naming %q, entity_paths %v",
+				tt.service, cfg.Database.DSN, cfg.Migrations.Dir, cfg.Migrations.TableName, cfg.Migrations.Naming, cfg.EntityPaths)
+		}
+		if cfg.Service() != tt.selected {
+			t.Errorf("service %q: Service() = %q", tt.service, cfg.Service())
+		}
+	}
+}
+
+func TestLoadServiceConfig_EnvOverridesService(t *testing.T) {
+	path := writeConfig(t, servicesConfig)
+	t.Setenv("DATABASE_DSN", "postgres://ci:5432/billing")
+
+	cfg, err := loadServiceConfig("billing", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.DSN != "postgres://ci:5432/billing" || cfg.Migrations.Dir != "services/billing/migrations" {
+		t.Errorf("dsn %q, dir %q: the environment must win over the service", cfg.Database.DSN, cfg.Migrations.Dir)
+	}
+}
+
+func TestLoadServiceConfig_Selection(t *testing.T) {
+	path := writeConfig(t, servicesConfig)
+
+	if _, err := loadServiceConfig("payments", path); err == nil || !strings.Contains(err.Error(), "services: billing, search") {
+		t.Errorf("unknown service: %v", err)
+	}
+
+	t.Setenv("MIGRATEME_SERVICE", "billing")
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Service() != "billing" || cfg.Migrations.Dir != "services/billing/migrations" {
+		t.Errorf("MIGRATEME_SERVICE selected %q with dir %q", cfg.Service(), cfg.Migrations.Dir)
+	}
+
+	nested := writeConfig(t, "services:\n  billing:\n    services:\n      inner: {}\n")
+	if _, err := loadServiceConfig("billing", nested); err == nil || !strings.Contains(err.Error(), "cannot be nested") {
+		t.Errorf("nested services: %v", err)
+	}
+
+	plain := writeConfig(t, "database:\n  dsn: postgres://localhost/app\n")
+	if _, err := loadServiceConfig("billing", plain); err == nil || !strings.Contains(err.Error(), "no services are configured") {
+		t.Errorf("service without services: %v", err)
+	}
+}
+
+func TestResolveEntityPaths_Recursive(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, name := range []string{"domain/user.go", "domain/billing/invoice.go", "domain/billing/v1/plan.go", "domain/user_test.go", "domain/notes.txt", "other/order.go"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("package domain\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		// ** matches no directory as well as several.
+		{"domain/**/*.go", []string{"domain/billing/invoice.go", "domain/billing/v1/plan.go", "domain/user.go"}},
+		{"domain/**/v1/*.go", []string{"domain/billing/v1/plan.go"}},
+		{"domain/billing/**", []string{"domain/billing/invoice.go", "domain/billing/v1/plan.go"}},
+	}
+	for _, tt := range tests {
+		got, err := ResolveEntityPaths([]string{filepath.Join(root, tt.pattern)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range got {
+			got[i], _ = filepath.Rel(root, got[i])
+			got[i] = filepath.ToSlash(got[i])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// TestGetMigrationsTable does not run in parallel: it sets MIGRATIONS_TABLE.
+func TestGetMigrationsTable(t *testing.T) {
+	t.Setenv("MIGRATIONS_TABLE", "")
+
+	tests := []struct {
+		table, group, env string
+		want              string
+	}{
+		{"", "", "", "schema_migrations"},
+		{"app_migrations", "", "", "app_migrations"},
+		// A group has its own history table, named after the configured one.
+		{"", "billing", "", "schema_migrations_billing"},
+		{"app_migrations", "billing", "", "app_migrations_billing"},
+		{"app_migrations", "billing", "ci_migrations", "ci_migrations_billing"},
+	}
+	for _, tt := range tests {
+		t.Setenv("MIGRATIONS_TABLE", tt.env)
+		cfg := &Config{Migrations: MigrationsConfig{TableName: tt.table}, group: tt.group}
+		if got := cfg.GetMigrationsTable(); got != tt.want {
+			t.Errorf("table %q, group %q, env %q: GetMigrationsTable() = %q, want %q", tt.table, tt.group, tt.env, got, tt.want)
+		}
+	}
+
+	t.Setenv("MIGRATIONS_TABLE", "")
+	cfg := &Config{Migrations: MigrationsConfig{TableName: "app_migrations"}}
+	for table, want := range map[string]bool{
+		"app_migrations":          true,
+		"app_migrations_billing":  true,
+		"app_migrations_progress": true,
+		"schema_migrations":       false,
+		"users":                   false,
+	} {
+		if got := cfg.IsHistoryTable(table); got != want {
+			t.Errorf("IsHistoryTable(%q) = %v, want %v", table, got, want)
+		}
+	}
+}
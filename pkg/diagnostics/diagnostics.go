@@ -0,0 +1,165 @@
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type Severity string
+
+const (
+	Warning Severity = "warning"
+	Error   Severity = "error"
+)
+
+// Code is a stable identifier of a diagnostic. Codes are never reused:
+// MM1xxx are discovery/entity problems, MM2xxx are schema change problems,
+// MM3xxx are migration file problems, MM4xxx are configuration problems.
+type Code string
+
+const (
+	DuplicateTable       Code = "MM1001"
+	UnparsableEntity     Code = "MM1002"
+	NoEntities           Code = "MM1003"
+	IdentifierTooLong    Code = "MM1004"
+	ReservedIdentifier   Code = "MM1005"
+	InvalidTag           Code = "MM1006"
+	RedundantTag         Code = "MM1007"
+	UnknownReference     Code = "MM1008"
+	UnresolvedType       Code = "MM1009"
+	LossyTypeChange      Code = "MM2003"
+	NarrowingSkipped     Code = "MM2004"
+	ChecksumMismatch     Code = "MM3001"
+	DuplicateMigration   Code = "MM3002"
+	MissingDownMigration Code = "MM3003"
+	OrphanDownMigration  Code = "MM3004"
+	EmptyMigration       Code = "MM3005"
+	InvalidEncoding      Code = "MM3006"
+	InvalidMigration     Code = "MM3007"
+	MissingMigration     Code = "MM3008"
+	UnmatchedVersion     Code = "MM3009"
+	ExportedSemantics    Code = "MM3010"
+	UnsaltedSnapshot     Code = "MM4001"
+)
+
+type Diagnostic struct {
+	Code     Code     `json:"code"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	prefix := ""
+	if d.File != "" {
+		prefix = d.File
+		if d.Line > 0 {
+			prefix += fmt.Sprintf(":%d", d.Line)
+		}
+		prefix += ": "
+	}
+	return fmt.Sprintf("%s%s %s: %s", prefix, d.Severity, d.Code, d.Message)
+}
+
+func Warningf(code Code, format string, args ...any) Diagnostic {
+	return Diagnostic{Code: code, Severity: Warning, Message: fmt.Sprintf(format, args...)}
+}
+
+func Errorf(code Code, format string, args ...any) Diagnostic {
+	return Diagnostic{Code: code, Severity: Error, Message: fmt.Sprintf(format, args...)}
+}
+
+func (d Diagnostic) At(file string, line int) Diagnostic {
+	d.File = file
+	d.Line = line
+	return d
+}
+
+type Reporter interface {
+	Report(d Diagnostic)
+}
+
+// Collector records reported diagnostics, drops codes suppressed in config and
+// optionally echoes every kept diagnostic to out as it arrives.
+type Collector struct {
+	mu         sync.Mutex
+	out        io.Writer
+	suppressed map[Code]bool
+	items      []Diagnostic
+}
+
+func NewCollector(out io.Writer, suppress []string) *Collector {
+	c := &Collector{out: out, suppressed: map[Code]bool{}}
+	for _, code := range suppress {
+		c.suppressed[Code(strings.ToUpper(strings.TrimSpace(code)))] = true
+	}
+	return c
+}
+
+func (c *Collector) Report(d Diagnostic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.suppressed[d.Code] {
+		return
+	}
+	c.items = append(c.items, d)
+	if c.out != nil {
+		fmt.Fprintln(c.out, d.String())
+	}
+}
+
+// SetOutput changes where diagnostics are echoed; nil disables echoing.
+func (c *Collector) SetOutput(out io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.out = out
+}
+
+func (c *Collector) Diagnostics() []Diagnostic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Diagnostic(nil), c.items...)
+}
+
+func (c *Collector) HasErrors() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range c.items {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Ignore-annotations look like:
+//
+//	// migrate:ignore MM1001
+//	// migrate:ignore MM1001, MM2003
+var ignoreRE = regexp.MustCompile(`(?i)migrate:ignore\s+((?:MM\d{4}[\s,]*)+)`)
+
+// ParseIgnores extracts codes from migrate:ignore annotations in a comment text.
+func ParseIgnores(text string) []string {
+	var out []string
+	for _, m := range ignoreRE.FindAllStringSubmatch(text, -1) {
+		for _, code := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' }) {
+			out = append(out, strings.ToUpper(code))
+		}
+	}
+	return out
+}
+
+// Ignored reports whether code is listed in annotations.
+func Ignored(annotations []string, code Code) bool {
+	for _, a := range annotations {
+		if Code(a) == code {
+			return true
+		}
+	}
+	return false
+}
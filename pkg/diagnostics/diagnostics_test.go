@@ -0,0 +1,37 @@
+package diagnostics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCollector_DropsSuppressedCodes(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	c := NewCollector(&out, []string{"mm1001"})
+	c.Report(Warningf(DuplicateTable, "duplicate table 'users'"))
+	c.Report(Warningf(LossyTypeChange, "lossy").At("user.go", 12))
+
+	got := c.Diagnostics()
+	if len(got) != 1 || got[0].Code != LossyTypeChange {
+		t.Fatalf("expected only %s to be kept, got %v", LossyTypeChange, got)
+	}
+	if strings.TrimSpace(out.String()) != "user.go:12: warning MM2003: lossy" {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+}
+
+func TestParseIgnores(t *testing.T) {
+	t.Parallel()
+
+	text := "table: \"users\"\nmigrate:ignore MM1001, mm2003\nsomething else MM9999\n"
+	got := ParseIgnores(text)
+	if len(got) != 2 || got[0] != "MM1001" || got[1] != "MM2003" {
+		t.Fatalf("ParseIgnores = %v, want [MM1001 MM2003]", got)
+	}
+	if !Ignored(got, LossyTypeChange) || Ignored(got, UnparsableEntity) {
+		t.Fatalf("Ignored returned unexpected result for %v", got)
+	}
+}
@@ -3,6 +3,8 @@ package discovery
 import (
 	"bufio"
 	"fmt"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/migrate"
 	"go/ast"
 	"go/parser"
 	"go/token"
@@ -12,15 +14,79 @@ import (
 )
 
 type PackageInfo struct {
-	Path    string                     // absolute filesystem path
-	Structs map[string]*ast.StructType // struct definitions
-	Files   []*ast.File
+	Path       string                     // absolute filesystem path
+	Structs    map[string]*ast.StructType // struct definitions
+	Decls      map[string]*ast.File       // file declaring each struct
+	TypeParams map[string][]string        // type parameter names of generic structs
+	Files      []*ast.File
 }
 
 type DiscoverContext struct {
 	Packages   map[string]*PackageInfo
 	ModuleRoot string // absolute path: /Users/.../migrateme
 	ModulePath string // module path:  github.com/amr0ny/migrateme
+
+	// Reporter receives discovery warnings; stderr is used when nil.
+	Reporter diagnostics.Reporter
+
+	// TagPriority lists the struct tags columns are read from, in order
+	// (see migrate.ColumnTag); nil means migrate.DefaultTagPriority.
+	TagPriority []string
+
+	// InferColumns makes exported fields without any of those tags columns,
+	// named and typed by migrate.InferColumnTag.
+	InferColumns bool
+
+	// EntitySources lists the ways a type can declare its table, by
+	// precedence (see ParseEntitySources); nil means DefaultEntitySources.
+	EntitySources []string
+
+	// Explain makes discovery record in Resolutions why each type was or
+	// was not picked up as an entity.
+	Explain     bool
+	Resolutions []Resolution
+
+	// Fset positions every parsed file, so that fields of embedded structs
+	// resolve to the file that declares them.
+	Fset *token.FileSet
+
+	// deps holds packages outside the module, by import path and directory,
+	// as go list resolved them; they are parsed on first use.
+	deps map[string]*listedPackage
+	// depsErr is why dependencies could not be listed, if they could not.
+	depsErr error
+	// methods caches the TableName methods of each package.
+	methods map[string]map[string]tableMethod
+	// options caches the TableOptions methods of each package.
+	options map[string]map[string]optionsMethod
+}
+
+func (ctx *DiscoverContext) tagPriority() []string {
+	if len(ctx.TagPriority) == 0 {
+		return migrate.DefaultTagPriority
+	}
+	return ctx.TagPriority
+}
+
+func (ctx *DiscoverContext) entitySources() []string {
+	if len(ctx.EntitySources) == 0 {
+		return DefaultEntitySources
+	}
+	return ctx.EntitySources
+}
+
+func (ctx *DiscoverContext) fileSet() *token.FileSet {
+	if ctx.Fset == nil {
+		ctx.Fset = token.NewFileSet()
+	}
+	return ctx.Fset
+}
+
+func (ctx *DiscoverContext) report(d diagnostics.Diagnostic) {
+	if ctx.Reporter == nil {
+		ctx.Reporter = diagnostics.NewCollector(os.Stderr, nil)
+	}
+	ctx.Reporter.Report(d)
 }
 
 //
@@ -42,6 +108,7 @@ func LoadPackages() (*DiscoverContext, error) {
 		Packages:   map[string]*PackageInfo{},
 		ModuleRoot: root,
 		ModulePath: modulePath,
+		Fset:       token.NewFileSet(),
 	}
 
 	//
@@ -61,8 +128,7 @@ func LoadPackages() (*DiscoverContext, error) {
 			return nil
 		}
 
-		fset := token.NewFileSet()
-		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		f, err := parser.ParseFile(ctx.Fset, path, nil, parser.ParseComments)
 		if err != nil {
 			return nil
 		}
@@ -95,36 +161,64 @@ func LoadPackages() (*DiscoverContext, error) {
 		return nil, err
 	}
 
-	//
-	// Collect struct definitions for each package
-	//
 	for _, pkg := range ctx.Packages {
-		for _, f := range pkg.Files {
-			for _, decl := range f.Decls {
-				gen, ok := decl.(*ast.GenDecl)
-				if !ok || gen.Tok != token.TYPE {
+		collectStructs(pkg)
+	}
+
+	// Embedded structs may come from other modules: replaced dependencies,
+	// workspace modules or the module cache.
+	ctx.depsErr = listDependencies(ctx)
+
+	return ctx, nil
+}
+
+//
+// HELPERS
+//
+
+// collectStructs records the struct definitions of the files of pkg.
+func collectStructs(pkg *PackageInfo) {
+	if pkg.Decls == nil {
+		pkg.Decls = map[string]*ast.File{}
+	}
+	if pkg.TypeParams == nil {
+		pkg.TypeParams = map[string][]string{}
+	}
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok {
 					continue
 				}
-
-				for _, spec := range gen.Specs {
-					ts, ok := spec.(*ast.TypeSpec)
-					if !ok {
-						continue
-					}
-					if st, ok := ts.Type.(*ast.StructType); ok {
-						pkg.Structs[ts.Name.Name] = st
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					pkg.Structs[ts.Name.Name] = st
+					pkg.Decls[ts.Name.Name] = f
+					if ts.TypeParams != nil {
+						pkg.TypeParams[ts.Name.Name] = fieldNames(ts.TypeParams)
 					}
 				}
 			}
 		}
 	}
-
-	return ctx, nil
 }
 
-//
-// HELPERS
-//
+// fieldNames returns the names declared by a field list, such as the type
+// parameters [K comparable, V any].
+func fieldNames(list *ast.FieldList) []string {
+	var names []string
+	for _, f := range list.List {
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+	}
+	return names
+}
 
 func findModuleRoot() (string, error) {
 	dir, err := os.Getwd()
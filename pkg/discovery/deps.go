@@ -0,0 +1,108 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// listedPackage is the part of `go list -json` output discovery uses.
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	GoFiles    []string
+	Standard   bool
+}
+
+// listDependencies records the packages the module depends on, directly or
+// through other modules, as the go command resolves them: with replace
+// directives, workspaces and the module cache. This is what go/packages
+// does with full dependency loading; packages are only parsed when an
+// embedded struct refers to them.
+func listDependencies(ctx *DiscoverContext) error {
+	cmd := exec.Command("go", "list", "-e", "-deps", "-json=ImportPath,Dir,GoFiles,Standard", "./...")
+	cmd.Dir = ctx.ModuleRoot
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("go list: %s", msg)
+		}
+		return fmt.Errorf("go list: %w", err)
+	}
+
+	ctx.deps = map[string]*listedPackage{}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		p := &listedPackage{}
+		if err := dec.Decode(p); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("go list: %w", err)
+		}
+		if p.Standard || p.Dir == "" || ctx.Packages[p.ImportPath] != nil {
+			continue
+		}
+		ctx.deps[p.ImportPath] = p
+		ctx.deps[p.Dir] = p
+	}
+	return nil
+}
+
+// lookupPackage returns the package at an import path or directory: a
+// package of the module, a dependency listed by go list, or the directory
+// of an entity path outside the module. Packages are parsed once.
+func (ctx *DiscoverContext) lookupPackage(key string) *PackageInfo {
+	if pkg := ctx.Packages[key]; pkg != nil {
+		return pkg
+	}
+
+	var dir, importPath string
+	var files []string
+	if p := ctx.deps[key]; p != nil {
+		dir, importPath = p.Dir, p.ImportPath
+		for _, name := range p.GoFiles {
+			files = append(files, filepath.Join(p.Dir, name))
+		}
+	} else if filepath.IsAbs(key) {
+		entries, err := os.ReadDir(key)
+		if err != nil {
+			return nil
+		}
+		dir = key
+		for _, e := range entries {
+			name := e.Name()
+			if !e.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+				files = append(files, filepath.Join(key, name))
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	pkg := &PackageInfo{Path: dir, Structs: map[string]*ast.StructType{}}
+	for _, path := range files {
+		f, err := parser.ParseFile(ctx.fileSet(), path, nil, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		pkg.Files = append(pkg.Files, f)
+	}
+	collectStructs(pkg)
+
+	ctx.Packages[dir] = pkg
+	if importPath != "" {
+		ctx.Packages[importPath] = pkg
+	}
+	return pkg
+}
@@ -0,0 +1,82 @@
+package discovery
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+)
+
+func TestLoadPackages_EmbeddedFromOtherModule(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+
+	root := t.TempDir()
+	files := map[string]string{
+		"domain/go.mod": "module example.com/domain\n\ngo 1.21\n",
+		"domain/base.go": "package domain\n\n" +
+			"import \"example.com/domain/audit\"\n\n" +
+			"type Base struct {\n" +
+			"\tID string `db:\"id,pk,type=uuid\"`\n" +
+			"\taudit.Stamps\n" +
+			"}\n",
+		"domain/audit/audit.go": "package audit\n\n" +
+			"type Stamps struct {\n" +
+			"\tCreatedAt string `db:\"created_at,type=timestamptz\"`\n" +
+			"}\n",
+		"app/go.mod": "module example.com/app\n\ngo 1.21\n\n" +
+			"require example.com/domain v0.0.0\n\n" +
+			"replace example.com/domain => ../domain\n",
+		"app/entities/order.go": "package entities\n\n" +
+			"import (\n\t\"example.com/domain\"\n\t\"example.com/missing/shared\"\n)\n\n" +
+			"// table: \"orders\"\n" +
+			"type Order struct {\n" +
+			"\tdomain.Base\n" +
+			"\tshared.Tenant\n" +
+			"\tTotal int `db:\"total\"`\n" +
+			"}\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(filepath.Join(root, "app"))
+
+	ctx, err := LoadPackages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	ctx.Reporter = diagnostics.NewCollector(&out, nil)
+
+	ents, err := DiscoverEntities(ctx, []string{"entities"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 1 {
+		t.Fatalf("unexpected entities: %+v", ents)
+	}
+	var got []string
+	for _, f := range ents[0].Fields {
+		got = append(got, f.ColumnName)
+	}
+	if want := "id created_at total"; strings.Join(got, " ") != want {
+		t.Errorf("columns = %q, want %q", got, want)
+	}
+	if !strings.Contains(out.String(), string(diagnostics.UnresolvedType)) || !strings.Contains(out.String(), "shared.Tenant") {
+		t.Errorf("expected a warning for shared.Tenant, got %q", out.String())
+	}
+}
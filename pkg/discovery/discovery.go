@@ -6,6 +6,7 @@ package discovery
 
 import (
 	"fmt"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
 	"github.com/amr0ny/migrateme/pkg/migrate"
 	"go/ast"
 	"go/parser"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -31,7 +33,16 @@ func DiscoverEntities(ctx *DiscoverContext, paths []string) ([]migrate.EntityInf
 		for _, e := range ents {
 			t := strings.ToLower(e.TableName)
 			if _, exists := seenTables[t]; exists {
-				fmt.Printf("Warning: duplicate table '%s' in %s — skipping\n", e.TableName, e.FilePath)
+				if !diagnostics.Ignored(e.Ignore, diagnostics.DuplicateTable) {
+					ctx.report(diagnostics.Warningf(diagnostics.DuplicateTable,
+						"duplicate table '%s' (struct %s) — skipping", e.TableName, e.StructName).At(e.FilePath, e.Line))
+				}
+				for i, r := range ctx.Resolutions {
+					if r.File == e.FilePath && r.Line == e.Line {
+						ctx.Resolutions[i].Table, ctx.Resolutions[i].Source = "", ""
+						ctx.Resolutions[i].Reason = fmt.Sprintf("table %q is already declared by another entity", e.TableName)
+					}
+				}
 				continue
 			}
 			seenTables[t] = struct{}{}
@@ -67,7 +78,7 @@ func discoverInDirectory(ctx *DiscoverContext, dir string) ([]migrate.EntityInfo
 		}
 		ents, err := discoverInFile(ctx, path)
 		if err != nil {
-			fmt.Printf("Warning: %v\n", err)
+			ctx.report(diagnostics.Warningf(diagnostics.UnparsableEntity, "%v", err).At(path, 0))
 			return nil
 		}
 		entities = append(entities, ents...)
@@ -100,7 +111,7 @@ func extractTableComment(doc *ast.CommentGroup) string {
 
 // main file-level discovery - ИСПРАВЛЕННАЯ ВЕРСИЯ
 func discoverInFile(ctx *DiscoverContext, filePath string) ([]migrate.EntityInfo, error) {
-	fset := token.NewFileSet()
+	fset := ctx.fileSet()
 	file, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments)
 	if err != nil {
 		return nil, err
@@ -123,19 +134,48 @@ func discoverInFile(ctx *DiscoverContext, filePath string) ([]migrate.EntityInfo
 				continue
 			}
 
-			st, ok := ts.Type.(*ast.StructType)
-			if !ok {
+			_, isStruct := ts.Type.(*ast.StructType)
+			res := Resolution{Struct: ts.Name.Name, File: filePath, Line: fset.Position(ts.Pos()).Line}
+
+			// A generic struct is a base for entities, not a table itself.
+			if ts.TypeParams != nil {
+				if isStruct {
+					res.Reason = "generic structs are bases for entities; declare the table on an instantiation"
+					ctx.explain(res)
+				}
 				continue
 			}
 
-			// Пытаемся извлечь имя таблицы из комментариев
-			tn := extractTableComment(gen.Doc)
-			if tn == "" && ts.Doc != nil {
-				tn = extractTableComment(ts.Doc)
-			}
+			tn, source, reason := ctx.resolveTable(gen, ts, pkgPath)
 			if tn == "" {
-				continue // пропускаем структуры без аннотации таблицы
+				// пропускаем типы без аннотации таблицы
+				if isStruct {
+					res.Reason = reason
+					ctx.explain(res)
+				}
+				continue
+			}
+
+			ignore := append(diagnostics.ParseIgnores(commentText(gen.Doc)), diagnostics.ParseIgnores(commentText(ts.Doc))...)
+
+			// Besides struct types, an entity can be an instantiation of a
+			// generic struct: type Order = Entity[OrderPayload].
+			entity := embeddedStruct{pkgPath: pkgPath, file: file}
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				entity.st = st
+			} else {
+				entity, err = resolveEmbedded(ctx, pkgPath, ts.Type, file, nil)
+				if err != nil && !diagnostics.Ignored(ignore, diagnostics.UnresolvedType) {
+					ctx.report(diagnostics.Warningf(diagnostics.UnresolvedType, "%v", err).At(filePath, fset.Position(ts.Pos()).Line))
+				}
+			}
+			if entity.st == nil {
+				res.Reason = "declares table " + strconv.Quote(tn) + ", but is not a struct or an instantiation of one"
+				ctx.explain(res)
+				continue
 			}
+			res.Table, res.Source, res.Reason = tn, source, reason
+			ctx.explain(res)
 
 			// Composite index directives are stored in struct-level comments.
 			indexes := make([]migrate.IndexMeta, 0)
@@ -148,16 +188,31 @@ func discoverInFile(ctx *DiscoverContext, filePath string) ([]migrate.EntityInfo
 
 			// Создаем информацию о сущности
 			ent := migrate.EntityInfo{
-				StructName: ts.Name.Name,
-				TableName:  tn,
-				Package:    pkgPath,
-				FilePath:   filePath,
-				Indexes:    indexes,
-				Checks:     checks,
+				StructName:  ts.Name.Name,
+				TableName:   tn,
+				Package:     pkgPath,
+				FilePath:    filePath,
+				Line:        fset.Position(ts.Pos()).Line,
+				PackageName: file.Name.Name,
+				Imports:     fileImports(file),
+				Owner:       firstNonEmpty(extractOwnerComment(ts.Doc), extractOwnerComment(gen.Doc)),
+				Group:       firstNonEmpty(extractGroupComment(ts.Doc), extractGroupComment(gen.Doc)),
+				Comment:     firstNonEmpty(extractDescription(ts.Doc), extractDescription(gen.Doc)),
+				Indexes:     indexes,
+				Checks:      checks,
+				Ignore:      ignore,
+			}
+
+			if m, ok := ctx.tableOptions(pkgPath)[ts.Name.Name]; ok {
+				if m.err != nil {
+					ctx.report(diagnostics.Warningf(diagnostics.UnparsableEntity,
+						"cannot read %s.TableOptions: %v", ts.Name.Name, m.err).At(filePath, ent.Line))
+				}
+				ent.Options = m.options
 			}
 
 			// Расширяем поля (включая встроенные структуры)
-			ent.Fields = ExpandFields(ctx, pkgPath, st, file, map[string]bool{})
+			ent.Fields = expandStruct(ctx, entity, map[string]bool{})
 			results = append(results, ent)
 		}
 	}
@@ -165,13 +220,100 @@ func discoverInFile(ctx *DiscoverContext, filePath string) ([]migrate.EntityInfo
 	return results, nil
 }
 
+// Supported syntax (struct-level comments):
+//
+//	migrate:owner payments-team
+var ownerDirectiveRE = regexp.MustCompile(`(?mi)migrate:owner\s+([A-Za-z0-9_.@/\-]+)`)
+
+func extractOwnerComment(doc *ast.CommentGroup) string {
+	if m := ownerDirectiveRE.FindStringSubmatch(commentText(doc)); len(m) == 2 {
+		return m[1]
+	}
+	return ""
+}
+
+// Supported syntax (struct-level comments):
+//
+//	migrate:group billing
+var groupDirectiveRE = regexp.MustCompile(`(?mi)migrate:group\s+([A-Za-z0-9_]+)`)
+
+func extractGroupComment(doc *ast.CommentGroup) string {
+	if m := groupDirectiveRE.FindStringSubmatch(commentText(doc)); len(m) == 2 {
+		return strings.ToLower(m[1])
+	}
+	return ""
+}
+
+// Supported syntax (field comments), for expressions the using= tag option
+// cannot hold because they contain commas:
+//
+//	migrate:using CASE WHEN status = 'active' THEN 1 ELSE 0 END
+var usingDirectiveRE = regexp.MustCompile(`(?mi)migrate:using\s+(.+)$`)
+
+func extractUsingComment(doc *ast.CommentGroup) string {
+	if m := usingDirectiveRE.FindStringSubmatch(commentText(doc)); len(m) == 2 {
+		return strings.TrimSpace(m[1])
+	}
+	return ""
+}
+
+// directiveLineRE matches doc comment lines that carry directives rather than
+// a description of the table.
+var directiveLineRE = regexp.MustCompile(`(?i)^\s*(?:(?:table|tablename|index|check)\s*:|migrate:)`)
+
+// extractDescription returns the doc comment without directive lines.
+func extractDescription(doc *ast.CommentGroup) string {
+	var lines []string
+	for _, line := range strings.Split(commentText(doc), "\n") {
+		if directiveLineRE.MatchString(line) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func fileImports(file *ast.File) map[string]string {
+	out := make(map[string]string, len(file.Imports))
+	for _, imp := range file.Imports {
+		path := strings.Trim(imp.Path.Value, `"`)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		out[name] = path
+	}
+	return out
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func commentText(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	return doc.Text()
+}
+
 // Supported syntax (struct-level comments):
 //
 //	index: idx_name(col1, col2)
 //	index: unique idx_name(col1, col2)
 //	index: idx_name(col1) where deleted_at IS NULL
 //	index: (col1, col2)  // name optional; migrator will handle name later
-var indexDirectiveRE = regexp.MustCompile(`(?mi)index\s*:\s*(unique\s+)?(?:([A-Za-z0-9_\-]+)\s*)?\(([^)]*)\)\s*(?:where\s+([^\n]+))?`)
+//	index: idx_name(embedding vector_cosine_ops) using hnsw with (m = 16, ef_construction = 64)
+//	index: idx_name(col1) tablespace fast_ssd
+var indexDirectiveRE = regexp.MustCompile(`(?mi)index\s*:\s*(unique\s+)?(?:([A-Za-z0-9_\-]+)\s*)?\(([^)]*)\)(?:\s*using\s+([A-Za-z_]+))?(?:\s*with\s*\(([^)]*)\))?(?:\s*tablespace\s+([A-Za-z0-9_]+))?\s*(?:where\s+([^\n]+))?`)
 
 func extractIndexesComment(doc *ast.CommentGroup) []migrate.IndexMeta {
 	if doc == nil {
@@ -193,23 +335,43 @@ func extractIndexesComment(doc *ast.CommentGroup) []migrate.IndexMeta {
 		// m[1] = unique (optional)
 		// m[2] = index name (optional)
 		// m[3] = columns inside parentheses
-		// m[4] = where predicate (optional)
+		// m[4] = access method (optional)
+		// m[5] = storage parameters (optional)
+		// m[6] = tablespace (optional)
+		// m[7] = where predicate (optional)
 
-		if len(m) < 5 {
+		if len(m) < 8 {
 			continue
 		}
 
 		unique := strings.TrimSpace(m[1]) != ""
 		name := strings.TrimSpace(m[2])
 		colsRaw := m[3]
-		whereRaw := strings.TrimSpace(m[4])
+		whereRaw := strings.TrimSpace(m[7])
 
-		var cols []string
+		// A column may be followed by an operator class: "embedding vector_cosine_ops".
+		var cols, opclasses []string
 		for _, c := range strings.Split(colsRaw, ",") {
-			c = strings.TrimSpace(c)
-			c = strings.Trim(c, `"'`+"`")
-			if c != "" {
-				cols = append(cols, c)
+			fields := strings.Fields(c)
+			if len(fields) == 0 {
+				continue
+			}
+			col := strings.Trim(fields[0], `"'`+"`")
+			if col == "" {
+				continue
+			}
+			cols = append(cols, col)
+			op := ""
+			if len(fields) > 1 {
+				op = fields[1]
+			}
+			opclasses = append(opclasses, op)
+		}
+
+		var with []string
+		for _, p := range strings.Split(m[5], ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				with = append(with, p)
 			}
 		}
 
@@ -223,10 +385,14 @@ func extractIndexesComment(doc *ast.CommentGroup) []migrate.IndexMeta {
 		}
 
 		out = append(out, migrate.IndexMeta{
-			Name:    name,
-			Columns: cols,
-			Unique:  unique,
-			Where:   where,
+			Name:       name,
+			Columns:    cols,
+			Unique:     unique,
+			Where:      where,
+			Method:     strings.ToLower(m[4]),
+			Opclasses:  opclasses,
+			With:       with,
+			Tablespace: m[6],
 		})
 	}
 
@@ -2,6 +2,10 @@ package discovery
 
 import (
 	"go/ast"
+	"go/parser"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -27,3 +31,321 @@ func TestExtractChecksComment_HandlesInnerParentheses(t *testing.T) {
 		t.Fatalf("unexpected second check expr: %q", checks[1].Expr)
 	}
 }
+
+func TestExtractIndexesComment_MethodOpclassAndParams(t *testing.T) {
+	t.Parallel()
+
+	doc := &ast.CommentGroup{
+		List: []*ast.Comment{
+			{Text: "// index: idx_items_embedding(embedding vector_cosine_ops) using hnsw with (m = 16, ef_construction = 64)"},
+			{Text: "// index: idx_items_owner(owner_id) tablespace fast_ssd where deleted_at IS NULL"},
+		},
+	}
+
+	indexes := extractIndexesComment(doc)
+	if len(indexes) != 2 {
+		t.Fatalf("expected 2 indexes, got %d", len(indexes))
+	}
+
+	hnsw := indexes[0]
+	if hnsw.Method != "hnsw" || len(hnsw.Columns) != 1 || hnsw.Columns[0] != "embedding" {
+		t.Fatalf("unexpected hnsw index: %+v", hnsw)
+	}
+	if len(hnsw.Opclasses) != 1 || hnsw.Opclasses[0] != "vector_cosine_ops" {
+		t.Fatalf("unexpected opclasses: %v", hnsw.Opclasses)
+	}
+	if len(hnsw.With) != 2 || hnsw.With[0] != "m = 16" || hnsw.With[1] != "ef_construction = 64" {
+		t.Fatalf("unexpected with params: %v", hnsw.With)
+	}
+
+	if indexes[1].Method != "" || indexes[1].Tablespace != "fast_ssd" ||
+		indexes[1].Where == nil || *indexes[1].Where != "deleted_at IS NULL" {
+		t.Fatalf("unexpected plain index: %+v", indexes[1])
+	}
+}
+
+func TestExtractDescription_SkipsDirectives(t *testing.T) {
+	t.Parallel()
+
+	doc := &ast.CommentGroup{
+		List: []*ast.Comment{
+			{Text: "// Order is a placed customer order."},
+			{Text: `// table: "orders"`},
+			{Text: "// index: idx_orders_user(user_id)"},
+			{Text: "// migrate:owner billing"},
+		},
+	}
+
+	if got := extractDescription(doc); got != "Order is a placed customer order." {
+		t.Fatalf("unexpected description: %q", got)
+	}
+	if got := extractDescription(&ast.CommentGroup{List: []*ast.Comment{{Text: `// table: "orders"`}}}); got != "" {
+		t.Fatalf("expected empty description, got %q", got)
+	}
+}
+
+func TestExtractUsingComment(t *testing.T) {
+	t.Parallel()
+
+	doc := &ast.CommentGroup{
+		List: []*ast.Comment{
+			{Text: "// Status of the order."},
+			{Text: "// migrate:using CASE WHEN status = 'active' THEN 1 ELSE coalesce(nullif(status, '')::integer, 0) END"},
+		},
+	}
+
+	want := "CASE WHEN status = 'active' THEN 1 ELSE coalesce(nullif(status, '')::integer, 0) END"
+	if got := extractUsingComment(doc); got != want {
+		t.Fatalf("extractUsingComment = %q, want %q", got, want)
+	}
+	if got := extractUsingComment(nil); got != "" {
+		t.Fatalf("expected no expression, got %q", got)
+	}
+}
+
+func TestExtractGroupComment(t *testing.T) {
+	t.Parallel()
+
+	doc := &ast.CommentGroup{
+		List: []*ast.Comment{
+			{Text: "// Invoice issued to a customer."},
+			{Text: "// migrate:owner payments-team"},
+			{Text: "// migrate:group Billing"},
+		},
+	}
+	if got := extractGroupComment(doc); got != "billing" {
+		t.Fatalf("extractGroupComment = %q, want billing", got)
+	}
+	if got := extractDescription(doc); got != "Invoice issued to a customer." {
+		t.Fatalf("extractDescription = %q", got)
+	}
+	if got := extractGroupComment(nil); got != "" {
+		t.Fatalf("expected no group, got %q", got)
+	}
+}
+
+func TestDiscoverInFile_FieldPositions(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "user.go")
+	src := `package domain
+
+// table: "users"
+type User struct {
+	ID   string ` + "`db:\"id,pk,type=uuid\"`" + `
+
+	Name string ` + "`db:\"name\"`" + `
+}
+`
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ents, err := discoverInFile(&DiscoverContext{Packages: map[string]*PackageInfo{}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 1 || len(ents[0].Fields) != 2 {
+		t.Fatalf("unexpected entities: %+v", ents)
+	}
+	for i, want := range []int{5, 7} {
+		f := ents[0].Fields[i]
+		if f.FilePath != path || f.Line != want {
+			t.Errorf("field %s at %s:%d, want %s:%d", f.FieldName, f.FilePath, f.Line, path, want)
+		}
+	}
+}
+
+func TestDiscoverInFile_EmbeddedStructs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "order.go")
+	src := "package domain\n\n" +
+		"type Base struct {\n" +
+		"\tID        string `db:\"id,pk,type=uuid\"`\n" +
+		"\tCreatedAt string `db:\"created_at,type=timestamp\"`\n" +
+		"}\n\n" +
+		"type Address struct {\n" +
+		"\tCity string `db:\"city\"`\n" +
+		"}\n\n" +
+		"type Audit struct {\n" +
+		"\tUpdatedBy string `db:\"updated_by\"`\n" +
+		"}\n\n" +
+		"// table: \"orders\"\n" +
+		"type Order struct {\n" +
+		"\t*Base\n" +
+		"\tAudit    `db:\"-\"`\n" +
+		"\tLast     Address `db:\",embed_prefix=last_,transient\"`\n" +
+		"\tTotal    int     `db:\"total\"`\n" +
+		"\tBilling  Address `db:\",embed_prefix=billing_\"`\n" +
+		"\tShipping Address `db:\",embed_prefix=shipping_\"`\n" +
+		"\tCreatedAt string `db:\"created_at,type=timestamptz,default=now()\"`\n" +
+		"}\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &DiscoverContext{Packages: map[string]*PackageInfo{}}
+	file, err := parser.ParseFile(ctx.fileSet(), path, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &PackageInfo{Path: dir, Structs: map[string]*ast.StructType{}, Files: []*ast.File{file}}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if ts, ok := n.(*ast.TypeSpec); ok {
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				pkg.Structs[ts.Name.Name] = st
+			}
+		}
+		return true
+	})
+	ctx.Packages[dir] = pkg
+
+	ents, err := discoverInFile(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 1 {
+		t.Fatalf("unexpected entities: %+v", ents)
+	}
+
+	want := []struct{ field, column, tag string }{
+		{"ID", "id", `db:"id,pk,type=uuid"`},
+		{"CreatedAt", "created_at", `db:"created_at,type=timestamptz,default=now()"`},
+		{"Total", "total", `db:"total"`},
+		{"Billing.City", "billing_city", `db:"city"`},
+		{"Shipping.City", "shipping_city", `db:"city"`},
+	}
+	fields := ents[0].Fields
+	if len(fields) != len(want) {
+		t.Fatalf("got %d fields, want %d: %+v", len(fields), len(want), fields)
+	}
+	for i, w := range want {
+		f := fields[i]
+		if f.FieldName != w.field || f.ColumnName != w.column || f.RawTag != w.tag || f.Idx != i {
+			t.Errorf("field %d = %s/%s %s idx %d, want %s/%s %s idx %d", i, f.FieldName, f.ColumnName, f.RawTag, f.Idx, w.field, w.column, w.tag, i)
+		}
+	}
+}
+
+func TestDiscoverInFile_InferColumns(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "note.go")
+	src := "package domain\n\n" +
+		"import \"time\"\n\n" +
+		"// table: \"notes\"\n" +
+		"type Note struct {\n" +
+		"\tID        int64  `db:\"id,pk\"`\n" +
+		"\tTitle     string\n" +
+		"\tArchivedAt *time.Time\n" +
+		"\tCache     string `db:\"-\"`\n" +
+		"\tWords     int    `db:\"words,transient\"`\n" +
+		"\tdraft     string\n" +
+		"\tAuthor    Author\n" +
+		"}\n\n" +
+		"type Author struct{ Name string }\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, infer := range []bool{false, true} {
+		ents, err := discoverInFile(&DiscoverContext{Packages: map[string]*PackageInfo{}, InferColumns: infer}, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range ents[0].Fields {
+			got = append(got, f.Tag)
+		}
+		want := []string{"id,pk"}
+		if infer {
+			want = append(want, "title,type=text,notnull", "archived_at,type=timestamptz")
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("infer=%v: tags = %q, want %q", infer, got, want)
+		}
+	}
+}
+
+func TestDiscoverInFile_StructTagSyntax(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "doc.go")
+	src := "package domain\n\n" +
+		"// table: \"docs\"\n" +
+		"type Doc struct {\n" +
+		"\tID    string \"db:\\\"id,pk\\\"\"\n" +
+		"\tTitle string `json:\"title\"   db:\"title,default='\\\"untitled\\\"'\"`\n" +
+		"\tBody  string `json:\"db:\\\"x\\\"\" db:\"body\"`\n" +
+		"\tCache string `json:\"cache\" db:\"-\"`\n" +
+		"}\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ents, err := discoverInFile(&DiscoverContext{Packages: map[string]*PackageInfo{}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range ents[0].Fields {
+		got = append(got, f.ColumnName+"="+f.Tag)
+	}
+	want := []string{"id=id,pk", `title=title,default='"untitled"'`, "body=body"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("fields = %q, want %q", got, want)
+	}
+}
+
+func TestDiscoverInFile_GenericEntities(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "order.go")
+	src := "package domain\n\n" +
+		"import \"time\"\n\n" +
+		"type Entity[ID comparable, P any] struct {\n" +
+		"\tID      ID   `db:\"id,pk\"`\n" +
+		"\tPayload P    `db:\",embed_prefix=payload_\"`\n" +
+		"\tTags    []ID `db:\"tags\"`\n" +
+		"\tStamps[time.Time]\n" +
+		"}\n\n" +
+		"type Stamps[T any] struct {\n" +
+		"\tCreatedAt T `db:\"created_at\"`\n" +
+		"}\n\n" +
+		"type OrderPayload struct {\n" +
+		"\tTotal int `db:\"total\"`\n" +
+		"}\n\n" +
+		"// table: \"orders\"\n" +
+		"type Order = Entity[string, OrderPayload]\n\n" +
+		"// table: \"invoices\"\n" +
+		"type Invoice struct {\n" +
+		"\tEntity[int64, OrderPayload]\n" +
+		"\tNumber string `db:\"number\"`\n" +
+		"}\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ents, err := discoverInFile(&DiscoverContext{Packages: map[string]*PackageInfo{}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"orders":   "id:string payload_total:int tags:[]string created_at:time.Time",
+		"invoices": "id:int64 payload_total:int tags:[]int64 created_at:time.Time number:string",
+	}
+	if len(ents) != len(want) {
+		t.Fatalf("got %d entities, want %d: %+v", len(ents), len(want), ents)
+	}
+	for _, e := range ents {
+		var got []string
+		for _, f := range e.Fields {
+			got = append(got, f.ColumnName+":"+f.GoType)
+		}
+		if strings.Join(got, " ") != want[e.TableName] {
+			t.Errorf("%s: fields = %q, want %q", e.TableName, strings.Join(got, " "), want[e.TableName])
+		}
+	}
+}
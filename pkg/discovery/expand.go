@@ -1,14 +1,28 @@
 package discovery
 
 import (
+	"fmt"
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
 	"github.com/amr0ny/migrateme/pkg/migrate"
 	"go/ast"
+	"go/types"
 	"path/filepath"
-	"regexp"
+	"reflect"
 	"strings"
 )
 
-// ExpandFields recursively resolves embedded structs, including other packages
+// ExpandFields recursively resolves embedded structs, including other packages.
+//
+// An anonymous struct field is expanded in place unless tagged db:"-". A
+// named struct field is expanded when its db tag has an embed_prefix= option,
+// e.g. Billing Address `db:",embed_prefix=billing_"`; the prefix is prepended
+// to every column of the embedded struct, and also works on anonymous fields.
+// A column declared directly in a struct overrides the inherited column of the
+// same name, at the inherited position, the way Go field promotion resolves
+// the shadowed field.
+//
+// Generic structs expand with their type arguments: a field of type T of an
+// embedded Base[uuid.UUID] is a uuid.UUID column.
 func ExpandFields(
 	ctx *DiscoverContext,
 	pkgPath string,
@@ -16,85 +30,269 @@ func ExpandFields(
 	file *ast.File,
 	visited map[string]bool,
 ) []migrate.FieldInfo {
+	return expandFields(ctx, pkgPath, st, file, visited, nil)
+}
 
-	var out []migrate.FieldInfo
+// expandFields expands st, in which type parameters stand for args.
+func expandFields(
+	ctx *DiscoverContext,
+	pkgPath string,
+	st *ast.StructType,
+	file *ast.File,
+	visited map[string]bool,
+	args typeArgs,
+) []migrate.FieldInfo {
+
+	var entries []migrate.FieldEntry
 
 	for _, field := range st.Fields.List {
 		tagText := ""
 		if field.Tag != nil {
-			tagText = strings.Trim(field.Tag.Value, "`")
+			tagText = migrate.TagLiteral(field.Tag.Value)
 		}
 
-		// If field has column tag — collect it later
-		column := parseDBTag(tagText)
-
 		// If field is anonymous (embedded)
 		isEmbedded := len(field.Names) == 0
+		prefix, hasPrefix := dbTagOption(tagText, "embed_prefix")
 
-		switch t := field.Type.(type) {
-
-		// ========== IDENT:   type MyStruct struct { BaseEntity } ==========
-		case *ast.Ident:
-			// anonymous embedded struct
-			if isEmbedded {
-				if next := ctx.Packages[pkgPath].Structs[t.Name]; next != nil {
-					key := pkgPath + "." + t.Name
-					if visited[key] {
-						break
-					}
-					visited[key] = true
-					out = append(out,
-						ExpandFields(ctx, pkgPath, next, file, visited)...,
-					)
-					continue
+		if (isEmbedded || hasPrefix) && !skipsEmbedding(tagText) {
+			next, err := resolveEmbedded(ctx, pkgPath, field.Type, file, args)
+			if err != nil {
+				ignore := append(diagnostics.ParseIgnores(commentText(field.Doc)), diagnostics.ParseIgnores(commentText(field.Comment))...)
+				if !diagnostics.Ignored(ignore, diagnostics.UnresolvedType) {
+					pos := ctx.fileSet().Position(field.Pos())
+					ctx.report(diagnostics.Warningf(diagnostics.UnresolvedType, "%v", err).At(pos.Filename, pos.Line))
 				}
 			}
-
-		// ========== SELECTOR:   domain.BaseEntity ==========
-		case *ast.SelectorExpr:
-			if isEmbedded {
-				alias := t.X.(*ast.Ident).Name
-				importPath := resolveImportPath(file, alias, ctx.ModulePath, ctx.ModuleRoot)
-				if importPath != "" {
-					if pkg := ctx.Packages[importPath]; pkg != nil {
-						if next := pkg.Structs[t.Sel.Name]; next != nil {
-							key := importPath + "." + t.Sel.Name
-							if visited[key] {
-								break
-							}
-							visited[key] = true
-							out = append(out,
-								ExpandFields(ctx, importPath, next, file, visited)...,
-							)
-							continue
-						}
+			if next.st != nil {
+				if visited[next.key] {
+					continue
+				}
+				// visited holds the structs being expanded, so a struct can
+				// be embedded twice under different prefixes but not in itself.
+				visited[next.key] = true
+				for _, f := range expandStruct(ctx, next, visited) {
+					f.ColumnName = prefix + f.ColumnName
+					if !isEmbedded {
+						f.FieldName = field.Names[0].Name + "." + f.FieldName
 					}
+					entries = append(entries, migrate.FieldEntry{Field: f, Inherited: true})
 				}
-			}
-
-		// ========== ANONYMOUS STRUCT:   struct { X int; Y string } ==========
-		case *ast.StructType:
-			if isEmbedded {
-				// treat inline anonymous struct as embedded
-				out = append(out,
-					ExpandFields(ctx, pkgPath, t, file, visited)...,
-				)
+				delete(visited, next.key)
 				continue
 			}
 		}
 
 		// ========== REGULAR FIELD WITH COLUMN ==========
-		if !isEmbedded && column != "" && len(field.Names) > 0 {
-			out = append(out, migrate.FieldInfo{
-				FieldName:  field.Names[0].Name,
-				ColumnName: column,
-				Idx:        len(out),
+		if isEmbedded {
+			continue
+		}
+		name := field.Names[0].Name
+		goType := types.ExprString(args.subst(field.Type))
+		tag, isColumn := migrate.ColumnTag(tagText, name, ctx.tagPriority())
+		if !isColumn && ctx.InferColumns && ast.IsExported(name) && migrate.Untagged(tagText, ctx.tagPriority()) {
+			tag, isColumn = migrate.InferColumnTag(name, goType)
+		}
+		if isColumn {
+			pos := ctx.fileSet().Position(field.Pos())
+			entries = append(entries, migrate.FieldEntry{Field: migrate.FieldInfo{
+				FieldName:  name,
+				ColumnName: migrate.TagName(tag),
 				RawTag:     tagText,
-			})
+				Tag:        tag,
+				GoType:     goType,
+				Ignore:     append(diagnostics.ParseIgnores(commentText(field.Doc)), diagnostics.ParseIgnores(commentText(field.Comment))...),
+				Using:      firstNonEmpty(extractUsingComment(field.Doc), extractUsingComment(field.Comment)),
+				FilePath:   pos.Filename,
+				Line:       pos.Line,
+			}})
+		}
+	}
+
+	return migrate.ResolveFields(entries)
+}
+
+type embeddedStruct struct {
+	key     string
+	pkgPath string
+	st      *ast.StructType
+	// file declares st, for the imports of its own embedded fields.
+	file *ast.File
+	// params are the type parameters of a generic struct, args their
+	// arguments.
+	params []string
+	args   typeArgs
+	// foreign is set for structs of another package.
+	foreign bool
+}
+
+// expandStruct expands a resolved struct. Types of fields of another package
+// are cleared, since they are written relative to that package.
+func expandStruct(ctx *DiscoverContext, next embeddedStruct, visited map[string]bool) []migrate.FieldInfo {
+	fields := expandFields(ctx, next.pkgPath, next.st, next.file, visited, next.args)
+	if next.foreign {
+		for i := range fields {
+			fields[i].GoType = ""
+		}
+	}
+	return fields
+}
+
+// typeArg is the argument of a type parameter, with the package and file it
+// is written in, which its names resolve against.
+type typeArg struct {
+	expr    ast.Expr
+	pkgPath string
+	file    *ast.File
+}
+
+// typeArgs maps the type parameters of a generic struct to their arguments.
+type typeArgs map[string]typeArg
+
+// subst returns expr with type parameters replaced by their arguments.
+func (args typeArgs) subst(expr ast.Expr) ast.Expr {
+	if len(args) == 0 {
+		return expr
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if a, ok := args[t.Name]; ok {
+			return a.expr
+		}
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: args.subst(t.X)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: t.Len, Elt: args.subst(t.Elt)}
+	case *ast.MapType:
+		return &ast.MapType{Key: args.subst(t.Key), Value: args.subst(t.Value)}
+	case *ast.IndexExpr:
+		return &ast.IndexExpr{X: t.X, Index: args.subst(t.Index)}
+	case *ast.IndexListExpr:
+		indices := make([]ast.Expr, len(t.Indices))
+		for i, index := range t.Indices {
+			indices[i] = args.subst(index)
 		}
+		return &ast.IndexListExpr{X: t.X, Indices: indices}
+	}
+	return expr
+}
+
+// arg returns the argument expr, written in pkgPath and file, passes on to a
+// type parameter; a type parameter passed on keeps the place of its own
+// argument.
+func (args typeArgs) arg(expr ast.Expr, pkgPath string, file *ast.File) typeArg {
+	if id, ok := expr.(*ast.Ident); ok {
+		if a, ok := args[id.Name]; ok {
+			return a
+		}
+	}
+	return typeArg{expr: args.subst(expr), pkgPath: pkgPath, file: file}
+}
+
+// resolveEmbedded finds the struct type of an embedded or prefixed field:
+// a struct of the same package, of another package of the module or of
+// another module, or an inline struct, optionally behind a pointer. A
+// generic struct is instantiated with the type arguments of expr, and a type
+// parameter of the struct being expanded resolves to its argument. st is nil
+// for other types. A type of a package that is not loaded is an error, since
+// its columns would otherwise be lost silently.
+func resolveEmbedded(ctx *DiscoverContext, pkgPath string, expr ast.Expr, file *ast.File, args typeArgs) (embeddedStruct, error) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		if a, ok := args[id.Name]; ok {
+			return resolveEmbedded(ctx, a.pkgPath, a.expr, a.file, nil)
+		}
+	}
+	var indices []ast.Expr
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr, indices = t.X, []ast.Expr{t.Index}
+	case *ast.IndexListExpr:
+		expr, indices = t.X, t.Indices
 	}
 
-	return out
+	next, err := resolveStruct(ctx, pkgPath, expr, file)
+	if err != nil || next.st == nil {
+		return next, err
+	}
+	if next.file == nil {
+		next.file = file
+	}
+	if _, inline := expr.(*ast.StructType); inline {
+		next.args = args
+	}
+	if len(next.params) > 0 {
+		next.args = make(typeArgs, len(next.params))
+		keys := make([]string, len(next.params))
+		for i, param := range next.params {
+			if i < len(indices) {
+				next.args[param] = args.arg(indices[i], pkgPath, file)
+				keys[i] = types.ExprString(next.args[param].expr)
+			}
+		}
+		next.key += "[" + strings.Join(keys, ",") + "]"
+	}
+	return next, nil
+}
+
+// resolveStruct finds the struct type named or written by expr.
+func resolveStruct(ctx *DiscoverContext, pkgPath string, expr ast.Expr, file *ast.File) (embeddedStruct, error) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if pkg := ctx.lookupPackage(pkgPath); pkg != nil {
+			if st := pkg.Structs[t.Name]; st != nil {
+				return embeddedStruct{
+					key: pkgPath + "." + t.Name, pkgPath: pkgPath, st: st,
+					file: pkg.Decls[t.Name], params: pkg.TypeParams[t.Name],
+				}, nil
+			}
+		}
+	case *ast.SelectorExpr:
+		alias, ok := t.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		importPath := resolveImportPath(file, alias.Name, ctx.ModulePath, ctx.ModuleRoot)
+		if importPath == "" {
+			break
+		}
+		pkg := ctx.lookupPackage(importPath)
+		if pkg == nil {
+			// Standard library paths have no dot in their first element.
+			if first, _, _ := strings.Cut(importPath, "/"); !strings.Contains(first, ".") {
+				break
+			}
+			reason := "it is not a dependency of the module"
+			if ctx.depsErr != nil {
+				reason = ctx.depsErr.Error()
+			}
+			return embeddedStruct{}, fmt.Errorf("cannot resolve type %s.%s, its columns are skipped: package %s is not loaded: %s",
+				alias.Name, t.Sel.Name, importPath, reason)
+		}
+		if st := pkg.Structs[t.Sel.Name]; st != nil {
+			return embeddedStruct{
+				key: importPath + "." + t.Sel.Name, pkgPath: importPath, st: st,
+				file: pkg.Decls[t.Sel.Name], params: pkg.TypeParams[t.Sel.Name], foreign: true,
+			}, nil
+		}
+	case *ast.StructType:
+		return embeddedStruct{key: fmt.Sprintf("%s.struct@%d", pkgPath, t.Pos()), pkgPath: pkgPath, st: t, file: file}, nil
+	}
+	return embeddedStruct{}, nil
+}
+
+// skipsEmbedding reports a db:"-" or transient tag, which keeps an embedded
+// struct out of the table.
+func skipsEmbedding(tag string) bool {
+	db, ok := reflect.StructTag(tag).Lookup("db")
+	return ok && migrate.Excluded(db)
+}
+
+// dbTagOption returns the value of a key=value option of the db tag.
+func dbTagOption(tag, key string) (string, bool) {
+	return migrate.TagOption(migrate.LookupTag(tag, "db"), key)
 }
 
 func resolveImportPath(file *ast.File, alias string, modulePrefix, moduleRoot string) string {
@@ -123,16 +321,3 @@ func patch(importPath, modulePrefix, moduleRoot string) string {
 
 	return filepath.Join(moduleRoot, rel)
 }
-
-func parseDBTag(tag string) string {
-	re := regexp.MustCompile(`db:"([^"]*)"`)
-	m := re.FindStringSubmatch(tag)
-	if len(m) != 2 {
-		return ""
-	}
-	col := strings.Split(m[1], ",")[0]
-	if col == "-" {
-		return ""
-	}
-	return col
-}
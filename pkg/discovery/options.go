@@ -0,0 +1,130 @@
+package discovery
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// optionsMethod is what a TableOptions method of a type returns.
+type optionsMethod struct {
+	options migrate.TableOptions
+	// err is why the method body could not be read.
+	err error
+}
+
+// tableOptions returns the TableOptions methods declared in a package, by
+// receiver type.
+func (ctx *DiscoverContext) tableOptions(pkgPath string) map[string]optionsMethod {
+	if methods, ok := ctx.options[pkgPath]; ok {
+		return methods
+	}
+	methods := map[string]optionsMethod{}
+	if pkg := ctx.lookupPackage(pkgPath); pkg != nil {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Name.Name != "TableOptions" || fn.Recv == nil || len(fn.Recv.List) != 1 {
+					continue
+				}
+				if fn.Type.Params.NumFields() != 0 || fn.Type.Results.NumFields() != 1 {
+					continue
+				}
+				if recv := receiverName(fn.Recv.List[0].Type); recv != "" {
+					opts, err := returnedOptions(fn.Body)
+					methods[recv] = optionsMethod{options: opts, err: err}
+				}
+			}
+		}
+	}
+	if ctx.options == nil {
+		ctx.options = map[string]map[string]optionsMethod{}
+	}
+	ctx.options[pkgPath] = methods
+	return methods
+}
+
+// returnedOptions reads a method body consisting of
+// return migrate.TableOptions{...} with constant string, []string and bool
+// fields.
+func returnedOptions(body *ast.BlockStmt) (migrate.TableOptions, error) {
+	var opts migrate.TableOptions
+	if body == nil || len(body.List) != 1 {
+		return opts, fmt.Errorf("body must be a single return statement")
+	}
+	ret, ok := body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return opts, fmt.Errorf("body must be a single return statement")
+	}
+	lit, ok := ret.Results[0].(*ast.CompositeLit)
+	if !ok {
+		return opts, fmt.Errorf("must return a migrate.TableOptions literal")
+	}
+
+	v := reflect.ValueOf(&opts).Elem()
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return opts, fmt.Errorf("fields of the literal must be named")
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			return opts, fmt.Errorf("fields of the literal must be named")
+		}
+		field := v.FieldByName(key.Name)
+		if !field.IsValid() {
+			return opts, fmt.Errorf("unknown field %s", key.Name)
+		}
+		if err := setConstant(field, kv.Value); err != nil {
+			return opts, fmt.Errorf("%s: %w", key.Name, err)
+		}
+	}
+	return opts, nil
+}
+
+// setConstant stores the constant expression expr in field.
+func setConstant(field reflect.Value, expr ast.Expr) error {
+	switch field.Kind() {
+	case reflect.String:
+		s, err := stringConstant(expr)
+		if err != nil {
+			return err
+		}
+		field.SetString(s)
+	case reflect.Bool:
+		id, ok := expr.(*ast.Ident)
+		if !ok || (id.Name != "true" && id.Name != "false") {
+			return fmt.Errorf("must be true or false")
+		}
+		field.SetBool(id.Name == "true")
+	case reflect.Slice:
+		lit, ok := expr.(*ast.CompositeLit)
+		if !ok || field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("must be a []string literal")
+		}
+		values := make([]string, 0, len(lit.Elts))
+		for _, elt := range lit.Elts {
+			s, err := stringConstant(elt)
+			if err != nil {
+				return err
+			}
+			values = append(values, s)
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+func stringConstant(expr ast.Expr) (string, error) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", fmt.Errorf("must be a string literal")
+	}
+	return strconv.Unquote(lit.Value)
+}
@@ -0,0 +1,50 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+)
+
+func TestDiscoverInFile_TableOptions(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "event.go")
+	src := "package domain\n\n" +
+		"import \"github.com/amr0ny/migrateme/pkg/migrate\"\n\n" +
+		"// table: \"events\"\n" +
+		"type Event struct {\n" +
+		"\tID int `db:\"id,pk\"`\n" +
+		"}\n\n" +
+		"func (Event) TableOptions() migrate.TableOptions {\n" +
+		"\treturn migrate.TableOptions{Storage: []string{\"fillfactor=70\", `autovacuum_enabled=false`}}\n" +
+		"}\n\n" +
+		"// table: \"logs\"\n" +
+		"type Log struct {\n" +
+		"\tID int `db:\"id,pk\"`\n" +
+		"}\n\n" +
+		"func (*Log) TableOptions() migrate.TableOptions { return defaultOptions }\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := diagnostics.NewCollector(nil, nil)
+	ctx := &DiscoverContext{Packages: map[string]*PackageInfo{}, Reporter: collector}
+	ents, err := discoverInFile(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 2 {
+		t.Fatalf("got %d entities", len(ents))
+	}
+	if got := strings.Join(ents[0].Options.Storage, " "); got != "fillfactor=70 autovacuum_enabled=false" {
+		t.Errorf("events storage = %q", got)
+	}
+	reported := collector.Diagnostics()
+	if len(ents[1].Options.Storage) != 0 || len(reported) != 1 || !strings.Contains(reported[0].Message, "Log.TableOptions") {
+		t.Errorf("logs options = %+v, reported %v", ents[1].Options, reported)
+	}
+}
@@ -0,0 +1,176 @@
+package discovery
+
+import (
+	"fmt"
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+// Ways a type declares the table it maps to.
+const (
+	// SourceComment is a table directive in the doc comment of the type:
+	// // table: "users".
+	SourceComment = "comment"
+	// SourceMethod is a TableName() string method returning a string
+	// literal, the convention of gorm, bun and pkg/registry.
+	SourceMethod = "method"
+)
+
+// DefaultEntitySources lets a table comment take precedence over a
+// TableName method.
+var DefaultEntitySources = []string{SourceComment, SourceMethod}
+
+// ParseEntitySources validates a configured precedence of entity sources;
+// empty means DefaultEntitySources.
+func ParseEntitySources(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return DefaultEntitySources, nil
+	}
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != SourceComment && name != SourceMethod {
+			return nil, fmt.Errorf("unknown entity source %q, expected %q or %q", name, SourceComment, SourceMethod)
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
+
+// Resolution explains why a type was or was not picked up as an entity.
+type Resolution struct {
+	Struct string `json:"struct"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	// Table is empty when the type is not an entity.
+	Table  string `json:"table,omitempty"`
+	Source string `json:"source,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// tableMethod is what a TableName method of a type returns.
+type tableMethod struct {
+	table string
+	// literal is false when the method does not just return a string
+	// literal, so the table is only known at run time.
+	literal bool
+}
+
+// resolveTable returns the table ts declares, by the first of the entity
+// sources that declares one, with the reason for the choice.
+func (ctx *DiscoverContext) resolveTable(gen *ast.GenDecl, ts *ast.TypeSpec, pkgPath string) (table, source, reason string) {
+	comment := extractTableComment(gen.Doc)
+	if comment == "" {
+		comment = extractTableComment(ts.Doc)
+	}
+	method, hasMethod := ctx.tableMethods(pkgPath)[ts.Name.Name]
+
+	var found []string
+	for _, src := range ctx.entitySources() {
+		switch src {
+		case SourceComment:
+			if comment == "" {
+				continue
+			}
+			found = append(found, fmt.Sprintf("table: comment %q", comment))
+			if table == "" {
+				table, source = comment, SourceComment
+			}
+		case SourceMethod:
+			if !hasMethod || !method.literal {
+				continue
+			}
+			found = append(found, fmt.Sprintf("TableName() %q", method.table))
+			if table == "" {
+				table, source = method.table, SourceMethod
+			}
+		}
+	}
+
+	switch {
+	case table != "" && len(found) > 1:
+		return table, source, fmt.Sprintf("declared by %s, which takes precedence over %s", found[0], strings.Join(found[1:], ", "))
+	case table != "":
+		return table, source, "declared by " + found[0]
+	case hasMethod && !method.literal && comment == "":
+		return "", "", "TableName() does not return a string literal, so the table is only known at run time; add a table: comment"
+	case comment != "" || hasMethod:
+		return "", "", fmt.Sprintf("its table is declared by a disabled source (entity_sources: %s)", strings.Join(ctx.entitySources(), ", "))
+	default:
+		return "", "", "no table: comment and no TableName() method"
+	}
+}
+
+// tableMethods returns the TableName methods declared in a package, by
+// receiver type.
+func (ctx *DiscoverContext) tableMethods(pkgPath string) map[string]tableMethod {
+	if methods, ok := ctx.methods[pkgPath]; ok {
+		return methods
+	}
+	methods := map[string]tableMethod{}
+	if pkg := ctx.lookupPackage(pkgPath); pkg != nil {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Name.Name != "TableName" || fn.Recv == nil || len(fn.Recv.List) != 1 {
+					continue
+				}
+				if fn.Type.Params.NumFields() != 0 || fn.Type.Results.NumFields() != 1 {
+					continue
+				}
+				if recv := receiverName(fn.Recv.List[0].Type); recv != "" {
+					methods[recv] = returnedLiteral(fn.Body)
+				}
+			}
+		}
+	}
+	if ctx.methods == nil {
+		ctx.methods = map[string]map[string]tableMethod{}
+	}
+	ctx.methods[pkgPath] = methods
+	return methods
+}
+
+// receiverName returns the type name of a receiver: T, *T or T[P].
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr = t.X
+	case *ast.IndexListExpr:
+		expr = t.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// returnedLiteral reads a method body consisting of return "table".
+func returnedLiteral(body *ast.BlockStmt) tableMethod {
+	if body == nil || len(body.List) != 1 {
+		return tableMethod{}
+	}
+	ret, ok := body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return tableMethod{}
+	}
+	lit, ok := ret.Results[0].(*ast.BasicLit)
+	if !ok {
+		return tableMethod{}
+	}
+	table, err := strconv.Unquote(lit.Value)
+	if err != nil || table == "" {
+		return tableMethod{}
+	}
+	return tableMethod{table: table, literal: true}
+}
+
+func (ctx *DiscoverContext) explain(r Resolution) {
+	if ctx.Explain {
+		ctx.Resolutions = append(ctx.Resolutions, r)
+	}
+}
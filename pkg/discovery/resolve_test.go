@@ -0,0 +1,107 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const resolveSrc = "package domain\n\n" +
+	"// table: \"users\"\n" +
+	"type User struct {\n" +
+	"\tID int `db:\"id,pk\"`\n" +
+	"}\n\n" +
+	"func (User) TableName() string { return \"app_users\" }\n\n" +
+	"type Order struct {\n" +
+	"\tID int `db:\"id,pk\"`\n" +
+	"}\n\n" +
+	"func (*Order) TableName() string { return \"orders\" }\n\n" +
+	"type Tenant struct {\n" +
+	"\tID int `db:\"id,pk\"`\n" +
+	"}\n\n" +
+	"func (Tenant) TableName() string { return tenantTable }\n\n" +
+	"const tenantTable = \"tenants\"\n\n" +
+	"type Money struct {\n" +
+	"\tAmount int `db:\"amount\"`\n" +
+	"}\n"
+
+func TestDiscoverInFile_EntitySources(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "domain.go")
+	if err := os.WriteFile(path, []byte(resolveSrc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		sources []string
+		want    map[string]string // struct -> table, "" when skipped
+		reasons map[string]string
+	}{
+		{
+			name: "default",
+			want: map[string]string{"User": "users", "Order": "orders", "Tenant": "", "Money": ""},
+			reasons: map[string]string{
+				"User":   "takes precedence over TableName()",
+				"Tenant": "does not return a string literal",
+				"Money":  "no table: comment and no TableName() method",
+			},
+		},
+		{
+			name:    "method first",
+			sources: []string{SourceMethod, SourceComment},
+			want:    map[string]string{"User": "app_users", "Order": "orders", "Tenant": "", "Money": ""},
+			reasons: map[string]string{"User": "takes precedence over table: comment"},
+		},
+		{
+			name:    "comment only",
+			sources: []string{SourceComment},
+			want:    map[string]string{"User": "users", "Order": "", "Tenant": "", "Money": ""},
+			reasons: map[string]string{"Order": "disabled source"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &DiscoverContext{Packages: map[string]*PackageInfo{}, EntitySources: tt.sources, Explain: true}
+			ents, err := discoverInFile(ctx, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tables := map[string]string{}
+			for _, e := range ents {
+				tables[e.StructName] = e.TableName
+			}
+			if len(ctx.Resolutions) != len(tt.want) {
+				t.Fatalf("got %d resolutions, want %d: %+v", len(ctx.Resolutions), len(tt.want), ctx.Resolutions)
+			}
+			for _, r := range ctx.Resolutions {
+				if r.Table != tt.want[r.Struct] || tables[r.Struct] != tt.want[r.Struct] {
+					t.Errorf("%s: table = %q (entity %q), want %q", r.Struct, r.Table, tables[r.Struct], tt.want[r.Struct])
+				}
+				if want := tt.reasons[r.Struct]; !strings.Contains(r.Reason, want) {
+					t.Errorf("%s: reason = %q, want it to contain %q", r.Struct, r.Reason, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseEntitySources(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseEntitySources([]string{" Method ", "comment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "method,comment" {
+		t.Errorf("got %v", got)
+	}
+	if got, _ := ParseEntitySources(nil); strings.Join(got, ",") != "comment,method" {
+		t.Errorf("default = %v", got)
+	}
+	if _, err := ParseEntitySources([]string{"annotation"}); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+}
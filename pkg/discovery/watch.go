@@ -0,0 +1,69 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileStamp identifies a version of a file well enough to notice edits.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch calls onChange whenever a Go file under paths is added, removed or
+// modified, until ctx is done. Files are polled every interval rather than
+// watched through OS notifications, which behave differently on every
+// platform and inside containers; edits within one interval make one call.
+func Watch(ctx context.Context, paths []string, interval time.Duration, onChange func()) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := snapshot(paths)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		cur := snapshot(paths)
+		if !sameSnapshot(last, cur) {
+			last = cur
+			onChange()
+		}
+	}
+}
+
+// snapshot stamps the Go files discovery would read under paths; test files
+// are skipped like in DiscoverEntities.
+func snapshot(paths []string) map[string]fileStamp {
+	out := map[string]fileStamp{}
+	for _, p := range paths {
+		filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+				return nil
+			}
+			out[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+	}
+	return out
+}
+
+func sameSnapshot(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		if other, ok := b[path]; !ok || !other.modTime.Equal(stamp.modTime) || other.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
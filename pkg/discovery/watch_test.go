@@ -0,0 +1,75 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch_ReportsChanges(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "user.go")
+	if err := os.WriteFile(path, []byte("package domain\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, []string{dir}, 10*time.Millisecond, func() { changes <- struct{}{} })
+	}()
+
+	// Ignored files do not count as changes.
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(dir, "user_test.go"), []byte("package domain\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("todo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("package domain\n\ntype User struct{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changes:
+	case <-ctx.Done():
+		t.Fatal("no change reported")
+	}
+	select {
+	case <-changes:
+		t.Fatal("one edit reported twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSameSnapshot(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	a := map[string]fileStamp{"a.go": {modTime: now, size: 1}}
+	if !sameSnapshot(a, map[string]fileStamp{"a.go": {modTime: now, size: 1}}) {
+		t.Error("equal snapshots differ")
+	}
+	for _, b := range []map[string]fileStamp{
+		{"a.go": {modTime: now, size: 2}},
+		{"a.go": {modTime: now.Add(time.Second), size: 1}},
+		{"b.go": {modTime: now, size: 1}},
+		{},
+	} {
+		if sameSnapshot(a, b) {
+			t.Errorf("sameSnapshot(%v, %v) = true", a, b)
+		}
+	}
+}
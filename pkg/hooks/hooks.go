@@ -0,0 +1,89 @@
+// Package hooks lets users inspect, rewrite or veto the statements generated
+// for each table before migration files are written.
+//
+// Hooks are registered programmatically or loaded from Go plugins built with
+// `go build -buildmode=plugin`. A plugin exports either a variable
+//
+//	var Hook hooks.Hook = requireCreatedAt{}
+//
+// or a constructor
+//
+//	func NewHook() hooks.Hook { return requireCreatedAt{} }
+package hooks
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// TableMigration is the generated migration of a single table.
+type TableMigration struct {
+	Table string
+	// Change is the kind of change, e.g. "create_table" or "add_columns".
+	Change string
+	// Schema is the declared (target) schema of the table.
+	Schema migrate.TableSchema
+	Up     []string
+	Down   []string
+	// PostUp runs after every table of the migration has been created.
+	PostUp []string
+}
+
+// Hook returns the migration to write, possibly rewritten. Returning an error
+// vetoes generation; use Vetof for a readable rule violation.
+type Hook interface {
+	Apply(m TableMigration) (TableMigration, error)
+}
+
+type HookFunc func(m TableMigration) (TableMigration, error)
+
+func (f HookFunc) Apply(m TableMigration) (TableMigration, error) { return f(m) }
+
+// VetoError reports that a hook rejected a table's migration.
+type VetoError struct {
+	Table  string
+	Reason string
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("table %s rejected: %s", e.Table, e.Reason)
+}
+
+func Vetof(table, format string, args ...any) error {
+	return &VetoError{Table: table, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Chain applies hooks in order, feeding each the previous result.
+func Chain(m TableMigration, hooks ...Hook) (TableMigration, error) {
+	for _, h := range hooks {
+		var err error
+		if m, err = h.Apply(m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// Load opens a Go plugin and returns the hook it exports.
+func Load(path string) (Hook, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open hook plugin %s: %w", path, err)
+	}
+
+	if sym, err := p.Lookup("Hook"); err == nil {
+		if h, ok := sym.(*Hook); ok && *h != nil {
+			return *h, nil
+		}
+		return nil, fmt.Errorf("hook plugin %s: Hook must be a hooks.Hook variable", path)
+	}
+	if sym, err := p.Lookup("NewHook"); err == nil {
+		if newHook, ok := sym.(func() Hook); ok {
+			return newHook(), nil
+		}
+		return nil, fmt.Errorf("hook plugin %s: NewHook must be func() hooks.Hook", path)
+	}
+	return nil, fmt.Errorf("hook plugin %s exports neither Hook nor NewHook", path)
+}
@@ -0,0 +1,52 @@
+package hooks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestChain_RewritesAndVetoes(t *testing.T) {
+	t.Parallel()
+
+	addComment := HookFunc(func(m TableMigration) (TableMigration, error) {
+		m.Up = append(m.Up, "COMMENT ON TABLE "+m.Table+" IS 'managed'")
+		return m, nil
+	})
+	requireCreatedAt := HookFunc(func(m TableMigration) (TableMigration, error) {
+		if m.Change != "create_table" {
+			return m, nil
+		}
+		for _, c := range m.Schema.Columns {
+			if c.ColumnName == "created_at" {
+				return m, nil
+			}
+		}
+		return m, Vetof(m.Table, "new tables must have created_at")
+	})
+
+	ok := TableMigration{
+		Table:  "users",
+		Change: "create_table",
+		Schema: migrate.TableSchema{Columns: []migrate.ColumnMeta{{ColumnName: "created_at"}}},
+		Up:     []string{"CREATE TABLE users ()"},
+	}
+	got, err := Chain(ok, addComment, requireCreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Up) != 2 || !strings.HasPrefix(got.Up[1], "COMMENT ON TABLE users") {
+		t.Fatalf("unexpected rewrite: %v", got.Up)
+	}
+
+	bad := ok
+	bad.Table = "posts"
+	bad.Schema = migrate.TableSchema{}
+	_, err = Chain(bad, addComment, requireCreatedAt)
+	var veto *VetoError
+	if !errors.As(err, &veto) || veto.Table != "posts" {
+		t.Fatalf("expected veto for posts, got %v", err)
+	}
+}
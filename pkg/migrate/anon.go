@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AnonRule is how snapshot anonymizes a column, set with the anon= tag
+// option. The zero rule copies values unchanged.
+type AnonRule string
+
+const (
+	// AnonHash replaces a value with the md5 of the salted value, so equal
+	// values stay equal, e.g. across a foreign key.
+	AnonHash AnonRule = "hash"
+	// AnonNull replaces a value with NULL.
+	AnonNull AnonRule = "null"
+	// AnonFakeEmail replaces a value with a unique address at example.com
+	// derived from the salted value.
+	AnonFakeEmail AnonRule = "fake_email"
+)
+
+// ParseAnonRule validates an anon= tag value.
+func ParseAnonRule(s string) (AnonRule, error) {
+	switch r := AnonRule(strings.ToLower(strings.TrimSpace(s))); r {
+	case AnonHash, AnonNull, AnonFakeEmail:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown anon rule %q, expected %q, %q or %q", s, AnonHash, AnonNull, AnonFakeEmail)
+	}
+}
+
+// Expr returns the SQL expression selecting column anonymized by r, cast to
+// pgType. salt is mixed into derived values so that they cannot be reversed
+// by hashing guessed values. NULL stays NULL.
+func (r AnonRule) Expr(column, pgType, salt string) string {
+	col := `"` + strings.ReplaceAll(column, `"`, `""`) + `"`
+	salted := fmt.Sprintf("md5(%s || %s::text)", quoteLiteral(salt), col)
+	switch r {
+	case AnonHash:
+		return fmt.Sprintf("(%s)::%s", salted, pgType)
+	case AnonNull:
+		return "NULL::" + pgType
+	case AnonFakeEmail:
+		return fmt.Sprintf("('user_' || substr(%s, 1, 16) || '@example.com')::%s", salted, pgType)
+	default:
+		return col
+	}
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
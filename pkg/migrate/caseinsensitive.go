@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CaseInsensitiveMode decides how columns tagged ci compare case-insensitively.
+type CaseInsensitiveMode string
+
+const (
+	// CaseInsensitiveCitext makes ci columns citext, which needs the citext
+	// extension.
+	CaseInsensitiveCitext CaseInsensitiveMode = "citext"
+	// CaseInsensitiveLower makes ci columns text and backs their unique
+	// constraint with a unique index on lower(column) instead.
+	CaseInsensitiveLower CaseInsensitiveMode = "lower"
+)
+
+// ParseCaseInsensitiveMode validates a configured mode; empty means
+// CaseInsensitiveCitext.
+func ParseCaseInsensitiveMode(s string) (CaseInsensitiveMode, error) {
+	switch m := CaseInsensitiveMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return CaseInsensitiveCitext, nil
+	case CaseInsensitiveCitext, CaseInsensitiveLower:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown case_insensitive mode %q, expected %q or %q",
+			s, CaseInsensitiveCitext, CaseInsensitiveLower)
+	}
+}
+
+// Apply resolves the ci columns of s. With CaseInsensitiveCitext their
+// string type becomes citext; with CaseInsensitiveLower it becomes text,
+// and a unique column trades its unique constraint for a unique index on
+// lower(column), named by LowerUniqueIndexName. Columns of other types are
+// left alone.
+func (m CaseInsensitiveMode) Apply(s TableSchema) TableSchema {
+	out := s
+	out.Columns = make([]ColumnMeta, len(s.Columns))
+	out.Indexes = append([]IndexMeta(nil), s.Indexes...)
+	for i, c := range s.Columns {
+		if c.Attrs.CaseInsensitive && IsStringType(c.Attrs.PgType) {
+			switch m {
+			case CaseInsensitiveLower:
+				c.Attrs.PgType = "text"
+				if c.Attrs.Unique {
+					c.Attrs.Unique = false
+					out.Indexes = append(out.Indexes, IndexMeta{
+						Name:    LowerUniqueIndexName(s.TableName, c.ColumnName),
+						Columns: []string{"lower(" + exprIdent(c.ColumnName) + ")"},
+						Unique:  true,
+					})
+				}
+			default:
+				c.Attrs.PgType = "citext"
+			}
+		}
+		out.Columns[i] = c
+	}
+	return out
+}
+
+// LowerUniqueIndexName names the unique index on lower(column) of a ci
+// column under CaseInsensitiveLower.
+func LowerUniqueIndexName(table, column string) string {
+	return fmt.Sprintf("uq_%s_%s_lower", table, column)
+}
+
+// exprIdent writes a column name inside an index expression the way
+// pg_get_indexdef does, so the declared and fetched index compare equal.
+func exprIdent(name string) string {
+	if plainIdentRe.MatchString(name) && name == strings.ToLower(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// IsStringType reports whether t is text, varchar, char or citext, with
+// or without a length.
+func IsStringType(t string) bool {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(t)), "(")
+	switch strings.TrimSpace(base) {
+	case "", "text", "varchar", "character varying", "char", "character", "bpchar", "citext":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package migrate
+
+import "testing"
+
+func TestCaseInsensitiveModeApply(t *testing.T) {
+	t.Parallel()
+
+	s := TableSchema{
+		TableName: "users",
+		Columns: []ColumnMeta{
+			{ColumnName: "email", Attrs: ParseColumnTag("email,unique,ci,type=varchar(255)")},
+			{ColumnName: "Login", Attrs: ParseColumnTag("Login,ci")},
+			{ColumnName: "age", Attrs: ParseColumnTag("age,ci,type=integer")},
+		},
+	}
+
+	citext := CaseInsensitiveCitext.Apply(s)
+	if got := citext.Columns[0].Attrs; got.PgType != "citext" || !got.Unique {
+		t.Errorf("citext email = %+v", got)
+	}
+	if got := citext.Columns[2].Attrs.PgType; got != "integer" {
+		t.Errorf("citext age = %s", got)
+	}
+	if len(citext.Indexes) != 0 {
+		t.Errorf("citext indexes = %+v", citext.Indexes)
+	}
+
+	lower := CaseInsensitiveLower.Apply(s)
+	if got := lower.Columns[0].Attrs; got.PgType != "text" || got.Unique {
+		t.Errorf("lower email = %+v", got)
+	}
+	if len(lower.Indexes) != 1 {
+		t.Fatalf("lower indexes = %+v", lower.Indexes)
+	}
+	idx := lower.Indexes[0]
+	if idx.Name != "uq_users_email_lower" || !idx.Unique || idx.Columns[0] != "lower(email)" {
+		t.Errorf("lower index = %+v", idx)
+	}
+	if s.Columns[0].Attrs.PgType != "varchar(255)" || !s.Columns[0].Attrs.Unique {
+		t.Errorf("Apply modified its argument: %+v", s.Columns[0].Attrs)
+	}
+
+	if _, err := ParseCaseInsensitiveMode("upper"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,246 @@
+package migrate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// EqualDefaults reports whether two column defaults are the same default
+// once spelled canonically (see CanonicalDefault). A missing default equals
+// DEFAULT NULL.
+func EqualDefaults(a, b *string) bool {
+	return canonicalOrNull(a) == canonicalOrNull(b)
+}
+
+func canonicalOrNull(d *string) string {
+	if d == nil {
+		return "null"
+	}
+	return CanonicalDefault(*d)
+}
+
+// CanonicalDefault returns a comparison key for a column default, so that
+// the expression declared on an entity and the one Postgres reports for it
+// compare equal: keywords and function names are lowercased, casts are
+// dropped ('a'::character varying is 'a', nextval('s'::regclass) is
+// nextval('s')), redundant parentheses and whitespace are removed, quoted
+// numbers are unquoted and CURRENT_TIMESTAMP is now(). String literals are
+// kept verbatim. The key is not meant to be executed.
+func CanonicalDefault(expr string) string {
+	tokens := stripCasts(tokenizeDefault(expr))
+
+	var b strings.Builder
+	for i, tok := range tokens {
+		if i > 0 && tok.wordish() && tokens[i-1].wordish() {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok.text)
+	}
+	out := stripOuterParens(b.String())
+
+	if eq, ok := defaultEquivalents[out]; ok {
+		return eq
+	}
+	if m := quotedNumberRe.FindStringSubmatch(out); m != nil {
+		return m[1]
+	}
+	return out
+}
+
+// defaultEquivalents maps spellings of the same default to one of them.
+var defaultEquivalents = map[string]string{
+	"current_timestamp":       "now()",
+	"transaction_timestamp()": "now()",
+	// pg_get_expr qualifies gen_random_uuid when the pgcrypto copy shadows
+	// or replaces the built-in one on the search path.
+	"pg_catalog.gen_random_uuid()": "gen_random_uuid()",
+	"public.gen_random_uuid()":     "gen_random_uuid()",
+}
+
+var quotedNumberRe = regexp.MustCompile(`^'(-?\d+(?:\.\d+)?)'$`)
+
+type defaultTokenKind int
+
+const (
+	tokenWord defaultTokenKind = iota
+	tokenLiteral
+	tokenIdent
+	tokenCast
+	tokenPunct
+)
+
+type defaultToken struct {
+	kind defaultTokenKind
+	text string
+}
+
+func (t defaultToken) wordish() bool {
+	return t.kind == tokenWord || t.kind == tokenLiteral || t.kind == tokenIdent
+}
+
+// tokenizeDefault splits a default expression into words (lowercased),
+// string literals, quoted identifiers, :: casts and punctuation, dropping
+// whitespace.
+func tokenizeDefault(expr string) []defaultToken {
+	var tokens []defaultToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || ((c == 'e' || c == 'E') && i+1 < len(expr) && expr[i+1] == '\''):
+			end := scanQuoted(expr, i, '\'', c != '\'')
+			tokens = append(tokens, defaultToken{tokenLiteral, expr[i:end]})
+			i = end
+		case c == '"':
+			end := scanQuoted(expr, i, '"', false)
+			tokens = append(tokens, defaultToken{tokenIdent, expr[i:end]})
+			i = end
+		case c == ':' && i+1 < len(expr) && expr[i+1] == ':':
+			tokens = append(tokens, defaultToken{tokenCast, "::"})
+			i += 2
+		case isWordByte(c):
+			end := i
+			for end < len(expr) && isWordByte(expr[end]) {
+				end++
+			}
+			tokens = append(tokens, defaultToken{tokenWord, strings.ToLower(expr[i:end])})
+			i = end
+		default:
+			tokens = append(tokens, defaultToken{tokenPunct, string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// scanQuoted returns the index just past the quoted token starting at i.
+// A doubled quote is an escaped quote; escapes also allows backslash escapes
+// (E'...' strings). An unterminated token runs to the end.
+func scanQuoted(s string, i int, quote byte, escapes bool) int {
+	if s[i] != quote {
+		i++ // E prefix
+	}
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case escapes && s[j] == '\\':
+			j++
+		case s[j] == quote && j+1 < len(s) && s[j+1] == quote:
+			j++
+		case s[j] == quote:
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '.' || c == '$' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// typeContinuations are the words that continue a multi-word type name,
+// e.g. character varying or timestamp with time zone.
+var typeContinuations = map[string]bool{
+	"varying": true, "precision": true, "with": true, "without": true, "time": true, "zone": true,
+}
+
+// literalTypes are the type names that can prefix a typed literal such as
+// interval '1 day' or date '2020-01-01'.
+var literalTypes = map[string]bool{
+	"date": true, "time": true, "timetz": true, "timestamp": true, "timestamptz": true, "interval": true,
+	"text": true, "varchar": true, "character": true, "char": true, "bpchar": true,
+	"boolean": true, "bool": true, "smallint": true, "integer": true, "int": true, "bigint": true,
+	"int2": true, "int4": true, "int8": true, "numeric": true, "decimal": true, "real": true,
+	"double": true, "float4": true, "float8": true, "money": true,
+	"json": true, "jsonb": true, "uuid": true, "bytea": true, "inet": true, "cidr": true, "macaddr": true,
+}
+
+// literalTypeWords returns how many trailing words of out name the type of
+// a typed literal that follows: a known type name, optionally continued as
+// in timestamp with time zone. It is 0 for any other word, e.g. THEN or
+// ELSE before a string.
+func literalTypeWords(out []defaultToken) int {
+	words := 0
+	for words < len(out) && words < 4 && out[len(out)-1-words].kind == tokenWord {
+		words++
+	}
+	for n := words; n >= 1; n-- {
+		name := strings.TrimPrefix(out[len(out)-n].text, "pg_catalog.")
+		if !literalTypes[name] {
+			continue
+		}
+		continued := true
+		for _, t := range out[len(out)-n+1:] {
+			continued = continued && typeContinuations[t.text]
+		}
+		if continued {
+			return n
+		}
+	}
+	return 0
+}
+
+// stripCasts removes every :: cast along with its type name, type modifier
+// and array brackets, and the type name of typed literals such as
+// interval '1 day'.
+func stripCasts(tokens []defaultToken) []defaultToken {
+	out := make([]defaultToken, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].kind == tokenLiteral {
+			out = out[:len(out)-literalTypeWords(out)]
+		}
+		if tokens[i].kind != tokenCast {
+			out = append(out, tokens[i])
+			continue
+		}
+		i++ // type name
+		continuation := func() {
+			for i+1 < len(tokens) && tokens[i+1].kind == tokenWord && typeContinuations[tokens[i+1].text] {
+				i++
+			}
+		}
+		continuation()
+		if i+1 < len(tokens) && tokens[i+1].text == "(" {
+			for i+1 < len(tokens) && tokens[i+1].text != ")" {
+				i++
+			}
+			i++
+			// The modifier sits inside the name, as in
+			// timestamp(3) with time zone.
+			continuation()
+		}
+		for i+2 < len(tokens) && tokens[i+1].text == "[" && tokens[i+2].text == "]" {
+			i += 2
+		}
+	}
+	return out
+}
+
+// stripOuterParens removes parentheses enclosing the whole expression.
+func stripOuterParens(s string) string {
+	for len(s) >= 2 && s[0] == '(' && s[len(s)-1] == ')' && closingParen(s) == len(s)-1 {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
+
+// closingParen returns the index of the parenthesis closing s[0], skipping
+// quoted text, or -1.
+func closingParen(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'', '"':
+			i = scanQuoted(s, i, s[i], false) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import "testing"
+
+// Pairs of a default as declared on an entity and as reported by Postgres.
+func TestEqualDefaults(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		declared, db string
+		equal        bool
+	}{
+		{"now()", "now()", true},
+		{"CURRENT_TIMESTAMP", "now()", true},
+		{"NOW()", "now()", true},
+		{"transaction_timestamp()", "CURRENT_TIMESTAMP", true},
+		{"now()", "statement_timestamp()", false},
+		{"CURRENT_DATE", "CURRENT_DATE", true},
+		{"nextval('users_id_seq')", "nextval('users_id_seq'::regclass)", true},
+		{"nextval('users_id_seq')", "nextval('orders_id_seq'::regclass)", false},
+		{"'active'", "'active'::character varying", true},
+		{"'active'", "'active'::text", true},
+		{"'Active'", "'active'::text", false},
+		{"'it''s'", "'it''s'::text", true},
+		{"''", "''::character varying", true},
+		{"0", "0", true},
+		{"'0'", "0", true},
+		{"-1", "'-1'::integer", true},
+		{"(-1)", "'-1'::integer", true},
+		{"1.5", "1.5", true},
+		{"1.5", "1.50", false},
+		{"true", "true", true},
+		{"TRUE", "true", true},
+		{"false", "true", false},
+		{"'{}'", "'{}'::text[]", true},
+		{"'{}'::jsonb", "'{}'::jsonb", true},
+		{"gen_random_uuid()", "gen_random_uuid()", true},
+		{"uuid_generate_v4()", "gen_random_uuid()", false},
+		{"gen_random_uuid()", "public.gen_random_uuid()", true},
+		{"gen_random_uuid()", "pg_catalog.gen_random_uuid()", true},
+		{"interval '1 day'", "'1 day'::interval", true},
+		{"now() + interval '1 day'", "(now() + '1 day'::interval)", true},
+		{"timezone('utc', now())", "timezone('utc'::text, now())", true},
+		{"'2020-01-01 00:00:00'", "'2020-01-01 00:00:00'::timestamp without time zone", true},
+		{"'10.00'", "10.00", true},
+		{"'x'", "'x'::character varying(10)", true},
+		{"NULL", "NULL::character varying", true},
+		{"date '2020-01-01'", "'2020-01-01'::date", true},
+		{"timestamp with time zone '2020-01-01'", "'2020-01-01'::timestamp with time zone", true},
+		{"'2020-01-01 00:00:00'", "'2020-01-01 00:00:00'::timestamp(3) with time zone", true},
+		{"'12:00'", "'12:00:00'::time(0) without time zone", false},
+		{"'12:00:00'", "'12:00:00'::time(0) without time zone", true},
+		{"CASE WHEN true THEN 'a' ELSE 'b' END", "CASE WHEN true THEN 'a'::text ELSE 'b'::text END", true},
+		{"CASE WHEN true THEN 'a' ELSE 'b' END", "CASE WHEN true THEN 'b' ELSE 'a' END", false},
+		{"CASE WHEN true THEN 'a' END", "CASE WHEN false THEN 'a' END", false},
+		{"format('%s-%s', 'a', 'b')", "format('%s-%s'::text, 'a'::text, 'b'::text)", true},
+		{"concat('a', 'b')", "concat('a', 'c')", false},
+		{"coalesce(current_setting('app.tenant', true), 'x')", "COALESCE(current_setting('app.tenant'::text, true), 'x'::text)", true},
+	}
+
+	for _, tc := range cases {
+		declared, db := tc.declared, tc.db
+		if got := EqualDefaults(&declared, &db); got != tc.equal {
+			t.Errorf("EqualDefaults(%q, %q) = %v, want %v (canonical %q vs %q)",
+				tc.declared, tc.db, got, tc.equal, CanonicalDefault(tc.declared), CanonicalDefault(tc.db))
+		}
+	}
+}
+
+func TestEqualDefaults_MissingIsNull(t *testing.T) {
+	t.Parallel()
+
+	null, now := "NULL", "now()"
+	if !EqualDefaults(nil, &null) {
+		t.Error("a missing default must equal DEFAULT NULL")
+	}
+	if EqualDefaults(nil, &now) {
+		t.Error("a missing default must differ from now()")
+	}
+}
@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// IdentifierPolicy decides how declared table and column names map to
+// database identifiers. Generated SQL always quotes identifiers, so the
+// mapped names are used exactly.
+type IdentifierPolicy string
+
+const (
+	// IdentifiersPreserve uses names as declared; "UserID" stays "UserID"
+	// and is compared case-sensitively.
+	IdentifiersPreserve IdentifierPolicy = "preserve"
+	// IdentifiersLower folds names to lower case, like unquoted Postgres
+	// identifiers: "UserID" becomes "userid".
+	IdentifiersLower IdentifierPolicy = "lower"
+	// IdentifiersSnakeCase converts names to snake_case: "UserID" becomes
+	// "user_id".
+	IdentifiersSnakeCase IdentifierPolicy = "snake_case"
+)
+
+// ParseIdentifierPolicy validates a configured policy; empty means
+// IdentifiersPreserve.
+func ParseIdentifierPolicy(s string) (IdentifierPolicy, error) {
+	switch p := IdentifierPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return IdentifiersPreserve, nil
+	case IdentifiersPreserve, IdentifiersLower, IdentifiersSnakeCase:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown identifier policy %q, expected %q, %q or %q",
+			s, IdentifiersPreserve, IdentifiersLower, IdentifiersSnakeCase)
+	}
+}
+
+// Ident maps one declared name. Schema-qualified names are mapped part by
+// part.
+func (p IdentifierPolicy) Ident(name string) string {
+	switch p {
+	case IdentifiersLower:
+		return strings.ToLower(name)
+	case IdentifiersSnakeCase:
+		parts := strings.Split(name, ".")
+		for i, part := range parts {
+			parts[i] = toSnakeCase(part)
+		}
+		return strings.Join(parts, ".")
+	default:
+		return name
+	}
+}
+
+var plainIdentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Apply maps the table name, column names, foreign key references and
+// plain index columns of s. Index columns that are expressions, and
+// explicit constraint, index and check names, are left alone.
+func (p IdentifierPolicy) Apply(s TableSchema) TableSchema {
+	if p == "" || p == IdentifiersPreserve {
+		return s
+	}
+
+	out := s
+	out.TableName = p.Ident(s.TableName)
+	if s.Like != "" {
+		out.Like = p.Ident(s.Like)
+	}
+	if len(s.Inherits) > 0 {
+		out.Inherits = make([]string, len(s.Inherits))
+		for i, parent := range s.Inherits {
+			out.Inherits[i] = p.Ident(parent)
+		}
+	}
+
+	out.Columns = make([]ColumnMeta, len(s.Columns))
+	for i, c := range s.Columns {
+		c.ColumnName = p.Ident(c.ColumnName)
+		if fk := c.Attrs.ForeignKey; fk != nil {
+			mapped := *fk
+			mapped.Table = p.Ident(fk.Table)
+			mapped.Column = p.Ident(fk.Column)
+			c.Attrs.ForeignKey = &mapped
+		}
+		out.Columns[i] = c
+	}
+
+	out.Indexes = make([]IndexMeta, len(s.Indexes))
+	for i, idx := range s.Indexes {
+		cols := make([]string, len(idx.Columns))
+		for j, col := range idx.Columns {
+			if plainIdentRe.MatchString(col) {
+				col = p.Ident(col)
+			}
+			cols[j] = col
+		}
+		idx.Columns = cols
+		out.Indexes[i] = idx
+	}
+	return out
+}
+
+// toSnakeCase converts CamelCase and mixedCase names, keeping acronyms
+// together: "HTTPServer" becomes "http_server", "UserID" becomes "user_id".
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			prevUpper := i > 0 && unicode.IsUpper(runes[i-1])
+			if i > 0 && runes[i-1] != '_' && (prevLower || (prevUpper && nextLower)) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ApplyEntity maps the table and column names of e, for code that works on
+// discovered entities rather than built schemas.
+func (p IdentifierPolicy) ApplyEntity(e EntityInfo) EntityInfo {
+	if p == "" || p == IdentifiersPreserve {
+		return e
+	}
+	out := e
+	out.TableName = p.Ident(e.TableName)
+	out.Fields = make([]FieldInfo, len(e.Fields))
+	for i, f := range e.Fields {
+		f.ColumnName = p.Ident(f.ColumnName)
+		out.Fields[i] = f
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package migrate
+
+import "testing"
+
+func TestIdentifierPolicyIdent(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		policy IdentifierPolicy
+		in     string
+		want   string
+	}{
+		{IdentifiersPreserve, "UserID", "UserID"},
+		{IdentifiersLower, "UserID", "userid"},
+		{IdentifiersSnakeCase, "UserID", "user_id"},
+		{IdentifiersSnakeCase, "HTTPServer", "http_server"},
+		{IdentifiersSnakeCase, "userProfiles", "user_profiles"},
+		{IdentifiersSnakeCase, "already_snake", "already_snake"},
+		{IdentifiersSnakeCase, "Address2Line", "address2_line"},
+		{IdentifiersSnakeCase, "Public.UserProfiles", "public.user_profiles"},
+	}
+
+	for _, tc := range cases {
+		if got := tc.policy.Ident(tc.in); got != tc.want {
+			t.Errorf("%s.Ident(%q) = %q, want %q", tc.policy, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestIdentifierPolicyApply(t *testing.T) {
+	t.Parallel()
+
+	s := TableSchema{
+		TableName: "UserProfiles",
+		Columns: []ColumnMeta{
+			{ColumnName: "ID", Attrs: ColumnAttributes{IsPK: true}},
+			{ColumnName: "OwnerID", Attrs: ColumnAttributes{ForeignKey: &ForeignKey{Table: "Accounts", Column: "ID"}}},
+		},
+		Indexes: []IndexMeta{{Name: "IdxOwner", Columns: []string{"OwnerID", "lower(Email)"}}},
+	}
+
+	got := IdentifiersSnakeCase.Apply(s)
+	if got.TableName != "user_profiles" || got.Columns[1].ColumnName != "owner_id" {
+		t.Fatalf("unexpected names: %s.%s", got.TableName, got.Columns[1].ColumnName)
+	}
+	if fk := got.Columns[1].Attrs.ForeignKey; fk.Table != "accounts" || fk.Column != "id" {
+		t.Fatalf("unexpected reference %s(%s)", fk.Table, fk.Column)
+	}
+	if idx := got.Indexes[0]; idx.Name != "IdxOwner" || idx.Columns[0] != "owner_id" || idx.Columns[1] != "lower(Email)" {
+		t.Fatalf("unexpected index %+v", idx)
+	}
+	if s.Columns[1].Attrs.ForeignKey.Table != "Accounts" || s.TableName != "UserProfiles" {
+		t.Fatal("Apply must not modify its argument")
+	}
+	if IdentifiersPreserve.Apply(s).TableName != "UserProfiles" {
+		t.Fatal("preserve must keep names")
+	}
+}
+
+func TestParseIdentifierPolicy(t *testing.T) {
+	t.Parallel()
+
+	if p, err := ParseIdentifierPolicy(""); err != nil || p != IdentifiersPreserve {
+		t.Fatalf("empty policy = %q, %v", p, err)
+	}
+	if p, err := ParseIdentifierPolicy("Snake_Case"); err != nil || p != IdentifiersSnakeCase {
+		t.Fatalf("snake_case policy = %q, %v", p, err)
+	}
+	if _, err := ParseIdentifierPolicy("camel"); err == nil {
+		t.Fatal("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Untagged reports whether a field has none of the tags of priority, so it
+// is neither declared a column nor excluded. A json tag without a name
+// counts as missing, as in ColumnTag.
+func Untagged(rawTag string, priority []string) bool {
+	st := reflect.StructTag(rawTag)
+	for _, key := range priority {
+		value, present := st.Lookup(key)
+		if present && (key != TagJSON || strings.Split(value, ",")[0] != "") {
+			return false
+		}
+	}
+	return true
+}
+
+// InferColumnTag returns db tag options for an untagged field: the
+// snake_case field name and the Postgres type of goType, as written in the
+// source. Pointers and sql.Null* types are nullable, other fields NOT NULL.
+// ok is false for types without an obvious column type, such as structs of
+// the application or interfaces.
+func InferColumnTag(fieldName, goType string) (tag string, ok bool) {
+	nullable := false
+	if t, isPtr := strings.CutPrefix(goType, "*"); isPtr {
+		goType, nullable = t, true
+	}
+	if t, isNull := nullTypes[goType]; isNull {
+		goType, nullable = t, true
+	}
+
+	pgType, ok := inferredTypes[goType]
+	if !ok {
+		elem, isSlice := strings.CutPrefix(goType, "[]")
+		if !isSlice || elem == "byte" {
+			return "", false
+		}
+		if pgType, ok = inferredTypes[elem]; !ok || strings.HasSuffix(pgType, "[]") || pgType == "jsonb" {
+			return "", false
+		}
+		pgType += "[]"
+	}
+
+	opts := []string{toSnakeCase(fieldName), "type=" + pgType}
+	if !nullable {
+		opts = append(opts, "notnull")
+	}
+	return strings.Join(opts, ","), true
+}
+
+// nullTypes maps database/sql null wrappers to the type they wrap.
+var nullTypes = map[string]string{
+	"sql.NullString":  "string",
+	"sql.NullInt16":   "int16",
+	"sql.NullInt32":   "int32",
+	"sql.NullInt64":   "int64",
+	"sql.NullFloat64": "float64",
+	"sql.NullBool":    "bool",
+	"sql.NullTime":    "time.Time",
+	"sql.NullByte":    "uint8",
+}
+
+// inferredTypes maps Go types to column types; it is the inverse of the
+// mapping gen models uses.
+var inferredTypes = map[string]string{
+	"string":                 "text",
+	"bool":                   "boolean",
+	"int":                    "bigint",
+	"int64":                  "bigint",
+	"int32":                  "integer",
+	"rune":                   "integer",
+	"int16":                  "smallint",
+	"int8":                   "smallint",
+	"uint":                   "bigint",
+	"uint64":                 "bigint",
+	"uint32":                 "bigint",
+	"uint16":                 "integer",
+	"uint8":                  "smallint",
+	"float64":                "double precision",
+	"float32":                "real",
+	"time.Time":              "timestamptz",
+	"time.Duration":          "interval",
+	"[]byte":                 "bytea",
+	"json.RawMessage":        "jsonb",
+	"jsontext.Value":         "jsonb", // json.RawMessage under encoding/json/v2
+	"map[string]any":         "jsonb",
+	"map[string]interface{}": "jsonb",
+	"map[string]string":      "jsonb",
+	"uuid.UUID":              "uuid",
+	"decimal.Decimal":        "numeric",
+	"net.IP":                 "inet",
+	"netip.Addr":             "inet",
+	"netip.Prefix":           "cidr",
+}
@@ -0,0 +1,51 @@
+package migrate
+
+import "testing"
+
+func TestInferColumnTag(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		field, goType string
+		want          string
+		ok            bool
+	}{
+		{"Name", "string", "name,type=text,notnull", true},
+		{"CreatedAt", "time.Time", "created_at,type=timestamptz,notnull", true},
+		{"DeletedAt", "*time.Time", "deleted_at,type=timestamptz", true},
+		{"Nickname", "sql.NullString", "nickname,type=text", true},
+		{"UserID", "uuid.UUID", "user_id,type=uuid,notnull", true},
+		{"Tags", "[]string", "tags,type=text[],notnull", true},
+		{"Avatar", "[]byte", "avatar,type=bytea,notnull", true},
+		{"Meta", "map[string]any", "meta,type=jsonb,notnull", true},
+		{"Owner", "User", "", false},
+		{"Handler", "func()", "", false},
+		{"Items", "[]Item", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := InferColumnTag(tt.field, tt.goType)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("InferColumnTag(%s, %s) = %q, %v, want %q, %v", tt.field, tt.goType, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUntagged(t *testing.T) {
+	t.Parallel()
+
+	priority := []string{TagDB, TagJSON}
+	for tag, want := range map[string]bool{
+		``:                        true,
+		`json:",omitempty"`:       true,
+		`yaml:"name"`:             true,
+		`db:"-"`:                  false,
+		`json:"name"`:             false,
+		`db:",embed_prefix=a_"`:   false,
+		`gorm:"column:name"`:      true,
+		`db:"name" gorm:"column"`: false,
+	} {
+		if got := Untagged(tag, priority); got != want {
+			t.Errorf("Untagged(%s) = %v, want %v", tag, got, want)
+		}
+	}
+}
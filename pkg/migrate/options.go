@@ -0,0 +1,61 @@
+package migrate
+
+import "reflect"
+
+// TableOptions are settings of an entity's table beyond its columns. An
+// entity declares them by implementing TableOptioner:
+//
+//	func (Event) TableOptions() migrate.TableOptions {
+//		return migrate.TableOptions{Storage: []string{"fillfactor=70"}}
+//	}
+//
+// Discovery reads the method from source, so its body must be a single
+// return of a TableOptions literal with constant values.
+type TableOptions struct {
+	// Storage holds storage parameters as "key=value", e.g. "fillfactor=70"
+	// or "autovacuum_vacuum_scale_factor=0.05".
+	Storage []string
+
+	// Tablespace is the tablespace the table is created in; empty is the
+	// database default.
+	Tablespace string
+
+	// Like names a template table: the table is created with
+	// LIKE template INCLUDING ALL, and only what its columns add to the
+	// template's is generated after it. Like matters only when the table is
+	// created, and only when the template is an entity too.
+	Like string
+
+	// Inherits names the parent tables of the table (INHERITS).
+	Inherits []string
+
+	// SoftDelete marks rows deleted by setting a SoftDeleteColumn instead
+	// of removing them. The column is added when the entity does not
+	// declare it, and unique columns and unique indexes become unique
+	// among the rows that are not deleted.
+	SoftDelete bool
+
+	// Audited records every change of a row in a companion <table>_audit
+	// table, written by a trigger (see schema.AuditTable).
+	Audited bool
+}
+
+// SoftDeleteColumn is the timestamptz column soft-deleted rows have set.
+const SoftDeleteColumn = "deleted_at"
+
+// NotDeleted is the predicate matching rows that are not soft-deleted.
+const NotDeleted = SoftDeleteColumn + " IS NULL"
+
+// TableOptioner is implemented by entity types that declare TableOptions.
+type TableOptioner interface {
+	TableOptions() TableOptions
+}
+
+// reflectOptions returns the TableOptions of the struct type typ, declared
+// with a value or pointer receiver.
+func reflectOptions(typ reflect.Type) TableOptions {
+	if o, ok := reflect.New(typ).Interface().(TableOptioner); ok {
+		return o.TableOptions()
+	}
+	return TableOptions{}
+}
@@ -0,0 +1,227 @@
+package migrate
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var registered = struct {
+	sync.Mutex
+	types map[string]registration
+}{types: map[string]registration{}}
+
+type registration struct {
+	typ  reflect.Type
+	opts []RegisterOption
+}
+
+// RegisterOption sets TableOptions of one registered table, overriding what
+// its type declares. It lets tables sharing a type differ, like the monthly
+// tables of an audit log created from the same template.
+type RegisterOption func(*TableOptions)
+
+// Like creates the table with LIKE template INCLUDING ALL (see
+// TableOptions.Like).
+func Like(template string) RegisterOption {
+	return func(o *TableOptions) { o.Like = template }
+}
+
+// Inherits makes the table inherit from parents (see TableOptions.Inherits).
+func Inherits(parents ...string) RegisterOption {
+	return func(o *TableOptions) { o.Inherits = parents }
+}
+
+// Register adds the struct type T as the entity of table, for programs that
+// run migrateme themselves (see pkg/cli) instead of having it discover
+// entities in source. Columns are read from T by reflection, with the same
+// tags and rules discovery applies, so T needs no table comment and does
+// not have to be under entity_paths. Registering a table again replaces its
+// type. Register panics when T is not a struct or a pointer to one.
+//
+//	migrate.Register[AuditLog]("audit_log")
+//	migrate.Register[AuditLog]("audit_log_2026_01", migrate.Like("audit_log"))
+func Register[T any](table string, opts ...RegisterOption) {
+	typ := reflect.TypeFor[T]()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("migrate.Register: %s is not a struct", typ))
+	}
+
+	registered.Lock()
+	defer registered.Unlock()
+	registered.types[table] = registration{typ: typ, opts: opts}
+}
+
+// RegisteredEntities returns the entities of registered types, sorted by
+// table. Columns are read from the tags of priority, DefaultTagPriority when
+// empty; with infer, exported untagged fields are columns as well (see
+// InferColumnTag).
+func RegisteredEntities(priority []string, infer bool) []EntityInfo {
+	registered.Lock()
+	defer registered.Unlock()
+
+	out := make([]EntityInfo, 0, len(registered.types))
+	for table, r := range registered.types {
+		e := ReflectEntity(r.typ, table, priority, infer)
+		for _, opt := range r.opts {
+			opt(&e.Options)
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TableName < out[j].TableName })
+	return out
+}
+
+// ReflectEntity returns the entity of table declared by the struct type typ,
+// or a pointer to it, reading columns as RegisteredEntities does, and its
+// TableOptions when it implements TableOptioner. Entities built by
+// reflection have no source position and no comment directives.
+func ReflectEntity(typ reflect.Type, table string, priority []string, infer bool) EntityInfo {
+	if len(priority) == 0 {
+		priority = DefaultTagPriority
+	}
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	pkgName := typ.PkgPath()
+	if i := strings.LastIndex(pkgName, "/"); i >= 0 {
+		pkgName = pkgName[i+1:]
+	}
+	e := EntityInfo{
+		StructName:  typ.Name(),
+		TableName:   table,
+		PackageName: pkgName,
+		Indexes:     []IndexMeta{},
+		Checks:      []CheckMeta{},
+	}
+	if typ.Kind() == reflect.Struct {
+		e.Fields = reflectFields(typ, priority, infer, map[reflect.Type]bool{typ: true})
+		e.Options = reflectOptions(typ)
+	}
+	return e
+}
+
+// reflectFields is the reflection counterpart of discovery.ExpandFields:
+// embedded structs and fields with embed_prefix= are expanded unless
+// excluded, and declared columns override inherited ones.
+func reflectFields(typ reflect.Type, priority []string, infer bool, visiting map[reflect.Type]bool) []FieldInfo {
+	var entries []FieldEntry
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		rawTag := string(f.Tag)
+		db := LookupTag(rawTag, TagDB)
+		prefix, hasPrefix := TagOption(db, "embed_prefix")
+
+		if (f.Anonymous || hasPrefix) && !Excluded(db) {
+			if st := structOf(f.Type); st != nil {
+				if visiting[st] {
+					continue
+				}
+				visiting[st] = true
+				for _, inner := range reflectFields(st, priority, infer, visiting) {
+					inner.ColumnName = prefix + inner.ColumnName
+					if !f.Anonymous {
+						inner.FieldName = f.Name + "." + inner.FieldName
+					}
+					entries = append(entries, FieldEntry{Field: inner, Inherited: true})
+				}
+				delete(visiting, st)
+				continue
+			}
+		}
+		if f.Anonymous {
+			continue
+		}
+
+		goType := goTypeString(f.Type)
+		tag, isColumn := ColumnTag(rawTag, f.Name, priority)
+		if !isColumn && infer && f.IsExported() && Untagged(rawTag, priority) {
+			tag, isColumn = InferColumnTag(f.Name, goType)
+		}
+		if isColumn {
+			entries = append(entries, FieldEntry{Field: FieldInfo{
+				FieldName:  f.Name,
+				ColumnName: TagName(tag),
+				RawTag:     rawTag,
+				Tag:        tag,
+				GoType:     goType,
+			}})
+		}
+	}
+	return ResolveFields(entries)
+}
+
+// structOf returns the struct type of t, behind any pointers, or nil.
+func structOf(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// goTypeString writes t the way it is written in source, which is how
+// discovery records field types.
+func goTypeString(t reflect.Type) string {
+	switch {
+	case t.Kind() == reflect.Pointer && t.Name() == "":
+		return "*" + goTypeString(t.Elem())
+	case t.Kind() == reflect.Slice && t.Name() == "":
+		if t.Elem() == reflect.TypeFor[byte]() {
+			return "[]byte"
+		}
+		return "[]" + goTypeString(t.Elem())
+	}
+	return strings.ReplaceAll(t.String(), "interface {}", "interface{}")
+}
+
+// FieldEntry is a field of a struct being expanded: declared in the struct,
+// or inherited from a struct embedded in it.
+type FieldEntry struct {
+	Field     FieldInfo
+	Inherited bool
+}
+
+// ResolveFields returns the fields of a struct from its expanded entries. A
+// column declared directly in the struct overrides the inherited column of
+// the same name, at the inherited position, the way Go field promotion
+// resolves the shadowed field. Idx is renumbered.
+func ResolveFields(entries []FieldEntry) []FieldInfo {
+	own := make(map[string]FieldInfo)
+	inherited := make(map[string]bool)
+	for _, e := range entries {
+		if e.Inherited {
+			inherited[e.Field.ColumnName] = true
+		} else if _, ok := own[e.Field.ColumnName]; !ok {
+			own[e.Field.ColumnName] = e.Field
+		}
+	}
+	var out []FieldInfo
+	placed := make(map[string]bool)
+	for _, e := range entries {
+		name := e.Field.ColumnName
+		f, overridden := own[name]
+		switch {
+		case e.Inherited && overridden:
+			if !placed[name] {
+				out = append(out, f)
+				placed[name] = true
+			}
+		case !e.Inherited && inherited[name]:
+			// Placed at the inherited position.
+		default:
+			out = append(out, e.Field)
+		}
+	}
+	for i := range out {
+		out[i].Idx = i
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package migrate
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type registeredBase struct {
+	ID        string    `db:"id,pk,type=uuid"`
+	CreatedAt time.Time `db:"created_at,type=timestamp"`
+}
+
+type registeredAddress struct {
+	City string `db:"city"`
+}
+
+type registeredOrder struct {
+	*registeredBase
+	Billing   registeredAddress `db:",embed_prefix=billing_"`
+	Audit     registeredAddress `db:"-"`
+	Total     int               `db:"total"`
+	Cache     string            `db:"cache,transient"`
+	CreatedAt time.Time         `db:"created_at,type=timestamptz"`
+	Note      *string
+	Meta      json.RawMessage
+	Payload   []byte
+	Deleted   sql.NullTime
+	internal  string
+}
+
+func (*registeredOrder) TableOptions() TableOptions {
+	return TableOptions{Storage: []string{"fillfactor=70"}}
+}
+
+func registeredEntity(t *testing.T, table string, infer bool) EntityInfo {
+	t.Helper()
+	for _, e := range RegisteredEntities(nil, infer) {
+		if e.TableName == table {
+			return e
+		}
+	}
+	t.Fatalf("table %s is not registered", table)
+	return EntityInfo{}
+}
+
+func TestRegister(t *testing.T) {
+	Register[*registeredOrder]("registered_orders")
+
+	e := registeredEntity(t, "registered_orders", false)
+	if e.StructName != "registeredOrder" || e.PackageName != "migrate" {
+		t.Errorf("entity = %s in %s", e.StructName, e.PackageName)
+	}
+	var got []string
+	for i, f := range e.Fields {
+		if f.Idx != i {
+			t.Errorf("%s has idx %d, want %d", f.FieldName, f.Idx, i)
+		}
+		got = append(got, f.FieldName+":"+f.ColumnName+":"+f.Tag)
+	}
+	want := []string{
+		"ID:id:id,pk,type=uuid",
+		"CreatedAt:created_at:created_at,type=timestamptz",
+		"Billing.City:billing_city:city",
+		"Total:total:total",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("fields = %q, want %q", got, want)
+	}
+	if len(e.Options.Storage) != 1 || e.Options.Storage[0] != "fillfactor=70" {
+		t.Errorf("options = %+v", e.Options)
+	}
+
+	e = registeredEntity(t, "registered_orders", true)
+	got = got[:0]
+	for _, f := range e.Fields[4:] {
+		got = append(got, f.Tag)
+	}
+	want = []string{
+		"note,type=text",
+		"meta,type=jsonb,notnull",
+		"payload,type=bytea,notnull",
+		"deleted,type=timestamptz",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("inferred = %q, want %q", got, want)
+	}
+	if e.Fields[4].GoType != "*string" || e.Fields[6].GoType != "[]byte" {
+		t.Errorf("types = %s, %s", e.Fields[4].GoType, e.Fields[6].GoType)
+	}
+}
+
+func TestRegister_Options(t *testing.T) {
+	Register[*registeredOrder]("registered_orders_2026_01", Like("registered_orders"), Inherits("orders_base"))
+
+	e := registeredEntity(t, "registered_orders_2026_01", false)
+	if e.Options.Like != "registered_orders" || strings.Join(e.Options.Inherits, ",") != "orders_base" {
+		t.Errorf("options = %+v", e.Options)
+	}
+	if len(e.Options.Storage) != 1 {
+		t.Errorf("storage declared by the type is lost: %+v", e.Options)
+	}
+}
+
+func TestRegister_NotAStruct(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	Register[string]("registered_strings")
+}
+
+func TestResolveFields(t *testing.T) {
+	t.Parallel()
+
+	got := ResolveFields([]FieldEntry{
+		{Field: FieldInfo{FieldName: "Base.ID", ColumnName: "id"}, Inherited: true},
+		{Field: FieldInfo{FieldName: "Base.Name", ColumnName: "name"}, Inherited: true},
+		{Field: FieldInfo{FieldName: "Total", ColumnName: "total"}},
+		{Field: FieldInfo{FieldName: "ID", ColumnName: "id"}},
+	})
+	var names []string
+	for i, f := range got {
+		if f.Idx != i {
+			t.Errorf("%s has idx %d, want %d", f.FieldName, f.Idx, i)
+		}
+		names = append(names, f.FieldName)
+	}
+	if want := "ID Base.Name Total"; strings.Join(names, " ") != want {
+		t.Errorf("fields = %q, want %q", names, want)
+	}
+}
@@ -0,0 +1,142 @@
+package migrate
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// TagLiteral returns the text of a struct tag as written in source, e.g. the
+// Value of an ast.BasicLit: a raw string in backquotes or an interpreted
+// string in double quotes, with its escapes resolved.
+func TagLiteral(lit string) string {
+	if s, err := strconv.Unquote(lit); err == nil {
+		return s
+	}
+	return strings.Trim(lit, "`")
+}
+
+// LookupTag returns the value of key in a struct tag, following
+// reflect.StructTag: keys are separated by spaces, and values are Go string
+// literals, so escaped quotes stay part of the value.
+func LookupTag(rawTag, key string) string {
+	return reflect.StructTag(rawTag).Get(key)
+}
+
+// TagName returns the column name of db tag options, e.g. "id" of
+// "id,pk,type=uuid".
+func TagName(tag string) string {
+	return strings.TrimSpace(SplitTagOptions(tag)[0])
+}
+
+// TagOption returns the value of a key=value option of db tag options.
+func TagOption(tag, key string) (string, bool) {
+	for _, p := range SplitTagOptions(tag)[1:] {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(p), key+"="); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// UUIDDefault is the default of pk_uuid columns.
+const UUIDDefault = "gen_random_uuid()"
+
+// ParseColumnTag reads db tag options, e.g. "id,pk,type=uuid". Discovery,
+// the schema builder and tag checks all read tags through it, so they agree
+// on what a tag declares. Spaces around options are ignored.
+//
+// pk_uuid is shorthand for pk,type=uuid,default=gen_random_uuid(); an
+// explicit type= or default= wins.
+func ParseColumnTag(tag string) ColumnAttributes {
+	attrs := ColumnAttributes{}
+
+	if tag == "" || Excluded(tag) {
+		return attrs
+	}
+
+	uuidPK := false
+	for _, p := range SplitTagOptions(tag)[1:] {
+		p = strings.TrimSpace(p)
+		switch {
+		case p == "pk":
+			attrs.IsPK = true
+			attrs.NotNull = true
+		case p == "pk_uuid":
+			attrs.IsPK = true
+			attrs.NotNull = true
+			uuidPK = true
+		case p == "notnull":
+			attrs.NotNull = true
+		case p == "unique":
+			attrs.Unique = true
+		case p == "nulls_not_distinct":
+			attrs.NullsNotDistinct = true
+		case p == "ci":
+			attrs.CaseInsensitive = true
+
+		case strings.HasPrefix(p, "type="):
+			attrs.PgType = strings.TrimPrefix(p, "type=")
+
+		case strings.HasPrefix(p, "anon="):
+			if r, err := ParseAnonRule(strings.TrimPrefix(p, "anon=")); err == nil {
+				attrs.Anon = r
+			}
+
+		case strings.HasPrefix(p, "default="):
+			v := strings.TrimPrefix(p, "default=")
+			attrs.Default = &v
+
+		case strings.HasPrefix(p, "fk="):
+			ref := strings.TrimPrefix(p, "fk=")
+			parts := strings.Split(ref, ".")
+			if len(parts) == 2 {
+				attrs.ForeignKey = &ForeignKey{
+					Table:  parts[0],
+					Column: parts[1],
+				}
+			}
+
+		case strings.HasPrefix(p, "delete="):
+			if attrs.ForeignKey != nil {
+				attrs.ForeignKey.OnDelete, attrs.ForeignKey.OnDeleteColumns = ParseAction(strings.TrimPrefix(p, "delete="))
+			}
+
+		case strings.HasPrefix(p, "update="):
+			if attrs.ForeignKey != nil {
+				attrs.ForeignKey.OnUpdate, _ = ParseAction(strings.TrimPrefix(p, "update="))
+			}
+
+		case strings.HasPrefix(p, "match="):
+			if attrs.ForeignKey != nil {
+				attrs.ForeignKey.Match = MatchType(strings.ToUpper(strings.TrimPrefix(p, "match=")))
+			}
+
+		case p == "deferrable":
+			if attrs.ForeignKey != nil {
+				attrs.ForeignKey.Deferrable = true
+			}
+
+		case p == "initially_deferred":
+			if attrs.ForeignKey != nil {
+				attrs.ForeignKey.Deferrable = true
+				attrs.ForeignKey.InitiallyDeferred = true
+			}
+		}
+	}
+
+	if uuidPK {
+		if attrs.PgType == "" {
+			attrs.PgType = "uuid"
+		}
+		if attrs.Default == nil {
+			v := UUIDDefault
+			attrs.Default = &v
+		}
+	}
+	if attrs.PgType == "" {
+		attrs.PgType = "text"
+	}
+
+	return attrs
+}
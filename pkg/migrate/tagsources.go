@@ -0,0 +1,212 @@
+package migrate
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Struct tags columns can be read from, besides db. Tags of other ORMs are
+// translated into db tag syntax, so models tagged for them can be migrated
+// without re-tagging.
+const (
+	TagDB   = "db"
+	TagBun  = "bun"
+	TagGorm = "gorm"
+	TagJSON = "json"
+)
+
+// DefaultTagPriority reads columns from db tags only.
+var DefaultTagPriority = []string{TagDB}
+
+var tagTranslators = map[string]func(value, fieldName string) (string, bool){
+	TagDB:   translateDBTag,
+	TagBun:  translateBunTag,
+	TagGorm: translateGormTag,
+	TagJSON: translateJSONTag,
+}
+
+// ParseTagPriority validates a configured tag priority list; empty means
+// DefaultTagPriority.
+func ParseTagPriority(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return DefaultTagPriority, nil
+	}
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := tagTranslators[name]; !ok {
+			return nil, fmt.Errorf("unknown entity tag %q, expected %q, %q, %q or %q", name, TagDB, TagBun, TagGorm, TagJSON)
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
+
+// ColumnTag returns the column options of a struct field in db tag syntax,
+// e.g. "id,pk,type=uuid", read from the first tag of priority the field has.
+// ok is false when the field is not a column: it has none of the tags, or
+// the first one excludes it ("-", or a relation in bun and gorm). A json tag
+// without a name does not count, since it only carries options.
+func ColumnTag(rawTag, fieldName string, priority []string) (tag string, ok bool) {
+	st := reflect.StructTag(rawTag)
+	for _, key := range priority {
+		value, present := st.Lookup(key)
+		if !present {
+			continue
+		}
+		if key == TagJSON && strings.Split(value, ",")[0] == "" {
+			continue
+		}
+		return tagTranslators[key](value, fieldName)
+	}
+	return "", false
+}
+
+func translateDBTag(value, _ string) (string, bool) {
+	if TagName(value) == "" || Excluded(value) {
+		return "", false
+	}
+	return value, true
+}
+
+// Excluded reports whether db tag options keep a field out of the table:
+// db:"-", or the transient option for in-memory fields such as caches and
+// derived values (db:"total,transient").
+func Excluded(tag string) bool {
+	parts := SplitTagOptions(tag)
+	if strings.TrimSpace(parts[0]) == "-" {
+		return true
+	}
+	for _, p := range parts[1:] {
+		if strings.TrimSpace(p) == "transient" {
+			return true
+		}
+	}
+	return false
+}
+
+func translateJSONTag(value, _ string) (string, bool) {
+	name := strings.Split(value, ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	return name, true
+}
+
+// translateBunTag reads bun:"name,pk,notnull,unique,type:uuid,default:now()".
+// An empty name is the snake_case field name, as in bun; scanonly fields
+// are transient.
+func translateBunTag(value, fieldName string) (string, bool) {
+	parts := SplitTagOptions(value)
+	name := parts[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = toSnakeCase(fieldName)
+	}
+
+	opts := []string{name}
+	var typ string
+	autoincrement := false
+	for _, p := range parts[1:] {
+		key, val, _ := strings.Cut(p, ":")
+		switch key {
+		case "pk", "notnull", "unique":
+			if val == "" {
+				opts = append(opts, key)
+			}
+		case "type":
+			typ = val
+		case "default":
+			opts = append(opts, "default="+val)
+		case "autoincrement":
+			autoincrement = true
+		case "rel", "m2m", "join", "scanonly":
+			return "", false
+		}
+	}
+	if typ == "" && autoincrement {
+		typ = "bigserial"
+	}
+	if typ != "" {
+		opts = append(opts, "type="+typ)
+	}
+	return strings.Join(opts, ","), true
+}
+
+// translateGormTag reads gorm:"column:id;primaryKey;type:uuid;not null;
+// unique;default:now()". Keys are case-insensitive; without column the name
+// is the snake_case field name, as in gorm's default naming strategy.
+func translateGormTag(value, fieldName string) (string, bool) {
+	name := toSnakeCase(fieldName)
+	var opts []string
+	var typ, size string
+	autoincrement := false
+	for _, p := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(strings.TrimSpace(p), ":")
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "-":
+			return "", false
+		case "column":
+			name = val
+		case "primarykey", "primary_key":
+			opts = append(opts, "pk")
+		case "not null", "notnull":
+			opts = append(opts, "notnull")
+		case "unique", "uniqueindex":
+			opts = append(opts, "unique")
+		case "type":
+			typ = val
+		case "size":
+			size = val
+		case "default":
+			opts = append(opts, "default="+val)
+		case "autoincrement":
+			autoincrement = val == "" || strings.EqualFold(val, "true")
+		case "foreignkey", "references", "many2many", "polymorphic", "embedded":
+			return "", false
+		}
+	}
+	switch {
+	case typ != "":
+	case autoincrement:
+		typ = "bigserial"
+	case size != "":
+		typ = "varchar(" + size + ")"
+	}
+	if typ != "" {
+		opts = append(opts, "type="+typ)
+	}
+	return strings.Join(append([]string{name}, opts...), ","), true
+}
+
+// SplitTagOptions splits a db tag at commas outside parentheses and quotes,
+// so that type=numeric(10,2) or using=coalesce(a, 0) stay one option.
+func SplitTagOptions(raw string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		case c == ',' && depth == 0:
+			parts = append(parts, raw[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, raw[start:])
+}
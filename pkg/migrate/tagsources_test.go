@@ -0,0 +1,134 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestColumnTag(t *testing.T) {
+	t.Parallel()
+
+	all := []string{TagDB, TagBun, TagGorm, TagJSON}
+	tests := []struct {
+		name     string
+		tag      string
+		field    string
+		priority []string
+		want     string
+		ok       bool
+	}{
+		{"db", `db:"id,pk,type=uuid" json:"uuid"`, "ID", all, "id,pk,type=uuid", true},
+		{"db only by default", `json:"email"`, "Email", DefaultTagPriority, "", false},
+		{"db excludes", `db:"-" json:"cache"`, "Cache", all, "", false},
+		{"db transient", `db:"total,type=numeric,transient" json:"total"`, "Total", all, "", false},
+		{"bun scanonly", `bun:"total,scanonly"`, "Total", all, "", false},
+		{"priority order", `db:"id" json:"uuid"`, "ID", []string{TagJSON, TagDB}, "uuid", true},
+		{"bun", `bun:"id,pk,type:numeric(10,2),notnull,default:0"`, "ID", all, "id,pk,notnull,default=0,type=numeric(10,2)", true},
+		{"bun field name", `bun:",pk,autoincrement"`, "UserID", all, "user_id,pk,type=bigserial", true},
+		{"bun relation", `bun:"rel:belongs-to,join:user_id=id"`, "User", all, "", false},
+		{"gorm", `gorm:"column:uid;primaryKey;type:uuid;not null;default:gen_random_uuid()"`, "ID", all, "uid,pk,notnull,default=gen_random_uuid(),type=uuid", true},
+		{"gorm field name and size", `gorm:"uniqueIndex;size:255"`, "EmailAddress", all, "email_address,unique,type=varchar(255)", true},
+		{"gorm excludes", `gorm:"-:all"`, "Cache", all, "", false},
+		{"gorm relation", `gorm:"foreignKey:UserID"`, "User", all, "", false},
+		{"json", `json:"created_at,omitempty"`, "CreatedAt", all, "created_at", true},
+		{"json without name", `json:",omitempty"`, "CreatedAt", all, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ColumnTag(tt.tag, tt.field, tt.priority)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: ColumnTag(%s) = %q, %v, want %q, %v", tt.name, tt.tag, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseTagPriority(t *testing.T) {
+	t.Parallel()
+
+	if got, err := ParseTagPriority(nil); err != nil || !reflect.DeepEqual(got, DefaultTagPriority) {
+		t.Errorf("ParseTagPriority(nil) = %v, %v", got, err)
+	}
+	if got, err := ParseTagPriority([]string{" DB", "gorm"}); err != nil || !reflect.DeepEqual(got, []string{"db", "gorm"}) {
+		t.Errorf("ParseTagPriority = %v, %v", got, err)
+	}
+	if _, err := ParseTagPriority([]string{"sqlx"}); err == nil {
+		t.Error("expected an error for an unknown tag")
+	}
+}
+
+func TestSplitTagOptions(t *testing.T) {
+	t.Parallel()
+
+	got := SplitTagOptions(`price,type=numeric(10,2),default='a,b',using=coalesce(price, 0)`)
+	want := []string{"price", "type=numeric(10,2)", "default='a,b'", "using=coalesce(price, 0)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitTagOptions = %q, want %q", got, want)
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	t.Parallel()
+
+	for tag, want := range map[string]bool{
+		"-":                          true,
+		"total,transient":            true,
+		" total , transient":         true,
+		",transient":                 true,
+		"total":                      false,
+		"total,type=numeric(10,2)":   false,
+		"note,default='transient'":   false,
+		"transient_total,type=jsonb": false,
+	} {
+		if got := Excluded(tag); got != want {
+			t.Errorf("Excluded(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestTagLiteral(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"`db:\"id,pk\"`":            `db:"id,pk"`,
+		`"db:\"id,pk\""`:            `db:"id,pk"`,
+		"`db:\"a,default='\\\"'\"`": `db:"a,default='\"'"`,
+	}
+	for lit, want := range tests {
+		if got := TagLiteral(lit); got != want {
+			t.Errorf("TagLiteral(%s) = %q, want %q", lit, got, want)
+		}
+	}
+}
+
+func TestParseColumnTag(t *testing.T) {
+	t.Parallel()
+
+	attrs := ParseColumnTag("author_id, notnull ,type=uuid, fk=users.id, delete=cascade")
+	if !attrs.NotNull || attrs.PgType != "uuid" || attrs.ForeignKey == nil ||
+		attrs.ForeignKey.Table != "users" || attrs.ForeignKey.OnDelete != "CASCADE" {
+		t.Errorf("ParseColumnTag = %+v", attrs)
+	}
+	if attrs := ParseColumnTag("price,type=numeric(10,2),default=0"); attrs.PgType != "numeric(10,2)" || *attrs.Default != "0" {
+		t.Errorf("ParseColumnTag = %+v", attrs)
+	}
+	if fk := ParseColumnTag("parent_id,fk=nodes.id,initially_deferred").ForeignKey; fk == nil || !fk.Deferrable || !fk.InitiallyDeferred {
+		t.Errorf("initially_deferred parsed as %+v", fk)
+	}
+	if attrs := ParseColumnTag("id,pk_uuid"); !attrs.IsPK || !attrs.NotNull || attrs.PgType != "uuid" || attrs.Default == nil || *attrs.Default != UUIDDefault {
+		t.Errorf("pk_uuid parsed as %+v", attrs)
+	}
+	if attrs := ParseColumnTag("id,pk_uuid,default=uuid_generate_v4()"); attrs.PgType != "uuid" || *attrs.Default != "uuid_generate_v4()" {
+		t.Errorf("pk_uuid with default= parsed as %+v", attrs)
+	}
+	if attrs := ParseColumnTag("email,anon=fake_email"); attrs.Anon != AnonFakeEmail {
+		t.Errorf("anon= parsed as %+v", attrs)
+	}
+	if attrs := ParseColumnTag("-"); attrs.PgType != "" {
+		t.Errorf("excluded tag parsed as %+v", attrs)
+	}
+	if name := TagName(" id ,pk"); name != "id" {
+		t.Errorf("TagName = %q", name)
+	}
+	if v, ok := TagOption("addr, embed_prefix=home_", "embed_prefix"); !ok || v != "home_" {
+		t.Errorf("TagOption = %q, %v", v, ok)
+	}
+}
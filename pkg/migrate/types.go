@@ -2,6 +2,7 @@ package migrate
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -10,9 +11,25 @@ type EntityInfo struct {
 	TableName  string
 	Package    string
 	FilePath   string
-	Fields     []FieldInfo
-	Indexes    []IndexMeta
-	Checks     []CheckMeta
+	// PackageName is the Go package clause of the entity file.
+	PackageName string
+	// Imports maps import names used in the entity file to import paths.
+	Imports map[string]string
+	Line    int
+	Owner   string
+	// Group is the bounded context of the entity (migrate:group), whose
+	// migrations are generated and applied separately; empty for none.
+	Group string
+	// Comment is the free text of the struct doc comment, without directives.
+	Comment string
+	Fields  []FieldInfo
+	Indexes []IndexMeta
+	Checks  []CheckMeta
+	// Options are the table settings the type declares (see TableOptioner).
+	Options TableOptions
+
+	// Ignore lists diagnostic codes suppressed by migrate:ignore annotations.
+	Ignore []string
 }
 
 type FieldInfo struct {
@@ -21,73 +38,209 @@ type FieldInfo struct {
 	Idx        int
 	ForeignKey string
 	RawTag     string
+	Ignore     []string
+	// Tag holds the column options in db tag syntax ("id,pk,type=uuid"),
+	// read from RawTag by the configured tag priority (see ColumnTag).
+	Tag string
+	// GoType is the field type as written in the entity file. It is empty for
+	// fields promoted from structs of other packages.
+	GoType string
+	// Using is the USING expression from a migrate:using field comment.
+	Using string
+	// FilePath and Line locate the field declaration, which is in another
+	// file than the entity for fields of embedded structs.
+	FilePath string
+	Line     int
 }
 
 type TableSchema struct {
-	TableName string
-	Columns   []ColumnMeta
-	Indexes   []IndexMeta
-	Checks    []CheckMeta
+	TableName string       `json:"table"`
+	Owner     string       `json:"owner,omitempty"`
+	Columns   []ColumnMeta `json:"columns"`
+	Indexes   []IndexMeta  `json:"indexes,omitempty"`
+	Checks    []CheckMeta  `json:"checks,omitempty"`
+	Ignore    []string     `json:"ignore,omitempty"`
+
+	// Storage holds table storage parameters as "key=value", like
+	// IndexMeta.With.
+	Storage []string `json:"storage,omitempty"`
+
+	// Tablespace is the table's tablespace; empty is the database default.
+	Tablespace string `json:"tablespace,omitempty"`
+
+	// Like is the template table the table is created from; see
+	// TableOptions.Like. The database does not record it.
+	Like string `json:"like,omitempty"`
+
+	// Inherits holds the parent tables of the table.
+	Inherits []string `json:"inherits,omitempty"`
+
+	// Triggers are the row-level triggers of the table.
+	Triggers []TriggerMeta `json:"triggers,omitempty"`
+}
+
+// TriggerMeta is a FOR EACH ROW trigger.
+type TriggerMeta struct {
+	Name string `json:"name"`
+	// Timing is BEFORE or AFTER.
+	Timing string `json:"timing"`
+	// Events holds INSERT, UPDATE and DELETE, in that order.
+	Events []string `json:"events"`
+	// Function is the trigger function, called without arguments.
+	Function string `json:"function"`
+	// FunctionSQL creates or replaces Function; it runs before the trigger
+	// is created. It is declared only: the database is not asked for it,
+	// and it is not compared.
+	FunctionSQL string `json:"function_sql,omitempty"`
 }
 
 type IndexMeta struct {
 	// Name is optional in code comments; when missing, the migrator will generate
 	// a deterministic name for CREATE statements.
-	Name string
+	Name string `json:"name,omitempty"`
 
 	// Columns must be in index order (composite indexes are ordered).
-	Columns []string
+	Columns []string `json:"columns"`
+
+	Unique bool    `json:"unique,omitempty"`
+	Where  *string `json:"where,omitempty"`
+
+	// Method is the index access method (btree, hash, gin, gist, ivfflat,
+	// hnsw, ...). Empty means btree.
+	Method string `json:"method,omitempty"`
+
+	// Opclasses holds a non-default operator class per column (parallel to
+	// Columns); empty entries use the column type's default.
+	Opclasses []string `json:"opclasses,omitempty"`
 
-	Unique bool
-	Where  *string
+	// With holds storage parameters as "key=value", e.g. "lists=100".
+	With []string `json:"with,omitempty"`
+
+	// Tablespace is the index's tablespace; empty is the database default.
+	Tablespace string `json:"tablespace,omitempty"`
 }
 
 type CheckMeta struct {
 	// Name is optional; if omitted, migrator generates deterministic name.
-	Name string
-	Expr string
+	Name string `json:"name,omitempty"`
+	Expr string `json:"expr"`
 }
 
 type ColumnMeta struct {
-	FieldName  string
-	ColumnName string
-	Idx        int
-	Attrs      ColumnAttributes
+	FieldName  string           `json:"field,omitempty"`
+	ColumnName string           `json:"name"`
+	Idx        int              `json:"idx"`
+	Attrs      ColumnAttributes `json:"attrs"`
+	Ignore     []string         `json:"ignore,omitempty"`
+
+	// SQLFile is a SQL fragment (from the sql= tag option) that is added to
+	// the migration which adds the column, e.g. to backfill it. It holds
+	// plain up SQL or -- +migrate Up/Down sections.
+	SQLFile string `json:"sql_file,omitempty"`
+
+	// Using is the USING expression (from the using= tag option) that
+	// converts existing values when the column type changes.
+	Using string `json:"using,omitempty"`
+
+	// FilePath and Line locate the struct field declaring the column, for
+	// diagnostics. They are unset for columns read from the database.
+	FilePath string `json:"-"`
+	Line     int    `json:"-"`
 }
 
 type OnActionType string
 
 const (
-	Cascade  OnActionType = "CASCADE"
-	SetNull  OnActionType = "SET NULL"
-	Restrict OnActionType = "RESTRICT"
-	NoAction OnActionType = "NO ACTION"
+	Cascade    OnActionType = "CASCADE"
+	SetNull    OnActionType = "SET NULL"
+	SetDefault OnActionType = "SET DEFAULT"
+	Restrict   OnActionType = "RESTRICT"
+	NoAction   OnActionType = "NO ACTION"
+)
+
+// MatchType is the MATCH clause of a foreign key.
+type MatchType string
+
+const (
+	// MatchSimple, the default, skips the check when any referencing column
+	// is NULL.
+	MatchSimple MatchType = "SIMPLE"
+	// MatchFull requires the referencing columns to be all NULL or all set.
+	MatchFull MatchType = "FULL"
 )
 
 type ForeignKey struct {
-	Table    string
-	Column   string
-	OnDelete OnActionType
-	OnUpdate OnActionType
+	Table    string       `json:"table"`
+	Column   string       `json:"column"`
+	OnDelete OnActionType `json:"on_delete,omitempty"`
+	OnUpdate OnActionType `json:"on_update,omitempty"`
+
+	// OnDeleteColumns limits a SET NULL or SET DEFAULT delete action to these
+	// columns (Postgres 15+), e.g. delete=set_null(author_id).
+	OnDeleteColumns []string `json:"on_delete_columns,omitempty"`
+
+	// Match is the MATCH clause; empty means MATCH SIMPLE.
+	Match MatchType `json:"match,omitempty"`
+
+	// Deferrable makes the constraint DEFERRABLE; InitiallyDeferred also
+	// checks it at commit by default instead of after each statement.
+	Deferrable        bool `json:"deferrable,omitempty"`
+	InitiallyDeferred bool `json:"initially_deferred,omitempty"`
 }
 
 type ColumnAttributes struct {
-	PgType         string
-	NotNull        bool
-	Unique         bool
-	IsPK           bool
-	Default        *string
-	ForeignKey     *ForeignKey
-	ConstraintName *string
+	PgType         string      `json:"type"`
+	NotNull        bool        `json:"not_null,omitempty"`
+	Unique         bool        `json:"unique,omitempty"`
+	IsPK           bool        `json:"pk,omitempty"`
+	Default        *string     `json:"default,omitempty"`
+	ForeignKey     *ForeignKey `json:"fk,omitempty"`
+	ConstraintName *string     `json:"constraint_name,omitempty"`
+
+	// NullsNotDistinct makes a unique column allow a single NULL (UNIQUE
+	// NULLS NOT DISTINCT, Postgres 15+).
+	NullsNotDistinct bool `json:"nulls_not_distinct,omitempty"`
+
+	// CaseInsensitive marks a string column compared case-insensitively
+	// (the ci tag); CaseInsensitiveMode.Apply decides how.
+	CaseInsensitive bool `json:"ci,omitempty"`
+
+	// Anon is how snapshot anonymizes the column (the anon= tag). It does
+	// not change the schema.
+	Anon AnonRule `json:"anon,omitempty"`
+
+	// Comment and Sequence are read from the database only. They are not
+	// compared, but let the down migration of a dropped column restore its
+	// comment and the sequence it owned.
+	Comment  *string       `json:"comment,omitempty"`
+	Sequence *SequenceMeta `json:"sequence,omitempty"`
+}
+
+// SequenceMeta describes a sequence owned by a column, e.g. the one behind a
+// serial column, including its position.
+type SequenceMeta struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Start     int64  `json:"start"`
+	Increment int64  `json:"increment"`
+	Min       int64  `json:"min"`
+	Max       int64  `json:"max"`
+	Cycle     bool   `json:"cycle,omitempty"`
+	// LastValue is nil when nextval has never been called.
+	LastValue *int64 `json:"last_value,omitempty"`
 }
 
 type TableDiff struct {
 	Up   []string
 	Down []string
+
+	// PostUp runs after the Up statements of every table in the migration,
+	// e.g. foreign keys that close a reference cycle.
+	PostUp []string
 }
 
 func (d TableDiff) IsEmpty() bool {
-	return len(d.Up) == 0 && len(d.Down) == 0
+	return len(d.Up) == 0 && len(d.Down) == 0 && len(d.PostUp) == 0
 }
 
 type SchemaRegistry map[string]func(string) TableSchema
@@ -100,10 +253,18 @@ func NormalizeSchema(s TableSchema) TableSchema {
 		c.Attrs.Default = normalizeDefault(c.Attrs.Default)
 
 		if fk := c.Attrs.ForeignKey; fk != nil {
-			fk.Table = strings.ToLower(fk.Table)
-			fk.Column = strings.ToLower(fk.Column)
+			// Case is left to the IdentifierPolicy: quoted identifiers
+			// referencing a mixed-case table must keep it.
+			fk.Table = strings.TrimSpace(fk.Table)
+			fk.Column = strings.TrimSpace(fk.Column)
 			fk.OnDelete = normalizeAction(fk.OnDelete)
 			fk.OnUpdate = normalizeAction(fk.OnUpdate)
+			fk.OnDeleteColumns = normalizeIndexColumns(fk.OnDeleteColumns)
+			if len(fk.OnDeleteColumns) == 0 {
+				fk.OnDeleteColumns = nil
+			}
+			fk.Deferrable = fk.Deferrable || fk.InitiallyDeferred
+			fk.Match = NormalizeMatch(fk.Match)
 		}
 
 		out.Columns[i] = c
@@ -112,14 +273,37 @@ func NormalizeSchema(s TableSchema) TableSchema {
 	for i, idx := range out.Indexes {
 		idx.Columns = normalizeIndexColumns(idx.Columns)
 		idx.Where = normalizeWhere(idx.Where)
+		idx.Method = normalizeIndexMethod(idx.Method)
+		idx.Opclasses = normalizeOpclasses(idx.Opclasses)
+		idx.With = normalizeIndexWith(idx.With)
+		idx.Tablespace = normalizeTablespace(idx.Tablespace)
 		out.Indexes[i] = idx
 	}
 
+	for i, trg := range out.Triggers {
+		trg.Timing = strings.ToUpper(strings.TrimSpace(trg.Timing))
+		trg.Events = normalizeTriggerEvents(trg.Events)
+		trg.Function = strings.TrimSuffix(strings.TrimSpace(trg.Function), "()")
+		out.Triggers[i] = trg
+	}
+
 	for i, chk := range out.Checks {
 		chk.Expr = normalizeCheckExpr(chk.Expr)
 		out.Checks[i] = chk
 	}
 
+	out.Storage = normalizeIndexWith(out.Storage)
+	out.Tablespace = normalizeTablespace(out.Tablespace)
+	if len(out.Inherits) > 0 {
+		inherits := make([]string, len(out.Inherits))
+		for i, parent := range out.Inherits {
+			inherits[i] = strings.TrimSpace(parent)
+		}
+		out.Inherits = inherits
+	} else {
+		out.Inherits = nil
+	}
+
 	return out
 }
 
@@ -136,6 +320,55 @@ func normalizeIndexColumns(cols []string) []string {
 	return out
 }
 
+func normalizeIndexMethod(m string) string {
+	m = strings.ToLower(strings.TrimSpace(m))
+	if m == "" {
+		return "btree"
+	}
+	return m
+}
+
+// normalizeOpclasses returns nil when every column uses its default opclass.
+func normalizeOpclasses(ops []string) []string {
+	out := make([]string, len(ops))
+	custom := false
+	for i, op := range ops {
+		out[i] = strings.ToLower(strings.TrimSpace(op))
+		custom = custom || out[i] != ""
+	}
+	if !custom {
+		return nil
+	}
+	return out
+}
+
+// normalizeTablespace folds a tablespace name the way Postgres folds an
+// unquoted identifier; pg_default is the database default, so it is empty.
+func normalizeTablespace(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "pg_default" {
+		return ""
+	}
+	return name
+}
+
+func normalizeIndexWith(params []string) []string {
+	if len(params) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(params))
+	for _, p := range params {
+		k, v, _ := strings.Cut(p, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "" {
+			continue
+		}
+		out = append(out, k+"="+strings.Trim(strings.TrimSpace(v), `'`))
+	}
+	sort.Strings(out)
+	return out
+}
+
 func normalizeWhere(where *string) *string {
 	if where == nil {
 		return nil
@@ -143,12 +376,53 @@ func normalizeWhere(where *string) *string {
 	v := strings.TrimSpace(*where)
 	v = strings.TrimSuffix(v, ";")
 	v = strings.TrimSpace(v)
+	// pg_get_expr wraps index predicates: "(deleted_at IS NULL)".
+	for wrapped(v) {
+		v = strings.TrimSpace(v[1 : len(v)-1])
+	}
 	if v == "" {
 		return nil
 	}
 	return &v
 }
 
+// normalizeTriggerEvents upper-cases trigger events and orders them as
+// Postgres reports them.
+func normalizeTriggerEvents(events []string) []string {
+	set := make(map[string]bool, len(events))
+	for _, e := range events {
+		set[strings.ToUpper(strings.TrimSpace(e))] = true
+	}
+	var out []string
+	for _, e := range []string{"INSERT", "UPDATE", "DELETE", "TRUNCATE"} {
+		if set[e] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// wrapped reports whether expr is enclosed in one pair of parentheses, so
+// "(a)" is and "(a) OR (b)" is not.
+func wrapped(expr string) bool {
+	if !strings.HasPrefix(expr, "(") || !strings.HasSuffix(expr, ")") {
+		return false
+	}
+	depth := 0
+	for i, r := range expr {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i < len(expr)-1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func normalizeCheckExpr(expr string) string {
 	expr = strings.TrimSpace(expr)
 	expr = strings.TrimSuffix(expr, ";")
@@ -165,11 +439,18 @@ func normalizeCheckExpr(expr string) string {
 	return expr
 }
 
+// NormalizePgType returns the canonical spelling of a Postgres type, as used
+// when comparing declared and live schemas.
+func NormalizePgType(t string) string { return normalizePgType(t) }
+
 func normalizePgType(t string) string {
 	t = strings.ToLower(strings.TrimSpace(t))
 	isArray := strings.HasSuffix(t, "[]")
 	if isArray {
 		t = strings.TrimSuffix(t, "[]")
+	} else if strings.HasPrefix(t, "_") {
+		// udt_name spelling of array types, e.g. _int4.
+		t, isArray = t[1:], true
 	}
 	t = strings.Join(strings.Fields(t), " ")
 	switch t {
@@ -183,23 +464,39 @@ func normalizePgType(t string) string {
 		t = "boolean"
 	case "float4", "real":
 		t = "real"
-	case "float8", "double precision":
+	case "float8", "double precision", "float":
 		t = "double precision"
+	case "serial2", "smallserial":
+		t = "smallserial"
+	case "serial4", "serial":
+		t = "serial"
+	case "serial8", "bigserial":
+		t = "bigserial"
+	case "time without time zone", "time":
+		t = "time"
+	case "time with time zone", "timetz":
+		t = "timetz"
 	case "timestamp without time zone", "timestamp":
 		t = "timestamp"
 	case "timestamp with time zone", "timestamptz":
 		t = "timestamptz"
-	case "character varying", "varchar", "varchar()", "varchar(255)":
+	case "character varying", "varchar", "varchar()":
 		t = "varchar"
+	case "character", "char", "bpchar":
+		t = "char(1)"
+	case "decimal", "numeric":
+		t = "numeric"
 	default:
-		if m := varcharWithLenRe.FindStringSubmatch(t); len(m) == 2 {
-			t = "varchar(" + m[1] + ")"
-		} else if strings.HasPrefix(t, "character varying(") {
-			t = strings.Replace(t, "character varying(", "varchar(", 1)
-		} else if strings.HasPrefix(t, "timestamp with time zone") {
-			t = strings.Replace(t, "timestamp with time zone", "timestamptz", 1)
-		} else if strings.HasPrefix(t, "timestamp without time zone") {
-			t = strings.Replace(t, "timestamp without time zone", "timestamp", 1)
+		if m := typeModifierRe.FindStringSubmatch(t); len(m) == 4 {
+			t = normalizeTypeModifier(m[1], m[2], m[3])
+		} else if m := vectorTypeRe.FindStringSubmatch(t); len(m) == 3 {
+			t = m[1] + "(" + m[2] + ")"
+		} else if m := timePrecisionRe.FindStringSubmatch(t); m != nil {
+			t = m[1]
+			if m[2] == "tz" || m[4] == "with" {
+				t += "tz"
+			}
+			t += "(" + m[3] + ")"
 		}
 	}
 	if isArray {
@@ -208,6 +505,33 @@ func normalizePgType(t string) string {
 	return t
 }
 
+// NormalizeMatch returns the canonical spelling of a MATCH clause, with
+// MATCH SIMPLE, the default, as empty.
+func NormalizeMatch(m MatchType) MatchType {
+	m = MatchType(strings.ToUpper(strings.TrimSpace(string(m))))
+	if m == MatchSimple {
+		return ""
+	}
+	return m
+}
+
+// ParseAction reads a delete= or update= tag value, e.g. "cascade" or
+// "set_null(author_id, tenant_id)", into the action and its column list.
+func ParseAction(v string) (OnActionType, []string) {
+	action, cols, hasCols := strings.Cut(v, "(")
+	a := OnActionType(strings.ToUpper(strings.TrimSpace(action)))
+	if !hasCols {
+		return a, nil
+	}
+	var out []string
+	for _, c := range strings.Split(strings.TrimSuffix(strings.TrimSpace(cols), ")"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			out = append(out, c)
+		}
+	}
+	return a, out
+}
+
 func normalizeAction(a OnActionType) OnActionType {
 	s := strings.ToUpper(strings.TrimSpace(string(a)))
 	s = strings.ReplaceAll(s, "_", " ")
@@ -220,7 +544,35 @@ func normalizeAction(a OnActionType) OnActionType {
 	return a
 }
 
-var varcharWithLenRe = regexp.MustCompile(`^character varying\((\d+)\)$`)
+// Types whose length, precision or scale is part of the type, e.g.
+// varchar(50) or numeric(10, 2).
+var typeModifierRe = regexp.MustCompile(`^(character varying|varchar|character|char|bpchar|numeric|decimal|bit varying|varbit|bit)\s*\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\)$`)
+
+// normalizeTypeModifier spells length and precision types the way
+// format_type does, so that varchar(50) and character varying(50), or
+// decimal(10) and numeric(10,0), compare equal.
+func normalizeTypeModifier(base, a, b string) string {
+	switch base {
+	case "character varying", "varchar":
+		return "varchar(" + a + ")"
+	case "character", "char", "bpchar":
+		return "char(" + a + ")"
+	case "numeric", "decimal":
+		if b == "" {
+			b = "0"
+		}
+		return "numeric(" + a + "," + b + ")"
+	case "varbit":
+		return "bit varying(" + a + ")"
+	}
+	return base + "(" + a + ")"
+}
+
+// timestamp(3) with time zone, time(0), timestamptz(6), ...
+var timePrecisionRe = regexp.MustCompile(`^(timestamp|time)(tz)?\s*\(\s*(\d+)\s*\)(?:\s+(with|without) time zone)?$`)
+
+// pgvector types: vector(1536), halfvec(768), sparsevec(1000).
+var vectorTypeRe = regexp.MustCompile(`^(vector|halfvec|sparsevec)\s*\(\s*(\d+)\s*\)$`)
 
 func normalizeDefault(d *string) *string {
 	if d == nil {
@@ -229,6 +581,37 @@ func normalizeDefault(d *string) *string {
 	v := strings.TrimSpace(*d)
 	v = strings.TrimSuffix(v, "::text")
 	v = strings.TrimSuffix(v, "::varchar")
-	v = strings.ToLower(v)
 	return &v
 }
+
+// serialTypes maps serial pseudo-types to the type of the column they create.
+var serialTypes = map[string]string{
+	"smallserial": "smallint",
+	"serial":      "integer",
+	"bigserial":   "bigint",
+}
+
+// AlignSerialColumns returns the live schema with every column that declared
+// defines as serial, and the database reports as the matching integer type
+// with a nextval(...) default, described as that serial type instead. Both
+// schemas must be normalized. Without it, a serial column would be "changed"
+// to its own type on every comparison.
+func AlignSerialColumns(live, declared TableSchema) TableSchema {
+	declaredTypes := make(map[string]string, len(declared.Columns))
+	for _, c := range declared.Columns {
+		declaredTypes[c.ColumnName] = c.Attrs.PgType
+	}
+
+	cols := make([]ColumnMeta, len(live.Columns))
+	for i, c := range live.Columns {
+		serial := declaredTypes[c.ColumnName]
+		if base, ok := serialTypes[serial]; ok && c.Attrs.PgType == base &&
+			c.Attrs.Default != nil && strings.HasPrefix(CanonicalDefault(*c.Attrs.Default), "nextval(") {
+			c.Attrs.PgType = serial
+			c.Attrs.Default = nil
+		}
+		cols[i] = c
+	}
+	live.Columns = cols
+	return live
+}
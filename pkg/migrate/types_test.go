@@ -14,6 +14,23 @@ func TestNormalizePgTypeAliases(t *testing.T) {
 		{in: "timestamp with time zone", want: "timestamptz"},
 		{in: "float8", want: "double precision"},
 		{in: "int4[]", want: "integer[]"},
+		{in: "varchar(255)", want: "varchar(255)"},
+		{in: "VARCHAR (50)", want: "varchar(50)"},
+		{in: "character(3)", want: "char(3)"},
+		{in: "decimal(10, 2)", want: "numeric(10,2)"},
+		{in: "numeric(10)", want: "numeric(10,0)"},
+		{in: "decimal", want: "numeric"},
+		{in: "int8", want: "bigint"},
+		{in: "bool", want: "boolean"},
+		{in: "float", want: "double precision"},
+		{in: "_int4", want: "integer[]"},
+		{in: "_varchar", want: "varchar[]"},
+		{in: "serial8", want: "bigserial"},
+		{in: "time without time zone", want: "time"},
+		{in: "time with time zone", want: "timetz"},
+		{in: "timestamp(3) with time zone", want: "timestamptz(3)"},
+		{in: "timestamptz(3)", want: "timestamptz(3)"},
+		{in: "timestamp(0) without time zone", want: "timestamp(0)"},
 	}
 
 	for _, tc := range cases {
@@ -73,14 +90,14 @@ func TestNormalizeSchemaNormalizesNestedMetadata(t *testing.T) {
 	if col.Attrs.PgType != "integer" {
 		t.Fatalf("normalized type = %q, want integer", col.Attrs.PgType)
 	}
-	if col.Attrs.Default == nil || *col.Attrs.Default != "'abc'" {
-		t.Fatalf("normalized default = %v, want 'abc'", col.Attrs.Default)
+	if col.Attrs.Default == nil || *col.Attrs.Default != "'ABC'" {
+		t.Fatalf("normalized default = %v, want 'ABC'", col.Attrs.Default)
 	}
 	if col.Attrs.ForeignKey == nil {
 		t.Fatalf("foreign key unexpectedly nil")
 	}
-	if col.Attrs.ForeignKey.Table != "public.companies" || col.Attrs.ForeignKey.Column != "id" {
-		t.Fatalf("normalized fk ref = %s.%s, want public.companies.id", col.Attrs.ForeignKey.Table, col.Attrs.ForeignKey.Column)
+	if col.Attrs.ForeignKey.Table != "Public.Companies" || col.Attrs.ForeignKey.Column != "ID" {
+		t.Fatalf("normalized fk ref = %s.%s, want Public.Companies.ID", col.Attrs.ForeignKey.Table, col.Attrs.ForeignKey.Column)
 	}
 	if col.Attrs.ForeignKey.OnDelete != NoAction || col.Attrs.ForeignKey.OnUpdate != Restrict {
 		t.Fatalf("normalized fk actions = (%s,%s), want (%s,%s)", col.Attrs.ForeignKey.OnDelete, col.Attrs.ForeignKey.OnUpdate, NoAction, Restrict)
@@ -93,4 +110,35 @@ func TestNormalizeSchemaNormalizesNestedMetadata(t *testing.T) {
 	}
 }
 
+func TestAlignSerialColumns(t *testing.T) {
+	t.Parallel()
+
+	declared := NormalizeSchema(TableSchema{
+		TableName: "users",
+		Columns: []ColumnMeta{
+			{ColumnName: "id", Attrs: ColumnAttributes{PgType: "BIGSERIAL"}},
+			{ColumnName: "seq", Attrs: ColumnAttributes{PgType: "serial"}},
+		},
+	})
+	live := NormalizeSchema(TableSchema{
+		TableName: "users",
+		Columns: []ColumnMeta{
+			{ColumnName: "id", Attrs: ColumnAttributes{PgType: "int8", Default: strPtr("nextval('users_id_seq'::regclass)")}},
+			{ColumnName: "seq", Attrs: ColumnAttributes{PgType: "bigint", Default: strPtr("nextval('users_seq_seq'::regclass)")}},
+		},
+	})
+
+	got := AlignSerialColumns(live, declared)
+	if id := got.Columns[0].Attrs; id.PgType != "bigserial" || id.Default != nil {
+		t.Fatalf("id = %s default %v, want bigserial without default", id.PgType, id.Default)
+	}
+	// serial creates an integer column; a bigint column is a real change.
+	if seq := got.Columns[1].Attrs; seq.PgType != "bigint" || seq.Default == nil {
+		t.Fatalf("seq = %s default %v, want it unchanged", seq.PgType, seq.Default)
+	}
+	if live.Columns[0].Attrs.PgType != "bigint" {
+		t.Fatal("AlignSerialColumns must not modify its argument")
+	}
+}
+
 func strPtr(v string) *string { return &v }
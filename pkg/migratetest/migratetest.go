@@ -0,0 +1,96 @@
+// Package migratetest gives tests a throwaway database with the migrations
+// of an application applied, so they run against the migrated schema:
+//
+//	func TestOrders(t *testing.T) {
+//		db := migratetest.New(t, os.DirFS("../../migrations"))
+//		repo := orders.NewRepo(db.Pool)
+//		...
+//	}
+//
+// The database is created with CREATE DATABASE on the server of the admin
+// DSN, read from MIGRATEME_TEST_DSN, whose user needs the CREATEDB
+// privilege. Tests calling New are skipped when it is not set, so suites
+// still pass on machines without Postgres. The database is dropped when the
+// test finishes.
+//
+// Start and Close do the same outside of a single test, e.g. to share one
+// database across a package from TestMain.
+package migratetest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/runner"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EnvDSN names the environment variable New reads the admin DSN from.
+const EnvDSN = "MIGRATEME_TEST_DSN"
+
+// DB is a throwaway database with the migrations applied.
+type DB struct {
+	// Name is the name of the database and DSN connects to it.
+	Name string
+	DSN  string
+	Pool *pgxpool.Pool
+	// Applied lists the migrations that were applied.
+	Applied []string
+
+	scratch *database.Scratch
+}
+
+// Start creates a database on the server of adminDSN and applies the
+// migrations at the root of fsys to it, like runner.Runner.Up with opts.
+// Close drops it again.
+func Start(ctx context.Context, adminDSN string, fsys fs.FS, opts ...runner.Option) (*DB, error) {
+	scratch, err := database.CreateScratch(ctx, adminDSN, "migratetest")
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{Name: scratch.Name, DSN: scratch.DSN, scratch: scratch}
+
+	db.Pool, err = pgxpool.New(ctx, scratch.DSN)
+	if err != nil {
+		scratch.Drop(ctx)
+		return nil, fmt.Errorf("connect to %s: %w", scratch.Name, err)
+	}
+	db.Applied, err = runner.New(db.Pool, fsys, opts...).Up(ctx)
+	if err != nil {
+		db.Close(ctx)
+		return nil, fmt.Errorf("apply migrations: %w", err)
+	}
+	return db, nil
+}
+
+// Close closes the pool and drops the database.
+func (db *DB) Close(ctx context.Context) error {
+	db.Pool.Close()
+	return db.scratch.Drop(ctx)
+}
+
+// New returns a database with the migrations at the root of fsys applied,
+// which is dropped when t finishes. It skips t when MIGRATEME_TEST_DSN is not
+// set and fails it when the database cannot be set up.
+func New(t testing.TB, fsys fs.FS, opts ...runner.Option) *DB {
+	t.Helper()
+
+	adminDSN := os.Getenv(EnvDSN)
+	if adminDSN == "" {
+		t.Skipf("%s is not set", EnvDSN)
+	}
+	db, err := Start(context.Background(), adminDSN, fsys, opts...)
+	if err != nil {
+		t.Fatalf("migratetest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(context.Background()); err != nil {
+			t.Errorf("migratetest: %v", err)
+		}
+	})
+	return db
+}
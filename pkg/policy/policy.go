@@ -0,0 +1,280 @@
+// Package policy checks declared schemas and generated migrations against
+// organizational rules configured in migrateme.yaml, e.g.
+//
+//	policy:
+//	  required_columns:
+//	    - name: created_at
+//	      type: timestamptz
+//	      except: [audit_log]
+//	  forbidden_types:
+//	    - type: json
+//	      reason: use jsonb
+//	  naming:
+//	    tables: '^[a-z][a-z0-9_]*s$'
+//	    columns: '^[a-z][a-z0-9_]*$'
+//	  require_comments: true
+//	  forbidden_statements:
+//	    - pattern: '(?i)\bDROP\s+TABLE\b'
+//	      reason: tables are dropped manually
+//
+// It is a declarative alternative to hooks for common rules.
+package policy
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// Rule names used in violations.
+const (
+	RuleRequiredColumns     = "required_columns"
+	RuleForbiddenTypes      = "forbidden_types"
+	RuleTableNaming         = "naming.tables"
+	RuleColumnNaming        = "naming.columns"
+	RuleIndexNaming         = "naming.indexes"
+	RuleRequireComments     = "require_comments"
+	RuleForbiddenStatements = "forbidden_statements"
+)
+
+type Rules struct {
+	RequiredColumns     []RequiredColumn     `yaml:"required_columns,omitempty"`
+	ForbiddenTypes      []ForbiddenType      `yaml:"forbidden_types,omitempty"`
+	Naming              Naming               `yaml:"naming,omitempty"`
+	RequireComments     bool                 `yaml:"require_comments,omitempty"`
+	ForbiddenStatements []ForbiddenStatement `yaml:"forbidden_statements,omitempty"`
+}
+
+// RequiredColumn must exist in every table, or only in Tables when set.
+// Type, when set, must match the column type.
+type RequiredColumn struct {
+	Name   string   `yaml:"name"`
+	Type   string   `yaml:"type,omitempty"`
+	Tables []string `yaml:"tables,omitempty"`
+	Except []string `yaml:"except,omitempty"`
+}
+
+// ForbiddenType matches a column type by its base name, so "varchar" also
+// forbids varchar(255).
+type ForbiddenType struct {
+	Type   string `yaml:"type"`
+	Reason string `yaml:"reason,omitempty"`
+}
+
+// Naming holds regular expressions that names must match.
+type Naming struct {
+	Tables  string `yaml:"tables,omitempty"`
+	Columns string `yaml:"columns,omitempty"`
+	Indexes string `yaml:"indexes,omitempty"`
+}
+
+// ForbiddenStatement rejects generated statements matching Pattern.
+type ForbiddenStatement struct {
+	Pattern string `yaml:"pattern"`
+	Reason  string `yaml:"reason,omitempty"`
+}
+
+func (r Rules) Empty() bool {
+	return len(r.RequiredColumns) == 0 && len(r.ForbiddenTypes) == 0 && r.Naming == (Naming{}) &&
+		!r.RequireComments && len(r.ForbiddenStatements) == 0
+}
+
+type Violation struct {
+	Rule    string `json:"rule"`
+	Table   string `json:"table"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Table is a declared table together with its doc comment.
+type Table struct {
+	Schema  migrate.TableSchema
+	Comment string
+}
+
+// Policy is a compiled set of rules.
+type Policy struct {
+	rules      Rules
+	tables     *regexp.Regexp
+	columns    *regexp.Regexp
+	indexes    *regexp.Regexp
+	statements []*regexp.Regexp
+}
+
+func Compile(r Rules) (*Policy, error) {
+	p := &Policy{rules: r}
+	var err error
+	if p.tables, err = compileOptional(RuleTableNaming, r.Naming.Tables); err != nil {
+		return nil, err
+	}
+	if p.columns, err = compileOptional(RuleColumnNaming, r.Naming.Columns); err != nil {
+		return nil, err
+	}
+	if p.indexes, err = compileOptional(RuleIndexNaming, r.Naming.Indexes); err != nil {
+		return nil, err
+	}
+	for _, s := range r.ForbiddenStatements {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", RuleForbiddenStatements, s.Pattern, err)
+		}
+		p.statements = append(p.statements, re)
+	}
+	return p, nil
+}
+
+func compileOptional(rule, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern %q: %w", rule, pattern, err)
+	}
+	return re, nil
+}
+
+// CheckTable evaluates the schema rules against a declared table.
+func (p *Policy) CheckTable(t Table) []Violation {
+	var out []Violation
+	s := t.Schema
+	add := func(rule, column, format string, args ...any) {
+		out = append(out, Violation{Rule: rule, Table: s.TableName, Column: column, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if p.tables != nil && !p.tables.MatchString(s.TableName) {
+		add(RuleTableNaming, "", "table name %q does not match %s", s.TableName, p.tables)
+	}
+	if p.rules.RequireComments && strings.TrimSpace(t.Comment) == "" {
+		add(RuleRequireComments, "", "table has no description in its doc comment")
+	}
+
+	columns := make(map[string]migrate.ColumnMeta, len(s.Columns))
+	for _, c := range s.Columns {
+		columns[strings.ToLower(c.ColumnName)] = c
+
+		if p.columns != nil && !p.columns.MatchString(c.ColumnName) {
+			add(RuleColumnNaming, c.ColumnName, "column name %q does not match %s", c.ColumnName, p.columns)
+		}
+		for _, ft := range p.rules.ForbiddenTypes {
+			if strings.EqualFold(baseType(c.Attrs.PgType), baseType(ft.Type)) {
+				msg := fmt.Sprintf("type %s is forbidden", c.Attrs.PgType)
+				if ft.Reason != "" {
+					msg += ": " + ft.Reason
+				}
+				add(RuleForbiddenTypes, c.ColumnName, "%s", msg)
+			}
+		}
+	}
+
+	for _, rc := range p.rules.RequiredColumns {
+		if !appliesTo(rc, s.TableName) {
+			continue
+		}
+		c, ok := columns[strings.ToLower(rc.Name)]
+		switch {
+		case !ok:
+			add(RuleRequiredColumns, rc.Name, "required column %s is missing", rc.Name)
+		case rc.Type != "" && !strings.EqualFold(migrate.NormalizePgType(c.Attrs.PgType), migrate.NormalizePgType(rc.Type)):
+			add(RuleRequiredColumns, rc.Name, "column %s must be %s, got %s", rc.Name, rc.Type, c.Attrs.PgType)
+		}
+	}
+
+	if p.indexes != nil {
+		for _, idx := range s.Indexes {
+			if idx.Name != "" && !p.indexes.MatchString(idx.Name) {
+				add(RuleIndexNaming, "", "index name %q does not match %s", idx.Name, p.indexes)
+			}
+		}
+	}
+	return out
+}
+
+// CheckStatements evaluates the statement rules against a table's generated
+// migration.
+func (p *Policy) CheckStatements(table string, stmts []string) []Violation {
+	var out []Violation
+	for _, stmt := range stmts {
+		for i, re := range p.statements {
+			if !re.MatchString(stmt) {
+				continue
+			}
+			msg := fmt.Sprintf("statement matches forbidden pattern %s: %s", re, firstLine(stmt))
+			if reason := p.rules.ForbiddenStatements[i].Reason; reason != "" {
+				msg += " (" + reason + ")"
+			}
+			out = append(out, Violation{Rule: RuleForbiddenStatements, Table: table, Message: msg})
+		}
+	}
+	return out
+}
+
+func appliesTo(rc RequiredColumn, table string) bool {
+	for _, t := range rc.Except {
+		if strings.EqualFold(t, table) {
+			return false
+		}
+	}
+	if len(rc.Tables) == 0 {
+		return true
+	}
+	for _, t := range rc.Tables {
+		if t == "*" || strings.EqualFold(t, table) {
+			return true
+		}
+	}
+	return false
+}
+
+func baseType(t string) string {
+	t = migrate.NormalizePgType(t)
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = t[:i]
+	}
+	return strings.TrimSpace(t)
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+	return s
+}
+
+// Error is returned when generation violates the policy.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "policy check failed with %d violations\n", len(e.Violations))
+	Report(&b, e.Violations)
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// Report writes violations grouped by rule, in the order rules first occur.
+func Report(w io.Writer, violations []Violation) {
+	var order []string
+	byRule := map[string][]Violation{}
+	for _, v := range violations {
+		if _, ok := byRule[v.Rule]; !ok {
+			order = append(order, v.Rule)
+		}
+		byRule[v.Rule] = append(byRule[v.Rule], v)
+	}
+	for _, rule := range order {
+		fmt.Fprintf(w, "%s (%d):\n", rule, len(byRule[rule]))
+		for _, v := range byRule[rule] {
+			target := v.Table
+			if v.Column != "" {
+				target += "." + v.Column
+			}
+			fmt.Fprintf(w, "  %s: %s\n", target, v.Message)
+		}
+	}
+}
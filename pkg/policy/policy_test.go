@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestCheckTable(t *testing.T) {
+	t.Parallel()
+
+	p, err := Compile(Rules{
+		RequiredColumns: []RequiredColumn{
+			{Name: "created_at", Type: "timestamptz"},
+			{Name: "tenant_id", Tables: []string{"orders"}},
+		},
+		ForbiddenTypes:  []ForbiddenType{{Type: "varchar", Reason: "use text"}},
+		Naming:          Naming{Tables: `^[a-z_]+s$`, Columns: `^[a-z_]+$`, Indexes: `^idx_`},
+		RequireComments: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := p.CheckTable(Table{Schema: migrate.TableSchema{
+		TableName: "person",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid"}},
+			{ColumnName: "fullName", Attrs: migrate.ColumnAttributes{PgType: "varchar(255)"}},
+			{ColumnName: "created_at", Attrs: migrate.ColumnAttributes{PgType: "timestamp"}},
+		},
+		Indexes: []migrate.IndexMeta{{Name: "person_name", Columns: []string{"fullName"}}},
+	}})
+
+	var rules []string
+	for _, v := range got {
+		rules = append(rules, v.Rule+":"+v.Column)
+	}
+	want := []string{
+		RuleTableNaming + ":",
+		RuleRequireComments + ":",
+		RuleColumnNaming + ":fullName",
+		RuleForbiddenTypes + ":fullName",
+		RuleRequiredColumns + ":created_at",
+		RuleIndexNaming + ":",
+	}
+	if strings.Join(rules, " ") != strings.Join(want, " ") {
+		t.Fatalf("unexpected violations:\n got %v\nwant %v", rules, want)
+	}
+
+	ok := p.CheckTable(Table{Comment: "Customer orders.", Schema: migrate.TableSchema{
+		TableName: "orders",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "tenant_id", Attrs: migrate.ColumnAttributes{PgType: "uuid"}},
+			{ColumnName: "created_at", Attrs: migrate.ColumnAttributes{PgType: "TIMESTAMPTZ"}},
+		},
+	}})
+	if len(ok) != 0 {
+		t.Fatalf("expected no violations, got %+v", ok)
+	}
+}
+
+func TestCheckStatementsAndReport(t *testing.T) {
+	t.Parallel()
+
+	p, err := Compile(Rules{ForbiddenStatements: []ForbiddenStatement{{Pattern: `(?i)\bDROP\s+COLUMN\b`, Reason: "drop columns manually"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	violations := p.CheckStatements("users", []string{
+		`ALTER TABLE "users" ADD COLUMN "age" integer`,
+		`ALTER TABLE "users" DROP COLUMN "nickname"`,
+	})
+	if len(violations) != 1 {
+		t.Fatalf("expected one violation, got %+v", violations)
+	}
+
+	msg := (&Error{Violations: violations}).Error()
+	for _, want := range []string{"1 violations", "forbidden_statements (1):", `users: statement matches`, "(drop columns manually)"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("expected %q in:\n%s", want, msg)
+		}
+	}
+}
+
+func TestCompileRejectsInvalidPattern(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Compile(Rules{Naming: Naming{Tables: "("}}); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
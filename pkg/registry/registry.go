@@ -0,0 +1,89 @@
+// Package registry registers entity types that name their own table.
+//
+// A migrate.SchemaRegistry built by hand maps table names to schema builders,
+// and nothing keeps a key in line with the schema it returns. Here the table
+// name comes from the type:
+//
+//	func (User) TableName() string { return "users" }
+//
+//	registry.Add[User]()
+//
+// so the name is written once, next to the type, and a type that does not
+// implement Migratable does not compile.
+package registry
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/schema"
+)
+
+// Migratable is an entity type that names its table. TableName is called on
+// the zero value, or on a new value when T is a pointer type.
+type Migratable interface {
+	TableName() string
+}
+
+// Add registers T as the entity of the table it names, like
+// migrate.Register, so programs running pkg/cli include it in the registry.
+func Add[T Migratable](opts ...migrate.RegisterOption) {
+	migrate.Register[T](TableName[T](), opts...)
+}
+
+// TableName returns the table T names.
+func TableName[T Migratable]() string {
+	var v T
+	if t := reflect.TypeFor[T](); t.Kind() == reflect.Pointer {
+		v = reflect.New(t.Elem()).Interface().(T)
+	}
+	return v.TableName()
+}
+
+// BuildSchema returns the schema of T as the migrator builds it from db tags,
+// before the identifier policy of a config is applied.
+func BuildSchema[T Migratable]() migrate.TableSchema {
+	table := TableName[T]()
+	return schema.BuildSchema(migrate.ReflectEntity(reflect.TypeFor[T](), table, nil, false))
+}
+
+// Registry is a typed set of entities, for programs that use schemas
+// directly rather than through the CLI.
+type Registry struct {
+	builders map[string]func() migrate.TableSchema
+}
+
+// New returns an empty Registry.
+func New() *Registry {
+	return &Registry{builders: map[string]func() migrate.TableSchema{}}
+}
+
+// AddTo adds T to r under the table it names:
+//
+//	r := registry.New()
+//	registry.AddTo[User](r)
+//	registry.AddTo[Order](r)
+func AddTo[T Migratable](r *Registry) {
+	r.builders[TableName[T]()] = BuildSchema[T]
+}
+
+// Tables returns the tables of r, sorted.
+func (r *Registry) Tables() []string {
+	tables := make([]string, 0, len(r.builders))
+	for table := range r.builders {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Schemas returns r as the migrate.SchemaRegistry the schema and migration
+// code works with.
+func (r *Registry) Schemas() migrate.SchemaRegistry {
+	out := make(migrate.SchemaRegistry, len(r.builders))
+	for table, build := range r.builders {
+		out[table] = func(string) migrate.TableSchema { return build() }
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+type user struct {
+	ID    string `db:"id,pk,type=uuid"`
+	Email string `db:"email,notnull,unique"`
+}
+
+func (user) TableName() string { return "registry_users" }
+
+type order struct {
+	ID     string `db:"id,pk,type=uuid"`
+	UserID string `db:"user_id,type=uuid,fk=registry_users.id,delete=cascade"`
+}
+
+func (*order) TableName() string { return "registry_orders" }
+
+func TestBuildSchema(t *testing.T) {
+	t.Parallel()
+
+	s := BuildSchema[*order]()
+	if s.TableName != "registry_orders" || len(s.Columns) != 2 {
+		t.Fatalf("unexpected schema: %+v", s)
+	}
+	fk := s.Columns[1].Attrs.ForeignKey
+	if fk == nil || fk.Table != "registry_users" || fk.OnDelete != migrate.Cascade {
+		t.Errorf("foreign key = %+v", fk)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	r := New()
+	AddTo[user](r)
+	AddTo[*order](r)
+	if got := r.Tables(); !reflect.DeepEqual(got, []string{"registry_orders", "registry_users"}) {
+		t.Fatalf("Tables() = %v", got)
+	}
+
+	schemas := r.Schemas()
+	s := schemas["registry_users"]("registry_users")
+	if s.TableName != "registry_users" || !s.Columns[0].Attrs.IsPK || !s.Columns[1].Attrs.Unique {
+		t.Errorf("unexpected schema: %+v", s)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	t.Parallel()
+
+	Add[user]()
+	for _, e := range migrate.RegisteredEntities(nil, false) {
+		if e.TableName == "registry_users" {
+			if e.StructName != "user" || len(e.Fields) != 2 {
+				t.Errorf("unexpected entity: %+v", e)
+			}
+			return
+		}
+	}
+	t.Error("user is not registered")
+}
@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/amr0ny/migrateme/internal/access"
+)
+
+// Handler returns an http.Handler for orchestration systems to inspect and
+// drive the migrations of a running service:
+//
+//	GET  /healthz              200 when no migration is pending, 503 otherwise
+//	GET  /migrations/status    applied and pending migrations
+//	POST /migrations/run       applies pending migrations
+//
+// All responses are JSON and report the number of pending migrations, so
+// that a deploy can be gated on it. /healthz needs no authentication and
+// tells nothing but that number; when the database cannot be reached its
+// error is logged, not returned. The other endpoints require the header
+// "Authorization: Bearer <token>"; with an empty token they are disabled.
+// Only one run is served at a time, a concurrent request gets 409. Mount
+// it under a prefix with http.StripPrefix:
+//
+//	mux.Handle("/admin/", http.StripPrefix("/admin", r.Handler(os.Getenv("MIGRATIONS_TOKEN"))))
+func (r *Runner) Handler(token string) http.Handler {
+	h := &handler{runner: r, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", h.health)
+	mux.HandleFunc("GET /migrations/status", h.requireToken(h.status))
+	mux.HandleFunc("POST /migrations/run", h.requireToken(h.run))
+	return mux
+}
+
+type handler struct {
+	runner  *Runner
+	token   string
+	running access.Exclusive
+}
+
+type statusResponse struct {
+	Status  string   `json:"status"`
+	Pending int      `json:"pending"`
+	Applied []string `json:"applied,omitempty"`
+	// PendingNames lists the pending migrations.
+	PendingNames []string `json:"pending_migrations,omitempty"`
+	// Ran lists the migrations applied by /migrations/run.
+	Ran   []string `json:"ran,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+func (h *handler) health(w http.ResponseWriter, req *http.Request) {
+	_, pending, err := h.runner.Status(req.Context())
+	switch {
+	case err != nil:
+		h.runner.logger().Error("migrations health check failed", "error", err)
+		writeResponse(w, http.StatusServiceUnavailable, statusResponse{Status: "error", Error: "migration status unavailable"})
+	case len(pending) > 0:
+		writeResponse(w, http.StatusServiceUnavailable, statusResponse{Status: "pending", Pending: len(pending)})
+	default:
+		writeResponse(w, http.StatusOK, statusResponse{Status: "ok"})
+	}
+}
+
+func (h *handler) status(w http.ResponseWriter, req *http.Request) {
+	applied, pending, err := h.runner.Status(req.Context())
+	if err != nil {
+		writeResponse(w, http.StatusInternalServerError, statusResponse{Status: "error", Error: err.Error()})
+		return
+	}
+	writeResponse(w, http.StatusOK, statusResponse{Status: statusOf(pending), Pending: len(pending), Applied: applied, PendingNames: pending})
+}
+
+// requireToken serves next only to requests with the bearer token.
+func (h *handler) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !access.Bearer(req.Header.Get("Authorization"), h.token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeResponse(w, http.StatusUnauthorized, statusResponse{Status: "error", Error: "missing or invalid token"})
+			return
+		}
+		next(w, req)
+	}
+}
+
+func (h *handler) run(w http.ResponseWriter, req *http.Request) {
+	release, ok := h.running.TryAcquire("")
+	if !ok {
+		writeResponse(w, http.StatusConflict, statusResponse{Status: "error", Error: "migrations are already being applied"})
+		return
+	}
+	defer release()
+
+	ran, err := h.runner.Up(req.Context())
+	_, pending, statusErr := h.runner.Status(req.Context())
+	resp := statusResponse{Status: statusOf(pending), Pending: len(pending), Ran: ran}
+	switch {
+	case err != nil:
+		resp.Status, resp.Error = "error", err.Error()
+		writeResponse(w, http.StatusInternalServerError, resp)
+	case statusErr != nil:
+		resp.Status, resp.Error = "error", statusErr.Error()
+		writeResponse(w, http.StatusInternalServerError, resp)
+	default:
+		writeResponse(w, http.StatusOK, resp)
+	}
+}
+
+func statusOf(pending []string) string {
+	if len(pending) > 0 {
+		return "pending"
+	}
+	return "ok"
+}
+
+func writeResponse(w http.ResponseWriter, code int, resp statusResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
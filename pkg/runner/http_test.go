@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// historyExecutor keeps the names of recorded migrations in memory. With
+// err set, every query fails with it.
+type historyExecutor struct {
+	applied []string
+	err     error
+}
+
+func (e *historyExecutor) Exec(_ context.Context, query string, args ...any) error {
+	if strings.HasPrefix(strings.TrimSpace(query), "INSERT INTO schema_migrations(") {
+		e.applied = append(e.applied, args[0].(string))
+	}
+	return nil
+}
+
+func (e *historyExecutor) Query(_ context.Context, query string, _ ...any) (Rows, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	rows := &nameRows{}
+	if strings.HasPrefix(query, "SELECT name FROM") {
+		rows.names = e.applied
+	}
+	return rows, nil
+}
+
+type nameRows struct {
+	names []string
+	cur   string
+}
+
+func (r *nameRows) Next() bool {
+	if len(r.names) == 0 {
+		return false
+	}
+	r.cur, r.names = r.names[0], r.names[1:]
+	return true
+}
+
+func (r *nameRows) Scan(dest ...any) error {
+	*dest[0].(*string) = r.cur
+	return nil
+}
+
+func (r *nameRows) Err() error   { return nil }
+func (r *nameRows) Close() error { return nil }
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	exec := &historyExecutor{}
+	h := NewWithExecutor(exec, fstest.MapFS{
+		"001__a.up.sql": {Data: []byte("SELECT 1;")},
+		"002__b.up.sql": {Data: []byte("SELECT 2;")},
+	}).Handler("secret")
+
+	serve := func(method, path, token string) (int, statusResponse) {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var resp statusResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return rec.Code, resp
+	}
+
+	if code, resp := serve("GET", "/healthz", ""); code != http.StatusServiceUnavailable || resp.Pending != 2 {
+		t.Fatalf("healthz with pending migrations: %d %+v", code, resp)
+	}
+	if code, resp := serve("GET", "/migrations/status", ""); code != http.StatusUnauthorized || len(resp.PendingNames) != 0 {
+		t.Fatalf("status without a token: %d %+v", code, resp)
+	}
+	if code, resp := serve("GET", "/migrations/status", "secret"); code != http.StatusOK || len(resp.PendingNames) != 2 {
+		t.Fatalf("status: %d %+v", code, resp)
+	}
+	if code, _ := serve("POST", "/migrations/run", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("run with a wrong token: %d", code)
+	}
+	if code, resp := serve("POST", "/migrations/run", "secret"); code != http.StatusOK || len(resp.Ran) != 2 || resp.Pending != 0 {
+		t.Fatalf("run: %d %+v", code, resp)
+	}
+	if code, resp := serve("GET", "/healthz", ""); code != http.StatusOK || resp.Status != "ok" {
+		t.Fatalf("healthz once applied: %d %+v", code, resp)
+	}
+}
+
+func TestHandler_RunDisabledWithoutToken(t *testing.T) {
+	t.Parallel()
+
+	h := NewWithExecutor(&historyExecutor{}, fstest.MapFS{}).Handler("")
+	req := httptest.NewRequest("POST", "/migrations/run", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("run without a configured token: %d", rec.Code)
+	}
+}
+
+func TestHandler_HealthHidesDatabaseErrors(t *testing.T) {
+	t.Parallel()
+
+	var logged bytes.Buffer
+	exec := &historyExecutor{err: errors.New(`failed to connect to host=db.internal user=admin: password authentication failed`)}
+	h := NewWithExecutor(exec, fstest.MapFS{}, WithLogger(slog.New(slog.NewTextHandler(&logged, nil)))).Handler("secret")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("healthz with a failing database: %d", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "db.internal") || strings.Contains(body, "admin") {
+		t.Errorf("healthz leaks the database error: %s", body)
+	}
+	if !strings.Contains(logged.String(), "db.internal") {
+		t.Errorf("expected the database error in the log, got %q", logged.String())
+	}
+}
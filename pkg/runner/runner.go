@@ -0,0 +1,156 @@
+// Package runner applies migrations from any fs.FS, so applications can embed
+// their migrations and run them at startup:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	sub, _ := fs.Sub(migrations, "migrations")
+//	applied, err := runner.New(pool, sub).Up(ctx)
+//
+// NewWithExecutor runs over database/sql or inside a transaction the
+// application already manages:
+//
+//	tx, _ := sqlDB.BeginTx(ctx, nil)
+//	applied, err := runner.NewWithExecutor(runner.FromSQL(tx), sub).Up(ctx)
+//	// commit or roll back tx as usual
+package runner
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"time"
+
+	"github.com/amr0ny/migrateme/internal/core"
+	"github.com/amr0ny/migrateme/internal/database"
+	"github.com/amr0ny/migrateme/pkg/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Runner applies and reverts migrations stored as <name>.up.sql and
+// <name>.down.sql files, or as <name>.sql files with -- +migrate Up/Down
+// sections, at the root of an fs.FS.
+type Runner struct {
+	migrator *core.Migrator
+	cfg      *config.Config
+	opts     core.RunOptions
+	log      *slog.Logger
+}
+
+type Option func(*Runner)
+
+// WithStrictChecksums makes Up fail when already applied migrations were
+// modified.
+func WithStrictChecksums() Option {
+	return func(r *Runner) { r.opts.StrictChecksums = true }
+}
+
+// WithTemplateVars renders migration files through text/template with vars
+// as data, like the migrations.templates config option.
+func WithTemplateVars(vars map[string]string) Option {
+	return func(r *Runner) {
+		r.cfg.Migrations.Templates = true
+		r.cfg.Vars = vars
+	}
+}
+
+// WithoutDestructive makes Up refuse migrations that drop or truncate data.
+func WithoutDestructive() Option {
+	return func(r *Runner) { r.opts.BlockDestructive = true }
+}
+
+// WithOutOfOrder lets Up apply pending migrations that sort before the
+// newest applied one, e.g. migrations added on a merged branch.
+func WithOutOfOrder() Option {
+	return func(r *Runner) { r.opts.AllowOutOfOrder = true }
+}
+
+// WithLockTimeout sets lock_timeout for every migration, like the
+// migrations.lock_timeout config option. Migrations may override it with a
+// -- migrateme:lock_timeout directive.
+func WithLockTimeout(d time.Duration) Option {
+	return func(r *Runner) { r.cfg.Migrations.LockTimeout = d }
+}
+
+// WithStatementTimeout sets statement_timeout for every migration, like the
+// migrations.statement_timeout config option. Migrations may override it
+// with a -- migrateme:statement_timeout directive.
+func WithStatementTimeout(d time.Duration) Option {
+	return func(r *Runner) { r.cfg.Migrations.StatementTimeout = d }
+}
+
+// WithLockRetry applies a migration up to attempts times when it fails with
+// lock_not_available or deadlock_detected, waiting backoff before the
+// first retry and doubling the wait after every further one, like the
+// migrations.lock_retry config option.
+func WithLockRetry(attempts int, backoff time.Duration) Option {
+	return func(r *Runner) {
+		r.cfg.Migrations.LockRetry = config.RetryConfig{Attempts: attempts, Backoff: backoff}
+	}
+}
+
+// WithLogger logs the errors that Handler does not return to
+// unauthenticated clients to l instead of slog.Default().
+func WithLogger(l *slog.Logger) Option {
+	return func(r *Runner) { r.log = l }
+}
+
+func (r *Runner) logger() *slog.Logger {
+	if r.log == nil {
+		return slog.Default()
+	}
+	return r.log
+}
+
+// Executor runs migration statements; see FromPgx and FromSQL.
+type Executor = database.Executor
+
+// Rows is returned by Executor.Query.
+type Rows = database.Rows
+
+// FromPgx adapts a *pgxpool.Pool, *pgxpool.Conn, *pgx.Conn or pgx.Tx.
+func FromPgx(q database.PgxQuerier) Executor {
+	return database.FromPgx(q)
+}
+
+// FromSQL adapts a *sql.DB, *sql.Conn or *sql.Tx using any PostgreSQL
+// driver.
+func FromSQL(q database.SQLQuerier) Executor {
+	return database.FromSQL(q)
+}
+
+func New(pool *pgxpool.Pool, fsys fs.FS, opts ...Option) *Runner {
+	return newRunner(&database.DB{Pool: pool}, fsys, opts)
+}
+
+// NewWithExecutor returns a Runner that applies migrations through exec.
+// When exec is a transaction, committing it is left to the caller.
+func NewWithExecutor(exec Executor, fsys fs.FS, opts ...Option) *Runner {
+	return newRunner(database.New(exec), fsys, opts)
+}
+
+func newRunner(db *database.DB, fsys fs.FS, opts []Option) *Runner {
+	r := &Runner{cfg: config.Default()}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.migrator = core.NewMigrator(r.cfg, db)
+	r.migrator.SetMigrationsFS(fsys)
+	return r
+}
+
+// Up applies all pending migrations and returns their names.
+func (r *Runner) Up(ctx context.Context) ([]string, error) {
+	return r.migrator.Run(ctx, r.opts)
+}
+
+// Down reverts the last n applied migrations and returns their names.
+func (r *Runner) Down(ctx context.Context, n int) ([]string, error) {
+	return r.migrator.Rollback(ctx, n)
+}
+
+// Status returns applied and pending migration names.
+func (r *Runner) Status(ctx context.Context) (applied, pending []string, err error) {
+	return r.migrator.Status(ctx)
+}
@@ -0,0 +1,62 @@
+package schema
+
+import (
+	"fmt"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// AuditActorSetting is the setting an application sets, e.g. with
+// SET LOCAL migrateme.actor = 'alice', to record who changed a row of an
+// audited table. Without it the database user is recorded.
+const AuditActorSetting = "migrateme.actor"
+
+// AuditTableName names the companion table recording the changes of table.
+func AuditTableName(table string) string {
+	return table + "_audit"
+}
+
+// AuditTable returns the companion table of an audited table: one row per
+// inserted, updated or deleted row, with the operation, who made it and
+// when, and the row before and after as jsonb.
+func AuditTable(table string) migrate.TableSchema {
+	now, actor := "now()", "current_user"
+	return migrate.TableSchema{
+		TableName: AuditTableName(table),
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "audit_id", Idx: 0, Attrs: migrate.ColumnAttributes{PgType: "bigserial", IsPK: true, NotNull: true}},
+			{ColumnName: "op", Idx: 1, Attrs: migrate.ColumnAttributes{PgType: "text", NotNull: true}},
+			{ColumnName: "changed_at", Idx: 2, Attrs: migrate.ColumnAttributes{PgType: "timestamptz", NotNull: true, Default: &now}},
+			{ColumnName: "changed_by", Idx: 3, Attrs: migrate.ColumnAttributes{PgType: "text", NotNull: true, Default: &actor}},
+			{ColumnName: "old_row", Idx: 4, Attrs: migrate.ColumnAttributes{PgType: "jsonb"}},
+			{ColumnName: "new_row", Idx: 5, Attrs: migrate.ColumnAttributes{PgType: "jsonb"}},
+		},
+		Indexes: []migrate.IndexMeta{},
+		Checks:  []migrate.CheckMeta{},
+	}
+}
+
+// WithAudit adds to s the trigger writing its changes to AuditTable.
+func WithAudit(s migrate.TableSchema) migrate.TableSchema {
+	fn := s.TableName + "_audit_trigger"
+	audit := AuditTableName(s.TableName)
+	s.Triggers = append(append([]migrate.TriggerMeta(nil), s.Triggers...), migrate.TriggerMeta{
+		Name:     s.TableName + "_audit",
+		Timing:   "AFTER",
+		Events:   []string{"INSERT", "UPDATE", "DELETE"},
+		Function: fn,
+		FunctionSQL: fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  INSERT INTO %s (op, changed_by, old_row, new_row)
+  VALUES (
+    TG_OP,
+    COALESCE(NULLIF(current_setting('%s', true), ''), current_user),
+    CASE WHEN TG_OP <> 'INSERT' THEN to_jsonb(OLD) END,
+    CASE WHEN TG_OP <> 'DELETE' THEN to_jsonb(NEW) END
+  );
+  RETURN NULL;
+END
+$$`, quoteIdent(fn), quoteIdent(audit), AuditActorSetting),
+	})
+	return s
+}
@@ -0,0 +1,86 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestWithAudit(t *testing.T) {
+	t.Parallel()
+
+	users := migrate.TableSchema{
+		TableName: "users",
+		Columns:   []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true}}},
+	}
+	audited := migrate.NormalizeSchema(WithAudit(users))
+	g := NewDiffGenerator()
+
+	up := g.DiffSchemas(migrate.TableSchema{}, audited).Up
+	joined := strings.Join(up, "\n")
+	for _, want := range []string{
+		`CREATE OR REPLACE FUNCTION "users_audit_trigger"() RETURNS trigger`,
+		`INSERT INTO "users_audit" (op, changed_by, old_row, new_row)`,
+		`CREATE TRIGGER "users_audit" AFTER INSERT OR UPDATE OR DELETE ON "users" FOR EACH ROW EXECUTE FUNCTION "users_audit_trigger"()`,
+		`COMMENT ON TRIGGER "users_audit" ON "users" IS 'managed by migrateme'`,
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected %s in:\n%s", want, joined)
+		}
+	}
+
+	// The trigger as the Fetcher reads it back.
+	fetched := users
+	fetched.Triggers = []migrate.TriggerMeta{{
+		Name: "users_audit", Timing: "AFTER", Events: []string{"INSERT", "UPDATE", "DELETE"}, Function: "users_audit_trigger",
+	}}
+	if diff := g.DiffSchemas(migrate.NormalizeSchema(fetched), audited); !diff.IsEmpty() {
+		t.Errorf("diff = %q", diff.Up)
+	}
+
+	diff := g.DiffSchemas(migrate.NormalizeSchema(fetched), migrate.NormalizeSchema(users))
+	if len(diff.Up) != 1 || diff.Up[0] != `DROP TRIGGER IF EXISTS "users_audit" ON "users"` {
+		t.Errorf("up = %q", diff.Up)
+	}
+	if len(diff.Down) != 2 || !strings.HasPrefix(diff.Down[0], `CREATE TRIGGER "users_audit"`) {
+		t.Errorf("down = %q", diff.Down)
+	}
+
+	audit := migrate.NormalizeSchema(AuditTable("users"))
+	if audit.TableName != "users_audit" || len(audit.Columns) != 6 {
+		t.Errorf("audit table = %+v", audit)
+	}
+}
+
+func TestWithTouchUpdatedAt(t *testing.T) {
+	t.Parallel()
+
+	posts := migrate.TableSchema{
+		TableName: "posts",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true}},
+			{ColumnName: "updated_at", Attrs: migrate.ColumnAttributes{PgType: "timestamp(3) with time zone"}},
+		},
+	}
+	touched := migrate.NormalizeSchema(WithTouchUpdatedAt(posts))
+	if len(touched.Triggers) != 1 {
+		t.Fatalf("triggers = %+v", touched.Triggers)
+	}
+
+	up := strings.Join(NewDiffGenerator().DiffSchemas(migrate.TableSchema{}, touched).Up, "\n")
+	for _, want := range []string{
+		`CREATE OR REPLACE FUNCTION "set_updated_at"() RETURNS trigger`,
+		`NEW."updated_at" = now();`,
+		`CREATE TRIGGER "posts_set_updated_at" BEFORE UPDATE ON "posts" FOR EACH ROW EXECUTE FUNCTION "set_updated_at"()`,
+	} {
+		if !strings.Contains(up, want) {
+			t.Errorf("expected %s in:\n%s", want, up)
+		}
+	}
+
+	posts.Columns[1].Attrs.PgType = "text"
+	if s := WithTouchUpdatedAt(posts); len(s.Triggers) != 0 {
+		t.Errorf("text updated_at got a trigger: %+v", s.Triggers)
+	}
+}
@@ -0,0 +1,177 @@
+package schema_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/internal/bench"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+	"github.com/amr0ny/migrateme/pkg/schema"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var benchSizes = []struct{ tables, columns int }{
+	{10, 10},
+	{100, 10},
+	{500, 20},
+}
+
+func BenchmarkDiffSchemasCreate(b *testing.B) {
+	for _, size := range benchSizes {
+		schemas := bench.SyntheticSchemas(size.tables, size.columns)
+		b.Run(fmt.Sprintf("%dx%d", size.tables, size.columns), func(b *testing.B) {
+			g := schema.NewDiffGenerator()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, s := range schemas {
+					g.DiffSchemas(migrate.TableSchema{TableName: s.TableName}, s)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDiffSchemasAlter(b *testing.B) {
+	for _, size := range benchSizes {
+		schemas := bench.SyntheticSchemas(size.tables, size.columns)
+		mutated := bench.Mutate(schemas)
+		b.Run(fmt.Sprintf("%dx%d", size.tables, size.columns), func(b *testing.B) {
+			g := schema.NewDiffGenerator()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := range schemas {
+					g.DiffSchemas(schemas[j], mutated[j])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFetcherFetch(b *testing.B) {
+	for _, size := range benchSizes {
+		schemas := bench.SyntheticSchemas(size.tables, size.columns)
+		q := newFakeQuerier(schemas)
+		b.Run(fmt.Sprintf("%dx%d", size.tables, size.columns), func(b *testing.B) {
+			f := schema.NewFetcher(q)
+			ctx := context.Background()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, s := range schemas {
+					if _, err := f.Fetch(ctx, s.TableName); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// fakeQuerier answers Fetcher's catalog queries from in-memory schemas so the
+// benchmark measures Fetcher's own overhead rather than the database.
+type fakeQuerier struct {
+	tables map[string]migrate.TableSchema
+}
+
+func newFakeQuerier(schemas []migrate.TableSchema) *fakeQuerier {
+	q := &fakeQuerier{tables: make(map[string]migrate.TableSchema, len(schemas))}
+	for _, s := range schemas {
+		q.tables[s.TableName] = s
+	}
+	return q
+}
+
+func (q *fakeQuerier) QueryRow(_ context.Context, _ string, args ...any) pgx.Row {
+	_, ok := q.tables[args[0].(string)]
+	return &fakeRows{data: [][]any{{ok}}}
+}
+
+func (q *fakeQuerier) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	s := q.tables[args[0].(string)]
+	rows := &fakeRows{}
+
+	switch {
+	case strings.Contains(sql, "information_schema.columns"):
+		for _, c := range s.Columns {
+			nullable := "YES"
+			if c.Attrs.NotNull {
+				nullable = "NO"
+			}
+			rows.data = append(rows.data, []any{c.ColumnName, c.Attrs.PgType, nullable, c.Attrs.Default, c.Attrs.Comment})
+		}
+	case strings.Contains(sql, "indisprimary;"):
+		for _, c := range s.Columns {
+			if c.Attrs.IsPK {
+				rows.data = append(rows.data, []any{c.ColumnName, s.TableName + "_pkey"})
+			}
+		}
+	case strings.Contains(sql, "contype = 'u'"):
+		for _, c := range s.Columns {
+			if c.Attrs.Unique {
+				rows.data = append(rows.data, []any{c.ColumnName, "uc_" + s.TableName + "_" + c.ColumnName, c.Attrs.NullsNotDistinct})
+			}
+		}
+	case strings.Contains(sql, "contype = 'f'"):
+		for _, c := range s.Columns {
+			if fk := c.Attrs.ForeignKey; fk != nil {
+				rows.data = append(rows.data, []any{c.ColumnName, fk.Table, fk.Column, "NO ACTION", string(fk.OnDelete), "fk_" + s.TableName + "_" + c.ColumnName, fk.Deferrable, fk.InitiallyDeferred, fk.OnDeleteColumns, "SIMPLE"})
+			}
+		}
+	case strings.Contains(sql, "ARRAY_AGG"):
+		for i, idx := range s.Indexes {
+			rows.data = append(rows.data, []any{fmt.Sprintf("idx_%s_%d", s.TableName, i), idx.Unique, idx.Columns, idx.Where})
+		}
+	case strings.Contains(sql, "contype = 'c'"):
+		for i, chk := range s.Checks {
+			rows.data = append(rows.data, []any{fmt.Sprintf("chk_%s_%d", s.TableName, i), "CHECK ((" + chk.Expr + "))"})
+		}
+	}
+
+	return rows, nil
+}
+
+type fakeRows struct {
+	data [][]any
+	pos  int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *fakeRows) Next() bool {
+	if r.pos >= len(r.data) {
+		return false
+	}
+	r.pos++
+	return true
+}
+
+func (r *fakeRows) Values() ([]any, error) { return r.data[r.pos-1], nil }
+
+func (r *fakeRows) Scan(dest ...any) error {
+	if r.pos == 0 {
+		r.pos = 1 // QueryRow semantics
+	}
+	row := r.data[r.pos-1]
+	for i, d := range dest {
+		switch p := d.(type) {
+		case *string:
+			*p = row[i].(string)
+		case *bool:
+			*p = row[i].(bool)
+		case **string:
+			*p = row[i].(*string)
+		case *[]string:
+			*p = row[i].([]string)
+		default:
+			return fmt.Errorf("fakeRows: unsupported scan target %T", d)
+		}
+	}
+	return nil
+}
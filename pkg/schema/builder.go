@@ -1,8 +1,11 @@
 package schema
 
 import (
+	"fmt"
+
 	"github.com/amr0ny/migrateme/pkg/migrate"
-	"strings"
+	"path/filepath"
+	"sort"
 )
 
 func collectPKs(s migrate.TableSchema) []string {
@@ -33,101 +36,128 @@ func stringSlicesEqual(a, b []string) bool {
 
 func BuildSchema(e migrate.EntityInfo) migrate.TableSchema {
 	schema := migrate.TableSchema{
-		TableName: e.TableName,
-		Columns:   make([]migrate.ColumnMeta, 0),
-		Indexes:   make([]migrate.IndexMeta, 0),
-		Checks:    make([]migrate.CheckMeta, 0),
+		TableName:  e.TableName,
+		Owner:      e.Owner,
+		Columns:    make([]migrate.ColumnMeta, 0),
+		Indexes:    make([]migrate.IndexMeta, 0),
+		Checks:     make([]migrate.CheckMeta, 0),
+		Ignore:     e.Ignore,
+		Storage:    e.Options.Storage,
+		Tablespace: e.Options.Tablespace,
+		Like:       e.Options.Like,
+		Inherits:   e.Options.Inherits,
 	}
 
 	for _, f := range e.Fields {
-		attrs := parseColumnTag(f.RawTag)
+		tag := columnTag(f)
+		if migrate.Excluded(tag) {
+			continue
+		}
+		attrs := migrate.ParseColumnTag(tag)
 
-		schema.Columns = append(schema.Columns, migrate.ColumnMeta{
+		col := migrate.ColumnMeta{
 			FieldName:  f.FieldName,
 			ColumnName: f.ColumnName,
 			Idx:        f.Idx,
 			Attrs:      attrs,
-		})
+			Ignore:     f.Ignore,
+			FilePath:   f.FilePath,
+			Line:       f.Line,
+		}
+		// Fragment paths are relative to the entity file.
+		if path, _ := migrate.TagOption(tag, "sql"); path != "" {
+			if !filepath.IsAbs(path) && e.FilePath != "" {
+				path = filepath.Join(filepath.Dir(e.FilePath), path)
+			}
+			col.SQLFile = path
+		}
+		col.Using, _ = migrate.TagOption(tag, "using")
+		if col.Using == "" {
+			col.Using = f.Using
+		}
+		schema.Columns = append(schema.Columns, col)
 	}
 
 	// Struct-level index directives (composite indexes) are parsed from comments.
 	schema.Indexes = append(schema.Indexes, e.Indexes...)
 	schema.Checks = append(schema.Checks, e.Checks...)
 
+	if e.Options.SoftDelete {
+		schema = withSoftDelete(schema)
+	}
+
 	return schema
 }
 
-func parseColumnTag(tag string) migrate.ColumnAttributes {
-	attrs := migrate.ColumnAttributes{}
-
-	raw := extractTag(tag, "db")
-	if raw == "" || raw == "-" {
-		return attrs
+// withSoftDelete adds migrate.SoftDeleteColumn to s unless declared, and
+// limits unique columns and unique indexes without a predicate to the rows
+// that are not deleted. A unique column becomes a partial unique index,
+// named by SoftDeleteIndexName.
+func withSoftDelete(s migrate.TableSchema) migrate.TableSchema {
+	declared := false
+	for _, c := range s.Columns {
+		declared = declared || c.ColumnName == migrate.SoftDeleteColumn
 	}
-
-	parts := strings.Split(raw, ",")
-	if len(parts) == 0 {
-		return attrs
+	if !declared {
+		s.Columns = append(s.Columns, migrate.ColumnMeta{
+			ColumnName: migrate.SoftDeleteColumn,
+			Idx:        len(s.Columns),
+			Attrs:      migrate.ColumnAttributes{PgType: "timestamptz"},
+		})
 	}
 
-	for _, p := range parts[1:] {
-		switch {
-		case p == "pk":
-			attrs.IsPK = true
-			attrs.NotNull = true
-		case p == "notnull":
-			attrs.NotNull = true
-		case p == "unique":
-			attrs.Unique = true
-
-		case strings.HasPrefix(p, "type="):
-			attrs.PgType = strings.TrimPrefix(p, "type=")
-
-		case strings.HasPrefix(p, "default="):
-			v := strings.TrimPrefix(p, "default=")
-			attrs.Default = &v
-
-		case strings.HasPrefix(p, "fk="):
-			ref := strings.TrimPrefix(p, "fk=")
-			parts := strings.Split(ref, ".")
-			if len(parts) == 2 {
-				attrs.ForeignKey = &migrate.ForeignKey{
-					Table:  parts[0],
-					Column: parts[1],
-				}
-			}
-
-		case strings.HasPrefix(p, "delete="):
-			if attrs.ForeignKey != nil {
-				attrs.ForeignKey.OnDelete = migrate.OnActionType(strings.ToUpper(strings.TrimPrefix(p, "delete=")))
-			}
-
-		case strings.HasPrefix(p, "update="):
-			if attrs.ForeignKey != nil {
-				attrs.ForeignKey.OnUpdate = migrate.OnActionType(strings.ToUpper(strings.TrimPrefix(p, "update=")))
-			}
+	var partial []migrate.IndexMeta
+	for i, c := range s.Columns {
+		if !c.Attrs.Unique || c.Attrs.IsPK {
+			continue
 		}
+		c.Attrs.Unique = false
+		s.Columns[i] = c
+		where := migrate.NotDeleted
+		partial = append(partial, migrate.IndexMeta{
+			Name:    SoftDeleteIndexName(s.TableName, c.ColumnName),
+			Columns: []string{c.ColumnName},
+			Unique:  true,
+			Where:   &where,
+		})
 	}
-
-	if attrs.PgType == "" {
-		attrs.PgType = "text"
+	for i, idx := range s.Indexes {
+		if idx.Unique && idx.Where == nil {
+			where := migrate.NotDeleted
+			idx.Where = &where
+			s.Indexes[i] = idx
+		}
 	}
+	s.Indexes = append(s.Indexes, partial...)
+	return s
+}
 
-	return attrs
+// SoftDeleteIndexName names the partial unique index that replaces the
+// unique constraint of a column on a soft-delete table.
+func SoftDeleteIndexName(table, column string) string {
+	return fmt.Sprintf("uq_%s_%s_not_deleted", table, column)
 }
 
-func extractTag(tag, key string) string {
-	needle := key + `:"`
-	idx := strings.Index(tag, needle)
-	if idx == -1 {
-		return ""
+// columnTag returns the db tag options of a field: the tag discovery
+// resolved by tag priority, or the db tag of RawTag for fields built by hand.
+func columnTag(f migrate.FieldInfo) string {
+	if f.Tag != "" {
+		return f.Tag
 	}
+	return migrate.LookupTag(f.RawTag, "db")
+}
 
-	rest := tag[idx+len(needle):]
-	end := strings.Index(rest, `"`)
-	if end == -1 {
-		return ""
-	}
+// ExtractColumns returns the column names of a table in declaration order and
+// the subset that forms the primary key.
+func ExtractColumns(s migrate.TableSchema) (columns, pk []string) {
+	cols := append([]migrate.ColumnMeta(nil), s.Columns...)
+	sort.SliceStable(cols, func(i, j int) bool { return cols[i].Idx < cols[j].Idx })
 
-	return rest[:end]
+	for _, c := range cols {
+		columns = append(columns, c.ColumnName)
+		if c.Attrs.IsPK {
+			pk = append(pk, c.ColumnName)
+		}
+	}
+	return columns, pk
 }
@@ -0,0 +1,155 @@
+package schema
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestBuildSchema_ResolvesSQLFragments(t *testing.T) {
+	t.Parallel()
+
+	s := BuildSchema(migrate.EntityInfo{
+		TableName: "users",
+		FilePath:  filepath.Join("internal", "domain", "user.go"),
+		Fields: []migrate.FieldInfo{
+			{ColumnName: "id", RawTag: `db:"id,pk,type=uuid"`},
+			{ColumnName: "status", RawTag: `db:"status,type=text,sql=sql/backfill_status.sql"`},
+		},
+	})
+
+	if s.Columns[0].SQLFile != "" {
+		t.Errorf("unexpected fragment %q", s.Columns[0].SQLFile)
+	}
+	if want := filepath.Join("internal", "domain", "sql", "backfill_status.sql"); s.Columns[1].SQLFile != want {
+		t.Errorf("SQLFile = %q, want %q", s.Columns[1].SQLFile, want)
+	}
+	if s.Columns[1].Attrs.PgType != "text" {
+		t.Errorf("sql= must not affect the column type, got %q", s.Columns[1].Attrs.PgType)
+	}
+}
+
+func TestBuildSchema_UsingExpression(t *testing.T) {
+	t.Parallel()
+
+	s := BuildSchema(migrate.EntityInfo{
+		TableName: "users",
+		Fields: []migrate.FieldInfo{
+			{ColumnName: "age", RawTag: `db:"age,type=integer,using=trim(age)::integer"`},
+		},
+	})
+
+	if want := "trim(age)::integer"; s.Columns[0].Using != want {
+		t.Errorf("Using = %q, want %q", s.Columns[0].Using, want)
+	}
+}
+
+func TestBuildSchema_UsingTagOverridesComment(t *testing.T) {
+	t.Parallel()
+
+	s := BuildSchema(migrate.EntityInfo{
+		TableName: "users",
+		Fields: []migrate.FieldInfo{
+			{ColumnName: "status", RawTag: `db:"status,type=integer"`, Using: "CASE WHEN status = 'on' THEN 1 ELSE 0 END"},
+			{ColumnName: "age", RawTag: `db:"age,type=integer,using=trim(age)::integer"`, Using: "age::integer"},
+		},
+	})
+
+	if want := "CASE WHEN status = 'on' THEN 1 ELSE 0 END"; s.Columns[0].Using != want {
+		t.Errorf("Using = %q, want %q", s.Columns[0].Using, want)
+	}
+	if want := "trim(age)::integer"; s.Columns[1].Using != want {
+		t.Errorf("Using = %q, want %q", s.Columns[1].Using, want)
+	}
+}
+
+func TestBuildSchema_TypeModifierWithComma(t *testing.T) {
+	t.Parallel()
+
+	s := BuildSchema(migrate.EntityInfo{
+		TableName: "orders",
+		Fields: []migrate.FieldInfo{
+			{ColumnName: "price", RawTag: `db:"price,type=numeric(10,2),notnull,using=coalesce(price, 0)::numeric"`},
+		},
+	})
+
+	col := s.Columns[0]
+	if col.Attrs.PgType != "numeric(10,2)" {
+		t.Errorf("PgType = %q, want numeric(10,2)", col.Attrs.PgType)
+	}
+	if !col.Attrs.NotNull {
+		t.Error("expected notnull after the type modifier")
+	}
+	if want := "coalesce(price, 0)::numeric"; col.Using != want {
+		t.Errorf("Using = %q, want %q", col.Using, want)
+	}
+}
+
+func TestBuildSchema_ResolvedTagOverridesRawTag(t *testing.T) {
+	t.Parallel()
+
+	s := BuildSchema(migrate.EntityInfo{
+		TableName: "users",
+		Fields: []migrate.FieldInfo{
+			{ColumnName: "id", RawTag: `gorm:"primaryKey;type:uuid"`, Tag: "id,pk,type=uuid"},
+		},
+	})
+
+	col := s.Columns[0]
+	if !col.Attrs.IsPK || col.Attrs.PgType != "uuid" {
+		t.Errorf("attrs = %+v, want a uuid primary key", col.Attrs)
+	}
+}
+
+func TestBuildSchema_SkipsExcludedFields(t *testing.T) {
+	t.Parallel()
+
+	s := BuildSchema(migrate.EntityInfo{
+		TableName: "carts",
+		Fields: []migrate.FieldInfo{
+			{ColumnName: "id", RawTag: `db:"id,pk,type=uuid"`},
+			{ColumnName: "cache", RawTag: `db:"-"`},
+			{ColumnName: "total", Idx: 2, RawTag: `db:"total,type=numeric(10,2),transient"`},
+			{ColumnName: "note", Idx: 3, RawTag: `db:"note"`},
+		},
+	})
+
+	columns, pk := ExtractColumns(s)
+	if strings.Join(columns, ",") != "id,note" || strings.Join(pk, ",") != "id" {
+		t.Errorf("columns = %v, pk = %v, want [id note] and [id]", columns, pk)
+	}
+}
+
+func TestBuildSchema_SoftDelete(t *testing.T) {
+	t.Parallel()
+
+	s := BuildSchema(migrate.EntityInfo{
+		TableName: "users",
+		Fields: []migrate.FieldInfo{
+			{ColumnName: "id", RawTag: `db:"id,pk,type=uuid"`},
+			{ColumnName: "email", Idx: 1, RawTag: `db:"email,unique"`},
+		},
+		Indexes: []migrate.IndexMeta{{Name: "idx_users_login", Columns: []string{"login"}, Unique: true}},
+		Options: migrate.TableOptions{SoftDelete: true},
+	})
+
+	if len(s.Columns) != 3 || s.Columns[2].ColumnName != "deleted_at" || s.Columns[2].Attrs.PgType != "timestamptz" {
+		t.Fatalf("columns = %+v", s.Columns)
+	}
+	if s.Columns[0].Attrs.Unique || s.Columns[1].Attrs.Unique {
+		t.Errorf("unique constraints are left: %+v", s.Columns)
+	}
+	if len(s.Indexes) != 2 {
+		t.Fatalf("indexes = %+v", s.Indexes)
+	}
+	for _, idx := range s.Indexes {
+		if !idx.Unique || idx.Where == nil || *idx.Where != "deleted_at IS NULL" {
+			t.Errorf("index %s is not partial: %+v", idx.Name, idx)
+		}
+	}
+	if s.Indexes[1].Name != "uq_users_email_not_deleted" {
+		t.Errorf("index name = %s", s.Indexes[1].Name)
+	}
+}
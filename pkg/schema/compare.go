@@ -0,0 +1,357 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+// AttrChange is a single changed column attribute, e.g. type or default.
+type AttrChange struct {
+	Name string `json:"name"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+type ColumnChange struct {
+	Column string     `json:"column"`
+	Kind   ChangeKind `json:"kind"`
+	// Definition describes added and removed columns.
+	Definition string       `json:"definition,omitempty"`
+	Attrs      []AttrChange `json:"attrs,omitempty"`
+}
+
+// ItemChange is an added or removed index or check. Like the diff generator,
+// they are matched by definition, so a changed one shows as removed + added.
+type ItemChange struct {
+	Kind       ChangeKind `json:"kind"`
+	Definition string     `json:"definition"`
+}
+
+type TableComparison struct {
+	Table    string         `json:"table"`
+	Kind     ChangeKind     `json:"kind"`
+	Columns  []ColumnChange `json:"columns,omitempty"`
+	Indexes  []ItemChange   `json:"indexes,omitempty"`
+	Checks   []ItemChange   `json:"checks,omitempty"`
+	Storage  []ItemChange   `json:"storage,omitempty"`
+	Triggers []ItemChange   `json:"triggers,omitempty"`
+}
+
+// Compare describes, attribute by attribute, how the schema changes going
+// from one set of tables to another. Unchanged tables are omitted.
+func Compare(from, to []migrate.TableSchema) []TableComparison {
+	fromByName := make(map[string]migrate.TableSchema, len(from))
+	for _, t := range from {
+		fromByName[t.TableName] = migrate.NormalizeSchema(t)
+	}
+	toByName := make(map[string]migrate.TableSchema, len(to))
+	for _, t := range to {
+		toByName[t.TableName] = migrate.NormalizeSchema(t)
+	}
+
+	names := make([]string, 0, len(fromByName)+len(toByName))
+	for name := range fromByName {
+		names = append(names, name)
+	}
+	for name := range toByName {
+		if _, ok := fromByName[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var out []TableComparison
+	for _, name := range names {
+		old, inFrom := fromByName[name]
+		new, inTo := toByName[name]
+
+		c := TableComparison{Table: name, Kind: Changed}
+		switch {
+		case !inFrom:
+			c.Kind = Added
+		case !inTo:
+			c.Kind = Removed
+		}
+		old = migrate.AlignSerialColumns(old, new)
+		c.Columns = compareColumns(old, new)
+		c.Indexes = compareItems(indexDefinitions(old), indexDefinitions(new))
+		c.Checks = compareItems(checkDefinitions(old), checkDefinitions(new))
+		c.Storage = compareItems(storageDefinitions(old), storageDefinitions(new))
+		c.Triggers = compareItems(triggerDefinitions(old), triggerDefinitions(new))
+
+		if c.Kind == Changed && len(c.Columns) == 0 && len(c.Indexes) == 0 && len(c.Checks) == 0 &&
+			len(c.Storage) == 0 && len(c.Triggers) == 0 {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func compareColumns(old, new migrate.TableSchema) []ColumnChange {
+	oldCols := make(map[string]migrate.ColumnMeta, len(old.Columns))
+	for _, c := range old.Columns {
+		oldCols[c.ColumnName] = c
+	}
+	newCols := make(map[string]migrate.ColumnMeta, len(new.Columns))
+	for _, c := range new.Columns {
+		newCols[c.ColumnName] = c
+	}
+
+	var out []ColumnChange
+	// Removed columns first, in their old order, then added and changed ones
+	// in the new order.
+	for _, c := range old.Columns {
+		if _, ok := newCols[c.ColumnName]; !ok {
+			out = append(out, ColumnChange{Column: c.ColumnName, Kind: Removed, Definition: describeColumn(c.Attrs)})
+		}
+	}
+	for _, c := range new.Columns {
+		prev, ok := oldCols[c.ColumnName]
+		if !ok {
+			out = append(out, ColumnChange{Column: c.ColumnName, Kind: Added, Definition: describeColumn(c.Attrs)})
+			continue
+		}
+		if attrs := compareAttrs(prev.Attrs, c.Attrs); len(attrs) > 0 {
+			out = append(out, ColumnChange{Column: c.ColumnName, Kind: Changed, Attrs: attrs})
+		}
+	}
+	return out
+}
+
+func compareAttrs(old, new migrate.ColumnAttributes) []AttrChange {
+	var out []AttrChange
+	add := func(name, o, n string) {
+		if o != n {
+			out = append(out, AttrChange{Name: name, Old: o, New: n})
+		}
+	}
+	add("type", old.PgType, new.PgType)
+	add("not null", fmt.Sprint(old.NotNull), fmt.Sprint(new.NotNull))
+	add("unique", fmt.Sprint(old.Unique), fmt.Sprint(new.Unique))
+	if old.Unique && new.Unique {
+		add("nulls not distinct", fmt.Sprint(old.NullsNotDistinct), fmt.Sprint(new.NullsNotDistinct))
+	}
+	add("primary key", fmt.Sprint(old.IsPK), fmt.Sprint(new.IsPK))
+	if !migrate.EqualDefaults(old.Default, new.Default) {
+		out = append(out, AttrChange{Name: "default", Old: describeDefault(old.Default), New: describeDefault(new.Default)})
+	}
+	add("references", describeFK(old.ForeignKey), describeFK(new.ForeignKey))
+	return out
+}
+
+func describeColumn(a migrate.ColumnAttributes) string {
+	parts := []string{a.PgType}
+	if a.IsPK {
+		parts = append(parts, "PRIMARY KEY")
+	} else if a.NotNull {
+		parts = append(parts, "NOT NULL")
+	}
+	if a.Unique {
+		parts = append(parts, "UNIQUE")
+		if a.NullsNotDistinct {
+			parts = append(parts, "NULLS NOT DISTINCT")
+		}
+	}
+	if a.Default != nil {
+		parts = append(parts, "DEFAULT "+*a.Default)
+	}
+	if a.ForeignKey != nil {
+		parts = append(parts, "REFERENCES "+describeFK(a.ForeignKey))
+	}
+	return strings.Join(parts, " ")
+}
+
+func describeDefault(d *string) string {
+	if d == nil {
+		return "none"
+	}
+	return *d
+}
+
+func describeFK(fk *migrate.ForeignKey) string {
+	if fk == nil {
+		return "none"
+	}
+	s := fk.Table + "(" + fk.Column + ")"
+	if m := migrate.NormalizeMatch(fk.Match); m != "" {
+		s += " MATCH " + string(m)
+	}
+	if fk.OnDelete != "" && fk.OnDelete != migrate.NoAction {
+		s += " ON DELETE " + string(fk.OnDelete)
+		if len(fk.OnDeleteColumns) > 0 {
+			s += " (" + strings.Join(fk.OnDeleteColumns, ", ") + ")"
+		}
+	}
+	if fk.OnUpdate != "" && fk.OnUpdate != migrate.NoAction {
+		s += " ON UPDATE " + string(fk.OnUpdate)
+	}
+	if fk.Deferrable || fk.InitiallyDeferred {
+		s += " " + deferralClause(fk)
+	}
+	return s
+}
+
+// indexDefinitions maps index keys to a readable definition.
+func indexDefinitions(t migrate.TableSchema) map[string]string {
+	out := make(map[string]string, len(t.Indexes))
+	for _, idx := range t.Indexes {
+		cols := make([]string, len(idx.Columns))
+		for i, c := range idx.Columns {
+			cols[i] = c
+			if i < len(idx.Opclasses) && idx.Opclasses[i] != "" {
+				cols[i] += " " + idx.Opclasses[i]
+			}
+		}
+		def := "index"
+		if idx.Unique {
+			def = "unique index"
+		}
+		if idx.Name != "" {
+			def += " " + idx.Name
+		}
+		def += " (" + strings.Join(cols, ", ") + ")"
+		if idx.Method != "" && idx.Method != "btree" {
+			def += " using " + idx.Method
+		}
+		if len(idx.With) > 0 {
+			def += " with (" + strings.Join(idx.With, ", ") + ")"
+		}
+		if idx.Tablespace != "" {
+			def += " tablespace " + idx.Tablespace
+		}
+		if idx.Where != nil {
+			def += " where " + *idx.Where
+		}
+		out[indexKey(idx)+"|tablespace="+idx.Tablespace] = def
+	}
+	return out
+}
+
+func checkDefinitions(t migrate.TableSchema) map[string]string {
+	out := make(map[string]string, len(t.Checks))
+	for _, chk := range t.Checks {
+		def := "check"
+		if chk.Name != "" {
+			def += " " + chk.Name
+		}
+		out[checkKey(chk)] = def + " (" + chk.Expr + ")"
+	}
+	return out
+}
+
+func storageDefinitions(t migrate.TableSchema) map[string]string {
+	out := make(map[string]string, len(t.Storage))
+	for _, p := range t.Storage {
+		out[p] = "storage " + p
+	}
+	if t.Tablespace != "" {
+		out["tablespace="+t.Tablespace] = "tablespace " + t.Tablespace
+	}
+	for _, p := range t.Inherits {
+		out["inherits="+p] = "inherits " + p
+	}
+	return out
+}
+
+func triggerDefinitions(t migrate.TableSchema) map[string]string {
+	out := make(map[string]string, len(t.Triggers))
+	for _, trg := range t.Triggers {
+		def := fmt.Sprintf("trigger %s %s %s execute %s()",
+			trg.Name, strings.ToLower(trg.Timing), strings.ToLower(strings.Join(trg.Events, " or ")), trg.Function)
+		out[def] = def
+	}
+	return out
+}
+
+func compareItems(old, new map[string]string) []ItemChange {
+	var out []ItemChange
+	for _, key := range sortedKeys(old) {
+		if _, ok := new[key]; !ok {
+			out = append(out, ItemChange{Kind: Removed, Definition: old[key]})
+		}
+	}
+	for _, key := range sortedKeys(new) {
+		if _, ok := old[key]; !ok {
+			out = append(out, ItemChange{Kind: Added, Definition: new[key]})
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+const (
+	ansiReset  = "\033[0m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+)
+
+// WriteComparison renders comparisons as an indented, optionally colorized
+// list: "+" added, "-" removed, "~" changed.
+func WriteComparison(w io.Writer, comparisons []TableComparison, color bool) error {
+	var b strings.Builder
+	line := func(indent int, kind ChangeKind, text string) {
+		sign, c := "~", ansiYellow
+		switch kind {
+		case Added:
+			sign, c = "+", ansiGreen
+		case Removed:
+			sign, c = "-", ansiRed
+		}
+		b.WriteString(strings.Repeat("    ", indent))
+		if color {
+			b.WriteString(c + sign + " " + text + ansiReset + "\n")
+		} else {
+			b.WriteString(sign + " " + text + "\n")
+		}
+	}
+
+	for _, t := range comparisons {
+		line(0, t.Kind, "table "+t.Table)
+		for _, c := range t.Columns {
+			if c.Kind != Changed {
+				line(1, c.Kind, c.Column+" "+c.Definition)
+				continue
+			}
+			line(1, Changed, c.Column)
+			for _, a := range c.Attrs {
+				fmt.Fprintf(&b, "        %s: %s -> %s\n", a.Name, a.Old, a.New)
+			}
+		}
+		for _, i := range t.Indexes {
+			line(1, i.Kind, i.Definition)
+		}
+		for _, i := range t.Checks {
+			line(1, i.Kind, i.Definition)
+		}
+		for _, i := range t.Storage {
+			line(1, i.Kind, i.Definition)
+		}
+		for _, i := range t.Triggers {
+			line(1, i.Kind, i.Definition)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
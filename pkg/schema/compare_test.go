@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	now := "now()"
+	from := []migrate.TableSchema{
+		{
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+				{ColumnName: "email", Attrs: migrate.ColumnAttributes{PgType: "varchar(100)"}},
+				{ColumnName: "nickname", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			},
+		},
+		{TableName: "legacy", Columns: []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "integer"}}}},
+		{TableName: "same", Columns: []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "integer"}}}},
+	}
+	to := []migrate.TableSchema{
+		{
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+				{ColumnName: "email", Attrs: migrate.ColumnAttributes{PgType: "text", NotNull: true, Unique: true}},
+				{ColumnName: "created_at", Attrs: migrate.ColumnAttributes{PgType: "timestamptz", NotNull: true, Default: &now}},
+			},
+			Indexes: []migrate.IndexMeta{{Name: "idx_users_created", Columns: []string{"created_at"}}},
+		},
+		{TableName: "same", Columns: []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "int4"}}}},
+	}
+
+	got := Compare(from, to)
+	if len(got) != 2 || got[0].Table != "legacy" || got[0].Kind != Removed || got[1].Table != "users" || got[1].Kind != Changed {
+		t.Fatalf("unexpected comparisons: %+v", got)
+	}
+
+	var b bytes.Buffer
+	if err := WriteComparison(&b, got, false); err != nil {
+		t.Fatal(err)
+	}
+	want := `- table legacy
+    - id integer
+~ table users
+    - nickname text
+    ~ email
+        type: varchar(100) -> text
+        not null: false -> true
+        unique: false -> true
+    + created_at timestamptz NOT NULL DEFAULT now()
+    + index idx_users_created (created_at)
+`
+	if b.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := WriteComparison(&b, got, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), ansiGreen+"+ created_at") {
+		t.Fatalf("expected colorized output:\n%q", b.String())
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	if err := WriteSnapshot(&b, NewSnapshot(graphTables())); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReadSnapshot(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Tables) != 2 || s.Tables[0].TableName != "posts" {
+		t.Fatalf("unexpected snapshot: %+v", s)
+	}
+	if diff := Compare(graphTables(), s.Tables); len(diff) != 0 {
+		t.Fatalf("snapshot must round-trip without changes, got %+v", diff)
+	}
+
+	if _, err := ReadSnapshot(strings.NewReader(`{"version": 99, "tables": []}`)); err == nil {
+		t.Fatal("expected error for unsupported version")
+	}
+}
@@ -3,11 +3,32 @@ package schema
 import (
 	"fmt"
 	"github.com/amr0ny/migrateme/pkg/migrate"
+	"slices"
 	"sort"
 	"strings"
 )
 
-type DiffGenerator struct{}
+type DiffGenerator struct {
+	// DeferForeignKey, when set, reports foreign keys that have to be added in
+	// the post pass because the referenced table is created later in the same
+	// migration.
+	DeferForeignKey func(table string, col migrate.ColumnMeta) bool
+
+	// DeferrableForeignKeys makes deferred foreign keys DEFERRABLE INITIALLY
+	// DEFERRED, so rows referencing each other can be inserted in one
+	// transaction.
+	DeferrableForeignKeys bool
+
+	// AllowNarrowing generates type changes that shrink a length, precision
+	// or scale (see IsNarrowingChange). They are skipped by default, so only
+	// widening changes are applied.
+	AllowNarrowing bool
+
+	// Template, when set, returns the declared schema of a table new tables
+	// are created LIKE (see migrate.TableOptions.Like). Without it, or when
+	// the template is unknown, such tables are created column by column.
+	Template func(table string) (migrate.TableSchema, bool)
+}
 
 func NewDiffGenerator() *DiffGenerator {
 	return &DiffGenerator{}
@@ -27,7 +48,9 @@ func (g *DiffGenerator) DiffSchemas(old, new migrate.TableSchema) migrate.TableD
 		return g.generateCreateTableDiff(new)
 	}
 
-	for _, name := range sortedColumnNames(newCols) {
+	// Columns are visited in declared (for the database: ordinal) order, so
+	// the generated SQL is stable and follows the entity definition.
+	for _, name := range columnNames(new.Columns) {
 		newCol := newCols[name]
 		oldCol, exists := oldCols[name]
 		if !exists {
@@ -37,7 +60,7 @@ func (g *DiffGenerator) DiffSchemas(old, new migrate.TableSchema) migrate.TableD
 		g.handleChangedColumn(&mig, new.TableName, oldCol, newCol, pushUp, pushDownFront)
 	}
 
-	for _, name := range sortedColumnNames(oldCols) {
+	for _, name := range columnNames(old.Columns) {
 		oldCol := oldCols[name]
 		if _, exists := newCols[name]; !exists {
 			g.handleRemovedColumn(&mig, old.TableName, oldCol, pushUp, pushDownFront)
@@ -52,11 +75,25 @@ func (g *DiffGenerator) DiffSchemas(old, new migrate.TableSchema) migrate.TableD
 
 	g.handleIndexChanges(&mig, old, new, pushUp, pushDownFront, pushDown)
 	g.handleCheckChanges(&mig, old, new, pushUp, pushDownFront, pushDown)
+	g.handleStorageChanges(old, new, pushUp, pushDownFront)
+	g.handleInheritsChanges(old, new, pushUp, pushDownFront)
+	g.handleTriggerChanges(old, new, pushUp, pushDownFront, pushDown)
+	if old.Tablespace != new.Tablespace {
+		table := quoteIdent(new.TableName)
+		pushUp(fmt.Sprintf("ALTER TABLE %s SET TABLESPACE %s", table, tablespaceName(new.Tablespace)))
+		pushDownFront(fmt.Sprintf("ALTER TABLE %s SET TABLESPACE %s", table, tablespaceName(old.Tablespace)))
+	}
 
 	return mig
 }
 
 func (g *DiffGenerator) generateCreateTableDiff(new migrate.TableSchema) migrate.TableDiff {
+	if new.Like != "" && g.Template != nil {
+		if tmpl, ok := g.Template(new.Like); ok && len(tmpl.Columns) > 0 {
+			return g.generateCreateLikeDiff(new, tmpl)
+		}
+	}
+
 	mig := migrate.TableDiff{}
 
 	columns := make([]string, 0, len(new.Columns))
@@ -73,8 +110,8 @@ func (g *DiffGenerator) generateCreateTableDiff(new migrate.TableSchema) migrate
 
 		if c.Attrs.Unique {
 			constrName := uniqueConstraintName(new.TableName, c.ColumnName)
-			constraints = append(constraints, fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)",
-				quoteIdent(constrName), quoteIdent(c.ColumnName)))
+			constraints = append(constraints, fmt.Sprintf("CONSTRAINT %s %s",
+				quoteIdent(constrName), uniqueClause(c)))
 		}
 	}
 
@@ -86,14 +123,21 @@ func (g *DiffGenerator) generateCreateTableDiff(new migrate.TableSchema) migrate
 	columns = append(columns, constraints...)
 
 	createStmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n  %s\n)",
-		quoteIdent(new.TableName), strings.Join(columns, ",\n  "))
+		quoteIdent(new.TableName), strings.Join(columns, ",\n  ")) + tableClauses(new)
 
 	mig.Up = append(mig.Up, createStmt)
 	mig.Down = append([]string{fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE",
 		quoteIdent(new.TableName))}, mig.Down...)
 
+	// Self-referencing foreign keys are added last, once the indexes exist:
+	// the referenced column may be unique only through one of them.
+	var selfRefs []migrate.ColumnMeta
 	for _, c := range new.Columns {
-		if c.Attrs.ForeignKey != nil {
+		switch {
+		case c.Attrs.ForeignKey == nil:
+		case isSelfReference(new.TableName, c):
+			selfRefs = append(selfRefs, c)
+		default:
 			g.addForeignKey(&mig, new.TableName, c)
 		}
 	}
@@ -113,12 +157,164 @@ func (g *DiffGenerator) generateCreateTableDiff(new migrate.TableSchema) migrate
 		if strings.TrimSpace(name) == "" {
 			name = defaultIndexName(new.TableName, idx.Columns)
 		}
-		mig.Up = append(mig.Up, g.createIndexStatement(new.TableName, name, idx.Columns, idx.Unique, idx.Where))
+		mig.Up = append(mig.Up, g.createIndexStatement(new.TableName, name, idx))
+	}
+
+	for _, c := range selfRefs {
+		g.addForeignKey(&mig, new.TableName, c)
+	}
+
+	for _, trg := range new.Triggers {
+		mig.Up = append(mig.Up, createTriggerStatements(new.TableName, trg)...)
 	}
 
 	return mig
 }
 
+// generateCreateLikeDiff creates new with LIKE its template INCLUDING ALL,
+// then generates what new declares beyond the template by diffing the two.
+// LIKE copies no foreign keys, so the template's are added by the diff too.
+func (g *DiffGenerator) generateCreateLikeDiff(new, tmpl migrate.TableSchema) migrate.TableDiff {
+	base := tmpl
+	base.TableName = new.TableName
+	base.Columns = make([]migrate.ColumnMeta, len(tmpl.Columns))
+	for i, c := range tmpl.Columns {
+		c.Attrs.ForeignKey = nil
+		base.Columns[i] = c
+	}
+	base.Storage, base.Tablespace, base.Inherits = new.Storage, new.Tablespace, new.Inherits
+	// Nor triggers.
+	base.Triggers = nil
+
+	rest := g.DiffSchemas(base, new)
+	createStmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING ALL)",
+		quoteIdent(new.TableName), quoteIdent(new.Like)) + tableClauses(new)
+	return migrate.TableDiff{
+		Up:   append([]string{createStmt}, rest.Up...),
+		Down: []string{fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", quoteIdent(new.TableName))},
+	}
+}
+
+// tableClauses returns the INHERITS, WITH and TABLESPACE clauses that follow
+// the column list of CREATE TABLE.
+func tableClauses(t migrate.TableSchema) string {
+	var out string
+	if len(t.Inherits) > 0 {
+		parents := make([]string, len(t.Inherits))
+		for i, p := range t.Inherits {
+			parents[i] = quoteIdent(p)
+		}
+		out += " INHERITS (" + strings.Join(parents, ", ") + ")"
+	}
+	if len(t.Storage) > 0 {
+		out += " WITH (" + storageParams(t.Storage) + ")"
+	}
+	if t.Tablespace != "" {
+		out += " TABLESPACE " + quoteIdent(t.Tablespace)
+	}
+	return out
+}
+
+// handleInheritsChanges attaches the table to added parents and detaches it
+// from removed ones.
+func (g *DiffGenerator) handleInheritsChanges(old, new migrate.TableSchema, pushUp, pushDownFront func(string)) {
+	table := quoteIdent(new.TableName)
+	for _, p := range new.Inherits {
+		if !slices.Contains(old.Inherits, p) {
+			pushUp(fmt.Sprintf("ALTER TABLE %s INHERIT %s", table, quoteIdent(p)))
+			pushDownFront(fmt.Sprintf("ALTER TABLE %s NO INHERIT %s", table, quoteIdent(p)))
+		}
+	}
+	for _, p := range old.Inherits {
+		if !slices.Contains(new.Inherits, p) {
+			pushUp(fmt.Sprintf("ALTER TABLE %s NO INHERIT %s", table, quoteIdent(p)))
+			pushDownFront(fmt.Sprintf("ALTER TABLE %s INHERIT %s", table, quoteIdent(p)))
+		}
+	}
+}
+
+// handleTriggerChanges creates added triggers, drops removed ones and
+// recreates triggers whose timing, events or function changed. Trigger
+// functions are created with their trigger but never dropped: other tables
+// may call them.
+func (g *DiffGenerator) handleTriggerChanges(old, new migrate.TableSchema, pushUp, pushDownFront, pushDown func(string)) {
+	oldByName := make(map[string]migrate.TriggerMeta, len(old.Triggers))
+	for _, trg := range old.Triggers {
+		oldByName[trg.Name] = trg
+	}
+	newByName := make(map[string]migrate.TriggerMeta, len(new.Triggers))
+	for _, trg := range new.Triggers {
+		newByName[trg.Name] = trg
+	}
+
+	for _, trg := range new.Triggers {
+		prev, exists := oldByName[trg.Name]
+		if exists && triggersEqual(prev, trg) {
+			continue
+		}
+		if exists {
+			pushUp(dropTriggerStatement(old.TableName, prev))
+		}
+		for _, stmt := range createTriggerStatements(new.TableName, trg) {
+			pushUp(stmt)
+		}
+		if exists {
+			restore := createTriggerStatement(old.TableName, prev)
+			for i := len(restore) - 1; i >= 0; i-- {
+				pushDownFront(restore[i])
+			}
+		}
+		pushDownFront(dropTriggerStatement(new.TableName, trg))
+	}
+	for _, trg := range old.Triggers {
+		if _, ok := newByName[trg.Name]; ok {
+			continue
+		}
+		pushUp(dropTriggerStatement(old.TableName, trg))
+		for _, stmt := range createTriggerStatement(old.TableName, trg) {
+			pushDown(stmt)
+		}
+	}
+}
+
+func triggersEqual(a, b migrate.TriggerMeta) bool {
+	return a.Timing == b.Timing && a.Function == b.Function &&
+		strings.Join(a.Events, ",") == strings.Join(b.Events, ",")
+}
+
+// TriggerComment marks the triggers the generator creates; the Fetcher
+// reads only those, so triggers created by hand are never dropped.
+const TriggerComment = "managed by migrateme"
+
+// createTriggerStatements creates the function of trg, when declared, and
+// trg.
+func createTriggerStatements(table string, trg migrate.TriggerMeta) []string {
+	var out []string
+	if trg.FunctionSQL != "" {
+		out = append(out, trg.FunctionSQL)
+	}
+	return append(out, createTriggerStatement(table, trg)...)
+}
+
+// createTriggerStatement creates trg, marked with TriggerComment.
+func createTriggerStatement(table string, trg migrate.TriggerMeta) []string {
+	return []string{
+		fmt.Sprintf("CREATE TRIGGER %s %s %s ON %s FOR EACH ROW EXECUTE FUNCTION %s()",
+			quoteIdent(trg.Name), trg.Timing, strings.Join(trg.Events, " OR "), quoteIdent(table), quoteIdent(trg.Function)),
+		fmt.Sprintf("COMMENT ON TRIGGER %s ON %s IS '%s'",
+			quoteIdent(trg.Name), quoteIdent(table), quoteLiteral(TriggerComment)),
+	}
+}
+
+func dropTriggerStatement(table string, trg migrate.TriggerMeta) string {
+	return fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s", quoteIdent(trg.Name), quoteIdent(table))
+}
+
+// isSelfReference reports whether col is a foreign key to its own table.
+func isSelfReference(table string, col migrate.ColumnMeta) bool {
+	return col.Attrs.ForeignKey != nil && col.Attrs.ForeignKey.Table == table
+}
+
 func (g *DiffGenerator) handleCheckChanges(
 	mig *migrate.TableDiff,
 	old, new migrate.TableSchema,
@@ -199,7 +395,7 @@ func (g *DiffGenerator) handleIndexChanges(
 			name = defaultIndexName(new.TableName, newIdx.Columns)
 		}
 
-		pushUp(g.createIndexStatement(new.TableName, name, newIdx.Columns, newIdx.Unique, newIdx.Where))
+		pushUp(g.createIndexStatement(new.TableName, name, newIdx))
 		pushDownFront(fmt.Sprintf(`DROP INDEX IF EXISTS %s`, quoteIdent(name)))
 	}
 
@@ -217,8 +413,44 @@ func (g *DiffGenerator) handleIndexChanges(
 		}
 
 		pushUp(fmt.Sprintf(`DROP INDEX IF EXISTS %s`, quoteIdent(name)))
-		pushDown(g.createIndexStatement(old.TableName, name, oldIdx.Columns, oldIdx.Unique, oldIdx.Where))
+		pushDown(g.createIndexStatement(old.TableName, name, oldIdx))
 	}
+
+	// Indexes moved to another tablespace are moved in place rather than
+	// rebuilt.
+	for _, key := range sortedIndexKeys(newByKey) {
+		newIdx := newByKey[key]
+		oldIdx, exists := oldByKey[key]
+		if !exists || oldIdx.Tablespace == newIdx.Tablespace {
+			continue
+		}
+
+		name := oldIdx.Name
+		if strings.TrimSpace(name) == "" {
+			name = defaultIndexName(old.TableName, oldIdx.Columns)
+		}
+
+		pushUp(fmt.Sprintf("ALTER INDEX %s SET TABLESPACE %s", quoteIdent(name), tablespaceName(newIdx.Tablespace)))
+		pushDownFront(fmt.Sprintf("ALTER INDEX %s SET TABLESPACE %s", quoteIdent(name), tablespaceName(oldIdx.Tablespace)))
+	}
+}
+
+// indexColumn quotes an index column; expressions, like lower(email), are
+// written as declared.
+func indexColumn(c string) string {
+	if strings.Contains(c, "(") {
+		return "(" + c + ")"
+	}
+	return quoteIdent(c)
+}
+
+// tablespaceName quotes a tablespace for SET TABLESPACE; empty is the
+// database default.
+func tablespaceName(name string) string {
+	if name == "" {
+		return "pg_default"
+	}
+	return quoteIdent(name)
 }
 
 func indexKey(idx migrate.IndexMeta) string {
@@ -226,7 +458,13 @@ func indexKey(idx migrate.IndexMeta) string {
 	if idx.Where != nil {
 		where = strings.TrimSpace(*idx.Where)
 	}
-	return fmt.Sprintf("unique=%t|cols=%s|where=%s", idx.Unique, strings.Join(idx.Columns, "\x1f"), where)
+	method := idx.Method
+	if method == "" {
+		method = "btree"
+	}
+	return fmt.Sprintf("unique=%t|method=%s|cols=%s|ops=%s|with=%s|where=%s",
+		idx.Unique, method, strings.Join(idx.Columns, "\x1f"), strings.Join(idx.Opclasses, "\x1f"),
+		strings.Join(idx.With, ","), where)
 }
 
 func defaultIndexName(table string, cols []string) string {
@@ -247,30 +485,108 @@ func defaultIndexName(table string, cols []string) string {
 	return base
 }
 
-func (g *DiffGenerator) createIndexStatement(table, name string, cols []string, unique bool, where *string) string {
-	parts := make([]string, 0, len(cols))
-	for _, c := range cols {
-		parts = append(parts, quoteIdent(c))
+func (g *DiffGenerator) createIndexStatement(table, name string, idx migrate.IndexMeta) string {
+	parts := make([]string, 0, len(idx.Columns))
+	for i, c := range idx.Columns {
+		part := indexColumn(c)
+		if i < len(idx.Opclasses) && idx.Opclasses[i] != "" {
+			part += " " + idx.Opclasses[i]
+		}
+		parts = append(parts, part)
 	}
 
 	uniq := ""
-	if unique {
+	if idx.Unique {
 		uniq = "UNIQUE "
 	}
 
+	using := ""
+	if m := strings.ToLower(strings.TrimSpace(idx.Method)); m != "" && m != "btree" {
+		using = "USING " + m + " "
+	}
+
 	stmt := fmt.Sprintf(
-		`CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)`,
+		`CREATE %sINDEX IF NOT EXISTS %s ON %s %s(%s)`,
 		uniq,
 		quoteIdent(name),
 		quoteIdent(table),
+		using,
 		strings.Join(parts, ", "),
 	)
-	if where != nil && strings.TrimSpace(*where) != "" {
-		stmt += " WHERE " + strings.TrimSpace(*where)
+	if len(idx.With) > 0 {
+		stmt += " WITH (" + storageParams(idx.With) + ")"
+	}
+	if idx.Tablespace != "" {
+		stmt += " TABLESPACE " + quoteIdent(idx.Tablespace)
+	}
+	if idx.Where != nil && strings.TrimSpace(*idx.Where) != "" {
+		stmt += " WHERE " + strings.TrimSpace(*idx.Where)
 	}
 	return stmt
 }
 
+// storageParams formats "key=value" storage parameters for a WITH or SET
+// clause.
+func storageParams(params []string) string {
+	out := make([]string, 0, len(params))
+	for _, p := range params {
+		k, v, _ := strings.Cut(p, "=")
+		out = append(out, fmt.Sprintf("%s = %s", k, v))
+	}
+	return strings.Join(out, ", ")
+}
+
+// handleStorageChanges sets the storage parameters that are added or
+// changed and resets the removed ones.
+func (g *DiffGenerator) handleStorageChanges(old, new migrate.TableSchema, pushUp, pushDownFront func(string)) {
+	oldParams := storageMap(old.Storage)
+	newParams := storageMap(new.Storage)
+
+	var set, reset, restore, unset []string
+	for _, p := range new.Storage {
+		k, v, _ := strings.Cut(p, "=")
+		prev, existed := oldParams[k]
+		switch {
+		case !existed:
+			set = append(set, p)
+			unset = append(unset, k)
+		case prev != v:
+			set = append(set, p)
+			restore = append(restore, k+"="+prev)
+		}
+	}
+	for _, p := range old.Storage {
+		k, _, _ := strings.Cut(p, "=")
+		if _, ok := newParams[k]; !ok {
+			reset = append(reset, k)
+			restore = append(restore, p)
+		}
+	}
+
+	table := quoteIdent(new.TableName)
+	if len(set) > 0 {
+		pushUp(fmt.Sprintf("ALTER TABLE %s SET (%s)", table, storageParams(set)))
+	}
+	if len(reset) > 0 {
+		pushUp(fmt.Sprintf("ALTER TABLE %s RESET (%s)", table, strings.Join(reset, ", ")))
+	}
+	if len(unset) > 0 {
+		pushDownFront(fmt.Sprintf("ALTER TABLE %s RESET (%s)", table, strings.Join(unset, ", ")))
+	}
+	if len(restore) > 0 {
+		pushDownFront(fmt.Sprintf("ALTER TABLE %s SET (%s)", table, storageParams(restore)))
+	}
+}
+
+func storageMap(params []string) map[string]string {
+	out := make(map[string]string, len(params))
+	for _, p := range params {
+		k, v, _ := strings.Cut(p, "=")
+		out[k] = v
+	}
+	return out
+}
+
 func checkKey(chk migrate.CheckMeta) string {
 	// Name is not part of identity; expr defines semantics.
 	return fmt.Sprintf("expr=%s", strings.TrimSpace(chk.Expr))
@@ -362,10 +678,17 @@ END $$;`, quoteIdent(table), quoteIdent(col.ColumnName), quoteIdent(table), quot
 
 func (g *DiffGenerator) handleChangedColumn(mig *migrate.TableDiff, table string, oldCol, newCol migrate.ColumnMeta, pushUp, pushDownFront func(string)) {
 
-	if oldCol.Attrs.PgType != newCol.Attrs.PgType {
-		up := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s",
-			quoteIdent(table), quoteIdent(newCol.ColumnName), newCol.Attrs.PgType,
-			quoteIdent(newCol.ColumnName), newCol.Attrs.PgType)
+	if oldCol.Attrs.PgType != newCol.Attrs.PgType &&
+		(g.AllowNarrowing || !IsNarrowingChange(oldCol.Attrs.PgType, newCol.Attrs.PgType)) {
+		using := fmt.Sprintf("%s::%s", quoteIdent(newCol.ColumnName), newCol.Attrs.PgType)
+		if newCol.Using != "" {
+			using = newCol.Using
+		}
+		up := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s",
+			quoteIdent(table), quoteIdent(newCol.ColumnName), newCol.Attrs.PgType, using)
+		if IsLossyTypeChange(oldCol.Attrs.PgType, newCol.Attrs.PgType) {
+			up = lossyChangeComment(table, oldCol, newCol, using) + up
+		}
 		down := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s",
 			quoteIdent(table), quoteIdent(newCol.ColumnName), oldCol.Attrs.PgType,
 			quoteIdent(newCol.ColumnName), oldCol.Attrs.PgType)
@@ -404,7 +727,7 @@ END $$;`, quoteIdent(table), quoteIdent(newCol.ColumnName), quoteIdent(table), q
 	if newCol.Attrs.Default != nil {
 		newDef = *newCol.Attrs.Default
 	}
-	if oldDef != newDef {
+	if !migrate.EqualDefaults(oldCol.Attrs.Default, newCol.Attrs.Default) {
 		if newCol.Attrs.Default != nil {
 			pushUp(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s",
 				quoteIdent(table), quoteIdent(newCol.ColumnName), newDef))
@@ -428,17 +751,64 @@ END $$;`, quoteIdent(table), quoteIdent(newCol.ColumnName), quoteIdent(table), q
 		} else {
 			g.dropUniqueConstraint(mig, table, oldCol, pushUp, pushDownFront)
 		}
+	} else if newCol.Attrs.Unique && oldCol.Attrs.NullsNotDistinct != newCol.Attrs.NullsNotDistinct {
+		// NULLS NOT DISTINCT cannot be altered; the constraint is recreated.
+		g.dropUniqueConstraint(mig, table, oldCol, pushUp, pushDownFront)
+		g.addUniqueConstraint(mig, table, newCol, pushUp, pushDownFront)
 	}
 
 	g.handleForeignKeyChanges(mig, table, oldCol, newCol, pushUp, pushDownFront)
 }
 
+// UnsafeTypeChanges returns the lossy type changes from old to new that
+// have no using= expression. Narrowing changes count only when
+// AllowNarrowing is set, since they are skipped otherwise.
+func (g *DiffGenerator) UnsafeTypeChanges(old, new migrate.TableSchema) []TypeChange {
+	oldCols := makeColumnMap(old.Columns)
+	var out []TypeChange
+	for _, col := range new.Columns {
+		oldCol, ok := oldCols[col.ColumnName]
+		if !ok || col.Using != "" {
+			continue
+		}
+		kind := ClassifyTypeChange(oldCol.Attrs.PgType, col.Attrs.PgType)
+		if kind == TypeChangeLossy || (kind == TypeChangeNarrowing && g.AllowNarrowing) {
+			out = append(out, TypeChange{
+				Table:  new.TableName,
+				Column: col.ColumnName,
+				From:   oldCol.Attrs.PgType,
+				To:     col.Attrs.PgType,
+				Kind:   kind,
+			})
+		}
+	}
+	return out
+}
+
+// lossyChangeComment warns about a type change that may lose data and gives
+// a query counting the rows whose value does not survive the conversion.
+func lossyChangeComment(table string, oldCol, newCol migrate.ColumnMeta, using string) string {
+	col := quoteIdent(newCol.ColumnName)
+	return fmt.Sprintf(`-- WARNING: changing %s.%s from %s to %s may lose data.
+-- Rows whose value changes or fails to convert:
+--   SELECT count(*) FROM %s WHERE %s IS NOT NULL AND (%s)::%s IS DISTINCT FROM %s;
+`, quoteIdent(table), col, oldCol.Attrs.PgType, newCol.Attrs.PgType,
+		quoteIdent(table), col, using, oldCol.Attrs.PgType, col)
+}
+
 func (g *DiffGenerator) handleRemovedColumn(mig *migrate.TableDiff, table string, oldCol migrate.ColumnMeta, pushUp, pushDownFront func(string)) {
 
 	pushUp(fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s",
 		quoteIdent(table), quoteIdent(oldCol.ColumnName)))
 
-	down := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s",
+	// Dropping the column drops the sequence it owns, so the down migration
+	// recreates it first: the restored default calls nextval on it.
+	down := ""
+	if seq := oldCol.Attrs.Sequence; seq != nil {
+		down = createSequenceStatement(*seq) + "; "
+	}
+
+	down += fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s",
 		quoteIdent(table), quoteIdent(oldCol.ColumnName), oldCol.Attrs.PgType)
 
 	if oldCol.Attrs.Default != nil {
@@ -448,6 +818,14 @@ func (g *DiffGenerator) handleRemovedColumn(mig *migrate.TableDiff, table string
 		down += " NOT NULL"
 	}
 
+	if seq := oldCol.Attrs.Sequence; seq != nil {
+		down += fmt.Sprintf("; ALTER SEQUENCE %s OWNED BY %s.%s",
+			quoteIdent(seq.Name), quoteIdent(table), quoteIdent(oldCol.ColumnName))
+		if seq.LastValue != nil {
+			down += fmt.Sprintf("; SELECT setval('%s', %d, true)", quoteLiteral(quoteIdent(seq.Name)), *seq.LastValue)
+		}
+	}
+
 	if oldCol.Attrs.IsPK {
 		down += fmt.Sprintf("; ALTER TABLE %s ADD CONSTRAINT %s PRIMARY KEY (%s)",
 			quoteIdent(table), quoteIdent(pkConstraintName(table)), quoteIdent(oldCol.ColumnName))
@@ -455,28 +833,45 @@ func (g *DiffGenerator) handleRemovedColumn(mig *migrate.TableDiff, table string
 	if oldCol.Attrs.Unique {
 		constrName := g.getConstraintName(oldCol, uniqueConstraintName(table, oldCol.ColumnName))
 		down += fmt.Sprintf("; %s", addConstraintIfNotExists(
-			fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (%s)",
-				quoteIdent(table), quoteIdent(constrName), quoteIdent(oldCol.ColumnName)),
+			fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s",
+				quoteIdent(table), quoteIdent(constrName), uniqueClause(oldCol)),
 			constrName))
 	}
 	if oldCol.Attrs.ForeignKey != nil {
 		fk := oldCol.Attrs.ForeignKey
 		constrName := g.getConstraintName(oldCol, fkConstraintName(table, oldCol.ColumnName))
 		down += fmt.Sprintf("; %s", addConstraintIfNotExists(
-			fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s) ON DELETE %s ON UPDATE %s",
-				quoteIdent(table), quoteIdent(constrName), quoteIdent(oldCol.ColumnName),
-				quoteIdent(fk.Table), quoteIdent(fk.Column),
-				getForeignKeyAction(fk.OnDelete), getForeignKeyAction(fk.OnUpdate)),
+			fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) %s",
+				quoteIdent(table), quoteIdent(constrName), quoteIdent(oldCol.ColumnName), foreignKeyClause(fk)),
 			constrName))
 	}
+	if oldCol.Attrs.Comment != nil {
+		down += fmt.Sprintf("; COMMENT ON COLUMN %s.%s IS '%s'",
+			quoteIdent(table), quoteIdent(oldCol.ColumnName), quoteLiteral(*oldCol.Attrs.Comment))
+	}
 
 	pushDownFront(down)
 }
 
+// createSequenceStatement recreates a sequence with the options it was
+// fetched with. Its position is restored separately, with setval.
+func createSequenceStatement(seq migrate.SequenceMeta) string {
+	cycle := "NO CYCLE"
+	if seq.Cycle {
+		cycle = "CYCLE"
+	}
+	typ := ""
+	if seq.Type != "" {
+		typ = " AS " + seq.Type
+	}
+	return fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS %s%s INCREMENT BY %d MINVALUE %d MAXVALUE %d START WITH %d %s",
+		quoteIdent(seq.Name), typ, seq.Increment, seq.Min, seq.Max, seq.Start, cycle)
+}
+
 func (g *DiffGenerator) addUniqueConstraint(mig *migrate.TableDiff, table string, col migrate.ColumnMeta, pushUp, pushDownFront func(string)) {
 	constrName := uniqueConstraintName(table, col.ColumnName)
-	addUnique := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (%s)",
-		quoteIdent(table), quoteIdent(constrName), quoteIdent(col.ColumnName))
+	addUnique := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s",
+		quoteIdent(table), quoteIdent(constrName), uniqueClause(col))
 	pushUp(addConstraintIfNotExists(addUnique, constrName))
 	pushDownFront(dropConstraintIfExists(table, constrName))
 }
@@ -484,18 +879,32 @@ func (g *DiffGenerator) addUniqueConstraint(mig *migrate.TableDiff, table string
 func (g *DiffGenerator) dropUniqueConstraint(mig *migrate.TableDiff, table string, col migrate.ColumnMeta, pushUp, pushDownFront func(string)) {
 	constrName := g.getConstraintName(col, uniqueConstraintName(table, col.ColumnName))
 	pushUp(dropConstraintIfExists(table, constrName))
-	pushDownFront(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (%s)",
-		quoteIdent(table), quoteIdent(constrName), quoteIdent(col.ColumnName)))
+	pushDownFront(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s",
+		quoteIdent(table), quoteIdent(constrName), uniqueClause(col)))
+}
+
+// uniqueClause returns the UNIQUE constraint of a single column.
+func uniqueClause(col migrate.ColumnMeta) string {
+	if col.Attrs.NullsNotDistinct {
+		return fmt.Sprintf("UNIQUE NULLS NOT DISTINCT (%s)", quoteIdent(col.ColumnName))
+	}
+	return fmt.Sprintf("UNIQUE (%s)", quoteIdent(col.ColumnName))
 }
 
 func (g *DiffGenerator) addForeignKey(mig *migrate.TableDiff, table string, col migrate.ColumnMeta) {
 	fk := col.Attrs.ForeignKey
 	constrName := fkConstraintName(table, col.ColumnName)
-	addFK := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s) ON DELETE %s ON UPDATE %s",
-		quoteIdent(table), quoteIdent(constrName), quoteIdent(col.ColumnName),
-		quoteIdent(fk.Table), quoteIdent(fk.Column),
-		getForeignKeyAction(fk.OnDelete), getForeignKeyAction(fk.OnUpdate))
-	mig.Up = append(mig.Up, addConstraintIfNotExists(addFK, constrName))
+	addFK := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) %s",
+		quoteIdent(table), quoteIdent(constrName), quoteIdent(col.ColumnName), foreignKeyClause(fk))
+	// The table a self-reference points at always exists by now.
+	if g.DeferForeignKey != nil && !isSelfReference(table, col) && g.DeferForeignKey(table, col) {
+		if g.DeferrableForeignKeys && !fk.Deferrable {
+			addFK += " DEFERRABLE INITIALLY DEFERRED"
+		}
+		mig.PostUp = append(mig.PostUp, addConstraintIfNotExists(addFK, constrName))
+	} else {
+		mig.Up = append(mig.Up, addConstraintIfNotExists(addFK, constrName))
+	}
 	mig.Down = append([]string{dropConstraintIfExists(table, constrName)}, mig.Down...)
 }
 
@@ -512,16 +921,22 @@ func (g *DiffGenerator) handleForeignKeyChanges(mig *migrate.TableDiff, table st
 		}
 	}
 
+	if !fkChanged && oldFK != nil && deferralChanged(oldFK, newFK, g.DeferrableForeignKeys) {
+		constrName := g.getConstraintName(oldCol, fkConstraintName(table, oldCol.ColumnName))
+		pushUp(fmt.Sprintf("ALTER TABLE %s ALTER CONSTRAINT %s %s",
+			quoteIdent(table), quoteIdent(constrName), deferralClause(newFK)))
+		pushDownFront(fmt.Sprintf("ALTER TABLE %s ALTER CONSTRAINT %s %s",
+			quoteIdent(table), quoteIdent(constrName), deferralClause(oldFK)))
+	}
+
 	if fkChanged {
 
 		if oldFK != nil {
 			constrName := g.getConstraintName(oldCol, fkConstraintName(table, oldCol.ColumnName))
 			pushUp(dropConstraintIfExists(table, constrName))
 
-			pushDownFront(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s) ON DELETE %s ON UPDATE %s",
-				quoteIdent(table), quoteIdent(constrName), quoteIdent(oldCol.ColumnName),
-				quoteIdent(oldFK.Table), quoteIdent(oldFK.Column),
-				getForeignKeyAction(oldFK.OnDelete), getForeignKeyAction(oldFK.OnUpdate)))
+			pushDownFront(fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) %s",
+				quoteIdent(table), quoteIdent(constrName), quoteIdent(oldCol.ColumnName), foreignKeyClause(oldFK)))
 		}
 
 		if newFK != nil {
@@ -535,7 +950,43 @@ func foreignKeysEqual(a, b *migrate.ForeignKey) bool {
 		return a == b
 	}
 	return normalizeRefIdent(a.Table) == normalizeRefIdent(b.Table) &&
-		normalizeRefIdent(a.Column) == normalizeRefIdent(b.Column)
+		normalizeRefIdent(a.Column) == normalizeRefIdent(b.Column) &&
+		migrate.NormalizeMatch(a.Match) == migrate.NormalizeMatch(b.Match)
+}
+
+// deferralChanged reports whether the DEFERRABLE options of a foreign key
+// differ. With keepDeferrable, foreign keys the generator made deferrable to
+// close a reference cycle are not made immediate again.
+func deferralChanged(old, new *migrate.ForeignKey, keepDeferrable bool) bool {
+	if keepDeferrable && old.Deferrable && !new.Deferrable {
+		return false
+	}
+	return old.Deferrable != new.Deferrable || old.InitiallyDeferred != new.InitiallyDeferred
+}
+
+// foreignKeyClause returns the REFERENCES clause of a foreign key
+// constraint, with its MATCH type, actions and deferral.
+func foreignKeyClause(fk *migrate.ForeignKey) string {
+	s := fmt.Sprintf("REFERENCES %s(%s)", quoteIdent(fk.Table), quoteIdent(fk.Column))
+	if m := migrate.NormalizeMatch(fk.Match); m != "" {
+		s += " MATCH " + string(m)
+	}
+	s += fmt.Sprintf(" ON DELETE %s ON UPDATE %s", deleteAction(fk), getForeignKeyAction(fk.OnUpdate))
+	if fk.Deferrable || fk.InitiallyDeferred {
+		s += " " + deferralClause(fk)
+	}
+	return s
+}
+
+func deferralClause(fk *migrate.ForeignKey) string {
+	switch {
+	case fk.InitiallyDeferred:
+		return "DEFERRABLE INITIALLY DEFERRED"
+	case fk.Deferrable:
+		return "DEFERRABLE INITIALLY IMMEDIATE"
+	default:
+		return "NOT DEFERRABLE"
+	}
 }
 
 func normalizeRefIdent(v string) string {
@@ -596,12 +1047,16 @@ func makeColumnMap(columns []migrate.ColumnMeta) map[string]migrate.ColumnMeta {
 	return m
 }
 
-func sortedColumnNames(columns map[string]migrate.ColumnMeta) []string {
+// columnNames returns column names in slice order, without duplicates.
+func columnNames(columns []migrate.ColumnMeta) []string {
+	seen := make(map[string]bool, len(columns))
 	names := make([]string, 0, len(columns))
-	for name := range columns {
-		names = append(names, name)
+	for _, col := range columns {
+		if !seen[col.ColumnName] {
+			seen[col.ColumnName] = true
+			names = append(names, col.ColumnName)
+		}
 	}
-	sort.Strings(names)
 	return names
 }
 
@@ -659,6 +1114,20 @@ func quoteLiteral(v string) string {
 	return strings.ReplaceAll(v, `'`, `''`)
 }
 
+// deleteAction is the ON DELETE action of fk with its column list, e.g.
+// SET NULL ("author_id").
+func deleteAction(fk *migrate.ForeignKey) string {
+	action := getForeignKeyAction(fk.OnDelete)
+	if len(fk.OnDeleteColumns) == 0 {
+		return action
+	}
+	cols := make([]string, len(fk.OnDeleteColumns))
+	for i, c := range fk.OnDeleteColumns {
+		cols[i] = quoteIdent(c)
+	}
+	return action + " (" + strings.Join(cols, ", ") + ")"
+}
+
 func getForeignKeyAction(action migrate.OnActionType) string {
 	if action == "" {
 		return "NO ACTION"
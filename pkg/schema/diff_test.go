@@ -1,13 +1,14 @@
 package schema
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/amr0ny/migrateme/pkg/migrate"
 )
 
-func TestDiffSchemas_AddedColumnsAreDeterministic(t *testing.T) {
+func TestDiffSchemas_FollowsDeclaredColumnOrder(t *testing.T) {
 	t.Parallel()
 
 	g := NewDiffGenerator()
@@ -15,6 +16,8 @@ func TestDiffSchemas_AddedColumnsAreDeterministic(t *testing.T) {
 		TableName: "demo",
 		Columns: []migrate.ColumnMeta{
 			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid"}},
+			{ColumnName: "y_old", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			{ColumnName: "b_old", Attrs: migrate.ColumnAttributes{PgType: "text"}},
 		},
 	}
 	newSchema := migrate.TableSchema{
@@ -23,22 +26,38 @@ func TestDiffSchemas_AddedColumnsAreDeterministic(t *testing.T) {
 			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid"}},
 			{ColumnName: "z_col", Attrs: migrate.ColumnAttributes{PgType: "text"}},
 			{ColumnName: "a_col", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			{ColumnName: "m_col", Attrs: migrate.ColumnAttributes{PgType: "text"}},
 		},
 	}
 
-	diff := g.DiffSchemas(old, newSchema)
-	if len(diff.Up) < 2 {
-		t.Fatalf("expected >=2 up statements, got %d", len(diff.Up))
+	want := []string{
+		`ADD COLUMN IF NOT EXISTS "z_col"`,
+		`ADD COLUMN IF NOT EXISTS "a_col"`,
+		`ADD COLUMN IF NOT EXISTS "m_col"`,
+		`DROP COLUMN IF EXISTS "y_old"`,
+		`DROP COLUMN IF EXISTS "b_old"`,
 	}
-
-	joined := strings.Join(diff.Up, "\n")
-	idxA := strings.Index(joined, `ADD COLUMN IF NOT EXISTS "a_col"`)
-	idxZ := strings.Index(joined, `ADD COLUMN IF NOT EXISTS "z_col"`)
-	if idxA == -1 || idxZ == -1 {
-		t.Fatalf("expected add statements for a_col and z_col, got:\n%s", joined)
+	// Repeated runs must produce identical output.
+	var first string
+	for i := 0; i < 20; i++ {
+		joined := strings.Join(g.DiffSchemas(old, newSchema).Up, "\n")
+		if i == 0 {
+			first = joined
+		} else if joined != first {
+			t.Fatalf("diff output changed between runs:\n%s\n---\n%s", first, joined)
+		}
 	}
-	if idxA > idxZ {
-		t.Fatalf("expected a_col statement before z_col for deterministic order, got:\n%s", joined)
+
+	prev := -1
+	for _, w := range want {
+		idx := strings.Index(first, w)
+		if idx == -1 {
+			t.Fatalf("expected %q in:\n%s", w, first)
+		}
+		if idx < prev {
+			t.Fatalf("expected declared order %v, got:\n%s", want, first)
+		}
+		prev = idx
 	}
 }
 
@@ -87,6 +106,330 @@ func TestDiffSchemas_FKActionOnlyChangeDoesNotProduceDiff(t *testing.T) {
 	}
 }
 
+func TestDiffSchemas_FKDeferralChange(t *testing.T) {
+	t.Parallel()
+
+	schemaWith := func(fk migrate.ForeignKey) migrate.TableSchema {
+		return migrate.TableSchema{
+			TableName: "child",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "parent_id", Attrs: migrate.ColumnAttributes{PgType: "uuid", ForeignKey: &fk}},
+			},
+		}
+	}
+	immediate := schemaWith(migrate.ForeignKey{Table: "parents", Column: "id"})
+	deferred := schemaWith(migrate.ForeignKey{Table: "parents", Column: "id", Deferrable: true, InitiallyDeferred: true})
+
+	g := NewDiffGenerator()
+	diff := g.DiffSchemas(immediate, deferred)
+	if len(diff.Up) != 1 || diff.Up[0] != `ALTER TABLE "child" ALTER CONSTRAINT "fk_child_parent_id" DEFERRABLE INITIALLY DEFERRED` {
+		t.Errorf("up = %v", diff.Up)
+	}
+	if len(diff.Down) != 1 || diff.Down[0] != `ALTER TABLE "child" ALTER CONSTRAINT "fk_child_parent_id" NOT DEFERRABLE` {
+		t.Errorf("down = %v", diff.Down)
+	}
+
+	// A cycle made deferrable by the generator is not undone.
+	g.DeferrableForeignKeys = true
+	if diff := g.DiffSchemas(deferred, immediate); !diff.IsEmpty() {
+		t.Errorf("expected no diff with DeferrableForeignKeys, got up=%v", diff.Up)
+	}
+	if create := strings.Join(g.DiffSchemas(migrate.TableSchema{}, deferred).Up, "\n"); !strings.Contains(create,
+		`REFERENCES "parents"("id") ON DELETE NO ACTION ON UPDATE NO ACTION DEFERRABLE INITIALLY DEFERRED;`) {
+		t.Errorf("create:\n%s", create)
+	}
+}
+
+func TestDiffSchemas_FKDeleteColumnList(t *testing.T) {
+	t.Parallel()
+
+	attrs := migrate.ParseColumnTag("author_id,type=uuid,fk=users.id,delete=set_default( author_id )")
+	posts := migrate.NormalizeSchema(migrate.TableSchema{
+		TableName: "posts",
+		Columns:   []migrate.ColumnMeta{{ColumnName: "author_id", Attrs: attrs}},
+	})
+
+	up := strings.Join(NewDiffGenerator().DiffSchemas(migrate.TableSchema{}, posts).Up, "\n")
+	if !strings.Contains(up, `REFERENCES "users"("id") ON DELETE SET DEFAULT ("author_id") ON UPDATE NO ACTION`) {
+		t.Errorf("up:\n%s", up)
+	}
+}
+
+func TestDiffSchemas_FKMatchChange(t *testing.T) {
+	t.Parallel()
+
+	schemaWith := func(tag string) migrate.TableSchema {
+		return migrate.NormalizeSchema(migrate.TableSchema{
+			TableName: "shipments",
+			Columns:   []migrate.ColumnMeta{{ColumnName: "order_id", Attrs: migrate.ParseColumnTag(tag)}},
+		})
+	}
+	simple := schemaWith("order_id,type=uuid,fk=orders.id,match=simple")
+	full := schemaWith("order_id,type=uuid,fk=orders.id,match=full")
+
+	g := NewDiffGenerator()
+	if diff := g.DiffSchemas(schemaWith("order_id,type=uuid,fk=orders.id"), simple); !diff.IsEmpty() {
+		t.Errorf("MATCH SIMPLE is the default, got up=%v", diff.Up)
+	}
+	up := strings.Join(g.DiffSchemas(simple, full).Up, "\n")
+	if !strings.Contains(up, `DROP CONSTRAINT IF EXISTS "fk_shipments_order_id"`) ||
+		!strings.Contains(up, `REFERENCES "orders"("id") MATCH FULL ON DELETE`) {
+		t.Errorf("up:\n%s", up)
+	}
+}
+
+func TestDiffSchemas_NullsNotDistinct(t *testing.T) {
+	t.Parallel()
+
+	schemaWith := func(tag string) migrate.TableSchema {
+		return migrate.TableSchema{
+			TableName: "users",
+			Columns:   []migrate.ColumnMeta{{ColumnName: "email", Attrs: migrate.ParseColumnTag(tag)}},
+		}
+	}
+	plain := schemaWith("email,unique")
+	nnd := schemaWith("email,unique,nulls_not_distinct")
+
+	g := NewDiffGenerator()
+	if diff := g.DiffSchemas(nnd, nnd); !diff.IsEmpty() {
+		t.Errorf("unchanged constraint recreated: up=%v", diff.Up)
+	}
+	diff := g.DiffSchemas(plain, nnd)
+	up := strings.Join(diff.Up, "\n")
+	if !strings.Contains(up, `DROP CONSTRAINT IF EXISTS "uc_users_email"`) ||
+		!strings.Contains(up, `ADD CONSTRAINT "uc_users_email" UNIQUE NULLS NOT DISTINCT ("email")`) {
+		t.Errorf("up:\n%s", up)
+	}
+	if len(diff.Down) != 2 || !strings.Contains(diff.Down[1], `ADD CONSTRAINT "uc_users_email" UNIQUE ("email")`) {
+		t.Errorf("down = %v", diff.Down)
+	}
+}
+
+func TestDiffSchemas_StorageParameters(t *testing.T) {
+	t.Parallel()
+
+	schemaWith := func(storage ...string) migrate.TableSchema {
+		return migrate.NormalizeSchema(migrate.TableSchema{
+			TableName: "events",
+			Columns:   []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint"}}},
+			Storage:   storage,
+		})
+	}
+	g := NewDiffGenerator()
+
+	create := g.DiffSchemas(migrate.TableSchema{}, schemaWith("fillfactor=70")).Up[0]
+	if !strings.HasSuffix(create, ") WITH (fillfactor = 70)") {
+		t.Errorf("create = %s", create)
+	}
+
+	diff := g.DiffSchemas(
+		schemaWith("fillfactor=70", "autovacuum_enabled=false"),
+		schemaWith("FillFactor = 80", "autovacuum_vacuum_scale_factor=0.05"),
+	)
+	wantUp := []string{
+		`ALTER TABLE "events" SET (autovacuum_vacuum_scale_factor = 0.05, fillfactor = 80)`,
+		`ALTER TABLE "events" RESET (autovacuum_enabled)`,
+	}
+	wantDown := []string{
+		`ALTER TABLE "events" SET (fillfactor = 70, autovacuum_enabled = false)`,
+		`ALTER TABLE "events" RESET (autovacuum_vacuum_scale_factor)`,
+	}
+	if strings.Join(diff.Up, "\n") != strings.Join(wantUp, "\n") {
+		t.Errorf("up = %q", diff.Up)
+	}
+	if strings.Join(diff.Down, "\n") != strings.Join(wantDown, "\n") {
+		t.Errorf("down = %q", diff.Down)
+	}
+}
+
+func TestDiffSchemas_Tablespace(t *testing.T) {
+	t.Parallel()
+
+	schemaIn := func(tablespace, indexTablespace string) migrate.TableSchema {
+		return migrate.NormalizeSchema(migrate.TableSchema{
+			TableName:  "events",
+			Columns:    []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint"}}},
+			Indexes:    []migrate.IndexMeta{{Name: "idx_events_id", Columns: []string{"id"}, Tablespace: indexTablespace}},
+			Tablespace: tablespace,
+		})
+	}
+	g := NewDiffGenerator()
+
+	create := g.DiffSchemas(migrate.TableSchema{}, schemaIn("fast_ssd", "fast_ssd"))
+	if !strings.HasSuffix(create.Up[0], `) TABLESPACE "fast_ssd"`) {
+		t.Errorf("create = %s", create.Up[0])
+	}
+	if !strings.HasSuffix(create.Up[1], `("id") TABLESPACE "fast_ssd"`) {
+		t.Errorf("create index = %s", create.Up[1])
+	}
+
+	diff := g.DiffSchemas(schemaIn("pg_default", ""), schemaIn("fast_ssd", "fast_ssd"))
+	wantUp := []string{
+		`ALTER INDEX "idx_events_id" SET TABLESPACE "fast_ssd"`,
+		`ALTER TABLE "events" SET TABLESPACE "fast_ssd"`,
+	}
+	wantDown := []string{
+		`ALTER TABLE "events" SET TABLESPACE pg_default`,
+		`ALTER INDEX "idx_events_id" SET TABLESPACE pg_default`,
+	}
+	if strings.Join(diff.Up, "\n") != strings.Join(wantUp, "\n") {
+		t.Errorf("up = %q", diff.Up)
+	}
+	if strings.Join(diff.Down, "\n") != strings.Join(wantDown, "\n") {
+		t.Errorf("down = %q", diff.Down)
+	}
+}
+
+func TestDiffSchemas_CreateLikeTemplate(t *testing.T) {
+	t.Parallel()
+
+	template := migrate.NormalizeSchema(migrate.TableSchema{
+		TableName: "audit_log",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true}},
+			{ColumnName: "user_id", Attrs: migrate.ColumnAttributes{
+				PgType: "bigint", ForeignKey: &migrate.ForeignKey{Table: "users", Column: "id"},
+			}},
+		},
+		Indexes: []migrate.IndexMeta{{Name: "idx_audit_log_user_id", Columns: []string{"user_id"}}},
+	})
+	month := template
+	month.TableName = "audit_log_2026_01"
+	month.Like = "audit_log"
+	month.Inherits = []string{"audit_log"}
+	month.Columns = append(append([]migrate.ColumnMeta{}, template.Columns...),
+		migrate.ColumnMeta{ColumnName: "note", Attrs: migrate.ColumnAttributes{PgType: "text"}})
+	month = migrate.NormalizeSchema(month)
+
+	g := NewDiffGenerator()
+	g.Template = func(table string) (migrate.TableSchema, bool) {
+		return template, table == "audit_log"
+	}
+	diff := g.DiffSchemas(migrate.TableSchema{}, month)
+
+	if len(diff.Up) != 3 {
+		t.Fatalf("up = %q", diff.Up)
+	}
+	if want := `CREATE TABLE IF NOT EXISTS "audit_log_2026_01" (LIKE "audit_log" INCLUDING ALL) INHERITS ("audit_log")`; diff.Up[0] != want {
+		t.Errorf("create = %s", diff.Up[0])
+	}
+	// LIKE copies the index but not the foreign key.
+	if !strings.Contains(diff.Up[1], `FOREIGN KEY ("user_id") REFERENCES "users"("id")`) {
+		t.Errorf("foreign key = %s", diff.Up[1])
+	}
+	if want := `ALTER TABLE "audit_log_2026_01" ADD COLUMN IF NOT EXISTS "note" text`; diff.Up[2] != want {
+		t.Errorf("added column = %s", diff.Up[2])
+	}
+	if len(diff.Down) != 1 || diff.Down[0] != `DROP TABLE IF EXISTS "audit_log_2026_01" CASCADE` {
+		t.Errorf("down = %q", diff.Down)
+	}
+
+	g.Template = nil
+	if create := g.DiffSchemas(migrate.TableSchema{}, month).Up[0]; strings.Contains(create, "LIKE") {
+		t.Errorf("create without a template = %s", create)
+	}
+}
+
+func TestDiffSchemas_InheritsChange(t *testing.T) {
+	t.Parallel()
+
+	schemaOf := func(parents ...string) migrate.TableSchema {
+		return migrate.TableSchema{
+			TableName: "events",
+			Columns:   []migrate.ColumnMeta{{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint"}}},
+			Inherits:  parents,
+		}
+	}
+	diff := NewDiffGenerator().DiffSchemas(schemaOf("base_a"), schemaOf("base_b"))
+	wantUp := []string{
+		`ALTER TABLE "events" INHERIT "base_b"`,
+		`ALTER TABLE "events" NO INHERIT "base_a"`,
+	}
+	wantDown := []string{
+		`ALTER TABLE "events" INHERIT "base_a"`,
+		`ALTER TABLE "events" NO INHERIT "base_b"`,
+	}
+	if strings.Join(diff.Up, "\n") != strings.Join(wantUp, "\n") {
+		t.Errorf("up = %q", diff.Up)
+	}
+	if strings.Join(diff.Down, "\n") != strings.Join(wantDown, "\n") {
+		t.Errorf("down = %q", diff.Down)
+	}
+}
+
+func TestDiffSchemas_UUIDPrimaryKey(t *testing.T) {
+	t.Parallel()
+
+	declared := migrate.NormalizeSchema(migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ParseColumnTag("id,pk_uuid")},
+		},
+	})
+	g := NewDiffGenerator()
+
+	if create := g.DiffSchemas(migrate.TableSchema{}, declared).Up[0]; !strings.Contains(create, `"id" uuid NOT NULL DEFAULT gen_random_uuid()`) {
+		t.Errorf("create = %s", create)
+	}
+	// gen_random_uuid is built in since Postgres 13 and needs pgcrypto only
+	// before; an unknown version (0) is taken as a current server.
+	for _, tt := range []struct {
+		version int
+		want    []string
+	}{
+		{0, []string{}},
+		{120017, []string{"pgcrypto"}},
+		{130000, []string{}},
+		{160002, []string{}},
+	} {
+		if exts := RequiredExtensions(declared, tt.version); !reflect.DeepEqual(exts, tt.want) {
+			t.Errorf("RequiredExtensions(%d) = %v, want %v", tt.version, exts, tt.want)
+		}
+	}
+
+	fetched := declared
+	fetched.Columns = append([]migrate.ColumnMeta(nil), declared.Columns...)
+	qualified := "public.gen_random_uuid()"
+	fetched.Columns[0].Attrs.Default = &qualified
+	if up := g.DiffSchemas(fetched, declared).Up; len(up) != 0 {
+		t.Errorf("qualified default must not diff, got %q", up)
+	}
+}
+
+func TestDiffSchemas_CaseInsensitiveColumns(t *testing.T) {
+	t.Parallel()
+
+	declared := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "email", Attrs: migrate.ParseColumnTag("email,unique,ci")},
+		},
+	}
+	g := NewDiffGenerator()
+
+	citext := migrate.NormalizeSchema(migrate.CaseInsensitiveCitext.Apply(declared))
+	if create := g.DiffSchemas(migrate.TableSchema{}, citext).Up[0]; !strings.Contains(create, `"email" citext`) {
+		t.Errorf("create = %s", create)
+	}
+	if exts := RequiredExtensions(citext, 0); len(exts) != 1 || exts[0] != "citext" {
+		t.Errorf("RequiredExtensions = %v, want [citext]", exts)
+	}
+
+	lower := migrate.NormalizeSchema(migrate.CaseInsensitiveLower.Apply(declared))
+	up := g.DiffSchemas(migrate.TableSchema{}, lower).Up
+	want := `CREATE UNIQUE INDEX IF NOT EXISTS "uq_users_email_lower" ON "users" ((lower(email)))`
+	if len(up) != 2 || up[1] != want || strings.Contains(up[0], "UNIQUE") {
+		t.Errorf("up = %q", up)
+	}
+
+	// The fetched index reads back as pg_get_indexdef writes the expression.
+	fetched := lower
+	fetched.Indexes = []migrate.IndexMeta{{Name: "uq_users_email_lower", Columns: []string{"lower(email)"}, Unique: true}}
+	if diff := g.DiffSchemas(migrate.NormalizeSchema(fetched), lower); !diff.IsEmpty() {
+		t.Errorf("diff = %q", diff.Up)
+	}
+}
+
 func TestAddConstraintIfNotExists_EscapesConstraintName(t *testing.T) {
 	t.Parallel()
 
@@ -95,3 +438,254 @@ func TestAddConstraintIfNotExists_EscapesConstraintName(t *testing.T) {
 		t.Fatalf("expected escaped constraint name in SQL, got:\n%s", stmt)
 	}
 }
+
+func TestDiffSchemas_VectorIndexRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	g := NewDiffGenerator()
+	cols := []migrate.ColumnMeta{
+		{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true}},
+		{ColumnName: "embedding", Attrs: migrate.ColumnAttributes{PgType: "vector(1536)"}},
+	}
+	declared := migrate.TableSchema{
+		TableName: "items",
+		Columns:   cols,
+		Indexes: []migrate.IndexMeta{{
+			Name:      "idx_items_embedding",
+			Columns:   []string{"embedding"},
+			Method:    "hnsw",
+			Opclasses: []string{"vector_cosine_ops"},
+			With:      []string{"m = 16", "ef_construction = 64"},
+		}},
+	}
+	fetched := migrate.TableSchema{
+		TableName: "items",
+		Columns:   cols,
+		Indexes: []migrate.IndexMeta{{
+			Name:      "idx_items_embedding",
+			Columns:   []string{"embedding"},
+			Method:    "hnsw",
+			Opclasses: []string{"vector_cosine_ops"},
+			With:      []string{"m=16", "ef_construction=64"},
+		}},
+	}
+
+	create := g.DiffSchemas(migrate.TableSchema{TableName: "items"}, migrate.NormalizeSchema(declared))
+	want := `CREATE INDEX IF NOT EXISTS "idx_items_embedding" ON "items" USING hnsw ("embedding" vector_cosine_ops) WITH (ef_construction = 64, m = 16)`
+	if !strings.Contains(strings.Join(create.Up, "\n"), want) {
+		t.Fatalf("expected %s, got:\n%s", want, strings.Join(create.Up, "\n"))
+	}
+	if exts := RequiredExtensions(declared, 0); len(exts) != 1 || exts[0] != "vector" {
+		t.Fatalf("RequiredExtensions = %v, want [vector]", exts)
+	}
+
+	diff := g.DiffSchemas(migrate.NormalizeSchema(fetched), migrate.NormalizeSchema(declared))
+	if !diff.IsEmpty() {
+		t.Fatalf("expected no diff, got:\n%s", strings.Join(diff.Up, "\n"))
+	}
+}
+
+func TestDiffSchemas_WidensButSkipsNarrowing(t *testing.T) {
+	t.Parallel()
+
+	table := func(name, code, price string) migrate.TableSchema {
+		return migrate.NormalizeSchema(migrate.TableSchema{
+			TableName: "items",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "name", Attrs: migrate.ColumnAttributes{PgType: name}},
+				{ColumnName: "code", Attrs: migrate.ColumnAttributes{PgType: code}},
+				{ColumnName: "price", Attrs: migrate.ColumnAttributes{PgType: price}},
+			},
+		})
+	}
+	old := table("character varying(50)", "character varying(255)", "numeric(10,2)")
+	newSchema := table("varchar(255)", "varchar(50)", "decimal(12, 4)")
+
+	up := strings.Join(NewDiffGenerator().DiffSchemas(old, newSchema).Up, "\n")
+	for _, want := range []string{
+		`ALTER COLUMN "name" TYPE varchar(255)`,
+		`ALTER COLUMN "price" TYPE numeric(12,4)`,
+	} {
+		if !strings.Contains(up, want) {
+			t.Fatalf("expected %q in:\n%s", want, up)
+		}
+	}
+	if strings.Contains(up, `"code"`) {
+		t.Fatalf("narrowing change must be skipped by default:\n%s", up)
+	}
+
+	g := NewDiffGenerator()
+	g.AllowNarrowing = true
+	if up := strings.Join(g.DiffSchemas(old, newSchema).Up, "\n"); !strings.Contains(up, `ALTER COLUMN "code" TYPE varchar(50)`) {
+		t.Fatalf("expected the narrowing change with AllowNarrowing:\n%s", up)
+	}
+	if diff := NewDiffGenerator().DiffSchemas(old, old); !diff.IsEmpty() {
+		t.Fatalf("unchanged lengths must not produce a diff, got %q", diff.Up)
+	}
+}
+
+func TestDiffSchemas_AliasesProduceNoChanges(t *testing.T) {
+	t.Parallel()
+
+	seq := "nextval('events_id_seq'::regclass)"
+	declared := migrate.NormalizeSchema(migrate.TableSchema{
+		TableName: "events",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigserial", IsPK: true, NotNull: true}},
+			{ColumnName: "count", Attrs: migrate.ColumnAttributes{PgType: "int4"}},
+			{ColumnName: "active", Attrs: migrate.ColumnAttributes{PgType: "bool"}},
+			{ColumnName: "score", Attrs: migrate.ColumnAttributes{PgType: "float8"}},
+			{ColumnName: "at", Attrs: migrate.ColumnAttributes{PgType: "timestamptz"}},
+			{ColumnName: "tags", Attrs: migrate.ColumnAttributes{PgType: "text[]"}},
+		},
+	})
+	live := migrate.NormalizeSchema(migrate.TableSchema{
+		TableName: "events",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true, Default: &seq}},
+			{ColumnName: "count", Attrs: migrate.ColumnAttributes{PgType: "integer"}},
+			{ColumnName: "active", Attrs: migrate.ColumnAttributes{PgType: "boolean"}},
+			{ColumnName: "score", Attrs: migrate.ColumnAttributes{PgType: "double precision"}},
+			{ColumnName: "at", Attrs: migrate.ColumnAttributes{PgType: "timestamp with time zone"}},
+			{ColumnName: "tags", Attrs: migrate.ColumnAttributes{PgType: "_text"}},
+		},
+	})
+
+	diff := NewDiffGenerator().DiffSchemas(migrate.AlignSerialColumns(live, declared), declared)
+	if !diff.IsEmpty() {
+		t.Fatalf("aliases must not produce changes, got:\n%s", strings.Join(diff.Up, "\n"))
+	}
+}
+
+func TestDiffSchemas_LossyTypeChange(t *testing.T) {
+	t.Parallel()
+
+	old := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "age", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			{ColumnName: "visits", Attrs: migrate.ColumnAttributes{PgType: "bigint"}},
+			{ColumnName: "score", Attrs: migrate.ColumnAttributes{PgType: "integer"}},
+		},
+	}
+	newSchema := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "age", Attrs: migrate.ColumnAttributes{PgType: "integer"}, Using: "NULLIF(age, '')::integer"},
+			{ColumnName: "visits", Attrs: migrate.ColumnAttributes{PgType: "integer"}},
+			{ColumnName: "score", Attrs: migrate.ColumnAttributes{PgType: "bigint"}},
+		},
+	}
+
+	g := NewDiffGenerator()
+	unsafe := g.UnsafeTypeChanges(old, newSchema)
+	if len(unsafe) != 1 || unsafe[0].Column != "visits" || unsafe[0].Kind != TypeChangeLossy {
+		t.Fatalf("UnsafeTypeChanges = %+v, want only visits", unsafe)
+	}
+
+	up := strings.Join(g.DiffSchemas(old, newSchema).Up, "\n")
+	for _, want := range []string{
+		`ALTER TABLE "users" ALTER COLUMN "age" TYPE integer USING NULLIF(age, '')::integer`,
+		`-- WARNING: changing "users"."visits" from bigint to integer may lose data.`,
+		`SELECT count(*) FROM "users" WHERE "visits" IS NOT NULL AND ("visits"::integer)::bigint IS DISTINCT FROM "visits";`,
+	} {
+		if !strings.Contains(up, want) {
+			t.Fatalf("expected %q in:\n%s", want, up)
+		}
+	}
+	if strings.Contains(up, `"score" from`) {
+		t.Fatalf("widening must not be annotated:\n%s", up)
+	}
+}
+
+func TestDiffSchemas_CreateTableWithSelfReference(t *testing.T) {
+	t.Parallel()
+
+	g := NewDiffGenerator()
+	// Every foreign key would be deferred; a self-reference must not be.
+	g.DeferForeignKey = func(string, migrate.ColumnMeta) bool { return true }
+
+	categories := migrate.TableSchema{
+		TableName: "categories",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+			{ColumnName: "slug", Attrs: migrate.ColumnAttributes{PgType: "text", NotNull: true}},
+			{ColumnName: "parent_slug", Attrs: migrate.ColumnAttributes{
+				PgType:     "text",
+				ForeignKey: &migrate.ForeignKey{Table: "categories", Column: "slug", OnDelete: migrate.Cascade},
+			}},
+			{ColumnName: "shop_id", Attrs: migrate.ColumnAttributes{
+				PgType:     "uuid",
+				ForeignKey: &migrate.ForeignKey{Table: "shops", Column: "id"},
+			}},
+		},
+		Indexes: []migrate.IndexMeta{{Name: "categories_slug_key", Columns: []string{"slug"}, Unique: true}},
+	}
+
+	diff := g.DiffSchemas(migrate.TableSchema{TableName: "categories"}, categories)
+	up := strings.Join(diff.Up, "\n")
+
+	create := strings.Index(up, "CREATE TABLE")
+	index := strings.Index(up, `"categories_slug_key"`)
+	selfFK := strings.Index(up, `FOREIGN KEY ("parent_slug") REFERENCES "categories"("slug") ON DELETE CASCADE`)
+	if create == -1 || index == -1 || selfFK == -1 {
+		t.Fatalf("missing statements in:\n%s", up)
+	}
+	if !(create < index && index < selfFK) {
+		t.Errorf("self-reference must be added after the table and its indexes:\n%s", up)
+	}
+	if strings.Contains(up, `"shops"`) {
+		t.Errorf("foreign key to another table should be deferred:\n%s", up)
+	}
+	if post := strings.Join(diff.PostUp, "\n"); strings.Contains(post, "parent_slug") || !strings.Contains(post, `"shops"`) {
+		t.Errorf("unexpected post pass:\n%s", post)
+	}
+}
+
+func TestDiffSchemas_RemovedColumnDownRestoresSequenceAndComment(t *testing.T) {
+	t.Parallel()
+
+	def := "nextval('orders_number_seq'::regclass)"
+	comment := "customer's order number"
+	last := int64(41)
+	old := migrate.TableSchema{
+		TableName: "orders",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+			{ColumnName: "number", Attrs: migrate.ColumnAttributes{
+				PgType:  "integer",
+				NotNull: true,
+				Default: &def,
+				Comment: &comment,
+				Sequence: &migrate.SequenceMeta{
+					Name: "orders_number_seq", Type: "integer",
+					Start: 1, Increment: 1, Min: 1, Max: 2147483647, LastValue: &last,
+				},
+			}},
+		},
+	}
+	newSchema := migrate.TableSchema{
+		TableName: "orders",
+		Columns:   old.Columns[:1],
+	}
+
+	down := strings.Join(NewDiffGenerator().DiffSchemas(old, newSchema).Down, "\n")
+	want := []string{
+		`CREATE SEQUENCE IF NOT EXISTS "orders_number_seq" AS integer INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START WITH 1 NO CYCLE`,
+		`ADD COLUMN IF NOT EXISTS "number" integer DEFAULT ` + def + ` NOT NULL`,
+		`ALTER SEQUENCE "orders_number_seq" OWNED BY "orders"."number"`,
+		`SELECT setval('"orders_number_seq"', 41, true)`,
+		`COMMENT ON COLUMN "orders"."number" IS 'customer''s order number'`,
+	}
+	prev := -1
+	for _, w := range want {
+		idx := strings.Index(down, w)
+		if idx == -1 {
+			t.Fatalf("expected %q in:\n%s", w, down)
+		}
+		if idx < prev {
+			t.Fatalf("expected order %v, got:\n%s", want, down)
+		}
+		prev = idx
+	}
+}
@@ -0,0 +1,86 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// typeExtensions maps column base types to the extension that provides them.
+var typeExtensions = map[string]string{
+	"vector":    "vector",
+	"halfvec":   "vector",
+	"sparsevec": "vector",
+	"citext":    "citext",
+}
+
+// indexMethodExtensions maps index access methods to the extension that
+// provides them.
+var indexMethodExtensions = map[string]string{
+	"ivfflat": "vector",
+	"hnsw":    "vector",
+}
+
+// defaultExtensions maps functions called by column defaults to the
+// extension that provides them.
+var defaultExtensions = map[string]string{
+	"gen_random_uuid":    "pgcrypto",
+	"uuid_generate_v1":   "uuid-ossp",
+	"uuid_generate_v1mc": "uuid-ossp",
+	"uuid_generate_v4":   "uuid-ossp",
+}
+
+// builtinSince is the server_version_num from which a function in
+// defaultExtensions is built in and needs no extension: gen_random_uuid
+// comes with Postgres 13, before that only with pgcrypto.
+var builtinSince = map[string]int{
+	"gen_random_uuid": 130000,
+}
+
+// defaultCallRe finds the functions a default expression calls.
+var defaultCallRe = regexp.MustCompile(`(?i)([a-z_][a-z0-9_]*)\s*\(`)
+
+// RequiredExtensions returns the sorted extensions a table needs to exist
+// before it can be created on a server with the given server_version_num.
+// A version of 0 means unknown and is taken as a current server, so
+// functions built in there add no extension.
+func RequiredExtensions(s migrate.TableSchema, serverVersion int) []string {
+	set := map[string]struct{}{}
+	for _, c := range s.Columns {
+		t := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(c.Attrs.PgType)), "[]")
+		base, _, _ := splitTypeModifier(t)
+		if ext, ok := typeExtensions[base]; ok {
+			set[ext] = struct{}{}
+		}
+		if c.Attrs.Default != nil {
+			for _, m := range defaultCallRe.FindAllStringSubmatch(*c.Attrs.Default, -1) {
+				fn := strings.ToLower(m[1])
+				if since, ok := builtinSince[fn]; ok && (serverVersion == 0 || serverVersion >= since) {
+					continue
+				}
+				if ext, ok := defaultExtensions[fn]; ok {
+					set[ext] = struct{}{}
+				}
+			}
+		}
+	}
+	for _, idx := range s.Indexes {
+		if ext, ok := indexMethodExtensions[strings.ToLower(idx.Method)]; ok {
+			set[ext] = struct{}{}
+		}
+	}
+
+	out := make([]string, 0, len(set))
+	for ext := range set {
+		out = append(out, ext)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func CreateExtensionStatement(name string) string {
+	return fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", quoteIdent(name))
+}
@@ -46,7 +46,8 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 			col.column_name,
 			pg_catalog.format_type(a.atttypid, a.atttypmod) AS formatted_type,
 			col.is_nullable,
-			col.column_default
+			col.column_default,
+			pg_catalog.col_description(c.oid, a.attnum) AS comment
 		FROM information_schema.columns col
 		JOIN pg_catalog.pg_class c ON c.relname = col.table_name
 		JOIN pg_catalog.pg_attribute a ON a.attrelid = c.oid AND a.attname = col.column_name
@@ -68,15 +69,16 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 
 	for rows.Next() {
 		var name, pgType, isNullableStr string
-		var colDefault *string
+		var colDefault, comment *string
 
-		if err := rows.Scan(&name, &pgType, &isNullableStr, &colDefault); err != nil {
+		if err := rows.Scan(&name, &pgType, &isNullableStr, &colDefault, &comment); err != nil {
 			return migrate.TableSchema{}, err
 		}
 
 		attrs := migrate.ColumnAttributes{
 			PgType:  pgType,
 			NotNull: isNullableStr == "NO",
+			Comment: comment,
 		}
 
 		if colDefault != nil {
@@ -102,6 +104,88 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 		)
 	}
 
+	// ---------- Storage parameters, tablespace and parents ----------
+	const relOptsQ = `
+		SELECT
+			COALESCE(c.reloptions, '{}'),
+			COALESCE(t.tablespace, ''),
+			ARRAY(
+				SELECT p.relname
+				FROM pg_catalog.pg_inherits i
+				JOIN pg_catalog.pg_class p ON p.oid = i.inhparent
+				WHERE i.inhrelid = c.oid AND NOT c.relispartition
+				ORDER BY i.inhseqno
+			)
+		FROM pg_catalog.pg_class c
+		LEFT JOIN pg_catalog.pg_tables t ON t.schemaname = current_schema() AND t.tablename = c.relname
+		WHERE c.relname = $1
+		  AND c.relnamespace = (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname = current_schema());
+	`
+	optRows, err := f.pool.Query(ctx, relOptsQ, table)
+	if err != nil {
+		return migrate.TableSchema{}, fmt.Errorf("query storage parameters: %w", err)
+	}
+	var storage []string
+	var tablespace string
+	var inherits []string
+	if optRows.Next() {
+		if err := optRows.Scan(&storage, &tablespace, &inherits); err != nil {
+			optRows.Close()
+			return migrate.TableSchema{}, fmt.Errorf("scan storage parameters: %w", err)
+		}
+	}
+	if err := optRows.Err(); err != nil {
+		optRows.Close()
+		return migrate.TableSchema{}, fmt.Errorf("iterate storage parameters: %w", err)
+	}
+	optRows.Close()
+
+	// ---------- Owned sequences (serial columns) ----------
+	const seqQ = `
+		SELECT
+			a.attname,
+			s.relname,
+			pg_catalog.format_type(seq.seqtypid, NULL),
+			seq.seqstart,
+			seq.seqincrement,
+			seq.seqmin,
+			seq.seqmax,
+			seq.seqcycle,
+			pg_catalog.pg_sequence_last_value(s.oid)
+		FROM pg_catalog.pg_depend d
+		JOIN pg_catalog.pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+		JOIN pg_catalog.pg_sequence seq ON seq.seqrelid = s.oid
+		JOIN pg_catalog.pg_class t ON t.oid = d.refobjid
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		WHERE d.classid = 'pg_catalog.pg_class'::regclass
+		  AND d.refclassid = 'pg_catalog.pg_class'::regclass
+		  AND d.deptype = 'a'
+		  AND t.relname = $1
+		  AND t.relnamespace = (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname = current_schema());
+	`
+	seqRows, err := f.pool.Query(ctx, seqQ, table)
+	if err != nil {
+		return migrate.TableSchema{}, fmt.Errorf("query owned sequences: %w", err)
+	}
+	for seqRows.Next() {
+		var colName string
+		var seq migrate.SequenceMeta
+		if err := seqRows.Scan(&colName, &seq.Name, &seq.Type, &seq.Start, &seq.Increment,
+			&seq.Min, &seq.Max, &seq.Cycle, &seq.LastValue); err != nil {
+			seqRows.Close()
+			return migrate.TableSchema{}, fmt.Errorf("scan owned sequence row: %w", err)
+		}
+		if cm, ok := colsMap[colName]; ok {
+			cm.Attrs.Sequence = &seq
+			colsMap[colName] = cm
+		}
+	}
+	if err := seqRows.Err(); err != nil {
+		seqRows.Close()
+		return migrate.TableSchema{}, fmt.Errorf("iterate owned sequence rows: %w", err)
+	}
+	seqRows.Close()
+
 	// ---------- PRIMARY KEY (+ real constraint name) ----------
 	const pkQ = `
 		SELECT
@@ -137,12 +221,16 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 	pkRows.Close()
 
 	// ---------- UNIQUE (+ real constraint name) ----------
+	// pg_index.indnullsnotdistinct exists since Postgres 15; it is read
+	// through to_jsonb so the query stays valid on older servers.
 	const uniqQ = `
 		SELECT
 			a.attname,
-			c.conname
+			c.conname,
+			COALESCE((to_jsonb(i) ->> 'indnullsnotdistinct')::boolean, false)
 		FROM pg_constraint c
 		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_index i ON i.indexrelid = c.conindid
 		JOIN unnest(c.conkey) WITH ORDINALITY AS cols(attnum, ord) ON true
 		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = cols.attnum
 		WHERE t.relname = $1 AND c.contype = 'u';
@@ -153,12 +241,14 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 	}
 	for uqRows.Next() {
 		var colName, conName string
-		if err := uqRows.Scan(&colName, &conName); err != nil {
+		var nullsNotDistinct bool
+		if err := uqRows.Scan(&colName, &conName, &nullsNotDistinct); err != nil {
 			uqRows.Close()
 			return migrate.TableSchema{}, fmt.Errorf("scan unique row: %w", err)
 		}
 		if cm, ok := colsMap[colName]; ok {
 			cm.Attrs.Unique = true
+			cm.Attrs.NullsNotDistinct = nullsNotDistinct
 			cm.Attrs.ConstraintName = &conName
 			colsMap[colName] = cm
 		}
@@ -189,7 +279,11 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 				WHEN 'n' THEN 'SET NULL'
 				WHEN 'd' THEN 'SET DEFAULT'
 			END AS delete_rule,
-			con.conname AS constraint_name
+			con.conname AS constraint_name,
+			con.condeferrable,
+			con.condeferred,
+			` + deleteSetColumns + ` AS delete_set_columns,
+			CASE con.confmatchtype WHEN 'f' THEN 'FULL' WHEN 'p' THEN 'PARTIAL' ELSE 'SIMPLE' END AS match_type
 		FROM pg_catalog.pg_constraint con
 		JOIN pg_catalog.pg_class local_table ON local_table.oid = con.conrelid
 		JOIN pg_catalog.pg_namespace local_ns ON local_ns.oid = local_table.relnamespace
@@ -210,16 +304,23 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 	}
 	for fkRows.Next() {
 		var col, fTable, fCol, onUpdate, onDelete, conName string
-		if err := fkRows.Scan(&col, &fTable, &fCol, &onUpdate, &onDelete, &conName); err != nil {
+		var deferrable, deferred bool
+		var setCols []string
+		var match string
+		if err := fkRows.Scan(&col, &fTable, &fCol, &onUpdate, &onDelete, &conName, &deferrable, &deferred, &setCols, &match); err != nil {
 			fkRows.Close()
 			return migrate.TableSchema{}, fmt.Errorf("scan foreign key row: %w", err)
 		}
 		if cm, ok := colsMap[col]; ok {
 			cm.Attrs.ForeignKey = &migrate.ForeignKey{
-				Table:    fTable,
-				Column:   fCol,
-				OnUpdate: migrate.OnActionType(strings.ToUpper(onUpdate)),
-				OnDelete: migrate.OnActionType(strings.ToUpper(onDelete)),
+				Table:             fTable,
+				Column:            fCol,
+				OnUpdate:          migrate.OnActionType(strings.ToUpper(onUpdate)),
+				OnDelete:          migrate.OnActionType(strings.ToUpper(onDelete)),
+				OnDeleteColumns:   setCols,
+				Match:             migrate.NormalizeMatch(migrate.MatchType(match)),
+				Deferrable:        deferrable,
+				InitiallyDeferred: deferred,
 			}
 			cm.Attrs.ConstraintName = &conName
 			colsMap[col] = cm
@@ -238,20 +339,27 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 		SELECT
 			i.relname AS index_name,
 			ix.indisunique AS is_unique,
-			ARRAY_AGG(a.attname ORDER BY k.ord) AS cols,
-			pg_get_expr(ix.indpred, ix.indrelid) AS pred
+			ARRAY_AGG(COALESCE(a.attname, pg_get_indexdef(ix.indexrelid, k.ord::int, true)) ORDER BY k.ord) AS cols,
+			pg_get_expr(ix.indpred, ix.indrelid) AS pred,
+			am.amname AS method,
+			ARRAY_AGG(CASE WHEN opc.opcdefault THEN '' ELSE opc.opcname END ORDER BY k.ord) AS opclasses,
+			COALESCE(i.reloptions, '{}') AS with_params,
+			COALESCE(ts.spcname, '') AS tablespace
 		FROM pg_index ix
 		JOIN pg_class t ON t.oid = ix.indrelid
 		JOIN pg_namespace n ON n.oid = t.relnamespace
 		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_am am ON am.oid = i.relam
 		JOIN unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
-		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum AND k.attnum <> 0
+		JOIN pg_opclass opc ON opc.oid = ix.indclass[(k.ord - 1)::int]
 		LEFT JOIN pg_constraint c ON c.conindid = ix.indexrelid
+		LEFT JOIN pg_tablespace ts ON ts.oid = i.reltablespace
 		WHERE t.relname = $1
 		  AND n.nspname = current_schema()
 		  AND c.oid IS NULL
 		  AND ix.indisprimary = false
-		GROUP BY i.relname, ix.indisunique, ix.indpred, ix.indrelid;
+		GROUP BY ix.indexrelid, i.relname, ix.indisunique, ix.indpred, ix.indrelid, am.amname, i.reloptions, ts.spcname;
 	`
 	idxRows, err := f.pool.Query(ctx, idxQ, table)
 	if err != nil {
@@ -265,17 +373,24 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 		var isUnique bool
 		var cols []string
 		var pred *string
-		if err := idxRows.Scan(&indexName, &isUnique, &cols, &pred); err != nil {
+		var method string
+		var opclasses, with []string
+		var indexTablespace string
+		if err := idxRows.Scan(&indexName, &isUnique, &cols, &pred, &method, &opclasses, &with, &indexTablespace); err != nil {
 			return migrate.TableSchema{}, fmt.Errorf("scan index row: %w", err)
 		}
 		if len(cols) == 0 {
 			continue
 		}
 		indexes = append(indexes, migrate.IndexMeta{
-			Name:    indexName,
-			Columns: cols,
-			Unique:  isUnique,
-			Where:   pred,
+			Name:       indexName,
+			Columns:    cols,
+			Unique:     isUnique,
+			Where:      pred,
+			Method:     method,
+			Opclasses:  opclasses,
+			With:       with,
+			Tablespace: indexTablespace,
 		})
 	}
 	if err := idxRows.Err(); err != nil {
@@ -328,6 +443,51 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 		return migrate.TableSchema{}, fmt.Errorf("iterate check rows: %w", err)
 	}
 
+	// ---------- Triggers ----------
+	// Only triggers the generator created, marked by their comment, are
+	// read: the others belong to hand-written SQL and are left alone.
+	// tgtype bits: 1 row, 2 before, 4 insert, 8 delete, 16 update.
+	const trgQ = `
+		SELECT tg.tgname, tg.tgtype, p.proname
+		FROM pg_catalog.pg_trigger tg
+		JOIN pg_catalog.pg_class c ON c.oid = tg.tgrelid
+		JOIN pg_catalog.pg_proc p ON p.oid = tg.tgfoid
+		WHERE c.relname = $1
+		  AND c.relnamespace = (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname = current_schema())
+		  AND NOT tg.tgisinternal
+		  AND obj_description(tg.oid, 'pg_trigger') = $2
+		ORDER BY tg.tgname;
+	`
+	trgRows, err := f.pool.Query(ctx, trgQ, table, TriggerComment)
+	if err != nil {
+		return migrate.TableSchema{}, fmt.Errorf("query triggers: %w", err)
+	}
+	defer trgRows.Close()
+	var triggers []migrate.TriggerMeta
+	for trgRows.Next() {
+		var name, function string
+		var tgtype int16
+		if err := trgRows.Scan(&name, &tgtype, &function); err != nil {
+			return migrate.TableSchema{}, fmt.Errorf("scan trigger row: %w", err)
+		}
+		trg := migrate.TriggerMeta{Name: name, Timing: "AFTER", Function: function}
+		if tgtype&2 != 0 {
+			trg.Timing = "BEFORE"
+		}
+		for _, ev := range []struct {
+			bit  int16
+			name string
+		}{{4, "INSERT"}, {16, "UPDATE"}, {8, "DELETE"}} {
+			if tgtype&ev.bit != 0 {
+				trg.Events = append(trg.Events, ev.name)
+			}
+		}
+		triggers = append(triggers, trg)
+	}
+	if err := trgRows.Err(); err != nil {
+		return migrate.TableSchema{}, fmt.Errorf("iterate trigger rows: %w", err)
+	}
+
 	cols := make([]migrate.ColumnMeta, 0, len(colOrder))
 	for _, colName := range colOrder {
 		if col, ok := colsMap[colName]; ok {
@@ -339,9 +499,160 @@ func (f *Fetcher) Fetch(ctx context.Context, table string) (migrate.TableSchema,
 	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
 
 	return migrate.TableSchema{
-		TableName: table,
-		Columns:   cols,
-		Indexes:   indexes,
-		Checks:    checks,
+		TableName:  table,
+		Columns:    cols,
+		Indexes:    indexes,
+		Checks:     checks,
+		Storage:    storage,
+		Tablespace: tablespace,
+		Inherits:   inherits,
+		Triggers:   triggers,
 	}, nil
 }
+
+// deleteSetColumns selects the column list of an ON DELETE SET NULL/SET
+// DEFAULT action of the constraint con. pg_constraint.confdelsetcols exists
+// since Postgres 15; reading it through to_jsonb keeps the query valid on
+// older servers, where the list is always empty.
+const deleteSetColumns = `ARRAY(
+				SELECT a_set.attname
+				FROM jsonb_array_elements_text(CASE jsonb_typeof(to_jsonb(con) -> 'confdelsetcols')
+					WHEN 'array' THEN to_jsonb(con) -> 'confdelsetcols' ELSE '[]'::jsonb END)
+					WITH ORDINALITY AS sc(attnum, ord)
+				JOIN pg_catalog.pg_attribute a_set
+					ON a_set.attrelid = con.conrelid AND a_set.attnum = sc.attnum::int2
+				ORDER BY sc.ord
+			)`
+
+// ListTables returns the ordinary tables of the current schema.
+func (f *Fetcher) ListTables(ctx context.Context) ([]string, error) {
+	const q = `
+		SELECT c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p')
+		  AND NOT c.relispartition
+		  AND n.nspname = current_schema()
+		ORDER BY c.relname;
+	`
+	rows, err := f.pool.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("query tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan table row: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// EstimateRows returns the planner's estimate of the rows in table, which
+// is cheap compared to counting them, or -1 when the table has not been
+// vacuumed or analyzed yet.
+func (f *Fetcher) EstimateRows(ctx context.Context, table string) (int64, error) {
+	const q = `
+		SELECT c.reltuples::bigint
+		FROM pg_class c
+		WHERE c.relname = $1
+		  AND c.relnamespace = (SELECT oid FROM pg_catalog.pg_namespace WHERE nspname = current_schema());
+	`
+	rows, err := f.pool.Query(ctx, q, table)
+	if err != nil {
+		return 0, fmt.Errorf("query row estimate: %w", err)
+	}
+	defer rows.Close()
+
+	estimate := int64(-1)
+	if rows.Next() {
+		if err := rows.Scan(&estimate); err != nil {
+			return 0, fmt.Errorf("scan row estimate: %w", err)
+		}
+	}
+	return estimate, rows.Err()
+}
+
+// References returns the single-column foreign keys of other tables in the
+// current schema that point at table.
+func (f *Fetcher) References(ctx context.Context, table string) ([]Reference, error) {
+	const q = `
+		SELECT
+			local_table.relname,
+			a_local.attname,
+			a_foreign.attname,
+			CASE con.confupdtype
+				WHEN 'a' THEN 'NO ACTION'
+				WHEN 'r' THEN 'RESTRICT'
+				WHEN 'c' THEN 'CASCADE'
+				WHEN 'n' THEN 'SET NULL'
+				WHEN 'd' THEN 'SET DEFAULT'
+			END,
+			CASE con.confdeltype
+				WHEN 'a' THEN 'NO ACTION'
+				WHEN 'r' THEN 'RESTRICT'
+				WHEN 'c' THEN 'CASCADE'
+				WHEN 'n' THEN 'SET NULL'
+				WHEN 'd' THEN 'SET DEFAULT'
+			END,
+			con.conname,
+			con.condeferrable,
+			con.condeferred,
+			` + deleteSetColumns + `,
+			CASE con.confmatchtype WHEN 'f' THEN 'FULL' WHEN 'p' THEN 'PARTIAL' ELSE 'SIMPLE' END
+		FROM pg_catalog.pg_constraint con
+		JOIN pg_catalog.pg_class local_table ON local_table.oid = con.conrelid
+		JOIN pg_catalog.pg_class foreign_table ON foreign_table.oid = con.confrelid
+		JOIN pg_catalog.pg_namespace foreign_ns ON foreign_ns.oid = foreign_table.relnamespace
+		JOIN pg_catalog.pg_attribute a_local
+			ON a_local.attrelid = con.conrelid AND a_local.attnum = con.conkey[1]
+		JOIN pg_catalog.pg_attribute a_foreign
+			ON a_foreign.attrelid = con.confrelid AND a_foreign.attnum = con.confkey[1]
+		WHERE con.contype = 'f'
+		  AND cardinality(con.conkey) = 1
+		  AND foreign_table.relname = $1
+		  AND local_table.oid <> foreign_table.oid
+		  AND foreign_ns.nspname = current_schema()
+		ORDER BY local_table.relname, con.conname;
+	`
+	rows, err := f.pool.Query(ctx, q, table)
+	if err != nil {
+		return nil, fmt.Errorf("query references: %w", err)
+	}
+	defer rows.Close()
+
+	var refs []Reference
+	for rows.Next() {
+		var refTable, col, fCol, onUpdate, onDelete, conName string
+		var deferrable, deferred bool
+		var setCols []string
+		var match string
+		if err := rows.Scan(&refTable, &col, &fCol, &onUpdate, &onDelete, &conName, &deferrable, &deferred, &setCols, &match); err != nil {
+			return nil, fmt.Errorf("scan reference row: %w", err)
+		}
+		refs = append(refs, Reference{
+			Table: refTable,
+			Column: migrate.ColumnMeta{
+				ColumnName: col,
+				Attrs: migrate.ColumnAttributes{
+					ForeignKey: &migrate.ForeignKey{
+						Table:             table,
+						Column:            fCol,
+						OnUpdate:          migrate.OnActionType(onUpdate),
+						OnDelete:          migrate.OnActionType(onDelete),
+						OnDeleteColumns:   setCols,
+						Match:             migrate.NormalizeMatch(migrate.MatchType(match)),
+						Deferrable:        deferrable,
+						InitiallyDeferred: deferred,
+					},
+					ConstraintName: &conName,
+				},
+			},
+		})
+	}
+	return refs, rows.Err()
+}
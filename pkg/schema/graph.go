@@ -0,0 +1,183 @@
+package schema
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// Graph formats supported by WriteGraph.
+const (
+	GraphDOT      = "dot"
+	GraphMermaid  = "mermaid"
+	GraphPlantUML = "plantuml"
+)
+
+// WriteGraph renders tables, their columns and foreign key edges as an
+// entity-relationship diagram in the given format.
+func WriteGraph(w io.Writer, format string, tables []migrate.TableSchema) error {
+	sorted := append([]migrate.TableSchema(nil), tables...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].TableName < sorted[j].TableName })
+
+	var b strings.Builder
+	switch format {
+	case GraphDOT:
+		writeDOT(&b, sorted)
+	case GraphMermaid:
+		writeMermaid(&b, sorted)
+	case GraphPlantUML:
+		writePlantUML(&b, sorted)
+	default:
+		return fmt.Errorf("unknown graph format %q (expected %s, %s or %s)", format, GraphDOT, GraphMermaid, GraphPlantUML)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func columnKeys(c migrate.ColumnMeta) []string {
+	var keys []string
+	if c.Attrs.IsPK {
+		keys = append(keys, "PK")
+	}
+	if c.Attrs.ForeignKey != nil {
+		keys = append(keys, "FK")
+	}
+	if c.Attrs.Unique && !c.Attrs.IsPK {
+		keys = append(keys, "UK")
+	}
+	return keys
+}
+
+func writeDOT(b *strings.Builder, tables []migrate.TableSchema) {
+	b.WriteString("digraph schema {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=plaintext, fontname=\"Helvetica\"];\n\n")
+
+	for _, t := range tables {
+		fmt.Fprintf(b, "  %q [label=<<table border=\"0\" cellborder=\"1\" cellspacing=\"0\">", t.TableName)
+		fmt.Fprintf(b, "<tr><td bgcolor=\"lightgrey\"><b>%s</b></td></tr>", html.EscapeString(t.TableName))
+		for _, c := range t.Columns {
+			label := c.ColumnName + " " + c.Attrs.PgType
+			if keys := columnKeys(c); len(keys) > 0 {
+				label += " " + strings.Join(keys, ",")
+			}
+			fmt.Fprintf(b, "<tr><td port=%q align=\"left\">%s</td></tr>", c.ColumnName, html.EscapeString(label))
+		}
+		b.WriteString("</table>>];\n")
+	}
+
+	b.WriteString("\n")
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			if fk := c.Attrs.ForeignKey; fk != nil {
+				fmt.Fprintf(b, "  %q:%q -> %q:%q;\n", t.TableName, c.ColumnName, fk.Table, fk.Column)
+			}
+		}
+	}
+	b.WriteString("}\n")
+}
+
+var mermaidUnsafeRE = regexp.MustCompile(`[^A-Za-z0-9_()\[\]-]+`)
+
+func writeMermaid(b *strings.Builder, tables []migrate.TableSchema) {
+	b.WriteString("erDiagram\n")
+	for _, t := range tables {
+		fmt.Fprintf(b, "    %s {\n", mermaidName(t.TableName))
+		for _, c := range t.Columns {
+			fmt.Fprintf(b, "        %s %s", mermaidUnsafeRE.ReplaceAllString(c.Attrs.PgType, "_"), mermaidName(c.ColumnName))
+			if keys := columnKeys(c); len(keys) > 0 {
+				b.WriteString(" " + strings.Join(keys, ", "))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("    }\n")
+	}
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			fk := c.Attrs.ForeignKey
+			if fk == nil {
+				continue
+			}
+			parent, child := "|o", "o{"
+			if c.Attrs.NotNull || c.Attrs.IsPK {
+				parent = "||"
+			}
+			if c.Attrs.Unique {
+				child = "o|"
+			}
+			fmt.Fprintf(b, "    %s %s--%s %s : %q\n", mermaidName(fk.Table), parent, child, mermaidName(t.TableName), c.ColumnName)
+		}
+	}
+}
+
+func mermaidName(name string) string {
+	return mermaidUnsafeRE.ReplaceAllString(name, "_")
+}
+
+var plantUMLAliasRE = regexp.MustCompile(`\W+`)
+
+func writePlantUML(b *strings.Builder, tables []migrate.TableSchema) {
+	b.WriteString("@startuml\n")
+	b.WriteString("hide circle\n")
+	b.WriteString("skinparam linetype ortho\n\n")
+
+	for _, t := range tables {
+		fmt.Fprintf(b, "entity %q as %s {\n", t.TableName, plantUMLAlias(t.TableName))
+		var pk, rest []migrate.ColumnMeta
+		for _, c := range t.Columns {
+			if c.Attrs.IsPK {
+				pk = append(pk, c)
+			} else {
+				rest = append(rest, c)
+			}
+		}
+		for _, c := range pk {
+			fmt.Fprintf(b, "  * %s : %s <<PK>>\n", c.ColumnName, c.Attrs.PgType)
+		}
+		if len(pk) > 0 {
+			b.WriteString("  --\n")
+		}
+		for _, c := range rest {
+			b.WriteString("  ")
+			if c.Attrs.NotNull {
+				b.WriteString("* ")
+			}
+			fmt.Fprintf(b, "%s : %s", c.ColumnName, c.Attrs.PgType)
+			if c.Attrs.ForeignKey != nil {
+				b.WriteString(" <<FK>>")
+			}
+			if c.Attrs.Unique {
+				b.WriteString(" <<UK>>")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n\n")
+	}
+
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			fk := c.Attrs.ForeignKey
+			if fk == nil {
+				continue
+			}
+			child, parent := "}o", "o|"
+			if c.Attrs.Unique {
+				child = "|o"
+			}
+			if c.Attrs.NotNull || c.Attrs.IsPK {
+				parent = "||"
+			}
+			fmt.Fprintf(b, "%s %s--%s %s : %s\n", plantUMLAlias(t.TableName), child, parent, plantUMLAlias(fk.Table), c.ColumnName)
+		}
+	}
+	b.WriteString("@enduml\n")
+}
+
+func plantUMLAlias(name string) string {
+	return plantUMLAliasRE.ReplaceAllString(name, "_")
+}
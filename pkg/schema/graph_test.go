@@ -0,0 +1,76 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func graphTables() []migrate.TableSchema {
+	return []migrate.TableSchema{
+		{
+			TableName: "posts",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+				{ColumnName: "user_id", Attrs: migrate.ColumnAttributes{PgType: "uuid", NotNull: true, ForeignKey: &migrate.ForeignKey{Table: "users", Column: "id"}}},
+				{ColumnName: "price", Attrs: migrate.ColumnAttributes{PgType: "numeric(10,2)"}},
+			},
+		},
+		{
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true, NotNull: true}},
+				{ColumnName: "email", Attrs: migrate.ColumnAttributes{PgType: "text", Unique: true}},
+			},
+		},
+	}
+}
+
+func TestWriteGraph(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string][]string{
+		GraphDOT: {
+			"digraph schema {",
+			`"users" [label=<`,
+			`<td port="user_id" align="left">user_id uuid FK</td>`,
+			`"posts":"user_id" -> "users":"id";`,
+		},
+		GraphMermaid: {
+			"erDiagram",
+			"        uuid id PK\n",
+			"        text email UK\n",
+			"        numeric(10_2) price\n",
+			`    users ||--o{ posts : "user_id"`,
+		},
+		GraphPlantUML: {
+			"@startuml",
+			`entity "users" as users {`,
+			"  * id : uuid <<PK>>\n  --\n",
+			"  email : text <<UK>>",
+			"posts }o--|| users : user_id",
+			"@enduml",
+		},
+	}
+
+	for format, wants := range cases {
+		var b strings.Builder
+		if err := WriteGraph(&b, format, graphTables()); err != nil {
+			t.Fatal(err)
+		}
+		out := b.String()
+		for _, want := range wants {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: expected %q in:\n%s", format, want, out)
+			}
+		}
+		if strings.Index(out, "posts") > strings.Index(out, "users") {
+			t.Errorf("%s: tables must be sorted by name:\n%s", format, out)
+		}
+	}
+
+	if err := WriteGraph(&strings.Builder{}, "svg", nil); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
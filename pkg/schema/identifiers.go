@@ -0,0 +1,70 @@
+package schema
+
+import (
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// MaxIdentifierLength is the longest identifier Postgres keeps, in bytes;
+// longer names are silently truncated (NAMEDATALEN - 1).
+const MaxIdentifierLength = 63
+
+// reservedWords are the keywords Postgres reserves, including those that
+// may only be used as function or type names. They work as quoted
+// identifiers, but break hand-written SQL, check and index expressions.
+var reservedWords = map[string]bool{
+	"all": true, "analyse": true, "analyze": true, "and": true, "any": true, "array": true,
+	"as": true, "asc": true, "asymmetric": true, "authorization": true, "binary": true,
+	"both": true, "case": true, "cast": true, "check": true, "collate": true,
+	"collation": true, "column": true, "concurrently": true, "constraint": true,
+	"create": true, "cross": true, "current_catalog": true, "current_date": true,
+	"current_role": true, "current_schema": true, "current_time": true,
+	"current_timestamp": true, "current_user": true, "default": true, "deferrable": true,
+	"desc": true, "distinct": true, "do": true, "else": true, "end": true, "except": true,
+	"false": true, "fetch": true, "for": true, "foreign": true, "freeze": true, "from": true,
+	"full": true, "grant": true, "group": true, "having": true, "ilike": true, "in": true,
+	"initially": true, "inner": true, "intersect": true, "into": true, "is": true,
+	"isnull": true, "join": true, "lateral": true, "leading": true, "left": true, "like": true,
+	"limit": true, "localtime": true, "localtimestamp": true, "natural": true, "not": true,
+	"notnull": true, "null": true, "offset": true, "on": true, "only": true, "or": true,
+	"order": true, "outer": true, "overlaps": true, "placing": true, "primary": true,
+	"references": true, "returning": true, "right": true, "select": true,
+	"session_user": true, "similar": true, "some": true, "symmetric": true,
+	"system_user": true, "table": true, "tablesample": true, "then": true, "to": true,
+	"trailing": true, "true": true, "union": true, "unique": true, "user": true,
+	"using": true, "variadic": true, "verbose": true, "when": true, "where": true,
+	"window": true, "with": true,
+}
+
+// IsReservedWord reports whether name is a reserved Postgres keyword.
+func IsReservedWord(name string) bool {
+	return reservedWords[strings.ToLower(name)]
+}
+
+// ConstraintNames returns the names of the primary key, unique and foreign
+// key constraints generated for s, and of its explicitly named indexes.
+func ConstraintNames(s migrate.TableSchema) []string {
+	g := NewDiffGenerator()
+	var names []string
+	for _, c := range s.Columns {
+		if c.Attrs.IsPK {
+			names = append(names, pkConstraintName(s.TableName))
+			break
+		}
+	}
+	for _, c := range s.Columns {
+		if c.Attrs.Unique {
+			names = append(names, g.getConstraintName(c, uniqueConstraintName(s.TableName, c.ColumnName)))
+		}
+		if c.Attrs.ForeignKey != nil {
+			names = append(names, fkConstraintName(s.TableName, c.ColumnName))
+		}
+	}
+	for _, idx := range s.Indexes {
+		if strings.TrimSpace(idx.Name) != "" {
+			names = append(names, idx.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestIsReservedWord(t *testing.T) {
+	t.Parallel()
+
+	for name, want := range map[string]bool{
+		"user":   true,
+		"Order":  true,
+		"table":  true,
+		"users":  false,
+		"name":   false,
+		"status": false,
+	} {
+		if got := IsReservedWord(name); got != want {
+			t.Errorf("IsReservedWord(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestConstraintNames(t *testing.T) {
+	t.Parallel()
+
+	s := migrate.TableSchema{
+		TableName: "orders",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "uuid", IsPK: true}},
+			{ColumnName: "code", Attrs: migrate.ColumnAttributes{PgType: "text", Unique: true}},
+			{ColumnName: "user_id", Attrs: migrate.ColumnAttributes{
+				PgType:     "uuid",
+				ForeignKey: &migrate.ForeignKey{Table: "users", Column: "id"},
+			}},
+		},
+		Indexes: []migrate.IndexMeta{
+			{Name: "orders_by_code", Columns: []string{"code"}},
+			{Columns: []string{"user_id"}},
+		},
+	}
+
+	want := []string{
+		pkConstraintName("orders"),
+		uniqueConstraintName("orders", "code"),
+		fkConstraintName("orders", "user_id"),
+		"orders_by_code",
+	}
+	if got := ConstraintNames(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConstraintNames() = %v, want %v", got, want)
+	}
+}
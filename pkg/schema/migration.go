@@ -1,16 +1,81 @@
 package schema
 
+import (
+	"io"
+	"strings"
+)
+
 func WrapTx(statements []string) string {
 	if len(statements) == 0 {
 		return ""
 	}
 
-	content := "BEGIN;\n\n"
+	var sb strings.Builder
+	tw := NewTxWriter(&sb)
+	tw.Write(statements...)
+	tw.Close()
+	return sb.String()
+}
+
+// TxWriter streams statements in exactly the format WrapTx produces, so large
+// migrations never have to be held in memory as a single string.
+type TxWriter struct {
+	w       io.Writer
+	started bool
+	err     error
+}
+
+func NewTxWriter(w io.Writer) *TxWriter {
+	return &TxWriter{w: w}
+}
+
+func (t *TxWriter) Write(statements ...string) error {
+	for _, stmt := range statements {
+		if !t.started {
+			t.write("BEGIN;\n\n")
+			t.started = true
+		}
+		if stmt != "" {
+			t.write(stmt + ";\n")
+		}
+	}
+	return t.err
+}
+
+// WriteRaw appends already rendered statements (see RenderStatements).
+func (t *TxWriter) WriteRaw(rendered string) error {
+	if !t.started {
+		t.write("BEGIN;\n\n")
+		t.started = true
+	}
+	t.write(rendered)
+	return t.err
+}
+
+// Close terminates the transaction block. Nothing is written if no statement
+// was ever written.
+func (t *TxWriter) Close() error {
+	if t.started {
+		t.write("\nCOMMIT;")
+	}
+	return t.err
+}
+
+func (t *TxWriter) write(s string) {
+	if t.err != nil {
+		return
+	}
+	_, t.err = io.WriteString(t.w, s)
+}
+
+// RenderStatements renders statements the way TxWriter writes them, without
+// the surrounding transaction block.
+func RenderStatements(statements []string) string {
+	var sb strings.Builder
 	for _, stmt := range statements {
 		if stmt != "" {
-			content += stmt + ";\n"
+			sb.WriteString(stmt + ";\n")
 		}
 	}
-	content += "\nCOMMIT;"
-	return content
+	return sb.String()
 }
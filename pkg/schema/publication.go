@@ -0,0 +1,19 @@
+package schema
+
+import "fmt"
+
+// AddTableToPublicationStatement creates the publication when it does not
+// exist yet and adds table to it. Publications have no IF NOT EXISTS form, so
+// the check is done in a DO block like constraint creation.
+func AddTableToPublicationStatement(publication, table string) string {
+	return fmt.Sprintf(`DO $$ BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = '%s') THEN
+    CREATE PUBLICATION %s;
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM pg_publication_tables WHERE pubname = '%s' AND tablename = '%s') THEN
+    ALTER PUBLICATION %s ADD TABLE %s;
+  END IF;
+END $$`, quoteLiteral(publication), quoteIdent(publication),
+		quoteLiteral(publication), quoteLiteral(table),
+		quoteIdent(publication), quoteIdent(table))
+}
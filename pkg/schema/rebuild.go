@@ -0,0 +1,171 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// Reference is a foreign key of another table that points at a table being
+// rebuilt. Column carries the foreign key and, when known, its constraint
+// name.
+type Reference struct {
+	Table  string
+	Column migrate.ColumnMeta
+}
+
+// ColumnOrderChanged reports whether altering old into new would leave the
+// columns in a different order than declared in new: existing columns were
+// reordered, or a column was added in front of an existing one.
+func ColumnOrderChanged(old, new migrate.TableSchema) bool {
+	pos := make(map[string]int, len(old.Columns))
+	for i, name := range columnNames(old.Columns) {
+		pos[name] = i
+	}
+
+	last, added := -1, false
+	for _, name := range columnNames(new.Columns) {
+		i, ok := pos[name]
+		if !ok {
+			added = true
+			continue
+		}
+		if added || i < last {
+			return true
+		}
+		last = i
+	}
+	return false
+}
+
+// RebuildTable recreates a table with the columns of new in declared order:
+// the rows are copied aside, the table is dropped and created again, and the
+// rows are copied back. refs are foreign keys of other tables pointing at it;
+// they are dropped before and restored after the rebuild. The table is
+// dropped without CASCADE, so views or foreign keys not listed in refs make
+// the migration fail instead of being removed silently.
+//
+// The copied rows have no value for columns added by new, so a new NOT NULL
+// column needs a default; RebuildTable returns an error otherwise.
+func (g *DiffGenerator) RebuildTable(old, new migrate.TableSchema, refs []Reference) (migrate.TableDiff, error) {
+	if unfilled := unfilledColumns(old, rebuildSchema(new)); len(unfilled) > 0 {
+		return migrate.TableDiff{}, fmt.Errorf(
+			"cannot rebuild table %s: new NOT NULL columns %s have no default for the copied rows; add a default, or add them nullable and backfill before setting NOT NULL",
+			new.TableName, strings.Join(unfilled, ", "))
+	}
+	up, postUp := g.rebuild(old, new, refs)
+	down, postDown := g.rebuild(new, old, refs)
+	return migrate.TableDiff{
+		Up:     up,
+		Down:   append(down, postDown...),
+		PostUp: postUp,
+	}, nil
+}
+
+// unfilledColumns returns the columns of to missing from from that reject
+// NULL and have no default to take.
+func unfilledColumns(from, to migrate.TableSchema) []string {
+	existing := makeColumnMap(from.Columns)
+	var unfilled []string
+	for _, col := range to.Columns {
+		if _, ok := existing[col.ColumnName]; ok {
+			continue
+		}
+		if (col.Attrs.NotNull || col.Attrs.IsPK) && col.Attrs.Default == nil && !isSerialType(col.Attrs.PgType) {
+			unfilled = append(unfilled, col.ColumnName)
+		}
+	}
+	return unfilled
+}
+
+func (g *DiffGenerator) rebuild(from, to migrate.TableSchema, refs []Reference) (stmts, post []string) {
+	table := quoteIdent(to.TableName)
+	tmp := quoteIdent(to.TableName + "__rebuild")
+
+	for _, ref := range refs {
+		stmts = append(stmts, dropConstraintIfExists(ref.Table, referenceConstraintName(ref)))
+	}
+	stmts = append(stmts,
+		fmt.Sprintf("CREATE TABLE %s AS TABLE %s", tmp, table),
+		fmt.Sprintf("DROP TABLE %s", table),
+	)
+
+	target := rebuildSchema(to)
+	create := g.generateCreateTableDiff(target)
+	stmts = append(stmts, create.Up[0])
+
+	existing := makeColumnMap(from.Columns)
+	var cols []string
+	for _, name := range columnNames(target.Columns) {
+		if _, ok := existing[name]; ok {
+			cols = append(cols, quoteIdent(name))
+		}
+	}
+	if len(cols) > 0 {
+		list := strings.Join(cols, ", ")
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", table, list, list, tmp))
+	}
+	// Recreating a serial column starts a fresh sequence; move it past the
+	// copied values.
+	for _, col := range target.Columns {
+		if _, ok := existing[col.ColumnName]; ok && isSerialType(col.Attrs.PgType) {
+			stmts = append(stmts, fmt.Sprintf(
+				"SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+				quoteLiteral(table), quoteLiteral(col.ColumnName), quoteIdent(col.ColumnName), table))
+		}
+	}
+	stmts = append(stmts, fmt.Sprintf("DROP TABLE %s", tmp))
+	stmts = append(stmts, create.Up[1:]...)
+
+	for _, ref := range refs {
+		fk := ref.Column.Attrs.ForeignKey
+		name := referenceConstraintName(ref)
+		stmts = append(stmts, addConstraintIfNotExists(fmt.Sprintf(
+			"ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) %s",
+			quoteIdent(ref.Table), quoteIdent(name), quoteIdent(ref.Column.ColumnName), foreignKeyClause(fk)), name))
+	}
+	return stmts, create.PostUp
+}
+
+func referenceConstraintName(ref Reference) string {
+	if ref.Column.Attrs.ConstraintName != nil {
+		return *ref.Column.Attrs.ConstraintName
+	}
+	return fkConstraintName(ref.Table, ref.Column.ColumnName)
+}
+
+var nextvalDefaultRE = regexp.MustCompile(`(?i)^nextval\(`)
+
+// rebuildSchema turns integer columns defaulting to nextval(...), as read
+// from the database, back into serial columns. Dropping the table drops the
+// sequences it owns, so the default would otherwise point at nothing.
+func rebuildSchema(s migrate.TableSchema) migrate.TableSchema {
+	cols := make([]migrate.ColumnMeta, len(s.Columns))
+	for i, col := range s.Columns {
+		if col.Attrs.Default != nil && nextvalDefaultRE.MatchString(strings.TrimSpace(*col.Attrs.Default)) {
+			if serial, ok := serialTypes[migrate.NormalizePgType(col.Attrs.PgType)]; ok {
+				col.Attrs.PgType = serial
+				col.Attrs.Default = nil
+			}
+		}
+		cols[i] = col
+	}
+	s.Columns = cols
+	return s
+}
+
+var serialTypes = map[string]string{
+	"smallint": "smallserial",
+	"integer":  "serial",
+	"bigint":   "bigserial",
+}
+
+func isSerialType(t string) bool {
+	switch strings.ToLower(strings.TrimSpace(t)) {
+	case "smallserial", "serial", "bigserial", "serial2", "serial4", "serial8":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestColumnOrderChanged(t *testing.T) {
+	t.Parallel()
+
+	table := func(cols ...string) migrate.TableSchema {
+		s := migrate.TableSchema{TableName: "demo"}
+		for _, c := range cols {
+			s.Columns = append(s.Columns, migrate.ColumnMeta{ColumnName: c})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		old, new migrate.TableSchema
+		want     bool
+	}{
+		{"unchanged", table("id", "name"), table("id", "name"), false},
+		{"appended", table("id", "name"), table("id", "name", "email"), false},
+		{"dropped", table("id", "name", "email"), table("id", "email"), false},
+		{"swapped", table("id", "name", "email"), table("id", "email", "name"), true},
+		{"inserted", table("id", "name"), table("id", "email", "name"), true},
+	}
+	for _, tt := range tests {
+		if got := ColumnOrderChanged(tt.old, tt.new); got != tt.want {
+			t.Errorf("%s: ColumnOrderChanged = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRebuildTable(t *testing.T) {
+	t.Parallel()
+
+	seq := "nextval('users_id_seq'::regclass)"
+	old := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true, Default: &seq}},
+			{ColumnName: "name", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+		},
+	}
+	newSchema := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigserial", IsPK: true, NotNull: true}},
+			{ColumnName: "email", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			{ColumnName: "name", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+		},
+		Indexes: []migrate.IndexMeta{{Columns: []string{"email"}}},
+	}
+	conName := "orders_user_id_fkey"
+	refs := []Reference{{
+		Table: "orders",
+		Column: migrate.ColumnMeta{
+			ColumnName: "user_id",
+			Attrs: migrate.ColumnAttributes{
+				ForeignKey:     &migrate.ForeignKey{Table: "users", Column: "id", OnDelete: migrate.Cascade},
+				ConstraintName: &conName,
+			},
+		},
+	}}
+
+	diff, err := NewDiffGenerator().RebuildTable(old, newSchema, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up := strings.Join(diff.Up, "\n")
+	want := []string{
+		`ALTER TABLE "orders" DROP CONSTRAINT IF EXISTS "orders_user_id_fkey"`,
+		`CREATE TABLE "users__rebuild" AS TABLE "users"`,
+		`DROP TABLE "users"`,
+		"CREATE TABLE IF NOT EXISTS \"users\" (\n  \"id\" bigserial NOT NULL,\n  \"email\" text,\n  \"name\" text",
+		`INSERT INTO "users" ("id", "name") SELECT "id", "name" FROM "users__rebuild"`,
+		`SELECT setval(pg_get_serial_sequence('"users"', 'id'), COALESCE(MAX("id"), 0) + 1, false) FROM "users"`,
+		`DROP TABLE "users__rebuild"`,
+		`CREATE INDEX`,
+		`ALTER TABLE "orders" ADD CONSTRAINT "orders_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE`,
+	}
+	prev := -1
+	for _, w := range want {
+		idx := strings.Index(up, w)
+		if idx < 0 || idx < prev {
+			t.Fatalf("expected %q after the previous statements in:\n%s", w, up)
+		}
+		prev = idx
+	}
+
+	// Rebuilding back recreates the sequence the nextval default relied on.
+	down := strings.Join(diff.Down, "\n")
+	if !strings.Contains(down, `"id" bigserial NOT NULL`) || strings.Contains(down, "nextval") {
+		t.Fatalf("down must recreate id as bigserial, got:\n%s", down)
+	}
+	if !strings.Contains(down, `INSERT INTO "users" ("id", "name") SELECT "id", "name" FROM "users__rebuild"`) {
+		t.Fatalf("down must copy the kept columns back, got:\n%s", down)
+	}
+}
+
+func TestRebuildTable_NewNotNullColumn(t *testing.T) {
+	t.Parallel()
+
+	old := migrate.TableSchema{
+		TableName: "users",
+		Columns: []migrate.ColumnMeta{
+			{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true}},
+			{ColumnName: "name", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+		},
+	}
+	table := func(email migrate.ColumnAttributes) migrate.TableSchema {
+		return migrate.TableSchema{
+			TableName: "users",
+			Columns: []migrate.ColumnMeta{
+				{ColumnName: "id", Attrs: migrate.ColumnAttributes{PgType: "bigint", IsPK: true, NotNull: true}},
+				{ColumnName: "email", Attrs: email},
+				{ColumnName: "name", Attrs: migrate.ColumnAttributes{PgType: "text"}},
+			},
+		}
+	}
+
+	// The copied rows have no email, so the INSERT would fail halfway
+	// through the migration.
+	_, err := NewDiffGenerator().RebuildTable(old, table(migrate.ColumnAttributes{PgType: "text", NotNull: true}), nil)
+	if err == nil || !strings.Contains(err.Error(), "email") {
+		t.Fatalf("expected the new NOT NULL column email to be rejected, got %v", err)
+	}
+
+	empty := "''"
+	diff, err := NewDiffGenerator().RebuildTable(old, table(migrate.ColumnAttributes{PgType: "text", NotNull: true, Default: &empty}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(diff.Up, "\n"), `"email" text NOT NULL DEFAULT ''`) {
+		t.Errorf("expected email to be created with its default, got:\n%s", strings.Join(diff.Up, "\n"))
+	}
+	if _, err := NewDiffGenerator().RebuildTable(old, table(migrate.ColumnAttributes{PgType: "bigserial", NotNull: true}), nil); err != nil {
+		t.Errorf("a serial column fills itself: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// SnapshotVersion is the version of the snapshot file format.
+const SnapshotVersion = 1
+
+// Snapshot is a point-in-time copy of a set of table schemas, written by
+// `schema dump` and read back as a diff source.
+type Snapshot struct {
+	Version int                   `json:"version"`
+	Tables  []migrate.TableSchema `json:"tables"`
+}
+
+// NewSnapshot normalizes tables and sorts them by name.
+func NewSnapshot(tables []migrate.TableSchema) Snapshot {
+	out := make([]migrate.TableSchema, 0, len(tables))
+	for _, t := range tables {
+		out = append(out, migrate.NormalizeSchema(t))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TableName < out[j].TableName })
+	return Snapshot{Version: SnapshotVersion, Tables: out}
+}
+
+func WriteSnapshot(w io.Writer, s Snapshot) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+func ReadSnapshot(r io.Reader) (Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return Snapshot{}, fmt.Errorf("decode snapshot: %w", err)
+	}
+	if s.Version != SnapshotVersion {
+		return Snapshot{}, fmt.Errorf("unsupported snapshot version %d (expected %d)", s.Version, SnapshotVersion)
+	}
+	return s, nil
+}
+
+func LoadSnapshot(path string) (Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer f.Close()
+
+	s, err := ReadSnapshot(f)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
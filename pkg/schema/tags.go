@@ -0,0 +1,215 @@
+package schema
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// tagFlags and tagKeys are the options migrate.ParseColumnTag understands,
+// besides the column name.
+var (
+	tagFlags = map[string]bool{
+		"pk": true, "notnull": true, "unique": true, "deferrable": true, "initially_deferred": true,
+		"nulls_not_distinct": true, "ci": true, "pk_uuid": true,
+	}
+	tagKeys = map[string]bool{
+		"type": true, "default": true, "fk": true, "delete": true, "update": true, "sql": true, "using": true,
+		"match": true, "anon": true,
+	}
+)
+
+var foreignKeyActions = map[string]bool{
+	"CASCADE": true, "SET NULL": true, "SET DEFAULT": true, "RESTRICT": true, "NO ACTION": true,
+}
+
+// pgTypeRe accepts type names the way they can be written in a column
+// definition: optionally schema-qualified, multi-word (double precision),
+// with a length or precision modifier, a time zone clause and array brackets.
+var pgTypeRe = regexp.MustCompile(`(?i)^[a-z_][a-z0-9_$]*(\.[a-z_][a-z0-9_$]*)?( [a-z_][a-z0-9_]*)*` +
+	`(\s*\(\s*\d+\s*(,\s*\d+\s*)?\))?( with(out)? time zone)?(\s*\[\d*\])*$`)
+
+// CheckTags reports db tags that migrate.ParseColumnTag would silently ignore
+// or misread, and combinations that produce failing or redundant SQL: unknown
+// options, unparseable type=, fk= and delete=/update= values, defaults on
+// serial columns, unique on a primary key and foreign keys to tables or
+// columns no entity declares. Names are compared after policy is applied, as
+// the registry does. Each diagnostic points at the field declaration; codes
+// ignored on the entity or field are skipped.
+func CheckTags(entities []migrate.EntityInfo, policy migrate.IdentifierPolicy) []diagnostics.Diagnostic {
+	columns := make(map[string]map[string]bool, len(entities))
+	for _, e := range entities {
+		s := policy.Apply(BuildSchema(e))
+		cols := make(map[string]bool, len(s.Columns))
+		for _, c := range s.Columns {
+			cols[c.ColumnName] = true
+		}
+		columns[s.TableName] = cols
+	}
+
+	var found []diagnostics.Diagnostic
+	for _, e := range entities {
+		for _, f := range e.Fields {
+			file, line := f.FilePath, f.Line
+			if file == "" {
+				file, line = e.FilePath, e.Line
+			}
+			for _, d := range checkFieldTag(e.TableName, f, policy, columns) {
+				if diagnostics.Ignored(f.Ignore, d.Code) || diagnostics.Ignored(e.Ignore, d.Code) {
+					continue
+				}
+				found = append(found, d.At(file, line))
+			}
+		}
+	}
+	return found
+}
+
+func checkFieldTag(table string, f migrate.FieldInfo, policy migrate.IdentifierPolicy, columns map[string]map[string]bool) []diagnostics.Diagnostic {
+	raw := columnTag(f)
+	if raw == "" || migrate.Excluded(raw) {
+		return nil
+	}
+	field := table + "." + f.FieldName
+
+	var found []diagnostics.Diagnostic
+	opts := make(map[string]string)
+	for _, p := range migrate.SplitTagOptions(raw)[1:] {
+		p = strings.TrimSpace(p)
+		key, value, isKey := strings.Cut(p, "=")
+		switch {
+		case !isKey && tagFlags[p]:
+			opts[p] = ""
+		case isKey && tagKeys[key]:
+			opts[key] = value
+		case p == "":
+			found = append(found, diagnostics.Warningf(diagnostics.InvalidTag,
+				"%s: empty option in db tag %q", field, raw))
+		default:
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+				"%s: unknown db tag option %q", field, p))
+		}
+	}
+
+	_, pk := opts["pk"]
+	_, uuidPK := opts["pk_uuid"]
+	_, unique := opts["unique"]
+	_, hasDefault := opts["default"]
+	typ, hasType := opts["type"]
+
+	if hasType {
+		if strings.Count(typ, "(") != strings.Count(typ, ")") || !pgTypeRe.MatchString(strings.TrimSpace(typ)) {
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+				"%s: cannot parse type=%q", field, typ))
+		} else if isSerialType(typ) && hasDefault {
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+				"%s: %s columns get their default from a sequence, remove default=", field, typ))
+		}
+	}
+	if uuidPK {
+		if pk {
+			found = append(found, diagnostics.Warningf(diagnostics.RedundantTag,
+				"%s: pk is redundant next to pk_uuid", field))
+		}
+		if hasType && !strings.EqualFold(strings.TrimSpace(typ), "uuid") {
+			found = append(found, diagnostics.Warningf(diagnostics.InvalidTag,
+				"%s: pk_uuid declares a uuid column, but type=%s overrides it", field, typ))
+		}
+		pk = true
+	}
+	if pk && unique {
+		found = append(found, diagnostics.Warningf(diagnostics.RedundantTag,
+			"%s: unique is redundant on a primary key column", field))
+	}
+	if _, ci := opts["ci"]; ci && hasType && !migrate.IsStringType(typ) {
+		found = append(found, diagnostics.Warningf(diagnostics.RedundantTag,
+			"%s: ci has no effect on %s columns", field, typ))
+	}
+	if anon, ok := opts["anon"]; ok {
+		rule, err := migrate.ParseAnonRule(anon)
+		switch {
+		case err != nil:
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag, "%s: %v", field, err))
+		case rule == migrate.AnonNull && migrate.ParseColumnTag(raw).NotNull:
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+				"%s: anon=null cannot be used on a NOT NULL column", field))
+		case rule == migrate.AnonHash && hasType && strings.EqualFold(strings.TrimSpace(typ), "uuid"):
+		case rule != migrate.AnonNull && hasType && !migrate.IsStringType(typ):
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+				"%s: anon=%s produces text and cannot be used on %s columns", field, rule, typ))
+		}
+	}
+	if _, nnd := opts["nulls_not_distinct"]; nnd && !unique {
+		found = append(found, diagnostics.Warningf(diagnostics.RedundantTag,
+			"%s: nulls_not_distinct has no effect without unique", field))
+	}
+
+	fk, hasFK := opts["fk"]
+	for _, key := range []string{"delete", "update"} {
+		action, ok := opts[key]
+		if !ok {
+			continue
+		}
+		if !hasFK {
+			found = append(found, diagnostics.Warningf(diagnostics.RedundantTag,
+				"%s: %s= has no effect without fk=", field, key))
+		}
+		base, list, hasList := strings.Cut(action, "(")
+		upper := strings.ToUpper(strings.TrimSpace(base))
+		switch {
+		case !foreignKeyActions[upper]:
+			d := diagnostics.Errorf(diagnostics.InvalidTag, "%s: unknown %s action %q", field, key, base)
+			if spaced := strings.ReplaceAll(upper, "_", " "); foreignKeyActions[spaced] {
+				d.Message += ", write " + key + "=" + strings.ToLower(spaced)
+			}
+			found = append(found, d)
+		case !hasList:
+		case key != "delete":
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+				"%s: column lists are only allowed in delete=, not %s=", field, key))
+		case upper != "SET NULL" && upper != "SET DEFAULT":
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+				"%s: a column list needs delete=set null or delete=set default, not %s", field, strings.ToLower(upper)))
+		case !strings.HasSuffix(strings.TrimSpace(list), ")") || strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(list), ")")) == "":
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+				"%s: cannot parse %s=%q, write %s=%s(column, ...)", field, key, action, key, strings.ToLower(upper)))
+		}
+	}
+	if match, ok := opts["match"]; ok {
+		if !hasFK {
+			found = append(found, diagnostics.Warningf(diagnostics.RedundantTag,
+				"%s: match= has no effect without fk=", field))
+		}
+		if m := migrate.MatchType(strings.ToUpper(strings.TrimSpace(match))); m != migrate.MatchFull && m != migrate.MatchSimple {
+			found = append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+				"%s: unknown match=%q, write match=full or match=simple", field, match))
+		}
+	}
+	for _, flag := range []string{"deferrable", "initially_deferred"} {
+		if _, ok := opts[flag]; ok && !hasFK {
+			found = append(found, diagnostics.Warningf(diagnostics.RedundantTag,
+				"%s: %s has no effect without fk=", field, flag))
+		}
+	}
+	if !hasFK {
+		return found
+	}
+
+	refTable, refColumn, ok := strings.Cut(fk, ".")
+	if !ok || refTable == "" || refColumn == "" || strings.Contains(refColumn, ".") {
+		return append(found, diagnostics.Errorf(diagnostics.InvalidTag,
+			"%s: fk=%q must be table.column", field, fk))
+	}
+	cols, known := columns[policy.Ident(refTable)]
+	switch {
+	case !known:
+		found = append(found, diagnostics.Errorf(diagnostics.UnknownReference,
+			"%s: fk=%s references table %q, which no entity declares", field, fk, refTable))
+	case !cols[policy.Ident(refColumn)]:
+		found = append(found, diagnostics.Errorf(diagnostics.UnknownReference,
+			"%s: fk=%s references column %q, which entity %q does not declare", field, fk, refColumn, refTable))
+	}
+	return found
+}
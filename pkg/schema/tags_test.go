@@ -0,0 +1,88 @@
+package schema
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/amr0ny/migrateme/pkg/diagnostics"
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+func TestCheckTags(t *testing.T) {
+	t.Parallel()
+
+	users := migrate.EntityInfo{
+		StructName: "User",
+		TableName:  "users",
+		FilePath:   "domain/user.go",
+		Line:       5,
+		Fields: []migrate.FieldInfo{
+			{FieldName: "ID", ColumnName: "id", RawTag: `db:"id,pk,unique,type=serial,default=1"`, FilePath: "domain/base.go", Line: 8},
+			{FieldName: "Price", ColumnName: "price", RawTag: `db:"price,type=numeric(10,2)"`, FilePath: "domain/user.go", Line: 7},
+			{FieldName: "Name", ColumnName: "name", RawTag: `db:"name,type=varchar(,nullable"`, FilePath: "domain/user.go", Line: 8},
+			{FieldName: "Email", ColumnName: "email", RawTag: `db:"email,type=text,uniq"`, FilePath: "domain/user.go", Line: 9},
+			{FieldName: "Token", ColumnName: "token", RawTag: `db:"token,pk_uuid,unique,type=text"`, FilePath: "domain/user.go", Line: 10},
+			{FieldName: "Phone", ColumnName: "phone", RawTag: `db:"phone,notnull,anon=null"`, FilePath: "domain/user.go", Line: 11},
+			{FieldName: "Age", ColumnName: "age", RawTag: `db:"age,type=integer,anon=fake_email"`, FilePath: "domain/user.go", Line: 12},
+		},
+	}
+	orders := migrate.EntityInfo{
+		StructName: "Order",
+		TableName:  "orders",
+		FilePath:   "domain/order.go",
+		Fields: []migrate.FieldInfo{
+			{FieldName: "UserID", ColumnName: "user_id", RawTag: `db:"user_id,type=integer,fk=users.uid,delete=set_null"`, FilePath: "domain/order.go", Line: 3},
+			{FieldName: "ShopID", ColumnName: "shop_id", RawTag: `db:"shop_id,type=uuid,fk=shops.id"`, FilePath: "domain/order.go", Line: 4},
+			{FieldName: "Kind", ColumnName: "kind", RawTag: `db:"kind,fk=kinds"`, FilePath: "domain/order.go", Line: 5, Ignore: []string{string(diagnostics.InvalidTag)}},
+			{FieldName: "Note", ColumnName: "note", RawTag: `db:"note,type=text,update=cascade"`, FilePath: "domain/order.go", Line: 6},
+			{FieldName: "EditorID", ColumnName: "editor_id", RawTag: `db:"editor_id,type=integer,fk=users.id,delete=cascade(editor_id)"`, FilePath: "domain/order.go", Line: 7},
+			{FieldName: "ReviewerID", ColumnName: "reviewer_id", RawTag: `db:"reviewer_id,type=integer,fk=users.id,delete=set null (reviewer_id)"`, FilePath: "domain/order.go", Line: 8},
+		},
+	}
+
+	found := CheckTags([]migrate.EntityInfo{users, orders}, migrate.IdentifiersPreserve)
+
+	want := []struct {
+		code     diagnostics.Code
+		severity diagnostics.Severity
+		at       string
+		message  string
+	}{
+		{diagnostics.InvalidTag, diagnostics.Error, "domain/base.go:8", "remove default="},
+		{diagnostics.RedundantTag, diagnostics.Warning, "domain/base.go:8", "unique is redundant"},
+		{diagnostics.InvalidTag, diagnostics.Error, "domain/user.go:8", `cannot parse type="varchar(,nullable"`},
+		{diagnostics.InvalidTag, diagnostics.Error, "domain/user.go:9", `unknown db tag option "uniq"`},
+		{diagnostics.InvalidTag, diagnostics.Warning, "domain/user.go:10", "type=text overrides it"},
+		{diagnostics.RedundantTag, diagnostics.Warning, "domain/user.go:10", "unique is redundant"},
+		{diagnostics.InvalidTag, diagnostics.Error, "domain/user.go:11", "anon=null cannot be used on a NOT NULL column"},
+		{diagnostics.InvalidTag, diagnostics.Error, "domain/user.go:12", "cannot be used on integer columns"},
+		{diagnostics.InvalidTag, diagnostics.Error, "domain/order.go:3", "write delete=set null"},
+		{diagnostics.UnknownReference, diagnostics.Error, "domain/order.go:3", `column "uid"`},
+		{diagnostics.UnknownReference, diagnostics.Error, "domain/order.go:4", `table "shops"`},
+		{diagnostics.RedundantTag, diagnostics.Warning, "domain/order.go:6", "update= has no effect without fk="},
+		{diagnostics.InvalidTag, diagnostics.Error, "domain/order.go:7", "column list needs delete=set null"},
+	}
+	if len(found) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %v", len(found), len(want), found)
+	}
+	for i, w := range want {
+		d := found[i]
+		at := d.File + ":" + strconv.Itoa(d.Line)
+		if d.Code != w.code || d.Severity != w.severity || at != w.at || !strings.Contains(d.Message, w.message) {
+			t.Errorf("diagnostic %d = %v, want %s %s at %s containing %q", i, d, w.severity, w.code, w.at, w.message)
+		}
+	}
+}
+
+func TestCheckTags_AppliesIdentifierPolicy(t *testing.T) {
+	t.Parallel()
+
+	entities := []migrate.EntityInfo{
+		{TableName: "UserAccounts", Fields: []migrate.FieldInfo{{FieldName: "ID", ColumnName: "ID", RawTag: `db:"ID,pk,type=uuid"`}}},
+		{TableName: "orders", Fields: []migrate.FieldInfo{{FieldName: "Owner", ColumnName: "owner", RawTag: `db:"owner,type=uuid,fk=user_accounts.id"`}}},
+	}
+	if found := CheckTags(entities, migrate.IdentifiersSnakeCase); len(found) != 0 {
+		t.Errorf("unexpected diagnostics: %v", found)
+	}
+}
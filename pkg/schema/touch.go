@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"strings"
+
+	"github.com/amr0ny/migrateme/pkg/migrate"
+)
+
+// UpdatedAtColumn is the column WithTouchUpdatedAt keeps current.
+const UpdatedAtColumn = "updated_at"
+
+// touchFunction is shared by the tables of every entity; creating it again
+// for each of them replaces it with the same body.
+const touchFunction = "set_updated_at"
+
+// WithTouchUpdatedAt adds to s a trigger setting UpdatedAtColumn to now() on
+// every update, so the column stays current whatever the application
+// writes. Tables without a timestamp updated_at column are returned as is.
+func WithTouchUpdatedAt(s migrate.TableSchema) migrate.TableSchema {
+	touched := false
+	for _, c := range s.Columns {
+		if c.ColumnName == UpdatedAtColumn {
+			touched = strings.HasPrefix(migrate.NormalizePgType(c.Attrs.PgType), "timestamp")
+		}
+	}
+	if !touched {
+		return s
+	}
+
+	s.Triggers = append(append([]migrate.TriggerMeta(nil), s.Triggers...), migrate.TriggerMeta{
+		Name:     s.TableName + "_set_updated_at",
+		Timing:   "BEFORE",
+		Events:   []string{"UPDATE"},
+		Function: touchFunction,
+		FunctionSQL: `CREATE OR REPLACE FUNCTION ` + quoteIdent(touchFunction) + `() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  NEW.` + quoteIdent(UpdatedAtColumn) + ` = now();
+  RETURN NEW;
+END
+$$`,
+	})
+	return s
+}
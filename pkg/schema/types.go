@@ -0,0 +1,123 @@
+package schema
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var typeModifierRE = regexp.MustCompile(`^([a-z ]+?)\s*\((\d+)(?:\s*,\s*(\d+))?\)$`)
+
+// integer widening chain: a cast to any later type in the list is safe.
+var integerRank = map[string]int{"smallint": 1, "integer": 2, "bigint": 3, "numeric": 4}
+
+// integerDigits is the number of decimal digits an integer type can hold.
+var integerDigits = map[string]int{"smallint": 5, "integer": 10, "bigint": 19}
+
+// IsLossyTypeChange reports whether converting a column from one (normalized)
+// Postgres type to another may lose or reject existing data.
+func IsLossyTypeChange(from, to string) bool {
+	from = strings.TrimSpace(strings.ToLower(from))
+	to = strings.TrimSpace(strings.ToLower(to))
+
+	if from == to || to == "text" {
+		return false
+	}
+
+	fromBase, fromLen, fromScale := splitTypeModifier(from)
+	toBase, toLen, toScale := splitTypeModifier(to)
+
+	if fromBase == "numeric" && toBase == "numeric" {
+		// Unconstrained numeric holds anything; otherwise both the scale and
+		// the digits before the decimal point must not shrink.
+		switch {
+		case toLen == 0:
+			return false
+		case fromLen == 0:
+			return true
+		}
+		return toScale < fromScale || toLen-toScale < fromLen-fromScale
+	}
+
+	if fr, ok := integerRank[fromBase]; ok {
+		if tr, ok := integerRank[toBase]; ok {
+			if toBase == "numeric" && toLen > 0 {
+				return toLen-toScale < integerDigits[fromBase]
+			}
+			return tr < fr
+		}
+	}
+
+	switch {
+	case fromBase == "real" && toBase == "double precision":
+		return false
+	case fromBase == "timestamp" && toBase == "timestamptz":
+		return false
+	case fromBase == "date" && (toBase == "timestamp" || toBase == "timestamptz"):
+		return false
+	case (fromBase == "varchar" || fromBase == "char") && toBase == "varchar",
+		fromBase == "bit varying" && toBase == "bit varying":
+		return toLen > 0 && (fromLen == 0 || toLen < fromLen)
+	case fromBase == "char" && toBase == "char":
+		return toLen < fromLen
+	}
+
+	return true
+}
+
+// IsNarrowingChange reports whether a type change keeps the base type but
+// shrinks its length, precision or scale, e.g. varchar(255) to varchar(50)
+// or numeric(12,4) to numeric(10,2).
+func IsNarrowingChange(from, to string) bool {
+	fromBase, _, _ := splitTypeModifier(strings.TrimSpace(strings.ToLower(from)))
+	toBase, _, _ := splitTypeModifier(strings.TrimSpace(strings.ToLower(to)))
+	return fromBase == toBase && IsLossyTypeChange(from, to)
+}
+
+// splitTypeModifier splits "varchar(255)" into ("varchar", 255, 0) and
+// "numeric(10,2)" into ("numeric", 10, 2).
+func splitTypeModifier(t string) (string, int, int) {
+	m := typeModifierRE.FindStringSubmatch(t)
+	if m == nil {
+		return t, 0, 0
+	}
+	a, _ := strconv.Atoi(m[2])
+	b, _ := strconv.Atoi(m[3])
+	return strings.TrimSpace(m[1]), a, b
+}
+
+// TypeChangeKind classifies a column type change by its risk to existing data.
+type TypeChangeKind string
+
+const (
+	// TypeChangeSafe converts every value without loss, e.g. integer to bigint.
+	TypeChangeSafe TypeChangeKind = "safe"
+	// TypeChangeNarrowing shrinks a length, precision or scale of the same
+	// type, e.g. varchar(255) to varchar(50).
+	TypeChangeNarrowing TypeChangeKind = "narrowing"
+	// TypeChangeLossy converts to another type that may reject or alter
+	// values, e.g. text to integer or bigint to integer.
+	TypeChangeLossy TypeChangeKind = "lossy"
+)
+
+// ClassifyTypeChange returns the kind of converting a column from one
+// (normalized) type to another.
+func ClassifyTypeChange(from, to string) TypeChangeKind {
+	switch {
+	case !IsLossyTypeChange(from, to):
+		return TypeChangeSafe
+	case IsNarrowingChange(from, to):
+		return TypeChangeNarrowing
+	default:
+		return TypeChangeLossy
+	}
+}
+
+// TypeChange is a column type change that needs explicit approval.
+type TypeChange struct {
+	Table  string         `json:"table"`
+	Column string         `json:"column"`
+	From   string         `json:"from"`
+	To     string         `json:"to"`
+	Kind   TypeChangeKind `json:"kind"`
+}
@@ -0,0 +1,82 @@
+package schema
+
+import "testing"
+
+func TestIsLossyTypeChange(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		from, to string
+		lossy    bool
+	}{
+		{"integer", "bigint", false},
+		{"bigint", "integer", true},
+		{"text", "integer", true},
+		{"integer", "text", false},
+		{"varchar(50)", "varchar(255)", false},
+		{"varchar(255)", "varchar(50)", true},
+		{"varchar(50)", "varchar", false},
+		{"timestamp", "timestamptz", false},
+		{"timestamptz", "timestamp", true},
+		{"real", "double precision", false},
+		{"numeric(10,2)", "numeric(12,4)", false},
+		{"numeric(12,4)", "numeric(10,2)", true},
+		{"numeric(10,2)", "numeric(10,4)", true},
+		{"numeric(10,2)", "numeric", false},
+		{"numeric", "numeric(10,2)", true},
+		{"integer", "numeric(12,2)", false},
+		{"bigint", "numeric(12,2)", true},
+		{"char(2)", "char(4)", false},
+		{"char(4)", "char(2)", true},
+	}
+
+	for _, tc := range cases {
+		if got := IsLossyTypeChange(tc.from, tc.to); got != tc.lossy {
+			t.Errorf("IsLossyTypeChange(%q, %q) = %v, want %v", tc.from, tc.to, got, tc.lossy)
+		}
+	}
+}
+
+func TestIsNarrowingChange(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		from, to  string
+		narrowing bool
+	}{
+		{"varchar(255)", "varchar(50)", true},
+		{"varchar", "varchar(50)", true},
+		{"varchar(50)", "varchar(255)", false},
+		{"numeric(12,4)", "numeric(10,2)", true},
+		{"numeric(10,2)", "numeric(12,4)", false},
+		{"bigint", "integer", false},
+		{"varchar(50)", "integer", false},
+	}
+
+	for _, tc := range cases {
+		if got := IsNarrowingChange(tc.from, tc.to); got != tc.narrowing {
+			t.Errorf("IsNarrowingChange(%q, %q) = %v, want %v", tc.from, tc.to, got, tc.narrowing)
+		}
+	}
+}
+
+func TestClassifyTypeChange(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		from, to string
+		kind     TypeChangeKind
+	}{
+		{"integer", "bigint", TypeChangeSafe},
+		{"varchar(50)", "text", TypeChangeSafe},
+		{"varchar(255)", "varchar(50)", TypeChangeNarrowing},
+		{"bigint", "integer", TypeChangeLossy},
+		{"text", "integer", TypeChangeLossy},
+	}
+
+	for _, tc := range cases {
+		if got := ClassifyTypeChange(tc.from, tc.to); got != tc.kind {
+			t.Errorf("ClassifyTypeChange(%q, %q) = %s, want %s", tc.from, tc.to, got, tc.kind)
+		}
+	}
+}
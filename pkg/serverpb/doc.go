@@ -0,0 +1,10 @@
+// Package serverpb holds the gRPC API of migrateme serve, generated from
+// migrations.proto. Clients dial the server and call the Migrations
+// service:
+//
+//	conn, _ := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+//	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+//	resp, err := serverpb.NewMigrationsClient(conn).Plan(ctx, &serverpb.Request{Service: "billing"})
+package serverpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative migrations.proto
@@ -0,0 +1,323 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: migrations.proto
+
+package serverpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Request is the request of every method.
+type Request struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Service is an entry of services in the config, or empty for the
+	// top-level settings.
+	Service string `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	// Group scopes the request to the entities and migrations of a group.
+	Group string `protobuf:"bytes,2,opt,name=group,proto3" json:"group,omitempty"`
+	// Steps is the number of migrations Rollback reverts, 1 when zero.
+	Steps         int32 `protobuf:"varint,3,opt,name=steps,proto3" json:"steps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Request) Reset() {
+	*x = Request{}
+	mi := &file_migrations_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Request) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Request) ProtoMessage() {}
+
+func (x *Request) ProtoReflect() protoreflect.Message {
+	mi := &file_migrations_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Request.ProtoReflect.Descriptor instead.
+func (*Request) Descriptor() ([]byte, []int) {
+	return file_migrations_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Request) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *Request) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *Request) GetSteps() int32 {
+	if x != nil {
+		return x.Steps
+	}
+	return 0
+}
+
+// Response is the result of every method; fields a method does not fill
+// are empty.
+type Response struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Service       string                 `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	Applied       []string               `protobuf:"bytes,2,rep,name=applied,proto3" json:"applied,omitempty"`
+	Pending       []string               `protobuf:"bytes,3,rep,name=pending,proto3" json:"pending,omitempty"`
+	Plan          []*PendingMigration    `protobuf:"bytes,4,rep,name=plan,proto3" json:"plan,omitempty"`
+	Ran           []string               `protobuf:"bytes,5,rep,name=ran,proto3" json:"ran,omitempty"`
+	Reverted      []string               `protobuf:"bytes,6,rep,name=reverted,proto3" json:"reverted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	mi := &file_migrations_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_migrations_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_migrations_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Response) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *Response) GetApplied() []string {
+	if x != nil {
+		return x.Applied
+	}
+	return nil
+}
+
+func (x *Response) GetPending() []string {
+	if x != nil {
+		return x.Pending
+	}
+	return nil
+}
+
+func (x *Response) GetPlan() []*PendingMigration {
+	if x != nil {
+		return x.Plan
+	}
+	return nil
+}
+
+func (x *Response) GetRan() []string {
+	if x != nil {
+		return x.Ran
+	}
+	return nil
+}
+
+func (x *Response) GetReverted() []string {
+	if x != nil {
+		return x.Reverted
+	}
+	return nil
+}
+
+// PendingMigration is a migration Apply would run.
+type PendingMigration struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Migration  string                 `protobuf:"bytes,1,opt,name=migration,proto3" json:"migration,omitempty"`
+	Statements int32                  `protobuf:"varint,2,opt,name=statements,proto3" json:"statements,omitempty"`
+	// SQL is what Apply would execute, templates rendered and timeouts set.
+	Sql           string `protobuf:"bytes,3,opt,name=sql,proto3" json:"sql,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PendingMigration) Reset() {
+	*x = PendingMigration{}
+	mi := &file_migrations_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PendingMigration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PendingMigration) ProtoMessage() {}
+
+func (x *PendingMigration) ProtoReflect() protoreflect.Message {
+	mi := &file_migrations_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PendingMigration.ProtoReflect.Descriptor instead.
+func (*PendingMigration) Descriptor() ([]byte, []int) {
+	return file_migrations_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PendingMigration) GetMigration() string {
+	if x != nil {
+		return x.Migration
+	}
+	return ""
+}
+
+func (x *PendingMigration) GetStatements() int32 {
+	if x != nil {
+		return x.Statements
+	}
+	return 0
+}
+
+func (x *PendingMigration) GetSql() string {
+	if x != nil {
+		return x.Sql
+	}
+	return ""
+}
+
+var File_migrations_proto protoreflect.FileDescriptor
+
+const file_migrations_proto_rawDesc = "" +
+	"\n" +
+	"\x10migrations.proto\x12\x13migrateme.server.v1\"O\n" +
+	"\aRequest\x12\x18\n" +
+	"\aservice\x18\x01 \x01(\tR\aservice\x12\x14\n" +
+	"\x05group\x18\x02 \x01(\tR\x05group\x12\x14\n" +
+	"\x05steps\x18\x03 \x01(\x05R\x05steps\"\xc1\x01\n" +
+	"\bResponse\x12\x18\n" +
+	"\aservice\x18\x01 \x01(\tR\aservice\x12\x18\n" +
+	"\aapplied\x18\x02 \x03(\tR\aapplied\x12\x18\n" +
+	"\apending\x18\x03 \x03(\tR\apending\x129\n" +
+	"\x04plan\x18\x04 \x03(\v2%.migrateme.server.v1.PendingMigrationR\x04plan\x12\x10\n" +
+	"\x03ran\x18\x05 \x03(\tR\x03ran\x12\x1a\n" +
+	"\breverted\x18\x06 \x03(\tR\breverted\"b\n" +
+	"\x10PendingMigration\x12\x1c\n" +
+	"\tmigration\x18\x01 \x01(\tR\tmigration\x12\x1e\n" +
+	"\n" +
+	"statements\x18\x02 \x01(\x05R\n" +
+	"statements\x12\x10\n" +
+	"\x03sql\x18\x03 \x01(\tR\x03sql2\xa7\x02\n" +
+	"\n" +
+	"Migrations\x12E\n" +
+	"\x06Status\x12\x1c.migrateme.server.v1.Request\x1a\x1d.migrateme.server.v1.Response\x12C\n" +
+	"\x04Plan\x12\x1c.migrateme.server.v1.Request\x1a\x1d.migrateme.server.v1.Response\x12D\n" +
+	"\x05Apply\x12\x1c.migrateme.server.v1.Request\x1a\x1d.migrateme.server.v1.Response\x12G\n" +
+	"\bRollback\x12\x1c.migrateme.server.v1.Request\x1a\x1d.migrateme.server.v1.ResponseB*Z(github.com/amr0ny/migrateme/pkg/serverpbb\x06proto3"
+
+var (
+	file_migrations_proto_rawDescOnce sync.Once
+	file_migrations_proto_rawDescData []byte
+)
+
+func file_migrations_proto_rawDescGZIP() []byte {
+	file_migrations_proto_rawDescOnce.Do(func() {
+		file_migrations_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_migrations_proto_rawDesc), len(file_migrations_proto_rawDesc)))
+	})
+	return file_migrations_proto_rawDescData
+}
+
+var file_migrations_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_migrations_proto_goTypes = []any{
+	(*Request)(nil),          // 0: migrateme.server.v1.Request
+	(*Response)(nil),         // 1: migrateme.server.v1.Response
+	(*PendingMigration)(nil), // 2: migrateme.server.v1.PendingMigration
+}
+var file_migrations_proto_depIdxs = []int32{
+	2, // 0: migrateme.server.v1.Response.plan:type_name -> migrateme.server.v1.PendingMigration
+	0, // 1: migrateme.server.v1.Migrations.Status:input_type -> migrateme.server.v1.Request
+	0, // 2: migrateme.server.v1.Migrations.Plan:input_type -> migrateme.server.v1.Request
+	0, // 3: migrateme.server.v1.Migrations.Apply:input_type -> migrateme.server.v1.Request
+	0, // 4: migrateme.server.v1.Migrations.Rollback:input_type -> migrateme.server.v1.Request
+	1, // 5: migrateme.server.v1.Migrations.Status:output_type -> migrateme.server.v1.Response
+	1, // 6: migrateme.server.v1.Migrations.Plan:output_type -> migrateme.server.v1.Response
+	1, // 7: migrateme.server.v1.Migrations.Apply:output_type -> migrateme.server.v1.Response
+	1, // 8: migrateme.server.v1.Migrations.Rollback:output_type -> migrateme.server.v1.Response
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_migrations_proto_init() }
+func file_migrations_proto_init() {
+	if File_migrations_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_migrations_proto_rawDesc), len(file_migrations_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_migrations_proto_goTypes,
+		DependencyIndexes: file_migrations_proto_depIdxs,
+		MessageInfos:      file_migrations_proto_msgTypes,
+	}.Build()
+	File_migrations_proto = out.File
+	file_migrations_proto_goTypes = nil
+	file_migrations_proto_depIdxs = nil
+}
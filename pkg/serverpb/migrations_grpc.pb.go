@@ -0,0 +1,259 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: migrations.proto
+
+package serverpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Migrations_Status_FullMethodName   = "/migrateme.server.v1.Migrations/Status"
+	Migrations_Plan_FullMethodName     = "/migrateme.server.v1.Migrations/Plan"
+	Migrations_Apply_FullMethodName    = "/migrateme.server.v1.Migrations/Apply"
+	Migrations_Rollback_FullMethodName = "/migrateme.server.v1.Migrations/Rollback"
+)
+
+// MigrationsClient is the client API for Migrations service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Migrations plans and applies the migrations of the databases configured
+// as services of a migrateme config, for a central migrations service.
+//
+// Every call must carry the metadata "authorization: Bearer <token>".
+// Apply and Rollback are written to the audit log, with the caller named
+// in the "x-migrateme-actor" metadata.
+type MigrationsClient interface {
+	// Status returns the applied and pending migrations.
+	Status(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	// Plan returns the pending migrations with the SQL Apply would execute.
+	Plan(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	// Apply applies the pending migrations under the run lock, with strict
+	// checksums.
+	Apply(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	// Rollback reverts the last steps applied migrations.
+	Rollback(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+}
+
+type migrationsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMigrationsClient(cc grpc.ClientConnInterface) MigrationsClient {
+	return &migrationsClient{cc}
+}
+
+func (c *migrationsClient) Status(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Migrations_Status_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *migrationsClient) Plan(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Migrations_Plan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *migrationsClient) Apply(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Migrations_Apply_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *migrationsClient) Rollback(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Migrations_Rollback_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MigrationsServer is the server API for Migrations service.
+// All implementations must embed UnimplementedMigrationsServer
+// for forward compatibility.
+//
+// Migrations plans and applies the migrations of the databases configured
+// as services of a migrateme config, for a central migrations service.
+//
+// Every call must carry the metadata "authorization: Bearer <token>".
+// Apply and Rollback are written to the audit log, with the caller named
+// in the "x-migrateme-actor" metadata.
+type MigrationsServer interface {
+	// Status returns the applied and pending migrations.
+	Status(context.Context, *Request) (*Response, error)
+	// Plan returns the pending migrations with the SQL Apply would execute.
+	Plan(context.Context, *Request) (*Response, error)
+	// Apply applies the pending migrations under the run lock, with strict
+	// checksums.
+	Apply(context.Context, *Request) (*Response, error)
+	// Rollback reverts the last steps applied migrations.
+	Rollback(context.Context, *Request) (*Response, error)
+	mustEmbedUnimplementedMigrationsServer()
+}
+
+// UnimplementedMigrationsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMigrationsServer struct{}
+
+func (UnimplementedMigrationsServer) Status(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedMigrationsServer) Plan(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Plan not implemented")
+}
+func (UnimplementedMigrationsServer) Apply(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Apply not implemented")
+}
+func (UnimplementedMigrationsServer) Rollback(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rollback not implemented")
+}
+func (UnimplementedMigrationsServer) mustEmbedUnimplementedMigrationsServer() {}
+func (UnimplementedMigrationsServer) testEmbeddedByValue()                    {}
+
+// UnsafeMigrationsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MigrationsServer will
+// result in compilation errors.
+type UnsafeMigrationsServer interface {
+	mustEmbedUnimplementedMigrationsServer()
+}
+
+func RegisterMigrationsServer(s grpc.ServiceRegistrar, srv MigrationsServer) {
+	// If the following call pancis, it indicates UnimplementedMigrationsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Migrations_ServiceDesc, srv)
+}
+
+func _Migrations_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationsServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Migrations_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationsServer).Status(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Migrations_Plan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationsServer).Plan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Migrations_Plan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationsServer).Plan(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Migrations_Apply_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationsServer).Apply(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Migrations_Apply_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationsServer).Apply(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Migrations_Rollback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MigrationsServer).Rollback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Migrations_Rollback_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MigrationsServer).Rollback(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Migrations_ServiceDesc is the grpc.ServiceDesc for Migrations service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Migrations_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "migrateme.server.v1.Migrations",
+	HandlerType: (*MigrationsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Status",
+			Handler:    _Migrations_Status_Handler,
+		},
+		{
+			MethodName: "Plan",
+			Handler:    _Migrations_Plan_Handler,
+		},
+		{
+			MethodName: "Apply",
+			Handler:    _Migrations_Apply_Handler,
+		},
+		{
+			MethodName: "Rollback",
+			Handler:    _Migrations_Rollback_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "migrations.proto",
+}